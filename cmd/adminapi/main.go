@@ -30,13 +30,17 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/codes"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/issueapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/statsapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/grpcapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/otp"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit/limitware"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
-	"github.com/google/exposure-notifications-server/pkg/observability"
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/server"
 
 	"github.com/gorilla/handlers"
@@ -71,10 +75,16 @@ func realMain(ctx context.Context) error {
 		return fmt.Errorf("failed to process config: %w", err)
 	}
 
+	// Verify the entropy source for code generation before accepting traffic.
+	if err := otp.SelfTest(cfg.RequireFIPSRandomness); err != nil {
+		return fmt.Errorf("entropy self-test failed: %w", err)
+	}
+	logger.Infow("entropy self-test passed", "fips", cfg.RequireFIPSRandomness)
+
 	// Setup monitoring
 	logger.Info("configuring observability exporter")
 	oeConfig := cfg.ObservabilityExporterConfig()
-	oe, err := observability.NewFromEnv(oeConfig)
+	oe, err := enobservability.NewFromEnv(oeConfig)
 	if err != nil {
 		return fmt.Errorf("unable to create ObservabilityExporter provider: %w", err)
 	}
@@ -84,6 +94,19 @@ func realMain(ctx context.Context) error {
 	defer oe.Close()
 	logger.Infow("observability exporter", "config", oeConfig)
 
+	sampleRate, err := observability.ConfigureTracing(oeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to configure tracing: %w", err)
+	}
+	logger.Infow("trace sampling", "rate", sampleRate, "sampleErrors", cfg.Tracing.SampleErrors)
+
+	// Serve metrics for scraping, in addition to the exporter.
+	if cfg.MetricsPort != "" {
+		if err := observability.ServeMetrics(ctx, cfg.MetricsPort); err != nil {
+			return fmt.Errorf("failed to serve metrics: %w", err)
+		}
+	}
+
 	// Setup cacher
 	cacher, err := cache.CacherFor(ctx, &cfg.Cache, cache.HMACKeyFunc(sha1.New, cfg.Cache.HMACKey))
 	if err != nil {
@@ -111,14 +134,52 @@ func realMain(ctx context.Context) error {
 	}
 	defer limiterStore.Close(ctx)
 
+	adaptive, err := ratelimit.NewAdaptive(ctx, &cfg.RateLimit)
+	if err != nil {
+		return fmt.Errorf("failed to create adaptive limit: %w", err)
+	}
+
 	httplimiter, err := limitware.NewMiddleware(ctx, limiterStore,
-		limitware.APIKeyFunc(ctx, db, "adminapi:ratelimit:", cfg.RateLimit.HMACKey),
-		limitware.AllowOnError(false))
+		limitware.APIKeyFunc(ctx, db, "adminapi:ratelimit:", cfg.RateLimit.HMACKey, cfg.RateLimit.ByAPIKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen),
+		limitware.Adaptive(adaptive))
 	if err != nil {
 		return fmt.Errorf("failed to create limiter middleware: %w", err)
 	}
 	rateLimit := httplimiter.Handle
 
+	// Route groups may configure their own limits.
+	groupStores := ratelimit.NewGroupStores(&cfg.RateLimit, limiterStore)
+	defer groupStores.Close(ctx)
+
+	issueStore, issueScope, err := groupStores.For(ctx, ratelimit.GroupIssue, "adminapi:ratelimit:")
+	if err != nil {
+		return fmt.Errorf("failed to create issue limiter: %w", err)
+	}
+	issueHTTPLimiter, err := limitware.NewMiddleware(ctx, issueStore,
+		limitware.APIKeyFunc(ctx, db, issueScope, cfg.RateLimit.HMACKey, cfg.RateLimit.ByAPIKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen),
+		limitware.Adaptive(adaptive))
+	if err != nil {
+		return fmt.Errorf("failed to create issue limiter middleware: %w", err)
+	}
+	issueRateLimit := issueHTTPLimiter.Handle
+
+	// Stats API keys are limited in their own scope, so that polling dashboards
+	// do not use up the realm's limit for issuing codes.
+	statsStore, statsScope, err := groupStores.For(ctx, ratelimit.GroupStats, "adminapi:stats:ratelimit:")
+	if err != nil {
+		return fmt.Errorf("failed to create stats limiter: %w", err)
+	}
+	statsHTTPLimiter, err := limitware.NewMiddleware(ctx, statsStore,
+		limitware.APIKeyFunc(ctx, db, statsScope, cfg.RateLimit.HMACKey, cfg.RateLimit.ByAPIKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen),
+		limitware.Adaptive(adaptive))
+	if err != nil {
+		return fmt.Errorf("failed to create stats limiter middleware: %w", err)
+	}
+	statsRateLimit := statsHTTPLimiter.Handle
+
 	// Install common security headers
 	r.Use(middleware.SecureHeaders(cfg.DevMode, "json"))
 
@@ -140,34 +201,73 @@ func realMain(ctx context.Context) error {
 	populateLogger := middleware.PopulateLogger(logger)
 	r.Use(populateLogger)
 
-	// Install the rate limiting first. In this case, we want to limit by key
-	// first to reduce the chance of a database lookup.
-	r.Use(rateLimit)
+	// Request tracing
+	r.Use(middleware.TraceRequests(cfg.Tracing.SampleErrors))
+
+	// Limit request body sizes
+	r.Use(middleware.LimitBodySize(h, cfg.BodyLimits.MaxBodyBytes))
+
+	// Compress large responses
+	if cfg.Compression.Enabled {
+		r.Use(middleware.CompressResponses(cfg.Compression.MinBytes))
+	}
 
 	// Other common middlewares
 	requireAPIKey := middleware.RequireAPIKey(cacher, db, h, []database.APIKeyType{
 		database.APIKeyTypeAdmin,
 	})
-	processFirewall := middleware.ProcessFirewall(h, "adminapi")
+	requireStatsAPIKey := middleware.RequireAPIKey(cacher, db, h, []database.APIKeyType{
+		database.APIKeyTypeStats,
+	})
+	processFirewall := middleware.ProcessFirewall(h, "adminapi", cfg.Proxy.TrustedProxies)
+	limitConcurrency := middleware.LimitConcurrency(ratelimit.NewConcurrency(), h)
+
+	// Install the rate limiting first on each route. In this case, we want to
+	// limit by key first to reduce the chance of a database lookup.
+	r.Handle("/health", rateLimit(controller.HandleHealthz(ctx, &cfg.Database, limiterStore, h))).Methods("GET")
+	r.Handle("/api/openapi.json", rateLimit(controller.HandleOpenAPI(h))).Methods("GET")
+
+	// Stats are registered before the other API routes so the /api prefix does
+	// not match them first.
+	{
+		sub := r.PathPrefix("/api/stats").Subrouter()
+		sub.Use(statsRateLimit)
+		sub.Use(requireStatsAPIKey)
+		sub.Use(processFirewall)
+
+		statsapiController := statsapi.New(ctx, db, cacher, h)
+		sub.Handle("/realm", statsapiController.HandleRealmStats()).Methods("GET")
+	}
 
-	r.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, h)).Methods("GET")
 	{
 		sub := r.PathPrefix("/api").Subrouter()
+		sub.Use(issueRateLimit)
 		sub.Use(requireAPIKey)
 		sub.Use(processFirewall)
+		sub.Use(limitConcurrency)
 
 		issueapiController := issueapi.New(ctx, cfg, db, limiterStore, h)
 		sub.Handle("/issue", issueapiController.HandleIssue()).Methods("POST")
+		sub.Handle("/batch-issue", middleware.LimitBodySize(h, cfg.BodyLimits.MaxBatchBodyBytes)(issueapiController.HandleBatchIssue())).Methods("POST")
 
 		codesController := codes.NewAPI(ctx, cfg, db, h)
 		sub.Handle("/checkcodestatus", codesController.HandleCheckCodeStatus()).Methods("POST")
 		sub.Handle("/expirecode", codesController.HandleExpireAPI()).Methods("POST")
 	}
 
+	handler := handlers.CombinedLoggingHandler(os.Stdout, r)
+
+	// Serve the gRPC API, which forwards each RPC to the HTTP routes above.
+	if cfg.GRPCPort != "" {
+		if err := grpcapi.Serve(ctx, cfg.GRPCPort, grpcapi.NewAdminAPI(handler)); err != nil {
+			return fmt.Errorf("failed to serve grpc: %w", err)
+		}
+	}
+
 	srv, err := server.New(cfg.Port)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 	logger.Infow("server listening", "port", cfg.Port)
-	return srv.ServeHTTPHandler(ctx, handlers.CombinedLoggingHandler(os.Stdout, r))
+	return srv.ServeHTTPHandler(ctx, handler)
 }
@@ -26,19 +26,24 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/captcha"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/appconfig"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/certapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/verifyapi"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/grpcapi"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit/limitware"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/google/exposure-notifications-verification-server/pkg/selftest"
 
 	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/logging"
-	"github.com/google/exposure-notifications-server/pkg/observability"
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/server"
 
 	"github.com/gorilla/handlers"
@@ -77,7 +82,7 @@ func realMain(ctx context.Context) error {
 	// Setup monitoring
 	logger.Info("configuring observability exporter")
 	oeConfig := cfg.ObservabilityExporterConfig()
-	oe, err := observability.NewFromEnv(oeConfig)
+	oe, err := enobservability.NewFromEnv(oeConfig)
 	if err != nil {
 		return fmt.Errorf("unable to create ObservabilityExporter provider: %w", err)
 	}
@@ -87,6 +92,19 @@ func realMain(ctx context.Context) error {
 	defer oe.Close()
 	logger.Infow("observability exporter", "config", oeConfig)
 
+	sampleRate, err := observability.ConfigureTracing(oeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to configure tracing: %w", err)
+	}
+	logger.Infow("trace sampling", "rate", sampleRate, "sampleErrors", cfg.Tracing.SampleErrors)
+
+	// Serve metrics for scraping, in addition to the exporter.
+	if cfg.MetricsPort != "" {
+		if err := observability.ServeMetrics(ctx, cfg.MetricsPort); err != nil {
+			return fmt.Errorf("failed to serve metrics: %w", err)
+		}
+	}
+
 	// Setup cacher
 	cacher, err := cache.CacherFor(ctx, &cfg.Cache, cache.HMACKeyFunc(sha1.New, cfg.Cache.HMACKey))
 	if err != nil {
@@ -114,6 +132,18 @@ func realMain(ctx context.Context) error {
 		return fmt.Errorf("failed to create certificate key manager: %w", err)
 	}
 
+	// Check the database and token signing with a throwaway code.
+	if cfg.SelfTest {
+		if err := selftest.Run(ctx, db, tokenSigner, &selftest.Config{
+			RealmName:   cfg.SelfTestRealmName,
+			TokenIssuer: cfg.TokenSigning.TokenIssuer,
+			TokenKeyID:  cfg.TokenSigning.ActiveKeyID(),
+			TokenKey:    cfg.TokenSigning.ActiveKey(),
+		}); err != nil {
+			return fmt.Errorf("self-test failed: %w", err)
+		}
+	}
+
 	// Create the router
 	r := mux.NewRouter()
 
@@ -126,14 +156,46 @@ func realMain(ctx context.Context) error {
 
 	// Note that rate limiting is installed _after_ the chaff middleware because
 	// we do not want chaff requests to count towards rate-limiting quota.
+	adaptive, err := ratelimit.NewAdaptive(ctx, &cfg.RateLimit)
+	if err != nil {
+		return fmt.Errorf("failed to create adaptive limit: %w", err)
+	}
+
 	httplimiter, err := limitware.NewMiddleware(ctx, limiterStore,
-		limitware.APIKeyFunc(ctx, db, "apiserver:ratelimit:", cfg.RateLimit.HMACKey),
-		limitware.AllowOnError(false))
+		limitware.APIKeyFunc(ctx, db, "apiserver:ratelimit:", cfg.RateLimit.HMACKey, cfg.RateLimit.ByAPIKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen),
+		limitware.Adaptive(adaptive))
 	if err != nil {
 		return fmt.Errorf("failed to create limiter middleware: %w", err)
 	}
 	rateLimit := httplimiter.Handle
 
+	// Route groups may configure their own limits.
+	groupStores := ratelimit.NewGroupStores(&cfg.RateLimit, limiterStore)
+	defer groupStores.Close(ctx)
+
+	verifyStore, verifyScope, err := groupStores.For(ctx, ratelimit.GroupVerify, "apiserver:ratelimit:")
+	if err != nil {
+		return fmt.Errorf("failed to create verify limiter: %w", err)
+	}
+	verifyHTTPLimiter, err := limitware.NewMiddleware(ctx, verifyStore,
+		limitware.APIKeyFunc(ctx, db, verifyScope, cfg.RateLimit.HMACKey, cfg.RateLimit.ByAPIKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen),
+		limitware.Adaptive(adaptive))
+	if err != nil {
+		return fmt.Errorf("failed to create verify limiter middleware: %w", err)
+	}
+	verifyRateLimit := verifyHTTPLimiter.Handle
+
+	// Unauthenticated endpoints are rate limited by IP in their own scope.
+	publicLimiter, err := limitware.NewMiddleware(ctx, limiterStore,
+		limitware.IPAddressKeyFunc(ctx, "apiserver:ratelimit:public:", cfg.RateLimit.HMACKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen))
+	if err != nil {
+		return fmt.Errorf("failed to create public limiter middleware: %w", err)
+	}
+	publicRateLimit := publicLimiter.Handle
+
 	// Install common security headers
 	r.Use(middleware.SecureHeaders(cfg.DevMode, "json"))
 
@@ -155,13 +217,32 @@ func realMain(ctx context.Context) error {
 	populateLogger := middleware.PopulateLogger(logger)
 	r.Use(populateLogger)
 
+	// Request tracing
+	r.Use(middleware.TraceRequests(cfg.Tracing.SampleErrors))
+
+	// Limit request body sizes
+	r.Use(middleware.LimitBodySize(h, cfg.BodyLimits.MaxBodyBytes))
+
+	// Compress large responses
+	if cfg.Compression.Enabled {
+		r.Use(middleware.CompressResponses(cfg.Compression.MinBytes))
+	}
+
 	// Other common middlewares
 	requireAPIKey := middleware.RequireAPIKey(cacher, db, h, []database.APIKeyType{
 		database.APIKeyTypeDevice,
 	})
-	processFirewall := middleware.ProcessFirewall(h, "apiserver")
+	processFirewall := middleware.ProcessFirewall(h, "apiserver", cfg.Proxy.TrustedProxies)
+	limitConcurrency := middleware.LimitConcurrency(ratelimit.NewConcurrency(), h)
+
+	// CAPTCHA verification, for the endpoints listed in the configuration
+	captchaProvider, err := captcha.ProviderFor(ctx, &cfg.Captcha)
+	if err != nil {
+		return fmt.Errorf("failed to create captcha provider: %w", err)
+	}
 
-	r.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, h)).Methods("GET")
+	r.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, limiterStore, h)).Methods("GET")
+	r.Handle("/api/openapi.json", controller.HandleOpenAPI(h)).Methods("GET")
 
 	// Make verify chaff tracker.
 	verifyChaffTracker, err := chaff.NewTracker(chaff.NewJSONResponder(encodeVerifyResponse), chaff.DefaultCapacity)
@@ -182,14 +263,19 @@ func realMain(ctx context.Context) error {
 		sub.Use(requireAPIKey)
 		sub.Use(processFirewall)
 		sub.Use(middleware.ProcessChaff(db, verifyChaffTracker))
-		sub.Use(rateLimit)
+		sub.Use(limitConcurrency)
+		sub.Use(verifyRateLimit)
+		sub.Use(middleware.RequireCaptcha(captchaProvider, &cfg.Captcha, h, captcha.EndpointVerify, cfg.Proxy.TrustedProxies))
 
 		// POST /api/verify
-		verifyapiController, err := verifyapi.New(ctx, cfg, db, h, tokenSigner)
+		verifyapiController, err := verifyapi.New(ctx, cfg, db, limiterStore, h, tokenSigner)
 		if err != nil {
 			return fmt.Errorf("failed to create verify api controller: %w", err)
 		}
 		sub.Handle("", verifyapiController.HandleVerify()).Methods("POST")
+
+		// POST /api/verify/long
+		sub.Handle("/long", verifyapiController.HandleVerifyLong()).Methods("POST")
 	}
 
 	{
@@ -197,7 +283,8 @@ func realMain(ctx context.Context) error {
 		sub.Use(requireAPIKey)
 		sub.Use(processFirewall)
 		sub.Use(middleware.ProcessChaff(db, certChaffTracker))
-		sub.Use(rateLimit)
+		sub.Use(limitConcurrency)
+		sub.Use(verifyRateLimit)
 
 		// POST /api/certificate
 		certapiController, err := certapi.New(ctx, cfg, db, cacher, certificateSigner, h)
@@ -207,12 +294,43 @@ func realMain(ctx context.Context) error {
 		sub.Handle("", certapiController.HandleCertificate()).Methods("POST")
 	}
 
+	{
+		sub := r.PathPrefix("/api/app-config").Subrouter()
+		sub.Use(requireAPIKey)
+		sub.Use(processFirewall)
+		sub.Use(limitConcurrency)
+		sub.Use(rateLimit)
+
+		// GET /api/app-config
+		appconfigController := appconfig.New(ctx, cfg, db, cacher, h)
+		sub.Handle("", appconfigController.HandleShow()).Methods("GET")
+	}
+
+	{
+		sub := r.PathPrefix("/api/realm").Subrouter()
+		sub.Use(publicRateLimit)
+		sub.Use(middleware.RequireCaptcha(captchaProvider, &cfg.Captcha, h, captcha.EndpointRealmPublic, cfg.Proxy.TrustedProxies))
+
+		// GET /api/realm/{id}/public
+		appconfigController := appconfig.New(ctx, cfg, db, cacher, h)
+		sub.Handle("/{id}/public", appconfigController.HandlePublic()).Methods("GET")
+	}
+
+	handler := handlers.CombinedLoggingHandler(os.Stdout, r)
+
+	// Serve the gRPC API, which forwards each RPC to the HTTP routes above.
+	if cfg.GRPCPort != "" {
+		if err := grpcapi.Serve(ctx, cfg.GRPCPort, grpcapi.NewAPIServer(handler)); err != nil {
+			return fmt.Errorf("failed to serve grpc: %w", err)
+		}
+	}
+
 	srv, err := server.New(cfg.Port)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 	logger.Infow("server listening", "port", cfg.Port)
-	return srv.ServeHTTPHandler(ctx, handlers.CombinedLoggingHandler(os.Stdout, r))
+	return srv.ServeHTTPHandler(ctx, handler)
 }
 
 // makePadFromChaff makes a Padding structure from chaff data.
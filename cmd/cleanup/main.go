@@ -22,6 +22,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/blobstore"
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/cleanup"
@@ -103,11 +104,18 @@ func realMain(ctx context.Context) error {
 	populateLogger := middleware.PopulateLogger(logger)
 	r.Use(populateLogger)
 
-	cleanupController, err := cleanup.New(ctx, cfg, db, h)
+	// Setup blob storage for scheduled exports
+	bs, err := blobstore.BlobstoreFor(ctx, &cfg.Blobstore)
+	if err != nil {
+		return fmt.Errorf("failed to create blobstore: %w", err)
+	}
+
+	cleanupController, err := cleanup.New(ctx, cfg, db, bs, h)
 	if err != nil {
 		return fmt.Errorf("failed to create cleanup controller: %w", err)
 	}
 	r.Handle("/", cleanupController.HandleCleanup()).Methods("GET")
+	r.Handle("/exports", cleanupController.HandleExports()).Methods("GET")
 
 	srv, err := server.New(cfg.Port)
 	if err != nil {
@@ -144,7 +144,7 @@ func realMain(ctx context.Context) error {
 		wk.PathPrefix("/assetlinks.json").Handler(assocHandler.HandleAndroid()).Methods("GET")
 	}
 
-	r.Handle("/health", controller.HandleHealthz(ctx, nil, h)).Methods("GET")
+	r.Handle("/health", controller.HandleHealthz(ctx, nil, nil, h)).Methods("GET")
 
 	redirectController, err := redirect.New(ctx, db, cfg, cacher, h)
 	if err != nil {
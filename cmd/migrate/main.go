@@ -64,6 +64,10 @@ func realMain(ctx context.Context) error {
 		return fmt.Errorf("failed to process config: %w", err)
 	}
 
+	// This command manages migrations itself, so never apply or verify them
+	// when connecting.
+	cfg.Migrations = database.MigrationModeNone
+
 	db, err := cfg.Load(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to load database config: %w", err)
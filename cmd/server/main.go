@@ -26,11 +26,13 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/otp"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 
 	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/logging"
-	"github.com/google/exposure-notifications-server/pkg/observability"
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/server"
 
 	"github.com/gorilla/handlers"
@@ -64,10 +66,16 @@ func realMain(ctx context.Context) error {
 		return fmt.Errorf("failed to process config: %w", err)
 	}
 
+	// Verify the entropy source for code generation before accepting traffic.
+	if err := otp.SelfTest(cfg.RequireFIPSRandomness); err != nil {
+		return fmt.Errorf("entropy self-test failed: %w", err)
+	}
+	logger.Infow("entropy self-test passed", "fips", cfg.RequireFIPSRandomness)
+
 	// Setup monitoring
 	logger.Info("configuring observability exporter")
 	oeConfig := cfg.ObservabilityExporterConfig()
-	oe, err := observability.NewFromEnv(oeConfig)
+	oe, err := enobservability.NewFromEnv(oeConfig)
 	if err != nil {
 		return fmt.Errorf("unable to create ObservabilityExporter provider: %w", err)
 	}
@@ -77,6 +85,19 @@ func realMain(ctx context.Context) error {
 	defer oe.Close()
 	logger.Infow("observability exporter", "config", oeConfig)
 
+	sampleRate, err := observability.ConfigureTracing(oeConfig)
+	if err != nil {
+		return fmt.Errorf("failed to configure tracing: %w", err)
+	}
+	logger.Infow("trace sampling", "rate", sampleRate, "sampleErrors", cfg.Tracing.SampleErrors)
+
+	// Serve metrics for scraping, in addition to the exporter.
+	if cfg.MetricsPort != "" {
+		if err := observability.ServeMetrics(ctx, cfg.MetricsPort); err != nil {
+			return fmt.Errorf("failed to serve metrics: %w", err)
+		}
+	}
+
 	// Setup cacher
 	cacher, err := cache.CacherFor(ctx, &cfg.Cache, cache.HMACKeyFunc(sha1.New, cfg.Cache.HMACKey))
 	if err != nil {
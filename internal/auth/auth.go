@@ -26,6 +26,10 @@ import (
 var (
 	ErrSessionMissing     = fmt.Errorf("session is missing")
 	ErrSessionInfoMissing = fmt.Errorf("session info is missing")
+
+	// ErrInvalidIDToken is returned by StoreSession when the provider rejects
+	// the ID token, as opposed to failing to check it.
+	ErrInvalidIDToken = fmt.Errorf("id token is invalid")
 )
 
 // InviteUserEmailFunc sends email with the given inviteLink.
@@ -86,8 +90,15 @@ type Provider interface {
 
 	// MFAEnabled returns true if MFA is enabled, false otherwise.
 	MFAEnabled(context.Context, *sessions.Session) (bool, error)
+
+	// SignInProvider returns the method the user used to sign in, such as
+	// SignInProviderPassword or the ID of an OIDC or SAML provider.
+	SignInProvider(context.Context, *sessions.Session) (string, error)
 }
 
+// SignInProviderPassword is the sign in provider for email and password login.
+const SignInProviderPassword = "password"
+
 // SessionInfo is a generic struct used to store session information. Not all
 // providers use all fields.
 type SessionInfo struct {
@@ -92,6 +92,13 @@ func (f *firebaseAuth) StoreSession(ctx context.Context, session *sessions.Sessi
 		return fmt.Errorf("missing id_token: %w", ErrSessionInfoMissing)
 	}
 
+	// Check the token before exchanging it, so a forged or expired token can be
+	// told apart from a failure to create the cookie.
+	if _, err := f.firebaseAuth.VerifyIDToken(ctx, idToken); err != nil {
+		f.ClearSession(ctx, session)
+		return fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
 	// Convert ID token to long-lived cookie
 	cookie, err := f.firebaseAuth.SessionCookie(ctx, idToken, i.TTL)
 	if err != nil {
@@ -210,6 +217,16 @@ func (f *firebaseAuth) MFAEnabled(ctx context.Context, session *sessions.Session
 	return data.MFAEnabled, nil
 }
 
+// SignInProvider returns the firebase sign_in_provider claim, which is
+// "password" for email and password login.
+func (f *firebaseAuth) SignInProvider(ctx context.Context, session *sessions.Session) (string, error) {
+	data, err := f.loadCookie(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return data.SignInProvider, nil
+}
+
 // ChangePassword changes the users password. The data must be an oobCode as a
 // string.
 func (f *firebaseAuth) ChangePassword(ctx context.Context, newPassword string, data interface{}) error {
@@ -309,10 +326,11 @@ func (f *firebaseAuth) emailVerificationLink(ctx context.Context, email string)
 }
 
 type firebaseCookieData struct {
-	UserID        string
-	Email         string
-	EmailVerified bool
-	MFAEnabled    bool
+	UserID         string
+	Email          string
+	EmailVerified  bool
+	MFAEnabled     bool
+	SignInProvider string
 }
 
 // dataFromCookie extracts the information from the provided firebase cookie, if
@@ -351,12 +369,14 @@ func (f *firebaseAuth) dataFromCookie(ctx context.Context, cookie string) (*fire
 		return nil, fmt.Errorf("token claims for firebase are missing")
 	}
 	_, mfaEnabled := firebase["sign_in_second_factor"]
+	signInProvider, _ := firebase["sign_in_provider"].(string)
 
 	return &firebaseCookieData{
-		UserID:        userID,
-		Email:         email,
-		EmailVerified: emailVerified,
-		MFAEnabled:    mfaEnabled,
+		UserID:         userID,
+		Email:          email,
+		EmailVerified:  emailVerified,
+		MFAEnabled:     mfaEnabled,
+		SignInProvider: signInProvider,
 	}, nil
 }
 
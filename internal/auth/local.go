@@ -164,6 +164,15 @@ func (a *localAuth) MFAEnabled(ctx context.Context, session *sessions.Session) (
 	return data.MFAEnabled, nil
 }
 
+// SignInProvider always returns SignInProviderPassword, since local auth
+// has no identity providers.
+func (a *localAuth) SignInProvider(ctx context.Context, session *sessions.Session) (string, error) {
+	if _, err := a.loadCookie(ctx, session); err != nil {
+		return "", err
+	}
+	return SignInProviderPassword, nil
+}
+
 // ChangePassword changes the users password. The data is not used. Since local
 // auth does not use passwords, this is a noop.
 func (a *localAuth) ChangePassword(ctx context.Context, newPassword string, data interface{}) error {
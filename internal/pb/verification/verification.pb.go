@@ -0,0 +1,1324 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.25.0
+// 	protoc        (unknown)
+// source: internal/pb/verification/verification.proto
+
+package verification
+
+import (
+	context "context"
+	reflect "reflect"
+	sync "sync"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// This is a compile-time assertion that a sufficiently up-to-date version
+// of the legacy proto package is being used.
+const _ = proto.ProtoPackageIsVersion4
+
+// IssueCodeRequest is the request to issue a verification code.
+type IssueCodeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// symptomDate and testDate are YYYY-MM-DD, RFC 3339, or seconds since the
+	// epoch. Epoch values are converted to a date using tzOffset.
+	SymptomDate string `protobuf:"bytes,1,opt,name=symptomDate,proto3" json:"symptomDate,omitempty"`
+	TestDate    string `protobuf:"bytes,2,opt,name=testDate,proto3" json:"testDate,omitempty"`
+	// testType is "confirmed", "likely", or "negative".
+	TestType string `protobuf:"bytes,3,opt,name=testType,proto3" json:"testType,omitempty"`
+	// tzOffset is the offset in minutes of the user's timezone from UTC.
+	TzOffset float32 `protobuf:"fixed32,4,opt,name=tzOffset,proto3" json:"tzOffset,omitempty"`
+	// phone is the optional phone number to send the code to by SMS.
+	Phone string `protobuf:"bytes,5,opt,name=phone,proto3" json:"phone,omitempty"`
+	// smsLocale is the optional language tag of the SMS, such as "es" or
+	// "fr-CA".
+	SmsLocale string `protobuf:"bytes,6,opt,name=smsLocale,proto3" json:"smsLocale,omitempty"`
+	// uuid is an optional handle to track the status of the code. If omitted,
+	// one is generated.
+	Uuid string `protobuf:"bytes,7,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	// externalIssuerID optionally identifies the entity making the request. It
+	// is stored as-is, so it must not contain PII.
+	ExternalIssuerID string `protobuf:"bytes,8,opt,name=externalIssuerID,proto3" json:"externalIssuerID,omitempty"`
+	// cohortID optionally tags codes issued for the same exposure event.
+	CohortID string `protobuf:"bytes,9,opt,name=cohortID,proto3" json:"cohortID,omitempty"`
+	// metadata is an optional set of key-value tags for later correlation.
+	Metadata map[string]string `protobuf:"bytes,10,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// supervisingUserEmail is the optional email of the supervising user.
+	SupervisingUserEmail string `protobuf:"bytes,11,opt,name=supervisingUserEmail,proto3" json:"supervisingUserEmail,omitempty"`
+	// maxClaims is the optional number of times the code may be claimed. It
+	// defaults to 1 and cannot be more than the realm allows.
+	MaxClaims uint32 `protobuf:"varint,12,opt,name=maxClaims,proto3" json:"maxClaims,omitempty"`
+	// email is the optional address to send the code to, if the realm sends codes
+	// by email.
+	Email string `protobuf:"bytes,13,opt,name=email,proto3" json:"email,omitempty"`
+	// emailLocale is the optional language tag of the email, like smsLocale.
+	EmailLocale string `protobuf:"bytes,14,opt,name=emailLocale,proto3" json:"emailLocale,omitempty"`
+}
+
+func (x *IssueCodeRequest) Reset() {
+	*x = IssueCodeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IssueCodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueCodeRequest) ProtoMessage() {}
+
+func (x *IssueCodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueCodeRequest.ProtoReflect.Descriptor instead.
+func (*IssueCodeRequest) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *IssueCodeRequest) GetSymptomDate() string {
+	if x != nil {
+		return x.SymptomDate
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetTestDate() string {
+	if x != nil {
+		return x.TestDate
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetTestType() string {
+	if x != nil {
+		return x.TestType
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetTzOffset() float32 {
+	if x != nil {
+		return x.TzOffset
+	}
+	return 0
+}
+
+func (x *IssueCodeRequest) GetPhone() string {
+	if x != nil {
+		return x.Phone
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetSmsLocale() string {
+	if x != nil {
+		return x.SmsLocale
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetExternalIssuerID() string {
+	if x != nil {
+		return x.ExternalIssuerID
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetCohortID() string {
+	if x != nil {
+		return x.CohortID
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *IssueCodeRequest) GetSupervisingUserEmail() string {
+	if x != nil {
+		return x.SupervisingUserEmail
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetMaxClaims() uint32 {
+	if x != nil {
+		return x.MaxClaims
+	}
+	return 0
+}
+
+func (x *IssueCodeRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *IssueCodeRequest) GetEmailLocale() string {
+	if x != nil {
+		return x.EmailLocale
+	}
+	return ""
+}
+
+// IssueCodeResponse is an issued verification code.
+type IssueCodeResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// uuid is the handle to track the status of the code.
+	Uuid string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+	// code is the verification code.
+	Code string `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	// expiresAt and expiresAtTimestamp are when the code expires, as an RFC 1123
+	// string and as seconds since the epoch.
+	ExpiresAt          string `protobuf:"bytes,3,opt,name=expiresAt,proto3" json:"expiresAt,omitempty"`
+	ExpiresAtTimestamp int64  `protobuf:"varint,4,opt,name=expiresAtTimestamp,proto3" json:"expiresAtTimestamp,omitempty"`
+	// longExpiresAt and longExpiresAtTimestamp are when the long code expires.
+	LongExpiresAt          string `protobuf:"bytes,5,opt,name=longExpiresAt,proto3" json:"longExpiresAt,omitempty"`
+	LongExpiresAtTimestamp int64  `protobuf:"varint,6,opt,name=longExpiresAtTimestamp,proto3" json:"longExpiresAtTimestamp,omitempty"`
+	// pendingApproval is true if the code must be approved before it is claimed.
+	PendingApproval bool `protobuf:"varint,7,opt,name=pendingApproval,proto3" json:"pendingApproval,omitempty"`
+	// claimToken, claimLink, and claimExpiresAtTimestamp are set if the server
+	// has claim links enabled.
+	ClaimToken              string `protobuf:"bytes,8,opt,name=claimToken,proto3" json:"claimToken,omitempty"`
+	ClaimLink               string `protobuf:"bytes,9,opt,name=claimLink,proto3" json:"claimLink,omitempty"`
+	ClaimExpiresAtTimestamp int64  `protobuf:"varint,10,opt,name=claimExpiresAtTimestamp,proto3" json:"claimExpiresAtTimestamp,omitempty"`
+	// smsDeliveryState is "sent", "failed", or "queued" when a phone number was
+	// given.
+	SmsDeliveryState string `protobuf:"bytes,11,opt,name=smsDeliveryState,proto3" json:"smsDeliveryState,omitempty"`
+	// codesRemaining and quotaResetsAtTimestamp describe the realm's daily
+	// quota. quotaResetsAtTimestamp is 0 if the realm has no quota.
+	CodesRemaining         uint64 `protobuf:"varint,12,opt,name=codesRemaining,proto3" json:"codesRemaining,omitempty"`
+	QuotaResetsAtTimestamp int64  `protobuf:"varint,13,opt,name=quotaResetsAtTimestamp,proto3" json:"quotaResetsAtTimestamp,omitempty"`
+	// error and errorCode are only set on failed codes in a batch.
+	Error     string `protobuf:"bytes,14,opt,name=error,proto3" json:"error,omitempty"`
+	ErrorCode string `protobuf:"bytes,15,opt,name=errorCode,proto3" json:"errorCode,omitempty"`
+	// emailDeliveryState is "sent" or "failed" when an email address was
+	// given.
+	EmailDeliveryState string `protobuf:"bytes,16,opt,name=emailDeliveryState,proto3" json:"emailDeliveryState,omitempty"`
+}
+
+func (x *IssueCodeResponse) Reset() {
+	*x = IssueCodeResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IssueCodeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IssueCodeResponse) ProtoMessage() {}
+
+func (x *IssueCodeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IssueCodeResponse.ProtoReflect.Descriptor instead.
+func (*IssueCodeResponse) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *IssueCodeResponse) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetExpiresAt() string {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetExpiresAtTimestamp() int64 {
+	if x != nil {
+		return x.ExpiresAtTimestamp
+	}
+	return 0
+}
+
+func (x *IssueCodeResponse) GetLongExpiresAt() string {
+	if x != nil {
+		return x.LongExpiresAt
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetLongExpiresAtTimestamp() int64 {
+	if x != nil {
+		return x.LongExpiresAtTimestamp
+	}
+	return 0
+}
+
+func (x *IssueCodeResponse) GetPendingApproval() bool {
+	if x != nil {
+		return x.PendingApproval
+	}
+	return false
+}
+
+func (x *IssueCodeResponse) GetClaimToken() string {
+	if x != nil {
+		return x.ClaimToken
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetClaimLink() string {
+	if x != nil {
+		return x.ClaimLink
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetClaimExpiresAtTimestamp() int64 {
+	if x != nil {
+		return x.ClaimExpiresAtTimestamp
+	}
+	return 0
+}
+
+func (x *IssueCodeResponse) GetSmsDeliveryState() string {
+	if x != nil {
+		return x.SmsDeliveryState
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetCodesRemaining() uint64 {
+	if x != nil {
+		return x.CodesRemaining
+	}
+	return 0
+}
+
+func (x *IssueCodeResponse) GetQuotaResetsAtTimestamp() int64 {
+	if x != nil {
+		return x.QuotaResetsAtTimestamp
+	}
+	return 0
+}
+
+func (x *IssueCodeResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetErrorCode() string {
+	if x != nil {
+		return x.ErrorCode
+	}
+	return ""
+}
+
+func (x *IssueCodeResponse) GetEmailDeliveryState() string {
+	if x != nil {
+		return x.EmailDeliveryState
+	}
+	return ""
+}
+
+// BatchIssueCodeRequest is the request to issue many codes.
+type BatchIssueCodeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Codes []*IssueCodeRequest `protobuf:"bytes,1,rep,name=codes,proto3" json:"codes,omitempty"`
+}
+
+func (x *BatchIssueCodeRequest) Reset() {
+	*x = BatchIssueCodeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchIssueCodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchIssueCodeRequest) ProtoMessage() {}
+
+func (x *BatchIssueCodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchIssueCodeRequest.ProtoReflect.Descriptor instead.
+func (*BatchIssueCodeRequest) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchIssueCodeRequest) GetCodes() []*IssueCodeRequest {
+	if x != nil {
+		return x.Codes
+	}
+	return nil
+}
+
+// BatchIssueCodeResponse has a result for each requested code, in order.
+type BatchIssueCodeResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Codes []*IssueCodeResponse `protobuf:"bytes,1,rep,name=codes,proto3" json:"codes,omitempty"`
+	// error summarizes the failed codes, if any.
+	Error string `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *BatchIssueCodeResponse) Reset() {
+	*x = BatchIssueCodeResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchIssueCodeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchIssueCodeResponse) ProtoMessage() {}
+
+func (x *BatchIssueCodeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchIssueCodeResponse.ProtoReflect.Descriptor instead.
+func (*BatchIssueCodeResponse) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchIssueCodeResponse) GetCodes() []*IssueCodeResponse {
+	if x != nil {
+		return x.Codes
+	}
+	return nil
+}
+
+func (x *BatchIssueCodeResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// CheckCodeStatusRequest is the request for the status of a code.
+type CheckCodeStatusRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// uuid is the handle returned when the code was issued.
+	Uuid string `protobuf:"bytes,1,opt,name=uuid,proto3" json:"uuid,omitempty"`
+}
+
+func (x *CheckCodeStatusRequest) Reset() {
+	*x = CheckCodeStatusRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CheckCodeStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckCodeStatusRequest) ProtoMessage() {}
+
+func (x *CheckCodeStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckCodeStatusRequest.ProtoReflect.Descriptor instead.
+func (*CheckCodeStatusRequest) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CheckCodeStatusRequest) GetUuid() string {
+	if x != nil {
+		return x.Uuid
+	}
+	return ""
+}
+
+// CheckCodeStatusResponse is the status of a code.
+type CheckCodeStatusResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// claimed is true if the code was exchanged for a token.
+	Claimed bool `protobuf:"varint,1,opt,name=claimed,proto3" json:"claimed,omitempty"`
+	// expiresAtTimestamp and longExpiresAtTimestamp are when the codes expire,
+	// in seconds since the epoch.
+	ExpiresAtTimestamp     int64 `protobuf:"varint,2,opt,name=expiresAtTimestamp,proto3" json:"expiresAtTimestamp,omitempty"`
+	LongExpiresAtTimestamp int64 `protobuf:"varint,3,opt,name=longExpiresAtTimestamp,proto3" json:"longExpiresAtTimestamp,omitempty"`
+	// metadata is the metadata the code was issued with.
+	Metadata map[string]string `protobuf:"bytes,4,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *CheckCodeStatusResponse) Reset() {
+	*x = CheckCodeStatusResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CheckCodeStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckCodeStatusResponse) ProtoMessage() {}
+
+func (x *CheckCodeStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckCodeStatusResponse.ProtoReflect.Descriptor instead.
+func (*CheckCodeStatusResponse) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CheckCodeStatusResponse) GetClaimed() bool {
+	if x != nil {
+		return x.Claimed
+	}
+	return false
+}
+
+func (x *CheckCodeStatusResponse) GetExpiresAtTimestamp() int64 {
+	if x != nil {
+		return x.ExpiresAtTimestamp
+	}
+	return 0
+}
+
+func (x *CheckCodeStatusResponse) GetLongExpiresAtTimestamp() int64 {
+	if x != nil {
+		return x.LongExpiresAtTimestamp
+	}
+	return 0
+}
+
+func (x *CheckCodeStatusResponse) GetMetadata() map[string]string {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+// VerifyCodeRequest is the request to exchange a code for a token.
+type VerifyCodeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// code is the short or long verification code.
+	Code string `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	// accept is the list of test types the app accepts. If empty, all test types
+	// are accepted.
+	Accept []string `protobuf:"bytes,2,rep,name=accept,proto3" json:"accept,omitempty"`
+	// deviceFingerprint is required if the realm binds tokens to devices.
+	DeviceFingerprint string `protobuf:"bytes,3,opt,name=deviceFingerprint,proto3" json:"deviceFingerprint,omitempty"`
+	// appId is required if the realm restricts which apps may claim codes.
+	AppId string `protobuf:"bytes,4,opt,name=appId,proto3" json:"appId,omitempty"`
+}
+
+func (x *VerifyCodeRequest) Reset() {
+	*x = VerifyCodeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VerifyCodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyCodeRequest) ProtoMessage() {}
+
+func (x *VerifyCodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyCodeRequest.ProtoReflect.Descriptor instead.
+func (*VerifyCodeRequest) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *VerifyCodeRequest) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *VerifyCodeRequest) GetAccept() []string {
+	if x != nil {
+		return x.Accept
+	}
+	return nil
+}
+
+func (x *VerifyCodeRequest) GetDeviceFingerprint() string {
+	if x != nil {
+		return x.DeviceFingerprint
+	}
+	return ""
+}
+
+func (x *VerifyCodeRequest) GetAppId() string {
+	if x != nil {
+		return x.AppId
+	}
+	return ""
+}
+
+// VerifyCodeResponse is the result of a verified code.
+type VerifyCodeResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// testType is the report type of the code.
+	TestType string `protobuf:"bytes,1,opt,name=testType,proto3" json:"testType,omitempty"`
+	// symptomDate and testDate are YYYY-MM-DD, if known.
+	SymptomDate string `protobuf:"bytes,2,opt,name=symptomDate,proto3" json:"symptomDate,omitempty"`
+	TestDate    string `protobuf:"bytes,3,opt,name=testDate,proto3" json:"testDate,omitempty"`
+	// token is the verification token to exchange for a certificate.
+	Token string `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`
+	// redirectURL is where web claim flows send the user next.
+	RedirectURL string `protobuf:"bytes,5,opt,name=redirectURL,proto3" json:"redirectURL,omitempty"`
+}
+
+func (x *VerifyCodeResponse) Reset() {
+	*x = VerifyCodeResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_pb_verification_verification_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VerifyCodeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyCodeResponse) ProtoMessage() {}
+
+func (x *VerifyCodeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_pb_verification_verification_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyCodeResponse.ProtoReflect.Descriptor instead.
+func (*VerifyCodeResponse) Descriptor() ([]byte, []int) {
+	return file_internal_pb_verification_verification_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *VerifyCodeResponse) GetTestType() string {
+	if x != nil {
+		return x.TestType
+	}
+	return ""
+}
+
+func (x *VerifyCodeResponse) GetSymptomDate() string {
+	if x != nil {
+		return x.SymptomDate
+	}
+	return ""
+}
+
+func (x *VerifyCodeResponse) GetTestDate() string {
+	if x != nil {
+		return x.TestDate
+	}
+	return ""
+}
+
+func (x *VerifyCodeResponse) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *VerifyCodeResponse) GetRedirectURL() string {
+	if x != nil {
+		return x.RedirectURL
+	}
+	return ""
+}
+
+var File_internal_pb_verification_verification_proto protoreflect.FileDescriptor
+
+var file_internal_pb_verification_verification_proto_rawDesc = []byte{
+	0x0a, 0x2b, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x62, 0x2f, 0x76, 0x65,
+	0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2f, 0x76, 0x65, 0x72, 0x69, 0x66,
+	0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0c, 0x76,
+	0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xa9, 0x04, 0x0a, 0x10,
+	0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x20, 0x0a, 0x0b, 0x73, 0x79, 0x6d, 0x70, 0x74, 0x6f, 0x6d, 0x44, 0x61, 0x74, 0x65, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x73, 0x79, 0x6d, 0x70, 0x74, 0x6f, 0x6d, 0x44, 0x61,
+	0x74, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x74, 0x65, 0x73, 0x74, 0x44, 0x61, 0x74, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x74, 0x65, 0x73, 0x74, 0x44, 0x61, 0x74, 0x65, 0x12, 0x1a,
+	0x0a, 0x08, 0x74, 0x65, 0x73, 0x74, 0x54, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x74, 0x65, 0x73, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x74, 0x7a,
+	0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x02, 0x52, 0x08, 0x74, 0x7a,
+	0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x68, 0x6f, 0x6e, 0x65, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x70, 0x68, 0x6f, 0x6e, 0x65, 0x12, 0x1c, 0x0a, 0x09,
+	0x73, 0x6d, 0x73, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x73, 0x6d, 0x73, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x75,
+	0x69, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x75, 0x69, 0x64, 0x12, 0x2a,
+	0x0a, 0x10, 0x65, 0x78, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x49, 0x73, 0x73, 0x75, 0x65, 0x72,
+	0x49, 0x44, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x65, 0x78, 0x74, 0x65, 0x72, 0x6e,
+	0x61, 0x6c, 0x49, 0x73, 0x73, 0x75, 0x65, 0x72, 0x49, 0x44, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6f,
+	0x68, 0x6f, 0x72, 0x74, 0x49, 0x44, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6f,
+	0x68, 0x6f, 0x72, 0x74, 0x49, 0x44, 0x12, 0x48, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61,
+	0x74, 0x61, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2c, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66,
+	0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x6f, 0x64,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74,
+	0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x32, 0x0a, 0x14, 0x73, 0x75, 0x70, 0x65, 0x72, 0x76, 0x69, 0x73, 0x69, 0x6e, 0x67, 0x55,
+	0x73, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x14,
+	0x73, 0x75, 0x70, 0x65, 0x72, 0x76, 0x69, 0x73, 0x69, 0x6e, 0x67, 0x55, 0x73, 0x65, 0x72, 0x45,
+	0x6d, 0x61, 0x69, 0x6c, 0x12, 0x1c, 0x0a, 0x09, 0x6d, 0x61, 0x78, 0x43, 0x6c, 0x61, 0x69, 0x6d,
+	0x73, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6d, 0x61, 0x78, 0x43, 0x6c, 0x61, 0x69,
+	0x6d, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x20, 0x0a, 0x0b, 0x65, 0x6d, 0x61, 0x69,
+	0x6c, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x65, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x65,
+	0x6d, 0x61, 0x69, 0x6c, 0x4c, 0x6f, 0x63, 0x61, 0x6c, 0x65, 0x1a, 0x3b, 0x0a, 0x0d, 0x4d, 0x65,
+	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0xf9, 0x04, 0x0a, 0x11, 0x49, 0x73, 0x73, 0x75,
+	0x65, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a,
+	0x04, 0x75, 0x75, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x75, 0x75, 0x69,
+	0x64, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73,
+	0x41, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65,
+	0x73, 0x41, 0x74, 0x12, 0x2e, 0x0a, 0x12, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74,
+	0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x12, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x12, 0x24, 0x0a, 0x0d, 0x6c, 0x6f, 0x6e, 0x67, 0x45, 0x78, 0x70, 0x69, 0x72,
+	0x65, 0x73, 0x41, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x6c, 0x6f, 0x6e, 0x67,
+	0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x12, 0x36, 0x0a, 0x16, 0x6c, 0x6f, 0x6e,
+	0x67, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x16, 0x6c, 0x6f, 0x6e, 0x67, 0x45,
+	0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x12, 0x28, 0x0a, 0x0f, 0x70, 0x65, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x41, 0x70, 0x70, 0x72,
+	0x6f, 0x76, 0x61, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0f, 0x70, 0x65, 0x6e, 0x64,
+	0x69, 0x6e, 0x67, 0x41, 0x70, 0x70, 0x72, 0x6f, 0x76, 0x61, 0x6c, 0x12, 0x1e, 0x0a, 0x0a, 0x63,
+	0x6c, 0x61, 0x69, 0x6d, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x63, 0x6c, 0x61, 0x69, 0x6d, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x1c, 0x0a, 0x09, 0x63,
+	0x6c, 0x61, 0x69, 0x6d, 0x4c, 0x69, 0x6e, 0x6b, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x63, 0x6c, 0x61, 0x69, 0x6d, 0x4c, 0x69, 0x6e, 0x6b, 0x12, 0x38, 0x0a, 0x17, 0x63, 0x6c, 0x61,
+	0x69, 0x6d, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x17, 0x63, 0x6c, 0x61, 0x69,
+	0x6d, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x12, 0x2a, 0x0a, 0x10, 0x73, 0x6d, 0x73, 0x44, 0x65, 0x6c, 0x69, 0x76, 0x65,
+	0x72, 0x79, 0x53, 0x74, 0x61, 0x74, 0x65, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x73,
+	0x6d, 0x73, 0x44, 0x65, 0x6c, 0x69, 0x76, 0x65, 0x72, 0x79, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12,
+	0x26, 0x0a, 0x0e, 0x63, 0x6f, 0x64, 0x65, 0x73, 0x52, 0x65, 0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e,
+	0x67, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0e, 0x63, 0x6f, 0x64, 0x65, 0x73, 0x52, 0x65,
+	0x6d, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x12, 0x36, 0x0a, 0x16, 0x71, 0x75, 0x6f, 0x74, 0x61,
+	0x52, 0x65, 0x73, 0x65, 0x74, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x03, 0x52, 0x16, 0x71, 0x75, 0x6f, 0x74, 0x61, 0x52, 0x65,
+	0x73, 0x65, 0x74, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12,
+	0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x12, 0x1c, 0x0a, 0x09, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f,
+	0x64, 0x65, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x43,
+	0x6f, 0x64, 0x65, 0x12, 0x2e, 0x0a, 0x12, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x44, 0x65, 0x6c, 0x69,
+	0x76, 0x65, 0x72, 0x79, 0x53, 0x74, 0x61, 0x74, 0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x12, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x44, 0x65, 0x6c, 0x69, 0x76, 0x65, 0x72, 0x79, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x22, 0x4d, 0x0a, 0x15, 0x42, 0x61, 0x74, 0x63, 0x68, 0x49, 0x73, 0x73, 0x75,
+	0x65, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x34, 0x0a, 0x05,
+	0x63, 0x6f, 0x64, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1e, 0x2e, 0x76, 0x65,
+	0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x49, 0x73, 0x73, 0x75, 0x65,
+	0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x05, 0x63, 0x6f, 0x64,
+	0x65, 0x73, 0x22, 0x65, 0x0a, 0x16, 0x42, 0x61, 0x74, 0x63, 0x68, 0x49, 0x73, 0x73, 0x75, 0x65,
+	0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x35, 0x0a, 0x05,
+	0x63, 0x6f, 0x64, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x76, 0x65,
+	0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x49, 0x73, 0x73, 0x75, 0x65,
+	0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x52, 0x05, 0x63, 0x6f,
+	0x64, 0x65, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x2c, 0x0a, 0x16, 0x43, 0x68, 0x65,
+	0x63, 0x6b, 0x43, 0x6f, 0x64, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x75, 0x75, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x75, 0x75, 0x69, 0x64, 0x22, 0xa9, 0x02, 0x0a, 0x17, 0x43, 0x68, 0x65, 0x63,
+	0x6b, 0x43, 0x6f, 0x64, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6c, 0x61, 0x69, 0x6d, 0x65, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x63, 0x6c, 0x61, 0x69, 0x6d, 0x65, 0x64, 0x12, 0x2e, 0x0a,
+	0x12, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x12, 0x65, 0x78, 0x70, 0x69, 0x72,
+	0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x36, 0x0a,
+	0x16, 0x6c, 0x6f, 0x6e, 0x67, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69,
+	0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x16, 0x6c,
+	0x6f, 0x6e, 0x67, 0x45, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x12, 0x4f, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74,
+	0x61, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x33, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69,
+	0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x43, 0x6f, 0x64, 0x65,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x2e, 0x4d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x6d, 0x65,
+	0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x1a, 0x3b, 0x0a, 0x0d, 0x4d, 0x65, 0x74, 0x61, 0x64, 0x61,
+	0x74, 0x61, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a,
+	0x02, 0x38, 0x01, 0x22, 0x83, 0x01, 0x0a, 0x11, 0x56, 0x65, 0x72, 0x69, 0x66, 0x79, 0x43, 0x6f,
+	0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x16, 0x0a,
+	0x06, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x06, 0x61,
+	0x63, 0x63, 0x65, 0x70, 0x74, 0x12, 0x2c, 0x0a, 0x11, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x46,
+	0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x11, 0x64, 0x65, 0x76, 0x69, 0x63, 0x65, 0x46, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72,
+	0x69, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x61, 0x70, 0x70, 0x49, 0x64, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x61, 0x70, 0x70, 0x49, 0x64, 0x22, 0xa6, 0x01, 0x0a, 0x12, 0x56, 0x65,
+	0x72, 0x69, 0x66, 0x79, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x74, 0x65, 0x73, 0x74, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x74, 0x65, 0x73, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x20, 0x0a, 0x0b,
+	0x73, 0x79, 0x6d, 0x70, 0x74, 0x6f, 0x6d, 0x44, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x73, 0x79, 0x6d, 0x70, 0x74, 0x6f, 0x6d, 0x44, 0x61, 0x74, 0x65, 0x12, 0x1a,
+	0x0a, 0x08, 0x74, 0x65, 0x73, 0x74, 0x44, 0x61, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x74, 0x65, 0x73, 0x74, 0x44, 0x61, 0x74, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x6f,
+	0x6b, 0x65, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74, 0x6f, 0x6b, 0x65, 0x6e,
+	0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x55, 0x52, 0x4c, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x55,
+	0x52, 0x4c, 0x32, 0xf2, 0x02, 0x0a, 0x0c, 0x56, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x12, 0x4e, 0x0a, 0x09, 0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x6f, 0x64, 0x65,
+	0x12, 0x1e, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
+	0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x1f, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e,
+	0x49, 0x73, 0x73, 0x75, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x12, 0x5d, 0x0a, 0x0e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x49, 0x73, 0x73, 0x75,
+	0x65, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x23, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x49, 0x73, 0x73, 0x75, 0x65, 0x43,
+	0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x76, 0x65, 0x72,
+	0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x49,
+	0x73, 0x73, 0x75, 0x65, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x60, 0x0a, 0x0f, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x43, 0x6f, 0x64, 0x65, 0x53,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x24, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61,
+	0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x43, 0x6f, 0x64, 0x65, 0x53, 0x74,
+	0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x25, 0x2e, 0x76, 0x65,
+	0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x68, 0x65, 0x63, 0x6b,
+	0x43, 0x6f, 0x64, 0x65, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x22, 0x00, 0x12, 0x51, 0x0a, 0x0a, 0x56, 0x65, 0x72, 0x69, 0x66, 0x79, 0x43, 0x6f,
+	0x64, 0x65, 0x12, 0x1f, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x2e, 0x56, 0x65, 0x72, 0x69, 0x66, 0x79, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x2e, 0x56, 0x65, 0x72, 0x69, 0x66, 0x79, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x64, 0x5a, 0x62, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x65, 0x78, 0x70,
+	0x6f, 0x73, 0x75, 0x72, 0x65, 0x2d, 0x6e, 0x6f, 0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x2d, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x2d, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c,
+	0x2f, 0x70, 0x62, 0x2f, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x3b, 0x76, 0x65, 0x72, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_internal_pb_verification_verification_proto_rawDescOnce sync.Once
+	file_internal_pb_verification_verification_proto_rawDescData = file_internal_pb_verification_verification_proto_rawDesc
+)
+
+func file_internal_pb_verification_verification_proto_rawDescGZIP() []byte {
+	file_internal_pb_verification_verification_proto_rawDescOnce.Do(func() {
+		file_internal_pb_verification_verification_proto_rawDescData = protoimpl.X.CompressGZIP(file_internal_pb_verification_verification_proto_rawDescData)
+	})
+	return file_internal_pb_verification_verification_proto_rawDescData
+}
+
+var file_internal_pb_verification_verification_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_internal_pb_verification_verification_proto_goTypes = []interface{}{
+	(*IssueCodeRequest)(nil),        // 0: verification.IssueCodeRequest
+	(*IssueCodeResponse)(nil),       // 1: verification.IssueCodeResponse
+	(*BatchIssueCodeRequest)(nil),   // 2: verification.BatchIssueCodeRequest
+	(*BatchIssueCodeResponse)(nil),  // 3: verification.BatchIssueCodeResponse
+	(*CheckCodeStatusRequest)(nil),  // 4: verification.CheckCodeStatusRequest
+	(*CheckCodeStatusResponse)(nil), // 5: verification.CheckCodeStatusResponse
+	(*VerifyCodeRequest)(nil),       // 6: verification.VerifyCodeRequest
+	(*VerifyCodeResponse)(nil),      // 7: verification.VerifyCodeResponse
+	nil,                             // 8: verification.IssueCodeRequest.MetadataEntry
+	nil,                             // 9: verification.CheckCodeStatusResponse.MetadataEntry
+}
+var file_internal_pb_verification_verification_proto_depIdxs = []int32{
+	8, // 0: verification.IssueCodeRequest.metadata:type_name -> verification.IssueCodeRequest.MetadataEntry
+	0, // 1: verification.BatchIssueCodeRequest.codes:type_name -> verification.IssueCodeRequest
+	1, // 2: verification.BatchIssueCodeResponse.codes:type_name -> verification.IssueCodeResponse
+	9, // 3: verification.CheckCodeStatusResponse.metadata:type_name -> verification.CheckCodeStatusResponse.MetadataEntry
+	0, // 4: verification.Verification.IssueCode:input_type -> verification.IssueCodeRequest
+	2, // 5: verification.Verification.BatchIssueCode:input_type -> verification.BatchIssueCodeRequest
+	4, // 6: verification.Verification.CheckCodeStatus:input_type -> verification.CheckCodeStatusRequest
+	6, // 7: verification.Verification.VerifyCode:input_type -> verification.VerifyCodeRequest
+	1, // 8: verification.Verification.IssueCode:output_type -> verification.IssueCodeResponse
+	3, // 9: verification.Verification.BatchIssueCode:output_type -> verification.BatchIssueCodeResponse
+	5, // 10: verification.Verification.CheckCodeStatus:output_type -> verification.CheckCodeStatusResponse
+	7, // 11: verification.Verification.VerifyCode:output_type -> verification.VerifyCodeResponse
+	8, // [8:12] is the sub-list for method output_type
+	4, // [4:8] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_internal_pb_verification_verification_proto_init() }
+func file_internal_pb_verification_verification_proto_init() {
+	if File_internal_pb_verification_verification_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_internal_pb_verification_verification_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IssueCodeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IssueCodeResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchIssueCodeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchIssueCodeResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CheckCodeStatusRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CheckCodeStatusResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VerifyCodeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_internal_pb_verification_verification_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VerifyCodeResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_internal_pb_verification_verification_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_pb_verification_verification_proto_goTypes,
+		DependencyIndexes: file_internal_pb_verification_verification_proto_depIdxs,
+		MessageInfos:      file_internal_pb_verification_verification_proto_msgTypes,
+	}.Build()
+	File_internal_pb_verification_verification_proto = out.File
+	file_internal_pb_verification_verification_proto_rawDesc = nil
+	file_internal_pb_verification_verification_proto_goTypes = nil
+	file_internal_pb_verification_verification_proto_depIdxs = nil
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// VerificationClient is the client API for Verification service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type VerificationClient interface {
+	// IssueCode issues a verification code, like POST /api/issue.
+	IssueCode(ctx context.Context, in *IssueCodeRequest, opts ...grpc.CallOption) (*IssueCodeResponse, error)
+	// BatchIssueCode issues many verification codes at once. The realm must
+	// allow bulk issuance. If only some codes fail, the RPC succeeds and the
+	// failed codes have error and errorCode set.
+	BatchIssueCode(ctx context.Context, in *BatchIssueCodeRequest, opts ...grpc.CallOption) (*BatchIssueCodeResponse, error)
+	// CheckCodeStatus returns the status of a code, like POST /api/checkcodestatus.
+	CheckCodeStatus(ctx context.Context, in *CheckCodeStatusRequest, opts ...grpc.CallOption) (*CheckCodeStatusResponse, error)
+	// VerifyCode exchanges a verification code for a token, like POST /api/verify.
+	VerifyCode(ctx context.Context, in *VerifyCodeRequest, opts ...grpc.CallOption) (*VerifyCodeResponse, error)
+}
+
+type verificationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewVerificationClient(cc grpc.ClientConnInterface) VerificationClient {
+	return &verificationClient{cc}
+}
+
+func (c *verificationClient) IssueCode(ctx context.Context, in *IssueCodeRequest, opts ...grpc.CallOption) (*IssueCodeResponse, error) {
+	out := new(IssueCodeResponse)
+	err := c.cc.Invoke(ctx, "/verification.Verification/IssueCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *verificationClient) BatchIssueCode(ctx context.Context, in *BatchIssueCodeRequest, opts ...grpc.CallOption) (*BatchIssueCodeResponse, error) {
+	out := new(BatchIssueCodeResponse)
+	err := c.cc.Invoke(ctx, "/verification.Verification/BatchIssueCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *verificationClient) CheckCodeStatus(ctx context.Context, in *CheckCodeStatusRequest, opts ...grpc.CallOption) (*CheckCodeStatusResponse, error) {
+	out := new(CheckCodeStatusResponse)
+	err := c.cc.Invoke(ctx, "/verification.Verification/CheckCodeStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *verificationClient) VerifyCode(ctx context.Context, in *VerifyCodeRequest, opts ...grpc.CallOption) (*VerifyCodeResponse, error) {
+	out := new(VerifyCodeResponse)
+	err := c.cc.Invoke(ctx, "/verification.Verification/VerifyCode", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// VerificationServer is the server API for Verification service.
+type VerificationServer interface {
+	// IssueCode issues a verification code, like POST /api/issue.
+	IssueCode(context.Context, *IssueCodeRequest) (*IssueCodeResponse, error)
+	// BatchIssueCode issues many verification codes at once. The realm must
+	// allow bulk issuance. If only some codes fail, the RPC succeeds and the
+	// failed codes have error and errorCode set.
+	BatchIssueCode(context.Context, *BatchIssueCodeRequest) (*BatchIssueCodeResponse, error)
+	// CheckCodeStatus returns the status of a code, like POST /api/checkcodestatus.
+	CheckCodeStatus(context.Context, *CheckCodeStatusRequest) (*CheckCodeStatusResponse, error)
+	// VerifyCode exchanges a verification code for a token, like POST /api/verify.
+	VerifyCode(context.Context, *VerifyCodeRequest) (*VerifyCodeResponse, error)
+}
+
+// UnimplementedVerificationServer can be embedded to have forward compatible implementations.
+type UnimplementedVerificationServer struct {
+}
+
+func (*UnimplementedVerificationServer) IssueCode(context.Context, *IssueCodeRequest) (*IssueCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IssueCode not implemented")
+}
+func (*UnimplementedVerificationServer) BatchIssueCode(context.Context, *BatchIssueCodeRequest) (*BatchIssueCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchIssueCode not implemented")
+}
+func (*UnimplementedVerificationServer) CheckCodeStatus(context.Context, *CheckCodeStatusRequest) (*CheckCodeStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckCodeStatus not implemented")
+}
+func (*UnimplementedVerificationServer) VerifyCode(context.Context, *VerifyCodeRequest) (*VerifyCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VerifyCode not implemented")
+}
+
+func RegisterVerificationServer(s *grpc.Server, srv VerificationServer) {
+	s.RegisterService(&_Verification_serviceDesc, srv)
+}
+
+func _Verification_IssueCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IssueCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VerificationServer).IssueCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/verification.Verification/IssueCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VerificationServer).IssueCode(ctx, req.(*IssueCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Verification_BatchIssueCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchIssueCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VerificationServer).BatchIssueCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/verification.Verification/BatchIssueCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VerificationServer).BatchIssueCode(ctx, req.(*BatchIssueCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Verification_CheckCodeStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckCodeStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VerificationServer).CheckCodeStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/verification.Verification/CheckCodeStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VerificationServer).CheckCodeStatus(ctx, req.(*CheckCodeStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Verification_VerifyCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VerificationServer).VerifyCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/verification.Verification/VerifyCode",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VerificationServer).VerifyCode(ctx, req.(*VerifyCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Verification_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "verification.Verification",
+	HandlerType: (*VerificationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "IssueCode",
+			Handler:    _Verification_IssueCode_Handler,
+		},
+		{
+			MethodName: "BatchIssueCode",
+			Handler:    _Verification_BatchIssueCode_Handler,
+		},
+		{
+			MethodName: "CheckCodeStatus",
+			Handler:    _Verification_CheckCodeStatus_Handler,
+		},
+		{
+			MethodName: "VerifyCode",
+			Handler:    _Verification_VerifyCode_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/pb/verification/verification.proto",
+}
@@ -22,7 +22,9 @@ import (
 
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/internal/i18n"
+	"github.com/google/exposure-notifications-verification-server/pkg/blobstore"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/captcha"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/admin"
@@ -35,8 +37,11 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/mobileapps"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmadmin"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmkeys"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/realmrequest"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/scim"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller/user"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit/limitware"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 	"github.com/sethvargo/go-limiter"
@@ -99,13 +104,59 @@ func Server(
 	populateLogger := middleware.PopulateLogger(logging.FromContext(ctx))
 	r.Use(populateLogger)
 
+	// Request tracing
+	r.Use(middleware.TraceRequests(cfg.Tracing.SampleErrors))
+
+	// Limit request body sizes. This must come before anything that reads the
+	// body, such as CSRF.
+	r.Use(middleware.LimitBodySize(h, cfg.BodyLimits.MaxBodyBytes))
+	limitBatchBody := middleware.LimitBodySize(h, cfg.BodyLimits.MaxBatchBodyBytes)
+
+	// Compress large responses.
+	if cfg.Compression.Enabled {
+		r.Use(middleware.CompressResponses(cfg.Compression.MinBytes))
+	}
+
 	httplimiter, err := limitware.NewMiddleware(ctx, limiterStore,
-		limitware.UserIDKeyFunc(ctx, "server:ratelimit:", cfg.RateLimit.HMACKey),
-		limitware.AllowOnError(false))
+		limitware.UserIDKeyFunc(ctx, "server:ratelimit:", cfg.RateLimit.HMACKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create limiter middleware: %w", err)
 	}
 
+	// System admin pages may configure their own limit. The stores created for
+	// route groups are closed when the server shuts down.
+	groupStores := ratelimit.NewGroupStores(&cfg.RateLimit, limiterStore)
+	go func() {
+		<-ctx.Done()
+		if err := groupStores.Close(context.Background()); err != nil {
+			logging.FromContext(ctx).Errorw("failed to close group limiters", "error", err)
+		}
+	}()
+
+	adminStore, adminScope, err := groupStores.For(ctx, ratelimit.GroupAdmin, "server:ratelimit:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin limiter: %w", err)
+	}
+	adminHTTPLimiter, err := limitware.NewMiddleware(ctx, adminStore,
+		limitware.UserIDKeyFunc(ctx, adminScope, cfg.RateLimit.HMACKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin limiter middleware: %w", err)
+	}
+
+	// Sign-ins are always limited by the client IP, since there is no user yet.
+	loginStore, loginScope, err := groupStores.For(ctx, ratelimit.GroupLogin, "server:ratelimit:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login limiter: %w", err)
+	}
+	loginHTTPLimiter, err := limitware.NewMiddleware(ctx, loginStore,
+		limitware.IPAddressKeyFunc(ctx, loginScope, cfg.RateLimit.HMACKey, cfg.Proxy.TrustedProxies),
+		limitware.AllowOnError(cfg.RateLimit.FailOpen))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create login limiter middleware: %w", err)
+	}
+
 	// Install common security headers
 	r.Use(middleware.SecureHeaders(cfg.DevMode, "html"))
 
@@ -118,22 +169,33 @@ func Server(
 	r.Use(configureCSRF)
 
 	// Sessions
-	requireSession := middleware.RequireSession(sessions, h)
+	requireSession := middleware.RequireSession(sessions, cacher, db, h, cfg.Proxy.TrustedProxies)
 	r.Use(requireSession)
 
 	// Include the current URI
 	currentPath := middleware.InjectCurrentPath()
 	r.Use(currentPath)
 
+	// Kiosk mode
+	processKiosk := middleware.ProcessKiosk(cfg.KioskFrameAncestors, cfg.KioskIdleTimeout)
+	r.Use(processKiosk)
+
 	// Create common middleware
-	requireAuth := middleware.RequireAuth(cacher, authProvider, db, h, cfg.SessionIdleTimeout, cfg.SessionDuration)
+	authenticate := middleware.RequireAuth(cacher, authProvider, db, h, cfg.SessionIdleTimeout, cfg.SessionDuration, cfg.Proxy.TrustedProxies)
+	// While impersonating, a system admin may only end the impersonation or sign
+	// out. Every authenticated route gets this restriction.
+	restrictImpersonation := middleware.RestrictImpersonation(h, "DELETE /impersonate", "/signout")
+	requireAuth := mux.MiddlewareFunc(func(next http.Handler) http.Handler {
+		return authenticate(restrictImpersonation(next))
+	})
 	requireVerified := middleware.RequireVerified(authProvider, db, h, cfg.SessionDuration)
-	requireAdmin := middleware.RequireRealmAdmin(h)
+	requireAdmin := middleware.RequireRealmAdmin(h, &cfg.PasswordRequirements)
 	loadCurrentRealm := middleware.LoadCurrentRealm(cacher, db, h)
-	requireRealm := middleware.RequireRealm(h)
+	requireRealm := middleware.RequireRealm(h, &cfg.PasswordRequirements)
 	requireSystemAdmin := middleware.RequireSystemAdmin(h)
 	requireMFA := middleware.RequireMFA(authProvider, h)
-	processFirewall := middleware.ProcessFirewall(h, "server")
+	processFirewall := middleware.ProcessFirewall(h, "server", cfg.Proxy.TrustedProxies)
+	restrictKiosk := middleware.RestrictKiosk(h, cfg.KioskFrameAncestors, cfg.KioskIdleTimeout)
 	rateLimit := httplimiter.Handle
 
 	{
@@ -150,8 +212,14 @@ func Server(
 
 	{
 		sub := r.PathPrefix("").Subrouter()
-		sub.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, h)).Methods("GET")
+		sub.Handle("/health", controller.HandleHealthz(ctx, &cfg.Database, limiterStore, h)).Methods("GET")
+	}
+
+	captchaProvider, err := captcha.ProviderFor(ctx, &cfg.Captcha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create captcha provider: %w", err)
 	}
+	requireResetPasswordCaptcha := middleware.RequireCaptcha(captchaProvider, &cfg.Captcha, h, captcha.EndpointResetPassword, cfg.Proxy.TrustedProxies)
 
 	{
 		loginController := login.New(ctx, authProvider, cfg, db, h)
@@ -161,21 +229,26 @@ func Server(
 
 			sub.Handle("/", loginController.HandleLogin()).Methods("GET")
 			sub.Handle("/login/reset-password", loginController.HandleShowResetPassword()).Methods("GET")
-			sub.Handle("/login/reset-password", loginController.HandleSubmitResetPassword()).Methods("POST")
+			sub.Handle("/login/reset-password", requireResetPasswordCaptcha(loginController.HandleSubmitResetPassword())).Methods("POST")
 			sub.Handle("/login/manage-account", loginController.HandleShowSelectNewPassword()).
 				Queries("oobCode", "", "mode", "resetPassword").Methods("GET")
 			sub.Handle("/login/manage-account", loginController.HandleSubmitNewPassword()).
 				Queries("oobCode", "", "mode", "resetPassword").Methods("POST")
 			sub.Handle("/login/manage-account", loginController.HandleReceiveVerifyEmail()).
 				Queries("oobCode", "{oobCode:.+}", "mode", "{mode:(?:verifyEmail|recoverEmail)}").Methods("GET")
-			sub.Handle("/session", loginController.HandleCreateSession()).Methods("POST")
 			sub.Handle("/signout", loginController.HandleSignOut()).Methods("GET")
 
+			// Sign in, limited per IP by the login limiter.
+			sub = r.PathPrefix("").Subrouter()
+			sub.Use(loginHTTPLimiter.Handle)
+			sub.Handle("/session", loginController.HandleCreateSession()).Methods("POST")
+
 			// Realm selection & account settings
 			sub = r.PathPrefix("").Subrouter()
 			sub.Use(requireAuth)
 			sub.Use(rateLimit)
 			sub.Use(loadCurrentRealm)
+			sub.Use(restrictKiosk)
 			sub.Handle("/login", loginController.HandleReauth()).Methods("GET")
 			sub.Handle("/login", loginController.HandleReauth()).Queries("redir", "").Methods("GET")
 			sub.Handle("/login/select-realm", loginController.HandleSelectRealm()).Methods("GET", "POST")
@@ -203,11 +276,25 @@ func Server(
 		sub.Handle("/issue", http.RedirectHandler("/codes/issue", http.StatusPermanentRedirect)).Methods("POST")
 	}
 
+	// realm requests
+	{
+		sub := r.PathPrefix("/realm-requests").Subrouter()
+		sub.Use(requireAuth)
+		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
+		sub.Use(rateLimit)
+
+		realmrequestController := realmrequest.New(ctx, cfg, db, h)
+		sub.Handle("/new", realmrequestController.HandleCreate()).Methods("GET")
+		sub.Handle("", realmrequestController.HandleCreate()).Methods("POST")
+	}
+
 	// codes
 	{
 		sub := r.PathPrefix("/codes").Subrouter()
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
 		sub.Use(requireRealm)
 		sub.Use(processFirewall)
 		sub.Use(requireVerified)
@@ -221,7 +308,8 @@ func Server(
 		issueapiController := issueapi.New(ctx, cfg, db, limiterStore, h)
 		sub.Handle("/issue", issueapiController.HandleIssue()).Methods("POST")
 		sub.Handle("/bulk-issue", issueapiController.HandleBulkIssue()).Methods("GET")
-		sub.Handle("/batch-issue", issueapiController.HandleBatchIssue()).Methods("POST")
+		sub.Handle("/batch-issue", limitBatchBody(issueapiController.HandleBatchIssue())).Methods("POST")
+		sub.Handle("/issue-sheet", issueapiController.HandleIssueSheet()).Methods("POST")
 
 		codesController := codes.NewServer(ctx, cfg, db, h)
 		codesRoutes(sub, codesController)
@@ -232,6 +320,7 @@ func Server(
 		sub := r.PathPrefix("/realm/mobile-apps").Subrouter()
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
 		sub.Use(requireRealm)
 		sub.Use(processFirewall)
 		sub.Use(requireAdmin)
@@ -248,6 +337,7 @@ func Server(
 		sub := r.PathPrefix("/realm/apikeys").Subrouter()
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
 		sub.Use(requireRealm)
 		sub.Use(processFirewall)
 		sub.Use(requireAdmin)
@@ -264,6 +354,7 @@ func Server(
 		sub := r.PathPrefix("/realm/users").Subrouter()
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
 		sub.Use(requireRealm)
 		sub.Use(processFirewall)
 		sub.Use(requireAdmin)
@@ -272,7 +363,7 @@ func Server(
 		sub.Use(rateLimit)
 
 		userController := user.New(ctx, authProvider, cacher, cfg, db, h)
-		userRoutes(sub, userController)
+		userRoutes(sub, userController, limitBatchBody)
 	}
 
 	// realms
@@ -280,6 +371,7 @@ func Server(
 		sub := r.PathPrefix("/realm").Subrouter()
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
 		sub.Use(requireRealm)
 		sub.Use(processFirewall)
 		sub.Use(requireAdmin)
@@ -287,8 +379,14 @@ func Server(
 		sub.Use(requireMFA)
 		sub.Use(rateLimit)
 
-		realmadminController := realmadmin.New(ctx, cacher, cfg, db, limiterStore, h)
-		realmadminRoutes(sub, realmadminController)
+		// Setup blob storage for uploaded realm assets
+		bs, err := blobstore.BlobstoreFor(ctx, &cfg.Blobstore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create blobstore: %w", err)
+		}
+
+		realmadminController := realmadmin.New(ctx, cacher, cfg, db, limiterStore, bs, h)
+		realmadminRoutes(sub, realmadminController, limitBatchBody)
 
 		realmkeysController, err := realmkeys.New(ctx, cfg, db, certificateSigner, cacher, h)
 		if err != nil {
@@ -302,7 +400,7 @@ func Server(
 		sub := r.PathPrefix("/jwks").Subrouter()
 		sub.Use(rateLimit)
 
-		jwksController, err := jwks.New(ctx, db, cacher, h)
+		jwksController, err := jwks.New(ctx, db, cacher, &cfg.CertificateSigning, certificateSigner, h)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create jwks controller: %w", err)
 		}
@@ -314,11 +412,19 @@ func Server(
 		sub := r.PathPrefix("/admin").Subrouter()
 		sub.Use(requireAuth)
 		sub.Use(loadCurrentRealm)
+		sub.Use(restrictKiosk)
 		sub.Use(requireSystemAdmin)
-		sub.Use(rateLimit)
+		sub.Use(adminHTTPLimiter.Handle)
 
 		adminController := admin.New(ctx, cfg, cacher, db, authProvider, limiterStore, h)
-		systemAdminRoutes(sub, adminController)
+		systemAdminRoutes(sub, adminController, limitBatchBody)
+
+		// Ending an impersonation happens while acting as the impersonated user,
+		// so it cannot require system admin.
+		sub = r.PathPrefix("/impersonate").Subrouter()
+		sub.Use(requireAuth)
+		sub.Use(rateLimit)
+		sub.Handle("", adminController.HandleImpersonateStop()).Methods("DELETE")
 	}
 
 	// Wrap the main router in the mutating middleware method. This cannot be
@@ -326,15 +432,52 @@ func Server(
 	// middleware.
 	mux := http.NewServeMux()
 	mux.Handle("/", middleware.MutateMethod()(r))
+
+	// SCIM provisioning is called by identity providers with a bearer token, so
+	// it is served outside of the main router to skip sessions and CSRF.
+	if cfg.SCIMToken != "" {
+		mux.Handle("/scim/v2/", scimRouter(ctx, cfg, db, authProvider, h, populateRequestID, populateLogger, httplimiter.Handle))
+	}
 	return mux, nil
 }
 
+// scimRouter builds the router for SCIM provisioning.
+func scimRouter(
+	ctx context.Context,
+	cfg *config.ServerConfig,
+	db *database.Database,
+	authProvider auth.Provider,
+	h *render.Renderer,
+	middlewares ...mux.MiddlewareFunc,
+) http.Handler {
+	c := scim.New(ctx, cfg, db, authProvider, h)
+
+	r := mux.NewRouter()
+	r.Use(middlewares...)
+	r.Use(middleware.SecureHeaders(cfg.DevMode, "json"))
+	r.Use(c.RequireToken())
+	r.NotFoundHandler = c.HandleNotFound()
+	r.MethodNotAllowedHandler = c.HandleMethodNotAllowed()
+
+	sub := r.PathPrefix("/scim/v2/Users").Subrouter()
+	sub.Handle("", c.HandleIndex()).Methods("GET")
+	sub.Handle("", c.HandleCreate()).Methods("POST")
+	sub.Handle("/{id}", c.HandleShow()).Methods("GET")
+	sub.Handle("/{id}", c.HandleReplace()).Methods("PUT")
+	sub.Handle("/{id}", c.HandlePatch()).Methods("PATCH")
+	sub.Handle("/{id}", c.HandleDelete()).Methods("DELETE")
+	return r
+}
+
 // codesRoutes are the routes for checking codes.
 func codesRoutes(r *mux.Router, c *codes.Controller) {
 	r.Handle("/issue", c.HandleIssue()).Methods("GET")
 	r.Handle("/status", c.HandleIndex()).Methods("GET")
+	r.Handle("/pending", c.HandlePending()).Methods("GET")
 	r.Handle("/{uuid}", c.HandleShow()).Methods("GET")
 	r.Handle("/{uuid}/expire", c.HandleExpirePage()).Methods("PATCH")
+	r.Handle("/{uuid}/approve", c.HandleApprove()).Methods("PATCH")
+	r.Handle("/{uuid}/reject", c.HandleReject()).Methods("PATCH")
 }
 
 // mobileappsRoutes are the Mobile App routes.
@@ -354,6 +497,9 @@ func apikeyRoutes(r *mux.Router, c *apikey.Controller) {
 	r.Handle("", c.HandleIndex()).Methods("GET")
 	r.Handle("", c.HandleCreate()).Methods("POST")
 	r.Handle("/new", c.HandleCreate()).Methods("GET")
+	r.Handle("/batch", c.HandleBatchCreate()).Methods("GET", "POST")
+	r.Handle("/export.csv", c.HandleExport()).Methods("GET")
+	r.Handle("/rotate-all", c.HandleRotateAll()).Methods("GET", "POST")
 	r.Handle("/{id:[0-9]+}/edit", c.HandleUpdate()).Methods("GET")
 	r.Handle("/{id:[0-9]+}", c.HandleShow()).Methods("GET")
 	r.Handle("/{id:[0-9]+}", c.HandleUpdate()).Methods("PATCH")
@@ -362,13 +508,13 @@ func apikeyRoutes(r *mux.Router, c *apikey.Controller) {
 }
 
 // userRoutes are the user routes.
-func userRoutes(r *mux.Router, c *user.Controller) {
+func userRoutes(r *mux.Router, c *user.Controller, limitBatchBody mux.MiddlewareFunc) {
 	r.Handle("", c.HandleIndex()).Methods("GET")
 	r.Handle("", c.HandleCreate()).Methods("POST")
 	r.Handle("/new", c.HandleCreate()).Methods("GET")
 	r.Handle("/export.csv", c.HandleExport()).Methods("GET")
 	r.Handle("/import", c.HandleImport()).Methods("GET")
-	r.Handle("/import", c.HandleImportBatch()).Methods("POST")
+	r.Handle("/import", limitBatchBody(c.HandleImportBatch())).Methods("POST")
 	r.Handle("/{id:[0-9]+}/edit", c.HandleUpdate()).Methods("GET")
 	r.Handle("/{id:[0-9]+}", c.HandleShow()).Methods("GET")
 	r.Handle("/{id:[0-9]+}", c.HandleUpdate()).Methods("PATCH")
@@ -387,23 +533,31 @@ func realmkeysRoutes(r *mux.Router, c *realmkeys.Controller) {
 }
 
 // realmadminRoutes are the realm admin routes.
-func realmadminRoutes(r *mux.Router, c *realmadmin.Controller) {
+func realmadminRoutes(r *mux.Router, c *realmadmin.Controller, limitBatchBody mux.MiddlewareFunc) {
 	r.Handle("/settings", c.HandleSettings()).Methods("GET", "POST")
+	r.Handle("/settings/logo", limitBatchBody(c.HandleLogoUpload())).Methods("POST")
+	r.Handle("/settings/logo", c.HandleLogoDelete()).Methods("DELETE")
 	r.Handle("/settings/enable-express", c.HandleEnableExpress()).Methods("POST")
 	r.Handle("/settings/disable-express", c.HandleDisableExpress()).Methods("POST")
 	r.Handle("/stats", c.HandleShow()).Methods("GET")
 	r.Handle("/stats.csv", c.HandleShow()).Methods("GET")
 	r.Handle("/stats.json", c.HandleShow()).Methods("GET")
 	r.Handle("/events", c.HandleEvents()).Methods("GET")
+	r.Handle("/events.csv", c.HandleEventsExport()).Methods("GET")
+	r.Handle("/exports", c.HandleExportsIndex()).Methods("GET", "POST")
+	r.Handle("/exports/{id:[0-9]+}", c.HandleExportsDelete()).Methods("DELETE")
+	r.Handle("/webhooks", c.HandleWebhooksIndex()).Methods("GET", "POST")
+	r.Handle("/webhooks/{id:[0-9]+}", c.HandleWebhooksDelete()).Methods("DELETE")
 }
 
 // jwksRoutes are the JWK routes, rooted at /jwks.
 func jwksRoutes(r *mux.Router, c *jwks.Controller) {
+	r.Handle("/system", c.HandleSystem()).Methods("GET")
 	r.Handle("/{realm_id:[0-9]+}", c.HandleIndex()).Methods("GET")
 }
 
 // systemAdminRoutes are the system routes, rooted at /admin.
-func systemAdminRoutes(r *mux.Router, c *admin.Controller) {
+func systemAdminRoutes(r *mux.Router, c *admin.Controller, limitBatchBody mux.MiddlewareFunc) {
 	// Redirect / to /admin/realms
 	r.Handle("", http.RedirectHandler("/admin/realms", http.StatusSeeOther)).Methods("GET")
 	r.Handle("/", http.RedirectHandler("/admin/realms", http.StatusSeeOther)).Methods("GET")
@@ -416,6 +570,10 @@ func systemAdminRoutes(r *mux.Router, c *admin.Controller) {
 	r.Handle("/realms/{realm_id:[0-9]+}/remove/{user_id:[0-9]+}", c.HandleRealmsRemove()).Methods("PATCH")
 	r.Handle("/realms/{id:[0-9]+}/realmadmin", c.HandleRealmsSelectAndAdmin()).Methods("GET")
 	r.Handle("/realms/{id:[0-9]+}", c.HandleRealmsUpdate()).Methods("PATCH")
+	r.Handle("/realms/{id:[0-9]+}/approve", c.HandleRealmRequestApprove()).Methods("PATCH")
+	r.Handle("/realms/{id:[0-9]+}/request", c.HandleRealmRequestReject()).Methods("DELETE")
+	r.Handle("/realms/{id:[0-9]+}/codes/import", c.HandleCodesImportShow()).Methods("GET")
+	r.Handle("/realms/{id:[0-9]+}/codes/import", limitBatchBody(c.HandleCodesImport())).Methods("POST")
 
 	r.Handle("/users", c.HandleUsersIndex()).Methods("GET")
 	r.Handle("/users/{id:[0-9]+}", c.HandleUserShow()).Methods("GET")
@@ -423,11 +581,19 @@ func systemAdminRoutes(r *mux.Router, c *admin.Controller) {
 	r.Handle("/users", c.HandleSystemAdminCreate()).Methods("POST")
 	r.Handle("/users/new", c.HandleSystemAdminCreate()).Methods("GET")
 	r.Handle("/users/{id:[0-9]+}/revoke", c.HandleSystemAdminRevoke()).Methods("DELETE")
+	r.Handle("/users/{id:[0-9]+}/impersonate", c.HandleImpersonateStart()).Methods("POST")
+
+	r.Handle("/sessions", c.HandleSessionsIndex()).Methods("GET")
+	r.Handle("/sessions/{id:[0-9]+}", c.HandleSessionRevoke()).Methods("DELETE")
+
+	r.Handle("/login-lockouts", c.HandleLoginLockoutsIndex()).Methods("GET")
+	r.Handle("/login-lockouts/{id:[0-9]+}", c.HandleLoginLockoutClear()).Methods("DELETE")
 
 	r.Handle("/mobile-apps", c.HandleMobileAppsShow()).Methods("GET")
 	r.Handle("/sms", c.HandleSMSUpdate()).Methods("GET", "POST")
 	r.Handle("/email", c.HandleEmailUpdate()).Methods("GET", "POST")
 	r.Handle("/events", c.HandleEventsShow()).Methods("GET")
+	r.Handle("/events.csv", c.HandleEventsExport()).Methods("GET")
 
 	r.Handle("/caches", c.HandleCachesIndex()).Methods("GET")
 	r.Handle("/caches/clear/{id}", c.HandleCachesClear()).Methods("POST")
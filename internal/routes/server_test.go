@@ -21,6 +21,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 	"github.com/gorilla/mux"
 )
 
@@ -43,6 +44,15 @@ func TestRoutes_codesRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("PATCH", "/aaa-aaa-aaa-aaa/expire", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/pending", nil),
+		},
+		{
+			req: httptest.NewRequest("PATCH", "/aaa-aaa-aaa-aaa/approve", nil),
+		},
+		{
+			req: httptest.NewRequest("PATCH", "/aaa-aaa-aaa-aaa/reject", nil),
+		},
 	}
 
 	for _, tc := range cases {
@@ -98,6 +108,15 @@ func TestRoutes_apikeyRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("GET", "/new", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/batch", nil),
+		},
+		{
+			req: httptest.NewRequest("POST", "/batch", nil),
+		},
+		{
+			req: httptest.NewRequest("GET", "/export.csv", nil),
+		},
 		{
 			req: httptest.NewRequest("GET", "/12345/edit", nil),
 		},
@@ -124,7 +143,7 @@ func TestRoutes_userRoutes(t *testing.T) {
 	t.Parallel()
 
 	m := mux.NewRouter()
-	userRoutes(m, nil)
+	userRoutes(m, nil, middleware.LimitBodySize(nil, 1))
 
 	cases := []struct {
 		req  *http.Request
@@ -201,7 +220,7 @@ func TestRoutes_realmadminRoutes(t *testing.T) {
 	t.Parallel()
 
 	m := mux.NewRouter()
-	realmadminRoutes(m, nil)
+	realmadminRoutes(m, nil, middleware.LimitBodySize(nil, 1))
 
 	cases := []struct {
 		req  *http.Request
@@ -213,6 +232,12 @@ func TestRoutes_realmadminRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("POST", "/settings", nil),
 		},
+		{
+			req: httptest.NewRequest("POST", "/settings/logo", nil),
+		},
+		{
+			req: httptest.NewRequest("DELETE", "/settings/logo", nil),
+		},
 		{
 			req: httptest.NewRequest("POST", "/settings/enable-express", nil),
 		},
@@ -231,6 +256,9 @@ func TestRoutes_realmadminRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("GET", "/events", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/events.csv", nil),
+		},
 	}
 
 	for _, tc := range cases {
@@ -248,6 +276,9 @@ func TestRoutes_jwksRoutes(t *testing.T) {
 		req  *http.Request
 		vars map[string]string
 	}{
+		{
+			req: httptest.NewRequest("GET", "/system", nil),
+		},
 		{
 			req:  httptest.NewRequest("GET", "/12345", nil),
 			vars: map[string]string{"realm_id": "12345"},
@@ -263,7 +294,7 @@ func TestRoutes_systemAdminRoutes(t *testing.T) {
 	t.Parallel()
 
 	m := mux.NewRouter()
-	systemAdminRoutes(m, nil)
+	systemAdminRoutes(m, nil, middleware.LimitBodySize(nil, 1))
 
 	cases := []struct {
 		req  *http.Request
@@ -301,6 +332,14 @@ func TestRoutes_systemAdminRoutes(t *testing.T) {
 			req:  httptest.NewRequest("GET", "/realms/12345/realmadmin", nil), // TODO: better route
 			vars: map[string]string{"id": "12345"},
 		},
+		{
+			req:  httptest.NewRequest("GET", "/realms/12345/codes/import", nil),
+			vars: map[string]string{"id": "12345"},
+		},
+		{
+			req:  httptest.NewRequest("POST", "/realms/12345/codes/import", nil),
+			vars: map[string]string{"id": "12345"},
+		},
 		{
 			req: httptest.NewRequest("GET", "/users", nil),
 		},
@@ -334,6 +373,9 @@ func TestRoutes_systemAdminRoutes(t *testing.T) {
 		{
 			req: httptest.NewRequest("GET", "/events", nil),
 		},
+		{
+			req: httptest.NewRequest("GET", "/events.csv", nil),
+		},
 		{
 			req: httptest.NewRequest("GET", "/caches", nil),
 		},
@@ -37,9 +37,21 @@ const (
 
 	// ErrUnparsableRequest indicates that the request could not be correctly parsed.
 	ErrUnparsableRequest = "unparsable_request"
+	// ErrRequestTooLarge indicates that the request body exceeds the maximum
+	// size accepted by the server.
+	ErrRequestTooLarge = "request_too_large"
+	// ErrConcurrencyLimitExceeded indicates that the API key already has as many
+	// requests in flight as its realm allows.
+	ErrConcurrencyLimitExceeded = "concurrency_limit_exceeded"
+	// ErrCaptchaFailed indicates the endpoint requires a CAPTCHA token, and the
+	// request did not have a valid one.
+	ErrCaptchaFailed = "captcha_failed"
 	// ErrInternal indicates some server-side error whose details are opaque to the caller.
 	// this could mean a database or RPC connection drop or some other internal outage.
 	ErrInternal = "internal_server_error"
+	// ErrRealmNotFound indicates that the requested realm does not exist or is
+	// not yet approved.
+	ErrRealmNotFound = "realm_not_found"
 
 	// Verify API responses
 
@@ -58,14 +70,90 @@ const (
 	// ErrInvalidTestType indicates the client says it supports a test type this server doesn't
 	// know about.
 	ErrInvalidTestType = "invalid_test_type"
+	// ErrLongCodesDisabled indicates the code looks like a long code, but the
+	// realm does not issue long codes. The user should enter the short code.
+	ErrLongCodesDisabled = "long_codes_disabled"
+	// ErrShortCodesDisabled indicates the code looks like a short code, but the
+	// realm only accepts long codes or deep links. The user should scan the code
+	// or follow the link.
+	ErrShortCodesDisabled = "short_codes_disabled"
+	// ErrVerifyCodePendingApproval indicates the realm requires codes to be
+	// approved before they are claimed, and the code has not been approved yet.
+	// The user may retry the same code later.
+	ErrVerifyCodePendingApproval = "code_pending_approval"
+	// ErrVerifyCodeBadExpiry indicates the code's expiration is outside of the
+	// policy bounds, for example because it was imported or modified. The user
+	// needs to obtain a new code.
+	ErrVerifyCodeBadExpiry = "code_expiry_invalid"
+	// ErrVerifyCodeTooManyAttempts indicates the code was expired after too many
+	// failed attempts to claim it.
+	ErrVerifyCodeTooManyAttempts = "code_too_many_attempts"
+	// ErrClaimRateLimitExceeded indicates there were too many recent attempts to
+	// claim codes issued to the same person, or to claim codes which do not
+	// exist from the same device. The user may retry later.
+	ErrClaimRateLimitExceeded = "claim_rate_limit_exceeded"
+	// ErrClaimRejected indicates the claim was rejected by a policy specific to
+	// the deployment. The error message describes why.
+	ErrClaimRejected = "claim_rejected"
+	// ErrClaimLocationNotAllowed indicates that the realm does not allow codes
+	// to be claimed from the client's location.
+	ErrClaimLocationNotAllowed = "claim_location_not_allowed"
+	// ErrMissingDeviceFingerprint indicates the realm binds tokens to devices,
+	// but no device fingerprint was supplied.
+	ErrMissingDeviceFingerprint = "missing_device_fingerprint"
+	// ErrAppNotAllowed indicates the realm restricts which apps may claim codes
+	// and the requesting app is not one of them.
+	ErrAppNotAllowed = "app_not_allowed"
+	// ErrInvalidCohortID indicates the cohort ID is not in a valid format.
+	ErrInvalidCohortID = "invalid_cohort_id"
+	// ErrInvalidMetadata indicates the code metadata is too large, has an
+	// invalid key, or appears to contain PII.
+	ErrInvalidMetadata = "invalid_metadata"
+	// ErrInvalidExternalID indicates the external issuer ID is longer than the
+	// realm allows.
+	ErrInvalidExternalID = "invalid_external_id"
+	// ErrMissingExternalID indicates the realm requires an external issuer ID,
+	// but none was provided.
+	ErrMissingExternalID = "missing_external_id"
+	// ErrInvalidEmail indicates the email address to send the code to is not
+	// valid, or the realm does not send codes by email.
+	ErrInvalidEmail = "invalid_email"
+	// ErrInvalidMaxClaims indicates the code was requested with more claims than
+	// the realm allows.
+	ErrInvalidMaxClaims = "invalid_max_claims"
+	// ErrInvalidSupervisingUser indicates the supervising user is not a member
+	// of the realm, or is the same as the issuing user.
+	ErrInvalidSupervisingUser = "invalid_supervising_user"
 	// ErrMissingDate indicates the realm requires a date, but none was supplied.
 	ErrMissingDate = "missing_date"
 	// ErrUUIDAlreadyExists indicates that the UUID has already been used for an issued code.
 	ErrUUIDAlreadyExists = "uuid_already_exists"
+	// ErrExternalIDAlreadyExists indicates that a code was recently issued for
+	// the same external issuer ID and the realm rejects duplicates.
+	ErrExternalIDAlreadyExists = "external_id_already_exists"
+	// ErrExternalIDLimitExceeded indicates that the realm's lifetime limit of
+	// codes for the external issuer ID has been reached.
+	ErrExternalIDLimitExceeded = "external_id_limit_exceeded"
+	// ErrActiveCodeLimitExceeded indicates that the realm already has the
+	// maximum number of unexpired, unclaimed codes outstanding.
+	ErrActiveCodeLimitExceeded = "active_code_limit_exceeded"
 	// ErrMaintenanceMode indicates that the server is read-only for maintenance.
 	ErrMaintenanceMode = "maintenance_mode"
 	// ErrQuotaExceeded indicates the realm has exceeded its daily allotment of codes.
 	ErrQuotaExceeded = "quota_exceeded"
+	// ErrMonthlyQuotaExceeded indicates the realm has used its monthly code
+	// quota, so issuance is disabled until the month ends.
+	ErrMonthlyQuotaExceeded = "monthly_quota_exceeded"
+	// ErrIssueRateLimitExceeded indicates the realm has issued as many codes as
+	// one of its configured rate limit windows allows. The error message names
+	// the window and when it resets.
+	ErrIssueRateLimitExceeded = "issue_rate_limit_exceeded"
+	// ErrIssueIPNotAllowed indicates the realm only allows issuing codes from
+	// certain IP ranges, and the request came from outside of them.
+	ErrIssueIPNotAllowed = "issue_ip_not_allowed"
+	// ErrQuietHours indicates that the realm does not issue codes at this time
+	// of day.
+	ErrQuietHours = "quiet_hours"
 
 	// Certificate API responses
 
@@ -75,6 +163,12 @@ const (
 	ErrTokenExpired = "token_expired"
 	// ErrHMACInvalid indicates that the HMAC that is being signed is invalid (wrong length)
 	ErrHMACInvalid = "hmac_invalid"
+	// ErrDeviceMismatch indicates that the token was issued to a different
+	// device than the one claiming it.
+	ErrDeviceMismatch = "device_mismatch"
+	// ErrNegativeResultUploadBlocked indicates that the token is for a negative
+	// test result and the realm does not accept uploads for negative results.
+	ErrNegativeResultUploadBlocked = "negative_result_upload_blocked"
 )
 
 // ErrorReturn defines the common error type.
@@ -175,13 +269,60 @@ type UserBatchResponse struct {
 	ErrorCode string `json:"errorCode,omitempty"`
 }
 
+// ImportCodesRequest is a request to import codes which were issued by another
+// system, such as when a health authority migrates to this server. This is
+// called by the Web frontend for system admins.
+// API is served at /admin/realms/{id}/codes/import
+type ImportCodesRequest struct {
+	Codes []*ImportCode `json:"codes"`
+}
+
+// ImportCode is a single code to import. The code values are kept as given.
+// SymptomDate and TestDate are optional and YYYY-MM-DD. ExpiresAt and
+// LongExpiresAt are RFC 3339 timestamps.
+type ImportCode struct {
+	Code          string `json:"code"`
+	LongCode      string `json:"longCode"`
+	TestType      string `json:"testType"`
+	SymptomDate   string `json:"symptomDate,omitempty"`
+	TestDate      string `json:"testDate,omitempty"`
+	ExpiresAt     string `json:"expiresAt"`
+	LongExpiresAt string `json:"longExpiresAt"`
+
+	// UUID is optional. If omitted, the server generates one.
+	UUID             string            `json:"uuid,omitempty"`
+	ExternalIssuerID string            `json:"externalIssuerID,omitempty"`
+	CohortID         string            `json:"cohortID,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// ImportCodesResponse defines the response type for ImportCodesRequest. There
+// is one result per requested code, in the same order.
+type ImportCodesResponse struct {
+	Imported int                 `json:"imported"`
+	Results  []*ImportCodeResult `json:"results"`
+
+	Error     string `json:"error"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// ImportCodeResult is the result of importing a single code. Error is blank if
+// the code was imported.
+type ImportCodeResult struct {
+	Index int    `json:"index"`
+	UUID  string `json:"uuid,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
 // IssueCodeRequest defines the parameters to request an new OTP (short term)
 // code. This is called by the Web frontend.
 // API is served at /api/issue
 type IssueCodeRequest struct {
 	Padding Padding `json:"padding"`
 
-	SymptomDate string `json:"symptomDate"` // ISO 8601 formatted date, YYYY-MM-DD
+	// SymptomDate and TestDate are YYYY-MM-DD, RFC 3339, or seconds since the
+	// epoch. Epoch values are converted to a date using TZOffset.
+	SymptomDate string `json:"symptomDate"`
 	TestDate    string `json:"testDate"`
 	TestType    string `json:"testType"`
 	// Offset in minutes of the user's timezone. Positive, negative, 0, or omitted
@@ -189,6 +330,17 @@ type IssueCodeRequest struct {
 	TZOffset float32 `json:"tzOffset"`
 	Phone    string  `json:"phone"`
 
+	// SMSLocale is the optional language tag, such as "es" or "fr-CA", of the
+	// SMS sent to Phone. If the realm has no SMS template for the locale, the
+	// realm's default template is used.
+	SMSLocale string `json:"smsLocale,omitempty"`
+
+	// Email is the optional address to send the code to, if the realm sends
+	// codes by email. EmailLocale is the optional language tag of the message,
+	// like SMSLocale. The address is only used to send the message.
+	Email       string `json:"email,omitempty"`
+	EmailLocale string `json:"emailLocale,omitempty"`
+
 	// Optional: UUID is a handle which allows the issuer to track status
 	// of the issued verification code. If omitted the server will generate the UUID.
 	UUID string `json:"uuid"`
@@ -205,6 +357,29 @@ type IssueCodeRequest struct {
 	// system does not sanitize or encrypt these external IDs, it is the caller's
 	// responsibility to do so.
 	ExternalIssuerID string `json:"externalIssuerID"`
+
+	// CohortID is an optional tag for codes issued for the same exposure event,
+	// such as an outbreak investigation. Many codes can share a cohort, and
+	// realm stats report the number of codes issued and claimed per cohort. It
+	// must be 1-64 letters, digits, dots, colons, underscores, or dashes, and
+	// must not contain PII.
+	CohortID string `json:"cohortID,omitempty"`
+
+	// Metadata is an optional set of key-value tags for later correlation, such
+	// as a clinic ID or test kit lot. There can be up to 10 keys. Keys must start
+	// with a letter and be up to 32 letters, digits, dots, underscores, or
+	// dashes. Values can be up to 128 characters and must not contain PII.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// SupervisingUserEmail is the optional email address of a user in the realm
+	// who supervised the issuance, for example when a trainee issues the code.
+	// It must not be the issuing user.
+	SupervisingUserEmail string `json:"supervisingUserEmail,omitempty"`
+
+	// MaxClaims is the optional number of times the code may be claimed, for
+	// example when one code is issued for a household. Each claim produces its
+	// own token. It defaults to 1 and cannot be more than the realm allows.
+	MaxClaims uint `json:"maxClaims,omitempty"`
 }
 
 // IssueCodeResponse defines the response type for IssueCodeRequest.
@@ -230,10 +405,67 @@ type IssueCodeResponse struct {
 	LongExpiresAt          string `json:"longExpiresAt,omitempty"`
 	LongExpiresAtTimestamp int64  `json:"longExpiresAtTimestamp,omitempty"`
 
+	// PendingApproval is true if the realm requires codes to be approved by a
+	// realm admin before they can be claimed.
+	PendingApproval bool `json:"pendingApproval,omitempty"`
+
+	// ClaimToken is a signed token which can be sent to /api/verify in place of
+	// the code until ClaimExpiresAtTimestamp. ClaimLink is a link to the
+	// server's claim page with the token, if one is configured. They are only
+	// present if the server has claim links enabled.
+	ClaimToken              string `json:"claimToken,omitempty"`
+	ClaimLink               string `json:"claimLink,omitempty"`
+	ClaimExpiresAtTimestamp int64  `json:"claimExpiresAtTimestamp,omitempty"`
+
+	// DeepLink opens the app and fills in the long code. If the realm embeds
+	// code metadata in deep links, the "m" query parameter is the base64url
+	// encoded JSON payload of the code and metadata, and the "s" query parameter
+	// is a detached JWS of the payload signed with the realm's signing key,
+	// which is published at /jwks/{realm_id}.
+	DeepLink string `json:"deepLink,omitempty"`
+
+	// SMSDeliveryState is whether the text message was sent, when a phone number
+	// was given. If the realm issues codes when text messages cannot be sent,
+	// it is "failed" or "queued", and the code should be given to the patient
+	// another way.
+	SMSDeliveryState string `json:"smsDeliveryState,omitempty"`
+
+	// EmailDeliveryState is whether the email was sent, when an email address
+	// was given. It is "sent" or "failed". The code is issued even if the email
+	// cannot be sent, and should then be given to the patient another way.
+	EmailDeliveryState string `json:"emailDeliveryState,omitempty"`
+
+	// CodesRemaining is the number of codes the realm can issue before it
+	// reaches its daily quota, and QuotaResetsAtTimestamp is when the quota
+	// resets, in UTC seconds since epoch. They are only present if the realm has
+	// a quota.
+	CodesRemaining         *uint64 `json:"codesRemaining,omitempty"`
+	QuotaResetsAtTimestamp int64   `json:"quotaResetsAtTimestamp,omitempty"`
+
 	Error     string `json:"error"`
 	ErrorCode string `json:"errorCode,omitempty"`
 }
 
+// SMS delivery states of an issued code.
+const (
+	// SMSDeliverySent indicates the text message was sent.
+	SMSDeliverySent = "sent"
+	// SMSDeliveryFailed indicates the text message could not be sent and will
+	// not be retried.
+	SMSDeliveryFailed = "failed"
+	// SMSDeliveryQueued indicates the text message could not be sent and will be
+	// retried until the code expires.
+	SMSDeliveryQueued = "queued"
+)
+
+// Email delivery states of an issued code.
+const (
+	// EmailDeliverySent indicates the email was sent.
+	EmailDeliverySent = "sent"
+	// EmailDeliveryFailed indicates the email could not be sent.
+	EmailDeliveryFailed = "failed"
+)
+
 // BatchIssueCodeRequest defines the request for issuing many codes at once.
 type BatchIssueCodeRequest struct {
 	Codes []*IssueCodeRequest `json:"codes"`
@@ -272,6 +504,9 @@ type CheckCodeStatusResponse struct {
 	// UTC seconds since epoch.
 	LongExpiresAtTimestamp int64 `json:"longExpiresAtTimestamp,omitempty"`
 
+	// Metadata is the metadata the code was issued with, if any.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
 	Error     string `json:"error,omitempty"`
 	ErrorCode string `json:"errorCode,omitempty"`
 }
@@ -324,6 +559,15 @@ type VerifyCodeRequest struct {
 
 	VerificationCode string   `json:"code"`
 	AcceptTestTypes  []string `json:"accept"`
+
+	// DeviceFingerprint is an optional, stable identifier for the device. It is
+	// required if the realm binds tokens to devices.
+	DeviceFingerprint string `json:"deviceFingerprint,omitempty"`
+
+	// AppID is the identifier of the app making the request (the iOS bundle ID
+	// or Android package name). It is required if the realm restricts which
+	// apps may claim codes.
+	AppID string `json:"appId,omitempty"`
 }
 
 // VerifyCodeResponse either contains an error, or contains the test parameters
@@ -336,6 +580,7 @@ type VerifyCodeResponse struct {
 	SymptomDate       string `json:"symptomDate,omitempty"` // ISO 8601 formatted date, YYYY-MM-DD
 	TestDate          string `json:"testDate,omitempty"`    // ISO 8601 formatted date, YYYY-MM-DD
 	VerificationToken string `json:"token,omitempty"`       // JWT - signed, not encrypted.
+	RedirectURL       string `json:"redirectURL,omitempty"` // Where web claim flows send the user next.
 	Error             string `json:"error,omitempty"`
 	ErrorCode         string `json:"errorCode,omitempty"`
 }
@@ -351,8 +596,18 @@ type VerificationCertificateRequest struct {
 
 	VerificationToken string `json:"token"`
 	ExposureKeyHMAC   string `json:"ekeyhmac"`
+
+	// DeviceFingerprint must match the fingerprint given when verifying the code
+	// if the realm binds tokens to devices.
+	DeviceFingerprint string `json:"deviceFingerprint,omitempty"`
 }
 
+// SignatureHeader is the response header which holds the signature of a
+// successful VerificationCertificateResponse, for realms which sign them. The
+// value is a JWS with a detached payload (RFC 7515, Appendix F) over the exact
+// response body. Its "kid" header identifies the key in the server's JWKS.
+const SignatureHeader = "X-Signature"
+
 // VerificationCertificateResponse either contains an error or contains
 // a signed certificate that can be presented to the configured exposure
 // notifications server to publish keys along w/ the certified diagnosis.
@@ -363,3 +618,95 @@ type VerificationCertificateResponse struct {
 	Error       string `json:"error,omitempty"`
 	ErrorCode   string `json:"errorCode,omitempty"`
 }
+
+// AppConfigResponse describes the features of the realm that owns the API key,
+// so that apps can adapt without shipping a new build. The response carries
+// an ETag and clients should send it back in an If-None-Match header.
+//
+// Requires API key in a HTTP header, X-API-Key: APIKEY
+type AppConfigResponse struct {
+	RealmName    string           `json:"realmName,omitempty"`
+	RegionCode   string           `json:"regionCode,omitempty"`
+	Capabilities *AppCapabilities `json:"capabilities,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	ErrorCode    string           `json:"errorCode,omitempty"`
+}
+
+// RealmPublicConfigResponse is the public configuration of a realm, which apps
+// can fetch before a user has an API key or has authenticated. It only includes
+// settings which are safe to share with anyone. The response carries an ETag
+// and clients should send it back in an If-None-Match header.
+//
+// Does not require an API key.
+type RealmPublicConfigResponse struct {
+	RealmID          uint     `json:"realmId,omitempty"`
+	RealmName        string   `json:"realmName,omitempty"`
+	RegionCode       string   `json:"regionCode,omitempty"`
+	DeepLink         string   `json:"deepLink,omitempty"`
+	ENExpress        bool     `json:"enExpress"`
+	AllowedTestTypes []string `json:"allowedTestTypes,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	ErrorCode        string   `json:"errorCode,omitempty"`
+}
+
+// RealmStatsResponse is the response for the realm statistics API. Days are
+// most recent first, and Total sums every day in the response.
+//
+// Requires a stats API key in a HTTP header, X-API-Key: APIKEY
+type RealmStatsResponse struct {
+	Days      []*RealmStatsDay `json:"days"`
+	Total     *RealmStatsDay   `json:"total"`
+	Error     string           `json:"error,omitempty"`
+	ErrorCode string           `json:"errorCode,omitempty"`
+}
+
+// RealmStatsDay is the statistics of a realm for a single UTC day.
+type RealmStatsDay struct {
+	// Date is YYYY-MM-DD. It is blank for totals.
+	Date         string `json:"date,omitempty"`
+	CodesIssued  uint   `json:"codesIssued"`
+	CodesClaimed uint   `json:"codesClaimed"`
+
+	// ClaimRatio is the number of codes claimed divided by the number of codes
+	// issued, or 0 if no codes were issued.
+	ClaimRatio float64 `json:"claimRatio"`
+}
+
+// AppCapabilities is the set of realm settings which affect the behavior of
+// apps.
+type AppCapabilities struct {
+	// SMS is true if the realm can send verification codes by SMS.
+	SMS bool `json:"sms"`
+
+	// ENExpress is true if the realm uses Exposure Notifications Express.
+	ENExpress bool `json:"enExpress"`
+
+	// DeepLink is the prefix of the links sent in SMS messages, for example
+	// "ens://v".
+	DeepLink string `json:"deepLink"`
+
+	// LongCodes is true if the realm issues long codes.
+	LongCodes bool `json:"longCodes"`
+
+	// ShortCodes is true if the realm accepts short codes when they are
+	// claimed. If false, apps should only offer scanning or deep links.
+	ShortCodes bool `json:"shortCodes"`
+
+	// AllowedTestTypes are the test types the realm issues codes for.
+	AllowedTestTypes []string `json:"allowedTestTypes"`
+
+	// RequireDate is true if codes are always issued with a symptom or test
+	// date.
+	RequireDate bool `json:"requireDate"`
+
+	// RequireDeviceBinding is true if a device fingerprint must be given when
+	// verifying a code.
+	RequireDeviceBinding bool `json:"requireDeviceBinding"`
+
+	// RequireAppID is true if the app ID must be given when verifying a code.
+	RequireAppID bool `json:"requireAppId"`
+
+	// MinAppVersions is the minimum supported version of each app, keyed by app
+	// ID. Apps which are older should prompt the user to upgrade.
+	MinAppVersions map[string]string `json:"minAppVersions,omitempty"`
+}
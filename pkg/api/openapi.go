@@ -0,0 +1,383 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification the document
+// conforms to.
+const OpenAPIVersion = "3.0.3"
+
+// openAPIErrorCodes are the well-defined error codes that may be returned in
+// the errorCode field of a response.
+var openAPIErrorCodes = []string{
+	ErrUnparsableRequest,
+	ErrRequestTooLarge,
+	ErrConcurrencyLimitExceeded,
+	ErrCaptchaFailed,
+	ErrInternal,
+	ErrRealmNotFound,
+	ErrVerifyCodeInvalid,
+	ErrVerifyCodeExpired,
+	ErrVerifyCodeNotFound,
+	ErrVerifyCodeUserUnauth,
+	ErrUnsupportedTestType,
+	ErrInvalidTestType,
+	ErrInvalidCohortID,
+	ErrInvalidMetadata,
+	ErrInvalidExternalID,
+	ErrMissingExternalID,
+	ErrInvalidEmail,
+	ErrInvalidMaxClaims,
+	ErrInvalidSupervisingUser,
+	ErrMissingDate,
+	ErrUUIDAlreadyExists,
+	ErrExternalIDAlreadyExists,
+	ErrExternalIDLimitExceeded,
+	ErrActiveCodeLimitExceeded,
+	ErrLongCodesDisabled,
+	ErrShortCodesDisabled,
+	ErrVerifyCodePendingApproval,
+	ErrVerifyCodeBadExpiry,
+	ErrVerifyCodeTooManyAttempts,
+	ErrClaimRateLimitExceeded,
+	ErrClaimRejected,
+	ErrMissingDeviceFingerprint,
+	ErrClaimLocationNotAllowed,
+	ErrAppNotAllowed,
+	ErrMaintenanceMode,
+	ErrQuotaExceeded,
+	ErrMonthlyQuotaExceeded,
+	ErrIssueRateLimitExceeded,
+	ErrQuietHours,
+	ErrIssueIPNotAllowed,
+	ErrTokenInvalid,
+	ErrTokenExpired,
+	ErrHMACInvalid,
+	ErrDeviceMismatch,
+	ErrNegativeResultUploadBlocked,
+}
+
+// openAPIOperation describes a single JSON API endpoint.
+type openAPIOperation struct {
+	// Path is the HTTP path of the endpoint.
+	Path string
+
+	// Method is the HTTP method of the endpoint, "post" if empty.
+	Method string
+
+	// Server is the name of the server binary that serves the endpoint.
+	Server string
+
+	// Summary is a short, human readable description of the endpoint.
+	Summary string
+
+	// Request and Response are values of the request and response types. Their
+	// schemas are generated from the JSON struct tags. Request is nil for
+	// endpoints which do not accept a body.
+	Request  interface{}
+	Response interface{}
+
+	// StatusCodes are the HTTP status codes the endpoint may return. Every
+	// status except 304 has a JSON body of the Response type.
+	StatusCodes []int
+
+	// Public is true for endpoints which do not require an API key.
+	Public bool
+}
+
+// openAPIOperations is the list of documented API operations.
+var openAPIOperations = []*openAPIOperation{
+	{
+		Path:        "/api/verify",
+		Server:      "apiserver",
+		Summary:     "Exchange a verification code for a long term verification token.",
+		Request:     VerifyCodeRequest{},
+		Response:    VerifyCodeResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusPreconditionFailed, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusGatewayTimeout},
+	},
+	{
+		Path:        "/api/verify/long",
+		Server:      "apiserver",
+		Summary:     "Exchange a long code, or a deep link which contains one, for a long term verification token.",
+		Request:     VerifyCodeRequest{},
+		Response:    VerifyCodeResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusPreconditionFailed, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusGatewayTimeout},
+	},
+	{
+		Path:        "/api/certificate",
+		Server:      "apiserver",
+		Summary:     "Exchange a verification token for a verification certificate.",
+		Request:     VerificationCertificateRequest{},
+		Response:    VerificationCertificateResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusConflict, http.StatusPreconditionFailed, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusGatewayTimeout},
+	},
+	{
+		Path:        "/api/issue",
+		Server:      "adminapi",
+		Summary:     "Request a verification code to be issued.",
+		Request:     IssueCodeRequest{},
+		Response:    IssueCodeResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusGatewayTimeout},
+	},
+	{
+		Path:        "/api/checkcodestatus",
+		Server:      "adminapi",
+		Summary:     "Check the status of a previously issued code, looking up by UUID.",
+		Request:     CheckCodeStatusRequest{},
+		Response:    CheckCodeStatusResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	{
+		Path:        "/api/expirecode",
+		Server:      "adminapi",
+		Summary:     "Expire a previously issued code, looking up by UUID.",
+		Request:     ExpireCodeRequest{},
+		Response:    ExpireCodeResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	{
+		Path:        "/api/app-config",
+		Method:      "get",
+		Server:      "apiserver",
+		Summary:     "Describe the capabilities of the realm that owns the API key.",
+		Response:    AppConfigResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusNotModified, http.StatusUnauthorized, http.StatusInternalServerError},
+	},
+	{
+		Path:        "/api/realm/{id}/public",
+		Method:      "get",
+		Server:      "apiserver",
+		Summary:     "Read the public configuration of a realm. Does not require an API key.",
+		Response:    RealmPublicConfigResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusNotModified, http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError},
+		Public:      true,
+	},
+	{
+		Path:        "/api/stats/realm",
+		Method:      "get",
+		Server:      "adminapi",
+		Summary:     "Read the daily code statistics of the realm that owns the stats API key.",
+		Response:    RealmStatsResponse{},
+		StatusCodes: []int{http.StatusOK, http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+}
+
+// method returns the lowercase HTTP method of the operation.
+func (op *openAPIOperation) method() string {
+	if op.Method == "" {
+		return "post"
+	}
+	return op.Method
+}
+
+// OpenAPI builds the OpenAPI 3 document that describes the JSON APIs. Schemas
+// are generated from the request and response types in this package so the
+// document cannot drift from the wire format.
+func OpenAPI() map[string]interface{} {
+	schemas := map[string]interface{}{
+		"ErrorCode": map[string]interface{}{
+			"type": "string",
+			"enum": openAPIErrorCodes,
+		},
+	}
+
+	paths := make(map[string]interface{}, len(openAPIOperations))
+	for _, op := range openAPIOperations {
+		respName := openAPIRegisterSchema(schemas, reflect.TypeOf(op.Response))
+
+		responses := make(map[string]interface{}, len(op.StatusCodes))
+		for _, code := range op.StatusCodes {
+			if code == http.StatusNotModified {
+				responses[strconv.Itoa(code)] = map[string]interface{}{
+					"description": http.StatusText(code),
+				}
+				continue
+			}
+
+			responses[strconv.Itoa(code)] = map[string]interface{}{
+				"description": http.StatusText(code),
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": openAPIRef(respName),
+					},
+				},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"summary":   op.Summary,
+			"tags":      []string{op.Server},
+			"responses": responses,
+		}
+		if params := openAPIPathParameters(op.Path); len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.Public {
+			// An empty list overrides the document's default security requirement.
+			operation["security"] = []interface{}{}
+		}
+		if op.Request != nil {
+			reqName := openAPIRegisterSchema(schemas, reflect.TypeOf(op.Request))
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": openAPIRef(reqName),
+					},
+				},
+			}
+		}
+
+		paths[op.Path] = map[string]interface{}{
+			op.method(): operation,
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": OpenAPIVersion,
+		"info": map[string]interface{}{
+			"title":       "Exposure Notifications Verification Server API",
+			"description": "Unless noted otherwise, endpoints require an API key passed via the X-API-Key header.",
+			"version":     "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-API-Key",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"apiKey": []string{}},
+		},
+	}
+}
+
+// openAPIJSONName returns the JSON key for the struct field, or the empty
+// string if the field is not serialized.
+func openAPIJSONName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// openAPIPathParameters returns the parameters for each "{name}" segment of the
+// path.
+func openAPIPathParameters(path string) []interface{} {
+	var params []interface{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, map[string]interface{}{
+				"name":     strings.Trim(segment, "{}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	return params
+}
+
+func openAPIRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openAPIRegisterSchema adds the schema for the struct type to schemas and
+// returns its name.
+func openAPIRegisterSchema(schemas map[string]interface{}, t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	name := t.Name()
+	if _, ok := schemas[name]; ok {
+		return name
+	}
+
+	// Reserve the name before recursing to handle self-referential types.
+	schemas[name] = nil
+
+	properties := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := openAPIJSONName(f)
+		if key == "" {
+			continue
+		}
+
+		if key == "errorCode" || key == "error_code" {
+			properties[key] = openAPIRef("ErrorCode")
+			continue
+		}
+		properties[key] = openAPISchemaFor(schemas, f.Type)
+	}
+
+	schemas[name] = map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	return name
+}
+
+func openAPISchemaFor(schemas map[string]interface{}, t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(Padding{}) {
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return openAPISchemaFor(schemas, t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": openAPISchemaFor(schemas, t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": openAPISchemaFor(schemas, t.Elem())}
+	case reflect.Struct:
+		return openAPIRef(openAPIRegisterSchema(schemas, t))
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	// Round-trip through JSON so the document is validated exactly as served.
+	b, err := json.Marshal(OpenAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := doc["openapi"], OpenAPIVersion; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	paths := doc["paths"].(map[string]interface{})
+
+	for _, op := range openAPIOperations {
+		op := op
+
+		t.Run(op.Path, func(t *testing.T) {
+			t.Parallel()
+
+			operation, ok := paths[op.Path].(map[string]interface{})[op.method()].(map[string]interface{})
+			if !ok {
+				t.Fatalf("missing %s operation for %s", op.method(), op.Path)
+			}
+
+			if op.Request != nil {
+				reqSchema := operation["requestBody"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"]
+				if err := validateOpenAPI(schemas, reqSchema, populated(t, op.Request)); err != nil {
+					t.Errorf("request does not match schema: %v", err)
+				}
+			} else if _, ok := operation["requestBody"]; ok {
+				t.Errorf("expected no request body for %s", op.Path)
+			}
+
+			responses := operation["responses"].(map[string]interface{})
+			for code, resp := range responses {
+				content, ok := resp.(map[string]interface{})["content"]
+				if !ok {
+					if code != "304" {
+						t.Errorf("%s response has no content", code)
+					}
+					continue
+				}
+				respSchema := content.(map[string]interface{})["application/json"].(map[string]interface{})["schema"]
+				if err := validateOpenAPI(schemas, respSchema, populated(t, op.Response)); err != nil {
+					t.Errorf("%s response does not match schema: %v", code, err)
+				}
+			}
+		})
+	}
+}
+
+// openAPIHandlerFiles are the source files, relative to this package, of the
+// handler which serves each documented operation. Statuses returned by shared
+// middleware, like rate limiting and API key checks, are not included.
+var openAPIHandlerFiles = map[string][]string{
+	"/api/verify":            {"../controller/verifyapi/verify.go", "../controller/verifyapi/location.go"},
+	"/api/verify/long":       {"../controller/verifyapi/verify.go", "../controller/verifyapi/location.go"},
+	"/api/certificate":       {"../controller/certapi/certificate.go"},
+	"/api/issue":             {"../controller/issueapi/handle_issue.go", "../controller/issueapi/logic.go", "../controller/issueapi/ip.go"},
+	"/api/checkcodestatus":   {"../controller/codes/api.go", "../controller/codes/logic.go"},
+	"/api/expirecode":        {"../controller/codes/expire.go", "../controller/codes/logic.go"},
+	"/api/app-config":        {"../controller/appconfig/show.go"},
+	"/api/realm/{id}/public": {"../controller/appconfig/public.go"},
+	"/api/stats/realm":       {"../controller/statsapi/realm.go"},
+}
+
+// httpStatusCodes maps the names of the net/http status constants to their
+// values. Add to it when a handler uses a new status.
+var httpStatusCodes = map[string]int{
+	"StatusOK":                    http.StatusOK,
+	"StatusCreated":               http.StatusCreated,
+	"StatusNoContent":             http.StatusNoContent,
+	"StatusSeeOther":              http.StatusSeeOther,
+	"StatusNotModified":           http.StatusNotModified,
+	"StatusBadRequest":            http.StatusBadRequest,
+	"StatusUnauthorized":          http.StatusUnauthorized,
+	"StatusForbidden":             http.StatusForbidden,
+	"StatusNotFound":              http.StatusNotFound,
+	"StatusMethodNotAllowed":      http.StatusMethodNotAllowed,
+	"StatusConflict":              http.StatusConflict,
+	"StatusPreconditionFailed":    http.StatusPreconditionFailed,
+	"StatusRequestEntityTooLarge": http.StatusRequestEntityTooLarge,
+	"StatusTooManyRequests":       http.StatusTooManyRequests,
+	"StatusInternalServerError":   http.StatusInternalServerError,
+	"StatusNotImplemented":        http.StatusNotImplemented,
+	"StatusServiceUnavailable":    http.StatusServiceUnavailable,
+	"StatusGatewayTimeout":        http.StatusGatewayTimeout,
+}
+
+func TestOpenAPI_HandlerStatusCodes(t *testing.T) {
+	t.Parallel()
+
+	for _, op := range openAPIOperations {
+		op := op
+
+		t.Run(op.Path, func(t *testing.T) {
+			t.Parallel()
+
+			files, ok := openAPIHandlerFiles[op.Path]
+			if !ok {
+				t.Fatalf("no handler files for %s", op.Path)
+			}
+
+			documented := make(map[int]struct{}, len(op.StatusCodes))
+			for _, code := range op.StatusCodes {
+				documented[code] = struct{}{}
+			}
+
+			for _, pth := range files {
+				for _, name := range httpStatusNames(t, pth) {
+					code, ok := httpStatusCodes[name]
+					if !ok {
+						t.Errorf("%s: unknown status http.%s", pth, name)
+						continue
+					}
+					if _, ok := documented[code]; !ok {
+						t.Errorf("%s: returns %d which is not documented for %s", pth, code, op.Path)
+					}
+				}
+			}
+		})
+	}
+}
+
+// httpStatusNames returns the names of the net/http status constants that are
+// referenced in the Go source file.
+func httpStatusNames(tb testing.TB, pth string) []string {
+	tb.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), pth, nil, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var names []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "http" && strings.HasPrefix(sel.Sel.Name, "Status") {
+			names = append(names, sel.Sel.Name)
+		}
+		return true
+	})
+	return names
+}
+
+// populated returns the JSON-decoded form of a value of the same type as v,
+// with every field set to a non-zero value so that omitempty fields appear.
+func populated(t testing.TB, v interface{}) interface{} {
+	t.Helper()
+
+	rv := reflect.New(reflect.TypeOf(v)).Elem()
+	fill(rv)
+
+	b, err := json.Marshal(rv.Interface())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var out interface{}
+	if err := d.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func fill(v reflect.Value) {
+	if v.Type() == reflect.TypeOf(Padding{}) {
+		v.SetBytes([]byte("padding"))
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.String:
+		v.SetString("value")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		val := reflect.New(v.Type().Elem()).Elem()
+		fill(val)
+		v.SetMapIndex(reflect.ValueOf("key").Convert(v.Type().Key()), val)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if openAPIJSONName(f) == "" {
+				continue
+			}
+			if strings.HasPrefix(openAPIJSONName(f), "error") && f.Type.Kind() == reflect.String {
+				v.Field(i).SetString(ErrInternal)
+				continue
+			}
+			fill(v.Field(i))
+		}
+	}
+}
+
+// validateOpenAPI validates the decoded JSON value against the schema. Objects
+// must contain exactly the documented properties.
+func validateOpenAPI(schemas map[string]interface{}, schema, value interface{}) error {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid schema %#v", schema)
+	}
+
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		resolved, ok := schemas[name]
+		if !ok {
+			return fmt.Errorf("unknown schema %q", ref)
+		}
+		return validateOpenAPI(schemas, resolved, value)
+	}
+
+	switch typ := s["type"]; typ {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object, got %T", value)
+		}
+
+		if additional, ok := s["additionalProperties"]; ok {
+			for k, v := range obj {
+				if err := validateOpenAPI(schemas, additional, v); err != nil {
+					return fmt.Errorf("%s: %w", k, err)
+				}
+			}
+			return nil
+		}
+
+		props, _ := s["properties"].(map[string]interface{})
+		for k, v := range obj {
+			prop, ok := props[k]
+			if !ok {
+				return fmt.Errorf("undocumented property %q", k)
+			}
+			if err := validateOpenAPI(schemas, prop, v); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+		for k := range props {
+			if _, ok := obj[k]; !ok {
+				return fmt.Errorf("documented property %q is never sent", k)
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("expected array, got %T", value)
+		}
+		for i, v := range arr {
+			if err := validateOpenAPI(schemas, s["items"], v); err != nil {
+				return fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", value)
+		}
+		if enum, ok := s["enum"].([]interface{}); ok {
+			for _, e := range enum {
+				if e == str {
+					return nil
+				}
+			}
+			return fmt.Errorf("%q is not one of %v", str, enum)
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected integer, got %T", value)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("expected integer: %w", err)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("expected number, got %T", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected boolean, got %T", value)
+		}
+	default:
+		return fmt.Errorf("unknown schema type %v", typ)
+	}
+	return nil
+}
+
+func TestOpenAPIPathParameters(t *testing.T) {
+	t.Parallel()
+
+	if got := openAPIPathParameters("/api/verify"); len(got) != 0 {
+		t.Errorf("expected no parameters, got %v", got)
+	}
+
+	got := openAPIPathParameters("/api/realm/{id}/public")
+	if len(got) != 1 {
+		t.Fatalf("expected 1 parameter, got %v", got)
+	}
+	param := got[0].(map[string]interface{})
+	if got, want := param["name"], "id"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := param["in"], "path"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
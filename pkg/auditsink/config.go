@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SinkType represents a type of audit sink.
+type SinkType string
+
+const (
+	TypeNone   SinkType = "NONE"
+	TypeSyslog SinkType = "SYSLOG"
+	TypeHTTP   SinkType = "HTTP"
+)
+
+// Config represents configuration for forwarding audit entries.
+type Config struct {
+	Type SinkType `env:"AUDIT_SINK_TYPE, default=NONE"`
+
+	// SyslogNetwork and SyslogAddress are the syslog server to send entries
+	// to, for example "udp" and "syslog.example.com:514". If the address is
+	// empty, the local syslog daemon is used.
+	SyslogNetwork string `env:"AUDIT_SINK_SYSLOG_NETWORK, default=udp"`
+	SyslogAddress string `env:"AUDIT_SINK_SYSLOG_ADDRESS"`
+	SyslogTag     string `env:"AUDIT_SINK_SYSLOG_TAG, default=en-verification-audit"`
+
+	// HTTPURL is the log collector endpoint that receives newline-delimited
+	// JSON entries. HTTPAuthorization, if set, is sent as the Authorization
+	// header.
+	HTTPURL           string `env:"AUDIT_SINK_HTTP_URL"`
+	HTTPAuthorization string `env:"AUDIT_SINK_HTTP_AUTHORIZATION" json:"-"`
+
+	// BufferSize is the number of entries held in memory while waiting to be
+	// forwarded. When the buffer is full, new entries are dropped from the sink
+	// (but are still saved in the database).
+	BufferSize int `env:"AUDIT_SINK_BUFFER_SIZE, default=1000"`
+
+	// BatchSize is the maximum number of entries sent at once.
+	BatchSize int `env:"AUDIT_SINK_BATCH_SIZE, default=100"`
+
+	// Timeout is the maximum time to spend sending a batch.
+	Timeout time.Duration `env:"AUDIT_SINK_TIMEOUT, default=5s"`
+}
+
+// SinkFor returns the sink for the configuration.
+func SinkFor(ctx context.Context, c *Config) (Sink, error) {
+	switch typ := c.Type; typ {
+	case TypeNone, "":
+		return NewNoop(), nil
+	case TypeSyslog:
+		w, err := newSyslogWriter(c.SyslogNetwork, c.SyslogAddress, c.SyslogTag)
+		if err != nil {
+			return nil, err
+		}
+		return NewForwarder(ctx, w, c)
+	case TypeHTTP:
+		if c.HTTPURL == "" {
+			return nil, fmt.Errorf("AUDIT_SINK_HTTP_URL is required for the HTTP audit sink")
+		}
+		return NewForwarder(ctx, newHTTPWriter(c.HTTPURL, c.HTTPAuthorization), c)
+	default:
+		return nil, fmt.Errorf("unknown audit sink type: %v", typ)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var _ writer = (*httpWriter)(nil)
+
+// httpWriter posts batches of entries to a log collector as newline-delimited
+// JSON.
+type httpWriter struct {
+	client        *http.Client
+	url           string
+	authorization string
+}
+
+func newHTTPWriter(url, authorization string) *httpWriter {
+	return &httpWriter{
+		client:        &http.Client{},
+		url:           url,
+		authorization: authorization,
+	}
+}
+
+func (h *httpWriter) Write(ctx context.Context, entries []*Entry) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to marshal entry: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if h.authorization != "" {
+		req.Header.Set("Authorization", h.authorization)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post entries: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024)); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("log collector returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (h *httpWriter) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
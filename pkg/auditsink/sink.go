@@ -0,0 +1,153 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package auditsink forwards audit entries to an external system, such as a
+// SIEM, in addition to the copy kept in the database.
+package auditsink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Entry is the structured form of an audit entry sent to the sink.
+type Entry struct {
+	ID            uint      `json:"id"`
+	RealmID       uint      `json:"realmID"`
+	ActorID       string    `json:"actorID"`
+	ActorDisplay  string    `json:"actorDisplay"`
+	Action        string    `json:"action"`
+	TargetID      string    `json:"targetID"`
+	TargetDisplay string    `json:"targetDisplay"`
+	Diff          string    `json:"diff,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// Sink receives audit entries.
+type Sink interface {
+	// Send queues the entry to be forwarded. It must not block.
+	Send(e *Entry)
+
+	// Close flushes queued entries and releases resources.
+	Close() error
+}
+
+// writer sends a batch of entries to the external system.
+type writer interface {
+	Write(ctx context.Context, entries []*Entry) error
+	Close() error
+}
+
+// Forwarder is a Sink which buffers entries in memory and writes them in the
+// background.
+type Forwarder struct {
+	w         writer
+	logger    *zap.SugaredLogger
+	batchSize int
+	timeout   time.Duration
+
+	ch       chan *Entry
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewForwarder creates a forwarder which writes to w and starts its background
+// worker.
+func NewForwarder(ctx context.Context, w writer, c *Config) (*Forwarder, error) {
+	if c.BufferSize < 1 {
+		return nil, fmt.Errorf("AUDIT_SINK_BUFFER_SIZE must be positive")
+	}
+	if c.BatchSize < 1 {
+		return nil, fmt.Errorf("AUDIT_SINK_BATCH_SIZE must be positive")
+	}
+
+	f := &Forwarder{
+		w:         w,
+		logger:    logging.FromContext(ctx).Named("auditsink"),
+		batchSize: c.BatchSize,
+		timeout:   c.Timeout,
+		ch:        make(chan *Entry, c.BufferSize),
+		doneCh:    make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Send queues the entry. If the buffer is full, the entry is dropped and an
+// error is logged.
+func (f *Forwarder) Send(e *Entry) {
+	select {
+	case f.ch <- e:
+	default:
+		f.logger.Errorw("audit sink buffer full, dropping entry",
+			"id", e.ID,
+			"action", e.Action)
+	}
+}
+
+// Close stops accepting entries, flushes the buffer, and closes the writer.
+// Send must not be called after Close.
+func (f *Forwarder) Close() error {
+	f.stopOnce.Do(func() {
+		close(f.ch)
+	})
+	<-f.doneCh
+	return f.w.Close()
+}
+
+// run reads entries from the buffer and writes them in batches until the
+// buffer is closed.
+func (f *Forwarder) run() {
+	defer close(f.doneCh)
+
+	for e := range f.ch {
+		batch := []*Entry{e}
+
+		// Collect anything else that is already waiting, up to the batch size.
+	collect:
+		for len(batch) < f.batchSize {
+			select {
+			case next, ok := <-f.ch:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+
+		f.write(batch)
+	}
+}
+
+func (f *Forwarder) write(batch []*Entry) {
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	if err := f.w.Write(ctx, batch); err != nil {
+		f.logger.Errorw("failed to forward audit entries",
+			"count", len(batch),
+			"error", err)
+	}
+}
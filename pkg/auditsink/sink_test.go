@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auditsink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForwarder_HTTP(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var got []*Entry
+	var auth string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		auth = r.Header.Get("Authorization")
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var e Entry
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Errorf("failed to decode entry: %v", err)
+				continue
+			}
+			got = append(got, &e)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	f, err := NewForwarder(context.Background(), newHTTPWriter(srv.URL, "Bearer token"), &Config{
+		BufferSize: 10,
+		BatchSize:  2,
+		Timeout:    5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint(1); i <= 5; i++ {
+		f.Send(&Entry{ID: i, Action: "created user"})
+	}
+
+	// Close flushes the buffer.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(got) != 5 {
+		t.Fatalf("expected 5 entries, got %d", len(got))
+	}
+	for i, e := range got {
+		if want := uint(i + 1); e.ID != want {
+			t.Errorf("expected entry %d to have id %d, got %d", i, want, e.ID)
+		}
+	}
+	if auth != "Bearer token" {
+		t.Errorf("expected %q to be %q", auth, "Bearer token")
+	}
+}
+
+// blockingWriter blocks writes until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+}
+
+func (b *blockingWriter) Write(ctx context.Context, entries []*Entry) error {
+	<-b.release
+	return nil
+}
+
+func (b *blockingWriter) Close() error {
+	return nil
+}
+
+func TestForwarder_DoesNotBlock(t *testing.T) {
+	t.Parallel()
+
+	w := &blockingWriter{release: make(chan struct{})}
+	f, err := NewForwarder(context.Background(), w, &Config{
+		BufferSize: 1,
+		BatchSize:  1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint(0); i < 10; i++ {
+			f.Send(&Entry{ID: i})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Send not to block when the buffer is full")
+	}
+
+	close(w.release)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSinkFor(t *testing.T) {
+	t.Parallel()
+
+	if _, err := SinkFor(context.Background(), &Config{Type: TypeNone}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, err := SinkFor(context.Background(), &Config{Type: TypeHTTP}); err == nil {
+		t.Errorf("expected error for missing URL")
+	}
+	if _, err := SinkFor(context.Background(), &Config{Type: "BANANA"}); err == nil {
+		t.Errorf("expected error for unknown type")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package blobstore writes files, such as scheduled exports, to blob storage
+// and creates expiring links to them.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotConfigured is returned when blob storage is used but not configured.
+var ErrNotConfigured = errors.New("blob storage is not configured")
+
+// Type represents a type of blob storage.
+type Type string
+
+const (
+	TypeNone       Type = "NONE"
+	TypeGCS        Type = "GOOGLE_CLOUD_STORAGE"
+	TypeFilesystem Type = "FILESYSTEM"
+)
+
+// Config represents the configuration for blob storage.
+type Config struct {
+	Type Type `env:"BLOBSTORE, default=NONE"`
+
+	// FilesystemRoot is the directory under which buckets are created when
+	// using the filesystem. It is intended for local development.
+	FilesystemRoot string `env:"BLOBSTORE_FILESYSTEM_ROOT"`
+
+	// SigningServiceAccount is the email of the service account used to sign
+	// Cloud Storage links. The server's identity must be allowed to create
+	// tokens for it (roles/iam.serviceAccountTokenCreator).
+	SigningServiceAccount string `env:"BLOBSTORE_SIGNING_SERVICE_ACCOUNT"`
+}
+
+// Blobstore writes objects and creates links to them.
+type Blobstore interface {
+	// CreateObject writes the contents to the object in the bucket, replacing
+	// it if it exists.
+	CreateObject(ctx context.Context, bucket, object, contentType string, contents []byte) error
+
+	// SignedURL returns a link which allows anyone to download the object
+	// until it expires.
+	SignedURL(ctx context.Context, bucket, object string, ttl time.Duration) (string, error)
+}
+
+// BlobstoreFor returns the blob storage for the configuration.
+func BlobstoreFor(ctx context.Context, c *Config) (Blobstore, error) {
+	switch typ := c.Type; typ {
+	case TypeNone, "":
+		return NewNoop(), nil
+	case TypeGCS:
+		return NewGCS(ctx, c.SigningServiceAccount)
+	case TypeFilesystem:
+		if c.FilesystemRoot == "" {
+			return nil, fmt.Errorf("BLOBSTORE_FILESYSTEM_ROOT is required for the filesystem blobstore")
+		}
+		return NewFilesystem(c.FilesystemRoot), nil
+	default:
+		return nil, fmt.Errorf("unknown blobstore type: %v", typ)
+	}
+}
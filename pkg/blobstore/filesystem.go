@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ Blobstore = (*Filesystem)(nil)
+
+// Filesystem is a Blobstore which writes objects to the local filesystem. Each
+// bucket is a directory under the root. Links are file:// URLs which do not
+// expire, so it must only be used for local development.
+type Filesystem struct {
+	root string
+}
+
+// NewFilesystem creates a new filesystem blobstore rooted at the directory.
+func NewFilesystem(root string) *Filesystem {
+	return &Filesystem{root: root}
+}
+
+// CreateObject writes the object to root/bucket/object.
+func (f *Filesystem) CreateObject(_ context.Context, bucket, object, _ string, contents []byte) error {
+	pth, err := f.path(bucket, object)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(pth), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := ioutil.WriteFile(pth, contents, 0600); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	return nil
+}
+
+// SignedURL returns a file:// URL to the object. The ttl is ignored.
+func (f *Filesystem) SignedURL(_ context.Context, bucket, object string, _ time.Duration) (string, error) {
+	pth, err := f.path(bucket, object)
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(pth)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+	u := &url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}
+	return u.String(), nil
+}
+
+// path returns the path to the object, ensuring it stays within the root.
+func (f *Filesystem) path(bucket, object string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", fmt.Errorf("invalid bucket %q", bucket)
+	}
+
+	root := filepath.Join(f.root, bucket)
+	pth := filepath.Join(root, filepath.FromSlash(object))
+	if pth == root || !strings.HasPrefix(pth, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object %q", object)
+	}
+	return pth, nil
+}
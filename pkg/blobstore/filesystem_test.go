@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilesystem(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	fs := NewFilesystem(root)
+
+	if err := fs.CreateObject(ctx, "exports", "realm-1/stats.csv", "text/csv", []byte("a,b\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(root, "exports", "realm-1", "stats.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "a,b\n"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	u, err := fs.SignedURL(ctx, "exports", "realm-1/stats.csv", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u, "file://") || !strings.HasSuffix(u, "/exports/realm-1/stats.csv") {
+		t.Errorf("unexpected url %q", u)
+	}
+
+	// Objects cannot escape the bucket.
+	for _, tc := range []struct{ bucket, object string }{
+		{"exports", "../other/stats.csv"},
+		{"exports", ""},
+		{"..", "stats.csv"},
+		{"a/b", "stats.csv"},
+	} {
+		if err := fs.CreateObject(ctx, tc.bucket, tc.object, "text/csv", nil); err == nil {
+			t.Errorf("expected error for %q/%q", tc.bucket, tc.object)
+		}
+	}
+}
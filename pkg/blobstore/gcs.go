@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/storage"
+	iamcredentials "google.golang.org/api/iamcredentials/v1"
+)
+
+var _ Blobstore = (*GCS)(nil)
+
+// GCS is a Blobstore backed by Google Cloud Storage.
+type GCS struct {
+	client *storage.Client
+
+	// signer and signingAccount sign links. If signingAccount is empty, links
+	// cannot be created.
+	signer         *iamcredentials.Service
+	signingAccount string
+}
+
+// NewGCS creates a new Cloud Storage blobstore using the default credentials.
+// If signingAccount is not empty, links are signed with that service account
+// using the IAM Credentials API.
+func NewGCS(ctx context.Context, signingAccount string) (*GCS, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	g := &GCS{
+		client:         client,
+		signingAccount: signingAccount,
+	}
+
+	if signingAccount != "" {
+		signer, err := iamcredentials.NewService(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create iam credentials client: %w", err)
+		}
+		g.signer = signer
+	}
+	return g, nil
+}
+
+// CreateObject writes the object to the bucket.
+func (g *GCS) CreateObject(ctx context.Context, bucket, object, contentType string, contents []byte) error {
+	w := g.client.Bucket(bucket).Object(object).NewWriter(ctx)
+	w.ContentType = contentType
+
+	if _, err := w.Write(contents); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("failed to write gs://%s/%s: %w", bucket, object, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to write gs://%s/%s: %w", bucket, object, err)
+	}
+	return nil
+}
+
+// SignedURL creates a V4 signed URL for downloading the object. Cloud Storage
+// does not accept a ttl longer than 7 days.
+func (g *GCS) SignedURL(ctx context.Context, bucket, object string, ttl time.Duration) (string, error) {
+	if g.signer == nil {
+		return "", fmt.Errorf("BLOBSTORE_SIGNING_SERVICE_ACCOUNT is required to create links")
+	}
+
+	name := "projects/-/serviceAccounts/" + g.signingAccount
+	u, err := storage.SignedURL(bucket, object, &storage.SignedURLOptions{
+		GoogleAccessID: g.signingAccount,
+		Method:         http.MethodGet,
+		Expires:        time.Now().Add(ttl),
+		Scheme:         storage.SigningSchemeV4,
+		SignBytes: func(b []byte) ([]byte, error) {
+			resp, err := g.signer.Projects.ServiceAccounts.
+				SignBlob(name, &iamcredentials.SignBlobRequest{
+					Payload: base64.StdEncoding.EncodeToString(b),
+				}).
+				Context(ctx).
+				Do()
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign: %w", err)
+			}
+			return base64.StdEncoding.DecodeString(resp.SignedBlob)
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign url: %w", err)
+	}
+	return u, nil
+}
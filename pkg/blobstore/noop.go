@@ -0,0 +1,41 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blobstore
+
+import (
+	"context"
+	"time"
+)
+
+var _ Blobstore = (*Noop)(nil)
+
+// Noop is a Blobstore which is not configured. All operations fail with
+// ErrNotConfigured.
+type Noop struct{}
+
+// NewNoop creates a new noop blobstore.
+func NewNoop() *Noop {
+	return &Noop{}
+}
+
+// CreateObject returns ErrNotConfigured.
+func (n *Noop) CreateObject(_ context.Context, _, _, _ string, _ []byte) error {
+	return ErrNotConfigured
+}
+
+// SignedURL returns ErrNotConfigured.
+func (n *Noop) SignedURL(_ context.Context, _, _ string, _ time.Duration) (string, error) {
+	return "", ErrNotConfigured
+}
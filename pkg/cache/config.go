@@ -17,6 +17,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/redis"
 	"github.com/sethvargo/go-envconfig"
@@ -40,6 +41,15 @@ type Config struct {
 
 	// Redis configuration
 	Redis redis.Config `env:", prefix=CACHE_"`
+
+	// LocalTTL is how long values in LocalNamespaces are held in memory on each
+	// instance, in front of the shared cache. Changes made on one instance are
+	// visible on the others after at most this duration. Set to 0 to disable.
+	// This only applies to the REDIS cacher.
+	LocalTTL time.Duration `env:"CACHE_LOCAL_TTL, default=30s"`
+
+	// LocalNamespaces are the key namespaces held in memory on each instance.
+	LocalNamespaces []string `env:"CACHE_LOCAL_NAMESPACES, default=realms:by_id"`
 }
 
 func CacherFor(ctx context.Context, c *Config, keyFunc KeyFunc) (Cacher, error) {
@@ -51,7 +61,7 @@ func CacherFor(ctx context.Context, c *Config, keyFunc KeyFunc) (Cacher, error)
 			KeyFunc: keyFunc,
 		})
 	case TypeRedis:
-		return NewRedis(&RedisConfig{
+		shared, err := NewRedis(&RedisConfig{
 			KeyFunc:     keyFunc,
 			Address:     fmt.Sprintf("%s:%s", c.Redis.Host, c.Redis.Port),
 			Username:    c.Redis.Username,
@@ -60,6 +70,29 @@ func CacherFor(ctx context.Context, c *Config, keyFunc KeyFunc) (Cacher, error)
 			MaxIdle:     c.Redis.MaxIdle,
 			MaxActive:   c.Redis.MaxActive,
 		})
+		if err != nil {
+			return nil, err
+		}
+		if c.LocalTTL <= 0 || len(c.LocalNamespaces) == 0 {
+			return shared, nil
+		}
+
+		local, err := NewInMemory(&InMemoryConfig{
+			GCInterval: 10 * c.LocalTTL,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ttls := make(map[string]time.Duration, len(c.LocalNamespaces))
+		for _, ns := range c.LocalNamespaces {
+			ttls[ns] = c.LocalTTL
+		}
+		return NewLayered(&LayeredConfig{
+			Local:  local,
+			Shared: shared,
+			TTLs:   ttls,
+		})
 	default:
 		return nil, fmt.Errorf("unknown cacher type: %v", typ)
 	}
@@ -0,0 +1,159 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var _ Cacher = (*layered)(nil)
+
+// layered is a cacher that holds selected namespaces in a per-instance cacher
+// in front of a shared cacher. This avoids a round trip to the shared cache for
+// values that are read on nearly every request, such as realm settings.
+//
+// Deletes go to both layers, so an instance sees its own changes immediately.
+// Other instances see changes once their local entry expires.
+type layered struct {
+	local  Cacher
+	shared Cacher
+
+	// ttls is the maximum local TTL, by namespace. Keys in other namespaces are
+	// only stored in the shared cacher.
+	ttls map[string]time.Duration
+}
+
+// LayeredConfig is the configuration for a layered cacher.
+type LayeredConfig struct {
+	// Local is the per-instance cacher. It is closed when the layered cacher is
+	// closed.
+	Local Cacher
+
+	// Shared is the cacher shared by all instances. It is closed when the layered
+	// cacher is closed.
+	Shared Cacher
+
+	// TTLs is the maximum time values are held in the local cacher, by key
+	// namespace.
+	TTLs map[string]time.Duration
+}
+
+// NewLayered creates a new layered cacher.
+func NewLayered(c *LayeredConfig) (Cacher, error) {
+	if c == nil || c.Local == nil || c.Shared == nil {
+		return nil, errors.New("local and shared cachers are required")
+	}
+
+	return &layered{
+		local:  c.Local,
+		shared: c.Shared,
+		ttls:   c.TTLs,
+	}, nil
+}
+
+// localTTL returns the TTL for the key in the local layer, capped at ttl. It
+// returns false if the key is not held locally.
+func (c *layered) localTTL(k *Key, ttl time.Duration) (time.Duration, bool) {
+	localTTL, ok := c.ttls[k.Namespace]
+	if !ok || localTTL <= 0 {
+		return 0, false
+	}
+	if ttl > 0 && ttl < localTTL {
+		localTTL = ttl
+	}
+	return localTTL, true
+}
+
+// Fetch reads the key from the local layer, falling back to Fetch on the shared
+// cacher.
+func (c *layered) Fetch(ctx context.Context, k *Key, out interface{}, ttl time.Duration, f FetchFunc) error {
+	localTTL, ok := c.localTTL(k, ttl)
+	if !ok {
+		return c.shared.Fetch(ctx, k, out, ttl, f)
+	}
+
+	if err := c.local.Read(ctx, k, out); err == nil {
+		recordLocal(ctx, k.Namespace, true)
+		return nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	recordLocal(ctx, k.Namespace, false)
+
+	if err := c.shared.Fetch(ctx, k, out, ttl, f); err != nil {
+		return err
+	}
+	return c.local.Write(ctx, k, out, localTTL)
+}
+
+// Read reads the key from the local layer, falling back to the shared cacher.
+func (c *layered) Read(ctx context.Context, k *Key, out interface{}) error {
+	localTTL, ok := c.localTTL(k, 0)
+	if !ok {
+		return c.shared.Read(ctx, k, out)
+	}
+
+	if err := c.local.Read(ctx, k, out); err == nil {
+		recordLocal(ctx, k.Namespace, true)
+		return nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	recordLocal(ctx, k.Namespace, false)
+
+	if err := c.shared.Read(ctx, k, out); err != nil {
+		return err
+	}
+	return c.local.Write(ctx, k, out, localTTL)
+}
+
+// Write writes the key to both layers.
+func (c *layered) Write(ctx context.Context, k *Key, val interface{}, ttl time.Duration) error {
+	if err := c.shared.Write(ctx, k, val, ttl); err != nil {
+		return err
+	}
+
+	if localTTL, ok := c.localTTL(k, ttl); ok {
+		return c.local.Write(ctx, k, val, localTTL)
+	}
+	return nil
+}
+
+// Delete removes the key from both layers.
+func (c *layered) Delete(ctx context.Context, k *Key) error {
+	if err := c.local.Delete(ctx, k); err != nil {
+		return err
+	}
+	return c.shared.Delete(ctx, k)
+}
+
+// DeletePrefix removes all keys with the prefix from both layers.
+func (c *layered) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := c.local.DeletePrefix(ctx, prefix); err != nil {
+		return err
+	}
+	return c.shared.DeletePrefix(ctx, prefix)
+}
+
+// Close closes both layers.
+func (c *layered) Close() error {
+	localErr := c.local.Close()
+	if err := c.shared.Close(); err != nil {
+		return err
+	}
+	return localErr
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func testLayered(tb testing.TB, ttls map[string]time.Duration) (Cacher, Cacher, Cacher) {
+	tb.Helper()
+
+	local, err := NewInMemory(nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	shared, err := NewInMemory(nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	cacher, err := NewLayered(&LayeredConfig{
+		Local:  local,
+		Shared: shared,
+		TTLs:   ttls,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if err := cacher.Close(); err != nil {
+			tb.Fatal(err)
+		}
+	})
+	return cacher, local, shared
+}
+
+func TestLayered(t *testing.T) {
+	t.Parallel()
+
+	cacher, _, _ := testLayered(t, nil)
+	exerciseCacher(t, cacher)
+}
+
+func TestLayered_Local(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cacher, local, shared := testLayered(t, map[string]time.Duration{
+		"realms:by_id": time.Minute,
+	})
+
+	key := &Key{Namespace: "realms:by_id", Key: "1"}
+	other := &Key{Namespace: "other", Key: "1"}
+
+	for _, k := range []*Key{key, other} {
+		var out string
+		if err := cacher.Fetch(ctx, k, &out, time.Hour, func() (interface{}, error) {
+			return "value", nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := out, "value"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	}
+
+	// Only the configured namespace is held locally.
+	var out string
+	if err := local.Read(ctx, key, &out); err != nil {
+		t.Errorf("expected key in local layer: %v", err)
+	}
+	if err := local.Read(ctx, other, &out); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected other key not in local layer, got %v", err)
+	}
+
+	// A change in the shared cacher from another instance is not seen until the
+	// local entry expires.
+	if err := shared.Write(ctx, key, "changed", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacher.Read(ctx, key, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out, "value"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Delete removes the key from both layers.
+	if err := cacher.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Read(ctx, key, &out); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected key deleted from local layer, got %v", err)
+	}
+	if err := shared.Read(ctx, key, &out); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected key deleted from shared layer, got %v", err)
+	}
+}
+
+func TestLayered_LocalTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	cacher, _, shared := testLayered(t, map[string]time.Duration{
+		"realms:by_id": 50 * time.Millisecond,
+	})
+
+	key := &Key{Namespace: "realms:by_id", Key: "1"}
+	if err := cacher.Write(ctx, key, "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := shared.Write(ctx, key, "changed", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	var out string
+	if err := cacher.Read(ctx, key, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out, "changed"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
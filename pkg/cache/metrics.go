@@ -0,0 +1,66 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const metricPrefix = observability.MetricRoot + "/cache"
+
+var (
+	mLocalHit  = stats.Int64(metricPrefix+"/local_hit", "reads served by the local cache layer", stats.UnitDimensionless)
+	mLocalMiss = stats.Int64(metricPrefix+"/local_miss", "reads not found in the local cache layer", stats.UnitDimensionless)
+
+	// namespaceTagKey is the namespace of the cache key.
+	namespaceTagKey = tag.MustNewKey("namespace")
+)
+
+func init() {
+	tagKeys := append(observability.CommonTagKeys(), namespaceTagKey)
+
+	enobservability.CollectViews([]*view.View{
+		{
+			Name:        metricPrefix + "/local_hit_count",
+			Measure:     mLocalHit,
+			Description: "The count of reads served by the local cache layer",
+			TagKeys:     tagKeys,
+			Aggregation: view.Count(),
+		},
+		{
+			Name:        metricPrefix + "/local_miss_count",
+			Measure:     mLocalMiss,
+			Description: "The count of reads not found in the local cache layer",
+			TagKeys:     tagKeys,
+			Aggregation: view.Count(),
+		},
+	}...)
+}
+
+// recordLocal records a hit or miss on the local cache layer.
+func recordLocal(ctx context.Context, namespace string, hit bool) {
+	m := mLocalMiss
+	if hit {
+		m = mLocalHit
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(namespaceTagKey, namespace)}, m.M(1))
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package captcha verifies CAPTCHA tokens submitted to unauthenticated
+// endpoints, to deter automated abuse.
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingToken is returned when a request has no CAPTCHA token.
+	ErrMissingToken = errors.New("missing captcha token")
+
+	// ErrInvalidToken is returned when the provider rejects a token. Any other
+	// error from Verify means the provider could not be reached or gave an
+	// unexpected response.
+	ErrInvalidToken = errors.New("invalid captcha token")
+)
+
+// ProviderType represents a type of CAPTCHA provider.
+type ProviderType string
+
+const (
+	ProviderTypeNone      ProviderType = "NONE"
+	ProviderTypeRecaptcha ProviderType = "RECAPTCHA"
+	ProviderTypeHCaptcha  ProviderType = "HCAPTCHA"
+)
+
+// Endpoints which can require a CAPTCHA token, listed in CAPTCHA_ENDPOINTS.
+const (
+	// EndpointResetPassword is the password reset form on the server.
+	EndpointResetPassword = "reset-password"
+
+	// EndpointRealmPublic is the public realm information on the API server.
+	EndpointRealmPublic = "realm-public"
+
+	// EndpointVerify is code verification on the API server. Only enable it if
+	// every app which claims codes sends a token.
+	EndpointVerify = "verify"
+)
+
+const (
+	recaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+	hcaptchaVerifyURL  = "https://hcaptcha.com/siteverify"
+)
+
+// Config represents the configuration for CAPTCHA verification. It is off
+// unless a provider is set and at least one endpoint is listed.
+type Config struct {
+	ProviderType ProviderType `env:"CAPTCHA_PROVIDER, default=NONE"`
+
+	// SiteKey is shown to browsers to render the challenge, and SecretKey is
+	// used to verify tokens with the provider.
+	SiteKey   string `env:"CAPTCHA_SITE_KEY"`
+	SecretKey string `env:"CAPTCHA_SECRET_KEY"`
+
+	// VerifyURL overrides the provider's verification URL, for example to use
+	// recaptcha.net where google.com is blocked.
+	VerifyURL string `env:"CAPTCHA_VERIFY_URL"`
+
+	// MinScore is the lowest score to accept from providers which score
+	// requests, such as reCAPTCHA v3. It is ignored when there is no score.
+	MinScore float64 `env:"CAPTCHA_MIN_SCORE, default=0.5"`
+
+	// Endpoints are the names of the endpoints which require a token. See
+	// docs/production.md for the names.
+	Endpoints []string `env:"CAPTCHA_ENDPOINTS"`
+
+	// FailClosed rejects requests when the provider cannot be reached. By
+	// default they are allowed, so an outage at the provider does not block
+	// legitimate users. Tokens which the provider rejects are always refused.
+	FailClosed bool          `env:"CAPTCHA_FAIL_CLOSED"`
+	Timeout    time.Duration `env:"CAPTCHA_TIMEOUT, default=5s"`
+}
+
+// Enabled returns true if the endpoint requires a CAPTCHA token.
+func (c *Config) Enabled(endpoint string) bool {
+	if c.ProviderType == ProviderTypeNone || c.ProviderType == "" {
+		return false
+	}
+	for _, e := range c.Endpoints {
+		if strings.EqualFold(strings.TrimSpace(e), endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider verifies CAPTCHA tokens.
+type Provider interface {
+	// Verify checks the token solved by the client at remoteIP. It returns an
+	// error wrapping ErrInvalidToken if the token is rejected.
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// ProviderFor returns the CAPTCHA provider for the configuration.
+func ProviderFor(ctx context.Context, c *Config) (Provider, error) {
+	verifyURL := c.VerifyURL
+
+	switch typ := c.ProviderType; typ {
+	case ProviderTypeNone, "":
+		return NewNoop(), nil
+	case ProviderTypeRecaptcha:
+		if verifyURL == "" {
+			verifyURL = recaptchaVerifyURL
+		}
+	case ProviderTypeHCaptcha:
+		if verifyURL == "" {
+			verifyURL = hcaptchaVerifyURL
+		}
+	default:
+		return nil, fmt.Errorf("unknown captcha provider type: %v", typ)
+	}
+
+	if c.SecretKey == "" {
+		return nil, fmt.Errorf("CAPTCHA_SECRET_KEY is required for the %s captcha provider", c.ProviderType)
+	}
+	if c.SiteKey == "" {
+		return nil, fmt.Errorf("CAPTCHA_SITE_KEY is required for the %s captcha provider", c.ProviderType)
+	}
+	return NewSiteVerify(verifyURL, c.SecretKey, c.MinScore, c.Timeout), nil
+}
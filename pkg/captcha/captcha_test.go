@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSiteVerify_Verify(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		if got, want := r.PostForm.Get("secret"), "s3cr3t"; got != want {
+			t.Errorf("expected secret %q to be %q", got, want)
+		}
+
+		switch token := r.PostForm.Get("response"); token {
+		case "good":
+			fmt.Fprint(w, `{"success":true}`)
+		case "high-score":
+			fmt.Fprint(w, `{"success":true,"score":0.9}`)
+		case "low-score":
+			fmt.Fprint(w, `{"success":true,"score":0.1}`)
+		case "bad":
+			fmt.Fprint(w, `{"success":false,"error-codes":["invalid-input-response"]}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cases := []struct {
+		name  string
+		token string
+		err   error
+		fail  bool
+	}{
+		{name: "success", token: "good"},
+		{name: "high_score", token: "high-score"},
+		{name: "low_score", token: "low-score", err: ErrInvalidToken},
+		{name: "rejected", token: "bad", err: ErrInvalidToken},
+		{name: "missing", token: "", err: ErrMissingToken},
+		{name: "provider_error", token: "error", fail: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewSiteVerify(srv.URL, "s3cr3t", 0.5, 5*time.Second)
+			err := p.Verify(context.Background(), tc.token, "1.2.3.4")
+
+			switch {
+			case tc.err != nil:
+				if !errors.Is(err, tc.err) {
+					t.Errorf("expected %v to be %v", err, tc.err)
+				}
+			case tc.fail:
+				if err == nil || errors.Is(err, ErrInvalidToken) {
+					t.Errorf("expected provider error, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_Enabled(t *testing.T) {
+	t.Parallel()
+
+	c := &Config{Endpoints: []string{"reset-password", " realm-public"}}
+	if c.Enabled("reset-password") {
+		t.Errorf("expected no endpoints without a provider")
+	}
+
+	c.ProviderType = ProviderTypeHCaptcha
+	if !c.Enabled("reset-password") || !c.Enabled("realm-public") {
+		t.Errorf("expected configured endpoints to be enabled")
+	}
+	if c.Enabled("verify") {
+		t.Errorf("expected other endpoints to be disabled")
+	}
+}
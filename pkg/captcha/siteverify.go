@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var _ Provider = (*SiteVerify)(nil)
+
+// maxResponseBytes is the largest verification response which is read.
+const maxResponseBytes = 64 * 1024
+
+// SiteVerify verifies tokens with the siteverify API, which reCAPTCHA and
+// hCaptcha both implement.
+type SiteVerify struct {
+	verifyURL string
+	secret    string
+	minScore  float64
+	client    *http.Client
+}
+
+// NewSiteVerify creates a new provider which verifies tokens at verifyURL.
+func NewSiteVerify(verifyURL, secret string, minScore float64, timeout time.Duration) *SiteVerify {
+	return &SiteVerify{
+		verifyURL: verifyURL,
+		secret:    secret,
+		minScore:  minScore,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Verify implements Provider.
+func (s *SiteVerify) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrMissingToken
+	}
+
+	form := url.Values{
+		"secret":   []string{s.secret},
+		"response": []string{token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to verify captcha: provider returned %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		Score      *float64 `json:"score"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrInvalidToken, strings.Join(result.ErrorCodes, ", "))
+	}
+	if result.Score != nil && *result.Score < s.minScore {
+		return fmt.Errorf("%w: score %.2f is below %.2f", ErrInvalidToken, *result.Score, s.minScore)
+	}
+	return nil
+}
@@ -46,17 +46,53 @@ type AdminAPIServerConfig struct {
 	// Rate limiting configuration
 	RateLimit ratelimit.Config
 
+	// Request body size limits
+	BodyLimits BodyLimitConfig
+
+	// Response compression
+	Compression CompressionConfig
+
+	// Proxies in front of the server
+	Proxy ProxyConfig
+
+	// Request tracing
+	Tracing TracingConfig
+
+	// Limits on the optional fields of issued codes
+	IssueLimits IssueLimitConfig
+
 	Port                string        `env:"PORT,default=8080"`
 	APIKeyCacheDuration time.Duration `env:"API_KEY_CACHE_DURATION,default=5m"`
 
+	// MetricsPort, if set, serves metrics in the Prometheus format at /metrics
+	// on this port.
+	MetricsPort string `env:"METRICS_PORT"`
+
+	// GRPCPort, if set, serves the IssueCode, BatchIssueCode, and CheckCodeStatus
+	// RPCs of the gRPC API on this port.
+	GRPCPort string `env:"GRPC_PORT"`
+
 	CollisionRetryCount uint          `env:"COLLISION_RETRY_COUNT,default=6"`
 	AllowedSymptomAge   time.Duration `env:"ALLOWED_PAST_SYMPTOM_DAYS,default=672h"` // 672h is 28 days.
 	EnforceRealmQuotas  bool          `env:"ENFORCE_REALM_QUOTAS, default=true"`
 
+	// RequireFIPSRandomness asserts that the entropy source used for code
+	// generation is FIPS compliant. If the host is not in FIPS mode, the server
+	// will refuse to start.
+	RequireFIPSRandomness bool `env:"REQUIRE_FIPS_RANDOMNESS"`
+
 	// For EN Express, the link will be
 	// https://[realm-region].[ENX_REDIRECT_DOMAIN]/v?c=[longcode]
 	// This repository contains a redirect service that can be used for this purpose.
 	ENExpressRedirectDomain string `env:"ENX_REDIRECT_DOMAIN"`
+
+	// ClaimLinkURL is the web page which claims codes from signed claim links.
+	// If set, and claim links are enabled with DB_CLAIM_LINK_KEY, issued codes
+	// include a claimLink to this URL with the token in the "token" query
+	// parameter. Links are valid for ClaimLinkDuration, but never longer than
+	// the long code.
+	ClaimLinkURL      string        `env:"CLAIM_LINK_URL"`
+	ClaimLinkDuration time.Duration `env:"CLAIM_LINK_DURATION, default=1h"`
 }
 
 // NewAdminAPIServerConfig returns the environment config for the Admin API server.
@@ -69,7 +105,11 @@ func NewAdminAPIServerConfig(ctx context.Context) (*AdminAPIServerConfig, error)
 	return &config, nil
 }
 
+// Validate checks the configuration. All problems are returned together as a
+// *ValidationError.
 func (c *AdminAPIServerConfig) Validate() error {
+	var v validator
+
 	fields := []struct {
 		Var  time.Duration
 		Name string
@@ -79,20 +119,43 @@ func (c *AdminAPIServerConfig) Validate() error {
 	}
 
 	for _, f := range fields {
-		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
-			return err
-		}
+		v.positiveDuration(f.Var, f.Name)
 	}
 
 	c.ENExpressRedirectDomain = strings.ToLower(c.ENExpressRedirectDomain)
+	validateRedirectDomain(&v, c.ENExpressRedirectDomain)
 
-	return nil
+	v.positiveDuration(c.ClaimLinkDuration, "CLAIM_LINK_DURATION")
+	validateClaimLinkURL(&v, c.ClaimLinkURL, c.DevMode)
+
+	v.merge(c.BodyLimits.Validate())
+	v.merge(c.Compression.Validate())
+	v.merge(c.Proxy.Validate())
+	v.merge(c.IssueLimits.Validate())
+
+	return v.err()
 }
 
 func (c *AdminAPIServerConfig) GetENXRedirectDomain() string {
 	return c.ENExpressRedirectDomain
 }
 
+func (c *AdminAPIServerConfig) GetClaimLinkURL() string {
+	return c.ClaimLinkURL
+}
+
+func (c *AdminAPIServerConfig) GetClaimLinkDuration() time.Duration {
+	return c.ClaimLinkDuration
+}
+
+func (c *AdminAPIServerConfig) GetTrustedProxies() int {
+	return c.Proxy.TrustedProxies
+}
+
+func (c *AdminAPIServerConfig) GetIssueLimits() *IssueLimitConfig {
+	return &c.IssueLimits
+}
+
 func (c *AdminAPIServerConfig) GetCollisionRetryCount() uint {
 	return c.CollisionRetryCount
 }
@@ -21,7 +21,9 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/captcha"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/geo"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 
 	"github.com/google/exposure-notifications-server/pkg/observability"
@@ -44,11 +46,29 @@ type APIServerConfig struct {
 
 	Port string `env:"PORT,default=8080"`
 
+	// MetricsPort, if set, serves metrics in the Prometheus format at /metrics
+	// on this port.
+	MetricsPort string `env:"METRICS_PORT"`
+
+	// GRPCPort, if set, serves the VerifyCode RPC of the gRPC API on this port.
+	GRPCPort string `env:"GRPC_PORT"`
+
+	// SelfTest, if true, issues, claims, and verifies a throwaway code in the
+	// SelfTestRealmName realm at startup, and fails startup if any step fails.
+	// It is intended for development and staging environments.
+	SelfTest          bool   `env:"SELF_TEST"`
+	SelfTestRealmName string `env:"SELF_TEST_REALM_NAME, default=Startup self-test"`
+
 	APIKeyCacheDuration time.Duration `env:"API_KEY_CACHE_DURATION,default=5m"`
 
-	// Verification Token Config
+	// VerificationTokenDuration is how long verification tokens are valid,
+	// unless the realm sets its own duration.
 	VerificationTokenDuration time.Duration `env:"VERIFICATION_TOKEN_DURATION,default=24h"`
 
+	// NegativeResultTokenDuration is the lifetime of verification tokens for
+	// negative test results in realms using the short expiry policy.
+	NegativeResultTokenDuration time.Duration `env:"NEGATIVE_RESULT_TOKEN_DURATION,default=15m"`
+
 	// Token signing
 	TokenSigning TokenSigningConfig
 
@@ -58,6 +78,24 @@ type APIServerConfig struct {
 	// Rate limiting configuration
 	RateLimit ratelimit.Config
 
+	// Geo locates clients, for realms which restrict where codes are claimed.
+	Geo geo.Config
+
+	// Request body size limits
+	BodyLimits BodyLimitConfig
+
+	// Response compression
+	Compression CompressionConfig
+
+	// Proxies in front of the server
+	Proxy ProxyConfig
+
+	// Request tracing
+	Tracing TracingConfig
+
+	// CAPTCHA verification for unauthenticated endpoints
+	Captcha captcha.Config
+
 	// cached allowed public keys
 	allowedTokenPublicKeys map[string]string
 	mu                     sync.RWMutex
@@ -104,25 +142,35 @@ func (c *APIServerConfig) AllowedTokenPublicKeys() map[string]string {
 	return c.allowedTokenPublicKeys
 }
 
+// Validate checks the configuration. All problems are returned together as a
+// *ValidationError.
 func (c *APIServerConfig) Validate() error {
+	var v validator
+
 	fields := []struct {
 		Var  time.Duration
 		Name string
 	}{
 		{c.APIKeyCacheDuration, "API_KEY_CACHE_DURATION"},
+		{c.NegativeResultTokenDuration, "NEGATIVE_RESULT_TOKEN_DURATION"},
 	}
 
 	for _, f := range fields {
-		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
-			return err
-		}
+		v.positiveDuration(f.Var, f.Name)
 	}
 
-	if err := c.TokenSigning.Validate(); err != nil {
-		return fmt.Errorf("failed to validate signing token configuration: %w", err)
+	if c.VerificationTokenDuration <= 0 || c.VerificationTokenDuration > database.MaxTokenDuration {
+		v.addf("VERIFICATION_TOKEN_DURATION", "(%s) must be greater than zero and no more than %s",
+			c.VerificationTokenDuration, database.MaxTokenDuration)
 	}
 
-	return nil
+	v.merge(c.TokenSigning.Validate())
+
+	v.merge(c.BodyLimits.Validate())
+	v.merge(c.Compression.Validate())
+	v.merge(c.Proxy.Validate())
+
+	return v.err()
 }
 
 func (c *APIServerConfig) ObservabilityExporterConfig() *observability.Config {
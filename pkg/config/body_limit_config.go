@@ -0,0 +1,42 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// BodyLimitConfig represents the maximum request body sizes accepted by a
+// server. Requests with larger bodies are rejected with a 413.
+type BodyLimitConfig struct {
+	// MaxBodyBytes is the limit for all routes.
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES, default=65536"`
+
+	// MaxBatchBodyBytes is the limit for batch issue and import routes, which
+	// accept many records in one request. CSV files are parsed in the browser
+	// and uploaded to these routes in JSON batches.
+	MaxBatchBodyBytes int64 `env:"MAX_BATCH_BODY_BYTES, default=1048576"`
+}
+
+// Validate checks the body limits.
+func (c *BodyLimitConfig) Validate() error {
+	var v validator
+
+	if c.MaxBodyBytes <= 0 {
+		v.addf("MAX_BODY_BYTES", "must be positive, got %d", c.MaxBodyBytes)
+	}
+	if c.MaxBatchBodyBytes < c.MaxBodyBytes {
+		v.addf("MAX_BATCH_BODY_BYTES", "(%d) must be at least MAX_BODY_BYTES (%d)",
+			c.MaxBatchBodyBytes, c.MaxBodyBytes)
+	}
+
+	return v.err()
+}
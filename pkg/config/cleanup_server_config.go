@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/blobstore"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 
 	"github.com/google/exposure-notifications-server/pkg/observability"
@@ -43,8 +44,13 @@ type CleanupConfig struct {
 	AuditEntryMaxAge    time.Duration `env:"AUDIT_ENTRY_MAX_AGE, default=720h"`
 	AuthorizedAppMaxAge time.Duration `env:"AUTHORIZED_APP_MAX_AGE, default=336h"`
 	CleanupPeriod       time.Duration `env:"CLEANUP_PERIOD, default=15m"`
-	MobileAppMaxAge     time.Duration `env:"MOBILE_APP_MAX_AGE, default=168h"`
-	UserPurgeMaxAge     time.Duration `env:"USER_PURGE_MAX_AGE, default=720h"`
+	// IssuanceFailureMaxAge is how long failed issuance attempts are kept for
+	// security analysis.
+	IssuanceFailureMaxAge time.Duration `env:"ISSUANCE_FAILURE_MAX_AGE, default=720h"`
+	LoginLockoutMaxAge    time.Duration `env:"LOGIN_LOCKOUT_MAX_AGE, default=168h"`
+	MobileAppMaxAge       time.Duration `env:"MOBILE_APP_MAX_AGE, default=168h"`
+	UserPurgeMaxAge       time.Duration `env:"USER_PURGE_MAX_AGE, default=720h"`
+	UserSessionMaxAge     time.Duration `env:"USER_SESSION_MAX_AGE, default=24h"`
 	// VerificationCodeMaxAge is the period in which the full code should be available.
 	// After this time it will be recycled. The code will be zeroed out, but its status persist.
 	VerificationCodeMaxAge time.Duration `env:"VERIFICATION_CODE_MAX_AGE, default=48h"`
@@ -52,6 +58,21 @@ type CleanupConfig struct {
 	// and the entry will be purged. This value should be greater than VerificationCodeMaxAge
 	VerificationCodeStatusMaxAge time.Duration `env:"VERIFICATION_CODE_STATUS_MAX_AGE, default=336h"`
 	VerificationTokenMaxAge      time.Duration `env:"VERIFICATION_TOKEN_MAX_AGE, default=24h"`
+
+	// Scheduled exports config. Exports delivered by email are written to
+	// ExportBucket and the email links to them expire after ExportLinkDuration.
+	// ExportBatchSize is the maximum number of exports run per request.
+	Blobstore          blobstore.Config
+	ExportBucket       string        `env:"EXPORT_BUCKET"`
+	ExportLinkDuration time.Duration `env:"EXPORT_LINK_DURATION, default=72h"`
+	ExportBatchSize    uint64        `env:"EXPORT_BATCH_SIZE, default=25"`
+
+	// APIKeyInactiveDisableAfter is how long an API key may go unused before it
+	// is disabled, and realm admins are warned APIKeyInactiveWarnBefore earlier.
+	// Disabled keys can be re-enabled until they are purged after
+	// AuthorizedAppMaxAge. If 0, inactive keys are never disabled.
+	APIKeyInactiveDisableAfter time.Duration `env:"API_KEY_INACTIVE_DISABLE_AFTER, default=0"`
+	APIKeyInactiveWarnBefore   time.Duration `env:"API_KEY_INACTIVE_WARN_BEFORE, default=168h"`
 }
 
 // NewCleanupConfig returns the environment config for the cleanup server.
@@ -75,6 +96,8 @@ func (c *CleanupConfig) Validate() error {
 		{c.VerificationCodeStatusMaxAge, "VERIFICATION_CODE_STATUS_MAX_AGE"},
 		{c.VerificationTokenMaxAge, "VERIFICATION_TOKEN_MAX_AGE"},
 		{c.AuditEntryMaxAge, "AUDIT_ENTRY_MAX_AGE"},
+		{c.IssuanceFailureMaxAge, "ISSUANCE_FAILURE_MAX_AGE"},
+		{c.ExportLinkDuration, "EXPORT_LINK_DURATION"},
 	}
 
 	for _, f := range fields {
@@ -88,6 +111,22 @@ func (c *CleanupConfig) Validate() error {
 		return fmt.Errorf("AUDIT_ENTRY_MAX_AGE must be at least 7 days")
 	}
 
+	// Cloud Storage does not accept signed URLs which last longer than 7 days.
+	if c.ExportLinkDuration > 7*24*time.Hour {
+		return fmt.Errorf("EXPORT_LINK_DURATION cannot be more than 7 days")
+	}
+
+	if c.ExportBatchSize == 0 {
+		return fmt.Errorf("EXPORT_BATCH_SIZE must be positive")
+	}
+
+	if c.APIKeyInactiveDisableAfter < 0 || c.APIKeyInactiveWarnBefore < 0 {
+		return fmt.Errorf("API_KEY_INACTIVE_DISABLE_AFTER and API_KEY_INACTIVE_WARN_BEFORE cannot be negative")
+	}
+	if c.APIKeyInactiveDisableAfter > 0 && c.APIKeyInactiveWarnBefore >= c.APIKeyInactiveDisableAfter {
+		return fmt.Errorf("API_KEY_INACTIVE_WARN_BEFORE must be less than API_KEY_INACTIVE_DISABLE_AFTER")
+	}
+
 	if c.VerificationCodeStatusMaxAge < c.VerificationCodeMaxAge {
 		return fmt.Errorf("the code status %q is expected to live longer than the life of the code %q",
 			c.VerificationCodeStatusMaxAge.String(), c.VerificationCodeMaxAge.String())
@@ -0,0 +1,38 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// CompressionConfig represents the response compression settings of a server.
+// Responses are compressed with gzip or deflate when the client accepts it.
+type CompressionConfig struct {
+	// Enabled turns on response compression.
+	Enabled bool `env:"RESPONSE_COMPRESSION_ENABLED, default=true"`
+
+	// MinBytes is the smallest response body which is compressed. Smaller
+	// responses are sent as-is, since compressing them saves little and costs
+	// CPU on both ends.
+	MinBytes int `env:"RESPONSE_COMPRESSION_MIN_BYTES, default=1024"`
+}
+
+// Validate checks the compression settings.
+func (c *CompressionConfig) Validate() error {
+	var v validator
+
+	if c.MinBytes < 0 {
+		v.addf("RESPONSE_COMPRESSION_MIN_BYTES", "must be non-negative, got %d", c.MinBytes)
+	}
+
+	return v.err()
+}
@@ -24,9 +24,13 @@ import (
 // code issue API.
 type IssueAPIConfig interface {
 	GetCollisionRetryCount() uint
+	GetIssueLimits() *IssueLimitConfig
 	GetAllowedSymptomAge() time.Duration
 	GetEnforceRealmQuotas() bool
 	GetRateLimitConfig() *ratelimit.Config
 	GetENXRedirectDomain() string
+	GetClaimLinkURL() string
+	GetClaimLinkDuration() time.Duration
+	GetTrustedProxies() int
 	IsMaintenanceMode() bool
 }
@@ -0,0 +1,52 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// IssueLimitConfig bounds the size of the optional fields that issuers attach
+// to codes. Realms may set lower limits, but not higher ones.
+type IssueLimitConfig struct {
+	// MaxMetadataKeys is the maximum number of keys in a code's metadata.
+	MaxMetadataKeys uint `env:"MAX_METADATA_KEYS, default=10"`
+
+	// MaxMetadataBytes is the maximum size of a code's JSON encoded metadata.
+	MaxMetadataBytes uint `env:"MAX_METADATA_BYTES, default=1024"`
+
+	// MaxExternalIDLength is the maximum length of an external issuer ID.
+	MaxExternalIDLength uint `env:"MAX_EXTERNAL_ID_LENGTH, default=255"`
+}
+
+// Validate checks the issue limits.
+func (c *IssueLimitConfig) Validate() error {
+	var v validator
+
+	if c.MaxMetadataKeys == 0 || c.MaxMetadataKeys > database.MaxCodeMetadataKeys {
+		v.addf("MAX_METADATA_KEYS", "must be between 1 and %d, got %d",
+			database.MaxCodeMetadataKeys, c.MaxMetadataKeys)
+	}
+	if c.MaxMetadataBytes == 0 || c.MaxMetadataBytes > database.MaxCodeMetadataSize {
+		v.addf("MAX_METADATA_BYTES", "must be between 1 and %d, got %d",
+			database.MaxCodeMetadataSize, c.MaxMetadataBytes)
+	}
+	if c.MaxExternalIDLength == 0 || c.MaxExternalIDLength > database.MaxIssuingExternalIDLength {
+		v.addf("MAX_EXTERNAL_ID_LENGTH", "must be between 1 and %d, got %d",
+			database.MaxIssuingExternalIDLength, c.MaxExternalIDLength)
+	}
+
+	return v.err()
+}
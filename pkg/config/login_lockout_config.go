@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// LoginLockoutConfig controls throttling of failed admin logins.
+type LoginLockoutConfig struct {
+	// Threshold is the number of consecutive failed logins from an address
+	// before it is locked out. The first lockout lasts BaseDuration, and each
+	// further failure doubles it up to MaxDuration. Set to 0 to disable lockouts.
+	Threshold    uint          `env:"LOGIN_LOCKOUT_THRESHOLD, default=5"`
+	BaseDuration time.Duration `env:"LOGIN_LOCKOUT_BASE_DURATION, default=1m"`
+	MaxDuration  time.Duration `env:"LOGIN_LOCKOUT_MAX_DURATION, default=1h"`
+
+	// ResetAfter is how long after the last failure the count starts over.
+	ResetAfter time.Duration `env:"LOGIN_LOCKOUT_RESET_AFTER, default=24h"`
+
+	// AlertThreshold is the number of consecutive failures after which system
+	// admins are emailed, if a system email config exists. Set to 0 to disable
+	// alerts.
+	AlertThreshold uint `env:"LOGIN_LOCKOUT_ALERT_THRESHOLD, default=20"`
+}
+
+// Enabled returns true if failed logins can lock out an email.
+func (c *LoginLockoutConfig) Enabled() bool {
+	return c.Threshold > 0
+}
+
+// Policy returns the lockout policy for the database.
+func (c *LoginLockoutConfig) Policy() *database.LoginLockoutPolicy {
+	return &database.LoginLockoutPolicy{
+		Threshold:      c.Threshold,
+		BaseDuration:   c.BaseDuration,
+		MaxDuration:    c.MaxDuration,
+		ResetAfter:     c.ResetAfter,
+		AlertThreshold: c.AlertThreshold,
+	}
+}
+
+// Validate checks the lockout settings.
+func (c *LoginLockoutConfig) Validate() error {
+	var v validator
+
+	if !c.Enabled() {
+		return nil
+	}
+
+	if c.BaseDuration <= 0 {
+		v.addf("LOGIN_LOCKOUT_BASE_DURATION", "must be greater than zero when LOGIN_LOCKOUT_THRESHOLD is set")
+	}
+	v.positiveDuration(c.ResetAfter, "LOGIN_LOCKOUT_RESET_AFTER")
+
+	if c.MaxDuration < c.BaseDuration {
+		v.addf("LOGIN_LOCKOUT_MAX_DURATION", "(%s) must be at least LOGIN_LOCKOUT_BASE_DURATION (%s)",
+			c.MaxDuration, c.BaseDuration)
+	}
+
+	return v.err()
+}
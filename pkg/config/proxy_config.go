@@ -0,0 +1,38 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// ProxyConfig describes the proxies, like load balancers, which sit in front of
+// a server. It determines which x-forwarded-for entry is the client IP for rate
+// limiting, firewalls, and session tracking.
+type ProxyConfig struct {
+	// TrustedProxies is the number of x-forwarded-for entries which are
+	// appended by the proxies in front of the server. The Google Cloud HTTP(S)
+	// load balancer appends both the client IP and its own IP, so the default
+	// is 2. Set it to 0 when requests reach the server directly, which ignores
+	// x-forwarded-for.
+	TrustedProxies int `env:"TRUSTED_PROXIES, default=2"`
+}
+
+// Validate checks the proxy settings.
+func (c *ProxyConfig) Validate() error {
+	var v validator
+
+	if c.TrustedProxies < 0 {
+		v.addf("TRUSTED_PROXIES", "must be non-negative, got %d", c.TrustedProxies)
+	}
+
+	return v.err()
+}
@@ -66,6 +66,24 @@ func NewRedirectConfig(ctx context.Context) (*RedirectConfig, error) {
 	return &config, nil
 }
 
+// Validate checks the configuration. All problems are returned together as a
+// *ValidationError.
+func (c *RedirectConfig) Validate() error {
+	var v validator
+
+	v.positiveDuration(c.AppCacheTTL, "APP_CACHE_TTL")
+
+	for hostname, region := range c.HostnameConfig {
+		if hostname == "" {
+			v.addf("HOSTNAME_TO_REGION", "hostname empty for region value: %v", region)
+			continue
+		}
+		v.regionCode(region, fmt.Sprintf("HOSTNAME_TO_REGION[%s]", hostname))
+	}
+
+	return v.err()
+}
+
 func (c *RedirectConfig) ObservabilityExporterConfig() *observability.Config {
 	return &c.Observability
 }
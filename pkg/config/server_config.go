@@ -16,10 +16,13 @@ package config
 
 import (
 	"context"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/blobstore"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/captcha"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 
@@ -31,6 +34,10 @@ import (
 
 var _ IssueAPIConfig = (*ServerConfig)(nil)
 
+// minSCIMTokenLength is the shortest SCIM token accepted. The token is the only
+// credential for provisioning users, so it must not be guessable.
+const minSCIMTokenLength = 32
+
 // PasswordRequirementsConfig represents the password complexity requirements for the server.
 type PasswordRequirementsConfig struct {
 	Length    int `env:"MIN_PWD_LENGTH,default=8"`
@@ -38,6 +45,12 @@ type PasswordRequirementsConfig struct {
 	Lowercase int `env:"MIN_PWD_LOWER,default=1"`
 	Number    int `env:"MIN_PWD_DIGITS,default=1"`
 	Special   int `env:"MIN_PWD_SPECIAL,default=1"`
+
+	// RotationPeriodDays and RotationWarningDays are the password rotation
+	// policy for realms which do not require rotation themselves. Users who sign
+	// in with single sign-on are exempt. 0 disables rotation.
+	RotationPeriodDays  uint `env:"PASSWORD_ROTATION_PERIOD_DAYS, default=0"`
+	RotationWarningDays uint `env:"PASSWORD_ROTATION_WARNING_DAYS, default=0"`
 }
 
 // HasRequirements is true if any requirements are set.
@@ -54,14 +67,47 @@ type ServerConfig struct {
 
 	Port string `env:"PORT,default=8080"`
 
+	// MetricsPort, if set, serves metrics in the Prometheus format at /metrics
+	// on this port.
+	MetricsPort string `env:"METRICS_PORT"`
+
 	// Login Config
 	SessionDuration    time.Duration `env:"SESSION_DURATION, default=20h"`
 	SessionIdleTimeout time.Duration `env:"SESSION_IDLE_TIMEOUT, default=20m"`
 	RevokeCheckPeriod  time.Duration `env:"REVOKE_CHECK_DURATION, default=5m"`
 
+	// ImpersonationDuration is the maximum amount of time a system admin may
+	// impersonate another user before the impersonation is ended.
+	ImpersonationDuration time.Duration `env:"IMPERSONATION_DURATION, default=30m"`
+
+	// KioskIdleTimeout is the idle timeout for sessions in kiosk mode. It must
+	// not be longer than SessionIdleTimeout.
+	KioskIdleTimeout time.Duration `env:"KIOSK_IDLE_TIMEOUT, default=3m"`
+
+	// KioskFrameAncestors are the origins which may embed kiosk mode pages in a
+	// frame. All other pages, and kiosk pages when this is empty, cannot be
+	// framed.
+	KioskFrameAncestors []string `env:"KIOSK_FRAME_ANCESTORS"`
+
 	// Password Config
 	PasswordRequirements PasswordRequirementsConfig
 
+	// LoginLockout throttles failed logins from each client IP address.
+	LoginLockout LoginLockoutConfig
+
+	// PasswordLoginDisabled rejects new sessions created with an email and
+	// password, so users must sign in through an identity provider configured
+	// in Firebase. Existing sessions remain valid until they expire or are
+	// revoked. The login page redirects to SSOLoginURL, which is required when
+	// password login is disabled.
+	PasswordLoginDisabled bool   `env:"PASSWORD_LOGIN_DISABLED"`
+	SSOLoginURL           string `env:"SSO_LOGIN_URL"`
+
+	// AllowSystemAdminPasswordLogin keeps email and password login available to
+	// system admins when PasswordLoginDisabled is set, as an emergency path if
+	// the identity provider is unavailable.
+	AllowSystemAdminPasswordLogin bool `env:"ALLOW_SYSTEM_ADMIN_PASSWORD_LOGIN"`
+
 	// CookieKeys is a slice of bytes. The first is 64 bytes, the second is 32.
 	// They should be base64-encoded.
 	CookieKeys Base64ByteSlice `env:"COOKIE_KEYS,required"`
@@ -79,6 +125,11 @@ type ServerConfig struct {
 	AllowedSymptomAge   time.Duration `env:"ALLOWED_PAST_SYMPTOM_DAYS,default=672h"` // 672h is 28 days.
 	EnforceRealmQuotas  bool          `env:"ENFORCE_REALM_QUOTAS, default=true"`
 
+	// RequireFIPSRandomness asserts that the entropy source used for code
+	// generation is FIPS compliant. If the host is not in FIPS mode, the server
+	// will refuse to start.
+	RequireFIPSRandomness bool `env:"REQUIRE_FIPS_RANDOMNESS"`
+
 	AssetsPath  string `env:"ASSETS_PATH, default=./cmd/server/assets"`
 	LocalesPath string `env:"LOCALES_PATH, default=./internal/i18n/locales"`
 
@@ -87,6 +138,43 @@ type ServerConfig struct {
 	// This repository contains a redirect service that can be used for this purpose.
 	ENExpressRedirectDomain string `env:"ENX_REDIRECT_DOMAIN"`
 
+	// ClaimLinkURL is the web page which claims codes from signed claim links.
+	// If set, and claim links are enabled with DB_CLAIM_LINK_KEY, issued codes
+	// include a claimLink to this URL with the token in the "token" query
+	// parameter. Links are valid for ClaimLinkDuration, but never longer than
+	// the long code.
+	ClaimLinkURL      string        `env:"CLAIM_LINK_URL"`
+	ClaimLinkDuration time.Duration `env:"CLAIM_LINK_DURATION, default=1h"`
+
+	// SCIMToken is the bearer token identity providers use to provision users
+	// through /scim/v2. It grants system admin level access to user lifecycle,
+	// so it should be stored in a secret manager. If blank, the SCIM endpoints
+	// are disabled.
+	SCIMToken string `env:"SCIM_TOKEN"`
+
+	// EnableRealmRequests allows signed-in users to request a new realm. The
+	// realm is created pending approval by a system admin, and the requester
+	// becomes its first admin when it is approved.
+	EnableRealmRequests bool `env:"ENABLE_REALM_REQUESTS"`
+
+	// NoRealmsContact is shown to users who are not a member of any realm, such
+	// as a support email address or URL, so they know who can grant them
+	// access. If blank, they are told to contact their realm administrator.
+	NoRealmsContact string `env:"NO_REALMS_CONTACT"`
+
+	// EnableScheduledExports allows realm admins to schedule recurring exports
+	// of their realm stats. The exports are run by the cleanup service, which
+	// must have blob storage configured.
+	EnableScheduledExports bool `env:"ENABLE_SCHEDULED_EXPORTS"`
+
+	// Blobstore and AssetBucket configure where uploaded realm assets, such as
+	// logos, are stored. If AssetBucket is blank, uploads are disabled. Uploaded
+	// assets must be publicly readable at AssetBaseURL, which defaults to the
+	// Cloud Storage URL of the bucket.
+	Blobstore    blobstore.Config
+	AssetBucket  string `env:"ASSET_BUCKET"`
+	AssetBaseURL string `env:"ASSET_BASE_URL"`
+
 	// Certificate signing key settings, needed for public key / settings display.
 	CertificateSigning CertificateSigningConfig
 
@@ -99,6 +187,24 @@ type ServerConfig struct {
 
 	// Rate limiting configuration
 	RateLimit ratelimit.Config
+
+	// Request body size limits
+	BodyLimits BodyLimitConfig
+
+	// Response compression
+	Compression CompressionConfig
+
+	// Proxies in front of the server
+	Proxy ProxyConfig
+
+	// Request tracing
+	Tracing TracingConfig
+
+	// CAPTCHA verification for unauthenticated endpoints
+	Captcha captcha.Config
+
+	// Limits on the optional fields of issued codes
+	IssueLimits IssueLimitConfig
 }
 
 // NewServerConfig initializes and validates a ServerConfig struct.
@@ -112,31 +218,140 @@ func NewServerConfig(ctx context.Context) (*ServerConfig, error) {
 	return &config, nil
 }
 
+// Validate checks the configuration, including constraints across fields. All
+// problems are returned together as a *ValidationError.
+// AssetURL returns the public URL of the uploaded asset object.
+func (c *ServerConfig) AssetURL(object string) string {
+	base := c.AssetBaseURL
+	if base == "" {
+		base = "https://storage.googleapis.com/" + c.AssetBucket
+	}
+	return strings.TrimRight(base, "/") + "/" + object
+}
+
 func (c *ServerConfig) Validate() error {
+	var v validator
+
 	fields := []struct {
 		Var  time.Duration
 		Name string
 	}{
 		{c.SessionDuration, "SESSION_DURATION"},
+		{c.SessionIdleTimeout, "SESSION_IDLE_TIMEOUT"},
 		{c.RevokeCheckPeriod, "REVOKE_CHECK_DURATION"},
+		{c.ImpersonationDuration, "IMPERSONATION_DURATION"},
+		{c.KioskIdleTimeout, "KIOSK_IDLE_TIMEOUT"},
 		{c.AllowedSymptomAge, "ALLOWED_PAST_SYMPTOM_DAYS"},
 	}
 
 	for _, f := range fields {
-		if err := checkPositiveDuration(f.Var, f.Name); err != nil {
-			return err
+		v.positiveDuration(f.Var, f.Name)
+	}
+
+	if c.SessionIdleTimeout > c.SessionDuration {
+		v.addf("SESSION_IDLE_TIMEOUT", "(%s) must not be longer than SESSION_DURATION (%s)",
+			c.SessionIdleTimeout, c.SessionDuration)
+	}
+	if c.ImpersonationDuration > c.SessionDuration {
+		v.addf("IMPERSONATION_DURATION", "(%s) must not be longer than SESSION_DURATION (%s)",
+			c.ImpersonationDuration, c.SessionDuration)
+	}
+	if c.KioskIdleTimeout > c.SessionIdleTimeout {
+		v.addf("KIOSK_IDLE_TIMEOUT", "(%s) must not be longer than SESSION_IDLE_TIMEOUT (%s)",
+			c.KioskIdleTimeout, c.SessionIdleTimeout)
+	}
+	if c.PasswordRequirements.RotationWarningDays > c.PasswordRequirements.RotationPeriodDays {
+		v.addf("PASSWORD_ROTATION_WARNING_DAYS", "(%d) must not be longer than PASSWORD_ROTATION_PERIOD_DAYS (%d)",
+			c.PasswordRequirements.RotationWarningDays, c.PasswordRequirements.RotationPeriodDays)
+	}
+	validateFrameAncestors(&v, c.KioskFrameAncestors, c.DevMode)
+
+	// Cookie keys are hash and block key pairs for gorilla/securecookie.
+	if len(c.CookieKeys) == 0 {
+		v.addf("COOKIE_KEYS", "must have at least one entry")
+	}
+	for i, k := range c.CookieKeys {
+		if i%2 == 0 {
+			if len(k) < 32 {
+				v.addf("COOKIE_KEYS", "hash key at index %d must be at least 32 bytes, got %d", i, len(k))
+			}
+			continue
+		}
+		if l := len(k); l != 16 && l != 24 && l != 32 {
+			v.addf("COOKIE_KEYS", "block key at index %d must be 16, 24, or 32 bytes, got %d", i, l)
+		}
+	}
+
+	if l := len(c.CSRFAuthKey); l != 32 {
+		v.addf("CSRF_AUTH_KEY", "must be 32 bytes, got %d", l)
+	}
+
+	// Outside of dev mode, session and CSRF cookies are only sent over HTTPS.
+	if !c.DevMode {
+		switch strings.ToLower(c.CookieDomain) {
+		case "localhost", "127.0.0.1":
+			v.addf("COOKIE_DOMAIN", "cookies for %q require HTTPS unless DEV_MODE is enabled", c.CookieDomain)
+		}
+	}
+
+	v.required(c.Firebase.APIKey, "FIREBASE_API_KEY")
+	v.required(c.Firebase.AuthDomain, "FIREBASE_AUTH_DOMAIN")
+	v.required(c.Firebase.DatabaseURL, "FIREBASE_DATABASE_URL")
+	v.required(c.Firebase.ProjectID, "FIREBASE_PROJECT_ID")
+	v.required(c.Firebase.StorageBucket, "FIREBASE_STORAGE_BUCKET")
+	v.required(c.Firebase.MessageSenderID, "FIREBASE_MESSAGE_SENDER_ID")
+	v.required(c.Firebase.AppID, "FIREBASE_APP_ID")
+	v.required(c.Firebase.MeasurementID, "FIREBASE_MEASUREMENT_ID")
+
+	if c.PasswordLoginDisabled {
+		v.required(c.SSOLoginURL, "SSO_LOGIN_URL")
+	}
+
+	if c.AssetBaseURL != "" {
+		if u, err := url.Parse(c.AssetBaseURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			v.addf("ASSET_BASE_URL", "must be an http or https URL")
 		}
 	}
 
+	if c.SCIMToken != "" && len(c.SCIMToken) < minSCIMTokenLength {
+		v.addf("SCIM_TOKEN", "must be at least %d characters, got %d", minSCIMTokenLength, len(c.SCIMToken))
+	}
+
 	c.ENExpressRedirectDomain = strings.ToLower(c.ENExpressRedirectDomain)
+	validateRedirectDomain(&v, c.ENExpressRedirectDomain)
+
+	v.positiveDuration(c.ClaimLinkDuration, "CLAIM_LINK_DURATION")
+	validateClaimLinkURL(&v, c.ClaimLinkURL, c.DevMode)
 
-	return nil
+	v.merge(c.LoginLockout.Validate())
+	v.merge(c.BodyLimits.Validate())
+	v.merge(c.Compression.Validate())
+	v.merge(c.Proxy.Validate())
+	v.merge(c.IssueLimits.Validate())
+
+	return v.err()
 }
 
 func (c *ServerConfig) GetENXRedirectDomain() string {
 	return c.ENExpressRedirectDomain
 }
 
+func (c *ServerConfig) GetClaimLinkURL() string {
+	return c.ClaimLinkURL
+}
+
+func (c *ServerConfig) GetClaimLinkDuration() time.Duration {
+	return c.ClaimLinkDuration
+}
+
+func (c *ServerConfig) GetTrustedProxies() int {
+	return c.Proxy.TrustedProxies
+}
+
+func (c *ServerConfig) GetIssueLimits() *IssueLimitConfig {
+	return &c.IssueLimits
+}
+
 func (c *ServerConfig) GetCollisionRetryCount() uint {
 	return c.CollisionRetryCount
 }
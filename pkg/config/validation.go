@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// regionCodeRe matches the region codes accepted by realms: letters, numbers,
+// and dashes, at most 10 characters (e.g. "US-WA").
+var regionCodeRe = regexp.MustCompile(`^[A-Za-z0-9-]{1,10}$`)
+
+// ValidationError is a report of every problem found while validating a
+// configuration. Validation collects all problems instead of stopping at the
+// first one so they can be fixed in a single deployment.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements error. Each problem is printed on its own line.
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  * %s", p)
+	}
+	return b.String()
+}
+
+// validator accumulates configuration problems.
+type validator struct {
+	problems []string
+}
+
+// addf records a problem with the named environment variable.
+func (v *validator) addf(name, format string, args ...interface{}) {
+	v.problems = append(v.problems, name+": "+fmt.Sprintf(format, args...))
+}
+
+// merge records the problems from a nested validation error.
+func (v *validator) merge(err error) {
+	if err == nil {
+		return
+	}
+
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		v.problems = append(v.problems, verr.Problems...)
+		return
+	}
+	v.problems = append(v.problems, err.Error())
+}
+
+// positiveDuration records a problem if the duration is negative.
+func (v *validator) positiveDuration(d time.Duration, name string) {
+	if err := checkPositiveDuration(d, name); err != nil {
+		v.problems = append(v.problems, err.Error())
+	}
+}
+
+// required records a problem if the value is blank.
+func (v *validator) required(s, name string) {
+	if strings.TrimSpace(s) == "" {
+		v.addf(name, "is required, but is blank")
+	}
+}
+
+// regionCode records a problem if the value is not a valid region code.
+func (v *validator) regionCode(s, name string) {
+	if !regionCodeRe.MatchString(s) {
+		v.addf(name, "%q is not a valid region code, must be 1-10 letters, numbers, or dashes", s)
+	}
+}
+
+// err returns the ValidationError, or nil if there are no problems.
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// validateRedirectDomain records a problem if the EN Express redirect domain is
+// not a bare hostname.
+func validateRedirectDomain(v *validator, domain string) {
+	if domain == "" {
+		return
+	}
+	if strings.Contains(domain, "://") || strings.ContainsAny(domain, "/?#") {
+		v.addf("ENX_REDIRECT_DOMAIN", "%q must be a hostname without a scheme or path", domain)
+	}
+}
+
+// validateClaimLinkURL records a problem if the claim link URL is not an
+// absolute https URL. Plain http is allowed in dev mode.
+func validateClaimLinkURL(v *validator, raw string, devMode bool) {
+	if raw == "" {
+		return
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		v.addf("CLAIM_LINK_URL", "%q must be an absolute URL", raw)
+		return
+	}
+	if u.Scheme != "https" && !(devMode && u.Scheme == "http") {
+		v.addf("CLAIM_LINK_URL", "%q must use https", raw)
+	}
+}
+
+// validateFrameAncestors checks that each frame ancestor is an https origin.
+// Wildcards are not allowed since they would let any site frame the page.
+func validateFrameAncestors(v *validator, origins []string, devMode bool) {
+	for _, raw := range origins {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || strings.Contains(u.Host, "*") ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			v.addf("KIOSK_FRAME_ANCESTORS", "%q must be an origin", raw)
+			continue
+		}
+		if u.Scheme != "https" && !(devMode && u.Scheme == "http") {
+			v.addf("KIOSK_FRAME_ANCESTORS", "%q must use https", raw)
+		}
+	}
+}
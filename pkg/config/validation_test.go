@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+func validServerConfig() *ServerConfig {
+	return &ServerConfig{
+		Firebase: FirebaseConfig{
+			APIKey:          "key",
+			AuthDomain:      "example.firebaseapp.com",
+			DatabaseURL:     "example.firebaseio.com",
+			ProjectID:       "example",
+			StorageBucket:   "example.appspot.com",
+			MessageSenderID: "123",
+			AppID:           "1:123:web:abc",
+			MeasurementID:   "G-ABC",
+		},
+		SessionDuration:       20 * time.Hour,
+		SessionIdleTimeout:    20 * time.Minute,
+		RevokeCheckPeriod:     5 * time.Minute,
+		ImpersonationDuration: 30 * time.Minute,
+		KioskIdleTimeout:      3 * time.Minute,
+		AllowedSymptomAge:     672 * time.Hour,
+		CookieKeys: Base64ByteSlice{
+			envconfig.Base64Bytes(make([]byte, 64)),
+			envconfig.Base64Bytes(make([]byte, 32)),
+		},
+		CSRFAuthKey: envconfig.Base64Bytes(make([]byte, 32)),
+		BodyLimits: BodyLimitConfig{
+			MaxBodyBytes:      64 * 1024,
+			MaxBatchBodyBytes: 1024 * 1024,
+		},
+		IssueLimits: IssueLimitConfig{
+			MaxMetadataKeys:     10,
+			MaxMetadataBytes:    1024,
+			MaxExternalIDLength: 255,
+		},
+	}
+}
+
+func TestServerConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		mutate   func(c *ServerConfig)
+		problems []string
+	}{
+		{
+			name:   "valid",
+			mutate: func(c *ServerConfig) {},
+		},
+		{
+			name: "reports_all_problems",
+			mutate: func(c *ServerConfig) {
+				c.SessionIdleTimeout = 21 * time.Hour
+				c.RevokeCheckPeriod = -1 * time.Minute
+				c.CookieKeys = Base64ByteSlice{envconfig.Base64Bytes(make([]byte, 8)), envconfig.Base64Bytes(make([]byte, 8))}
+				c.CSRFAuthKey = envconfig.Base64Bytes(make([]byte, 16))
+				c.CookieDomain = "localhost"
+				c.Firebase.APIKey = " "
+				c.ENExpressRedirectDomain = "https://enx.example.com"
+				c.SCIMToken = "hunter2"
+				c.BodyLimits.MaxBatchBodyBytes = 1024
+				c.IssueLimits.MaxExternalIDLength = 0
+			},
+			problems: []string{
+				"REVOKE_CHECK_DURATION must be a positive duration",
+				"SESSION_IDLE_TIMEOUT: (21h0m0s) must not be longer than SESSION_DURATION",
+				"COOKIE_KEYS: hash key at index 0",
+				"COOKIE_KEYS: block key at index 1",
+				"CSRF_AUTH_KEY: must be 32 bytes",
+				"COOKIE_DOMAIN: cookies for \"localhost\" require HTTPS",
+				"FIREBASE_API_KEY: is required",
+				"ENX_REDIRECT_DOMAIN: \"https://enx.example.com\" must be a hostname",
+				"SCIM_TOKEN: must be at least 32 characters",
+				"MAX_BATCH_BODY_BYTES: (1024) must be at least MAX_BODY_BYTES",
+				"MAX_EXTERNAL_ID_LENGTH: must be between 1 and 255",
+			},
+		},
+		{
+			name: "password_login_disabled_without_sso",
+			mutate: func(c *ServerConfig) {
+				c.PasswordLoginDisabled = true
+			},
+			problems: []string{
+				"SSO_LOGIN_URL: is required",
+			},
+		},
+		{
+			name: "kiosk",
+			mutate: func(c *ServerConfig) {
+				c.KioskIdleTimeout = time.Hour
+				c.KioskFrameAncestors = []string{"https://portal.example.com", "http://insecure.example.com", "https://*.example.com", "https://example.com/kiosk"}
+			},
+			problems: []string{
+				"KIOSK_IDLE_TIMEOUT: (1h0m0s) must not be longer than SESSION_IDLE_TIMEOUT",
+				"KIOSK_FRAME_ANCESTORS: \"http://insecure.example.com\" must use https",
+				"KIOSK_FRAME_ANCESTORS: \"https://*.example.com\" must be an origin",
+				"KIOSK_FRAME_ANCESTORS: \"https://example.com/kiosk\" must be an origin",
+			},
+		},
+		{
+			name: "password_rotation",
+			mutate: func(c *ServerConfig) {
+				c.PasswordRequirements.RotationPeriodDays = 30
+				c.PasswordRequirements.RotationWarningDays = 45
+			},
+			problems: []string{
+				"PASSWORD_ROTATION_WARNING_DAYS: (45) must not be longer than PASSWORD_ROTATION_PERIOD_DAYS (30)",
+			},
+		},
+		{
+			name: "claim_link_url",
+			mutate: func(c *ServerConfig) {
+				c.ClaimLinkURL = "http://claim.example.com/verify"
+			},
+			problems: []string{
+				"CLAIM_LINK_URL: \"http://claim.example.com/verify\" must use https",
+			},
+		},
+		{
+			name: "claim_link_url_relative",
+			mutate: func(c *ServerConfig) {
+				c.ClaimLinkURL = "/verify"
+			},
+			problems: []string{
+				"CLAIM_LINK_URL: \"/verify\" must be an absolute URL",
+			},
+		},
+		{
+			name: "login_lockout",
+			mutate: func(c *ServerConfig) {
+				c.LoginLockout = LoginLockoutConfig{
+					Threshold:   5,
+					MaxDuration: time.Hour,
+				}
+			},
+			problems: []string{
+				"LOGIN_LOCKOUT_BASE_DURATION: must be greater than zero",
+			},
+		},
+		{
+			name: "asset_base_url",
+			mutate: func(c *ServerConfig) {
+				c.AssetBaseURL = "storage.example.com/assets"
+			},
+			problems: []string{
+				"ASSET_BASE_URL: must be an http or https URL",
+			},
+		},
+		{
+			name: "dev_mode_localhost",
+			mutate: func(c *ServerConfig) {
+				c.DevMode = true
+				c.CookieDomain = "localhost"
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := validServerConfig()
+			tc.mutate(c)
+
+			err := c.Validate()
+			if len(tc.problems) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *ValidationError, got %T: %v", err, err)
+			}
+			if got, want := len(verr.Problems), len(tc.problems); got != want {
+				t.Errorf("expected %d problems, got %d: %v", want, got, verr)
+			}
+			for _, want := range tc.problems {
+				if !strings.Contains(verr.Error(), want) {
+					t.Errorf("expected %q to contain %q", verr.Error(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	c := &RedirectConfig{
+		HostnameConfig: map[string]string{
+			"good.example.com": "US-WA",
+			"bad.example.com":  "not a region!",
+			"":                 "US-AA",
+		},
+	}
+
+	var verr *ValidationError
+	if err := c.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if got, want := len(verr.Problems), 2; got != want {
+		t.Errorf("expected %d problems, got %d: %v", want, got, verr)
+	}
+}
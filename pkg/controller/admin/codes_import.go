@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// maxImportCodes is the maximum number of codes in a single import request.
+// The import page sends larger files in batches.
+const maxImportCodes = 100
+
+// HandleCodesImportShow renders the page for importing codes which were issued
+// by another system into the realm.
+func (c *Controller) HandleCodesImportShow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Import codes - %s - System Admin", realm.Name)
+		m["realm"] = realm
+		m["maxImportCodes"] = maxImportCodes
+		c.h.RenderHTML(w, "admin/realms/import-codes", m)
+	})
+}
+
+// HandleCodesImport imports a batch of codes which were issued by another
+// system. Each code is validated and saved on its own, so one bad row does not
+// fail the batch. The response has a result for every row.
+func (c *Controller) HandleCodesImport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		logger := logging.FromContext(ctx).Named("admin.HandleCodesImport")
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		var request api.ImportCodesRequest
+		if err := controller.BindJSON(w, r, &request); err != nil {
+			logger.Errorw("error decoding request", "error", err)
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err).WithCode(api.ErrUnparsableRequest))
+			return
+		}
+
+		if l := len(request.Codes); l > maxImportCodes {
+			c.h.RenderJSON(w, http.StatusBadRequest,
+				api.Errorf("too many codes: %d, at most %d may be imported at once", l, maxImportCodes))
+			return
+		}
+
+		response := &api.ImportCodesResponse{
+			Results: make([]*api.ImportCodeResult, 0, len(request.Codes)),
+		}
+		for i, code := range request.Codes {
+			result := &api.ImportCodeResult{Index: i}
+			response.Results = append(response.Results, result)
+
+			vc, err := c.importCode(ctx, realm, code, currentUser)
+			if err != nil {
+				logger.Warnw("failed to import code", "realm", realm.ID, "index", i, "error", err)
+				result.Error = err.Error()
+				continue
+			}
+			result.UUID = vc.UUID
+			response.Imported++
+		}
+
+		// Unlike a partial failure, which is reported per row, a batch where
+		// nothing could be imported is an error.
+		if response.Imported == 0 && len(request.Codes) > 0 {
+			response.Error = "no codes were imported"
+			c.h.RenderJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		c.h.RenderJSON(w, http.StatusOK, response)
+	})
+}
+
+// importCode converts and saves a single imported code. Errors are safe to
+// show to the system admin.
+func (c *Controller) importCode(ctx context.Context, realm *database.Realm, in *api.ImportCode, actor *database.User) (*database.VerificationCode, error) {
+	if in == nil {
+		return nil, fmt.Errorf("missing code")
+	}
+
+	vc, err := toImportedCode(in)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.db.ImportVerificationCode(ctx, realm, vc, c.config.GetAllowedSymptomAge(), actor); err != nil {
+		if strings.Contains(err.Error(), database.VercodeUUIDUniqueIndex) {
+			return nil, fmt.Errorf("uuid %s is already in use", vc.UUID)
+		}
+		return nil, err
+	}
+	return vc, nil
+}
+
+// toImportedCode parses the dates and timestamps of an imported code.
+func toImportedCode(in *api.ImportCode) (*database.VerificationCode, error) {
+	vc := &database.VerificationCode{
+		Code:              in.Code,
+		LongCode:          in.LongCode,
+		TestType:          strings.ToLower(project.TrimSpace(in.TestType)),
+		UUID:              project.TrimSpaceAndNonPrintable(in.UUID),
+		IssuingExternalID: project.TrimSpace(in.ExternalIssuerID),
+		CohortID:          project.TrimSpace(in.CohortID),
+		Metadata:          in.Metadata,
+	}
+
+	var err error
+	if vc.SymptomDate, err = parseImportDate("symptomDate", in.SymptomDate); err != nil {
+		return nil, err
+	}
+	if vc.TestDate, err = parseImportDate("testDate", in.TestDate); err != nil {
+		return nil, err
+	}
+
+	if vc.ExpiresAt, err = time.Parse(time.RFC3339, project.TrimSpace(in.ExpiresAt)); err != nil {
+		return nil, fmt.Errorf("expiresAt must be an RFC 3339 timestamp")
+	}
+
+	// Codes without a separate long code expiry share the short code expiry.
+	if s := project.TrimSpace(in.LongExpiresAt); s == "" {
+		vc.LongExpiresAt = vc.ExpiresAt
+	} else if vc.LongExpiresAt, err = time.Parse(time.RFC3339, s); err != nil {
+		return nil, fmt.Errorf("longExpiresAt must be an RFC 3339 timestamp")
+	}
+	if vc.LongExpiresAt.Before(vc.ExpiresAt) {
+		return nil, fmt.Errorf("longExpiresAt must not be before expiresAt")
+	}
+	return vc, nil
+}
+
+// parseImportDate parses an optional YYYY-MM-DD date.
+func parseImportDate(name, s string) (*time.Time, error) {
+	s = project.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be YYYY-MM-DD", name)
+	}
+	return &t, nil
+}
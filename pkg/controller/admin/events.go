@@ -16,8 +16,11 @@ package admin
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -45,64 +48,127 @@ func (c *Controller) HandleEventsShow() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
 		// Parse query params
 		pageParams, err := pagination.FromRequest(r)
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
-		from := r.FormValue(QueryFromSearch)
-		to := r.FormValue(QueryToSearch)
-		scopes := []database.Scope{}
-		scopes = append(scopes, database.WithAuditTime(from, to))
-		realmID := project.TrimSpace(r.FormValue(QueryRealmIDSearch))
-
-		includeTest, _ := strconv.ParseBool(r.FormValue(QueryIncludeTest))
-		if !includeTest {
-			scopes = append(scopes, database.WithoutAuditTest())
+
+		realm, scopes, err := c.eventsScopes(r)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
 		}
 
-		// Add realm filter if applicable
-		var realm *database.Realm
-		switch realmID {
-		case "":
-			// All events
-		case "0":
-			realm = &database.Realm{
-				Model: gorm.Model{ID: 0},
-				Name:  "System",
-			}
-		default:
-			realm, err = c.db.FindRealm(realmID)
-			if err != nil {
+		// List the events
+		var events []*database.AuditEntry
+		var paginator *pagination.Paginator
+		q, err := controller.AuditLogQueryFromRequest(r)
+		if err == nil {
+			events, paginator, err = c.db.QueryAuditLog(q, pageParams, scopes...)
+		}
+		if err != nil {
+			if !errors.Is(err, database.ErrInvalidAuditLogQuery) {
 				controller.InternalError(w, r, c.h, err)
 				return
 			}
+			flash.Error("Failed to search events: %v", err)
 		}
 
-		// If a specific realm was provided, filter by that realm.
-		if realm != nil {
-			scopes = append(scopes, database.WithAuditRealmID(realm.ID))
+		c.renderEvents(ctx, w, r, events, paginator, realm)
+	})
+}
+
+// HandleEventsExport exports the events which match the query as CSV, up to
+// database.MaxAuditExportEntries.
+func (c *Controller) HandleEventsExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, scopes, err := c.eventsScopes(r)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
 		}
 
-		// List the events
-		events, paginator, err := c.db.ListAudits(pageParams, scopes...)
+		pageParams := &pagination.PageParams{
+			Page:  0,
+			Limit: database.MaxAuditExportEntries,
+		}
+
+		var events []*database.AuditEntry
+		q, err := controller.AuditLogQueryFromRequest(r)
+		if err == nil {
+			events, _, err = c.db.QueryAuditLog(q, pageParams, scopes...)
+		}
 		if err != nil {
+			if errors.Is(err, database.ErrInvalidAuditLogQuery) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
 
-		c.renderEvents(ctx, w, events, paginator, from, to, realm)
+		filename := fmt.Sprintf("%s-events.csv", time.Now().UTC().Format("20060102150405"))
+		c.h.RenderCSV(w, http.StatusOK, filename, database.AuditEntries(events))
 	})
 }
 
-func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter,
-	events []*database.AuditEntry, paginator *pagination.Paginator, from, to string, realm *database.Realm) {
+// eventsScopes returns the realm to filter events by, if any, and the scopes
+// for the realm and test filters.
+func (c *Controller) eventsScopes(r *http.Request) (*database.Realm, []database.Scope, error) {
+	var scopes []database.Scope
+
+	includeTest, _ := strconv.ParseBool(r.FormValue(QueryIncludeTest))
+	if !includeTest {
+		scopes = append(scopes, database.WithoutAuditTest())
+	}
+
+	// Add realm filter if applicable
+	var realm *database.Realm
+	switch realmID := project.TrimSpace(r.FormValue(QueryRealmIDSearch)); realmID {
+	case "":
+		// All events
+	case "0":
+		realm = &database.Realm{
+			Model: gorm.Model{ID: 0},
+			Name:  "System",
+		}
+	default:
+		var err error
+		realm, err = c.db.FindRealm(realmID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// If a specific realm was provided, filter by that realm.
+	if realm != nil {
+		scopes = append(scopes, database.WithAuditRealmID(realm.ID))
+	}
+
+	return realm, scopes, nil
+}
+
+func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	events []*database.AuditEntry, paginator *pagination.Paginator, realm *database.Realm) {
 	m := controller.TemplateMapFromContext(ctx)
 	m["events"] = events
 	m["paginator"] = paginator
-	m[QueryFromSearch] = from
-	m[QueryToSearch] = to
+	m[QueryFromSearch] = r.FormValue(QueryFromSearch)
+	m[QueryToSearch] = r.FormValue(QueryToSearch)
+	m["queryActorID"] = r.FormValue(controller.QueryAuditActorID)
+	m["queryAction"] = r.FormValue(controller.QueryAuditAction)
+	m["queryTargetID"] = r.FormValue(controller.QueryAuditTargetID)
+	m["exportQuery"] = r.URL.RawQuery
+	m["maxQueryDays"] = int(database.MaxAuditQueryWindow / (24 * time.Hour))
 	m["realm"] = realm
 	c.h.RenderHTML(w, "admin/events/index", m)
 }
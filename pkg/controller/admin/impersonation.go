@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleImpersonateStart begins a time-limited, read-only impersonation of
+// another user by the current system admin.
+func (c *Controller) HandleImpersonateStart() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		user, err := c.db.FindUser(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if user.ID == currentUser.ID {
+			flash.Error("Cannot impersonate yourself!")
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		if user.SystemAdmin {
+			flash.Error("Cannot impersonate another system admin.")
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		now := time.Now().UTC()
+		duration := c.config.ImpersonationDuration
+
+		audit := database.BuildAuditEntry(currentUser,
+			fmt.Sprintf("started impersonating user for %s", duration), user, 0)
+		if err := c.db.SaveAuditEntry(audit); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		controller.StoreSessionImpersonation(session, user, now, now.Add(duration))
+		controller.ClearSessionRealm(session)
+
+		flash.Alert("You are now viewing as %s for the next %s.", user.Email, duration)
+		http.Redirect(w, r, "/login/select-realm", http.StatusSeeOther)
+	})
+}
+
+// HandleImpersonateStop ends the current impersonation and returns the system
+// admin to their own identity.
+func (c *Controller) HandleImpersonateStop() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		impersonator := controller.ImpersonatorFromContext(ctx)
+		currentUser := controller.UserFromContext(ctx)
+		if impersonator == nil || currentUser == nil {
+			// Nothing to stop.
+			controller.ClearSessionImpersonation(session)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		_, startedAt, _ := controller.ImpersonationFromSession(session)
+		elapsed := time.Since(startedAt).Round(time.Second)
+
+		audit := database.BuildAuditEntry(impersonator,
+			fmt.Sprintf("stopped impersonating user after %s", elapsed), currentUser, 0)
+		if err := c.db.SaveAuditEntry(audit); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		controller.ClearSessionImpersonation(session)
+		controller.ClearSessionRealm(session)
+
+		flash.Alert("Stopped impersonating %s.", currentUser.Email)
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/gorilla/mux"
+)
+
+// HandleLoginLockoutsIndex renders the list of addresses which are locked out
+// after failed logins.
+func (c *Controller) HandleLoginLockoutsIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		lockouts, paginator, err := c.db.ListLoginLockouts(pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Login lockouts - System Admin")
+		m["lockouts"] = lockouts
+		m["lockoutsEnabled"] = c.config.LoginLockout.Enabled()
+		m["paginator"] = paginator
+		c.h.RenderHTML(w, "admin/login-lockouts/index", m)
+	})
+}
+
+// HandleLoginLockoutClear clears a lockout so the address may sign in again
+// immediately.
+func (c *Controller) HandleLoginLockoutClear() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		lockout, err := c.db.ClearLoginLockout(vars["id"], currentUser)
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			flash.Error("Failed to clear lockout: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Successfully cleared lockout for %s.", lockout.IPAddress)
+		http.Redirect(w, r, "/admin/login-lockouts", http.StatusSeeOther)
+	})
+}
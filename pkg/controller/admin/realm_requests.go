@@ -0,0 +1,145 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleRealmRequestApprove approves a pending realm request. The realm
+// becomes active, and the requester becomes its first admin and is notified by
+// email.
+func (c *Controller) HandleRealmRequestApprove() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+		logger := logging.FromContext(ctx).Named("admin.HandleRealmRequestApprove")
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if !realm.PendingApproval {
+			flash.Error("Realm %q is not pending approval.", realm.Name)
+			http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+			return
+		}
+
+		requester, err := c.db.FindUser(realm.RequestedByID)
+		if err != nil {
+			if database.IsNotFound(err) {
+				flash.Error("The user who requested %q no longer exists, reject the request instead.", realm.Name)
+				http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		realm.PendingApproval = false
+		if err := c.db.SaveRealm(realm, currentUser); err != nil {
+			flash.Error("Failed to approve realm: %v", err)
+			http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+			return
+		}
+
+		requester.AddRealm(realm)
+		requester.AddRealmAdmin(realm)
+		if err := c.db.SaveUser(requester, currentUser); err != nil {
+			flash.Error("Approved realm %q, but failed to add %s as an admin: %v", realm.Name, requester.Email, err)
+			http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+			return
+		}
+
+		if err := controller.SendSystemEmail(ctx, c.db, c.h, "email/realm-request-approved", []string{requester.Email}, map[string]interface{}{
+			"RealmName": realm.Name,
+			"LoginLink": controller.AbsoluteURL(r, "/", c.config.DevMode),
+		}); err != nil {
+			logger.Errorw("failed to notify requester of approval", "error", err)
+			flash.Warning("Failed to email %s: %v", requester.Email, err)
+		}
+
+		flash.Alert("Approved realm %q and added %s as its admin.", realm.Name, requester.Email)
+		http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+	})
+}
+
+// HandleRealmRequestReject rejects a pending realm request by deleting the
+// realm.
+func (c *Controller) HandleRealmRequestReject() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm, err := c.db.FindRealm(vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteRealmRequest(realm, currentUser); err != nil {
+			flash.Error("Failed to reject realm request: %v", err)
+			http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+			return
+		}
+
+		flash.Alert("Rejected the request for realm %q.", realm.Name)
+		http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
+	})
+}
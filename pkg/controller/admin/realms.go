@@ -17,6 +17,7 @@ package admin
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -36,7 +37,14 @@ func (c *Controller) HandleRealmsIndex() http.Handler {
 
 		q := r.FormValue(QueryKeySearch)
 
-		realms, paginator, err := c.db.ListRealms(pageParams, database.WithRealmSearch(q))
+		realms, paginator, err := c.db.ListRealms(pageParams,
+			database.WithRealmSearch(q), database.WithoutPendingRealms())
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		pendingRealms, err := c.db.ListPendingRealms()
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
@@ -45,6 +53,7 @@ func (c *Controller) HandleRealmsIndex() http.Handler {
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("Realms - System Admin")
 		m["realms"] = realms
+		m["pendingRealms"] = pendingRealms
 		m["query"] = q
 		m["paginator"] = paginator
 		c.h.RenderHTML(w, "admin/realms/index", m)
@@ -160,6 +169,7 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 	type FormData struct {
 		CanUseSystemSMSConfig   bool `form:"can_use_system_sms_config"`
 		CanUseSystemEmailConfig bool `form:"can_use_system_email_config"`
+		MonthlyCodeQuota        uint `form:"monthly_code_quota"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -199,7 +209,7 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 
 		var quotaLimit, quotaRemaining uint64
 		if realm.AbusePreventionEnabled {
-			key, err := realm.QuotaKey(c.config.RateLimit.HMACKey)
+			key, err := realm.DailyQuotaKey(c.config.RateLimit.HMACKey, time.Now())
 			if err != nil {
 				controller.InternalError(w, r, c.h, err)
 				return
@@ -212,27 +222,49 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 			}
 		}
 
+		monthlyIssued, err := realm.CountMonthlyCodesIssued(c.db, time.Now())
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			c.renderEditRealm(ctx, w, realm, smsConfig, emailConfig, quotaLimit, quotaRemaining)
+			c.renderEditRealm(ctx, w, realm, smsConfig, emailConfig, quotaLimit, quotaRemaining, monthlyIssued)
 			return
 		}
 
 		var form FormData
 		if err := controller.BindForm(w, r, &form); err != nil {
 			flash.Error("Failed to process form: %v", err)
-			c.renderEditRealm(ctx, w, realm, smsConfig, emailConfig, quotaLimit, quotaRemaining)
+			c.renderEditRealm(ctx, w, realm, smsConfig, emailConfig, quotaLimit, quotaRemaining, monthlyIssued)
 			return
 		}
 
 		realm.CanUseSystemSMSConfig = form.CanUseSystemSMSConfig
 		realm.CanUseSystemEmailConfig = form.CanUseSystemEmailConfig
+		realm.MonthlyCodeQuota = form.MonthlyCodeQuota
 		if err := c.db.SaveRealm(realm, currentUser); err != nil {
 			flash.Error("Failed to create realm: %v", err)
-			c.renderEditRealm(ctx, w, realm, smsConfig, emailConfig, quotaLimit, quotaRemaining)
+			c.renderEditRealm(ctx, w, realm, smsConfig, emailConfig, quotaLimit, quotaRemaining, monthlyIssued)
 			return
 		}
 
+		// Raising or removing the quota of a disabled realm re-enables issuance.
+		if realm.QuotaDisabledAt != nil {
+			exhausted, err := realm.MonthlyQuotaExhausted(c.db, time.Now())
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			if !exhausted {
+				if err := c.db.EnableRealmIssuanceForQuota(realm, "monthly quota raised", currentUser); err != nil {
+					controller.InternalError(w, r, c.h, err)
+					return
+				}
+			}
+		}
+
 		flash.Alert("Successfully updated realm %q", realm.Name)
 		http.Redirect(w, r, "/admin/realms", http.StatusSeeOther)
 	})
@@ -240,7 +272,7 @@ func (c *Controller) HandleRealmsUpdate() http.Handler {
 
 func (c *Controller) renderEditRealm(ctx context.Context, w http.ResponseWriter,
 	realm *database.Realm, smsConfig *database.SMSConfig, emailConfig *database.EmailConfig,
-	quotaLimit, quotaRemaining uint64) {
+	quotaLimit, quotaRemaining, monthlyIssued uint64) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Realm: %s - System Admin", realm.Name)
 	m["realm"] = realm
@@ -249,6 +281,8 @@ func (c *Controller) renderEditRealm(ctx context.Context, w http.ResponseWriter,
 	m["supportsPerRealmSigning"] = c.db.SupportsPerRealmSigning()
 	m["quotaLimit"] = quotaLimit
 	m["quotaRemaining"] = quotaRemaining
+	m["monthlyCodesIssued"] = monthlyIssued
+	m["issuanceDisabledByQuota"] = realm.IssuanceDisabledByQuota(time.Now())
 	c.h.RenderHTML(w, "admin/realms/edit", m)
 }
 
@@ -0,0 +1,93 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/gorilla/mux"
+)
+
+// HandleSessionsIndex renders the list of active user sessions.
+func (c *Controller) HandleSessionsIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		userSessions, paginator, err := c.db.ListActiveUserSessions(pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Sessions - System Admin")
+		m["userSessions"] = userSessions
+		m["currentSessionID"] = controller.UserSessionIDFromSession(session)
+		m["paginator"] = paginator
+		c.h.RenderHTML(w, "admin/sessions/index", m)
+	})
+}
+
+// HandleSessionRevoke revokes a user session. The user must sign in again on
+// their next request.
+func (c *Controller) HandleSessionRevoke() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		userSession, err := c.db.RevokeUserSession(vars["id"], currentUser)
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+
+			flash.Error("Failed to revoke session: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Successfully revoked session from %s.", userSession.IPAddress)
+		http.Redirect(w, r, "/admin/sessions", http.StatusSeeOther)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// maxBatchSize is the maximum number of API keys which can be created at once.
+const maxBatchSize = 50
+
+// batchResult is the outcome of creating a single API key in a batch. APIKey
+// is only set if the key was created.
+type batchResult struct {
+	Name   string
+	ID     uint
+	APIKey string
+	Error  string
+}
+
+// HandleBatchCreate creates API keys of the same type for each of the given
+// names. The keys are displayed once, on the response page. Each key is
+// created and audited individually, so a failure does not prevent the other
+// keys from being created.
+func (c *Controller) HandleBatchCreate() http.Handler {
+	type FormData struct {
+		Names string              `form:"names"`
+		Type  database.APIKeyType `form:"type"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		// Requested form, stop processing.
+		if r.Method == http.MethodGet {
+			c.renderBatch(ctx, w, "", database.APIKeyTypeInvalid, nil)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			c.renderBatch(ctx, w, form.Names, form.Type, nil)
+			return
+		}
+
+		switch form.Type {
+		case database.APIKeyTypeDevice, database.APIKeyTypeAdmin, database.APIKeyTypeStats:
+		default:
+			flash.Error("Select the type of the API keys.")
+			c.renderBatch(ctx, w, form.Names, form.Type, nil)
+			return
+		}
+
+		names := parseBatchNames(form.Names)
+		if len(names) == 0 || len(names) > maxBatchSize {
+			flash.Error("Number of API keys must be between 1 and %d.", maxBatchSize)
+			c.renderBatch(ctx, w, form.Names, form.Type, nil)
+			return
+		}
+
+		results := make([]*batchResult, 0, len(names))
+		var failed int
+		for _, name := range names {
+			authApp := &database.AuthorizedApp{
+				Name:       name,
+				APIKeyType: form.Type,
+			}
+
+			result := &batchResult{Name: name}
+			apiKey, err := realm.CreateAuthorizedApp(c.db, authApp, currentUser)
+			if err != nil {
+				failed++
+				result.Error = err.Error()
+				if msgs := authApp.ErrorMessages(); len(msgs) > 0 {
+					result.Error = strings.Join(msgs, ", ")
+				}
+			} else {
+				result.ID = authApp.ID
+				result.APIKey = apiKey
+			}
+			results = append(results, result)
+		}
+
+		if failed > 0 {
+			flash.Error("Failed to create %d of %d API keys.", failed, len(results))
+		} else {
+			flash.Alert("Successfully created %d API keys.", len(results))
+		}
+		c.renderBatch(ctx, w, "", form.Type, results)
+	})
+}
+
+// parseBatchNames returns the non-blank, newline-separated names, without
+// duplicates.
+func parseBatchNames(s string) []string {
+	seen := make(map[string]struct{})
+	names := make([]string, 0, 8)
+	for _, line := range strings.Split(s, "\n") {
+		name := project.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	return names
+}
+
+// renderBatch renders the batch creation page. If results are given, the
+// created API keys are shown instead of the form.
+func (c *Controller) renderBatch(ctx context.Context, w http.ResponseWriter, names string, typ database.APIKeyType, results []*batchResult) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("New API keys")
+	m["names"] = names
+	m["type"] = typ
+	m["results"] = results
+	m["maxBatchSize"] = maxBatchSize
+	m["typeAdmin"] = database.APIKeyTypeAdmin
+	m["typeDevice"] = database.APIKeyTypeDevice
+	m["typeStats"] = database.APIKeyTypeStats
+	c.h.RenderHTML(w, "apikeys/batch", m)
+}
@@ -16,6 +16,7 @@ package apikey
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -57,7 +58,12 @@ func (c *Controller) HandleEnable() http.Handler {
 			return
 		}
 
+		// Restart the inactivity period, so a key which was disabled for
+		// inactivity is not disabled again right away.
+		now := time.Now().UTC()
 		authApp.DeletedAt = nil
+		authApp.LastUsedAt = &now
+		authApp.InactivityWarnedAt = nil
 		if err := c.db.SaveAuthorizedApp(authApp, currentUser); err != nil {
 			flash.Error("Failed to enable API Key: %v", err)
 			http.Redirect(w, r, "/realm/apikeys", http.StatusSeeOther)
@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apikey
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// rotateGracePeriodHours are the grace periods which can be selected when
+// rotating API keys.
+var rotateGracePeriodHours = []int{0, 1, 24, 72, 168}
+
+// HandleRotateAll replaces the key of every enabled API key in the realm, for
+// example after a suspected breach. The replaced keys are accepted for the
+// selected grace period, so apps can be updated without an outage. The new
+// keys are displayed once, on the response page.
+func (c *Controller) HandleRotateAll() http.Handler {
+	type FormData struct {
+		GracePeriodHours int  `form:"grace_period_hours"`
+		Confirm          bool `form:"confirm"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		// Requested form, stop processing.
+		if r.Method == http.MethodGet {
+			c.renderRotate(ctx, w, 24, nil)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			c.renderRotate(ctx, w, form.GracePeriodHours, nil)
+			return
+		}
+
+		if !form.Confirm {
+			flash.Error("Confirm that every API key in the realm should be rotated.")
+			c.renderRotate(ctx, w, form.GracePeriodHours, nil)
+			return
+		}
+
+		grace := time.Duration(form.GracePeriodHours) * time.Hour
+		rotated, err := realm.RotateAuthorizedApps(c.db, grace, currentUser)
+		if err != nil {
+			flash.Error("Failed to rotate API keys, no keys were changed: %v", err)
+			c.renderRotate(ctx, w, form.GracePeriodHours, nil)
+			return
+		}
+
+		if len(rotated) == 0 {
+			flash.Warning("There are no enabled API keys to rotate.")
+			c.renderRotate(ctx, w, form.GracePeriodHours, nil)
+			return
+		}
+
+		// The API keys are only in this response, so it must not be cached by the
+		// browser or any proxies.
+		w.Header().Set("Cache-Control", "no-store")
+
+		flash.Alert("Successfully rotated %d API keys.", len(rotated))
+		c.renderRotate(ctx, w, form.GracePeriodHours, rotated)
+	})
+}
+
+// renderRotate renders the rotation page. If results are given, the new API
+// keys are shown instead of the form.
+func (c *Controller) renderRotate(ctx context.Context, w http.ResponseWriter, graceHours int, results []*database.RotatedAPIKey) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Rotate API keys")
+	m["gracePeriodHours"] = graceHours
+	m["gracePeriodOptions"] = rotateGracePeriodHours
+	m["results"] = results
+	c.h.RenderHTML(w, "apikeys/rotate", m)
+}
@@ -55,6 +55,10 @@ func (c *Controller) HandleShow() http.Handler {
 			m := controller.TemplateMapFromContext(ctx)
 			m["apiKey"] = apiKey
 			delete(session.Values, "apiKey")
+
+			// The API key is only in this response, so it must not be cached by the
+			// browser or any proxies.
+			w.Header().Set("Cache-Control", "no-store")
 		}
 
 		// Pull the authorized app from the id.
@@ -27,7 +27,9 @@ import (
 // HandleUpdate handles an update.
 func (c *Controller) HandleUpdate() http.Handler {
 	type FormData struct {
-		Name string `form:"name"`
+		Name             string              `form:"name"`
+		InactivityExempt bool                `form:"inactivity_exempt"`
+		AcceptTestTypes  []database.TestType `form:"accept_test_types"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +68,7 @@ func (c *Controller) HandleUpdate() http.Handler {
 
 		// Requested form, stop processing.
 		if r.Method == http.MethodGet {
-			c.renderEdit(ctx, w, authApp)
+			c.renderEdit(ctx, w, realm, authApp)
 			return
 		}
 
@@ -81,16 +83,29 @@ func (c *Controller) HandleUpdate() http.Handler {
 			}
 
 			flash.Error("Failed to process form: %v", err)
-			c.renderEdit(ctx, w, authApp)
+			c.renderEdit(ctx, w, realm, authApp)
 		}
 
 		// Build the authorized app struct
 		authApp.Name = form.Name
+		authApp.InactivityExempt = form.InactivityExempt
+
+		var acceptTestTypes database.TestType
+		for _, t := range form.AcceptTestTypes {
+			acceptTestTypes |= t
+		}
+		authApp.AcceptTestTypes = acceptTestTypes
+		if acceptTestTypes&^realm.AllowedTestTypes != 0 {
+			authApp.AddError("acceptTestTypes", "must be allowed by the realm")
+			flash.Error("Failed to save api key: validation failed")
+			c.renderEdit(ctx, w, realm, authApp)
+			return
+		}
 
 		// Save
 		if err := c.db.SaveAuthorizedApp(authApp, currentUser); err != nil {
 			flash.Error("Failed to save api key: %v", err)
-			c.renderEdit(ctx, w, authApp)
+			c.renderEdit(ctx, w, realm, authApp)
 			return
 		}
 
@@ -100,9 +115,40 @@ func (c *Controller) HandleUpdate() http.Handler {
 }
 
 // renderEdit renders the edit page.
-func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, authApp *database.AuthorizedApp) {
+func (c *Controller) renderEdit(ctx context.Context, w http.ResponseWriter, realm *database.Realm, authApp *database.AuthorizedApp) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Edit API key: %s", authApp.Name)
 	m["authApp"] = authApp
+	m["acceptTestTypes"] = acceptTestTypeOptions(realm, authApp)
 	c.h.RenderHTML(w, "/realm/apikeys/edit", m)
 }
+
+// acceptTestTypeOption is a test type which can be selected for an API key.
+type acceptTestTypeOption struct {
+	Name    string
+	Value   database.TestType
+	Checked bool
+}
+
+// acceptTestTypeOptions returns the test types the realm allows, and whether
+// the API key is restricted to each of them.
+func acceptTestTypeOptions(realm *database.Realm, authApp *database.AuthorizedApp) []*acceptTestTypeOption {
+	all := []database.TestType{
+		database.TestTypeConfirmed,
+		database.TestTypeLikely,
+		database.TestTypeNegative,
+	}
+
+	options := make([]*acceptTestTypeOption, 0, len(all))
+	for _, t := range all {
+		if realm.AllowedTestTypes&t == 0 {
+			continue
+		}
+		options = append(options, &acceptTestTypeOption{
+			Name:    t.Display(),
+			Value:   t,
+			Checked: authApp.AcceptTestTypes&t != 0,
+		})
+	}
+	return options
+}
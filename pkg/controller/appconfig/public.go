@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appconfig
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandlePublic returns the public configuration of the realm in the path. It
+// does not require an API key, so apps can set up their UI before a user
+// authenticates. Only settings which are safe to share with anyone are
+// included. Unknown realms and realms pending approval are not found.
+func (c *Controller) HandlePublic() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		vars := mux.Vars(r)
+		realmID, err := strconv.ParseUint(vars["id"], 10, 64)
+		if err != nil || realmID == 0 {
+			c.h.RenderJSON(w, http.StatusNotFound,
+				api.Errorf("realm not found").WithCode(api.ErrRealmNotFound))
+			return
+		}
+
+		cacheKey := &cache.Key{
+			Namespace: "appconfig:public",
+			Key:       strconv.FormatUint(realmID, 10),
+		}
+
+		// Realms which are not found are cached too, so unknown IDs cannot be used
+		// to generate database load.
+		var resp api.RealmPublicConfigResponse
+		if err := c.cacher.Fetch(ctx, cacheKey, &resp, cacheTTL, func() (interface{}, error) {
+			return c.buildPublicResponse(realmID)
+		}); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if resp.RealmID == 0 {
+			c.h.RenderJSON(w, http.StatusNotFound,
+				api.Errorf("realm not found").WithCode(api.ErrRealmNotFound))
+			return
+		}
+
+		etag, err := computeETag(&resp)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cacheTTL.Seconds())))
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &resp)
+	})
+}
+
+// buildPublicResponse builds the public configuration of the realm. If the
+// realm does not exist or is pending approval, the response is empty.
+func (c *Controller) buildPublicResponse(realmID uint64) (*api.RealmPublicConfigResponse, error) {
+	realm, err := c.db.FindRealm(realmID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			return &api.RealmPublicConfigResponse{}, nil
+		}
+		return nil, fmt.Errorf("failed to find realm: %w", err)
+	}
+	return publicConfig(realm), nil
+}
+
+// publicConfig returns the public configuration of the realm. Nothing secret
+// or internal to the realm's operation may be added here.
+func publicConfig(realm *database.Realm) *api.RealmPublicConfigResponse {
+	if realm.PendingApproval {
+		return &api.RealmPublicConfigResponse{}
+	}
+
+	return &api.RealmPublicConfigResponse{
+		RealmID:          realm.ID,
+		RealmName:        realm.Name,
+		RegionCode:       realm.RegionCode,
+		DeepLink:         realm.DeepLinkBase(),
+		ENExpress:        realm.EnableENExpress,
+		AllowedTestTypes: realm.AllowedTestTypes.Names(),
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appconfig
+
+import (
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPublicConfig(t *testing.T) {
+	t.Parallel()
+
+	realm := database.NewRealmWithDefaults("State of Wonder")
+	realm.ID = 7
+	realm.RegionCode = "US-WA"
+	realm.SMSTextTemplate = "secret template"
+	realm.CertificateIssuer = "internal issuer"
+
+	got := publicConfig(realm)
+	exp := &api.RealmPublicConfigResponse{
+		RealmID:          7,
+		RealmName:        "State of Wonder",
+		RegionCode:       "US-WA",
+		DeepLink:         realm.DeepLinkBase(),
+		AllowedTestTypes: realm.AllowedTestTypes.Names(),
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	realm.PendingApproval = true
+	if got := publicConfig(realm); got.RealmID != 0 || got.RealmName != "" {
+		t.Errorf("expected empty config for pending realm, got %#v", got)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// cacheTTL is how long the capabilities of a realm are cached, both on the
+// server and by clients.
+const cacheTTL = 5 * time.Minute
+
+// HandleShow returns the capabilities of the realm which owns the API key. The
+// response has an ETag, and a matching If-None-Match header results in a 304.
+func (c *Controller) HandleShow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		cacheKey := &cache.Key{
+			Namespace: "appconfig:realm",
+			Key:       strconv.FormatUint(uint64(realm.ID), 10),
+		}
+
+		var resp api.AppConfigResponse
+		if err := c.cacher.Fetch(ctx, cacheKey, &resp, cacheTTL, func() (interface{}, error) {
+			return c.buildResponse(realm)
+		}); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		etag, err := computeETag(&resp)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(cacheTTL.Seconds())))
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &resp)
+	})
+}
+
+// buildResponse builds the capability document from the realm's settings.
+func (c *Controller) buildResponse(realm *database.Realm) (*api.AppConfigResponse, error) {
+	hasSMS, err := realm.HasSMSConfig(c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sms config: %w", err)
+	}
+
+	minVersions, err := realm.MinAppVersions(c.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app versions: %w", err)
+	}
+
+	return &api.AppConfigResponse{
+		RealmName:  realm.Name,
+		RegionCode: realm.RegionCode,
+		Capabilities: &api.AppCapabilities{
+			SMS:                  hasSMS,
+			ENExpress:            realm.EnableENExpress,
+			DeepLink:             realm.DeepLinkBase(),
+			LongCodes:            !realm.DisableLongCodes,
+			ShortCodes:           !realm.DisableShortCodeClaims,
+			AllowedTestTypes:     realm.AllowedTestTypes.Names(),
+			RequireDate:          realm.RequireDate,
+			RequireDeviceBinding: realm.RequireDeviceBinding,
+			RequireAppID:         len(realm.AllowedClaimAppIDs) > 0,
+			MinAppVersions:       minVersions,
+		},
+	}, nil
+}
+
+// computeETag returns a strong ETag for the JSON encoding of the response.
+func computeETag(resp interface{}) (string, error) {
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal response: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// etagMatches returns true if the If-None-Match header value includes the
+// ETag. Weak comparison is used, as described in RFC 7232.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
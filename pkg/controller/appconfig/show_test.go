@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appconfig
+
+import (
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+)
+
+func TestComputeETag(t *testing.T) {
+	t.Parallel()
+
+	a, err := computeETag(&api.AppConfigResponse{RealmName: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := computeETag(&api.AppConfigResponse{RealmName: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("expected etags for different responses to differ")
+	}
+
+	again, err := computeETag(&api.AppConfigResponse{RealmName: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != again {
+		t.Errorf("expected %q to be %q", again, a)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	t.Parallel()
+
+	etag := `"abc"`
+
+	cases := []struct {
+		name   string
+		header string
+		exp    bool
+	}{
+		{name: "empty", header: "", exp: false},
+		{name: "exact", header: `"abc"`, exp: true},
+		{name: "weak", header: `W/"abc"`, exp: true},
+		{name: "list", header: `"xyz", "abc"`, exp: true},
+		{name: "wildcard", header: "*", exp: true},
+		{name: "other", header: `"xyz"`, exp: false},
+		{name: "unquoted", header: `abc`, exp: false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := etagMatches(tc.header, etag); got != tc.exp {
+				t.Errorf("expected %t to be %t", got, tc.exp)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+const (
+	// QueryAuditFrom and QueryAuditTo are the query keys for the time range of
+	// an audit log query, as <input type="datetime-local"> values in UTC.
+	QueryAuditFrom = "from"
+	QueryAuditTo   = "to"
+
+	// QueryAuditActorID, QueryAuditAction, and QueryAuditTargetID are the query
+	// keys for the audit log filters.
+	QueryAuditActorID  = "actor_id"
+	QueryAuditAction   = "action"
+	QueryAuditTargetID = "target_id"
+)
+
+// auditTimeFormats are the accepted formats of the audit log time range.
+var auditTimeFormats = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC3339,
+}
+
+// AuditLogQueryFromRequest builds an audit log query from the request's query
+// parameters. Errors wrap database.ErrInvalidAuditLogQuery.
+func AuditLogQueryFromRequest(r *http.Request) (*database.AuditLogQuery, error) {
+	from, err := parseAuditTime(r.FormValue(QueryAuditFrom))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid start time: %v", database.ErrInvalidAuditLogQuery, err)
+	}
+	to, err := parseAuditTime(r.FormValue(QueryAuditTo))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid end time: %v", database.ErrInvalidAuditLogQuery, err)
+	}
+
+	return &database.AuditLogQuery{
+		ActorID:  project.TrimSpace(r.FormValue(QueryAuditActorID)),
+		Action:   project.TrimSpace(r.FormValue(QueryAuditAction)),
+		TargetID: project.TrimSpace(r.FormValue(QueryAuditTargetID)),
+		From:     from,
+		To:       to,
+	}, nil
+}
+
+func parseAuditTime(s string) (time.Time, error) {
+	s = project.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range auditTimeFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a valid time", s)
+}
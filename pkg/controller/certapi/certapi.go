@@ -22,6 +22,7 @@ import (
 
 	vcache "github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
@@ -97,7 +98,13 @@ func (c *Controller) validateToken(ctx context.Context, verToken string, publicK
 		logger.Errorf("JWT is invalid: %v", err)
 		return "", nil, fmt.Errorf("verification token expired")
 	}
-	if !tokenClaims.VerifyIssuer(c.config.TokenSigning.TokenIssuer, true) || !tokenClaims.VerifyAudience(c.config.TokenSigning.TokenIssuer, true) {
+	issuer := c.config.TokenSigning.TokenIssuer
+	audience := c.config.TokenSigning.TokenIssuer
+	if realm := controller.RealmFromContext(ctx); realm != nil {
+		issuer = realm.EffectiveTokenIssuer(issuer)
+		audience = realm.EffectiveTokenAudience(audience)
+	}
+	if !tokenClaims.VerifyIssuer(issuer, true) || !tokenClaims.VerifyAudience(audience, true) {
 		logger.Errorf("jwt contains invalid iss/aud: iss %v aud: %v", tokenClaims.Issuer, tokenClaims.Audience)
 		return "", nil, fmt.Errorf("verification token not valid")
 	}
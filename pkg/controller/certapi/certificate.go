@@ -95,6 +95,17 @@ func (c *Controller) HandleCertificate() http.Handler {
 			return
 		}
 
+		// Negative results may not be uploaded if the realm's policy forbids it.
+		if realm := controller.RealmFromContext(ctx); realm != nil &&
+			subject.TestType == "negative" && realm.NegativeResultPolicy.BlocksUpload() {
+			blame = observability.BlameClient
+			result = observability.ResultError("NEGATIVE_RESULT_UPLOAD_BLOCKED")
+
+			c.h.RenderJSON(w, http.StatusPreconditionFailed,
+				api.Errorf("this realm does not accept uploads for negative test results").WithCode(api.ErrNegativeResultUploadBlocked))
+			return
+		}
+
 		// Validate the HMAC length. SHA 256 HMAC must be 32 bytes in length.
 		hmacBytes, err := base64util.DecodeString(request.ExposureKeyHMAC)
 		if err != nil {
@@ -131,8 +142,20 @@ func (c *Controller) HandleCertificate() http.Handler {
 		// Create the Certificate
 		now := time.Now().UTC()
 		claims := verifyapi.NewVerificationClaims()
-		// Assign the report type.
+		// Assign the report type, using the realm's report type mapping.
 		claims.ReportType = subject.TestType
+		if realm := controller.RealmFromContext(ctx); realm != nil {
+			reportType, err := realm.ReportTypeFor(subject.TestType)
+			if err != nil {
+				logger.Errorw("failed to map report type", "error", err)
+				blame = observability.BlameServer
+				result = observability.ResultError("INVALID_REPORT_TYPE_MAPPING")
+
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+			claims.ReportType = reportType
+		}
 		if subject.SymptomDate != nil {
 			claims.SymptomOnsetInterval = subject.SymptomInterval()
 		}
@@ -158,7 +181,7 @@ func (c *Controller) HandleCertificate() http.Handler {
 
 		// Do the transactional update to the database last so that if it fails, the
 		// client can retry.
-		if err := c.db.ClaimToken(authApp.RealmID, tokenID, subject); err != nil {
+		if err := c.db.ClaimToken(ctx, authApp.RealmID, tokenID, subject, request.DeviceFingerprint); err != nil {
 			logger.Errorw("failed to claim token", "tokenID", tokenID, "error", err)
 			blame = observability.BlameClient
 			switch {
@@ -174,6 +197,15 @@ func (c *Controller) HandleCertificate() http.Handler {
 				result = observability.ResultError("TOKEN_METADATA_MISMATCH")
 				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification token invalid").WithCode(api.ErrTokenExpired))
 				return
+			case errors.Is(err, database.ErrTokenDeviceMismatch):
+				result = observability.ResultError("TOKEN_DEVICE_MISMATCH")
+				c.h.RenderJSON(w, http.StatusConflict, api.Errorf("verification token was issued to a different device").WithCode(api.ErrDeviceMismatch))
+				return
+			case database.IsQueryTimeout(err):
+				blame = observability.BlameServer
+				result = observability.ResultError("QUERY_TIMEOUT")
+				c.h.RenderJSON(w, http.StatusGatewayTimeout, api.Errorf("timed out claiming token, please try again").WithCode(api.ErrInternal))
+				return
 			default:
 				result = observability.ResultError("UNKNOWN_TOKEN_CLAIM_ERROR")
 				c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err))
@@ -181,8 +213,18 @@ func (c *Controller) HandleCertificate() http.Handler {
 			}
 		}
 
-		c.h.RenderJSON(w, http.StatusOK, &api.VerificationCertificateResponse{
+		resp := &api.VerificationCertificateResponse{
 			Certificate: certificate,
-		})
+		}
+
+		// If the realm signs responses, sign the body with the same key as the
+		// certificate, so key servers can verify it with the published keys.
+		if realm := controller.RealmFromContext(ctx); realm != nil && realm.SignCertificateResponses {
+			c.h.RenderSignedJSON(w, http.StatusOK, resp, api.SignatureHeader, func(b []byte) (string, error) {
+				return jwthelper.SignDetached(b, signerInfo.KeyID, signerInfo.Signer)
+			})
+			return
+		}
+		c.h.RenderJSON(w, http.StatusOK, resp)
 	})
 }
@@ -46,5 +46,6 @@ func init() {
 			TagKeys:     observability.APITagKeys(),
 			Aggregation: ochttp.DefaultLatencyDistribution,
 		},
+		observability.SLOView(metricPrefix, mLatencyMs, "Latency distribution of certificate issue requests by realm and blame"),
 	}...)
 }
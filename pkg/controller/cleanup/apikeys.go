@@ -0,0 +1,165 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/hashicorp/go-multierror"
+)
+
+// inactiveAPIKeyEmailTemplate is the email sent to realm admins before and
+// after an API key is disabled for inactivity.
+var inactiveAPIKeyEmailTemplate = template.Must(template.New("inactive-api-key").Parse(`Subject: {{if .Disabled}}Disabled{{else}}Inactive{{end}} API key in {{.RealmName}}
+To: {{.ToEmail}}
+From: {{.FromEmail}}
+MIME-Version: 1.0
+Content-Type: text/plain; charset="utf-8"
+
+Hello,
+
+The "{{.AppName}}" API key in the {{.RealmName}} realm has not been used since
+{{.LastUsedAt}}.
+{{if .Disabled}}
+It has been disabled. A realm admin can re-enable it from the API keys page
+until {{.PurgeAt}}, after which it is deleted.
+{{else}}
+It will be disabled at {{.DisableAt}} unless it is used. If the key is still
+needed but rarely used, a realm admin can exempt it from being disabled on the
+API key's edit page.
+{{end}}
+You are receiving this email because you are an admin of the realm.
+`))
+
+// disableInactiveAPIKeys warns realm admins about API keys which are about to
+// be disabled for inactivity, and disables the keys whose warning period has
+// passed. It returns the number of keys warned about and disabled.
+func (c *Controller) disableInactiveAPIKeys(ctx context.Context, now time.Time) (int, int, error) {
+	disableAfter := c.config.APIKeyInactiveDisableAfter
+	if disableAfter <= 0 {
+		return 0, 0, nil
+	}
+	warnBefore := c.config.APIKeyInactiveWarnBefore
+
+	apps, err := c.db.ListInactiveAuthorizedApps(now.Add(-1 * (disableAfter - warnBefore)))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list inactive API keys: %w", err)
+	}
+
+	var warned, disabled int
+	var merr *multierror.Error
+	realms := make(map[uint]*database.Realm)
+
+	for _, app := range apps {
+		realm, ok := realms[app.RealmID]
+		if !ok {
+			realm, err = c.db.FindRealm(app.RealmID)
+			if err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to find realm %d: %w", app.RealmID, err))
+				continue
+			}
+			realms[app.RealmID] = realm
+		}
+
+		lastUsedAt := app.CreatedAt
+		if app.LastUsedAt != nil {
+			lastUsedAt = *app.LastUsedAt
+		}
+
+		// Admins always get the full warning period, even if the key was inactive
+		// for longer, such as when this was first enabled.
+		if app.InactivityWarnedAt == nil {
+			disableAt := lastUsedAt.Add(disableAfter)
+			if earliest := now.Add(warnBefore); disableAt.Before(earliest) {
+				disableAt = earliest
+			}
+
+			// The warning is recorded even if the email fails, so that a realm
+			// without email does not keep its inactive keys forever.
+			if err := c.notifyInactiveAPIKey(ctx, realm, app, lastUsedAt, disableAt, false); err != nil {
+				merr = multierror.Append(merr, err)
+			}
+			if err := c.db.MarkAuthorizedAppInactivityWarned(app); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to mark API key %d warned: %w", app.ID, err))
+				continue
+			}
+			warned++
+			continue
+		}
+
+		if now.Before(lastUsedAt.Add(disableAfter)) || now.Before(app.InactivityWarnedAt.Add(warnBefore)) {
+			continue
+		}
+
+		if err := c.db.DisableInactiveAuthorizedApp(app); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to disable API key %d: %w", app.ID, err))
+			continue
+		}
+		if err := c.notifyInactiveAPIKey(ctx, realm, app, lastUsedAt, now, true); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		disabled++
+	}
+
+	return warned, disabled, merr.ErrorOrNil()
+}
+
+// notifyInactiveAPIKey emails the realm admins about an inactive API key. It
+// does nothing if the realm has no email configuration.
+func (c *Controller) notifyInactiveAPIKey(ctx context.Context, realm *database.Realm, app *database.AuthorizedApp, lastUsedAt, disableAt time.Time, disabled bool) error {
+	logger := logging.FromContext(ctx).Named("cleanup.notifyInactiveAPIKey")
+
+	emailer, err := realm.EmailProvider(c.db)
+	if err != nil {
+		if database.IsNotFound(err) {
+			logger.Debugw("realm has no email configuration", "realm", realm.ID)
+			return nil
+		}
+		return fmt.Errorf("failed to create email provider for realm %d: %w", realm.ID, err)
+	}
+
+	emails, err := realm.AdminEmails(c.db)
+	if err != nil {
+		return fmt.Errorf("failed to list admins for realm %d: %w", realm.ID, err)
+	}
+
+	var merr *multierror.Error
+	for _, to := range emails {
+		var buf bytes.Buffer
+		if err := inactiveAPIKeyEmailTemplate.Execute(&buf, map[string]interface{}{
+			"ToEmail":    to,
+			"FromEmail":  emailer.From(),
+			"RealmName":  realm.Name,
+			"AppName":    app.Name,
+			"LastUsedAt": lastUsedAt.UTC().Format(time.RFC1123),
+			"DisableAt":  disableAt.UTC().Format(time.RFC1123),
+			"PurgeAt":    disableAt.Add(c.config.AuthorizedAppMaxAge).UTC().Format(time.RFC1123),
+			"Disabled":   disabled,
+		}); err != nil {
+			return fmt.Errorf("failed to render inactive API key email: %w", err)
+		}
+
+		if err := emailer.SendEmail(ctx, to, buf.Bytes()); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to email %s: %w", to, err))
+		}
+	}
+	return merr.ErrorOrNil()
+}
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/blobstore"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
@@ -33,17 +34,19 @@ import (
 
 // Controller is a controller for the cleanup service.
 type Controller struct {
-	config *config.CleanupConfig
-	db     *database.Database
-	h      *render.Renderer
+	config    *config.CleanupConfig
+	db        *database.Database
+	blobstore blobstore.Blobstore
+	h         *render.Renderer
 }
 
 // New creates a new cleanup controller.
-func New(ctx context.Context, config *config.CleanupConfig, db *database.Database, h *render.Renderer) (*Controller, error) {
+func New(ctx context.Context, config *config.CleanupConfig, db *database.Database, bs blobstore.Blobstore, h *render.Renderer) (*Controller, error) {
 	return &Controller{
-		config: config,
-		db:     db,
-		h:      h,
+		config:    config,
+		db:        db,
+		blobstore: bs,
+		h:         h,
 	}, nil
 }
 
@@ -105,6 +108,45 @@ func (c *Controller) HandleCleanup() http.Handler {
 			}
 		}()
 
+		// API keys - disable keys which have not been used
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "API_KEYS_INACTIVE")
+			if warned, disabled, err := c.disableInactiveAPIKeys(ctx, time.Now().UTC()); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to disable inactive authorized apps: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("disabled inactive authorized apps", "warned", warned, "disabled", disabled)
+				result = observability.ResultOK()
+			}
+		}()
+
+		// Realms - re-enable issuance after the monthly code quota resets
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "REALM_MONTHLY_QUOTA")
+			if notified, enabled, err := c.processQuotaDisabledRealms(ctx, time.Now().UTC()); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to process quota disabled realms: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("processed quota disabled realms", "notified", notified, "enabled", enabled)
+				result = observability.ResultOK()
+			}
+		}()
+
+		// SMS - retry text messages which failed when codes were issued
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "SMS_RETRY")
+			if sent, dropped, err := c.retryQueuedSMS(ctx, time.Now().UTC()); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to retry sms: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("retried queued sms", "sent", sent, "dropped", dropped)
+				result = observability.ResultOK()
+			}
+		}()
+
 		// Verification codes - purge codes from database entirely.
 		// Their code/long_code hmac values will have been set to "".
 		func() {
@@ -185,6 +227,58 @@ func (c *Controller) HandleCleanup() http.Handler {
 			}
 		}()
 
+		// User sessions
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "USER_SESSION")
+			if count, err := c.db.PurgeUserSessions(c.config.UserSessionMaxAge); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge user sessions: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("purged user sessions", "count", count)
+				result = observability.ResultOK()
+			}
+		}()
+
+		// Login lockouts
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "LOGIN_LOCKOUT")
+			if count, err := c.db.PurgeLoginLockouts(c.config.LoginLockoutMaxAge); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge login lockouts: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("purged login lockouts", "count", count)
+				result = observability.ResultOK()
+			}
+		}()
+
+		// Issuance failures
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "ISSUANCE_FAILURE")
+			if count, err := c.db.PurgeIssuanceFailures(c.config.IssuanceFailureMaxAge); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to purge issuance failures: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("purged issuance failures", "count", count)
+				result = observability.ResultOK()
+			}
+		}()
+
+		// Re-encrypt secrets which were encrypted with a previous key
+		func() {
+			defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+			item = tag.Upsert(itemTagKey, "ENCRYPTION_KEY")
+			if count, err := c.db.RotateEncryptionKeys(); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to rotate encryption keys: %w", err))
+				result = observability.ResultError("FAILED")
+			} else {
+				logger.Infow("re-encrypted secrets", "count", count)
+				result = observability.ResultOK()
+			}
+		}()
+
 		// If there are any errors, return them
 		if merr != nil {
 			if errs := merr.WrappedErrors(); len(errs) > 0 {
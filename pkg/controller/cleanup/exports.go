@@ -0,0 +1,186 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"text/template"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/hashicorp/go-multierror"
+	"go.opencensus.io/tag"
+)
+
+// exportEmailTemplate is the email sent for exports delivered by email. The
+// cleanup service does not load the server's assets, so it is defined here.
+var exportEmailTemplate = template.Must(template.New("export").Parse(`Subject: {{.RealmName}} stats export
+To: {{.ToEmail}}
+From: {{.FromEmail}}
+MIME-Version: 1.0
+Content-Type: text/plain; charset="utf-8"
+
+Hello,
+
+The scheduled {{.Description}} export for the {{.RealmName}} realm is ready.
+Use the following link to download it:
+
+{{.Link}}
+
+The link expires at {{.ExpiresAt}}. You are receiving this email because a realm
+admin added you to the export's recipients.
+`))
+
+// HandleExports runs the scheduled exports which are due. Each schedule is
+// claimed before it runs, so concurrent requests never run the same export,
+// and a failed export is recorded on the schedule and retried at its next run.
+func (c *Controller) HandleExports() http.Handler {
+	type ExportsResult struct {
+		OK     bool    `json:"ok"`
+		Ran    int     `json:"ran"`
+		Errors []error `json:"errors,omitempty"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := observability.WithBuildInfo(r.Context())
+
+		logger := logging.FromContext(ctx).Named("cleanup.HandleExports")
+
+		var result, item tag.Mutator
+		item = tag.Upsert(itemTagKey, "EXPORT")
+
+		now := time.Now().UTC()
+		schedules, err := c.db.ClaimDueExportSchedules(now, c.config.ExportBatchSize)
+		if err != nil {
+			logger.Errorw("failed to claim export schedules", "error", err)
+			c.h.RenderJSON(w, http.StatusInternalServerError, &ExportsResult{
+				OK:     false,
+				Errors: []error{err},
+			})
+			return
+		}
+
+		var merr *multierror.Error
+		for _, s := range schedules {
+			func() {
+				defer observability.RecordLatency(&ctx, time.Now(), mLatencyMs, &result, &item)
+
+				runErr := c.runExport(ctx, s, now)
+				if runErr != nil {
+					merr = multierror.Append(merr, fmt.Errorf("export schedule %d: %w", s.ID, runErr))
+					result = observability.ResultError("FAILED")
+				} else {
+					logger.Infow("ran export", "id", s.ID, "realm", s.RealmID)
+					result = observability.ResultOK()
+				}
+
+				if err := c.db.RecordExportScheduleRun(s, now, runErr); err != nil {
+					merr = multierror.Append(merr, fmt.Errorf("failed to record export schedule %d: %w", s.ID, err))
+				}
+			}()
+		}
+
+		if errs := merr.WrappedErrors(); len(errs) > 0 {
+			logger.Errorw("failed to run exports", "errors", errs)
+			c.h.RenderJSON(w, http.StatusInternalServerError, &ExportsResult{
+				OK:     false,
+				Ran:    len(schedules),
+				Errors: errs,
+			})
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, &ExportsResult{
+			OK:  true,
+			Ran: len(schedules),
+		})
+	})
+}
+
+// runExport generates the export and delivers it to the schedule's
+// destination.
+func (c *Controller) runExport(ctx context.Context, s *database.ExportSchedule, now time.Time) error {
+	realm, err := c.db.FindRealm(s.RealmID)
+	if err != nil {
+		return fmt.Errorf("failed to find realm: %w", err)
+	}
+
+	b, err := s.Generate(c.db, realm, now)
+	if err != nil {
+		return err
+	}
+	filename := s.Filename(now)
+
+	switch s.Destination {
+	case database.ExportDestinationGCS:
+		object := path.Join(s.Prefix, filename)
+		if err := c.blobstore.CreateObject(ctx, s.Bucket, object, s.ContentType(), b); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+		return nil
+
+	case database.ExportDestinationEmail:
+		if c.config.ExportBucket == "" {
+			return fmt.Errorf("EXPORT_BUCKET is not configured")
+		}
+
+		emailer, err := realm.EmailProvider(c.db)
+		if err != nil {
+			if database.IsNotFound(err) {
+				return fmt.Errorf("realm has no email configuration")
+			}
+			return fmt.Errorf("failed to create email provider: %w", err)
+		}
+
+		object := fmt.Sprintf("realm-%d/schedule-%d/%s", realm.ID, s.ID, filename)
+		if err := c.blobstore.CreateObject(ctx, c.config.ExportBucket, object, s.ContentType(), b); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+
+		link, err := c.blobstore.SignedURL(ctx, c.config.ExportBucket, object, c.config.ExportLinkDuration)
+		if err != nil {
+			return fmt.Errorf("failed to create export link: %w", err)
+		}
+
+		var merr *multierror.Error
+		for _, to := range s.Emails {
+			var buf bytes.Buffer
+			if err := exportEmailTemplate.Execute(&buf, map[string]interface{}{
+				"ToEmail":     to,
+				"FromEmail":   emailer.From(),
+				"RealmName":   realm.Name,
+				"Description": s.Display(),
+				"Link":        link,
+				"ExpiresAt":   now.Add(c.config.ExportLinkDuration).Format(time.RFC1123),
+			}); err != nil {
+				return fmt.Errorf("failed to render export email: %w", err)
+			}
+
+			if err := emailer.SendEmail(ctx, to, buf.Bytes()); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to email %s: %w", to, err))
+			}
+		}
+		return merr.ErrorOrNil()
+
+	default:
+		return fmt.Errorf("unknown export destination %q", s.Destination)
+	}
+}
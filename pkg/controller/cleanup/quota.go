@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cleanup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/hashicorp/go-multierror"
+)
+
+// quotaDisabledEmailTemplate is the email sent to realm admins when issuance is
+// disabled because the realm used its monthly code quota.
+var quotaDisabledEmailTemplate = template.Must(template.New("quota-disabled").Parse(`Subject: Code issuance disabled in {{.RealmName}}
+To: {{.ToEmail}}
+From: {{.FromEmail}}
+MIME-Version: 1.0
+Content-Type: text/plain; charset="utf-8"
+
+Hello,
+
+The {{.RealmName}} realm has issued its monthly quota of {{.Quota}} codes, so
+issuing new codes was disabled at {{.DisabledAt}}. Codes which were already
+issued can still be claimed.
+
+Issuing resumes automatically at {{.ResumeAt}}. To resume sooner, contact
+your system administrator to raise the realm's quota.
+
+You are receiving this email because you are an admin of the realm.
+`))
+
+// processQuotaDisabledRealms re-enables issuance for realms whose monthly code
+// quota has reset or been raised, and emails the admins of realms which are
+// still disabled. It returns the number of realms notified and re-enabled.
+func (c *Controller) processQuotaDisabledRealms(ctx context.Context, now time.Time) (int, int, error) {
+	realms, err := c.db.ListQuotaDisabledRealms()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list quota disabled realms: %w", err)
+	}
+
+	var notified, enabled int
+	var merr *multierror.Error
+
+	for _, realm := range realms {
+		if !realm.IssuanceDisabledByQuota(now) {
+			if err := c.db.EnableRealmIssuanceForQuota(realm, "monthly quota reset", database.System); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to enable realm %d: %w", realm.ID, err))
+				continue
+			}
+			enabled++
+			continue
+		}
+
+		exhausted, err := realm.MonthlyQuotaExhausted(c.db, now)
+		if err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to check quota for realm %d: %w", realm.ID, err))
+			continue
+		}
+		if !exhausted {
+			if err := c.db.EnableRealmIssuanceForQuota(realm, "monthly quota raised", database.System); err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to enable realm %d: %w", realm.ID, err))
+				continue
+			}
+			enabled++
+			continue
+		}
+
+		if realm.QuotaDisabledNotified {
+			continue
+		}
+
+		// The notification is recorded even if the email fails, so that admins
+		// are not emailed on every run.
+		if err := c.notifyQuotaDisabled(ctx, realm); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+		if err := c.db.MarkRealmQuotaDisabledNotified(realm); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to mark realm %d notified: %w", realm.ID, err))
+			continue
+		}
+		notified++
+	}
+
+	return notified, enabled, merr.ErrorOrNil()
+}
+
+// notifyQuotaDisabled emails the realm admins that issuance was disabled. It
+// does nothing if the realm has no email configuration.
+func (c *Controller) notifyQuotaDisabled(ctx context.Context, realm *database.Realm) error {
+	logger := logging.FromContext(ctx).Named("cleanup.notifyQuotaDisabled")
+
+	emailer, err := realm.EmailProvider(c.db)
+	if err != nil {
+		if database.IsNotFound(err) {
+			logger.Debugw("realm has no email configuration", "realm", realm.ID)
+			return nil
+		}
+		return fmt.Errorf("failed to create email provider for realm %d: %w", realm.ID, err)
+	}
+
+	emails, err := realm.AdminEmails(c.db)
+	if err != nil {
+		return fmt.Errorf("failed to list admins for realm %d: %w", realm.ID, err)
+	}
+
+	_, resumeAt := database.QuotaMonth(*realm.QuotaDisabledAt)
+
+	var merr *multierror.Error
+	for _, to := range emails {
+		var buf bytes.Buffer
+		if err := quotaDisabledEmailTemplate.Execute(&buf, map[string]interface{}{
+			"ToEmail":    to,
+			"FromEmail":  emailer.From(),
+			"RealmName":  realm.Name,
+			"Quota":      realm.MonthlyCodeQuota,
+			"DisabledAt": realm.QuotaDisabledAt.UTC().Format(time.RFC1123),
+			"ResumeAt":   resumeAt.Format(time.RFC1123),
+		}); err != nil {
+			return fmt.Errorf("failed to render quota disabled email: %w", err)
+		}
+
+		if err := emailer.SendEmail(ctx, to, buf.Bytes()); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to email %s: %w", to, err))
+		}
+	}
+	return merr.ErrorOrNil()
+}
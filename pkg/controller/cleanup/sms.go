@@ -0,0 +1,127 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/sms"
+	"github.com/hashicorp/go-multierror"
+)
+
+// smsRetryBatchSize is the maximum number of queued text messages retried in
+// one cleanup run.
+const smsRetryBatchSize = 100
+
+// retryQueuedSMS retries sending text messages which failed when their codes
+// were issued. Messages are dropped once they are sent, their code is claimed
+// or expires, or they run out of attempts. It returns the number of messages
+// sent and dropped.
+func (c *Controller) retryQueuedSMS(ctx context.Context, now time.Time) (int, int, error) {
+	logger := logging.FromContext(ctx).Named("cleanup.retryQueuedSMS")
+
+	retries, err := c.db.ListDueSMSRetries(now, smsRetryBatchSize)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list sms retries: %w", err)
+	}
+
+	var sent, dropped int
+	var merr *multierror.Error
+	realms := make(map[uint]*database.Realm)
+	providers := make(map[uint]sms.Provider)
+
+	drop := func(retry *database.SMSRetry) {
+		if err := c.db.DeleteSMSRetry(retry); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to delete sms retry %d: %w", retry.ID, err))
+			return
+		}
+		dropped++
+	}
+
+	for _, retry := range retries {
+		if retry.IsExpired(now) {
+			drop(retry)
+			continue
+		}
+
+		realm, ok := realms[retry.RealmID]
+		if !ok {
+			realm, err = c.db.FindRealm(retry.RealmID)
+			if err != nil {
+				if database.IsNotFound(err) {
+					drop(retry)
+					continue
+				}
+				merr = multierror.Append(merr, fmt.Errorf("failed to find realm %d: %w", retry.RealmID, err))
+				continue
+			}
+			realms[retry.RealmID] = realm
+		}
+
+		// Do not send codes which can no longer be used.
+		vc, err := realm.FindVerificationCodeByUUID(c.db, retry.VerificationCodeUUID)
+		if err != nil {
+			if database.IsNotFound(err) {
+				drop(retry)
+				continue
+			}
+			merr = multierror.Append(merr, fmt.Errorf("failed to find code for sms retry %d: %w", retry.ID, err))
+			continue
+		}
+		if vc.Claimed || vc.IsExpired() {
+			drop(retry)
+			continue
+		}
+
+		provider, ok := providers[retry.RealmID]
+		if !ok {
+			provider, err = realm.SMSProvider(c.db)
+			if err != nil {
+				merr = multierror.Append(merr, fmt.Errorf("failed to create sms provider for realm %d: %w", realm.ID, err))
+				continue
+			}
+			providers[retry.RealmID] = provider
+		}
+		if provider == nil {
+			// The realm removed its SMS configuration after the code was issued.
+			drop(retry)
+			continue
+		}
+
+		if err := provider.SendSMS(ctx, retry.Phone, retry.Message); err != nil {
+			logger.Warnw("failed to retry sms", "realm", realm.ID, "attempt", retry.Attempts+1, "error", err)
+			keep, err := c.db.RecordSMSRetryFailure(retry, err, now)
+			if err != nil {
+				merr = multierror.Append(merr, err)
+				continue
+			}
+			if !keep {
+				drop(retry)
+			}
+			continue
+		}
+
+		sent++
+		if err := c.db.DeleteSMSRetry(retry); err != nil {
+			merr = multierror.Append(merr, fmt.Errorf("failed to delete sms retry %d: %w", retry.ID, err))
+		}
+	}
+
+	return sent, dropped, merr.ErrorOrNil()
+}
@@ -40,6 +40,7 @@ func (c *Controller) HandleCheckCodeStatus() http.Handler {
 				Claimed:                code.Claimed,
 				ExpiresAtTimestamp:     code.ExpiresAt.UTC().Unix(),
 				LongExpiresAtTimestamp: code.LongExpiresAt.UTC().Unix(),
+				Metadata:               code.Metadata,
 			})
 	})
 }
@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/gorilla/mux"
+)
+
+// HandlePending lists the codes in the realm which are waiting for approval.
+func (c *Controller) HandlePending() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		if !currentUser.CanAdminRealm(realm.ID) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		pageParams, err := pagination.FromRequest(r)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		codes, paginator, err := realm.ListPendingApprovalCodes(c.db, pageParams)
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		m := controller.TemplateMapFromContext(ctx)
+		m.Title("Codes pending approval")
+		m["codes"] = codes
+		m["paginator"] = paginator
+		c.h.RenderHTML(w, "codes/pending", m)
+	})
+}
+
+// HandleApprove approves a code which is pending approval.
+func (c *Controller) HandleApprove() http.Handler {
+	return c.handleDecision((*database.Database).ApproveCode, "Approved code. It can now be used.")
+}
+
+// HandleReject rejects a code which is pending approval.
+func (c *Controller) HandleReject() http.Handler {
+	return c.handleDecision((*database.Database).RejectCode, "Rejected code. It can no longer be used.")
+}
+
+type decideFunc func(db *database.Database, realmID uint, uuid string, approver *database.User) (*database.VerificationCode, error)
+
+func (c *Controller) handleDecision(decide decideFunc, success string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		if !currentUser.CanAdminRealm(realm.ID) {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		code, err := decide(c.db, realm.ID, vars["uuid"], currentUser)
+		if err != nil {
+			switch {
+			case database.IsNotFound(err):
+				controller.NotFound(w, r, c.h)
+				return
+			case errors.Is(err, database.ErrCodeNotPendingApproval),
+				errors.Is(err, database.ErrCodeApprovalExpired),
+				errors.Is(err, database.ErrApproverIsIssuer):
+				flash.Error("Failed to update code: %v.", err)
+				controller.Back(w, r, c.h)
+				return
+			default:
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+		}
+
+		flash.Alert(success)
+
+		retCode := Code{}
+		c.responseCode(ctx, r, code, &retCode)
+		c.renderShow(ctx, w, retCode)
+	})
+}
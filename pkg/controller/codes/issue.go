@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
 )
 
 func (c *Controller) HandleIssue() http.Handler {
@@ -57,6 +58,8 @@ func (c *Controller) HandleIssue() http.Handler {
 		m["maxSymptomDays"] = displayAllowedDays
 		m["duration"] = realm.CodeDuration.Duration.String()
 		m["hasSMSConfig"] = hasSMSConfig
+		m["smsLocales"] = realm.SMSTextTemplates.Languages()
+		m["emailLocales"] = realm.EmailCodeTemplates.Languages()
 
 		// If the realm has a welcome message and it has not been displayed this
 		// session, display it.
@@ -69,6 +72,13 @@ func (c *Controller) HandleIssue() http.Handler {
 			m["welcomeMessage"] = template.HTML(realm.RenderWelcomeMessage())
 		}
 
+		// This is marked as HTML safe because it's run through bluemonday during
+		// parsing. The message is localized using the same preferences as the
+		// rest of the page.
+		m["issueConfirmationMessage"] = template.HTML(realm.RenderIssueConfirmationMessage(
+			r.URL.Query().Get(middleware.QueryKeyLanguage),
+			r.Header.Get(middleware.HeaderAcceptLanguage)))
+
 		// Render
 		c.h.RenderHTML(w, "codes/issue", m)
 	})
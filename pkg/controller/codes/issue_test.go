@@ -118,7 +118,12 @@ func TestHandleIssue_IssueCode(t *testing.T) {
 
 	// Exchange the code for a verification certificate.
 	allowedTypes := api.AcceptTypes{api.TestTypeConfirmed: struct{}{}}
-	token, err := harness.Database.VerifyCodeAndIssueToken(realm.ID, code, allowedTypes, 30*time.Minute)
+	token, err := harness.Database.VerifyCodeAndIssueToken(context.Background(), &database.IssueTokenRequest{
+		RealmID:          realm.ID,
+		VerificationCode: code,
+		AcceptTypes:      allowedTypes,
+		ExpireAfter:      30 * time.Minute,
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -97,11 +97,28 @@ func (c *Controller) responseCode(ctx context.Context, r *http.Request, code *da
 		retCode.IssuerType = "Issuing app"
 		retCode.Issuer = c.getAuthAppName(ctx, r, code.IssuingAppID)
 	}
+	if code.SupervisingUserID != 0 {
+		retCode.Supervisor = c.getUserName(ctx, r, code.SupervisingUserID)
+	}
 
 	retCode.Claimed = code.Claimed
-	if code.Claimed {
+	switch {
+	case code.Claimed:
 		retCode.Status = "Claimed by user"
-	} else {
+	case code.ApprovalStatus == database.ApprovalStatusRejected:
+		retCode.Status = "Rejected by realm admin"
+	case code.IsApprovalExpired():
+		retCode.Status = "Not approved in time"
+	case code.IsPendingApproval():
+		retCode.Status = "Awaiting approval"
+		retCode.PendingApproval = true
+
+		// Only a realm admin other than the issuer may approve the code.
+		realm := controller.RealmFromContext(ctx)
+		currentUser := controller.UserFromContext(ctx)
+		retCode.CanApprove = realm != nil && currentUser != nil &&
+			currentUser.CanAdminRealm(realm.ID) && currentUser.ID != code.IssuingUserID
+	default:
 		retCode.Status = "Not yet claimed"
 	}
 	if !code.IsExpired() && !code.Claimed {
@@ -172,9 +189,13 @@ type Code struct {
 	TestType       string `json:"testType"`
 	IssuerType     string `json:"issuerType"`
 	Issuer         string `json:"issuer"`
+	Supervisor     string `json:"supervisor,omitempty"`
 	Expires        int64  `json:"expires"`
 	LongExpires    int64  `json:"longExpires"`
 	HasLongExpires bool   `json:"hasLongExpires"`
+
+	PendingApproval bool `json:"pendingApproval"`
+	CanApprove      bool `json:"canApprove"`
 }
 
 func (c *Controller) renderShow(ctx context.Context, w http.ResponseWriter, code Code) {
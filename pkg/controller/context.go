@@ -30,6 +30,9 @@ type contextKey string
 const (
 	contextKeyAuthorizedApp = contextKey("authorizedApp")
 	contextKeyFirebaseUser  = contextKey("firebaseUser")
+	contextKeyGRPC          = contextKey("grpc")
+	contextKeyImpersonator  = contextKey("impersonator")
+	contextKeyKiosk         = contextKey("kiosk")
 	contextKeyRealm         = contextKey("realm")
 	contextKeyRequestID     = contextKey("requestID")
 	contextKeySession       = contextKey("session")
@@ -65,6 +68,7 @@ func AuthorizedAppFromContext(ctx context.Context) *database.AuthorizedApp {
 func WithRealm(ctx context.Context, r *database.Realm) context.Context {
 	m := TemplateMapFromContext(ctx)
 	m["currentRealm"] = r
+	m["realmTimezone"] = r.Location()
 	ctx = WithTemplateMap(ctx, m)
 
 	return context.WithValue(ctx, contextKeyRealm, r)
@@ -199,6 +203,31 @@ func UserFromContext(ctx context.Context) *database.User {
 	return t
 }
 
+// WithImpersonator stores the system admin who is impersonating the current
+// user on the context.
+func WithImpersonator(ctx context.Context, u *database.User) context.Context {
+	m := TemplateMapFromContext(ctx)
+	m["impersonator"] = u
+	ctx = WithTemplateMap(ctx, m)
+
+	return context.WithValue(ctx, contextKeyImpersonator, u)
+}
+
+// ImpersonatorFromContext retrieves the impersonating system admin from the
+// context. If no value exists, it returns nil.
+func ImpersonatorFromContext(ctx context.Context) *database.User {
+	v := ctx.Value(contextKeyImpersonator)
+	if v == nil {
+		return nil
+	}
+
+	t, ok := v.(*database.User)
+	if !ok {
+		return nil
+	}
+	return t
+}
+
 // WithFirebaseUser stores the current firebase user on the context.
 func WithFirebaseUser(ctx context.Context, u *auth.UserRecord) context.Context {
 	return context.WithValue(ctx, contextKeyFirebaseUser, u)
@@ -218,3 +247,29 @@ func FirebaseUserFromContext(ctx context.Context) *auth.UserRecord {
 	}
 	return t
 }
+
+// WithKiosk marks the request as being in kiosk mode.
+func WithKiosk(ctx context.Context) context.Context {
+	m := TemplateMapFromContext(ctx)
+	m["kiosk"] = true
+	ctx = WithTemplateMap(ctx, m)
+
+	return context.WithValue(ctx, contextKeyKiosk, true)
+}
+
+// KioskFromContext returns true if the request is in kiosk mode.
+func KioskFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(contextKeyKiosk).(bool)
+	return v
+}
+
+// WithGRPC marks the request as forwarded from the gRPC API.
+func WithGRPC(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyGRPC, true)
+}
+
+// GRPCFromContext returns true if the request was forwarded from the gRPC API.
+func GRPCFromContext(ctx context.Context) bool {
+	v, _ := ctx.Value(contextKeyGRPC).(bool)
+	return v
+}
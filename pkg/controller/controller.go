@@ -28,8 +28,12 @@ import (
 )
 
 var (
-	apiErrorUnauthorized = api.Errorf("unauthorized")
-	apiErrorMissingRealm = api.Errorf("missing realm")
+	apiErrorUnauthorized  = api.Errorf("unauthorized")
+	apiErrorMissingRealm  = api.Errorf("missing realm")
+	apiErrorTooLarge      = api.Errorf("request body too large").WithCode(api.ErrRequestTooLarge)
+	apiErrorKiosk         = api.Errorf("not available in kiosk mode")
+	apiErrorImpersonation = api.Errorf("not permitted while impersonating a user")
+	apiErrorCaptcha       = api.Errorf("captcha verification failed").WithCode(api.ErrCaptchaFailed)
 
 	errMissingAuthorizedApp = fmt.Errorf("authorized app missing in request context")
 	errMissingSession       = fmt.Errorf("session missing in request context")
@@ -69,6 +73,20 @@ func Back(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
 	http.Redirect(w, r, ref, http.StatusSeeOther)
 }
 
+// AbsoluteURL returns the absolute URL of the path on the host which received
+// the request, for links in emails. The scheme is https unless devMode is set.
+func AbsoluteURL(r *http.Request, path string, devMode bool) string {
+	u := &url.URL{
+		Scheme: "https",
+		Host:   r.Host,
+		Path:   path,
+	}
+	if devMode {
+		u.Scheme = "http"
+	}
+	return u.String()
+}
+
 // InternalError handles an internal error, returning the right response to the
 // client.
 func InternalError(w http.ResponseWriter, r *http.Request, h *render.Renderer, err error) {
@@ -120,6 +138,43 @@ func Unauthorized(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
 	}
 }
 
+// KioskRestricted returns an error indicating the requested page or action is
+// not available in kiosk mode. HTML requests are sent back to the issue page.
+func KioskRestricted(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
+	accept := strings.Split(r.Header.Get("Accept"), ",")
+	accept = append(accept, strings.Split(r.Header.Get("Content-Type"), ",")...)
+
+	switch {
+	case prefixInList(accept, ContentTypeHTML):
+		flash := Flash(SessionFromContext(r.Context()))
+		flash.Error("That page is not available in kiosk mode.")
+		http.Redirect(w, r, "/codes/issue", http.StatusSeeOther)
+	case prefixInList(accept, ContentTypeJSON):
+		h.RenderJSON(w, http.StatusForbidden, apiErrorKiosk)
+	default:
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	}
+}
+
+// ImpersonationRestricted returns an error indicating the requested action is
+// not permitted while impersonating a user. HTML requests are sent back to the
+// referring page.
+func ImpersonationRestricted(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
+	accept := strings.Split(r.Header.Get("Accept"), ",")
+	accept = append(accept, strings.Split(r.Header.Get("Content-Type"), ",")...)
+
+	switch {
+	case prefixInList(accept, ContentTypeHTML):
+		flash := Flash(SessionFromContext(r.Context()))
+		flash.Error("That action is not permitted while impersonating a user.")
+		Back(w, r, h)
+	case prefixInList(accept, ContentTypeJSON):
+		h.RenderJSON(w, http.StatusForbidden, apiErrorImpersonation)
+	default:
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	}
+}
+
 // MissingRealm returns an error indicating that the request requires a realm
 // selection, but one was not present.
 func MissingRealm(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
@@ -138,6 +193,40 @@ func MissingRealm(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
 	}
 }
 
+// RequestEntityTooLarge returns an error indicating the request body exceeds
+// the allowed size.
+func RequestEntityTooLarge(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
+	accept := strings.Split(r.Header.Get("Accept"), ",")
+	accept = append(accept, strings.Split(r.Header.Get("Content-Type"), ",")...)
+
+	switch {
+	case prefixInList(accept, ContentTypeHTML):
+		h.RenderHTMLStatus(w, http.StatusRequestEntityTooLarge, "400", nil)
+	case prefixInList(accept, ContentTypeJSON):
+		h.RenderJSON(w, http.StatusRequestEntityTooLarge, apiErrorTooLarge)
+	default:
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	}
+}
+
+// CaptchaFailed returns an error indicating the request did not have a valid
+// CAPTCHA token. HTML requests are sent back to the form.
+func CaptchaFailed(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
+	accept := strings.Split(r.Header.Get("Accept"), ",")
+	accept = append(accept, strings.Split(r.Header.Get("Content-Type"), ",")...)
+
+	switch {
+	case prefixInList(accept, ContentTypeHTML):
+		flash := Flash(SessionFromContext(r.Context()))
+		flash.Error("Please complete the verification challenge and try again.")
+		Back(w, r, h)
+	case prefixInList(accept, ContentTypeJSON):
+		h.RenderJSON(w, http.StatusForbidden, apiErrorCaptcha)
+	default:
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	}
+}
+
 // MissingAuthorizedApp returns an internal error when the authorized app does
 // not exist.
 func MissingAuthorizedApp(w http.ResponseWriter, r *http.Request, h *render.Renderer) {
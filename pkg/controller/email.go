@@ -178,3 +178,41 @@ func SendEmailVerificationEmailFunc(ctx context.Context, db *database.Database,
 		return nil
 	}, nil
 }
+
+// SendSystemEmail renders the email template and sends it to each recipient
+// using the system email config. The template data is given the ToEmail and
+// FromEmail of each message. If there is no system email config, no email is
+// sent.
+func SendSystemEmail(ctx context.Context, db *database.Database, h *render.Renderer, tmpl string, to []string, data map[string]interface{}) error {
+	emailConfig, err := db.SystemEmailConfig()
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get system email config: %w", err)
+	}
+
+	emailer, err := emailConfig.Provider()
+	if err != nil {
+		return fmt.Errorf("failed to create email provider: %w", err)
+	}
+
+	for _, email := range to {
+		vars := make(map[string]interface{}, len(data)+2)
+		for k, v := range data {
+			vars[k] = v
+		}
+		vars["ToEmail"] = email
+		vars["FromEmail"] = emailer.From()
+
+		message, err := h.RenderEmail(tmpl, vars)
+		if err != nil {
+			return fmt.Errorf("failed to render %s template: %w", tmpl, err)
+		}
+
+		if err := emailer.SendEmail(ctx, email, message); err != nil {
+			return fmt.Errorf("failed to send email: %w", err)
+		}
+	}
+	return nil
+}
@@ -22,8 +22,10 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 
+	"github.com/sethvargo/go-limiter"
 	"golang.org/x/time/rate"
 )
 
@@ -31,7 +33,7 @@ var (
 	rl = rate.NewLimiter(rate.Every(time.Minute), 1)
 )
 
-func HandleHealthz(ctx context.Context, cfg *database.Config, h *render.Renderer) http.Handler {
+func HandleHealthz(ctx context.Context, cfg *database.Config, limiterStore limiter.Store, h *render.Renderer) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
@@ -68,6 +70,17 @@ func HandleHealthz(ctx context.Context, cfg *database.Config, h *render.Renderer
 					return
 				}
 			}
+		case "ratelimit":
+			if limiterStore == nil {
+				InternalError(w, r, h, fmt.Errorf("rate limiter not configured for health check"))
+				return
+			}
+
+			if err := ratelimit.Ping(ctx, limiterStore); err != nil {
+				logger.Errorw("ping limiter store", "error", err)
+				InternalError(w, r, h, err)
+				return
+			}
 		case "alerts":
 			// TODO(ych): fire a metric and configure an alert
 		default:
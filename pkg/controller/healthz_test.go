@@ -0,0 +1,107 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+func TestHandleHealthz_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	h, err := render.New(ctx, envstest.ServerAssetsPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		service string
+		store   limiter.Store
+		expCode int
+	}{
+		{
+			name:    "basic",
+			service: "",
+			expCode: http.StatusOK,
+		},
+		{
+			name:    "not_configured",
+			service: "ratelimit",
+			expCode: http.StatusInternalServerError,
+		},
+		{
+			name:    "uninstrumented_store",
+			service: "ratelimit",
+			store:   &noopStore{},
+			expCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/healthz?service="+tc.service, nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+
+			controller.HandleHealthz(ctx, nil, tc.store, h).ServeHTTP(w, r)
+
+			if got, want := w.Code, tc.expCode; got != want {
+				t.Errorf("expected %d to be %d: %s", got, want, w.Body.String())
+			}
+		})
+	}
+}
+
+var _ limiter.Store = (*noopStore)(nil)
+
+// noopStore is a limiter.Store which allows everything.
+type noopStore struct{}
+
+func (s *noopStore) Take(_ context.Context, _ string) (uint64, uint64, uint64, bool, error) {
+	return 1, 1, 0, true, nil
+}
+
+func (s *noopStore) Get(_ context.Context, _ string) (uint64, uint64, error) {
+	return 1, 1, nil
+}
+
+func (s *noopStore) Set(_ context.Context, _ string, _ uint64, _ time.Duration) error {
+	return nil
+}
+
+func (s *noopStore) Burst(_ context.Context, _ string, _ uint64) error {
+	return nil
+}
+
+func (s *noopStore) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the IP address of the client which made the request.
+//
+// Each proxy in front of the server appends the address it received the request
+// from to x-forwarded-for, so entries to the left of those are supplied by the
+// client and cannot be trusted. trustedProxies is the number of entries the
+// proxies in front of the server append, and the client IP is that many entries
+// from the right. If trustedProxies is 0, x-forwarded-for is ignored. If the
+// header has fewer entries than trustedProxies, or the entry is not an IP
+// address, the request did not come through the proxies and the host of the
+// remote address is used.
+func ClientIP(r *http.Request, trustedProxies int) string {
+	if trustedProxies > 0 {
+		if xff := r.Header.Get("x-forwarded-for"); xff != "" {
+			entries := strings.Split(xff, ",")
+
+			if idx := len(entries) - trustedProxies; idx >= 0 {
+				if ip := strings.TrimSpace(entries[idx]); net.ParseIP(ip) != nil {
+					return ip
+				}
+			}
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		remoteAddr     string
+		xff            string
+		trustedProxies int
+		exp            string
+	}{
+		{
+			name:       "remote_addr",
+			remoteAddr: "203.0.113.5:4321",
+			exp:        "203.0.113.5",
+		},
+		{
+			name:       "remote_addr_ipv6",
+			remoteAddr: "[2001:db8::1]:4321",
+			exp:        "2001:db8::1",
+		},
+		{
+			name:       "remote_addr_no_port",
+			remoteAddr: "203.0.113.5",
+			exp:        "203.0.113.5",
+		},
+		{
+			name:       "forwarded_no_proxies",
+			remoteAddr: "203.0.113.5:4321",
+			xff:        "198.51.100.7",
+			exp:        "203.0.113.5",
+		},
+		{
+			name:       "forwarded_spoofed_no_proxies",
+			remoteAddr: "203.0.113.5:4321",
+			xff:        "192.0.2.1, 198.51.100.7",
+			exp:        "203.0.113.5",
+		},
+		{
+			name:           "forwarded_one_proxy",
+			remoteAddr:     "10.0.0.1:4321",
+			xff:            "198.51.100.7",
+			trustedProxies: 1,
+			exp:            "198.51.100.7",
+		},
+		{
+			name:           "forwarded_spoofed_one_proxy",
+			remoteAddr:     "10.0.0.1:4321",
+			xff:            "192.0.2.1, 198.51.100.7",
+			trustedProxies: 1,
+			exp:            "198.51.100.7",
+		},
+		{
+			name:           "forwarded_two_proxies",
+			remoteAddr:     "10.0.0.1:4321",
+			xff:            "198.51.100.7, 10.0.0.2",
+			trustedProxies: 2,
+			exp:            "198.51.100.7",
+		},
+		{
+			name:           "forwarded_spoofed_two_proxies",
+			remoteAddr:     "10.0.0.1:4321",
+			xff:            "192.0.2.1, 198.51.100.7, 10.0.0.2",
+			trustedProxies: 2,
+			exp:            "198.51.100.7",
+		},
+		{
+			name:           "forwarded_fewer_entries_than_proxies",
+			remoteAddr:     "203.0.113.5:4321",
+			xff:            "198.51.100.7",
+			trustedProxies: 2,
+			exp:            "203.0.113.5",
+		},
+		{
+			name:           "forwarded_spoofed_fewer_entries_than_proxies",
+			remoteAddr:     "203.0.113.5:4321",
+			xff:            "192.0.2.1, 198.51.100.7",
+			trustedProxies: 3,
+			exp:            "203.0.113.5",
+		},
+		{
+			name:           "forwarded_empty_entry",
+			remoteAddr:     "203.0.113.5:4321",
+			xff:            "198.51.100.7, ",
+			trustedProxies: 1,
+			exp:            "203.0.113.5",
+		},
+		{
+			name:           "forwarded_invalid_entry",
+			remoteAddr:     "203.0.113.5:4321",
+			xff:            "not-an-ip, 10.0.0.2",
+			trustedProxies: 2,
+			exp:            "203.0.113.5",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest("POST", "/api/issue", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				r.Header.Set("X-Forwarded-For", tc.xff)
+			}
+
+			if got, want := ClientIP(r, tc.trustedProxies), tc.exp; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
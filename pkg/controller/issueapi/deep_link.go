@@ -0,0 +1,80 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/jwthelper"
+)
+
+// deepLinkPayload is the signed payload embedded in a deep link. The code is
+// included so the metadata cannot be moved to a link for a different code.
+type deepLinkPayload struct {
+	Code     string                `json:"c"`
+	Metadata database.CodeMetadata `json:"m"`
+}
+
+// buildDeepLink returns the realm's deep link for the long code. If the realm
+// embeds metadata in deep links and the code has any of those keys, they are
+// added along with a signature. If signing fails, the link without metadata is
+// returned with the error.
+func (c *Controller) buildDeepLink(ctx context.Context, realm *database.Realm, longCode string, metadata database.CodeMetadata) (string, error) {
+	link := realm.ENExpressLink(longCode, c.config.GetENXRedirectDomain())
+
+	selected := realm.DeepLinkMetadata(metadata)
+	if len(selected) == 0 {
+		return link, nil
+	}
+
+	payload, err := json.Marshal(&deepLinkPayload{
+		Code:     longCode,
+		Metadata: selected,
+	})
+	if err != nil {
+		return link, fmt.Errorf("failed to marshal deep link payload: %w", err)
+	}
+
+	signingKey, err := realm.GetCurrentSigningKey(c.db)
+	if err != nil {
+		return link, fmt.Errorf("failed to find current signing key: %w", err)
+	}
+	if signingKey == nil {
+		return link, fmt.Errorf("realm has no active signing key")
+	}
+	signer, err := c.db.KeyManager().NewSigner(ctx, signingKey.KeyID)
+	if err != nil {
+		return link, fmt.Errorf("failed to get signer: %w", err)
+	}
+	signature, err := jwthelper.SignDetached(payload, signingKey.GetKID(), signer)
+	if err != nil {
+		return link, fmt.Errorf("failed to sign deep link payload: %w", err)
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return link, fmt.Errorf("failed to parse deep link: %w", err)
+	}
+	q := u.Query()
+	q.Set("m", base64.RawURLEncoding.EncodeToString(payload))
+	q.Set("s", signature)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"context"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"go.opencensus.io/tag"
+)
+
+// recordIssuanceFailure saves a failed attempt to issue a code so realm admins
+// can find misbehaving integrations. Only the reason and the requesting API key
+// or user are kept. Recording is best effort and never fails the request.
+func (c *Controller) recordIssuanceFailure(ctx context.Context, result *issueResult) {
+	realm := controller.RealmFromContext(ctx)
+	if realm == nil {
+		return
+	}
+
+	var source string
+	if authApp := controller.AuthorizedAppFromContext(ctx); authApp != nil {
+		source = authApp.AuditID()
+	} else if user := controller.UserFromContext(ctx); user != nil {
+		source = user.AuditID()
+	}
+
+	failure := &database.IssuanceFailure{
+		RealmID:  realm.ID,
+		Source:   source,
+		Reason:   resultReason(result),
+		HTTPCode: result.httpCode,
+	}
+	if result.errorReturn != nil {
+		failure.ErrorCode = result.errorReturn.ErrorCode
+	}
+
+	if err := c.db.RecordIssuanceFailure(failure); err != nil {
+		logging.FromContext(ctx).Named("issueapi.recordIssuanceFailure").
+			Errorw("failed to record issuance failure", "error", err)
+	}
+}
+
+// resultReason returns the result which is recorded in metrics for the issue
+// result, such as "QUOTA_EXCEEDED".
+func resultReason(result *issueResult) string {
+	if result.obsResult == nil {
+		return "UNKNOWN"
+	}
+
+	ctx, err := tag.New(context.Background(), result.obsResult)
+	if err != nil {
+		return "UNKNOWN"
+	}
+	if v, ok := tag.FromContext(ctx).Value(observability.ResultTagKey); ok {
+		return v
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+)
+
+func TestResultReason(t *testing.T) {
+	t.Parallel()
+
+	result := &issueResult{obsResult: observability.ResultError("QUOTA_EXCEEDED")}
+	if got, want := resultReason(result), "QUOTA_EXCEEDED"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if got, want := resultReason(&issueResult{}), "UNKNOWN"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
@@ -66,6 +66,13 @@ func (c *Controller) HandleIssue() http.Handler {
 			return
 		}
 
+		if ipResult := checkIssueIP(r, realm, c.config.GetTrustedProxies()); ipResult != nil {
+			*result = *ipResult
+			c.recordIssuanceFailure(ctx, result)
+			c.h.RenderJSON(w, result.httpCode, result.errorReturn)
+			return
+		}
+
 		// Add realm so that metrics are groupable on a per-realm basis.
 		result, resp := c.issue(ctx, &request)
 		if result.errorReturn != nil {
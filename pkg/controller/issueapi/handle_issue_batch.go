@@ -64,6 +64,13 @@ func (c *Controller) HandleBatchIssue() http.Handler {
 			return
 		}
 
+		if ipResult := checkIssueIP(r, realm, c.config.GetTrustedProxies()); ipResult != nil {
+			*result = *ipResult
+			c.recordIssuanceFailure(ctx, result)
+			c.h.RenderJSON(w, result.httpCode, result.errorReturn)
+			return
+		}
+
 		// Add realm so that metrics are groupable on a per-realm basis.
 		if !realm.AllowBulkUpload {
 			controller.Unauthorized(w, r, c.h)
@@ -0,0 +1,176 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+)
+
+// maxSheetSize is the maximum number of codes that can be issued onto a single
+// printable sheet.
+const maxSheetSize = 6 * codesPerSheetPage
+
+// HandleIssueSheet issues a number of codes and returns them as a printable
+// PDF. Codes are issued through the same path as single and batch issue, so
+// all realm limits apply to each code.
+func (c *Controller) HandleIssueSheet() http.Handler {
+	type FormData struct {
+		Count       uint    `form:"count"`
+		TestType    string  `form:"testType"`
+		SymptomDate string  `form:"symptomDate"`
+		TestDate    string  `form:"testDate"`
+		TZOffset    float32 `form:"tzOffset"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("issueapi.HandleIssueSheet")
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		if !realm.AllowBulkUpload {
+			controller.Unauthorized(w, r, c.h)
+			return
+		}
+
+		if c.config.IsMaintenanceMode() {
+			flash.Error("The server is read-only for maintenance.")
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		result := &issueResult{
+			httpCode:  http.StatusOK,
+			obsBlame:  observability.BlameNone,
+			obsResult: observability.ResultOK(),
+		}
+		ctx = observability.WithRealmID(observability.WithBuildInfo(ctx), realm.ID)
+		defer recordObservability(ctx, result)
+
+		if ipResult := checkIssueIP(r, realm, c.config.GetTrustedProxies()); ipResult != nil {
+			*result = *ipResult
+			c.recordIssuanceFailure(ctx, result)
+			flash.Error("This realm does not allow issuing codes from your IP address.")
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			result.obsBlame = observability.BlameClient
+			result.obsResult = observability.ResultError("FAILED_TO_PARSE_FORM")
+			flash.Error("Failed to process form: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		if form.Count == 0 || form.Count > maxSheetSize {
+			result.obsBlame = observability.BlameClient
+			result.obsResult = observability.ResultError("BATCH_SIZE_LIMIT_EXCEEDED")
+			flash.Error("Number of codes must be between 1 and %d.", maxSheetSize)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		// Check that the deep links fit in a QR code before issuing codes which
+		// could not be printed.
+		if err := checkSheetQRCode(realm, c.config.GetENXRedirectDomain()); err != nil {
+			result.obsBlame = observability.BlameClient
+			result.obsResult = observability.ResultError("QR_CODE_TOO_LONG")
+			flash.Error("This realm's deep links are too long to print as QR codes: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		sheet := &codeSheet{
+			realm:     realm,
+			enxDomain: c.config.GetENXRedirectDomain(),
+			testType:  strings.ToLower(form.TestType),
+			codes:     make([]*api.IssueCodeResponse, 0, form.Count),
+		}
+
+		for i := uint(0); i < form.Count; i++ {
+			res, resp := c.issue(ctx, &api.IssueCodeRequest{
+				TestType:    form.TestType,
+				SymptomDate: form.SymptomDate,
+				TestDate:    form.TestDate,
+				TZOffset:    form.TZOffset,
+			})
+			*result = *res
+			if result.errorReturn == nil {
+				sheet.codes = append(sheet.codes, resp)
+				continue
+			}
+
+			// If nothing was issued, there is no sheet to print.
+			if len(sheet.codes) == 0 {
+				if result.httpCode == http.StatusInternalServerError {
+					controller.InternalError(w, r, c.h, errors.New(result.errorReturn.Error))
+					return
+				}
+				flash.Error("Failed to issue codes: %s", result.errorReturn.Error)
+				controller.Back(w, r, c.h)
+				return
+			}
+
+			// Codes that were already issued are still valid, so print them rather
+			// than dropping them.
+			logger.Warnw("code sheet issuance stopped early",
+				"issued", len(sheet.codes),
+				"requested", form.Count,
+				"error", result.errorReturn.Error)
+			sheet.note = fmt.Sprintf("Only %d of %d requested codes were issued: %s",
+				len(sheet.codes), form.Count, result.errorReturn.Error)
+			result.httpCode = http.StatusOK
+			break
+		}
+
+		var b bytes.Buffer
+		if err := sheet.render(&b); err != nil {
+			logger.Errorw("failed to render code sheet", "error", err)
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		filename := fmt.Sprintf("verification-codes-%s.pdf", time.Now().In(realm.Location()).Format("20060102-150405"))
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		if _, err := b.WriteTo(w); err != nil {
+			logger.Errorw("failed to write code sheet", "error", err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+)
+
+// checkIssueIP returns a failed result if the realm restricts issuing codes to
+// CIDR blocks which do not include the client's IP. It returns nil if the code
+// may be issued.
+func checkIssueIP(r *http.Request, realm *database.Realm, trustedProxies int) *issueResult {
+	ip := controller.ClientIP(r, trustedProxies)
+	if realm.CanIssueFromIP(ip) {
+		return nil
+	}
+
+	logger := logging.FromContext(r.Context()).Named("issueapi.checkIssueIP")
+	logger.Warnw("rejected issuing code from ip outside of allowed cidrs",
+		"realm", realm.ID,
+		"ip", ip)
+
+	return &issueResult{
+		obsBlame:    observability.BlameClient,
+		obsResult:   observability.ResultError("ISSUE_IP_NOT_ALLOWED"),
+		httpCode:    http.StatusForbidden,
+		errorReturn: api.Errorf("realm does not allow issuing codes from this IP address").WithCode(api.ErrIssueIPNotAllowed),
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestCheckIssueIP(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		cidrs          []string
+		remoteAddr     string
+		xff            string
+		trustedProxies int
+		allowed        bool
+	}{
+		{
+			name:       "no_cidrs",
+			remoteAddr: "203.0.113.5:4321",
+			allowed:    true,
+		},
+		{
+			name:       "remote_addr_allowed",
+			cidrs:      []string{"203.0.113.0/24"},
+			remoteAddr: "203.0.113.5:4321",
+			allowed:    true,
+		},
+		{
+			name:       "remote_addr_denied",
+			cidrs:      []string{"198.51.100.0/24"},
+			remoteAddr: "203.0.113.5:4321",
+			allowed:    false,
+		},
+		{
+			name:           "forwarded_allowed",
+			cidrs:          []string{"198.51.100.0/24"},
+			remoteAddr:     "10.0.0.1:4321",
+			xff:            "198.51.100.7, 10.0.0.2",
+			trustedProxies: 2,
+			allowed:        true,
+		},
+		{
+			name:           "forwarded_spoofed",
+			cidrs:          []string{"198.51.100.0/24"},
+			remoteAddr:     "10.0.0.1:4321",
+			xff:            "198.51.100.7, 203.0.113.5, 10.0.0.2",
+			trustedProxies: 2,
+			allowed:        false,
+		},
+		{
+			name:       "forwarded_spoofed_no_proxies",
+			cidrs:      []string{"198.51.100.0/24"},
+			remoteAddr: "203.0.113.5:4321",
+			xff:        "198.51.100.7",
+			allowed:    false,
+		},
+		{
+			name:           "forwarded_spoofed_fewer_entries_than_proxies",
+			cidrs:          []string{"198.51.100.0/24"},
+			remoteAddr:     "203.0.113.5:4321",
+			xff:            "198.51.100.7",
+			trustedProxies: 2,
+			allowed:        false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := database.NewRealmWithDefaults("test")
+			realm.AllowedCIDRsIssue = tc.cidrs
+
+			r := httptest.NewRequest("POST", "/api/issue", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				r.Header.Set("X-Forwarded-For", tc.xff)
+			}
+
+			result := checkIssueIP(r, realm, tc.trustedProxies)
+			if got, want := result == nil, tc.allowed; got != want {
+				t.Fatalf("expected allowed to be %t", want)
+			}
+			if result != nil {
+				if got, want := result.httpCode, http.StatusForbidden; got != want {
+					t.Errorf("expected %d to be %d", got, want)
+				}
+			}
+		})
+	}
+}
@@ -15,8 +15,12 @@
 package issueapi
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
 )
 
 func TestDateValidation(t *testing.T) {
@@ -66,3 +70,140 @@ func TestDateValidation(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		input     string
+		tzOffset  int
+		expected  string
+		shouldErr bool
+	}{
+		{name: "date", input: "2020-08-15", expected: "2020-08-15"},
+		{name: "rfc3339_utc", input: "2020-08-15T23:30:00Z", expected: "2020-08-15"},
+		{name: "rfc3339_offset", input: "2020-08-15T23:30:00-07:00", expected: "2020-08-15"},
+		{name: "epoch_utc", input: "1597534200", expected: "2020-08-15"},
+		{name: "epoch_behind", input: "1597534200", tzOffset: -60, expected: "2020-08-15"},
+		{name: "epoch_ahead", input: "1597534200", tzOffset: 60, expected: "2020-08-16"},
+		{name: "epoch_negative", input: "-1", shouldErr: true},
+		{name: "epoch_millis", input: "1597534200000", shouldErr: true},
+		{name: "garbage", input: "08/15/2020", shouldErr: true},
+		{name: "empty", input: "", shouldErr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseDate(tc.input, tc.tzOffset)
+			if tc.shouldErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := got.Format("2006-01-02"); s != tc.expected {
+				t.Errorf("expected %q to be %q", s, tc.expected)
+			}
+			if got.Location() != time.UTC || got.Hour() != 0 {
+				t.Errorf("expected %v to be midnight UTC", got)
+			}
+		})
+	}
+}
+
+func TestLongCodeOptions(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 8, 15, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		disable   bool
+		send      bool
+		expLength uint
+		expExpiry time.Time
+	}{
+		{
+			name:      "sent",
+			send:      true,
+			expLength: 16,
+			expExpiry: now.Add(24 * time.Hour),
+		},
+		{
+			name:      "not_sent",
+			expLength: 16,
+			expExpiry: now.Add(15 * time.Minute),
+		},
+		{
+			name:      "disabled_sent",
+			disable:   true,
+			send:      true,
+			expLength: 0,
+			expExpiry: now.Add(15 * time.Minute),
+		},
+		{
+			name:      "disabled_not_sent",
+			disable:   true,
+			expLength: 0,
+			expExpiry: now.Add(15 * time.Minute),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := &database.Realm{
+				CodeDuration:     database.FromDuration(15 * time.Minute),
+				LongCodeLength:   16,
+				LongCodeDuration: database.FromDuration(24 * time.Hour),
+				DisableLongCodes: tc.disable,
+			}
+
+			length, expiry := longCodeOptions(realm, now, tc.send)
+			if got, want := length, tc.expLength; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := expiry, tc.expExpiry; !got.Equal(want) {
+				t.Errorf("expected %s to be %s", got, want)
+			}
+		})
+	}
+}
+
+func TestController_addLongCodeLinks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	// Without long codes the long code is the short code, so no links are
+	// built. The controller has no database, so this would panic if it tried.
+	c := &Controller{}
+	realm := &database.Realm{DisableLongCodes: true}
+	resp := &api.IssueCodeResponse{VerificationCode: "12345678"}
+
+	c.addLongCodeLinks(ctx, realm, resp, "12345678", nil, now, now.Add(time.Hour))
+	if got := resp.DeepLink; got != "" {
+		t.Errorf("expected deep link %q to be empty", got)
+	}
+	if got := resp.ClaimLink; got != "" {
+		t.Errorf("expected claim link %q to be empty", got)
+	}
+	if got := resp.ClaimToken; got != "" {
+		t.Errorf("expected claim token %q to be empty", got)
+	}
+	if got := resp.LongExpiresAtTimestamp; got != 0 {
+		t.Errorf("expected long expiry %d to be 0", got)
+	}
+}
@@ -16,8 +16,11 @@ package issueapi
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -27,17 +30,42 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/email"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
 	"github.com/google/exposure-notifications-verification-server/pkg/otp"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/sms"
 	"go.opencensus.io/stats"
 )
 
+// issue issues a code for the request. Failed attempts are recorded for the
+// realm.
 func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (*issueResult, *api.IssueCodeResponse) {
+	result, resp := c.issueCode(ctx, request)
+	if result.errorReturn != nil {
+		c.recordIssuanceFailure(ctx, result)
+	}
+	return result, resp
+}
+
+func (c *Controller) issueCode(ctx context.Context, request *api.IssueCodeRequest) (*issueResult, *api.IssueCodeResponse) {
 	logger := logging.FromContext(ctx).Named("issueapi.issue")
 	realm := controller.RealmFromContext(ctx)
 	var err error
 
+	// Reject codes during the realm's quiet hours, unless a realm admin is
+	// issuing them.
+	if window := realm.ActiveQuietHours(time.Now()); window != nil {
+		if user := controller.UserFromContext(ctx); user == nil || !user.CanAdminRealm(realm.ID) {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("QUIET_HOURS"),
+				httpCode:    http.StatusForbidden,
+				errorReturn: api.Errorf("codes cannot be issued during the realm's quiet hours (%s %s)", window, realm.Location()).WithCode(api.ErrQuietHours),
+			}, nil
+		}
+	}
+
 	// If this realm requires a date but no date was specified, return an error.
 	if realm.RequireDate && request.SymptomDate == "" && request.TestDate == "" {
 		return &issueResult{
@@ -58,6 +86,17 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		}, nil
 	}
 
+	// Test types past their sunset are rejected even if they are still allowed.
+	if realm.TestTypeSunsetPassed(request.TestType, time.Now()) {
+		sunset := realm.TestTypeSunset(request.TestType).In(realm.Location()).Format("2006-01-02 15:04 MST")
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("TEST_TYPE_SUNSET"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("test type %v is no longer accepted as of %s", request.TestType, sunset).WithCode(api.ErrUnsupportedTestType),
+		}, nil
+	}
+
 	// Verify the test type
 	request.TestType = strings.ToLower(request.TestType)
 	if _, ok := c.validTestType[request.TestType]; !ok {
@@ -69,6 +108,104 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		}, nil
 	}
 
+	if !database.ValidCohortID(request.CohortID) {
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("INVALID_COHORT_ID"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("cohort ID must be 1-64 letters, digits, dots, colons, underscores, or dashes").WithCode(api.ErrInvalidCohortID),
+		}, nil
+	}
+
+	limits := c.config.GetIssueLimits()
+	if max := realm.ExternalIDLengthLimit(limits.MaxExternalIDLength); uint(len(request.ExternalIssuerID)) > max {
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("INVALID_EXTERNAL_ID"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("external issuer ID cannot exceed %d characters", max).WithCode(api.ErrInvalidExternalID),
+		}, nil
+	}
+
+	if realm.RequireExternalID {
+		if request.ExternalIssuerID == "" {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("MISSING_EXTERNAL_ID"),
+				httpCode:    http.StatusBadRequest,
+				errorReturn: api.Errorf("realm requires an external issuer ID for every code").WithCode(api.ErrMissingExternalID),
+			}, nil
+		}
+		if !realm.ExternalIDMatchesFormat(request.ExternalIssuerID) {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("INVALID_EXTERNAL_ID"),
+				httpCode:    http.StatusBadRequest,
+				errorReturn: api.Errorf("external issuer ID does not match the realm's format").WithCode(api.ErrInvalidExternalID),
+			}, nil
+		}
+	}
+
+	metadata := database.CodeMetadata(request.Metadata)
+	maxKeys, maxSize := realm.MetadataLimits(limits.MaxMetadataKeys, limits.MaxMetadataBytes)
+	if problems := metadata.ValidateWithLimits(maxKeys, maxSize); len(problems) > 0 {
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("INVALID_METADATA"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("invalid metadata: %s", strings.Join(problems, ", ")).WithCode(api.ErrInvalidMetadata),
+		}, nil
+	}
+	if b, err := json.Marshal(realm.DeepLinkMetadata(metadata)); err == nil && len(b) > database.MaxDeepLinkMetadataSize {
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("INVALID_METADATA"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("invalid metadata: metadata embedded in the deep link cannot exceed %d bytes", database.MaxDeepLinkMetadataSize).WithCode(api.ErrInvalidMetadata),
+		}, nil
+	}
+
+	// Codes are single-use unless the realm allows more claims.
+	maxClaims := request.MaxClaims
+	if maxClaims == 0 {
+		maxClaims = 1
+	}
+	if maxClaims > 1 && maxClaims > realm.MaxClaimsPerCode {
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("INVALID_MAX_CLAIMS"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("maxClaims must be between 1 and %d", realm.MaxClaimsPerCode).WithCode(api.ErrInvalidMaxClaims),
+		}, nil
+	}
+
+	// Verify the supervising user, if one was provided, is someone else in the
+	// realm.
+	var supervisingUser *database.User
+	if email := project.TrimSpace(request.SupervisingUserEmail); email != "" {
+		supervisingUser, err = c.db.FindUserByEmail(email)
+		if err != nil && !database.IsNotFound(err) {
+			logger.Errorw("failed to find supervising user", "error", err)
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_FIND_SUPERVISING_USER"),
+				httpCode:    http.StatusInternalServerError,
+				errorReturn: api.Errorf("failed to find supervising user, please try again"),
+			}, nil
+		}
+
+		issuingUser := controller.UserFromContext(ctx)
+		if supervisingUser == nil || !supervisingUser.CanViewRealm(realm.ID) ||
+			(issuingUser != nil && issuingUser.ID == supervisingUser.ID) {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("INVALID_SUPERVISING_USER"),
+				httpCode:    http.StatusBadRequest,
+				errorReturn: api.Errorf("supervising user must be another member of the realm").WithCode(api.ErrInvalidSupervisingUser),
+			}, nil
+		}
+	}
+
 	// Verify SMS configuration if phone was provided
 	var smsProvider sms.Provider
 	if request.Phone != "" {
@@ -93,6 +230,47 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		}
 	}
 
+	// Verify the email address and configuration if an email was provided. The
+	// address is not logged or stored.
+	var emailProvider email.Provider
+	request.Email = strings.TrimSpace(request.Email)
+	if request.Email != "" {
+		if !realm.EnableEmailCodes {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("EMAIL_CODES_DISABLED"),
+				httpCode:    http.StatusBadRequest,
+				errorReturn: api.Errorf("this realm does not send codes by email").WithCode(api.ErrInvalidEmail),
+			}, nil
+		}
+		if err := email.ValidateAddress(request.Email); err != nil {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("INVALID_EMAIL"),
+				httpCode:    http.StatusBadRequest,
+				errorReturn: api.Error(err).WithCode(api.ErrInvalidEmail),
+			}, nil
+		}
+		emailProvider, err = realm.EmailProvider(c.db)
+		if err != nil && !database.IsNotFound(err) {
+			logger.Errorw("failed to get email provider", "error", err)
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_GET_EMAIL_PROVIDER"),
+				httpCode:    http.StatusInternalServerError,
+				errorReturn: api.Errorf("failed to get email provider"),
+			}, nil
+		}
+		if emailProvider == nil {
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_GET_EMAIL_PROVIDER"),
+				httpCode:    http.StatusBadRequest,
+				errorReturn: api.Errorf("email provided, but no email provider is configured"),
+			}, nil
+		}
+	}
+
 	// Set up parallel arrays to leverage the observability reporting and connect the parse / validation errors
 	// to the correct date.
 	parsedDates := make([]*time.Time, 2)
@@ -100,23 +278,25 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 	dateSettings := []*dateParseSettings{&onsetSettings, &testSettings}
 	for i, d := range input {
 		if d != "" {
-			parsed, err := time.Parse("2006-01-02", d)
+			parsed, err := parseDate(d, int(request.TZOffset))
 			if err != nil {
 				return &issueResult{
 					obsBlame:    observability.BlameClient,
 					obsResult:   observability.ResultError(dateSettings[i].ParseError),
 					httpCode:    http.StatusBadRequest,
-					errorReturn: api.Errorf("failed to process %s date: %v", dateSettings[i].Name, err).WithCode(api.ErrUnparsableRequest),
+					errorReturn: api.Errorf("failed to process %s date (%s): %v", dateSettings[i].Name, dateSettings[i].Field, err).WithCode(api.ErrUnparsableRequest),
 				}, nil
 			}
-			// Max date is today (UTC time) and min date is AllowedTestAge ago, truncated.
-			maxDate := timeutils.UTCMidnight(time.Now())
+			// Max date is today (UTC time), allowing for the realm's tolerance of
+			// clock skew, and min date is AllowedTestAge ago, truncated.
+			maxDate := realm.MaxIssueDate(time.Now())
 			minDate := timeutils.Midnight(maxDate.Add(-1 * c.config.GetAllowedSymptomAge()))
 
 			validatedDate, err := validateDate(parsed, minDate, maxDate, int(request.TZOffset))
 			if err != nil {
-				err := fmt.Errorf("%s date must be on/after %v and on/before %v %v",
+				err := fmt.Errorf("%s date (%s) must be on/after %v and on/before %v %v",
 					dateSettings[i].Name,
+					dateSettings[i].Field,
 					minDate.Format("2006-01-02"),
 					maxDate.Format("2006-01-02"),
 					parsed.Format("2006-01-02"),
@@ -132,6 +312,30 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		}
 	}
 
+	// If the realm autofills dates, the test must have been taken on or after
+	// symptom onset.
+	if realm.AutofillDateOrderViolated(parsedDates[0], parsedDates[1]) {
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("TEST_DATE_BEFORE_SYMPTOM_DATE"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: api.Errorf("test date must be on or after symptom date"),
+		}, nil
+	}
+
+	if realm.DateOrderViolated(parsedDates[0], parsedDates[1]) {
+		errorReturn := api.Errorf("test date must be on or after symptom date")
+		if days := realm.MaxTestBeforeSymptomDays; days > 0 {
+			errorReturn = api.Errorf("test date must be no more than %d days before symptom date", days)
+		}
+		return &issueResult{
+			obsBlame:    observability.BlameClient,
+			obsResult:   observability.ResultError("TEST_DATE_TOO_EARLY"),
+			httpCode:    http.StatusBadRequest,
+			errorReturn: errorReturn,
+		}, nil
+	}
+
 	// If there is a client-provided UUID, check if a code has already been issued.
 	// this prevents us from consuming quota on conflict.
 	rUUID := project.TrimSpaceAndNonPrintable(request.UUID)
@@ -155,63 +359,187 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		}
 	}
 
-	// If we got this far, we're about to issue a code - take from the limiter
-	// to ensure this is permitted.
-	if realm.AbusePreventionEnabled {
-		key, err := realm.QuotaKey(c.config.GetRateLimitConfig().HMACKey)
+	// If the realm rejects duplicate external IDs, check if a code was recently
+	// issued for this external ID. Like the UUID check, this happens before
+	// consuming quota.
+	if realm.RejectDuplicateExternalID && request.ExternalIssuerID != "" {
+		exists, err := realm.HasRecentCodeForExternalID(c.db, request.ExternalIssuerID)
 		if err != nil {
+			logger.Errorw("failed to check external id", "error", err)
 			return &issueResult{
 				obsBlame:    observability.BlameServer,
-				obsResult:   observability.ResultError("FAILED_TO_GENERATE_HMAC"),
+				obsResult:   observability.ResultError("FAILED_TO_CHECK_EXTERNAL_ID"),
 				httpCode:    http.StatusInternalServerError,
 				errorReturn: api.Error(err),
 			}, nil
 		}
-		limit, _, reset, ok, err := c.limiter.Take(ctx, key)
+		if exists {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("EXTERNAL_ID_CONFLICT"),
+				httpCode:    http.StatusConflict,
+				errorReturn: api.Errorf("code for external issuer ID %s was issued within the last %s", request.ExternalIssuerID, realm.DuplicateExternalIDWindow.Duration).WithCode(api.ErrExternalIDAlreadyExists),
+			}, nil
+		}
+	}
+
+	// If the realm limits the number of codes per external ID, make sure this
+	// external ID has not reached the limit.
+	if realm.MaxCodesPerExternalID > 0 && request.ExternalIssuerID != "" {
+		count, err := realm.CountCodesForExternalID(c.db, request.ExternalIssuerID)
 		if err != nil {
-			logger.Errorw("failed to take from limiter", "error", err)
+			logger.Errorw("failed to count codes for external id", "error", err)
 			return &issueResult{
 				obsBlame:    observability.BlameServer,
-				obsResult:   observability.ResultError("FAILED_TO_TAKE_FROM_LIMITER"),
+				obsResult:   observability.ResultError("FAILED_TO_COUNT_EXTERNAL_ID"),
 				httpCode:    http.StatusInternalServerError,
-				errorReturn: api.Errorf("failed to verify realm stats, please try again"),
+				errorReturn: api.Error(err),
 			}, nil
 		}
+		if count >= realm.MaxCodesPerExternalID {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("EXTERNAL_ID_LIMIT_EXCEEDED"),
+				httpCode:    http.StatusConflict,
+				errorReturn: api.Errorf("external issuer ID %s has reached the limit of %d codes", request.ExternalIssuerID, realm.MaxCodesPerExternalID).WithCode(api.ErrExternalIDLimitExceeded),
+			}, nil
+		}
+	}
 
-		stats.Record(ctx, mRealmTokenUsed.M(1))
-
-		if !ok {
-			logger.Warnw("realm has exceeded daily quota",
+	// If the realm caps the number of outstanding codes, make sure it is not at
+	// capacity.
+	if realm.MaxActiveCodes > 0 {
+		count, err := realm.CountActiveCodes(c.db)
+		if err != nil {
+			logger.Errorw("failed to count active codes", "error", err)
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_COUNT_ACTIVE_CODES"),
+				httpCode:    http.StatusInternalServerError,
+				errorReturn: api.Error(err),
+			}, nil
+		}
+		if count >= realm.MaxActiveCodes {
+			logger.Warnw("realm has reached active code limit",
 				"realm", realm.ID,
-				"limit", limit,
-				"reset", reset)
+				"limit", realm.MaxActiveCodes)
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("ACTIVE_CODE_LIMIT_EXCEEDED"),
+				httpCode:    http.StatusTooManyRequests,
+				errorReturn: api.Errorf("realm has reached the limit of %d active codes, please try again later", realm.MaxActiveCodes).WithCode(api.ErrActiveCodeLimitExceeded),
+			}, nil
+		}
+	}
+
+	// Realms with a monthly code quota stop issuing once it is used, until the
+	// month ends or the quota is raised. Codes already issued can be claimed.
+	if realm.MonthlyCodeQuota > 0 {
+		now := time.Now().UTC()
+		exhausted, err := realm.MonthlyQuotaExhausted(c.db, now)
+		if err != nil {
+			logger.Errorw("failed to count monthly codes", "error", err)
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_COUNT_MONTHLY_CODES"),
+				httpCode:    http.StatusInternalServerError,
+				errorReturn: api.Error(err),
+			}, nil
+		}
+		if exhausted {
+			if !realm.IssuanceDisabledByQuota(now) {
+				logger.Warnw("realm has used its monthly quota",
+					"realm", realm.ID,
+					"quota", realm.MonthlyCodeQuota)
+				if err := c.db.DisableRealmIssuanceForQuota(realm, now); err != nil {
+					logger.Errorw("failed to disable realm issuance", "error", err)
+				}
+			}
+
+			_, monthEnd := database.QuotaMonth(now)
+			return &issueResult{
+				obsBlame:  observability.BlameClient,
+				obsResult: observability.ResultError("MONTHLY_QUOTA_EXCEEDED"),
+				httpCode:  http.StatusTooManyRequests,
+				errorReturn: api.Errorf("realm has used its monthly quota of %d codes, issuing resumes on %s, please contact the realm admin",
+					realm.MonthlyCodeQuota, monthEnd.Format("2006-01-02")).WithCode(api.ErrMonthlyQuotaExceeded),
+			}, nil
+		}
+	}
+
+	// If we got this far, we're about to issue a code - take from the limiter
+	// to ensure this is permitted. The remaining quota is returned to the
+	// issuer.
+	var quotaRemaining *uint64
+	var quotaResetsAt time.Time
+	if realm.AbusePreventionEnabled {
+		remaining, resetsAt, ok, result := c.takeDailyQuota(ctx, realm, time.Now())
+		if result != nil {
+			return result, nil
+		}
+		quotaRemaining, quotaResetsAt = &remaining, resetsAt
 
-			if c.config.GetEnforceRealmQuotas() {
+		if !ok && c.config.GetEnforceRealmQuotas() {
+			return &issueResult{
+				obsBlame:    observability.BlameClient,
+				obsResult:   observability.ResultError("QUOTA_EXCEEDED"),
+				httpCode:    http.StatusTooManyRequests,
+				errorReturn: api.Errorf("exceeded realm quota, please contact the realm admin.").WithCode(api.ErrQuotaExceeded),
+			}, nil
+		}
+	}
+
+	// Enforce the realm's own issuance rate limits. Unlike the abuse prevention
+	// quota, these are always enforced since the realm admin configured them.
+	if windows := realm.IssueRateWindows(); len(windows) > 0 {
+		key, err := realm.QuotaKey(c.config.GetRateLimitConfig().HMACKey)
+		if err != nil {
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_GENERATE_HMAC"),
+				httpCode:    http.StatusInternalServerError,
+				errorReturn: api.Error(err),
+			}, nil
+		}
+
+		if err := ratelimit.TakeWindows(ctx, c.limiter, key+":issue", windows); err != nil {
+			var werr *ratelimit.WindowExceededError
+			if errors.As(err, &werr) {
+				logger.Warnw("realm has exceeded issue rate limit",
+					"realm", realm.ID,
+					"window", werr.Window.Name,
+					"limit", werr.Window.Limit,
+					"reset", werr.Reset)
 				return &issueResult{
 					obsBlame:    observability.BlameClient,
-					obsResult:   observability.ResultError("QUOTA_EXCEEDED"),
+					obsResult:   observability.ResultError("ISSUE_RATE_LIMIT_EXCEEDED"),
 					httpCode:    http.StatusTooManyRequests,
-					errorReturn: api.Errorf("exceeded realm quota, please contact the realm admin.").WithCode(api.ErrQuotaExceeded),
+					errorReturn: api.Errorf("realm %s", werr).WithCode(api.ErrIssueRateLimitExceeded),
 				}, nil
 			}
+
+			logger.Errorw("failed to take from limiter", "error", err)
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("FAILED_TO_TAKE_FROM_LIMITER"),
+				httpCode:    http.StatusInternalServerError,
+				errorReturn: api.Errorf("failed to verify realm stats, please try again"),
+			}, nil
 		}
 	}
 
 	now := time.Now().UTC()
 	expiryTime := now.Add(realm.CodeDuration.Duration)
-	longExpiryTime := now.Add(realm.LongCodeDuration.Duration)
-	if request.Phone == "" || smsProvider == nil {
-		// If this isn't going to be send via SMS, make the long code expiration time same as short.
-		// This is because the long code will never be shown or sent.
-		longExpiryTime = expiryTime
-	}
+	sendSMS := request.Phone != "" && smsProvider != nil
+	sendEmail := request.Email != "" && emailProvider != nil
+	longLength, longExpiryTime := longCodeOptions(realm, now, sendSMS || sendEmail)
 
 	// Generate verification code
 	codeRequest := otp.Request{
 		DB:             c.db,
 		ShortLength:    realm.CodeLength,
 		ShortExpiresAt: expiryTime,
-		LongLength:     realm.LongCodeLength,
+		LongLength:     longLength,
 		LongExpiresAt:  longExpiryTime,
 		TestType:       request.TestType,
 		SymptomDate:    parsedDates[0],
@@ -223,6 +551,15 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		IssuingUser:       controller.UserFromContext(ctx),
 		IssuingApp:        controller.AuthorizedAppFromContext(ctx),
 		IssuingExternalID: request.ExternalIssuerID,
+		SupervisingUser:   supervisingUser,
+		CohortID:          request.CohortID,
+		Metadata:          metadata,
+		MaxClaims:         maxClaims,
+		CaseInsensitive:   realm.CaseInsensitiveCodes,
+	}
+	if realm.RequireIssuanceApproval {
+		approvalExpiresAt := now.Add(realm.IssuanceApprovalTimeout.Duration)
+		codeRequest.ApprovalExpiresAt = &approvalExpiresAt
 	}
 
 	code, longCode, uuid, err := codeRequest.Issue(ctx, c.config.GetCollisionRetryCount())
@@ -237,6 +574,14 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 				errorReturn: api.Errorf("code for %s already exists", request.UUID).WithCode(api.ErrUUIDAlreadyExists),
 			}, nil
 		}
+		if database.IsQueryTimeout(err) {
+			return &issueResult{
+				obsBlame:    observability.BlameServer,
+				obsResult:   observability.ResultError("QUERY_TIMEOUT"),
+				httpCode:    http.StatusGatewayTimeout,
+				errorReturn: api.Errorf("timed out issuing code, please try again").WithCode(api.ErrInternal),
+			}, nil
+		}
 		return &issueResult{
 			obsBlame:    observability.BlameServer,
 			obsResult:   observability.ResultError("FAILED_TO_ISSUE_CODE"),
@@ -251,19 +596,14 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 		obsResult: observability.ResultOK(),
 	}
 
+	var smsDeliveryState string
 	if request.Phone != "" && smsProvider != nil {
+		message := realm.BuildLocalizedSMSText(request.SMSLocale, code, longCode, c.config.GetENXRedirectDomain())
+
 		if err := func() error {
 			defer observability.RecordLatency(&ctx, time.Now(), mSMSLatencyMs, &result.obsBlame, &result.obsResult)
 
-			message := realm.BuildSMSText(code, longCode, c.config.GetENXRedirectDomain())
-
 			if err := smsProvider.SendSMS(ctx, request.Phone, message); err != nil {
-				// Delete the token
-				if err := c.db.DeleteVerificationCode(code); err != nil {
-					logger.Errorw("failed to delete verification code", "error", err)
-					// fallthrough to the error
-				}
-
 				logger.Errorw("failed to send sms", "error", err)
 				result.obsBlame = observability.BlameServer
 				result.obsResult = observability.ResultError("FAILED_TO_SEND_SMS")
@@ -271,20 +611,186 @@ func (c *Controller) issue(ctx context.Context, request *api.IssueCodeRequest) (
 			}
 			return nil
 		}(); err != nil {
-			result.httpCode = http.StatusInternalServerError
-			result.errorReturn = api.Errorf("failed to send sms: %s", err)
-			return result, nil
+			// The failure is recorded in the SMS metrics. Under the warn and retry
+			// policies, the code is still issued.
+			switch realm.SMSFailurePolicy {
+			case database.SMSFailureWarn:
+				smsDeliveryState = api.SMSDeliveryFailed
+				result.obsBlame = observability.BlameNone
+				result.obsResult = observability.ResultOK()
+			case database.SMSFailureRetry:
+				smsDeliveryState = api.SMSDeliveryQueued
+				if _, err := c.db.QueueSMSRetry(realm.ID, uuid, request.Phone, message, longExpiryTime); err != nil {
+					logger.Errorw("failed to queue sms retry", "error", err)
+					smsDeliveryState = api.SMSDeliveryFailed
+				}
+				result.obsBlame = observability.BlameNone
+				result.obsResult = observability.ResultOK()
+			default:
+				// Delete the token
+				if err := c.db.DeleteVerificationCode(code); err != nil {
+					logger.Errorw("failed to delete verification code", "error", err)
+					// fallthrough to the error
+				}
+
+				result.httpCode = http.StatusInternalServerError
+				result.errorReturn = api.Errorf("failed to send sms: %s", err)
+				return result, nil
+			}
+		} else {
+			smsDeliveryState = api.SMSDeliverySent
+		}
+	}
+
+	// Email delivery failures are never fatal, since the code can be given to
+	// the patient another way.
+	var emailDeliveryState string
+	if sendEmail {
+		body := realm.BuildLocalizedEmailCodeText(request.EmailLocale, code, longCode, c.config.GetENXRedirectDomain())
+		subject := fmt.Sprintf("Your %s verification code", realm.Name)
+		message := email.PlainTextMessage(emailProvider.From(), request.Email, subject, body)
+
+		emailDeliveryState = api.EmailDeliverySent
+		if err := emailProvider.SendEmail(ctx, request.Email, message); err != nil {
+			logger.Warnw("failed to send code email", "error", err)
+			emailDeliveryState = api.EmailDeliveryFailed
 		}
 	}
 
-	return result, &api.IssueCodeResponse{
-		UUID:                   uuid,
-		VerificationCode:       code,
-		ExpiresAt:              expiryTime.Format(time.RFC1123),
-		ExpiresAtTimestamp:     expiryTime.UTC().Unix(),
-		LongExpiresAt:          longExpiryTime.Format(time.RFC1123),
-		LongExpiresAtTimestamp: longExpiryTime.UTC().Unix(),
+	resp := &api.IssueCodeResponse{
+		UUID:               uuid,
+		VerificationCode:   code,
+		ExpiresAt:          expiryTime.Format(time.RFC1123),
+		ExpiresAtTimestamp: expiryTime.UTC().Unix(),
+		PendingApproval:    realm.RequireIssuanceApproval,
+		SMSDeliveryState:   smsDeliveryState,
+		EmailDeliveryState: emailDeliveryState,
+	}
+	if quotaRemaining != nil {
+		resp.CodesRemaining = quotaRemaining
+		resp.QuotaResetsAtTimestamp = quotaResetsAt.UTC().Unix()
+	}
+	c.addLongCodeLinks(ctx, realm, resp, longCode, metadata, now, longExpiryTime)
+	return result, resp
+}
+
+// addLongCodeLinks adds the long code's expiry, deep link, and claim link to
+// the response. Realms which disable long codes get none of them, since their
+// long code is the short code.
+func (c *Controller) addLongCodeLinks(ctx context.Context, realm *database.Realm, resp *api.IssueCodeResponse, longCode string, metadata database.CodeMetadata, now, longExpiryTime time.Time) {
+	if realm.DisableLongCodes {
+		return
+	}
+
+	resp.LongExpiresAt = longExpiryTime.Format(time.RFC1123)
+	resp.LongExpiresAtTimestamp = longExpiryTime.UTC().Unix()
+	if longCode == "" {
+		return
+	}
+
+	logger := logging.FromContext(ctx).Named("issueapi.addLongCodeLinks")
+
+	deepLink, err := c.buildDeepLink(ctx, realm, longCode, metadata)
+	if err != nil {
+		// The code was issued, so return the deep link without metadata.
+		logger.Errorw("failed to sign deep link metadata", "error", err)
+	}
+	resp.DeepLink = deepLink
+
+	if c.db.ClaimLinksEnabled() {
+		claimExpiresAt := now.Add(c.config.GetClaimLinkDuration())
+		if claimExpiresAt.After(longExpiryTime) {
+			claimExpiresAt = longExpiryTime
+		}
+
+		token, err := c.db.SignClaimLink(realm.ID, longCode, claimExpiresAt)
+		if err != nil {
+			// The code was issued, so return it without a claim link.
+			logger.Errorw("failed to sign claim link", "error", err)
+			return
+		}
+		resp.ClaimToken = token
+		resp.ClaimExpiresAtTimestamp = claimExpiresAt.Unix()
+		resp.ClaimLink = buildClaimLink(c.config.GetClaimLinkURL(), token)
+	}
+}
+
+// buildClaimLink returns the claim page URL with the token in the "token"
+// query parameter, or the empty string if there is no claim page.
+func buildClaimLink(base, token string) string {
+	if base == "" {
+		return ""
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// longCodeOptions returns the length and expiration time of the long code. A
+// long length of 0 skips long code generation and the long code is the same as
+// the short code.
+func longCodeOptions(realm *database.Realm, now time.Time, send bool) (uint, time.Time) {
+	if realm.DisableLongCodes {
+		return 0, now.Add(realm.CodeDuration.Duration)
+	}
+
+	// If this isn't going to be sent via SMS or email, make the long code
+	// expiration time same as short. This is because the long code will never be
+	// shown or sent.
+	if !send {
+		return realm.LongCodeLength, now.Add(realm.CodeDuration.Duration)
+	}
+	return realm.LongCodeLength, now.Add(realm.LongCodeDuration.Duration)
+}
+
+// takeDailyQuota takes a code from the realm's abuse prevention quota for the
+// local day which contains now. It returns the number of codes remaining, when
+// the quota resets, and whether the quota allowed the code. A non-nil result is
+// returned if the quota could not be checked.
+func (c *Controller) takeDailyQuota(ctx context.Context, realm *database.Realm, now time.Time) (uint64, time.Time, bool, *issueResult) {
+	logger := logging.FromContext(ctx).Named("issueapi.takeDailyQuota")
+
+	key, err := realm.DailyQuotaKey(c.config.GetRateLimitConfig().HMACKey, now)
+	if err != nil {
+		return 0, time.Time{}, false, &issueResult{
+			obsBlame:    observability.BlameServer,
+			obsResult:   observability.ResultError("FAILED_TO_GENERATE_HMAC"),
+			httpCode:    http.StatusInternalServerError,
+			errorReturn: api.Error(err),
+		}
+	}
+
+	// The quota resets at midnight in the realm's timezone. The first code of
+	// the day creates the day's bucket with the realm's current limit, in the
+	// same store operation as the take.
+	_, dayEnd := realm.QuotaDay(now)
+	limitTokens := uint64(realm.AbusePreventionEffectiveLimit())
+	limit, remaining, reset, ok, err := ratelimit.TakeBucket(ctx, c.limiter, key, limitTokens, dayEnd.Sub(now), false)
+	if err != nil {
+		logger.Errorw("failed to take from limiter", "error", err)
+		return 0, time.Time{}, false, &issueResult{
+			obsBlame:    observability.BlameServer,
+			obsResult:   observability.ResultError("FAILED_TO_TAKE_FROM_LIMITER"),
+			httpCode:    http.StatusInternalServerError,
+			errorReturn: api.Errorf("failed to verify realm stats, please try again"),
+		}
+	}
+
+	stats.Record(ctx, mRealmTokenUsed.M(1))
+
+	if !ok {
+		logger.Warnw("realm has exceeded daily quota",
+			"realm", realm.ID,
+			"limit", limit,
+			"reset", reset)
 	}
+	return remaining, dayEnd, ok, nil
 }
 
 func (c *Controller) getAuthorizationFromContext(r *http.Request) (*database.AuthorizedApp, *database.User, error) {
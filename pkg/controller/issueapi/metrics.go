@@ -49,6 +49,7 @@ func init() {
 			TagKeys:     observability.APITagKeys(),
 			Aggregation: ochttp.DefaultLatencyDistribution,
 		},
+		observability.SLOView(metricPrefix, mLatencyMs, "Latency distribution of code issue requests by realm and blame"),
 		{
 			Name:        metricPrefix + "/sms_request_count",
 			Measure:     mSMSLatencyMs,
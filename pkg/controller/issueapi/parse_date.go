@@ -17,11 +17,21 @@ package issueapi
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 )
 
+// dateFormats describes the accepted date formats for error messages.
+const dateFormats = "YYYY-MM-DD, RFC 3339, or seconds since the epoch"
+
+// maxEpochSeconds is the largest accepted epoch value. Anything larger is very
+// likely milliseconds, which would otherwise be a date tens of thousands of
+// years from now.
+const maxEpochSeconds = 1e11
+
 type dateParseSettings struct {
 	Name          string
+	Field         string
 	ParseError    string
 	ValidateError string
 }
@@ -32,11 +42,13 @@ var (
 
 	onsetSettings = dateParseSettings{
 		Name:          "symptom onset",
+		Field:         "symptomDate",
 		ParseError:    "FAILED_TO_PROCESS_SYMPTOM_ONSET_DATE",
 		ValidateError: "SYMPTOM_ONSET_DATE_NOT_IN_VALID_RANGE",
 	}
 	testSettings = dateParseSettings{
 		Name:          "test",
+		Field:         "testDate",
 		ParseError:    "FAILED_TO_PROCESS_TEST_DATE",
 		ValidateError: "TEST_DATE_NOT_IN_VALID_RANGE",
 	}
@@ -50,6 +62,42 @@ func init() {
 	}
 }
 
+// parseDate parses a date in any of the accepted formats and returns midnight
+// UTC of that calendar date:
+//
+//   - YYYY-MM-DD, the date as given
+//   - RFC 3339, the date in the timestamp's own offset
+//   - seconds since the epoch, the date in the client's timezone, which is
+//     tzOffset minutes from UTC
+func parseDate(s string, tzOffset int) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return calendarDate(t), nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n < 0 {
+			return time.Time{}, fmt.Errorf("epoch seconds cannot be negative")
+		}
+		if n >= maxEpochSeconds {
+			return time.Time{}, fmt.Errorf("%d is too large, epoch must be in seconds, not milliseconds", n)
+		}
+		zone := time.FixedZone("client", tzOffset*60)
+		return calendarDate(time.Unix(n, 0).In(zone)), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a valid date, must be %s", s, dateFormats)
+}
+
+// calendarDate returns midnight UTC of the calendar date of t in its location.
+func calendarDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, utc)
+}
+
 // validateDate validates the date given -- returning the time or an error.
 func validateDate(date, minDate, maxDate time.Time, tzOffset int) (*time.Time, error) {
 	// Check that all our dates are utc.
@@ -0,0 +1,219 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+func TestController_takeDailyQuota(t *testing.T) {
+	t.Parallel()
+
+	// 10:00 in UTC, 06:00 in New York.
+	now := time.Date(2020, 8, 15, 10, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		realm    *database.Realm
+		takes    int
+		exp      []uint64
+		expOK    []bool
+		expReset time.Time
+	}{
+		{
+			name:     "decrements",
+			realm:    &database.Realm{AbusePreventionLimit: 3, AbusePreventionLimitFactor: 1.0},
+			takes:    3,
+			exp:      []uint64{2, 1, 0},
+			expOK:    []bool{true, true, true},
+			expReset: time.Date(2020, 8, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "exhausted_stays_zero",
+			realm:    &database.Realm{AbusePreventionLimit: 1, AbusePreventionLimitFactor: 1.0},
+			takes:    3,
+			exp:      []uint64{0, 0, 0},
+			expOK:    []bool{true, false, false},
+			expReset: time.Date(2020, 8, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "limit_factor",
+			realm:    &database.Realm{AbusePreventionLimit: 2, AbusePreventionLimitFactor: 1.5},
+			takes:    4,
+			exp:      []uint64{2, 1, 0, 0},
+			expOK:    []bool{true, true, true, false},
+			expReset: time.Date(2020, 8, 16, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "realm_timezone",
+			realm:    &database.Realm{AbusePreventionLimit: 2, AbusePreventionLimitFactor: 1.0, Timezone: "America/New_York"},
+			takes:    1,
+			exp:      []uint64{1},
+			expOK:    []bool{true},
+			expReset: time.Date(2020, 8, 16, 4, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			c := testQuotaController(&fakeStore{buckets: make(map[string]*fakeBucket)})
+
+			for i := 0; i < tc.takes; i++ {
+				remaining, resetsAt, ok, result := c.takeDailyQuota(ctx, tc.realm, now)
+				if result != nil {
+					t.Fatalf("take %d: unexpected error: %v", i, result.errorReturn)
+				}
+				if got, want := remaining, tc.exp[i]; got != want {
+					t.Errorf("take %d: expected %d to be %d", i, got, want)
+				}
+				if got, want := ok, tc.expOK[i]; got != want {
+					t.Errorf("take %d: expected %t to be %t", i, got, want)
+				}
+				if got, want := resetsAt, tc.expReset; !got.Equal(want) {
+					t.Errorf("take %d: expected %s to be %s", i, got, want)
+				}
+
+				// The remaining quota is reported even when it is zero.
+				b, err := json.Marshal(&api.IssueCodeResponse{
+					CodesRemaining:         &remaining,
+					QuotaResetsAtTimestamp: resetsAt.UTC().Unix(),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := string(b), fmt.Sprintf(`"codesRemaining":%d`, tc.exp[i]); !strings.Contains(got, want) {
+					t.Errorf("expected %s to contain %s", got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("new_day", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c := testQuotaController(&fakeStore{buckets: make(map[string]*fakeBucket)})
+		realm := &database.Realm{AbusePreventionLimit: 1, AbusePreventionLimitFactor: 1.0}
+
+		if _, _, ok, _ := c.takeDailyQuota(ctx, realm, now); !ok {
+			t.Fatal("expected first take to be allowed")
+		}
+		if _, _, ok, _ := c.takeDailyQuota(ctx, realm, now); ok {
+			t.Fatal("expected quota to be exhausted")
+		}
+
+		remaining, _, ok, result := c.takeDailyQuota(ctx, realm, now.Add(24*time.Hour))
+		if result != nil {
+			t.Fatal(result.errorReturn)
+		}
+		if !ok || remaining != 0 {
+			t.Errorf("expected next day to allow a code with 0 remaining, got %t with %d", ok, remaining)
+		}
+	})
+
+	t.Run("limiter_error", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		c := testQuotaController(&fakeStore{buckets: make(map[string]*fakeBucket), err: fmt.Errorf("oops")})
+		realm := &database.Realm{AbusePreventionLimit: 1, AbusePreventionLimitFactor: 1.0}
+
+		_, _, _, result := c.takeDailyQuota(ctx, realm, now)
+		if result == nil {
+			t.Fatal("expected error")
+		}
+		if got, want := result.httpCode, http.StatusInternalServerError; got != want {
+			t.Errorf("expected %d to be %d", got, want)
+		}
+	})
+}
+
+func testQuotaController(store limiter.Store) *Controller {
+	return &Controller{
+		config: &config.AdminAPIServerConfig{
+			RateLimit: ratelimit.Config{HMACKey: []byte("abcd1234")},
+		},
+		limiter: store,
+	}
+}
+
+var _ limiter.Store = (*fakeStore)(nil)
+
+// fakeStore is a limiter.Store with buckets which never reset.
+type fakeStore struct {
+	buckets map[string]*fakeBucket
+	err     error
+}
+
+type fakeBucket struct {
+	tokens, remaining uint64
+}
+
+func (s *fakeStore) Take(_ context.Context, key string) (uint64, uint64, uint64, bool, error) {
+	if s.err != nil {
+		return 0, 0, 0, false, s.err
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		return 0, 0, 0, false, nil
+	}
+	reset := uint64(time.Now().Add(time.Minute).UnixNano())
+	if b.remaining == 0 {
+		return b.tokens, 0, reset, false, nil
+	}
+	b.remaining--
+	return b.tokens, b.remaining, reset, true, nil
+}
+
+func (s *fakeStore) Get(_ context.Context, key string) (uint64, uint64, error) {
+	if b, ok := s.buckets[key]; ok {
+		return b.tokens, b.remaining, nil
+	}
+	return 0, 0, nil
+}
+
+func (s *fakeStore) Set(_ context.Context, key string, tokens uint64, _ time.Duration) error {
+	s.buckets[key] = &fakeBucket{tokens: tokens, remaining: tokens}
+	return nil
+}
+
+func (s *fakeStore) Burst(_ context.Context, key string, tokens uint64) error {
+	if b, ok := s.buckets[key]; ok {
+		b.remaining += tokens
+	}
+	return nil
+}
+
+func (s *fakeStore) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/pdf"
+)
+
+// Code sheet layout, in points. Each letter page holds a grid of cards
+// separated by dashed cut lines.
+const (
+	sheetMargin  = 36
+	sheetHeader  = 24
+	sheetColumns = 2
+	sheetRows    = 4
+	sheetQRSize  = 100
+
+	// sheetMaxNameLength is the number of characters of the realm name that
+	// fit on a card.
+	sheetMaxNameLength = 30
+)
+
+// codesPerSheetPage is the number of codes on each page.
+const codesPerSheetPage = sheetColumns * sheetRows
+
+// codeSheet is the information needed to print a set of issued codes.
+type codeSheet struct {
+	realm     *database.Realm
+	enxDomain string
+	testType  string
+	codes     []*api.IssueCodeResponse
+
+	// note is printed at the top of the first page, for example if fewer codes
+	// were issued than requested.
+	note string
+}
+
+// render writes the sheet as a PDF. If the realm uses EN Express with long
+// codes, each card includes a QR code of the deep link that fills in the long
+// code, and when that link expires.
+func (s *codeSheet) render(w io.Writer) error {
+	loc := s.realm.Location()
+	now := time.Now().In(loc)
+
+	name := s.realm.Name
+	if len(name) > sheetMaxNameLength {
+		name = name[:sheetMaxNameLength-3] + "..."
+	}
+
+	cellW := float64(pdf.LetterWidth-2*sheetMargin) / sheetColumns
+	cellH := float64(pdf.LetterHeight-2*sheetMargin-sheetHeader) / sheetRows
+	pages := (len(s.codes) + codesPerSheetPage - 1) / codesPerSheetPage
+
+	doc := pdf.New(pdf.LetterWidth, pdf.LetterHeight)
+	var page *pdf.Page
+	for i, code := range s.codes {
+		if i%codesPerSheetPage == 0 {
+			page = doc.AddPage()
+
+			header := fmt.Sprintf("%s - %d verification codes - generated %s - page %d of %d",
+				name, len(s.codes), now.Format("2006-01-02 15:04 MST"), i/codesPerSheetPage+1, pages)
+			page.Text(sheetMargin, pdf.LetterHeight-sheetMargin, pdf.Helvetica, 8, header)
+			if i == 0 && s.note != "" {
+				page.Text(sheetMargin, pdf.LetterHeight-sheetMargin-12, pdf.HelveticaBold, 8, s.note)
+			}
+		}
+
+		n := i % codesPerSheetPage
+		x := sheetMargin + float64(n%sheetColumns)*cellW
+		y := pdf.LetterHeight - sheetMargin - sheetHeader - float64(n/sheetColumns+1)*cellH
+
+		if err := s.renderCard(page, x, y, cellW, cellH, name, code, loc); err != nil {
+			return err
+		}
+	}
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+func (s *codeSheet) renderCard(page *pdf.Page, x, y, w, h float64, name string, code *api.IssueCodeResponse, loc *time.Location) error {
+	page.StrokeRect(x, y, w, h, 4)
+
+	expires := time.Unix(code.ExpiresAtTimestamp, 0).In(loc)
+
+	left := x + 12
+	page.Text(left, y+h-24, pdf.HelveticaBold, 11, name)
+	page.Text(left, y+h-44, pdf.Helvetica, 9, "Your verification code")
+	page.Text(left, y+h-72, pdf.CourierBold, 22, code.VerificationCode)
+	page.Text(left, y+h-92, pdf.Helvetica, 8, "Expires "+expires.Format("2006-01-02 15:04 MST"))
+	page.Text(left, y+h-106, pdf.Helvetica, 8, "Test type: "+s.testType)
+
+	if !s.realm.EnableENExpress || code.DeepLink == "" {
+		page.Text(left, y+14, pdf.Helvetica, 7, "Enter this code in the exposure notifications app.")
+		return nil
+	}
+
+	longExpires := time.Unix(code.LongExpiresAtTimestamp, 0).In(loc)
+	page.Text(left, y+34, pdf.Helvetica, 7, "Enter this code in the exposure notifications")
+	page.Text(left, y+24, pdf.Helvetica, 7, "app, or scan the QR code with your phone.")
+	page.Text(left, y+14, pdf.Helvetica, 7, "QR code expires "+longExpires.Format("2006-01-02 15:04 MST"))
+
+	qrCode, err := encodeQRCode(code.DeepLink)
+	if err != nil {
+		return err
+	}
+	drawQRCode(page, qrCode, x+w-sheetQRSize-12, y+(h-sheetQRSize)/2, sheetQRSize)
+	return nil
+}
+
+// encodeQRCode encodes the link as a QR code.
+func encodeQRCode(link string) (barcode.Barcode, error) {
+	code, err := qr.Encode(link, qr.M, qr.Auto)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %d byte deep link as a qr code: %w", len(link), err)
+	}
+	return code, nil
+}
+
+// checkSheetQRCode returns an error if the realm's deep links do not fit in a
+// QR code, so that a sheet can be rejected before any codes are issued for it.
+// Sheet codes have no metadata, so the longest link is for the longest code.
+func checkSheetQRCode(realm *database.Realm, enxDomain string) error {
+	if !realm.EnableENExpress || realm.DisableLongCodes {
+		return nil
+	}
+
+	_, err := encodeQRCode(realm.ENExpressLink(strings.Repeat("0", int(realm.LongCodeLength)), enxDomain))
+	return err
+}
+
+// drawQRCode draws the code, including its quiet zone, as a square of the given
+// size with the bottom left corner at x, y.
+func drawQRCode(page *pdf.Page, code barcode.Barcode, x, y, size float64) {
+	const quietZone = 4
+	bounds := code.Bounds()
+	n := bounds.Dx()
+	module := size / float64(n+2*quietZone)
+	x += quietZone * module
+	top := y + size - quietZone*module
+
+	dark := func(col, row int) bool {
+		return color.GrayModel.Convert(code.At(bounds.Min.X+col, bounds.Min.Y+row)).(color.Gray).Y < 128
+	}
+
+	// Draw horizontal runs of dark modules to keep the document small.
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; {
+			if !dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < n && dark(col, row) {
+				col++
+			}
+			page.FillRect(x+float64(start)*module, top-float64(row+1)*module, float64(col-start)*module, module)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package issueapi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestCodeSheet_Render(t *testing.T) {
+	t.Parallel()
+
+	realm := database.NewRealmWithDefaults("State of Wonder")
+	realm.RegionCode = "US-WA"
+	realm.EnableENExpress = true
+
+	codes := make([]*api.IssueCodeResponse, codesPerSheetPage+1)
+	for i := range codes {
+		codes[i] = &api.IssueCodeResponse{
+			VerificationCode:       fmt.Sprintf("1234567%d", i),
+			ExpiresAtTimestamp:     time.Now().Add(time.Hour).Unix(),
+			LongExpiresAtTimestamp: time.Now().Add(24 * time.Hour).Unix(),
+			DeepLink:               realm.ENExpressLink(fmt.Sprintf("abcdefghijklmno%d", i), "en.express"),
+		}
+	}
+
+	sheet := &codeSheet{
+		realm:     realm,
+		enxDomain: "en.express",
+		testType:  "confirmed",
+		codes:     codes,
+		note:      "Only 9 of 10 requested codes were issued",
+	}
+
+	var b bytes.Buffer
+	if err := sheet.render(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.String()
+	if !strings.HasPrefix(out, "%PDF-") {
+		t.Fatalf("expected pdf, got %q", out[:10])
+	}
+	if !strings.Contains(out, "/Count 2") {
+		t.Errorf("expected 2 pages")
+	}
+	for _, code := range codes {
+		if !strings.Contains(out, "("+code.VerificationCode+") Tj") {
+			t.Errorf("missing code %s", code.VerificationCode)
+		}
+	}
+	if !strings.Contains(out, sheet.note) {
+		t.Errorf("missing note")
+	}
+	if !strings.Contains(out, "re f") {
+		t.Errorf("missing qr code modules")
+	}
+	if !strings.Contains(out, "(QR code expires ") {
+		t.Errorf("missing qr code expiry")
+	}
+}
+
+func TestCheckSheetQRCode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		host   string
+		length uint
+		err    bool
+	}{
+		{name: "default", length: 16},
+		{name: "long_code", length: 1000},
+		{name: "too_long", host: strings.Repeat("a", 3000), length: 16, err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := database.NewRealmWithDefaults("State of Wonder")
+			realm.RegionCode = "US-WA"
+			realm.EnableENExpress = true
+			realm.DeepLinkHost = tc.host
+			realm.LongCodeLength = tc.length
+
+			err := checkSheetQRCode(realm, "")
+			if got, want := err != nil, tc.err; got != want {
+				t.Errorf("expected error %v to be %t", err, want)
+			}
+		})
+	}
+}
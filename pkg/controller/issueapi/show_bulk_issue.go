@@ -44,6 +44,7 @@ func (c *Controller) HandleBulkIssue() http.Handler {
 
 		m := controller.TemplateMapFromContext(ctx)
 		m["hasSMSConfig"] = hasSMSConfig
+		m["maxSheetSize"] = maxSheetSize
 		m.Title("Bulk issue codes")
 		c.h.RenderHTML(w, "codes/issue-bulk", m)
 	})
@@ -23,21 +23,14 @@ import (
 	"strings"
 )
 
-const (
-	// Max request size of 64KB. None of the current API requests for this
-	// server are near that limit. Prevents us from unnecessarily parsing JSON
-	// payloads that are much large than we anticipate.
-	maxBodyBytes = 64_000
-)
-
 // BindJSON provides a common implementation of JSON unmarshaling with well defined error handling.
+// The size of the body is limited by middleware.LimitBodySize.
 func BindJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	if !IsJSONContentType(r) {
 		return fmt.Errorf("content-type is not application/json")
 	}
 
 	defer r.Body.Close()
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
 
 	d := json.NewDecoder(r.Body)
 	d.DisallowUnknownFields()
@@ -19,12 +19,15 @@ package jwks
 
 import (
 	"context"
+	"crypto"
 	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/keyutils"
@@ -42,6 +45,9 @@ type Controller struct {
 	db       *database.Database
 	keyCache *keyutils.PublicKeyCache
 	cacher   cache.Cacher
+
+	signing          *config.CertificateSigningConfig
+	systemKeyManager keys.KeyManager
 }
 
 // HandleIndex returns an http.Handler that handles jwks GET requests.
@@ -49,27 +55,7 @@ func (c *Controller) HandleIndex() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
-		// key is the key in the cacher where the values for this JWK are cached.
-		key := &cache.Key{
-			Namespace: "jwks",
-			Key:       r.URL.String(),
-		}
-
-		// See if there's a cached value. Note we cannot use Fetch here because our
-		// fetch function also depends on the cacher to lookup pubic keys and
-		// results in a deadlock.
-		var encoded []*jwk.JWK
-		if err := c.cacher.Read(ctx, key, &encoded); err == nil {
-			c.h.RenderJSON(w, http.StatusOK, encoded)
-			return
-		} else if err != cache.ErrNotFound {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
-
-		// If we got this far, it means there was no cached value, so do a full
-		// read.
-		encoded, err := func() ([]*jwk.JWK, error) {
+		c.renderCached(w, r, func() ([]*jwk.JWK, error) {
 			// Grab the URL path components  we need.
 			realmID := mux.Vars(r)["realm_id"]
 
@@ -93,37 +79,92 @@ func (c *Controller) HandleIndex() http.Handler {
 				}
 
 				// Encode it, and sent it off.
-				spec := jwk.NewSpec(pk)
-				spec.KeyID = key.GetKID()
-				encoded[i], err = spec.ToJWK()
+				encoded[i], err = encodeJWK(pk, key.GetKID())
 				if err != nil {
 					return nil, err
 				}
 			}
 			return encoded, nil
-		}()
-		if err != nil {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
-
-		// It's possible there were concurrent requests and someone already has the
-		// cache - now that we have the value, we can avoid the deadline and do a
-		// fetch. If there's already a cached value, our value will be discarded.
-		// Otherwise, it will be overwritten and saved in the cache.
-		ttl := 5 * time.Minute
-		if err := c.cacher.Fetch(ctx, key, &encoded, ttl, func() (interface{}, error) {
-			return encoded, nil
-		}); err != nil {
-			controller.InternalError(w, r, c.h, err)
-			return
-		}
+		})
+	})
+}
 
-		// Get the keys.
-		c.h.RenderJSON(w, http.StatusOK, encoded)
+// HandleSystem returns an http.Handler that returns the system certificate
+// signing key, which signs certificates and responses for realms without
+// realm-specific keys.
+func (c *Controller) HandleSystem() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		c.renderCached(w, r, func() ([]*jwk.JWK, error) {
+			pk, err := c.keyCache.GetPublicKey(ctx, c.signing.CertificateSigningKey, c.systemKeyManager)
+			if err != nil {
+				return nil, err
+			}
+
+			encoded, err := encodeJWK(pk, c.signing.CertificateSigningKeyID)
+			if err != nil {
+				return nil, err
+			}
+			return []*jwk.JWK{encoded}, nil
+		})
 	})
 }
 
+// renderCached renders the keys returned by fn, caching them by the request
+// URL.
+func (c *Controller) renderCached(w http.ResponseWriter, r *http.Request, fn func() ([]*jwk.JWK, error)) {
+	ctx := r.Context()
+
+	// key is the key in the cacher where the values for this JWK are cached.
+	key := &cache.Key{
+		Namespace: "jwks",
+		Key:       r.URL.String(),
+	}
+
+	// See if there's a cached value. Note we cannot use Fetch here because our
+	// fetch function also depends on the cacher to lookup pubic keys and
+	// results in a deadlock.
+	var encoded []*jwk.JWK
+	if err := c.cacher.Read(ctx, key, &encoded); err == nil {
+		c.h.RenderJSON(w, http.StatusOK, encoded)
+		return
+	} else if err != cache.ErrNotFound {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	// If we got this far, it means there was no cached value, so do a full
+	// read.
+	encoded, err := fn()
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	// It's possible there were concurrent requests and someone already has the
+	// cache - now that we have the value, we can avoid the deadline and do a
+	// fetch. If there's already a cached value, our value will be discarded.
+	// Otherwise, it will be overwritten and saved in the cache.
+	ttl := 5 * time.Minute
+	if err := c.cacher.Fetch(ctx, key, &encoded, ttl, func() (interface{}, error) {
+		return encoded, nil
+	}); err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	// Get the keys.
+	c.h.RenderJSON(w, http.StatusOK, encoded)
+}
+
+// encodeJWK encodes the public key as a JWK with the given key ID.
+func encodeJWK(pk crypto.PublicKey, kid string) (*jwk.JWK, error) {
+	spec := jwk.NewSpec(pk)
+	spec.KeyID = kid
+	return spec.ToJWK()
+}
+
 // getRealm finds realm given ID.
 func (c *Controller) getRealm(realmStr string) (*database.Realm, error) {
 	realmID, err := strconv.Atoi(realmStr)
@@ -138,8 +179,9 @@ func (c *Controller) getRealm(realmStr string) (*database.Realm, error) {
 	return realm, nil
 }
 
-// New creates a new jwks *Controller, and returns it.
-func New(ctx context.Context, db *database.Database, cacher cache.Cacher, h *render.Renderer) (*Controller, error) {
+// New creates a new jwks *Controller, and returns it. The signing config and
+// key manager are used to look up the system certificate signing key.
+func New(ctx context.Context, db *database.Database, cacher cache.Cacher, signing *config.CertificateSigningConfig, systemKeyManager keys.KeyManager, h *render.Renderer) (*Controller, error) {
 	kc, err := keyutils.NewPublicKeyCache(ctx, cacher, time.Minute)
 	if err != nil {
 		return nil, err
@@ -150,5 +192,8 @@ func New(ctx context.Context, db *database.Database, cacher cache.Cacher, h *ren
 		db:       db,
 		keyCache: kc,
 		cacher:   cacher,
+
+		signing:          signing,
+		systemKeyManager: systemKeyManager,
 	}, nil
 }
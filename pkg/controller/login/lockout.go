@@ -0,0 +1,96 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// errLoginLockedOut is returned when the client's address is locked out. It
+// does not depend on the account, so it cannot be used to discover accounts.
+var errLoginLockedOut = fmt.Errorf("too many failed sign-in attempts, try again later")
+
+// checkLoginLockout returns errLoginLockedOut if the client's address is locked
+// out after too many failed logins.
+func (c *Controller) checkLoginLockout(r *http.Request) error {
+	lockout, err := c.db.FindLoginLockout(controller.ClientIP(r, c.config.Proxy.TrustedProxies))
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to check login lockout: %w", err)
+	}
+	if lockout.IsLocked() {
+		return errLoginLockedOut
+	}
+	return nil
+}
+
+// recordLoginFailure counts a sign-in which the server rejected against the
+// client's address, and alerts system admins if there have been too many.
+// Passwords are checked by the auth provider, which throttles guesses itself.
+func (c *Controller) recordLoginFailure(r *http.Request) {
+	logger := logging.FromContext(r.Context()).Named("login.recordLoginFailure")
+
+	lockout, alert, err := c.db.RecordLoginFailure(controller.ClientIP(r, c.config.Proxy.TrustedProxies), c.config.LoginLockout.Policy())
+	if err != nil {
+		logger.Errorw("failed to record login failure", "error", err)
+		return
+	}
+
+	if lockout.IsLocked() {
+		logger.Warnw("address locked out after failed logins",
+			"ip_address", lockout.IPAddress,
+			"failed_attempts", lockout.FailedAttempts,
+			"locked_until", lockout.LockedUntil)
+	}
+
+	if alert {
+		if err := c.sendLockoutAlert(r, lockout.IPAddress, lockout.FailedAttempts, lockout.LockedUntil); err != nil {
+			logger.Errorw("failed to alert system admins of login failures", "error", err)
+		}
+	}
+}
+
+// sendLockoutAlert emails the system admins about repeated failed logins.
+func (c *Controller) sendLockoutAlert(r *http.Request, ip string, failedAttempts uint, lockedUntil *time.Time) error {
+	admins, err := c.db.ListSystemAdmins()
+	if err != nil {
+		return err
+	}
+
+	to := make([]string, 0, len(admins))
+	for _, admin := range admins {
+		to = append(to, admin.Email)
+	}
+
+	until := "the lockout is cleared"
+	if lockedUntil != nil {
+		until = lockedUntil.UTC().Format(time.RFC1123)
+	}
+
+	return controller.SendSystemEmail(r.Context(), c.db, c.h, "email/login-lockout-alert", to, map[string]interface{}{
+		"LockoutAddress": ip,
+		"FailedAttempts": failedAttempts,
+		"LockedUntil":    until,
+		"ReviewLink":     controller.AbsoluteURL(r, "/admin/login-lockouts", c.config.DevMode),
+	})
+}
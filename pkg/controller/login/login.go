@@ -37,6 +37,13 @@ func (c *Controller) HandleLogin() http.Handler {
 			}
 		}
 
+		// When password login is disabled, send users straight to the identity
+		// provider unless system admins may still sign in with a password.
+		if c.config.PasswordLoginDisabled && !c.config.AllowSystemAdminPasswordLogin {
+			http.Redirect(w, r, c.config.SSOLoginURL, http.StatusSeeOther)
+			return
+		}
+
 		c.renderLogin(ctx, w)
 	})
 }
@@ -45,5 +52,7 @@ func (c *Controller) renderLogin(ctx context.Context, w http.ResponseWriter) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Login")
 	m["firebase"] = c.config.Firebase
+	m["passwordLoginDisabled"] = c.config.PasswordLoginDisabled
+	m["ssoLoginURL"] = c.config.SSOLoginURL
 	c.h.RenderHTML(w, "login", m)
 }
@@ -19,6 +19,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/captcha"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 )
@@ -34,6 +35,9 @@ func (c *Controller) renderResetPassword(ctx context.Context, w http.ResponseWri
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Reset password")
 	m["email"] = email
+	if c.config.Captcha.Enabled(captcha.EndpointResetPassword) {
+		m["captcha"] = &c.config.Captcha
+	}
 	c.h.RenderHTML(w, "login/reset-password", m)
 }
 
@@ -18,6 +18,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 )
@@ -51,6 +52,16 @@ func (c *Controller) HandleSelectRealm() http.Handler {
 				http.Redirect(w, r, "/admin", http.StatusSeeOther)
 				return
 			}
+
+			// Otherwise there is nothing they can select. Log it so admins can find
+			// orphaned accounts, and explain how to get access. Any flash from
+			// being redirected here is cleared since it asks them to select a realm.
+			logging.FromContext(ctx).Named("login.HandleSelectRealm").
+				Warnw("user is not a member of any realms", "user_id", currentUser.ID)
+
+			flash.Clear()
+			c.renderNoRealms(ctx, w)
+			return
 		case 1:
 			// If the user is only a member of one realm, set that and bypass selection.
 			realm := currentUser.Realms[0]
@@ -116,5 +127,15 @@ func (c *Controller) renderSelect(ctx context.Context, w http.ResponseWriter, re
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Realm selector")
 	m["realms"] = realms
+	m["realmRequestsEnabled"] = c.config.EnableRealmRequests
 	c.h.RenderHTML(w, "login/select-realm", m)
 }
+
+// renderNoRealms renders the page for users who are not a member of any realm.
+func (c *Controller) renderNoRealms(ctx context.Context, w http.ResponseWriter) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("No realm access")
+	m["contact"] = c.config.NoRealmsContact
+	m["realmRequestsEnabled"] = c.config.EnableRealmRequests
+	c.h.RenderHTMLStatus(w, http.StatusForbidden, "login/no-realms", m)
+}
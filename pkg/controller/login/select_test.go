@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package login_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/internal/i18n"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/login"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/sessions"
+)
+
+func TestHandleSelectRealm_NoRealms(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	h, err := render.New(ctx, envstest.ServerAssetsPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locales, err := i18n.Load(envstest.LocalesPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name          string
+		systemAdmin   bool
+		contact       string
+		realmRequests bool
+		expCode       int
+		expLocation   string
+		expBody       []string
+		notBody       []string
+	}{
+		{
+			name:        "system_admin",
+			systemAdmin: true,
+			expCode:     http.StatusSeeOther,
+			expLocation: "/admin",
+		},
+		{
+			name:    "default_contact",
+			expCode: http.StatusForbidden,
+			expBody: []string{"No realm access", "contact your realm administrator"},
+			notBody: []string{"request-realm", "Select a realm to continue."},
+		},
+		{
+			name:    "configured_contact",
+			contact: "support@example.com",
+			expCode: http.StatusForbidden,
+			expBody: []string{"contact support@example.com"},
+			notBody: []string{"contact your realm administrator"},
+		},
+		{
+			name:          "realm_requests",
+			realmRequests: true,
+			expCode:       http.StatusForbidden,
+			expBody:       []string{`href="/realm-requests/new"`},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := &config.ServerConfig{
+				NoRealmsContact:     tc.contact,
+				EnableRealmRequests: tc.realmRequests,
+			}
+			c := login.New(ctx, nil, cfg, nil, h)
+
+			session := &sessions.Session{
+				Values:  map[interface{}]interface{}{},
+				Options: &sessions.Options{},
+			}
+			controller.Flash(session).Error("Select a realm to continue.")
+
+			user := &database.User{Email: "user@example.com", SystemAdmin: tc.systemAdmin}
+			user.ID = 1
+
+			r := httptest.NewRequest(http.MethodGet, "/login/select-realm", nil)
+			r = r.WithContext(controller.WithUser(controller.WithSession(r.Context(), session), user))
+			w := httptest.NewRecorder()
+
+			handler := middleware.InjectCurrentPath()(middleware.ProcessLocale(locales)(c.HandleSelectRealm()))
+			handler.ServeHTTP(w, r)
+
+			if got, want := w.Code, tc.expCode; got != want {
+				t.Fatalf("expected %d to be %d: %s", got, want, w.Body.String())
+			}
+			if got, want := w.Header().Get("Location"), tc.expLocation; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			body := w.Body.String()
+			for _, want := range tc.expBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected body to contain %q:\n%s", want, body)
+				}
+			}
+			for _, notWant := range tc.notBody {
+				if strings.Contains(body, notWant) {
+					t.Errorf("expected body not to contain %q", notWant)
+				}
+			}
+
+			// The "select a realm" flash does not apply when there are no realms.
+			if tc.expCode == http.StatusForbidden {
+				if got := controller.Flash(session).Errors(); len(got) != 0 {
+					t.Errorf("expected flash to be cleared, got %v", got)
+				}
+			}
+		})
+	}
+}
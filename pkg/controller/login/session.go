@@ -15,11 +15,16 @@
 package login
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/google/exposure-notifications-verification-server/internal/auth"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/sessions"
 )
 
 func (c *Controller) HandleCreateSession() http.Handler {
@@ -45,6 +50,19 @@ func (c *Controller) HandleCreateSession() http.Handler {
 			return
 		}
 
+		// Addresses with too many rejected sign-ins may not sign in, even with a
+		// valid token, until the lockout ends.
+		if c.config.LoginLockout.Enabled() {
+			if err := c.checkLoginLockout(r); err != nil {
+				flash.Error("%v", err)
+				c.h.RenderJSON(w, http.StatusUnauthorized, api.Error(err))
+				return
+			}
+		}
+
+		// Start a new server-side session record for the new login.
+		controller.ClearSessionUserSessionID(session)
+
 		// Create the session cookie.
 		if err := c.authProvider.StoreSession(ctx, session, &auth.SessionInfo{
 			Data: map[string]interface{}{
@@ -52,11 +70,59 @@ func (c *Controller) HandleCreateSession() http.Handler {
 			},
 			TTL: c.config.SessionDuration,
 		}); err != nil {
+			if errors.Is(err, auth.ErrInvalidIDToken) && c.config.LoginLockout.Enabled() {
+				c.recordLoginFailure(r)
+			}
+
 			flash.Error("Failed to create session: %v", err)
 			c.h.RenderJSON(w, http.StatusUnauthorized, api.Error(err))
 			return
 		}
 
+		if c.config.PasswordLoginDisabled {
+			if err := c.checkPasswordLoginAllowed(ctx, session); err != nil {
+				c.authProvider.ClearSession(ctx, session)
+				flash.Error("%v", err)
+				c.h.RenderJSON(w, http.StatusUnauthorized, api.Error(err))
+				return
+			}
+		}
+
+		// Users who sign in with single sign-on are exempt from password
+		// rotation. If the method cannot be determined, assume a password.
+		provider, err := c.authProvider.SignInProvider(ctx, session)
+		controller.StoreSessionSSO(session, err == nil && provider != auth.SignInProviderPassword)
+
 		c.h.RenderJSON(w, http.StatusOK, nil)
 	})
 }
+
+// checkPasswordLoginAllowed returns an error if the session was created with
+// an email and password, unless the user is a system admin and the emergency
+// password path is enabled.
+func (c *Controller) checkPasswordLoginAllowed(ctx context.Context, session *sessions.Session) error {
+	provider, err := c.authProvider.SignInProvider(ctx, session)
+	if err != nil {
+		return fmt.Errorf("failed to determine sign in method: %w", err)
+	}
+	if provider != auth.SignInProviderPassword {
+		return nil
+	}
+
+	if c.config.AllowSystemAdminPasswordLogin {
+		email, err := c.authProvider.EmailAddress(ctx, session)
+		if err != nil {
+			return fmt.Errorf("failed to get email: %w", err)
+		}
+
+		user, err := c.db.FindUserByEmail(email)
+		if err != nil && !database.IsNotFound(err) {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+		if user != nil && user.SystemAdmin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("password login is disabled, sign in with single sign-on instead")
+}
@@ -65,9 +65,18 @@ func (c *Controller) HandleSignOut() http.Handler {
 			logger.Debugw("failed to revoke session", "error", err)
 		}
 
+		// Delete the server-side session record.
+		if id := controller.UserSessionIDFromSession(session); id != "" {
+			if err := c.db.DeleteUserSession(id); err != nil {
+				logger.Errorw("failed to delete user session", "error", err)
+			}
+			controller.ClearSessionUserSessionID(session)
+		}
+
 		// Set MaxAge to -1 to expire the session.
 		session.Options.MaxAge = -1
 		controller.ClearMFAPrompted(session)
+		controller.ClearSessionImpersonation(session)
 
 		m := controller.TemplateMapFromContext(ctx)
 		m.Title("Logging out...")
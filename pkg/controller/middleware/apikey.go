@@ -18,6 +18,7 @@ package middleware
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
@@ -45,6 +46,11 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h *render.Rendere
 
 	cacheTTL := 5 * time.Minute
 
+	// lastTouched is when this instance last recorded the use of each API key.
+	// Cached apps may have a stale LastUsedAt, so this keeps every request in the
+	// cache period from writing to the database.
+	var lastTouched sync.Map
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -106,6 +112,17 @@ func RequireAPIKey(cacher cache.Cacher, db *database.Database, h *render.Rendere
 				return
 			}
 
+			// Record that the API key was used. Failures are logged, but do not fail
+			// the request.
+			if authApp.NeedsTouch() {
+				if t, ok := lastTouched.Load(authApp.ID); !ok || time.Since(t.(time.Time)) > cacheTTL {
+					lastTouched.Store(authApp.ID, time.Now())
+					if err := db.TouchAuthorizedApp(&authApp); err != nil {
+						logger.Warnw("failed to record api key use", "error", err)
+					}
+				}
+			}
+
 			// Save the authorized app on the context.
 			ctx = controller.WithAuthorizedApp(ctx, &authApp)
 			ctx = controller.WithRealm(ctx, &realm)
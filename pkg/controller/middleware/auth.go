@@ -16,6 +16,7 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -31,8 +32,9 @@ import (
 
 // RequireAuth requires a user to be logged in. It also ensures that currentUser
 // is set in the template map. It fetches a user from the session and stores the
-// full record in the request context.
-func RequireAuth(cacher cache.Cacher, authProvider auth.Provider, db *database.Database, h *render.Renderer, sessionIdleTTL, expiryCheckTTL time.Duration) mux.MiddlewareFunc {
+// full record in the request context. trustedProxies is the number of proxies
+// in front of the server, used to find the client IP.
+func RequireAuth(cacher cache.Cacher, authProvider auth.Provider, db *database.Database, h *render.Renderer, sessionIdleTTL, expiryCheckTTL time.Duration, trustedProxies int) mux.MiddlewareFunc {
 	cacheTTL := 15 * time.Minute
 
 	return func(next http.Handler) http.Handler {
@@ -122,8 +124,79 @@ func RequireAuth(cacher cache.Cacher, authProvider auth.Provider, db *database.D
 				}
 			}
 
+			// Record the session server-side so it can be listed and revoked. This
+			// is keyed on the real user, even while impersonating.
+			if controller.UserSessionIDFromSession(session) == "" {
+				userSession, err := db.CreateUserSession(user.ID, controller.RealmIDFromSession(session),
+					controller.ClientIP(r, trustedProxies), r.UserAgent(), expiryCheckTTL)
+				if err != nil {
+					logger.Errorw("failed to create user session", "error", err)
+					controller.InternalError(w, r, h, err)
+					return
+				}
+				controller.StoreSessionUserSessionID(session, userSession.SessionID)
+			}
+
+			// If a system admin is impersonating another user, act as that user for
+			// the remainder of the request.
+			currentUser := &user
+			if targetID, startedAt, expiresAt := controller.ImpersonationFromSession(session); targetID != 0 {
+				switch {
+				case !user.SystemAdmin:
+					logger.Warnw("impersonation requested by non-admin", "user", user.ID)
+					controller.ClearSessionImpersonation(session)
+				case time.Now().After(expiresAt):
+					controller.ClearSessionImpersonation(session)
+					controller.ClearSessionRealm(session)
+
+					target, err := db.FindUser(targetID)
+					if err != nil && !database.IsNotFound(err) {
+						logger.Errorw("failed to lookup impersonated user", "error", err)
+						controller.InternalError(w, r, h, err)
+						return
+					}
+					if target != nil {
+						msg := fmt.Sprintf("impersonation expired after %s", expiresAt.Sub(startedAt))
+						audit := database.BuildAuditEntry(&user, msg, target, 0)
+						if err := db.SaveAuditEntry(audit); err != nil {
+							logger.Errorw("failed to save audit", "error", err)
+							controller.InternalError(w, r, h, err)
+							return
+						}
+					}
+
+					flash.Alert("Your impersonation session has expired.")
+				default:
+					target, err := db.FindUser(targetID)
+					if err != nil {
+						controller.ClearSessionImpersonation(session)
+
+						if !database.IsNotFound(err) {
+							logger.Errorw("failed to lookup impersonated user", "error", err)
+							controller.InternalError(w, r, h, err)
+							return
+						}
+						break
+					}
+
+					// System admins cannot be impersonated, even if the target was
+					// promoted after the impersonation started.
+					if target.SystemAdmin {
+						logger.Warnw("impersonation of system admin rejected",
+							"user", user.ID,
+							"target", target.ID)
+						controller.ClearSessionImpersonation(session)
+						flash.Error("System admins cannot be impersonated.")
+						break
+					}
+
+					ctx = controller.WithImpersonator(ctx, &user)
+					currentUser = target
+				}
+			}
+
 			// Save the user on the context.
-			ctx = controller.WithUser(ctx, &user)
+			ctx = controller.WithUser(ctx, currentUser)
 			r = r.Clone(ctx)
 
 			next.ServeHTTP(w, r)
@@ -156,3 +229,51 @@ func RequireSystemAdmin(h *render.Renderer) mux.MiddlewareFunc {
 		})
 	}
 }
+
+// RestrictImpersonation prevents a system admin who is impersonating a user from
+// performing any action that modifies state. Only safe methods are permitted,
+// plus the explicitly allowed routes. Each allowed route is either a path (any
+// method) or a method and path separated by a space, like "DELETE /impersonate".
+// It must come after RequireAuth so that the impersonator is set on the
+// context.
+func RestrictImpersonation(h *render.Renderer, allowed ...string) mux.MiddlewareFunc {
+	allowedRoutes := make(map[string]struct{}, len(allowed))
+	for _, v := range allowed {
+		allowedRoutes[v] = struct{}{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			logger := logging.FromContext(ctx).Named("middleware.RestrictImpersonation")
+
+			impersonator := controller.ImpersonatorFromContext(ctx)
+			if impersonator == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if _, ok := allowedRoutes[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if _, ok := allowedRoutes[r.Method+" "+r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			logger.Debugw("blocked action while impersonating",
+				"impersonator", impersonator.ID,
+				"method", r.Method,
+				"path", r.URL.Path)
+			controller.ImpersonationRestricted(w, r, h)
+		})
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/sessions"
+)
+
+// testSession returns a new session that is logged in as the given email using
+// the local auth provider.
+func testSession(tb testing.TB, authProvider auth.Provider, email string) *sessions.Session {
+	tb.Helper()
+
+	session := &sessions.Session{
+		Values:  map[interface{}]interface{}{},
+		Options: &sessions.Options{},
+		IsNew:   true,
+	}
+	if err := authProvider.StoreSession(context.Background(), session, &auth.SessionInfo{
+		Data: map[string]interface{}{
+			"email":          email,
+			"email_verified": true,
+			"mfa_enabled":    true,
+			"revoked":        false,
+		},
+		TTL: 30 * time.Minute,
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	return session
+}
+
+func TestRequireAuth_Impersonation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	h, err := render.New(ctx, envstest.ServerAssetsPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacher, err := cache.NewNoop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authProvider, err := auth.NewLocal(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &database.User{
+		Email:       "admin@example.com",
+		Name:        "Admin",
+		SystemAdmin: true,
+	}
+	if err := db.SaveUser(admin, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	otherAdmin := &database.User{
+		Email:       "other-admin@example.com",
+		Name:        "Other admin",
+		SystemAdmin: true,
+	}
+	if err := db.SaveUser(otherAdmin, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &database.User{
+		Email: "target@example.com",
+		Name:  "Target",
+	}
+	if err := db.SaveUser(target, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	requireAuth := middleware.RequireAuth(cacher, authProvider, db, h, time.Hour, time.Hour, 0)
+
+	cases := []struct {
+		name      string
+		email     string
+		target    *database.User
+		expiresIn time.Duration
+
+		expUser         string
+		expImpersonator string
+		expCleared      bool
+		expAudit        string
+	}{
+		{
+			name:            "active",
+			email:           admin.Email,
+			target:          target,
+			expiresIn:       10 * time.Minute,
+			expUser:         target.Email,
+			expImpersonator: admin.Email,
+		},
+		{
+			name:       "non_admin",
+			email:      target.Email,
+			target:     admin,
+			expiresIn:  10 * time.Minute,
+			expUser:    target.Email,
+			expCleared: true,
+		},
+		{
+			name:       "expired",
+			email:      admin.Email,
+			target:     target,
+			expiresIn:  -1 * time.Minute,
+			expUser:    admin.Email,
+			expCleared: true,
+			expAudit:   "impersonation expired after",
+		},
+		{
+			name:       "system_admin_target",
+			email:      admin.Email,
+			target:     otherAdmin,
+			expiresIn:  10 * time.Minute,
+			expUser:    admin.Email,
+			expCleared: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			// Not parallel, since the audit assertions look at the shared database.
+
+			session := testSession(t, authProvider, tc.email)
+			startedAt := time.Now().Add(-15 * time.Minute)
+			controller.StoreSessionImpersonation(session, tc.target, startedAt, time.Now().Add(tc.expiresIn))
+
+			var gotUser, gotImpersonator string
+			handler := requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if u := controller.UserFromContext(r.Context()); u != nil {
+					gotUser = u.Email
+				}
+				if u := controller.ImpersonatorFromContext(r.Context()); u != nil {
+					gotImpersonator = u.Email
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.Clone(controller.WithSession(r.Context(), session))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got, want := w.Code, http.StatusOK; got != want {
+				t.Errorf("expected status %d to be %d", got, want)
+			}
+			if got, want := gotUser, tc.expUser; got != want {
+				t.Errorf("expected user %q to be %q", got, want)
+			}
+			if got, want := gotImpersonator, tc.expImpersonator; got != want {
+				t.Errorf("expected impersonator %q to be %q", got, want)
+			}
+
+			id, _, _ := controller.ImpersonationFromSession(session)
+			if got, want := id == 0, tc.expCleared; got != want {
+				t.Errorf("expected impersonation cleared to be %t", want)
+			}
+
+			if tc.expAudit != "" {
+				audits, _, err := db.ListAudits(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var found bool
+				for _, audit := range audits {
+					if strings.HasPrefix(audit.Action, tc.expAudit) && audit.TargetDisplay == tc.target.AuditDisplay() {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("expected audit entry %q for %s", tc.expAudit, tc.target.Email)
+				}
+			}
+		})
+	}
+}
+
+func TestRestrictImpersonation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	h, err := render.New(ctx, envstest.ServerAssetsPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restrictImpersonation := middleware.RestrictImpersonation(h, "DELETE /impersonate", "/signout")
+
+	cases := []struct {
+		name          string
+		method        string
+		path          string
+		accept        string
+		impersonating bool
+		expCode       int
+	}{
+		{
+			name:    "not_impersonating",
+			method:  http.MethodPost,
+			path:    "/login/change-password",
+			expCode: http.StatusOK,
+		},
+		{
+			name:          "get",
+			method:        http.MethodGet,
+			path:          "/codes/issue",
+			impersonating: true,
+			expCode:       http.StatusOK,
+		},
+		{
+			name:          "head",
+			method:        http.MethodHead,
+			path:          "/codes/issue",
+			impersonating: true,
+			expCode:       http.StatusOK,
+		},
+		{
+			name:          "post",
+			method:        http.MethodPost,
+			path:          "/login/change-password",
+			impersonating: true,
+			expCode:       http.StatusForbidden,
+		},
+		{
+			name:          "post_json",
+			method:        http.MethodPost,
+			path:          "/codes/issue",
+			accept:        "application/json",
+			impersonating: true,
+			expCode:       http.StatusForbidden,
+		},
+		{
+			name:          "put",
+			method:        http.MethodPut,
+			path:          "/realm/settings",
+			impersonating: true,
+			expCode:       http.StatusForbidden,
+		},
+		{
+			name:          "patch",
+			method:        http.MethodPatch,
+			path:          "/realm/users/1",
+			impersonating: true,
+			expCode:       http.StatusForbidden,
+		},
+		{
+			name:          "delete",
+			method:        http.MethodDelete,
+			path:          "/realm/apikeys/1",
+			impersonating: true,
+			expCode:       http.StatusForbidden,
+		},
+		{
+			name:          "allowed_method_and_path",
+			method:        http.MethodDelete,
+			path:          "/impersonate",
+			impersonating: true,
+			expCode:       http.StatusOK,
+		},
+		{
+			name:          "allowed_path_wrong_method",
+			method:        http.MethodPost,
+			path:          "/impersonate",
+			impersonating: true,
+			expCode:       http.StatusForbidden,
+		},
+		{
+			name:          "allowed_path",
+			method:        http.MethodPost,
+			path:          "/signout",
+			impersonating: true,
+			expCode:       http.StatusOK,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := restrictImpersonation(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+
+			ctx := controller.WithSession(r.Context(), &sessions.Session{
+				Values:  map[interface{}]interface{}{},
+				Options: &sessions.Options{},
+			})
+			ctx = controller.WithUser(ctx, &database.User{Email: "target@example.com"})
+			if tc.impersonating {
+				ctx = controller.WithImpersonator(ctx, &database.User{Email: "admin@example.com", SystemAdmin: true})
+			}
+			r = r.Clone(ctx)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if got, want := w.Code, tc.expCode; got != want {
+				t.Errorf("expected status %d to be %d", got, want)
+			}
+		})
+	}
+}
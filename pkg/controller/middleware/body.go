@@ -0,0 +1,63 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// originalBodyKey is the context key for the request body before any limit
+// was applied.
+type originalBodyKey struct{}
+
+// LimitBodySize rejects requests with a declared Content-Length over maxBytes
+// and caps reads of the body at maxBytes for requests without one.
+//
+// The middleware may be applied again on a subrouter or route to change the
+// limit, for example to allow larger batch uploads. The innermost limit wins.
+func LimitBodySize(h *render.Renderer, maxBytes int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if r.ContentLength > maxBytes {
+				logger := logging.FromContext(ctx).Named("middleware.LimitBodySize")
+				logger.Debugw("request body too large", "size", r.ContentLength, "max", maxBytes)
+				controller.RequestEntityTooLarge(w, r, h)
+				return
+			}
+
+			// Wrap the original body so an outer limit does not apply to a route
+			// with a larger one.
+			body, ok := ctx.Value(originalBodyKey{}).(io.ReadCloser)
+			if !ok {
+				body = r.Body
+				ctx = context.WithValue(ctx, originalBodyKey{}, body)
+				r = r.Clone(ctx)
+			}
+			r.Body = http.MaxBytesReader(w, body, maxBytes)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
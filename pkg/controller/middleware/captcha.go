@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/captcha"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// CaptchaTokenHeader is the header API clients use to send a CAPTCHA token.
+const CaptchaTokenHeader = "X-Captcha-Token"
+
+// captchaFormFields are the form fields the reCAPTCHA and hCaptcha widgets
+// submit their token in.
+var captchaFormFields = []string{"g-recaptcha-response", "h-captcha-response"}
+
+// RequireCaptcha rejects requests without a valid CAPTCHA token when the
+// endpoint is listed in the CAPTCHA configuration, and does nothing otherwise.
+// If the provider cannot be reached, requests are allowed unless the
+// configuration fails closed. trustedProxies is the number of proxies in front
+// of the server, used to find the client IP.
+func RequireCaptcha(provider captcha.Provider, cfg *captcha.Config, h *render.Renderer, endpoint string, trustedProxies int) mux.MiddlewareFunc {
+	enabled := cfg.Enabled(endpoint)
+
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			logger := logging.FromContext(ctx).Named("middleware.RequireCaptcha")
+
+			err := provider.Verify(ctx, captchaToken(r), controller.ClientIP(r, trustedProxies))
+			switch {
+			case err == nil:
+			case errors.Is(err, captcha.ErrMissingToken), errors.Is(err, captcha.ErrInvalidToken):
+				logger.Debugw("captcha rejected", "endpoint", endpoint, "error", err)
+				controller.CaptchaFailed(w, r, h)
+				return
+			case cfg.FailClosed:
+				logger.Errorw("failed to verify captcha", "endpoint", endpoint, "error", err)
+				controller.CaptchaFailed(w, r, h)
+				return
+			default:
+				logger.Warnw("failed to verify captcha, allowing request", "endpoint", endpoint, "error", err)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// captchaToken returns the token from the header, or from the fields the
+// CAPTCHA widgets add to HTML forms.
+func captchaToken(r *http.Request) string {
+	if v := r.Header.Get(CaptchaTokenHeader); v != "" {
+		return v
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return ""
+	}
+	for _, field := range captchaFormFields {
+		if v := r.PostFormValue(field); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// uncompressedContentTypes are content types which are already compressed, or
+// are exports which handle their own encoding, and are sent as-is.
+var uncompressedContentTypes = []string{
+	"application/pdf",
+	"application/zip",
+	"application/gzip",
+	"text/csv",
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+}
+
+// CompressResponses compresses response bodies of at least minBytes with gzip
+// or deflate, whichever the client prefers in its Accept-Encoding header.
+//
+// Responses which are attachments, such as CSV and PDF exports, or which
+// already have a Content-Encoding are sent as-is. If the handler flushes the
+// response before minBytes are written, the response is streamed uncompressed.
+func CompressResponses(minBytes int) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minBytes:       minBytes,
+				status:         http.StatusOK,
+			}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the supported encoding with the highest q-value in
+// the Accept-Encoding header, preferring gzip on ties, or the empty string if
+// neither is accepted.
+func negotiateEncoding(header string) string {
+	var best string
+	var bestQ float64
+	for _, part := range strings.Split(header, ",") {
+		name, q := part, 1.0
+		if i := strings.Index(part, ";"); i != -1 {
+			name = part[:i]
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err != nil {
+					continue
+				}
+				q = v
+			}
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			name = encodingGzip
+		}
+		if (name != encodingGzip && name != encodingDeflate) || q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == encodingGzip) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until it reaches minBytes, and then
+// decides whether to compress it.
+type compressWriter struct {
+	http.ResponseWriter
+
+	encoding string
+	minBytes int
+
+	status      int
+	buf         []byte
+	decided     bool
+	wroteHeader bool
+	writer      io.WriteCloser
+}
+
+// WriteHeader records the status code. It is sent once the response is large
+// enough to decide whether to compress it.
+func (w *compressWriter) WriteHeader(code int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+}
+
+// Write buffers or compresses the data.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.minBytes {
+			return len(b), nil
+		}
+		if err := w.decide(w.shouldCompress()); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data. A response which is flushed before it is
+// large enough to compress is streamed uncompressed.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(false); err != nil {
+			return
+		}
+	}
+
+	if fw, ok := w.writer.(interface{ Flush() error }); ok {
+		_ = fw.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes any buffered data and finishes the compressed stream.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		return w.decide(false)
+	}
+	if w.writer != nil {
+		return w.writer.Close()
+	}
+	return nil
+}
+
+// shouldCompress returns true if the headers allow the response to be
+// compressed.
+func (w *compressWriter) shouldCompress() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.HasPrefix(strings.ToLower(h.Get("Content-Disposition")), "attachment") {
+		return false
+	}
+	if w.status < http.StatusOK || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+
+	contentType := strings.ToLower(h.Get("Content-Type"))
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf)
+	}
+	for _, t := range uncompressedContentTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide sends the headers and the buffered data, compressed or not.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+
+	if compress {
+		h := w.Header()
+		if h.Get("Content-Type") == "" {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", w.encoding)
+
+		switch w.encoding {
+		case encodingGzip:
+			w.writer = gzip.NewWriter(w.ResponseWriter)
+		case encodingDeflate:
+			// The "deflate" content coding is the zlib format (RFC 1950).
+			w.writer = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	if w.wroteHeader || len(w.buf) > 0 || w.writer != nil {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.writer != nil {
+		_, err := w.writer.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
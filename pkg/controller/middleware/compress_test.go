@@ -0,0 +1,282 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		header string
+		exp    string
+	}{
+		{name: "empty", header: "", exp: ""},
+		{name: "unsupported", header: "br", exp: ""},
+		{name: "gzip", header: "gzip", exp: encodingGzip},
+		{name: "deflate", header: "deflate", exp: encodingDeflate},
+		{name: "case_and_spaces", header: " GZip ", exp: encodingGzip},
+		{name: "wildcard", header: "*", exp: encodingGzip},
+		{name: "tie_prefers_gzip", header: "deflate, gzip", exp: encodingGzip},
+		{name: "tie_prefers_gzip_q", header: "deflate;q=0.5, gzip;q=0.5", exp: encodingGzip},
+		{name: "higher_q_wins", header: "gzip;q=0.4, deflate;q=0.8", exp: encodingDeflate},
+		{name: "q_zero_refuses", header: "gzip;q=0, deflate", exp: encodingDeflate},
+		{name: "all_q_zero", header: "gzip;q=0, deflate;q=0", exp: ""},
+		{name: "wildcard_q_zero", header: "*;q=0", exp: ""},
+		{name: "invalid_q_skipped", header: "gzip;q=abc, deflate;q=0.1", exp: encodingDeflate},
+		{name: "other_params", header: "gzip;level=1", exp: encodingGzip},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := negotiateEncoding(tc.header), tc.exp; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	t.Parallel()
+
+	const minBytes = 64
+	large := strings.Repeat("hello world ", 20)
+	small := "hello"
+
+	cases := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		handler        http.HandlerFunc
+		expEncoding    string
+		expStatus      int
+		expBody        string
+	}{
+		{
+			name:           "no_accept_encoding",
+			acceptEncoding: "",
+			handler:        writeBody(http.StatusOK, "text/plain", large),
+			expStatus:      http.StatusOK,
+			expBody:        large,
+		},
+		{
+			name:           "below_min_bytes",
+			acceptEncoding: "gzip",
+			handler:        writeBody(http.StatusOK, "text/plain", small),
+			expStatus:      http.StatusOK,
+			expBody:        small,
+		},
+		{
+			name:           "gzip",
+			acceptEncoding: "gzip",
+			handler:        writeBody(http.StatusOK, "text/plain", large),
+			expEncoding:    encodingGzip,
+			expStatus:      http.StatusOK,
+			expBody:        large,
+		},
+		{
+			name:           "deflate",
+			acceptEncoding: "deflate",
+			handler:        writeBody(http.StatusOK, "text/plain", large),
+			expEncoding:    encodingDeflate,
+			expStatus:      http.StatusOK,
+			expBody:        large,
+		},
+		{
+			name:           "preserves_status",
+			acceptEncoding: "gzip",
+			handler:        writeBody(http.StatusNotFound, "text/html", large),
+			expEncoding:    encodingGzip,
+			expStatus:      http.StatusNotFound,
+			expBody:        large,
+		},
+		{
+			name:           "preserves_status_uncompressed",
+			acceptEncoding: "gzip",
+			handler:        writeBody(http.StatusBadRequest, "text/html", small),
+			expStatus:      http.StatusBadRequest,
+			expBody:        small,
+		},
+		{
+			name:           "head",
+			method:         http.MethodHead,
+			acceptEncoding: "gzip",
+			handler:        writeBody(http.StatusOK, "text/plain", large),
+			expStatus:      http.StatusOK,
+			expBody:        large,
+		},
+		{
+			name:           "attachment",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Disposition", "attachment; filename=codes.txt")
+				writeBody(http.StatusOK, "text/plain", large)(w, r)
+			},
+			expStatus: http.StatusOK,
+			expBody:   large,
+		},
+		{
+			name:           "already_encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "identity")
+				writeBody(http.StatusOK, "text/plain", large)(w, r)
+			},
+			expEncoding: "identity",
+			expStatus:   http.StatusOK,
+			expBody:     large,
+		},
+		{
+			name:           "uncompressed_content_type",
+			acceptEncoding: "gzip",
+			handler:        writeBody(http.StatusOK, "text/csv", large),
+			expStatus:      http.StatusOK,
+			expBody:        large,
+		},
+		{
+			name:           "no_content",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:           "not_modified",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotModified)
+			},
+			expStatus: http.StatusNotModified,
+		},
+		{
+			name:           "flush_before_min_bytes",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, small)
+				w.(http.Flusher).Flush()
+				io.WriteString(w, large)
+			},
+			expStatus: http.StatusOK,
+			expBody:   small + large,
+		},
+		{
+			name:           "flush_after_min_bytes",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, large)
+				w.(http.Flusher).Flush()
+				io.WriteString(w, small)
+			},
+			expEncoding: encodingGzip,
+			expStatus:   http.StatusOK,
+			expBody:     large + small,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			if tc.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+
+			CompressResponses(minBytes)(tc.handler).ServeHTTP(w, r)
+
+			if got, want := w.Code, tc.expStatus; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := w.Header().Get("Content-Encoding"), tc.expEncoding; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if got, want := w.Header().Get("Vary"), "Accept-Encoding"; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if tc.expEncoding == encodingGzip || tc.expEncoding == encodingDeflate {
+				if got := w.Header().Get("Content-Length"); got != "" {
+					t.Errorf("expected no content-length, got %q", got)
+				}
+			}
+
+			if got, want := decodeBody(t, tc.expEncoding, w.Body.Bytes()), tc.expBody; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		})
+	}
+}
+
+// writeBody returns a handler which writes body with the given status and
+// content type.
+func writeBody(code int, contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", "1")
+		w.WriteHeader(code)
+		io.WriteString(w, body)
+	}
+}
+
+// decodeBody decompresses b according to the content encoding.
+func decodeBody(tb testing.TB, encoding string, b []byte) string {
+	tb.Helper()
+
+	var r io.Reader = bytes.NewReader(b)
+	switch encoding {
+	case encodingGzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		r = gr
+	case encodingDeflate:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		r = zr
+	}
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(out)
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/mux"
+)
+
+// LimitConcurrency rejects requests from an API key which already has as many
+// requests in flight as its realm allows.
+//
+// This must come after the authorized app and realm have been loaded in the
+// context, probably via RequireAPIKey.
+func LimitConcurrency(limiter *ratelimit.Concurrency, h *render.Renderer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			logger := logging.FromContext(ctx).Named("middleware.LimitConcurrency")
+
+			authApp := controller.AuthorizedAppFromContext(ctx)
+			if authApp == nil {
+				controller.MissingAuthorizedApp(w, r, h)
+				return
+			}
+
+			realm := controller.RealmFromContext(ctx)
+			if realm == nil {
+				controller.MissingRealm(w, r, h)
+				return
+			}
+
+			key := strconv.FormatUint(uint64(authApp.ID), 10)
+			release, ok := limiter.Acquire(ctx, key, realm.MaxConcurrentAPIKeyRequests)
+			if !ok {
+				logger.Warnw("api key exceeded concurrency limit",
+					"authorized_app", authApp.ID,
+					"limit", realm.MaxConcurrentAPIKeyRequests)
+				h.RenderJSON(w, http.StatusTooManyRequests,
+					api.Errorf("too many concurrent requests for this API key, limit is %d", realm.MaxConcurrentAPIKeyRequests).
+						WithCode(api.ErrConcurrencyLimitExceeded))
+				return
+			}
+			defer release()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -17,7 +17,6 @@ package middleware
 import (
 	"net"
 	"net/http"
-	"strings"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
@@ -29,8 +28,9 @@ import (
 // ProcessFirewall verifies the application-level firewall configuration.
 //
 // This must come after the realm has been loaded in the context, probably via a
-// different middleware.
-func ProcessFirewall(h *render.Renderer, typ string) mux.MiddlewareFunc {
+// different middleware. trustedProxies is the number of proxies in front of the
+// server, used to find the client IP.
+func ProcessFirewall(h *render.Renderer, typ string, trustedProxies int) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -63,18 +63,8 @@ func ProcessFirewall(h *render.Renderer, typ string) mux.MiddlewareFunc {
 
 			logger.Debugw("validating ip in cidr block", "type", typ)
 
-			// Get the remote address.
-			ipStr := r.RemoteAddr
-
-			// Check if x-forwarded-for exists, the load balancer sets this, and the
-			// first entry is the real client IP.
-			xff := r.Header.Get("x-forwarded-for")
-			if xff != "" {
-				ipStr = strings.Split(xff, ",")[0]
-			}
-
-			// Parse as an IP.
-			ip := net.ParseIP(ipStr)
+			// Parse the client address as an IP.
+			ip := net.ParseIP(controller.ClientIP(r, trustedProxies))
 			if ip == nil {
 				logger.Errorw("provided ip could not be parsed")
 			}
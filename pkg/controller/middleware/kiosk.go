@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// QueryKeyKiosk is the query parameter which puts the session in kiosk mode.
+	QueryKeyKiosk = "kiosk"
+)
+
+// kioskAllowedPaths are the pages which are available in kiosk mode, in
+// addition to anything under /login.
+var kioskAllowedPaths = map[string]struct{}{
+	"/codes/issue": {},
+}
+
+// ProcessKiosk puts the session in kiosk mode if the kiosk query parameter is
+// true. Once set, kiosk mode lasts until the session ends, so a kiosk user
+// cannot leave it by changing the URL. It also allows kiosk pages to be framed
+// by the given origins. It must come after RequireSession.
+func ProcessKiosk(frameAncestors []string, idleTTL time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			session := controller.SessionFromContext(ctx)
+			if session == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if v, _ := strconv.ParseBool(r.URL.Query().Get(QueryKeyKiosk)); v {
+				controller.StoreSessionKiosk(session, true)
+			}
+
+			if controller.KioskFromSession(session) {
+				ctx = withKiosk(ctx, w, frameAncestors, idleTTL)
+				r = r.Clone(ctx)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RestrictKiosk enforces kiosk mode. A request is in kiosk mode if the session
+// is, or if the current realm enables kiosk mode and the user is not a realm
+// admin. In kiosk mode, only issuing codes and login pages are available, and
+// sessions which are idle for longer than idleTTL are signed out. It must come
+// after RequireAuth and LoadCurrentRealm.
+func RestrictKiosk(h *render.Renderer, frameAncestors []string, idleTTL time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			logger := logging.FromContext(ctx).Named("middleware.RestrictKiosk")
+
+			if !controller.KioskFromContext(ctx) {
+				realm := controller.RealmFromContext(ctx)
+				user := controller.UserFromContext(ctx)
+				if realm == nil || user == nil || !realm.KioskMode || user.CanAdminRealm(realm.ID) {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				ctx = withKiosk(ctx, w, frameAncestors, idleTTL)
+				r = r.Clone(ctx)
+			}
+
+			session := controller.SessionFromContext(ctx)
+			if session == nil {
+				controller.MissingSession(w, r, h)
+				return
+			}
+
+			if t := controller.LastActivityFromSession(session); !t.IsZero() && time.Since(t) > idleTTL {
+				logger.Debugw("kiosk session is idle")
+				controller.Unauthorized(w, r, h)
+				return
+			}
+
+			if _, ok := kioskAllowedPaths[r.URL.Path]; !ok && !strings.HasPrefix(r.URL.Path, "/login") {
+				logger.Debugw("blocked page in kiosk mode", "method", r.Method, "path", r.URL.Path)
+				controller.KioskRestricted(w, r, h)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withKiosk marks the context as kiosk mode and sets the framing policy.
+func withKiosk(ctx context.Context, w http.ResponseWriter, frameAncestors []string, idleTTL time.Duration) context.Context {
+	if len(frameAncestors) > 0 {
+		w.Header().Del("X-Frame-Options")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors 'self' "+strings.Join(frameAncestors, " "))
+	}
+
+	ctx = controller.WithKiosk(ctx)
+
+	m := controller.TemplateMapFromContext(ctx)
+	m["kioskIdleSeconds"] = int64(idleTTL.Seconds())
+	return controller.WithTemplateMap(ctx, m)
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
@@ -88,12 +89,14 @@ func LoadCurrentRealm(cacher cache.Cacher, db *database.Database, h *render.Rend
 }
 
 // RequireRealm requires a realm to exist in the session. It also ensures the
-// realm is set as currentRealm in the template map.
+// realm is set as currentRealm in the template map. Users whose password is
+// older than the realm's rotation policy, or the server's in pwd if the realm
+// has none, are redirected to change it.
 //
 // Must come after:
 //   LoadCurrentRealm to populate the current realm.
 //   RequireAuth so that a user is set on the context.
-func RequireRealm(h *render.Renderer) mux.MiddlewareFunc {
+func RequireRealm(h *render.Renderer, pwd *config.PasswordRequirementsConfig) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -120,7 +123,7 @@ func RequireRealm(h *render.Renderer) mux.MiddlewareFunc {
 				return
 			}
 
-			if passwordRedirectRequired(ctx, currentUser, realm) {
+			if passwordRedirectRequired(ctx, currentUser, realm, pwd) {
 				controller.RedirectToChangePassword(w, r, h)
 				return
 			}
@@ -130,12 +133,13 @@ func RequireRealm(h *render.Renderer) mux.MiddlewareFunc {
 	}
 }
 
-// RequireRealmAdmin verifies the user is an admin of the current realm.
+// RequireRealmAdmin verifies the user is an admin of the current realm. Like
+// RequireRealm, it enforces the password rotation policy.
 //
 // Must come after:
 //   LoadCurrentRealm to populate the current realm.
 //   RequireAuth so that a user is set on the context.
-func RequireRealmAdmin(h *render.Renderer) mux.MiddlewareFunc {
+func RequireRealmAdmin(h *render.Renderer, pwd *config.PasswordRequirementsConfig) mux.MiddlewareFunc {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -162,7 +166,7 @@ func RequireRealmAdmin(h *render.Renderer) mux.MiddlewareFunc {
 				return
 			}
 
-			if passwordRedirectRequired(ctx, currentUser, realm) {
+			if passwordRedirectRequired(ctx, currentUser, realm, pwd) {
 				controller.RedirectToChangePassword(w, r, h)
 				return
 			}
@@ -172,12 +176,18 @@ func RequireRealmAdmin(h *render.Renderer) mux.MiddlewareFunc {
 	}
 }
 
-func passwordRedirectRequired(ctx context.Context, user *database.User, realm *database.Realm) bool {
-	err := checkRealmPasswordAge(user, realm)
+func passwordRedirectRequired(ctx context.Context, user *database.User, realm *database.Realm, pwd *config.PasswordRequirementsConfig) bool {
+	// Users who sign in with single sign-on do not have a password here.
+	session := controller.SessionFromContext(ctx)
+	if controller.SSOFromSession(session) {
+		return false
+	}
+
+	periodDays, warningDays := realm.EffectivePasswordRotation(pwd.RotationPeriodDays, pwd.RotationWarningDays)
+	err := checkPasswordAge(user, periodDays, warningDays)
 	if err == nil {
 		return false
 	}
-	session := controller.SessionFromContext(ctx)
 	flash := controller.Flash(session)
 
 	if err == errPasswordChangeRequired {
@@ -194,21 +204,21 @@ func passwordRedirectRequired(ctx context.Context, user *database.User, realm *d
 
 var errPasswordChangeRequired = errors.New("password change required")
 
-func checkRealmPasswordAge(user *database.User, realm *database.Realm) error {
-	if realm.PasswordRotationPeriodDays <= 0 {
+func checkPasswordAge(user *database.User, periodDays, warningDays uint) error {
+	if periodDays <= 0 {
 		return nil
 	}
 
 	now := time.Now().UTC()
 	nextPasswordChange := user.PasswordChanged().Add(
-		time.Hour * 24 * time.Duration(realm.PasswordRotationPeriodDays))
+		time.Hour * 24 * time.Duration(periodDays))
 
 	if now.After(nextPasswordChange) {
 		return errPasswordChangeRequired
 	}
 
 	if time.Until(nextPasswordChange) <
-		time.Hour*24*time.Duration(realm.PasswordRotationWarningDays) {
+		time.Hour*24*time.Duration(warningDays) {
 		untilChange := nextPasswordChange.Sub(now).Hours()
 		if daysUntilChange := int(untilChange / 24); daysUntilChange > 1 {
 			return fmt.Errorf("password change required in %d days", daysUntilChange)
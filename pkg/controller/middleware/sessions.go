@@ -20,7 +20,9 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
 
 	"github.com/gorilla/sessions"
@@ -36,7 +38,15 @@ const (
 // request's context for future retrieval. It also ensures the flash data is
 // populated in the template map. Any handler that wants to utilize sessions
 // should use this middleware.
-func RequireSession(store sessions.Store, h *render.Renderer) func(http.Handler) http.Handler {
+//
+// If the session references a server-side session record which is revoked,
+// expired, or missing, the session is replaced with an empty one so the user is
+// treated as logged out. The record is cached briefly, and the cache is purged
+// when the record is revoked or deleted. trustedProxies is the number of proxies
+// in front of the server, used to find the client IP.
+func RequireSession(store sessions.Store, cacher cache.Cacher, db *database.Database, h *render.Renderer, trustedProxies int) func(http.Handler) http.Handler {
+	cacheTTL := 30 * time.Second
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx := r.Context()
@@ -55,6 +65,36 @@ func RequireSession(store sessions.Store, h *render.Renderer) func(http.Handler)
 				session, _ = store.New(r, sessionName)
 			}
 
+			// Check the server-side session record, if there is one.
+			if id := controller.UserSessionIDFromSession(session); id != "" {
+				var userSession database.UserSession
+				cacheKey := &cache.Key{
+					Namespace: "user_sessions:by_session_id",
+					Key:       id,
+				}
+				err := cacher.Fetch(ctx, cacheKey, &userSession, cacheTTL, func() (interface{}, error) {
+					return db.FindUserSession(id)
+				})
+				if err != nil && !database.IsNotFound(err) {
+					logger.Errorw("failed to find user session", "error", err)
+					controller.InternalError(w, r, h, err)
+					return
+				}
+
+				switch {
+				case err != nil || !userSession.IsActive():
+					logger.Debugw("user session is no longer active")
+
+					// Discard the error for the same reason as above.
+					session, _ = store.New(r, sessionName)
+					controller.Flash(session).Alert("Your session has ended. Please sign in again.")
+				case userSession.NeedsTouch(controller.RealmIDFromSession(session), controller.ClientIP(r, trustedProxies)):
+					if err := db.TouchUserSession(&userSession, controller.RealmIDFromSession(session), controller.ClientIP(r, trustedProxies)); err != nil {
+						logger.Errorw("failed to update user session", "error", err)
+					}
+				}
+			}
+
 			// Save the flash in the template map.
 			m := controller.TemplateMapFromContext(ctx)
 			m["flash"] = controller.Flash(session)
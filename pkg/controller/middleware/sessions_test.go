@@ -0,0 +1,136 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/envstest"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller/middleware"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+
+	"github.com/gorilla/sessions"
+)
+
+// testStore is a sessions.Store which always returns the same session from Get,
+// and never persists anything.
+type testStore struct {
+	session *sessions.Session
+}
+
+func (s *testStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	if s.session == nil {
+		return s.New(r, name)
+	}
+	return s.session, nil
+}
+
+func (s *testStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	session.Options = &sessions.Options{}
+	session.IsNew = true
+	return session, nil
+}
+
+func (s *testStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return nil
+}
+
+func TestRequireSession_Revoked(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cacher, err := cache.NewInMemory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := testDatabaseInstance.NewDatabase(t, cacher)
+
+	h, err := render.New(ctx, envstest.ServerAssetsPath(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &database.User{Email: "session@example.com", Name: "Session"}
+	if err := db.SaveUser(user, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	userSession, err := db.CreateUserSession(user.ID, 0, "198.51.100.7", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := new(testStore)
+	store.session, _ = store.New(nil, "test")
+	store.session.IsNew = false
+	controller.StoreSessionUserSessionID(store.session, userSession.SessionID)
+
+	requireSession := middleware.RequireSession(store, cacher, db, h, 0)
+
+	// serve returns the session which the next handler received.
+	serve := func(t *testing.T) *sessions.Session {
+		t.Helper()
+
+		var got *sessions.Session
+		handler := requireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = controller.SessionFromContext(r.Context())
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "198.51.100.7:4321"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if got == nil {
+			t.Fatal("expected session on the context")
+		}
+		return got
+	}
+
+	// While the session is active, it is used as-is. This also caches the
+	// session record.
+	if got := serve(t); got != store.session {
+		t.Fatalf("expected the existing session")
+	}
+
+	if _, err := db.RevokeUserSession(userSession.ID, database.SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once revoked, the request gets a fresh session, even though the active
+	// record was cached.
+	got := serve(t)
+	if got == store.session {
+		t.Fatalf("expected a new session")
+	}
+	if !got.IsNew {
+		t.Errorf("expected session to be new")
+	}
+	if id := controller.UserSessionIDFromSession(got); id != "" {
+		t.Errorf("expected no user session id, got %q", id)
+	}
+	if alerts := controller.Flash(got).Alerts(); len(alerts) != 1 {
+		t.Errorf("expected 1 alert, got %v", alerts)
+	}
+}
@@ -16,6 +16,7 @@ package middleware
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/buildinfo"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
@@ -39,6 +40,10 @@ func PopulateTemplateVariables(config *config.ServerConfig) mux.MiddlewareFunc {
 			m["buildTag"] = buildinfo.BuildTag
 			m["maintenanceMode"] = config.MaintenanceMode
 
+			// Times are displayed in UTC unless a realm with a configured timezone
+			// is loaded later in the chain.
+			m["realmTimezone"] = time.UTC
+
 			// Save the template map on the context.
 			ctx = controller.WithTemplateMap(ctx, m)
 			r = r.Clone(ctx)
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opencensus.io/plugin/ochttp"
+	"go.opencensus.io/trace"
+)
+
+// TraceRequests starts a server span for each request, named after the matched
+// route so that IDs in the path are not recorded. Incoming trace headers are
+// ignored, since clients of public APIs should not decide what is sampled.
+//
+// If sampleErrors is true and a request which was not sampled fails with a
+// server error, a sampled span is recorded in the same trace, so failures are
+// visible regardless of the sampling rate.
+func TraceRequests(sampleErrors bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := r.Method + " " + routeTemplate(r)
+			ctx, span := trace.StartSpan(r.Context(), name, trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+
+			start := time.Now()
+			sw := &traceStatusWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r.Clone(ctx))
+
+			attrs := []trace.Attribute{
+				trace.StringAttribute(ochttp.MethodAttribute, r.Method),
+				trace.StringAttribute(ochttp.PathAttribute, routeTemplate(r)),
+				trace.Int64Attribute(ochttp.StatusCodeAttribute, int64(sw.code)),
+			}
+			status := ochttp.TraceStatus(sw.code, "")
+
+			if span.SpanContext().IsSampled() {
+				span.AddAttributes(attrs...)
+				span.SetStatus(status)
+				return
+			}
+
+			if !sampleErrors || sw.code < http.StatusInternalServerError {
+				return
+			}
+
+			// The request's own span cannot be sampled after it started, so record
+			// the failure in a child which is always sampled.
+			_, errSpan := trace.StartSpanWithRemoteParent(ctx, name+" (error)", span.SpanContext(),
+				trace.WithSampler(trace.AlwaysSample()),
+				trace.WithSpanKind(trace.SpanKindServer))
+			errSpan.AddAttributes(attrs...)
+			errSpan.AddAttributes(trace.Int64Attribute("duration_ms", time.Since(start).Milliseconds()))
+			errSpan.SetStatus(status)
+			errSpan.End()
+		})
+	}
+}
+
+// routeTemplate returns the path template of the matched route, or "unknown"
+// if no route matched.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unknown"
+}
+
+// traceStatusWriter records the status code of the response.
+type traceStatusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *traceStatusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
@@ -30,6 +30,8 @@ func (c *Controller) HandleCreate() http.Handler {
 		OS    database.OSType `form:"os"`
 		AppID string          `form:"app_id"`
 		SHA   string          `form:"sha"`
+
+		MinVersion string `form:"min_version"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -69,6 +71,8 @@ func (c *Controller) HandleCreate() http.Handler {
 				OS:    form.OS,
 				AppID: form.AppID,
 				SHA:   form.SHA,
+
+				MinVersion: form.MinVersion,
 			}
 
 			flash.Error("Failed to process form: %v", err)
@@ -84,6 +88,8 @@ func (c *Controller) HandleCreate() http.Handler {
 			OS:      form.OS,
 			AppID:   form.AppID,
 			SHA:     form.SHA,
+
+			MinVersion: form.MinVersion,
 		}
 
 		if err := c.db.SaveMobileApp(app, currentUser); err != nil {
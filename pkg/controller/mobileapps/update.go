@@ -32,6 +32,8 @@ func (c *Controller) HandleUpdate() http.Handler {
 		OS    database.OSType `form:"os"`
 		AppID string          `form:"app_id"`
 		SHA   string          `form:"sha"`
+
+		MinVersion string `form:"min_version"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -94,6 +96,7 @@ func (c *Controller) HandleUpdate() http.Handler {
 		app.OS = form.OS
 		app.AppID = form.AppID
 		app.SHA = form.SHA
+		app.MinVersion = form.MinVersion
 
 		// Save
 		if err := c.db.SaveMobileApp(app, currentUser); err != nil {
@@ -199,12 +199,17 @@ func (c *Controller) rebuildModel(ctx context.Context, id uint64) error {
 
 	logger.Debugw("next effective limit", "value", effective)
 
-	// Update the limiter to use the new value.
-	key, err := realm.QuotaKey(c.config.RateLimit.HMACKey)
+	// Configure the bucket for the realm's next local day with the new value.
+	// The current day's bucket is left alone so the quota only resets at the
+	// realm's local midnight.
+	now := time.Now()
+	_, tomorrow := realm.QuotaDay(now)
+	_, tomorrowEnd := realm.QuotaDay(tomorrow)
+	key, err := realm.DailyQuotaKey(c.config.RateLimit.HMACKey, tomorrow)
 	if err != nil {
 		return fmt.Errorf("failed to digest realm id: %w", err)
 	}
-	if err := c.limiter.Set(ctx, key, uint64(effective), 24*time.Hour); err != nil {
+	if err := c.limiter.Set(ctx, key, uint64(effective), tomorrowEnd.Sub(now)); err != nil {
 		return fmt.Errorf("failed to update limit: %w", err)
 	}
 
@@ -16,7 +16,10 @@ package realmadmin
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -35,41 +38,92 @@ func (c *Controller) HandleEvents() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
 		realm := controller.RealmFromContext(ctx)
 		if realm == nil {
 			controller.MissingRealm(w, r, c.h)
 			return
 		}
 
-		var scopes []database.Scope
-		from := r.FormValue(QueryFromSearch)
-		to := r.FormValue(QueryToSearch)
-		scopes = append(scopes, database.WithAuditTime(from, to))
-
 		pageParams, err := pagination.FromRequest(r)
 		if err != nil {
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
 
-		events, paginator, err := realm.ListAudits(c.db, pageParams, scopes...)
+		var events []*database.AuditEntry
+		var paginator *pagination.Paginator
+		q, err := controller.AuditLogQueryFromRequest(r)
+		if err == nil {
+			events, paginator, err = c.db.QueryAuditLog(q, pageParams, database.WithAuditRealmID(realm.ID))
+		}
+		if err != nil {
+			if !errors.Is(err, database.ErrInvalidAuditLogQuery) {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+			flash.Error("Failed to search events: %v", err)
+		}
+
+		c.renderEvents(ctx, w, r, realm, events, paginator)
+	})
+}
+
+// HandleEventsExport exports the realm's events which match the query as CSV,
+// up to database.MaxAuditExportEntries.
+func (c *Controller) HandleEventsExport() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		pageParams := &pagination.PageParams{
+			Page:  0,
+			Limit: database.MaxAuditExportEntries,
+		}
+
+		var events []*database.AuditEntry
+		q, err := controller.AuditLogQueryFromRequest(r)
+		if err == nil {
+			events, _, err = c.db.QueryAuditLog(q, pageParams, database.WithAuditRealmID(realm.ID))
+		}
 		if err != nil {
+			if errors.Is(err, database.ErrInvalidAuditLogQuery) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			controller.InternalError(w, r, c.h, err)
 			return
 		}
 
-		c.renderEvents(ctx, w, realm, events, paginator, from, to)
+		filename := fmt.Sprintf("%s-events.csv", time.Now().UTC().Format("20060102150405"))
+		c.h.RenderCSV(w, http.StatusOK, filename, database.AuditEntries(events))
 	})
 }
 
-func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter,
-	realm *database.Realm, events []*database.AuditEntry, paginator *pagination.Paginator, from, to string) {
+func (c *Controller) renderEvents(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	realm *database.Realm, events []*database.AuditEntry, paginator *pagination.Paginator) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Events")
 	m["user"] = realm
 	m["events"] = events
 	m["paginator"] = paginator
-	m[QueryFromSearch] = from
-	m[QueryToSearch] = to
+	m[QueryFromSearch] = r.FormValue(QueryFromSearch)
+	m[QueryToSearch] = r.FormValue(QueryToSearch)
+	m["queryActorID"] = r.FormValue(controller.QueryAuditActorID)
+	m["queryAction"] = r.FormValue(controller.QueryAuditAction)
+	m["queryTargetID"] = r.FormValue(controller.QueryAuditTargetID)
+	m["exportQuery"] = r.URL.RawQuery
+	m["maxQueryDays"] = int(database.MaxAuditQueryWindow / (24 * time.Hour))
 	c.h.RenderHTML(w, "realmadmin/events", m)
 }
@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleExportsIndex lists the realm's scheduled exports along with the form
+// to create one, and creates the export when the form is submitted.
+func (c *Controller) HandleExportsIndex() http.Handler {
+	type FormData struct {
+		Scope       string `form:"scope"`
+		Format      string `form:"format"`
+		RangeDays   uint   `form:"range_days"`
+		Frequency   string `form:"frequency"`
+		Destination string `form:"destination"`
+		Bucket      string `form:"bucket"`
+		Prefix      string `form:"prefix"`
+		Emails      string `form:"emails"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if !c.config.EnableScheduledExports {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		schedule := &database.ExportSchedule{
+			RealmID:     realm.ID,
+			Scope:       database.ExportScopeRealm,
+			Format:      database.ExportFormatCSV,
+			RangeDays:   30,
+			Frequency:   database.ExportFrequencyWeekly,
+			Destination: database.ExportDestinationEmail,
+		}
+
+		if r.Method == http.MethodGet {
+			c.renderExports(ctx, w, r, realm, schedule)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			c.renderExports(ctx, w, r, realm, schedule)
+			return
+		}
+
+		schedule.Scope = database.ExportScope(form.Scope)
+		schedule.Format = database.ExportFormat(form.Format)
+		schedule.RangeDays = form.RangeDays
+		schedule.Frequency = database.ExportFrequency(form.Frequency)
+		schedule.Destination = database.ExportDestination(form.Destination)
+		schedule.Bucket = form.Bucket
+		schedule.Prefix = form.Prefix
+		schedule.Emails = strings.FieldsFunc(form.Emails, func(r rune) bool {
+			return r == '\n' || r == ','
+		})
+
+		if err := c.db.SaveExportSchedule(schedule, currentUser); err != nil {
+			flash.Error("Failed to create export: %v", err)
+			c.renderExports(ctx, w, r, realm, schedule)
+			return
+		}
+
+		flash.Alert("Successfully scheduled %s export.", schedule.Display())
+		http.Redirect(w, r, "/realm/exports", http.StatusSeeOther)
+	})
+}
+
+// HandleExportsDelete deletes a scheduled export.
+func (c *Controller) HandleExportsDelete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		if !c.config.EnableScheduledExports {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		schedule, err := realm.FindExportSchedule(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteExportSchedule(schedule, currentUser); err != nil {
+			flash.Error("Failed to delete export: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Successfully deleted %s export.", schedule.Display())
+		http.Redirect(w, r, "/realm/exports", http.StatusSeeOther)
+	})
+}
+
+func (c *Controller) renderExports(ctx context.Context, w http.ResponseWriter, r *http.Request, realm *database.Realm, schedule *database.ExportSchedule) {
+	schedules, err := realm.ListExportSchedules(c.db)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Scheduled exports")
+	m["schedule"] = schedule
+	m["schedules"] = schedules
+	c.h.RenderHTML(w, "realmadmin/exports", m)
+}
@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	// Register decoders for the accepted logo formats.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+)
+
+const (
+	// maxLogoBytes is the largest logo file accepted.
+	maxLogoBytes = 512 * 1024
+
+	// maxLogoPixels is the largest width or height of an accepted logo.
+	maxLogoPixels = 2048
+)
+
+// logoTypes are the accepted logo content types and their file extensions.
+// SVG is not accepted since it can contain scripts.
+var logoTypes = map[string]string{
+	"image/gif":  ".gif",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// HandleLogoUpload stores an uploaded logo in the asset bucket and sets its
+// public URL on the realm.
+func (c *Controller) HandleLogoUpload() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if c.config.AssetBucket == "" {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		f, _, err := r.FormFile("logo")
+		if err != nil {
+			flash.Error("Failed to read logo: %v", err)
+			http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+			return
+		}
+		defer f.Close()
+
+		b, err := ioutil.ReadAll(io.LimitReader(f, maxLogoBytes+1))
+		if err != nil {
+			flash.Error("Failed to read logo: %v", err)
+			http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+			return
+		}
+
+		contentType, ext, err := validateLogo(b)
+		if err != nil {
+			flash.Error("Invalid logo: %v", err)
+			http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+			return
+		}
+
+		// Name the object by its contents, so a new logo gets a new URL and is
+		// not hidden by a cached copy of the old one.
+		object := fmt.Sprintf("realms/%d/logo-%x%s", realm.ID, sha256.Sum256(b), ext)
+		if err := c.blobstore.CreateObject(ctx, c.config.AssetBucket, object, contentType, b); err != nil {
+			controller.InternalError(w, r, c.h, fmt.Errorf("failed to store logo: %w", err))
+			return
+		}
+
+		realm.LogoURL = c.config.AssetURL(object)
+		if err := c.db.SaveRealm(realm, currentUser); err != nil {
+			flash.Error("Failed to update realm: %v", err)
+			http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+			return
+		}
+
+		flash.Alert("Successfully updated logo.")
+		http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+	})
+}
+
+// HandleLogoDelete removes the realm's logo. The stored object is left in the
+// bucket.
+func (c *Controller) HandleLogoDelete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		realm.LogoURL = ""
+		if err := c.db.SaveRealm(realm, currentUser); err != nil {
+			flash.Error("Failed to update realm: %v", err)
+			http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+			return
+		}
+
+		flash.Alert("Successfully removed logo.")
+		http.Redirect(w, r, "/realm/settings#general", http.StatusSeeOther)
+	})
+}
+
+// validateLogo checks the size, content type, and dimensions of the logo. The
+// content type is detected from the contents, not the file name or the type
+// sent by the browser, and the image must decode as that type.
+func validateLogo(b []byte) (string, string, error) {
+	if len(b) == 0 {
+		return "", "", fmt.Errorf("file is empty")
+	}
+	if len(b) > maxLogoBytes {
+		return "", "", fmt.Errorf("file must be %d KB or smaller", maxLogoBytes/1024)
+	}
+
+	contentType := http.DetectContentType(b)
+	ext, ok := logoTypes[contentType]
+	if !ok {
+		return "", "", fmt.Errorf("file must be a PNG, JPEG, or GIF image, got %s", contentType)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if "image/"+format != contentType {
+		return "", "", fmt.Errorf("image format %s does not match %s", format, contentType)
+	}
+	if cfg.Width > maxLogoPixels || cfg.Height > maxLogoPixels {
+		return "", "", fmt.Errorf("image must be %dx%d pixels or smaller", maxLogoPixels, maxLogoPixels)
+	}
+
+	return contentType, ext, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestValidateLogo(t *testing.T) {
+	t.Parallel()
+
+	encode := func(t *testing.T, w, h int) []byte {
+		t.Helper()
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	cases := []struct {
+		name string
+		data func(t *testing.T) []byte
+		err  bool
+	}{
+		{
+			name: "png",
+			data: func(t *testing.T) []byte { return encode(t, 64, 64) },
+		},
+		{
+			name: "empty",
+			data: func(t *testing.T) []byte { return nil },
+			err:  true,
+		},
+		{
+			name: "svg",
+			data: func(t *testing.T) []byte {
+				return []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+			},
+			err: true,
+		},
+		{
+			name: "truncated",
+			data: func(t *testing.T) []byte { return encode(t, 64, 64)[:20] },
+			err:  true,
+		},
+		{
+			name: "too_large",
+			data: func(t *testing.T) []byte { return encode(t, maxLogoPixels+1, 1) },
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			contentType, ext, err := validateLogo(tc.data(t))
+			if tc.err {
+				if err == nil {
+					t.Errorf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentType != "image/png" || ext != ".png" {
+				t.Errorf("expected image/png and .png, got %s and %s", contentType, ext)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ package realmadmin
 import (
 	"context"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/blobstore"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -26,19 +27,21 @@ import (
 )
 
 type Controller struct {
-	cacher  cache.Cacher
-	config  *config.ServerConfig
-	db      *database.Database
-	h       *render.Renderer
-	limiter limiter.Store
+	blobstore blobstore.Blobstore
+	cacher    cache.Cacher
+	config    *config.ServerConfig
+	db        *database.Database
+	h         *render.Renderer
+	limiter   limiter.Store
 }
 
-func New(ctx context.Context, cacher cache.Cacher, config *config.ServerConfig, db *database.Database, limiter limiter.Store, h *render.Renderer) *Controller {
+func New(ctx context.Context, cacher cache.Cacher, config *config.ServerConfig, db *database.Database, limiter limiter.Store, bs blobstore.Blobstore, h *render.Renderer) *Controller {
 	return &Controller{
-		cacher:  cacher,
-		config:  config,
-		db:      db,
-		h:       h,
-		limiter: limiter,
+		blobstore: bs,
+		cacher:    cacher,
+		config:    config,
+		db:        db,
+		h:         h,
+		limiter:   limiter,
 	}
 }
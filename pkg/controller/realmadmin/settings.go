@@ -18,12 +18,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/email"
+	"github.com/google/exposure-notifications-verification-server/pkg/outbound"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/sms"
 )
 
@@ -35,6 +38,9 @@ var (
 	mfaGracePeriod              = []int64{0, 1, 7, 30}
 	passwordRotationPeriodDays  = []int{0, 30, 60, 90, 365}
 	passwordRotationWarningDays = []int{0, 1, 3, 5, 7, 30}
+	duplicateExternalIDHours    = []int{1, 4, 8, 12, 24, 48, 72, 168, 336}
+	issuanceApprovalHours       = []int{1, 2, 4, 8, 12, 24}
+	tokenDurationHours          = []int{0, 1, 4, 8, 12, 24, 48, 72, 168, 336}
 )
 
 func init() {
@@ -48,24 +54,75 @@ func init() {
 
 func (c *Controller) HandleSettings() http.Handler {
 	type FormData struct {
-		General        bool   `form:"general"`
-		Name           string `form:"name"`
-		RegionCode     string `form:"region_code"`
-		WelcomeMessage string `form:"welcome_message"`
-
-		Codes                 bool              `form:"codes"`
-		AllowedTestTypes      database.TestType `form:"allowed_test_types"`
-		AllowBulkUpload       bool              `form:"allow_bulk"`
-		RequireDate           bool              `form:"require_date"`
-		CodeLength            uint              `form:"code_length"`
-		CodeDurationMinutes   int64             `form:"code_duration"`
-		LongCodeLength        uint              `form:"long_code_length"`
-		LongCodeDurationHours int64             `form:"long_code_duration"`
-		SMSTextTemplate       string            `form:"sms_text_template"`
+		General                            bool   `form:"general"`
+		Name                               string `form:"name"`
+		RegionCode                         string `form:"region_code"`
+		WelcomeMessage                     string `form:"welcome_message"`
+		IssueConfirmationMessage           string `form:"issue_confirmation_message"`
+		LocalizedIssueConfirmationMessages string `form:"localized_issue_confirmation_messages"`
+		Timezone                           string `form:"timezone"`
+
+		Codes                 bool                          `form:"codes"`
+		AllowedTestTypes      database.TestType             `form:"allowed_test_types"`
+		ConfirmedSunset       string                        `form:"confirmed_sunset"`
+		LikelySunset          string                        `form:"likely_sunset"`
+		NegativeSunset        string                        `form:"negative_sunset"`
+		NegativeResultPolicy  database.NegativeResultPolicy `form:"negative_result_policy"`
+		AllowBulkUpload       bool                          `form:"allow_bulk"`
+		RequireDate           bool                          `form:"require_date"`
+		AutofillTestDate      bool                          `form:"autofill_test_date"`
+		TestDateOffsetDays    uint                          `form:"test_date_offset_days"`
+		EnforceDateOrder      bool                          `form:"enforce_date_order"`
+		MaxTestBeforeSymptom  int                           `form:"max_test_before_symptom_days"`
+		FutureDateTolerance   int64                         `form:"future_date_tolerance"`
+		RejectDuplicateExtID  bool                          `form:"reject_duplicate_external_id"`
+		DuplicateExtIDHours   int64                         `form:"duplicate_external_id_window"`
+		MaxCodesPerExtID      uint                          `form:"max_codes_per_external_id"`
+		MaxClaimsPerCode      uint                          `form:"max_claims_per_code"`
+		MaxMetadataKeys       uint                          `form:"max_metadata_keys"`
+		MaxMetadataBytes      uint                          `form:"max_metadata_bytes"`
+		MaxExternalIDLength   uint                          `form:"max_external_id_length"`
+		RequireExternalID     bool                          `form:"require_external_id"`
+		ExternalIDFormat      string                        `form:"external_id_format"`
+		MaxActiveCodes        uint                          `form:"max_active_codes"`
+		IssueLimitPerMinute   uint                          `form:"issue_limit_per_minute"`
+		IssueLimitPerHour     uint                          `form:"issue_limit_per_hour"`
+		IssueLimitPerDay      uint                          `form:"issue_limit_per_day"`
+		QuietHours            string                        `form:"quiet_hours"`
+		RequireApproval       bool                          `form:"require_issuance_approval"`
+		ApprovalTimeoutHours  int64                         `form:"issuance_approval_timeout"`
+		RequireDeviceBinding  bool                          `form:"require_device_binding"`
+		MaxFailedClaims       uint                          `form:"max_failed_claim_attempts"`
+		MinClaimInterval      uint                          `form:"min_claim_interval_seconds"`
+		ExternalIDClaimLimit  uint                          `form:"claim_limit_per_external_id"`
+		AllowedClaimAppIDs    string                        `form:"allowed_claim_app_ids"`
+		AllowedClaimCountries string                        `form:"allowed_claim_countries"`
+		EnforceClaimCountries bool                          `form:"enforce_claim_countries"`
+		ClaimResponseMapping  string                        `form:"claim_response_mapping"`
+		ReportTypeMapping     string                        `form:"report_type_mapping"`
+		ClaimRedirectURL      string                        `form:"claim_redirect_url"`
+		CodeLength            uint                          `form:"code_length"`
+		CodeDurationMinutes   int64                         `form:"code_duration"`
+		DisableLongCodes      bool                          `form:"disable_long_codes"`
+		DisableShortClaims    bool                          `form:"disable_short_code_claims"`
+		CaseInsensitiveCodes  bool                          `form:"case_insensitive_codes"`
+		CodeSeparators        string                        `form:"code_separators"`
+		StrictCodeExpiry      bool                          `form:"strict_code_expiry"`
+		LongCodeLength        uint                          `form:"long_code_length"`
+		LongCodeDurationHours int64                         `form:"long_code_duration"`
+		TokenDurationHours    int64                         `form:"token_duration"`
+		TokenIssuer           string                        `form:"token_issuer"`
+		TokenAudience         string                        `form:"token_audience"`
+		DeepLinkScheme        string                        `form:"deep_link_scheme"`
+		DeepLinkHost          string                        `form:"deep_link_host"`
+		DeepLinkMetadataKeys  string                        `form:"deep_link_metadata_keys"`
+		SMSTextTemplate       string                        `form:"sms_text_template"`
+		SMSTextTemplates      string                        `form:"sms_text_templates"`
 
 		SMS                bool   `form:"sms"`
 		UseSystemSMSConfig bool   `form:"use_system_sms_config"`
 		SMSCountry         string `form:"sms_country"`
+		SMSFailurePolicy   int16  `form:"sms_failure_policy"`
 		TwilioAccountSid   string `form:"twilio_account_sid"`
 		TwilioAuthToken    string `form:"twilio_auth_token"`
 		TwilioFromNumber   string `form:"twilio_from_number"`
@@ -77,6 +134,9 @@ func (c *Controller) HandleSettings() http.Handler {
 		SMTPHost             string `form:"smtp_host"`
 		SMTPPort             string `form:"smtp_port"`
 		EmailInviteTemplate  string `form:"email_invite_template"`
+		EnableEmailCodes     bool   `form:"enable_email_codes"`
+		EmailCodeTemplate    string `form:"email_code_template"`
+		EmailCodeTemplates   string `form:"email_code_templates"`
 
 		Security                    bool   `form:"security"`
 		MFAMode                     int16  `form:"mfa_mode"`
@@ -87,6 +147,10 @@ func (c *Controller) HandleSettings() http.Handler {
 		AllowedCIDRsAdminAPI        string `form:"allowed_cidrs_adminapi"`
 		AllowedCIDRsAPIServer       string `form:"allowed_cidrs_apiserver"`
 		AllowedCIDRsServer          string `form:"allowed_cidrs_server"`
+		AllowedCIDRsIssue           string `form:"allowed_cidrs_issue"`
+		MaxConcurrentAPIKeyRequests uint   `form:"max_concurrent_api_key_requests"`
+		KioskMode                   bool   `form:"kiosk_mode"`
+		SignCertificateResponses    bool   `form:"sign_certificate_responses"`
 
 		AbusePrevention            bool    `form:"abuse_prevention"`
 		AbusePreventionEnabled     bool    `form:"abuse_prevention_enabled"`
@@ -118,7 +182,7 @@ func (c *Controller) HandleSettings() http.Handler {
 
 		var quotaLimit, quotaRemaining uint64
 		if realm.AbusePreventionEnabled {
-			key, err := realm.QuotaKey(c.config.RateLimit.HMACKey)
+			key, err := realm.DailyQuotaKey(c.config.RateLimit.HMACKey, time.Now())
 			if err != nil {
 				controller.InternalError(w, r, c.h, err)
 				return
@@ -148,15 +212,121 @@ func (c *Controller) HandleSettings() http.Handler {
 			realm.Name = form.Name
 			realm.RegionCode = form.RegionCode
 			realm.WelcomeMessage = form.WelcomeMessage
+			realm.IssueConfirmationMessage = form.IssueConfirmationMessage
+
+			localized, err := database.ParseLocalizedMessages(form.LocalizedIssueConfirmationMessages)
+			if err != nil {
+				realm.AddError("localizedIssueConfirmationMessages", err.Error())
+				flash.Error("Failed to update realm")
+				c.renderSettings(ctx, w, r, realm, nil, nil, quotaLimit, quotaRemaining)
+				return
+			}
+			realm.LocalizedIssueConfirmationMessages = localized
+			realm.Timezone = form.Timezone
 		}
 
 		// Codes
 		if form.Codes {
 			realm.AllowedTestTypes = form.AllowedTestTypes
+
+			for _, sunset := range []struct {
+				field string
+				val   string
+				ptr   **time.Time
+			}{
+				{"confirmedSunsetAt", form.ConfirmedSunset, &realm.ConfirmedSunsetAt},
+				{"likelySunsetAt", form.LikelySunset, &realm.LikelySunsetAt},
+				{"negativeSunsetAt", form.NegativeSunset, &realm.NegativeSunsetAt},
+			} {
+				t, err := parseSunset(realm, sunset.val)
+				if err != nil {
+					realm.AddError(sunset.field, err.Error())
+					flash.Error("Failed to update realm")
+					c.renderSettings(ctx, w, r, realm, nil, nil, quotaLimit, quotaRemaining)
+					return
+				}
+				*sunset.ptr = t
+			}
+			realm.NegativeResultPolicy = form.NegativeResultPolicy
 			realm.RequireDate = form.RequireDate
+			realm.AutofillTestDate = form.AutofillTestDate
+			realm.TestDateOffsetDays = form.TestDateOffsetDays
+			realm.EnforceDateOrder = form.EnforceDateOrder
+			realm.MaxTestBeforeSymptomDays = form.MaxTestBeforeSymptom
+			realm.FutureDateTolerance = database.FromDuration(time.Duration(form.FutureDateTolerance) * time.Minute)
 			realm.AllowBulkUpload = form.AllowBulkUpload
+			realm.MaxCodesPerExternalID = form.MaxCodesPerExtID
+			realm.MaxClaimsPerCode = form.MaxClaimsPerCode
+			realm.MaxMetadataKeys = form.MaxMetadataKeys
+			realm.MaxMetadataBytes = form.MaxMetadataBytes
+			realm.MaxExternalIDLength = form.MaxExternalIDLength
+			realm.RequireExternalID = form.RequireExternalID
+			realm.ExternalIDFormat = form.ExternalIDFormat
+			realm.MaxActiveCodes = form.MaxActiveCodes
+			realm.IssueLimitPerMinute = form.IssueLimitPerMinute
+			realm.IssueLimitPerHour = form.IssueLimitPerHour
+			realm.IssueLimitPerDay = form.IssueLimitPerDay
+			realm.QuietHours = form.QuietHours
+			realm.RequireDeviceBinding = form.RequireDeviceBinding
+			realm.MaxFailedClaimAttempts = form.MaxFailedClaims
+			realm.MinClaimIntervalSeconds = form.MinClaimInterval
+			realm.ClaimLimitPerExternalID = form.ExternalIDClaimLimit
+			realm.AllowedClaimAppIDs = database.ToAppIDList(form.AllowedClaimAppIDs)
+			realm.AllowedClaimCountries = database.ToAppIDList(form.AllowedClaimCountries)
+			realm.EnforceClaimCountries = form.EnforceClaimCountries
+			realm.ClaimResponseMapping = form.ClaimResponseMapping
+			realm.ReportTypeMapping = form.ReportTypeMapping
+			realm.ClaimRedirectURL = form.ClaimRedirectURL
+
+			// Warn about app IDs which do not match a registered mobile app, since
+			// they are most likely typos.
+			if len(realm.AllowedClaimAppIDs) > 0 {
+				mobileAppIDs, err := realm.MobileAppIDs(c.db)
+				if err != nil {
+					controller.InternalError(w, r, c.h, err)
+					return
+				}
+
+				registered := make(map[string]struct{}, len(mobileAppIDs))
+				for _, v := range mobileAppIDs {
+					registered[v] = struct{}{}
+				}
+				for _, v := range realm.AllowedClaimAppIDs {
+					if _, ok := registered[v]; !ok {
+						flash.Warning("Allowed app %q is not a registered mobile app.", v)
+					}
+				}
+			}
+			realm.RejectDuplicateExternalID = form.RejectDuplicateExtID
+			if form.RejectDuplicateExtID {
+				realm.DuplicateExternalIDWindow = database.FromDuration(time.Duration(form.DuplicateExtIDHours) * time.Hour)
+			}
+			realm.RequireIssuanceApproval = form.RequireApproval
+			if form.RequireApproval {
+				realm.IssuanceApprovalTimeout = database.FromDuration(time.Duration(form.ApprovalTimeoutHours) * time.Hour)
+			}
 			realm.SMSTextTemplate = form.SMSTextTemplate
 
+			smsTemplates, err := database.ParseLocalizedMessages(form.SMSTextTemplates)
+			if err != nil {
+				realm.AddError("smsTextTemplates", err.Error())
+				flash.Error("Failed to update realm")
+				c.renderSettings(ctx, w, r, realm, nil, nil, quotaLimit, quotaRemaining)
+				return
+			}
+			realm.SMSTextTemplates = smsTemplates
+			realm.DeepLinkScheme = form.DeepLinkScheme
+			realm.DeepLinkHost = form.DeepLinkHost
+			realm.DeepLinkMetadataKeys = strings.Split(form.DeepLinkMetadataKeys, ",")
+			realm.DisableLongCodes = form.DisableLongCodes
+			realm.DisableShortCodeClaims = form.DisableShortClaims
+			realm.CaseInsensitiveCodes = form.CaseInsensitiveCodes
+			realm.CodeSeparators = form.CodeSeparators
+			realm.StrictCodeExpiry = form.StrictCodeExpiry
+			realm.TokenDuration = database.FromDuration(time.Duration(form.TokenDurationHours) * time.Hour)
+			realm.TokenIssuer = form.TokenIssuer
+			realm.TokenAudience = form.TokenAudience
+
 			// These fields can only be set if ENX is disabled
 			if !realm.EnableENExpress {
 				realm.CodeLength = form.CodeLength
@@ -170,12 +340,24 @@ func (c *Controller) HandleSettings() http.Handler {
 		if form.SMS {
 			realm.UseSystemSMSConfig = form.UseSystemSMSConfig
 			realm.SMSCountry = form.SMSCountry
+			realm.SMSFailurePolicy = database.SMSFailurePolicy(form.SMSFailurePolicy)
 		}
 
 		// Email
 		if form.Email {
 			realm.UseSystemEmailConfig = form.UseSystemEmailConfig
 			realm.EmailInviteTemplate = form.EmailInviteTemplate
+
+			emailCodeTemplates, err := database.ParseLocalizedMessages(form.EmailCodeTemplates)
+			if err != nil {
+				realm.AddError("emailCodeTemplates", err.Error())
+				flash.Error("Failed to update realm")
+				c.renderSettings(ctx, w, r, realm, nil, nil, quotaLimit, quotaRemaining)
+				return
+			}
+			realm.EnableEmailCodes = form.EnableEmailCodes
+			realm.EmailCodeTemplate = form.EmailCodeTemplate
+			realm.EmailCodeTemplates = emailCodeTemplates
 		}
 
 		// Security
@@ -212,6 +394,18 @@ func (c *Controller) HandleSettings() http.Handler {
 				return
 			}
 			realm.AllowedCIDRsServer = allowedCIDRsServer
+
+			allowedCIDRsIssue, err := database.ToCIDRList(form.AllowedCIDRsIssue)
+			if err != nil {
+				realm.AddError("allowedCIDRsIssue", err.Error())
+				flash.Error("Failed to update realm")
+				c.renderSettings(ctx, w, r, realm, nil, nil, quotaLimit, quotaRemaining)
+				return
+			}
+			realm.AllowedCIDRsIssue = allowedCIDRsIssue
+			realm.MaxConcurrentAPIKeyRequests = form.MaxConcurrentAPIKeyRequests
+			realm.KioskMode = form.KioskMode
+			realm.SignCertificateResponses = form.SignCertificateResponses
 		}
 
 		// Abuse prevention
@@ -231,16 +425,17 @@ func (c *Controller) HandleSettings() http.Handler {
 		// not ideal or correct.
 		//
 		// Even if saving the realm fails, there's no harm in doing this early. It's
-		// an idempotent operation that TTLs out after a week anyway.
+		// an idempotent operation that TTLs out at the end of the realm's day.
 		if abusePreventionJustEnabled {
-			key, err := realm.QuotaKey(c.config.RateLimit.HMACKey)
+			now := time.Now()
+			key, err := realm.DailyQuotaKey(c.config.RateLimit.HMACKey, now)
 			if err != nil {
 				controller.InternalError(w, r, c.h, err)
 				return
 			}
 			limit := uint64(realm.AbusePreventionEffectiveLimit())
-			ttl := 7 * 24 * time.Hour
-			if err := c.limiter.Set(ctx, key, limit, ttl); err != nil {
+			_, dayEnd := realm.QuotaDay(now)
+			if err := ratelimit.EnsureBucket(ctx, c.limiter, key, limit, dayEnd.Sub(now)); err != nil {
 				controller.InternalError(w, r, c.h, err)
 				return
 			}
@@ -313,16 +508,10 @@ func (c *Controller) HandleSettings() http.Handler {
 				}
 				emailConfig.SMTPHost = form.SMTPHost
 				emailConfig.SMTPPort = form.SMTPPort
-
-				if err := c.db.SaveEmailConfig(emailConfig); err != nil {
-					flash.Error("Failed to update realm: %v", err)
-					c.renderSettings(ctx, w, r, realm, nil, emailConfig, quotaLimit, quotaRemaining)
-					return
-				}
 			} else {
 				// There's no record or the existing record was the system config so we
 				// want to create our own.
-				emailConfig := &database.EmailConfig{
+				emailConfig = &database.EmailConfig{
 					RealmID:      realm.ID,
 					ProviderType: email.ProviderTypeSMTP,
 					SMTPAccount:  form.SMTPAccount,
@@ -330,22 +519,41 @@ func (c *Controller) HandleSettings() http.Handler {
 					SMTPHost:     form.SMTPHost,
 					SMTPPort:     form.SMTPPort,
 				}
+			}
 
-				if err := c.db.SaveEmailConfig(emailConfig); err != nil {
-					flash.Error("Failed to update realm: %v", err)
+			// The server connects to the realm's SMTP host, so it must not point at
+			// an internal address. Localhost is allowed in dev mode for testing with
+			// a local mail server.
+			if host := emailConfig.SMTPHost; host != "" {
+				if err := outbound.ValidateHost(ctx, host, c.config.DevMode); err != nil {
+					emailConfig.AddError("smtpHost", err.Error())
+					flash.Error("Failed to update realm: invalid SMTP host: %v", err)
 					c.renderSettings(ctx, w, r, realm, nil, emailConfig, quotaLimit, quotaRemaining)
 					return
 				}
 			}
+
+			if err := c.db.SaveEmailConfig(emailConfig); err != nil {
+				flash.Error("Failed to update realm: %v", err)
+				c.renderSettings(ctx, w, r, realm, nil, emailConfig, quotaLimit, quotaRemaining)
+				return
+			}
 		}
 
 		// Process temporary abuse prevention bursts
 		if burst := form.AbusePreventionBurst; burst > 0 {
-			key, err := realm.QuotaKey(c.config.RateLimit.HMACKey)
+			now := time.Now()
+			key, err := realm.DailyQuotaKey(c.config.RateLimit.HMACKey, now)
 			if err != nil {
 				controller.InternalError(w, r, c.h, err)
 				return
 			}
+			limit := uint64(realm.AbusePreventionEffectiveLimit())
+			_, dayEnd := realm.QuotaDay(now)
+			if err := ratelimit.EnsureBucket(ctx, c.limiter, key, limit, dayEnd.Sub(now)); err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
 			if err := c.limiter.Burst(ctx, key, burst); err != nil {
 				controller.InternalError(w, r, c.h, err)
 				return
@@ -430,26 +638,54 @@ func (c *Controller) renderSettings(
 		}
 	}
 
+	mobileAppIDs, err := realm.MobileAppIDs(c.db)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Realm settings")
 	m["realm"] = realm
 	m["smsConfig"] = smsConfig
 	m["emailConfig"] = emailConfig
+	m["mobileAppIDs"] = mobileAppIDs
 	m["countries"] = database.Countries
 	m["testTypes"] = map[string]database.TestType{
 		"confirmed": database.TestTypeConfirmed,
 		"likely":    database.TestTypeConfirmed | database.TestTypeLikely,
 		"negative":  database.TestTypeConfirmed | database.TestTypeLikely | database.TestTypeNegative,
 	}
+	m["negativeResultPolicies"] = []database.NegativeResultPolicy{
+		database.NegativeResultAllow,
+		database.NegativeResultBlockUpload,
+		database.NegativeResultShortExpiry,
+		database.NegativeResultInformational,
+	}
+	m["smsFailurePolicies"] = []database.SMSFailurePolicy{
+		database.SMSFailureFail,
+		database.SMSFailureWarn,
+		database.SMSFailureRetry,
+	}
 	// Valid settings for pwd rotation.
 	m["mfaGracePeriod"] = mfaGracePeriod
 	m["passwordRotateDays"] = passwordRotationPeriodDays
 	m["passwordWarnDays"] = passwordRotationWarningDays
+	m["systemPasswordRotationDays"] = c.config.PasswordRequirements.RotationPeriodDays
 	// Valid settings for code parameters.
 	m["shortCodeLengths"] = shortCodeLengths
 	m["shortCodeMinutes"] = shortCodeMinutes
 	m["longCodeLengths"] = longCodeLengths
 	m["longCodeHours"] = longCodeHours
+	m["duplicateExternalIDHours"] = duplicateExternalIDHours
+	m["issuanceApprovalHours"] = issuanceApprovalHours
+	m["tokenDurationHours"] = tokenDurationHours
+	m["maxTestDateOffsetDays"] = database.MaxTestDateOffsetDays
+	m["maxTestBeforeSymptomDays"] = database.MaxTestBeforeSymptomDays
+	m["maxFutureDateToleranceMinutes"] = int(database.MaxFutureDateTolerance.Minutes())
+	m["maxClaimsPerCodeLimit"] = database.MaxClaimsPerCodeLimit
+	m["testTypeSunsets"] = realm.UpcomingTestTypeSunsets(time.Now())
+	m["logoUploadsEnabled"] = c.config.AssetBucket != ""
 	m["enxRedirectDomain"] = c.config.GetENXRedirectDomain()
 
 	m["quotaLimit"] = quotaLimit
@@ -457,3 +693,18 @@ func (c *Controller) renderSettings(
 
 	c.h.RenderHTML(w, "realmadmin/edit", m)
 }
+
+// parseSunset parses a test type sunset date from the form. The sunset is the
+// start of that day in the realm's timezone. An empty value clears the sunset.
+func parseSunset(realm *database.Realm, val string) (*time.Time, error) {
+	val = project.TrimSpace(val)
+	if val == "" {
+		return nil, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", val, realm.Location())
+	if err != nil {
+		return nil, fmt.Errorf("must be a date in the format YYYY-MM-DD")
+	}
+	return &t, nil
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -60,6 +61,23 @@ func (c *Controller) HandleShow() http.Handler {
 			case "user":
 				filename = fmt.Sprintf("%s-user-stats.csv", nowFormatted)
 				stats, err = c.getUserStats(ctx, realm, now, past)
+			case "cohort":
+				filename = fmt.Sprintf("%s-cohort-stats.csv", nowFormatted)
+				stats, err = c.getCohortStats(ctx, realm, now, past)
+			case "failures":
+				filename = fmt.Sprintf("%s-issuance-failure-stats.csv", nowFormatted)
+				stats, err = c.getIssuanceFailureStats(ctx, realm, now, past)
+			case "failure-log":
+				filename = fmt.Sprintf("%s-issuance-failures.csv", nowFormatted)
+				stats, err = c.db.ListIssuanceFailures(realm.ID, past, now)
+			case "metadata":
+				key := r.URL.Query().Get("key")
+				if !database.ValidCodeMetadataKey(key) {
+					http.Error(w, "invalid metadata key", http.StatusBadRequest)
+					return
+				}
+				filename = fmt.Sprintf("%s-metadata-%s-stats.csv", nowFormatted, key)
+				stats, err = c.getMetadataStats(ctx, realm, key, now, past)
 			default:
 				filename = fmt.Sprintf("%s-realm-stats.csv", nowFormatted)
 				stats, err = c.getRealmStats(ctx, realm, now, past)
@@ -80,6 +98,17 @@ func (c *Controller) HandleShow() http.Handler {
 				stats, err = c.getExternalIssuerStats(ctx, realm, now, past)
 			case "user":
 				stats, err = c.getUserStats(ctx, realm, now, past)
+			case "cohort":
+				stats, err = c.getCohortStats(ctx, realm, now, past)
+			case "failures":
+				stats, err = c.getIssuanceFailureStats(ctx, realm, now, past)
+			case "metadata":
+				key := r.URL.Query().Get("key")
+				if !database.ValidCodeMetadataKey(key) {
+					c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("invalid metadata key %q", key))
+					return
+				}
+				stats, err = c.getMetadataStats(ctx, realm, key, now, past)
 			default:
 				stats, err = c.getRealmStats(ctx, realm, now, past)
 			}
@@ -92,15 +121,30 @@ func (c *Controller) HandleShow() http.Handler {
 			c.h.RenderJSON(w, http.StatusOK, stats)
 		default:
 			// Fallback to HTML
-			c.renderHTML(ctx, w, realm)
+			cohortStats, err := c.getCohortStats(ctx, realm, now, past)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+
+			failureStats, err := c.getIssuanceFailureStats(ctx, realm, now, past)
+			if err != nil {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+
+			c.renderHTML(ctx, w, realm, cohortStats, failureStats)
 			return
 		}
 	})
 }
 
-func (c *Controller) renderHTML(ctx context.Context, w http.ResponseWriter, realm *database.Realm) {
+func (c *Controller) renderHTML(ctx context.Context, w http.ResponseWriter, realm *database.Realm, cohortStats database.CohortStats, failureStats database.IssuanceFailureStats) {
 	m := controller.TemplateMapFromContext(ctx)
 	m.Title("Realm stats")
+	m["cohortStats"] = cohortStats
+	m["failureStats"] = failureStats
+	m["scheduledExportsEnabled"] = c.config.EnableScheduledExports
 	c.h.RenderHTML(w, "realmadmin/show", m)
 }
 
@@ -148,3 +192,50 @@ func (c *Controller) getExternalIssuerStats(ctx context.Context, realm *database
 	}
 	return stats, nil
 }
+
+// getCohortStats gets the per-cohort code counts for a given date range.
+func (c *Controller) getCohortStats(ctx context.Context, realm *database.Realm, now, past time.Time) (database.CohortStats, error) {
+	var stats database.CohortStats
+	cacheKey := &cache.Key{
+		Namespace: "stats:realm:per_cohort",
+		Key:       strconv.FormatUint(uint64(realm.ID), 10),
+	}
+	if err := c.cacher.Fetch(ctx, cacheKey, &stats, cacheTimeout, func() (interface{}, error) {
+		return c.db.CountCodesByCohort(realm.ID, past, now)
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getIssuanceFailureStats gets the number of failed issuance attempts for each
+// day and reason for a given date range.
+func (c *Controller) getIssuanceFailureStats(ctx context.Context, realm *database.Realm, now, past time.Time) (database.IssuanceFailureStats, error) {
+	var stats database.IssuanceFailureStats
+	cacheKey := &cache.Key{
+		Namespace: "stats:realm:issuance_failures",
+		Key:       strconv.FormatUint(uint64(realm.ID), 10),
+	}
+	if err := c.cacher.Fetch(ctx, cacheKey, &stats, cacheTimeout, func() (interface{}, error) {
+		return c.db.IssuanceFailureStats(realm.ID, past, now)
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// getMetadataStats gets the code counts for each value of the metadata key for
+// a given date range.
+func (c *Controller) getMetadataStats(ctx context.Context, realm *database.Realm, key string, now, past time.Time) (database.MetadataStats, error) {
+	var stats database.MetadataStats
+	cacheKey := &cache.Key{
+		Namespace: "stats:realm:per_metadata",
+		Key:       fmt.Sprintf("%d:%s", realm.ID, key),
+	}
+	if err := c.cacher.Fetch(ctx, cacheKey, &stats, cacheTimeout, func() (interface{}, error) {
+		return c.db.CountCodesByMetadata(realm.ID, key, past, now)
+	}); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmadmin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
+	"github.com/gorilla/mux"
+)
+
+// HandleWebhooksIndex lists the realm's webhooks along with the form to create
+// one, and creates the webhook when the form is submitted.
+func (c *Controller) HandleWebhooksIndex() http.Handler {
+	type FormData struct {
+		URL            string   `form:"url"`
+		Events         []string `form:"events"`
+		PayloadVersion uint     `form:"payload_version"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if !c.config.Database.Webhooks.Enabled {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		hook := &database.Webhook{
+			RealmID:        realm.ID,
+			Events:         []string{string(webhook.EventClaimed)},
+			PayloadVersion: webhook.LatestPayloadVersion,
+		}
+
+		if r.Method == http.MethodGet {
+			c.renderWebhooks(ctx, w, r, realm, hook)
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			c.renderWebhooks(ctx, w, r, realm, hook)
+			return
+		}
+
+		hook.URL = form.URL
+		hook.Events = form.Events
+		hook.PayloadVersion = form.PayloadVersion
+
+		if err := c.db.SaveWebhook(hook, currentUser); err != nil {
+			flash.Error("Failed to create webhook: %v", err)
+			c.renderWebhooks(ctx, w, r, realm, hook)
+			return
+		}
+
+		flash.Alert("Successfully created webhook for %s. Its signing secret is %s. "+
+			"Store it now, it will not be shown again.", hook.URL, hook.Secret)
+		http.Redirect(w, r, "/realm/webhooks", http.StatusSeeOther)
+	})
+}
+
+// HandleWebhooksDelete deletes a webhook.
+func (c *Controller) HandleWebhooksDelete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		vars := mux.Vars(r)
+
+		if !c.config.Database.Webhooks.Enabled {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		hook, err := realm.FindWebhook(c.db, vars["id"])
+		if err != nil {
+			if database.IsNotFound(err) {
+				controller.NotFound(w, r, c.h)
+				return
+			}
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		if err := c.db.DeleteWebhook(hook, currentUser); err != nil {
+			flash.Error("Failed to delete webhook: %v", err)
+			controller.Back(w, r, c.h)
+			return
+		}
+
+		flash.Alert("Successfully deleted webhook for %s.", hook.URL)
+		http.Redirect(w, r, "/realm/webhooks", http.StatusSeeOther)
+	})
+}
+
+func (c *Controller) renderWebhooks(ctx context.Context, w http.ResponseWriter, r *http.Request, realm *database.Realm, hook *database.Webhook) {
+	hooks, err := realm.ListWebhooks(c.db)
+	if err != nil {
+		controller.InternalError(w, r, c.h, err)
+		return
+	}
+
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Webhooks")
+	m["webhook"] = hook
+	m["webhooks"] = hooks
+	m["eventTypes"] = webhook.EventTypes
+	m["payloadVersions"] = webhook.PayloadVersions
+	m["latestPayloadVersion"] = webhook.LatestPayloadVersion
+	c.h.RenderHTML(w, "realmadmin/webhooks", m)
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realmrequest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// HandleCreate renders the realm request form and creates the realm, pending
+// approval, when it is submitted. System admins are notified by email.
+func (c *Controller) HandleCreate() http.Handler {
+	type FormData struct {
+		Name          string `form:"name"`
+		RegionCode    string `form:"region_code"`
+		RequestReason string `form:"request_reason"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := logging.FromContext(ctx).Named("realmrequest.HandleCreate")
+
+		if !c.config.EnableRealmRequests {
+			controller.NotFound(w, r, c.h)
+			return
+		}
+
+		session := controller.SessionFromContext(ctx)
+		if session == nil {
+			controller.MissingSession(w, r, c.h)
+			return
+		}
+		flash := controller.Flash(session)
+
+		currentUser := controller.UserFromContext(ctx)
+		if currentUser == nil {
+			controller.MissingUser(w, r, c.h)
+			return
+		}
+
+		// Requested form, stop processing.
+		if r.Method == http.MethodGet {
+			c.renderNew(ctx, w, new(database.Realm))
+			return
+		}
+
+		var form FormData
+		if err := controller.BindForm(w, r, &form); err != nil {
+			flash.Error("Failed to process form: %v", err)
+			c.renderNew(ctx, w, new(database.Realm))
+			return
+		}
+
+		realm := database.NewRealmWithDefaults(form.Name)
+		realm.RegionCode = form.RegionCode
+		realm.RequestReason = form.RequestReason
+		if err := c.db.RequestRealm(realm, currentUser); err != nil {
+			if errors.Is(err, database.ErrRealmRequestPending) {
+				flash.Error("Failed to request realm: %v.", err)
+				c.renderNew(ctx, w, realm)
+				return
+			}
+			if len(realm.Errors()) == 0 {
+				controller.InternalError(w, r, c.h, err)
+				return
+			}
+
+			flash.Error("Failed to request realm: %v", err)
+			c.renderNew(ctx, w, realm)
+			return
+		}
+
+		admins, err := c.db.ListSystemAdmins()
+		if err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		to := make([]string, 0, len(admins))
+		for _, admin := range admins {
+			to = append(to, admin.Email)
+		}
+
+		if err := controller.SendSystemEmail(ctx, c.db, c.h, "email/realm-request", to, map[string]interface{}{
+			"RealmName":      realm.Name,
+			"RegionCode":     realm.RegionCode,
+			"RequestReason":  realm.RequestReason,
+			"RequesterName":  currentUser.Name,
+			"RequesterEmail": currentUser.Email,
+			"ReviewLink":     controller.AbsoluteURL(r, "/admin/realms", c.config.DevMode),
+		}); err != nil {
+			// The request was saved and is visible to system admins, so do not fail.
+			logger.Errorw("failed to notify system admins of realm request", "error", err)
+		}
+
+		flash.Alert("Requested realm %q. You will be added as its admin once a system admin approves it.", realm.Name)
+		http.Redirect(w, r, "/login/select-realm", http.StatusSeeOther)
+	})
+}
+
+func (c *Controller) renderNew(ctx context.Context, w http.ResponseWriter, realm *database.Realm) {
+	m := controller.TemplateMapFromContext(ctx)
+	m.Title("Request a realm")
+	m["realm"] = realm
+	c.h.RenderHTML(w, "realmrequest/new", m)
+}
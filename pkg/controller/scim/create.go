@@ -0,0 +1,77 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// HandleCreate provisions a new user, along with their realm memberships, and
+// creates the user in the auth provider. Like users created in the UI, the user
+// receives an invitation to set their password.
+func (c *Controller) HandleCreate() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var req User
+		if err := decodeJSON(w, r, &req); err != nil {
+			c.renderError(w, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		email := req.email()
+		if _, err := c.db.FindUserByEmail(email); err == nil {
+			c.renderError(w, http.StatusConflict, errUniqueness, "a user with that userName already exists")
+			return
+		} else if !database.IsNotFound(err) {
+			c.renderErr(w, r, fmt.Errorf("failed to find user: %w", err))
+			return
+		}
+
+		user := &database.User{
+			Email: email,
+			Name:  req.name(),
+		}
+
+		if err := c.update(user, &req); err != nil {
+			c.renderErr(w, r, err)
+			return
+		}
+
+		// Send the invitation using the email settings of the user's first realm,
+		// if it has any.
+		if len(user.Realms) > 0 {
+			ctx = controller.WithRealm(ctx, user.Realms[0])
+		}
+		inviteComposer, err := controller.SendInviteEmailFunc(ctx, c.db, c.h, user.Email)
+		if err != nil {
+			c.renderErr(w, r, fmt.Errorf("failed to build invite email: %w", err))
+			return
+		}
+
+		if _, err := c.authProvider.CreateUser(ctx, user.Name, user.Email, "", true, inviteComposer); err != nil {
+			c.renderErr(w, r, fmt.Errorf("failed to create user in auth provider: %w", err))
+			return
+		}
+
+		resp := toSCIM(user)
+		w.Header().Set("Location", resp.Meta.Location)
+		c.h.RenderJSON(w, http.StatusCreated, resp)
+	})
+}
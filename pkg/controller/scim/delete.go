@@ -0,0 +1,45 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleDelete deletes a user. System admins cannot be deleted through SCIM;
+// they must be removed from the system admin console first.
+func (c *Controller) HandleDelete() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := c.findUser(w, r, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+
+		if user.SystemAdmin {
+			c.renderError(w, http.StatusBadRequest, errMutability, "system admins cannot be deleted through SCIM")
+			return
+		}
+
+		if err := c.db.DeleteUser(user, actor); err != nil {
+			c.renderErr(w, r, fmt.Errorf("failed to delete user: %w", err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// HandleIndex queries users. Only the `userName eq "..."` filter is supported,
+// which is what identity providers use to find an existing user.
+func (c *Controller) HandleIndex() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter := r.URL.Query().Get("filter")
+		matches := userNameFilterRe.FindStringSubmatch(filter)
+		if matches == nil {
+			c.renderError(w, http.StatusBadRequest, errInvalidFilter,
+				`only filters of the form 'userName eq "..."' are supported`)
+			return
+		}
+
+		resp := &ListResponse{
+			Schemas:    []string{SchemaListResponse},
+			StartIndex: 1,
+			Resources:  make([]*User, 0, 1),
+		}
+
+		user, err := c.db.FindUserByEmail(matches[1])
+		if err != nil && !database.IsNotFound(err) {
+			c.renderErr(w, r, fmt.Errorf("failed to find user: %w", err))
+			return
+		}
+		if user != nil {
+			resp.Resources = append(resp.Resources, toSCIM(user))
+		}
+		resp.TotalResults = len(resp.Resources)
+		resp.ItemsPerPage = len(resp.Resources)
+
+		c.h.RenderJSON(w, http.StatusOK, resp)
+	})
+}
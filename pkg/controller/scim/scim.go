@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scim implements a minimal subset of the SCIM 2.0 protocol (RFC 7643
+// and RFC 7644) so identity providers can provision and deprovision users and
+// their realm memberships.
+//
+// Only the Users resource is supported. Realm memberships are carried in a
+// custom extension schema. Users do not have an enabled flag, so a user is
+// "active" while they are a member of at least one realm, and deactivating a
+// user removes all of their realm memberships.
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/internal/auth"
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/gorilla/mux"
+)
+
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaRealms       = "urn:ietf:params:scim:schemas:extension:verification:2.0:User"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Error types from RFC 7644 section 3.12.
+const (
+	errInvalidFilter = "invalidFilter"
+	errInvalidSyntax = "invalidSyntax"
+	errInvalidPath   = "invalidPath"
+	errInvalidValue  = "invalidValue"
+	errMutability    = "mutability"
+	errUniqueness    = "uniqueness"
+)
+
+// actor is the audit actor for changes made through SCIM.
+var actor database.Auditable = new(scimActor)
+
+type scimActor struct{}
+
+func (s *scimActor) AuditID() string {
+	return "scim:1"
+}
+
+func (s *scimActor) AuditDisplay() string {
+	return "SCIM provisioning"
+}
+
+// Controller handles SCIM requests.
+type Controller struct {
+	config       *config.ServerConfig
+	db           *database.Database
+	authProvider auth.Provider
+	h            *render.Renderer
+}
+
+// New creates a new SCIM controller.
+func New(ctx context.Context, config *config.ServerConfig, db *database.Database, authProvider auth.Provider, h *render.Renderer) *Controller {
+	return &Controller{
+		config:       config,
+		db:           db,
+		authProvider: authProvider,
+		h:            h,
+	}
+}
+
+// RequireToken verifies the request has the configured SCIM bearer token in
+// the Authorization header.
+func (c *Controller) RequireToken() mux.MiddlewareFunc {
+	want := []byte(c.config.SCIMToken)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			logger := logging.FromContext(ctx).Named("scim.RequireToken")
+
+			header := r.Header.Get("Authorization")
+			got := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+			if len(want) == 0 || header == got || subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+				logger.Debugw("invalid scim token")
+				c.renderError(w, http.StatusUnauthorized, "", "invalid or missing bearer token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HandleNotFound renders a SCIM error for unknown resources, such as Groups.
+func (c *Controller) HandleNotFound() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.renderError(w, http.StatusNotFound, "", "resource type is not supported")
+	})
+}
+
+// HandleMethodNotAllowed renders a SCIM error for unsupported operations on a
+// known resource.
+func (c *Controller) HandleMethodNotAllowed() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.renderError(w, http.StatusNotImplemented, "", r.Method+" is not supported on this resource")
+	})
+}
+
+// requestError is an error caused by the request. It is rendered as a SCIM
+// error with the given status and type.
+type requestError struct {
+	code     int
+	scimType string
+	detail   string
+}
+
+func (e *requestError) Error() string {
+	return e.detail
+}
+
+// invalidValue returns a requestError for an invalid attribute value.
+func invalidValue(format string, args ...interface{}) error {
+	return &requestError{
+		code:     http.StatusBadRequest,
+		scimType: errInvalidValue,
+		detail:   fmt.Sprintf(format, args...),
+	}
+}
+
+// renderErr renders err as a SCIM error. Errors that are not caused by the
+// request are logged and rendered as internal errors.
+func (c *Controller) renderErr(w http.ResponseWriter, r *http.Request, err error) {
+	var rerr *requestError
+	if errors.As(err, &rerr) {
+		c.renderError(w, rerr.code, rerr.scimType, rerr.detail)
+		return
+	}
+
+	logger := logging.FromContext(r.Context()).Named("scim")
+	logger.Errorw("scim request failed", "error", err)
+	c.h.JSON500(w, err)
+}
+
+// scimError is the error response from RFC 7644 section 3.12.
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// renderError renders a SCIM error response. The status is repeated in the
+// body as a string, as required by the specification.
+func (c *Controller) renderError(w http.ResponseWriter, code int, scimType, detail string) {
+	c.h.RenderJSON(w, code, &scimError{
+		Schemas:  []string{SchemaError},
+		Status:   strconv.Itoa(code),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleShow returns a single user.
+func (c *Controller) HandleShow() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := c.findUser(w, r, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, toSCIM(user))
+	})
+}
+
+// findUser looks up the user by ID. If the user cannot be found, it renders
+// the appropriate SCIM error and returns false.
+func (c *Controller) findUser(w http.ResponseWriter, r *http.Request, id string) (*database.User, bool) {
+	userID := parseID(id)
+	if userID == 0 {
+		c.renderError(w, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+
+	user, err := c.db.FindUser(userID)
+	if err != nil {
+		if database.IsNotFound(err) {
+			c.renderError(w, http.StatusNotFound, "", "user not found")
+			return nil, false
+		}
+
+		c.renderErr(w, r, fmt.Errorf("failed to find user: %w", err))
+		return nil, false
+	}
+	return user, true
+}
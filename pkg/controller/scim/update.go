@@ -0,0 +1,246 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/gorilla/mux"
+)
+
+// HandleReplace replaces a user's name, active state, and realm memberships.
+// If the request does not include the realm extension, memberships are left
+// unchanged.
+func (c *Controller) HandleReplace() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req User
+		if err := decodeJSON(w, r, &req); err != nil {
+			c.renderError(w, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		user, ok := c.findUser(w, r, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+
+		if email := req.email(); !strings.EqualFold(email, user.Email) {
+			c.renderError(w, http.StatusBadRequest, errMutability, "userName cannot be changed")
+			return
+		}
+
+		if err := c.update(user, &req); err != nil {
+			c.renderErr(w, r, err)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, toSCIM(user))
+	})
+}
+
+// HandlePatch applies a SCIM PATCH request. Only the active, displayName,
+// name.formatted, and realm membership attributes can be changed.
+func (c *Controller) HandlePatch() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PatchRequest
+		if err := decodeJSON(w, r, &req); err != nil {
+			c.renderError(w, http.StatusBadRequest, errInvalidSyntax, err.Error())
+			return
+		}
+
+		changes, err := patchToUser(&req)
+		if err != nil {
+			c.renderErr(w, r, err)
+			return
+		}
+
+		user, ok := c.findUser(w, r, mux.Vars(r)["id"])
+		if !ok {
+			return
+		}
+
+		if err := c.update(user, changes); err != nil {
+			c.renderErr(w, r, err)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, toSCIM(user))
+	})
+}
+
+// update applies the changes to the user and saves it. Deactivating a user
+// removes all of their realm memberships.
+func (c *Controller) update(user *database.User, changes *User) error {
+	if name := changes.name(); name != "" {
+		user.Name = name
+	}
+
+	switch {
+	case !changes.isActive():
+		user.Realms = []*database.Realm{}
+		user.AdminRealms = []*database.Realm{}
+	case changes.Realms != nil:
+		if err := c.setRealms(user, changes.Realms.Realms); err != nil {
+			return err
+		}
+	}
+
+	if err := c.db.SaveUser(user, actor); err != nil {
+		if len(user.ErrorMessages()) > 0 {
+			return invalidValue("%s", err)
+		}
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+	return nil
+}
+
+// setRealms replaces the user's realm memberships.
+func (c *Controller) setRealms(user *database.User, memberships []*RealmMembership) error {
+	user.Realms = []*database.Realm{}
+	user.AdminRealms = []*database.Realm{}
+
+	for _, m := range memberships {
+		id := parseID(m.Value)
+		if id == 0 {
+			return invalidValue("invalid realm %q", m.Value)
+		}
+
+		realm, err := c.db.FindRealm(id)
+		if err != nil {
+			if database.IsNotFound(err) {
+				return invalidValue("realm %q does not exist", m.Value)
+			}
+			return fmt.Errorf("failed to find realm: %w", err)
+		}
+
+		if m.Admin {
+			user.AddRealmAdmin(realm)
+		} else {
+			user.AddRealm(realm)
+		}
+	}
+	return nil
+}
+
+// patchToUser converts the PATCH operations into the equivalent partial user.
+// Operations on unsupported attributes are rejected.
+func patchToUser(req *PatchRequest) (*User, error) {
+	if len(req.Operations) == 0 {
+		return nil, &requestError{
+			code:     http.StatusBadRequest,
+			scimType: errInvalidSyntax,
+			detail:   "at least one operation is required",
+		}
+	}
+
+	var changes User
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		case "remove":
+			return nil, &requestError{
+				code:   http.StatusNotImplemented,
+				detail: "remove operations are not supported",
+			}
+		default:
+			return nil, &requestError{
+				code:     http.StatusBadRequest,
+				scimType: errInvalidSyntax,
+				detail:   fmt.Sprintf("invalid operation %q", op.Op),
+			}
+		}
+
+		// Without a path, the value is an object of attributes.
+		if op.Path == "" {
+			var partial struct {
+				Active      json.RawMessage `json:"active"`
+				DisplayName *string         `json:"displayName"`
+				Name        *Name           `json:"name"`
+				Realms      *RealmExtension `json:"urn:ietf:params:scim:schemas:extension:verification:2.0:User"`
+			}
+			if err := json.Unmarshal(op.Value, &partial); err != nil {
+				return nil, invalidValue("value must be an object of attributes")
+			}
+			if partial.Active != nil {
+				if err := patchActive(&changes, partial.Active); err != nil {
+					return nil, err
+				}
+			}
+			if partial.DisplayName != nil {
+				changes.DisplayName = *partial.DisplayName
+			}
+			if partial.Name != nil {
+				changes.Name = partial.Name
+			}
+			if partial.Realms != nil {
+				changes.Realms = partial.Realms
+			}
+			continue
+		}
+
+		switch strings.ToLower(op.Path) {
+		case "active":
+			if err := patchActive(&changes, op.Value); err != nil {
+				return nil, err
+			}
+		case "displayname":
+			if err := json.Unmarshal(op.Value, &changes.DisplayName); err != nil {
+				return nil, invalidValue("displayName must be a string")
+			}
+		case "name.formatted":
+			changes.Name = new(Name)
+			if err := json.Unmarshal(op.Value, &changes.Name.Formatted); err != nil {
+				return nil, invalidValue("name.formatted must be a string")
+			}
+		case strings.ToLower(SchemaRealms + ":realms"):
+			changes.Realms = new(RealmExtension)
+			if err := json.Unmarshal(op.Value, &changes.Realms.Realms); err != nil {
+				return nil, invalidValue("realms must be a list of realm memberships")
+			}
+		default:
+			return nil, &requestError{
+				code:     http.StatusBadRequest,
+				scimType: errInvalidPath,
+				detail:   fmt.Sprintf("path %q is not supported", op.Path),
+			}
+		}
+	}
+
+	return &changes, nil
+}
+
+// patchActive sets the active state from the raw value. Some identity providers
+// send booleans as strings, so both are accepted.
+func patchActive(changes *User, raw json.RawMessage) error {
+	var active bool
+	if err := json.Unmarshal(raw, &active); err != nil {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return invalidValue("active must be a boolean")
+		}
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return invalidValue("active must be a boolean")
+		}
+		active = v
+	}
+	changes.Active = &active
+	return nil
+}
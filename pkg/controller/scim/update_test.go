@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPatchToUser(t *testing.T) {
+	t.Parallel()
+
+	yes, no := true, false
+
+	cases := []struct {
+		name string
+		body string
+		exp  *User
+		code int
+	}{
+		{
+			name: "azure_deactivate",
+			body: `{"Operations":[{"op":"Replace","path":"active","value":"False"}]}`,
+			exp:  &User{Active: &no},
+		},
+		{
+			name: "okta_deactivate",
+			body: `{"Operations":[{"op":"replace","value":{"active":false}}]}`,
+			exp:  &User{Active: &no},
+		},
+		{
+			name: "rename_and_realms",
+			body: `{"Operations":[
+				{"op":"replace","path":"displayName","value":"Jane Doe"},
+				{"op":"add","path":"urn:ietf:params:scim:schemas:extension:verification:2.0:User:realms","value":[{"value":"1","admin":true}]},
+				{"op":"replace","value":{"active":true}}
+			]}`,
+			exp: &User{
+				DisplayName: "Jane Doe",
+				Active:      &yes,
+				Realms:      &RealmExtension{Realms: []*RealmMembership{{Value: "1", Admin: true}}},
+			},
+		},
+		{
+			name: "no_operations",
+			body: `{"Operations":[]}`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "remove",
+			body: `{"Operations":[{"op":"remove","path":"displayName"}]}`,
+			code: http.StatusNotImplemented,
+		},
+		{
+			name: "unknown_path",
+			body: `{"Operations":[{"op":"replace","path":"emails[type eq \"work\"].value","value":"a@b.com"}]}`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "invalid_active",
+			body: `{"Operations":[{"op":"replace","path":"active","value":"maybe"}]}`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var req PatchRequest
+			if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := patchToUser(&req)
+			if tc.code != 0 {
+				var rerr *requestError
+				if !errors.As(err, &rerr) {
+					t.Fatalf("expected requestError, got %v", err)
+				}
+				if rerr.code != tc.code {
+					t.Errorf("expected code %d to be %d", rerr.code, tc.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.exp, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUser_NameEmail(t *testing.T) {
+	t.Parallel()
+
+	var u User
+	if err := json.Unmarshal([]byte(`{
+		"userName": "jdoe",
+		"name": {"givenName": "Jane", "familyName": "Doe"},
+		"emails": [{"value": "other@example.com"}, {"value": "jane@example.com", "primary": true}]
+	}`), &u); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := u.email(), "jane@example.com"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := u.name(), "Jane Doe"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if !u.isActive() {
+		t.Errorf("expected user to be active by default")
+	}
+
+	if m := userNameFilterRe.FindStringSubmatch(`username EQ "jane@example.com"`); m == nil || m[1] != "jane@example.com" {
+		t.Errorf("expected filter to match, got %v", m)
+	}
+	if m := userNameFilterRe.FindStringSubmatch(`emails co "example"`); m != nil {
+		t.Errorf("expected filter not to match, got %v", m)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+// maxBodyBytes is the largest SCIM request accepted.
+const maxBodyBytes = 64_000
+
+// User is the SCIM representation of a user.
+type User struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id,omitempty"`
+	UserName    string          `json:"userName"`
+	DisplayName string          `json:"displayName,omitempty"`
+	Name        *Name           `json:"name,omitempty"`
+	Emails      []*Email        `json:"emails,omitempty"`
+	Active      *bool           `json:"active,omitempty"`
+	Realms      *RealmExtension `json:"urn:ietf:params:scim:schemas:extension:verification:2.0:User,omitempty"`
+	Meta        *Meta           `json:"meta,omitempty"`
+}
+
+// Name is the components of a user's name. Only the formatted name is stored.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Email is an email address for the user.
+type Email struct {
+	Value   string `json:"value"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// RealmExtension is the extension schema for realm memberships.
+type RealmExtension struct {
+	Realms []*RealmMembership `json:"realms"`
+}
+
+// RealmMembership is a user's membership in a single realm. Value is the realm
+// ID.
+type RealmMembership struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Admin   bool   `json:"admin"`
+}
+
+// Meta is the resource metadata.
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+// ListResponse is the response for a query.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []*User  `json:"Resources"`
+}
+
+// PatchRequest is a SCIM PATCH request.
+type PatchRequest struct {
+	Schemas    []string          `json:"schemas"`
+	Operations []*PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single operation in a PATCH request.
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// userNameFilterRe matches the only supported filter, which identity providers
+// use to look up a user before creating them.
+var userNameFilterRe = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+"([^"]*)"\s*$`)
+
+// toSCIM converts the database user to its SCIM representation.
+func toSCIM(u *database.User) *User {
+	active := len(u.Realms) > 0
+
+	memberships := make([]*RealmMembership, 0, len(u.Realms))
+	for _, realm := range u.Realms {
+		memberships = append(memberships, &RealmMembership{
+			Value:   strconv.FormatUint(uint64(realm.ID), 10),
+			Display: realm.Name,
+			Admin:   u.CanAdminRealm(realm.ID),
+		})
+	}
+
+	id := strconv.FormatUint(uint64(u.ID), 10)
+	return &User{
+		Schemas:     []string{SchemaUser, SchemaRealms},
+		ID:          id,
+		UserName:    u.Email,
+		DisplayName: u.Name,
+		Name:        &Name{Formatted: u.Name},
+		Emails:      []*Email{{Value: u.Email, Primary: true}},
+		Active:      &active,
+		Realms:      &RealmExtension{Realms: memberships},
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt.UTC(),
+			LastModified: u.UpdatedAt.UTC(),
+			Location:     "/scim/v2/Users/" + id,
+		},
+	}
+}
+
+// email returns the email address for the SCIM user, preferring the userName.
+func (s *User) email() string {
+	if strings.Contains(s.UserName, "@") {
+		return s.UserName
+	}
+	for _, e := range s.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(s.Emails) > 0 {
+		return s.Emails[0].Value
+	}
+	return s.UserName
+}
+
+// name returns the display name for the SCIM user.
+func (s *User) name() string {
+	if v := strings.TrimSpace(s.DisplayName); v != "" {
+		return v
+	}
+	if s.Name == nil {
+		return ""
+	}
+	if v := strings.TrimSpace(s.Name.Formatted); v != "" {
+		return v
+	}
+	return strings.TrimSpace(s.Name.GivenName + " " + s.Name.FamilyName)
+}
+
+// isActive returns true unless the user was explicitly marked inactive.
+func (s *User) isActive() bool {
+	return s.Active == nil || *s.Active
+}
+
+// decodeJSON decodes the request body. Unknown attributes are ignored because
+// identity providers send many attributes this server does not store.
+func decodeJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	defer r.Body.Close()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		return fmt.Errorf("malformed request: %w", err)
+	}
+	return nil
+}
+
+// parseID parses a user ID from the URL. It returns 0 if the ID is invalid.
+func parseID(s string) uint {
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
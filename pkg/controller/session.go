@@ -29,8 +29,14 @@ type sessionKey string
 const (
 	emailVerificationPrompted         = sessionKey("emailVerificationPrompted")
 	mfaPrompted                       = sessionKey("mfaPrompted")
+	sessionKeyImpersonatedUserID      = sessionKey("impersonatedUserID")
+	sessionKeyImpersonationStartedAt  = sessionKey("impersonationStartedAt")
+	sessionKeyImpersonationExpiresAt  = sessionKey("impersonationExpiresAt")
+	sessionKeyKiosk                   = sessionKey("kiosk")
 	sessionKeyLastActivity            = sessionKey("lastActivity")
 	sessionKeyRealmID                 = sessionKey("realmID")
+	sessionKeySSO                     = sessionKey("sso")
+	sessionKeyUserSessionID           = sessionKey("userSessionID")
 	sessionKeyWelcomeMessageDisplayed = sessionKey("welcomeMessageDisplayed")
 	passwordExpireWarned              = sessionKey("passwordExpireWarned")
 )
@@ -65,6 +71,54 @@ func RealmIDFromSession(session *sessions.Session) uint {
 	return t
 }
 
+// StoreSessionImpersonation stores the user being impersonated and the time at
+// which the impersonation expires in the session.
+func StoreSessionImpersonation(session *sessions.Session, user *database.User, startedAt, expiresAt time.Time) {
+	if session == nil || user == nil {
+		return
+	}
+	session.Values[sessionKeyImpersonatedUserID] = user.ID
+	session.Values[sessionKeyImpersonationStartedAt] = startedAt.Unix()
+	session.Values[sessionKeyImpersonationExpiresAt] = expiresAt.Unix()
+}
+
+// ClearSessionImpersonation clears the impersonation from the session.
+func ClearSessionImpersonation(session *sessions.Session) {
+	sessionClear(session, sessionKeyImpersonatedUserID)
+	sessionClear(session, sessionKeyImpersonationStartedAt)
+	sessionClear(session, sessionKeyImpersonationExpiresAt)
+}
+
+// ImpersonationFromSession extracts the impersonated user's ID and the start and
+// expiration times of the impersonation. If there is no impersonation, the ID
+// is 0.
+func ImpersonationFromSession(session *sessions.Session) (uint, time.Time, time.Time) {
+	v := sessionGet(session, sessionKeyImpersonatedUserID)
+	if v == nil {
+		return 0, time.Time{}, time.Time{}
+	}
+
+	id, ok := v.(uint)
+	if !ok {
+		ClearSessionImpersonation(session)
+		return 0, time.Time{}, time.Time{}
+	}
+
+	started, ok := sessionGet(session, sessionKeyImpersonationStartedAt).(int64)
+	if !ok {
+		ClearSessionImpersonation(session)
+		return 0, time.Time{}, time.Time{}
+	}
+
+	expires, ok := sessionGet(session, sessionKeyImpersonationExpiresAt).(int64)
+	if !ok {
+		ClearSessionImpersonation(session)
+		return 0, time.Time{}, time.Time{}
+	}
+
+	return id, time.Unix(started, 0), time.Unix(expires, 0)
+}
+
 // StoreSessionMFAPrompted stores if the user was prompted for MFA.
 func StoreSessionMFAPrompted(session *sessions.Session, prompted bool) {
 	if session == nil {
@@ -124,6 +178,35 @@ func LastActivityFromSession(session *sessions.Session) time.Time {
 	return time.Unix(i, 0)
 }
 
+// StoreSessionUserSessionID stores the ID of the server-side session record.
+func StoreSessionUserSessionID(session *sessions.Session, id string) {
+	if session == nil {
+		return
+	}
+	session.Values[sessionKeyUserSessionID] = id
+}
+
+// ClearSessionUserSessionID clears the server-side session record ID.
+func ClearSessionUserSessionID(session *sessions.Session) {
+	sessionClear(session, sessionKeyUserSessionID)
+}
+
+// UserSessionIDFromSession extracts the ID of the server-side session record.
+func UserSessionIDFromSession(session *sessions.Session) string {
+	v := sessionGet(session, sessionKeyUserSessionID)
+	if v == nil {
+		return ""
+	}
+
+	t, ok := v.(string)
+	if !ok {
+		delete(session.Values, sessionKeyUserSessionID)
+		return ""
+	}
+
+	return t
+}
+
 // StoreSessionEmailVerificationPrompted stores if the user was prompted for email verification.
 func StoreSessionEmailVerificationPrompted(session *sessions.Session, prompted bool) {
 	if session == nil {
@@ -215,6 +298,65 @@ func PasswordExpireWarnedFromSession(session *sessions.Session) bool {
 	return f
 }
 
+// StoreSessionSSO stores if the user signed in with single sign-on, rather than
+// an email and password.
+func StoreSessionSSO(session *sessions.Session, sso bool) {
+	if session == nil {
+		return
+	}
+	session.Values[sessionKeySSO] = sso
+}
+
+// ClearSessionSSO clears the single sign-on bit.
+func ClearSessionSSO(session *sessions.Session) {
+	sessionClear(session, sessionKeySSO)
+}
+
+// SSOFromSession extracts if the user signed in with single sign-on.
+func SSOFromSession(session *sessions.Session) bool {
+	v := sessionGet(session, sessionKeySSO)
+	if v == nil {
+		return false
+	}
+
+	f, ok := v.(bool)
+	if !ok {
+		delete(session.Values, sessionKeySSO)
+		return false
+	}
+
+	return f
+}
+
+// StoreSessionKiosk stores if the session is in kiosk mode.
+func StoreSessionKiosk(session *sessions.Session, kiosk bool) {
+	if session == nil {
+		return
+	}
+	session.Values[sessionKeyKiosk] = kiosk
+}
+
+// ClearSessionKiosk clears the kiosk mode bit.
+func ClearSessionKiosk(session *sessions.Session) {
+	sessionClear(session, sessionKeyKiosk)
+}
+
+// KioskFromSession extracts if the session is in kiosk mode.
+func KioskFromSession(session *sessions.Session) bool {
+	v := sessionGet(session, sessionKeyKiosk)
+	if v == nil {
+		return false
+	}
+
+	f, ok := v.(bool)
+	if !ok {
+		delete(session.Values, sessionKeyKiosk)
+		return false
+	}
+
+	return f
+}
+
 func sessionGet(session *sessions.Session, key sessionKey) interface{} {
 	if session == nil || session.Values == nil {
 		return nil
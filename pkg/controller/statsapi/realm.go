@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+const (
+	// defaultDays and maxDays bound the number of days in a response.
+	defaultDays = 30
+	maxDays     = 90
+
+	// cacheTTL is how long stats are cached. Stats are updated as codes are
+	// issued and claimed, so they are only approximately current.
+	cacheTTL = 5 * time.Minute
+)
+
+// HandleRealmStats returns the daily code statistics of the realm which owns
+// the API key. The number of days is set by the "days" query parameter.
+func (c *Controller) HandleRealmStats() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		realm := controller.RealmFromContext(ctx)
+		if realm == nil {
+			controller.MissingRealm(w, r, c.h)
+			return
+		}
+
+		days, err := parseDays(r.URL.Query().Get("days"))
+		if err != nil {
+			c.h.RenderJSON(w, http.StatusBadRequest, api.Error(err).WithCode(api.ErrUnparsableRequest))
+			return
+		}
+
+		cacheKey := &cache.Key{
+			Namespace: "statsapi:realm",
+			Key:       fmt.Sprintf("%d:%d", realm.ID, days),
+		}
+
+		var stats database.RealmStats
+		if err := c.cacher.Fetch(ctx, cacheKey, &stats, cacheTTL, func() (interface{}, error) {
+			now := time.Now().UTC()
+			past := now.Add(-1 * time.Duration(days-1) * 24 * time.Hour)
+			return realm.Stats(c.db, past, now)
+		}); err != nil {
+			controller.InternalError(w, r, c.h, err)
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, buildResponse(stats))
+	})
+}
+
+// parseDays parses the number of days requested, which defaults to
+// defaultDays and cannot exceed maxDays.
+func parseDays(s string) (int, error) {
+	if s == "" {
+		return defaultDays, nil
+	}
+
+	days, err := strconv.Atoi(s)
+	if err != nil || days < 1 || days > maxDays {
+		return 0, fmt.Errorf("days must be between 1 and %d", maxDays)
+	}
+	return days, nil
+}
+
+// buildResponse converts the realm stats, which are most recent first, into
+// the API response.
+func buildResponse(stats database.RealmStats) *api.RealmStatsResponse {
+	resp := &api.RealmStatsResponse{
+		Days:  make([]*api.RealmStatsDay, 0, len(stats)),
+		Total: new(api.RealmStatsDay),
+	}
+
+	for _, stat := range stats {
+		resp.Days = append(resp.Days, &api.RealmStatsDay{
+			Date:         stat.Date.Format("2006-01-02"),
+			CodesIssued:  stat.CodesIssued,
+			CodesClaimed: stat.CodesClaimed,
+			ClaimRatio:   claimRatio(stat.CodesIssued, stat.CodesClaimed),
+		})
+
+		resp.Total.CodesIssued += stat.CodesIssued
+		resp.Total.CodesClaimed += stat.CodesClaimed
+	}
+	resp.Total.ClaimRatio = claimRatio(resp.Total.CodesIssued, resp.Total.CodesClaimed)
+
+	return resp
+}
+
+// claimRatio returns claimed/issued, or 0 if no codes were issued.
+func claimRatio(issued, claimed uint) float64 {
+	if issued == 0 {
+		return 0
+	}
+	return float64(claimed) / float64(issued)
+}
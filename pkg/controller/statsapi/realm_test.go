@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDays(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		exp  int
+		err  bool
+	}{
+		{name: "default", in: "", exp: defaultDays},
+		{name: "valid", in: "7", exp: 7},
+		{name: "max", in: "90", exp: maxDays},
+		{name: "zero", in: "0", err: true},
+		{name: "too_many", in: "91", err: true},
+		{name: "not_a_number", in: "week", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseDays(tc.in)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error %t, got %v", tc.err, err)
+			}
+			if got != tc.exp {
+				t.Errorf("expected %d to be %d", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestBuildResponse(t *testing.T) {
+	t.Parallel()
+
+	today := time.Date(2020, 10, 2, 0, 0, 0, 0, time.UTC)
+	stats := database.RealmStats{
+		{Date: today, CodesIssued: 4, CodesClaimed: 3},
+		{Date: today.Add(-24 * time.Hour), CodesIssued: 0, CodesClaimed: 0},
+		{Date: today.Add(-48 * time.Hour), CodesIssued: 6, CodesClaimed: 2},
+	}
+
+	exp := &api.RealmStatsResponse{
+		Days: []*api.RealmStatsDay{
+			{Date: "2020-10-02", CodesIssued: 4, CodesClaimed: 3, ClaimRatio: 0.75},
+			{Date: "2020-10-01"},
+			{Date: "2020-09-30", CodesIssued: 6, CodesClaimed: 2, ClaimRatio: 2.0 / 6.0},
+		},
+		Total: &api.RealmStatsDay{CodesIssued: 10, CodesClaimed: 5, ClaimRatio: 0.5},
+	}
+
+	if diff := cmp.Diff(exp, buildResponse(stats)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsapi serves read-only realm statistics to the realm's own
+// backend systems, authenticated by a stats API key.
+package statsapi
+
+import (
+	"context"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/render"
+)
+
+type Controller struct {
+	db     *database.Database
+	cacher cache.Cacher
+	h      *render.Renderer
+}
+
+func New(ctx context.Context, db *database.Database, cacher cache.Cacher, h *render.Renderer) *Controller {
+	return &Controller{
+		db:     db,
+		cacher: cacher,
+		h:      h,
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifyapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+)
+
+// externalIDClaimLimiter returns a function which rate limits attempts to claim
+// the realm's codes by the code's external ID, or nil if the realm does not
+// limit them. This catches guessing against one person's code which is spread
+// across many clients, which the per-client limits do not.
+func (c *Controller) externalIDClaimLimiter(realm *database.Realm) func(context.Context, string) error {
+	if realm == nil || c.limiter == nil {
+		return nil
+	}
+
+	windows := realm.ExternalIDClaimWindows()
+	if len(windows) == 0 {
+		return nil
+	}
+
+	return func(ctx context.Context, externalID string) error {
+		key, err := realm.ExternalIDClaimKey(c.config.RateLimit.HMACKey, externalID)
+		if err != nil {
+			return err
+		}
+
+		if err := ratelimit.TakeWindows(ctx, c.limiter, key, windows); err != nil {
+			var werr *ratelimit.WindowExceededError
+			if errors.As(err, &werr) {
+				return database.ErrTooManyExternalIDClaims
+			}
+			return fmt.Errorf("failed to take from limiter: %w", err)
+		}
+		return nil
+	}
+}
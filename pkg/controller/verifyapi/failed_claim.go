@@ -0,0 +1,75 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifyapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+)
+
+// errTooManyFailedClaims is returned when a device has claimed too many codes
+// which do not exist.
+var errTooManyFailedClaims = errors.New("too many claims of codes which do not exist")
+
+// takeFailedClaim counts a claim against the device's limit of claims of codes
+// which do not exist, before the code is looked up. Wrong codes cannot be
+// counted on any one code, so this is what limits guessing. The device is the
+// fingerprint if the realm requires one, since tokens are bound to it, or the
+// client IP otherwise.
+//
+// The returned function refunds the claim and must be called unless the code
+// was not found.
+func (c *Controller) takeFailedClaim(ctx context.Context, r *http.Request, realm *database.Realm, deviceFingerprint string) (func(), error) {
+	noop := func() {}
+	if realm == nil || c.limiter == nil {
+		return noop, nil
+	}
+
+	windows := realm.FailedClaimWindows()
+	if len(windows) == 0 {
+		return noop, nil
+	}
+
+	device := deviceFingerprint
+	if device == "" {
+		device = controller.ClientIP(r, c.config.Proxy.TrustedProxies)
+	}
+	key, err := realm.FailedClaimKey(c.config.RateLimit.HMACKey, device)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ratelimit.TakeWindows(ctx, c.limiter, key, windows); err != nil {
+		var werr *ratelimit.WindowExceededError
+		if errors.As(err, &werr) {
+			return nil, errTooManyFailedClaims
+		}
+		return nil, fmt.Errorf("failed to take from limiter: %w", err)
+	}
+
+	return func() {
+		if err := ratelimit.RefundWindows(ctx, c.limiter, key, windows); err != nil {
+			logging.FromContext(ctx).Named("verifyapi.takeFailedClaim").
+				Warnw("failed to refund failed claim", "error", err)
+		}
+	}, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifyapi
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/config"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+func TestController_takeFailedClaim(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := &Controller{
+		config: &config.APIServerConfig{
+			RateLimit: ratelimit.Config{HMACKey: []byte("abcd1234")},
+		},
+		limiter: &fakeStore{buckets: make(map[string]*fakeBucket)},
+	}
+	realm := &database.Realm{MaxFailedClaimAttempts: 2}
+	realm.ID = 1
+
+	r := httptest.NewRequest("POST", "/api/verify", nil)
+	r.RemoteAddr = "203.0.113.10:1234"
+
+	// Claims which find their code are refunded and never use up the limit.
+	for i := 0; i < 5; i++ {
+		refund, err := c.takeFailedClaim(ctx, r, realm, "")
+		if err != nil {
+			t.Fatalf("take %d: %v", i, err)
+		}
+		refund()
+	}
+
+	// Claims of codes which do not exist are not refunded.
+	for i := 0; i < 2; i++ {
+		if _, err := c.takeFailedClaim(ctx, r, realm, ""); err != nil {
+			t.Fatalf("take %d: %v", i, err)
+		}
+	}
+	if _, err := c.takeFailedClaim(ctx, r, realm, ""); !errors.Is(err, errTooManyFailedClaims) {
+		t.Errorf("expected %v, got %v", errTooManyFailedClaims, err)
+	}
+
+	// Other devices are counted separately.
+	if _, err := c.takeFailedClaim(ctx, r, realm, "device-1"); err != nil {
+		t.Errorf("expected other device to be allowed, got %v", err)
+	}
+	other := httptest.NewRequest("POST", "/api/verify", nil)
+	other.RemoteAddr = "203.0.113.11:1234"
+	if _, err := c.takeFailedClaim(ctx, other, realm, ""); err != nil {
+		t.Errorf("expected other IP to be allowed, got %v", err)
+	}
+
+	// Realms without a limit are not counted.
+	if _, err := c.takeFailedClaim(ctx, r, &database.Realm{}, ""); err != nil {
+		t.Errorf("expected unlimited realm to be allowed, got %v", err)
+	}
+}
+
+var _ limiter.Store = (*fakeStore)(nil)
+
+// fakeStore is a limiter.Store with buckets which never reset.
+type fakeStore struct {
+	buckets map[string]*fakeBucket
+}
+
+type fakeBucket struct {
+	tokens, remaining uint64
+}
+
+func (s *fakeStore) Take(_ context.Context, key string) (uint64, uint64, uint64, bool, error) {
+	b, ok := s.buckets[key]
+	if !ok || b.remaining == 0 {
+		return 0, 0, 0, false, nil
+	}
+	b.remaining--
+	return b.tokens, b.remaining, 0, true, nil
+}
+
+func (s *fakeStore) Get(_ context.Context, key string) (uint64, uint64, error) {
+	if b, ok := s.buckets[key]; ok {
+		return b.tokens, b.remaining, nil
+	}
+	return 0, 0, nil
+}
+
+func (s *fakeStore) Set(_ context.Context, key string, tokens uint64, _ time.Duration) error {
+	s.buckets[key] = &fakeBucket{tokens: tokens, remaining: tokens}
+	return nil
+}
+
+func (s *fakeStore) Burst(_ context.Context, key string, tokens uint64) error {
+	if b, ok := s.buckets[key]; ok {
+		b.remaining += tokens
+	}
+	return nil
+}
+
+func (s *fakeStore) Close(_ context.Context) error {
+	return nil
+}
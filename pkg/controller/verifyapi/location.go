@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifyapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/geo"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// checkClaimLocation compares the location of the request with the realm's
+// allowed claim countries. Claims from elsewhere are logged and counted. It
+// returns false if the claim must be rejected, which is only the case when the
+// realm enforces its countries and the location is known.
+func (c *Controller) checkClaimLocation(ctx context.Context, r *http.Request, realm *database.Realm) bool {
+	if realm == nil || len(realm.AllowedClaimCountries) == 0 {
+		return true
+	}
+
+	logger := logging.FromContext(ctx).Named("verifyapi.checkClaimLocation")
+
+	loc, err := c.geo.Locate(r)
+	if err != nil {
+		if !errors.Is(err, geo.ErrUnknownLocation) {
+			logger.Warnw("failed to locate claim", "error", err)
+		}
+		recordClaimLocation(ctx, "UNKNOWN")
+		return true
+	}
+
+	if realm.ClaimCountryAllowed(loc.Country) {
+		recordClaimLocation(ctx, "ALLOWED")
+		return true
+	}
+
+	logger.Warnw("claim from outside of the realm's allowed countries",
+		"realm", realm.ID,
+		"country", loc.Country,
+		"region", loc.Region,
+		"enforced", realm.EnforceClaimCountries)
+	recordClaimLocation(ctx, "OUTSIDE")
+	return !realm.EnforceClaimCountries
+}
+
+func recordClaimLocation(ctx context.Context, location string) {
+	ctx, err := tag.New(ctx, tag.Upsert(claimLocationTagKey, location))
+	if err != nil {
+		logging.FromContext(ctx).Errorw("failed to create claim location tag", "error", err)
+		return
+	}
+	stats.Record(ctx, mClaimLocation.M(1))
+}
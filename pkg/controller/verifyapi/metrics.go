@@ -21,12 +21,19 @@ import (
 	"go.opencensus.io/plugin/ochttp"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
 )
 
 const metricPrefix = observability.MetricRoot + "/api/verify"
 
 var (
 	mLatencyMs = stats.Float64(metricPrefix+"/request", "verify requests latency", stats.UnitMilliseconds)
+
+	mClaimLocation = stats.Int64(metricPrefix+"/claim_location", "claims checked against the realm's allowed countries", stats.UnitDimensionless)
+
+	// claimLocationTagKey is whether the claim was located in one of the
+	// realm's allowed countries.
+	claimLocationTagKey = tag.MustNewKey("location")
 )
 
 func init() {
@@ -45,5 +52,13 @@ func init() {
 			TagKeys:     observability.APITagKeys(),
 			Aggregation: ochttp.DefaultLatencyDistribution,
 		},
+		observability.SLOView(metricPrefix, mLatencyMs, "Latency distribution of verify requests by realm and blame"),
+		{
+			Name:        metricPrefix + "/claim_location_count",
+			Measure:     mClaimLocation,
+			Description: "Count of claims by location relative to the realm's allowed countries",
+			TagKeys:     append(observability.CommonTagKeys(), claimLocationTagKey),
+			Aggregation: view.Count(),
+		},
 	}...)
 }
@@ -21,10 +21,15 @@
 package verifyapi
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/google/exposure-notifications-verification-server/pkg/controller"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
@@ -37,7 +42,20 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+// HandleVerify exchanges a short code, long code, or claim link for a
+// verification token.
 func (c *Controller) HandleVerify() http.Handler {
+	return c.handleVerify(false)
+}
+
+// HandleVerifyLong exchanges a long code, a deep link which contains one, or a
+// claim link for a verification token. Short codes are never matched, which is
+// for apps that only scan codes or follow links.
+func (c *Controller) HandleVerifyLong() http.Handler {
+	return c.handleVerify(true)
+}
+
+func (c *Controller) handleVerify(longCodeOnly bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if c.config.MaintenanceMode {
 			c.h.RenderJSON(w, http.StatusTooManyRequests,
@@ -63,6 +81,7 @@ func (c *Controller) HandleVerify() http.Handler {
 		}
 
 		ctx = observability.WithRealmID(ctx, authApp.RealmID)
+		realm := controller.RealmFromContext(ctx)
 
 		var request api.VerifyCodeRequest
 		if err := controller.BindJSON(w, r, &request); err != nil {
@@ -96,11 +115,126 @@ func (c *Controller) HandleVerify() http.Handler {
 			return
 		}
 
+		// The API key may restrict the test types the app can process.
+		acceptTypes = authApp.EffectiveAcceptTypes(acceptTypes)
+
+		// Realms may restrict the countries from which codes are claimed.
+		if !c.checkClaimLocation(ctx, r, realm) {
+			blame = observability.BlameClient
+			result = observability.ResultError("CLAIM_LOCATION_NOT_ALLOWED")
+
+			c.h.RenderJSON(w, http.StatusForbidden,
+				api.Errorf("codes for this realm cannot be claimed from this location").WithCode(api.ErrClaimLocationNotAllowed))
+			return
+		}
+
+		// If the realm binds tokens to devices, the client must identify itself.
+		var deviceFingerprint string
+		if realm != nil && realm.RequireDeviceBinding {
+			deviceFingerprint = request.DeviceFingerprint
+			if deviceFingerprint == "" {
+				blame = observability.BlameClient
+				result = observability.ResultError("MISSING_DEVICE_FINGERPRINT")
+
+				c.h.RenderJSON(w, http.StatusBadRequest,
+					api.Errorf("this realm requires a device fingerprint").WithCode(api.ErrMissingDeviceFingerprint))
+				return
+			}
+		}
+
+		// Realms which never use short codes only match long codes, and deep links
+		// are only accepted where short codes are not.
+		code := request.VerificationCode
+		if longCodeOnly {
+			code = codeFromDeepLink(code)
+		}
+		if realm != nil && realm.DisableShortCodeClaims {
+			longCodeOnly = true
+		}
+		if longCodeOnly && realm != nil && realm.DisableLongCodes {
+			blame = observability.BlameClient
+			result = observability.ResultError("LONG_CODES_DISABLED")
+
+			c.h.RenderJSON(w, http.StatusBadRequest,
+				api.Errorf("long codes are not supported by this realm, enter the short code").WithCode(api.ErrLongCodesDisabled))
+			return
+		}
+
 		// Exchange the short term verification code for a long term verification token.
 		// The token can be used to sign TEKs later.
-		verificationToken, err := c.db.VerifyCodeAndIssueToken(authApp.RealmID, request.VerificationCode, acceptTypes, c.config.VerificationTokenDuration)
+		var allowedAppIDs []string
+		var negativeResultPolicy database.NegativeResultPolicy
+		var caseInsensitive bool
+		var codeSeparators string
+		var maxCodeDuration, maxLongCodeDuration time.Duration
+		var maxFailedClaimAttempts uint
+		var minClaimInterval time.Duration
+		if realm != nil {
+			allowedAppIDs = realm.AllowedClaimAppIDs
+			maxFailedClaimAttempts = realm.MaxFailedClaimAttempts
+			minClaimInterval = time.Duration(realm.MinClaimIntervalSeconds) * time.Second
+			negativeResultPolicy = realm.NegativeResultPolicy
+			caseInsensitive = realm.CaseInsensitiveCodes
+			codeSeparators = realm.CodeSeparators
+			if realm.StrictCodeExpiry {
+				maxCodeDuration = realm.CodeDuration.Duration
+				maxLongCodeDuration = realm.LongCodeDuration.Duration
+			}
+		}
+
+		expireAfter := c.config.VerificationTokenDuration
+		if realm != nil {
+			expireAfter = realm.EffectiveTokenDuration(expireAfter)
+		}
+
+		var negativeExpireAfter time.Duration
+		if negativeResultPolicy == database.NegativeResultShortExpiry {
+			negativeExpireAfter = c.config.NegativeResultTokenDuration
+		}
+
+		// Claims of codes which do not exist are limited per device.
+		refundFailedClaim, err := c.takeFailedClaim(ctx, r, realm, deviceFingerprint)
+		if err != nil {
+			if errors.Is(err, errTooManyFailedClaims) {
+				blame = observability.BlameClient
+				result = observability.ResultError("FAILED_CLAIM_RATE_LIMIT_EXCEEDED")
+				c.h.RenderJSON(w, http.StatusTooManyRequests,
+					api.Errorf("too many attempts with invalid codes, try again later").WithCode(api.ErrClaimRateLimitExceeded))
+				return
+			}
+
+			logger.Errorw("failed to check failed claims", "error", err)
+			blame = observability.BlameServer
+			result = observability.ResultError("FAILED_TO_TAKE_FROM_LIMITER")
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		verificationToken, err := c.db.VerifyCodeAndIssueToken(ctx, &database.IssueTokenRequest{
+			RealmID:             authApp.RealmID,
+			VerificationCode:    code,
+			AcceptTypes:         acceptTypes,
+			ExpireAfter:         expireAfter,
+			NegativeExpireAfter: negativeExpireAfter,
+			DeviceFingerprint:   deviceFingerprint,
+			AppID:               request.AppID,
+			AllowedAppIDs:       allowedAppIDs,
+			CaseInsensitive:     caseInsensitive,
+			CodeSeparators:      codeSeparators,
+			LongCodeOnly:        longCodeOnly,
+			MaxCodeDuration:     maxCodeDuration,
+			MaxLongCodeDuration: maxLongCodeDuration,
+
+			MaxFailedClaimAttempts: maxFailedClaimAttempts,
+			MinClaimInterval:       minClaimInterval,
+			CheckExternalID:        c.externalIDClaimLimiter(realm),
+		})
+		if !errors.Is(err, database.ErrVerificationCodeNotFound) {
+			refundFailedClaim()
+		}
 		if err != nil {
 			blame = observability.BlameClient
+			var rejectedErr *database.ClaimRejectedError
 			switch {
 			case errors.Is(err, database.ErrVerificationCodeExpired):
 				result = observability.ResultError("VERIFICATION_CODE_EXPIRED")
@@ -110,14 +244,51 @@ func (c *Controller) HandleVerify() http.Handler {
 				result = observability.ResultError("VERIFICATION_CODE_INVALID")
 				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification code invalid").WithCode(api.ErrVerifyCodeInvalid))
 				return
+			case errors.Is(err, database.ErrVerificationCodePending):
+				result = observability.ResultError("VERIFICATION_CODE_PENDING_APPROVAL")
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification code has not been approved yet, try again later").WithCode(api.ErrVerifyCodePendingApproval))
+				return
+			case errors.Is(err, database.ErrTooManyClaimAttempts):
+				result = observability.ResultError("VERIFICATION_CODE_TOO_MANY_ATTEMPTS")
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification code expired after too many failed attempts, request a new code").WithCode(api.ErrVerifyCodeTooManyAttempts))
+				return
+			case errors.Is(err, database.ErrTooManyExternalIDClaims):
+				result = observability.ResultError("EXTERNAL_ID_CLAIM_RATE_LIMIT_EXCEEDED")
+				c.h.RenderJSON(w, http.StatusTooManyRequests, api.Errorf("too many attempts to claim this code, try again later").WithCode(api.ErrClaimRateLimitExceeded))
+				return
+			case errors.As(err, &rejectedErr):
+				result = observability.ResultError("CLAIM_REJECTED")
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("%s", rejectedErr.Reason).WithCode(api.ErrClaimRejected))
+				return
+			case errors.Is(err, database.ErrVerificationCodeBadExpiry):
+				result = observability.ResultError("VERIFICATION_CODE_BAD_EXPIRY")
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification code expiry is invalid").WithCode(api.ErrVerifyCodeBadExpiry))
+				return
+			case errors.Is(err, database.ErrVerificationCodeNotFound) && looksLikeShortCode(realm, code):
+				result = observability.ResultError("SHORT_CODES_DISABLED")
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("short codes are not accepted by this realm, scan the code or follow the link").WithCode(api.ErrShortCodesDisabled))
+				return
+			case errors.Is(err, database.ErrVerificationCodeNotFound) && looksLikeLongCode(realm, code):
+				result = observability.ResultError("LONG_CODES_DISABLED")
+				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("long codes are not supported by this realm, enter the short code").WithCode(api.ErrLongCodesDisabled))
+				return
 			case errors.Is(err, database.ErrVerificationCodeNotFound):
 				result = observability.ResultError("VERIFICATION_CODE_NOT_FOUND")
 				c.h.RenderJSON(w, http.StatusBadRequest, api.Errorf("verification code invalid").WithCode(api.ErrVerifyCodeInvalid))
 				return
+			case errors.Is(err, database.ErrAppNotAllowed):
+				result = observability.ResultError("APP_NOT_ALLOWED")
+				c.h.RenderJSON(w, http.StatusUnauthorized, api.Errorf("app is not allowed to claim codes for this realm").WithCode(api.ErrAppNotAllowed))
+				return
 			case errors.Is(err, database.ErrUnsupportedTestType):
 				result = observability.ResultError("VERIFICATION_CODE_UNSUPPORTED_TEST_TYPE")
 				c.h.RenderJSON(w, http.StatusPreconditionFailed, api.Errorf("verification code has unsupported test type").WithCode(api.ErrUnsupportedTestType))
 				return
+			case database.IsQueryTimeout(err):
+				blame = observability.BlameServer
+				result = observability.ResultError("QUERY_TIMEOUT")
+				c.h.RenderJSON(w, http.StatusGatewayTimeout, api.Errorf("timed out verifying code, please try again").WithCode(api.ErrInternal))
+				return
 			default:
 				logger.Errorw("failed to issue verification token", "error", err)
 				result = observability.ResultError("UNKNOWN_ERROR")
@@ -126,14 +297,21 @@ func (c *Controller) HandleVerify() http.Handler {
 			}
 		}
 
+		issuer := c.config.TokenSigning.TokenIssuer
+		audience := c.config.TokenSigning.TokenIssuer
+		if realm != nil {
+			issuer = realm.EffectiveTokenIssuer(issuer)
+			audience = realm.EffectiveTokenAudience(audience)
+		}
+
 		subject := verificationToken.Subject()
 		now := time.Now().UTC()
 		claims := &jwt.StandardClaims{
-			Audience:  c.config.TokenSigning.TokenIssuer,
-			ExpiresAt: now.Add(c.config.VerificationTokenDuration).Unix(),
+			Audience:  audience,
+			ExpiresAt: verificationToken.ExpiresAt.Unix(),
 			Id:        verificationToken.TokenID,
 			IssuedAt:  now.Unix(),
-			Issuer:    c.config.TokenSigning.TokenIssuer,
+			Issuer:    issuer,
 			Subject:   subject.String(),
 		}
 		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
@@ -147,11 +325,129 @@ func (c *Controller) HandleVerify() http.Handler {
 			return
 		}
 
-		c.h.RenderJSON(w, http.StatusOK, api.VerifyCodeResponse{
+		resp := &api.VerifyCodeResponse{
 			TestType:          verificationToken.TestType,
 			SymptomDate:       verificationToken.FormatSymptomDate(),
 			TestDate:          verificationToken.FormatTestDate(),
 			VerificationToken: signedJWT,
-		})
+		}
+
+		// Informational-only negative results confirm the result to the app, but
+		// there is nothing to upload, so the token is withheld.
+		if verificationToken.TestType == "negative" && negativeResultPolicy == database.NegativeResultInformational {
+			resp.VerificationToken = ""
+		}
+
+		var mapping map[string]string
+		if realm != nil {
+			resp.RedirectURL = realm.ClaimRedirectURL
+
+			resp.TestType, err = realm.ReportTypeFor(verificationToken.TestType)
+			if err != nil {
+				logger.Errorw("failed to map report type", "error", err)
+				blame = observability.BlameServer
+				result = observability.ResultError("INVALID_REPORT_TYPE_MAPPING")
+
+				c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+				return
+			}
+
+			// The claim response mapping renames JSON fields for apps, so it does
+			// not apply to the gRPC API, which has a fixed schema.
+			if !controller.GRPCFromContext(ctx) {
+				mapping, err = realm.ClaimResponseFieldMapping()
+				if err != nil {
+					logger.Errorw("invalid claim response mapping", "error", err)
+					blame = observability.BlameServer
+					result = observability.ResultError("INVALID_CLAIM_RESPONSE_MAPPING")
+
+					c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+					return
+				}
+			}
+		}
+
+		mapped, err := mapClaimResponse(resp, mapping)
+		if err != nil {
+			logger.Errorw("failed to map claim response", "error", err)
+			blame = observability.BlameServer
+			result = observability.ResultError("FAILED_TO_MAP_CLAIM_RESPONSE")
+
+			c.h.RenderJSON(w, http.StatusInternalServerError, api.InternalError())
+			return
+		}
+
+		c.h.RenderJSON(w, http.StatusOK, mapped)
 	})
 }
+
+// mapClaimResponse renames or omits fields in the response according to the
+// realm's claim response mapping. If the mapping is empty, the response is
+// returned unchanged.
+func mapClaimResponse(resp *api.VerifyCodeResponse, mapping map[string]string) (interface{}, error) {
+	if len(mapping) == 0 {
+		return resp, nil
+	}
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	out := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		name, ok := mapping[k]
+		if !ok {
+			name = k
+		}
+		if name == "" {
+			continue
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+// looksLikeLongCode returns true if the realm does not issue long codes and the
+// code is longer than the realm's short codes, which happens when a user follows
+// an old or forged deep link.
+func looksLikeLongCode(realm *database.Realm, code string) bool {
+	if realm == nil || !realm.DisableLongCodes || database.IsClaimLinkToken(code) {
+		return false
+	}
+	return uint(len(database.StripCodeSeparators(code, realm.CodeSeparators))) > realm.CodeLength
+}
+
+// looksLikeShortCode returns true if the realm does not accept short codes and
+// the code is no longer than the realm's short codes, which happens when a user
+// types the short code into an app which supports it.
+func looksLikeShortCode(realm *database.Realm, code string) bool {
+	if realm == nil || !realm.DisableShortCodeClaims || database.IsClaimLinkToken(code) {
+		return false
+	}
+	return uint(len(database.StripCodeSeparators(code, realm.CodeSeparators))) <= realm.CodeLength
+}
+
+// codeFromDeepLink returns the code in the "c" query parameter if s is a deep
+// link, such as "ens://v?r=US-WA&c=1234abcd" or
+// "https://us-wa.en.express/v?c=1234abcd". Anything else is returned unchanged.
+func codeFromDeepLink(s string) string {
+	s = project.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	if code := u.Query().Get("c"); code != "" {
+		return code
+	}
+	return s
+}
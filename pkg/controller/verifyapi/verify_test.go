@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verifyapi
+
+import (
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestLooksLikeLongCode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		realm *database.Realm
+		code  string
+		exp   bool
+	}{
+		{
+			name:  "nil_realm",
+			realm: nil,
+			code:  "abcdefgh12345678",
+		},
+		{
+			name:  "long_codes_enabled",
+			realm: &database.Realm{CodeLength: 8},
+			code:  "abcdefgh12345678",
+		},
+		{
+			name:  "short_code",
+			realm: &database.Realm{CodeLength: 8, DisableLongCodes: true},
+			code:  "12345678",
+		},
+		{
+			name:  "shorter_code",
+			realm: &database.Realm{CodeLength: 8, DisableLongCodes: true},
+			code:  "1234",
+		},
+		{
+			name:  "long_code",
+			realm: &database.Realm{CodeLength: 8, DisableLongCodes: true},
+			code:  "123456789",
+			exp:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := looksLikeLongCode(tc.realm, tc.code), tc.exp; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+}
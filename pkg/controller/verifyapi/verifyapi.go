@@ -16,26 +16,38 @@ package verifyapi
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-verification-server/pkg/config"
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/geo"
 	"github.com/google/exposure-notifications-verification-server/pkg/render"
+	"github.com/sethvargo/go-limiter"
 )
 
 // Controller is a controller for the verification code verification API.
 type Controller struct {
-	config *config.APIServerConfig
-	db     *database.Database
-	h      *render.Renderer
-	kms    keys.KeyManager
+	config  *config.APIServerConfig
+	db      *database.Database
+	geo     geo.Provider
+	h       *render.Renderer
+	kms     keys.KeyManager
+	limiter limiter.Store
 }
 
-func New(ctx context.Context, config *config.APIServerConfig, db *database.Database, h *render.Renderer, kms keys.KeyManager) (*Controller, error) {
+func New(ctx context.Context, config *config.APIServerConfig, db *database.Database, limiter limiter.Store, h *render.Renderer, kms keys.KeyManager) (*Controller, error) {
+	geoProvider, err := geo.ProviderFor(ctx, &config.Geo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create geo provider: %w", err)
+	}
+
 	return &Controller{
-		config: config,
-		db:     db,
-		h:      h,
-		kms:    kms,
+		config:  config,
+		db:      db,
+		geo:     geoProvider,
+		h:       h,
+		kms:     kms,
+		limiter: limiter,
 	}, nil
 }
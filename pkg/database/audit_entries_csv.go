@@ -0,0 +1,64 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuditEntries is a list of audit entries which can be exported as CSV.
+type AuditEntries []*AuditEntry
+
+// MarshalCSV returns bytes in CSV format.
+func (a AuditEntries) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(a) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"id", "realm_id", "created_at", "actor_id", "actor", "action", "target_id", "target", "diff"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, entry := range a {
+		if err := w.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			strconv.FormatUint(uint64(entry.RealmID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.ActorID,
+			entry.ActorDisplay,
+			entry.Action,
+			entry.TargetID,
+			entry.TargetDisplay,
+			entry.Diff,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
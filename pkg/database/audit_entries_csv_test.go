@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditEntries_MarshalCSV(t *testing.T) {
+	t.Parallel()
+
+	if b, err := AuditEntries(nil).MarshalCSV(); err != nil || b != nil {
+		t.Errorf("expected no output for no entries, got %q, %v", b, err)
+	}
+
+	entries := AuditEntries{
+		{
+			ID:            1,
+			RealmID:       2,
+			ActorID:       "users:1",
+			ActorDisplay:  "Jane Doe (jane@example.com)",
+			Action:        "updated realm",
+			TargetID:      "realms:2",
+			TargetDisplay: "State, North",
+			Diff:          "- a\n+ b\n",
+			CreatedAt:     time.Date(2020, 11, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}
+
+	b, err := entries.MarshalCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "id,realm_id,created_at,actor_id,actor,action,target_id,target,diff\n" +
+		"1,2,2020-11-01T10:00:00Z,users:1,Jane Doe (jane@example.com),updated realm,realms:2,\"State, North\",\"- a\n+ b\n\"\n"
+	if got := string(b); got != exp {
+		t.Errorf("expected\n%s\nto be\n%s", got, exp)
+	}
+}
@@ -15,11 +15,32 @@
 package database
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
 )
 
+const (
+	// MaxAuditQueryWindow is the longest time range an audit log query may
+	// cover. Queries without a start time cover this window before the end time.
+	MaxAuditQueryWindow = 90 * 24 * time.Hour
+
+	// MaxAuditExportEntries is the maximum number of audit entries in an export.
+	MaxAuditExportEntries = 10000
+
+	// maxAuditQueryFieldLength is the maximum length of each text filter.
+	maxAuditQueryFieldLength = 255
+)
+
+// ErrInvalidAuditLogQuery is returned when an audit log query is invalid or
+// too broad.
+var ErrInvalidAuditLogQuery = errors.New("invalid audit log query")
+
 // AuditEntry represents an event in the system. These records are purged after
 // a configurable number of days by the cleanup job. The AuditEntry specifically
 // does NOT make use of foreign keys or relationships to avoid breaking an audit
@@ -63,6 +84,41 @@ type AuditEntry struct {
 	CreatedAt time.Time
 }
 
+// sinkEntry returns the form of the entry sent to an audit sink.
+func (a *AuditEntry) sinkEntry() *auditsink.Entry {
+	return &auditsink.Entry{
+		ID:            a.ID,
+		RealmID:       a.RealmID,
+		ActorID:       a.ActorID,
+		ActorDisplay:  a.ActorDisplay,
+		Action:        a.Action,
+		TargetID:      a.TargetID,
+		TargetDisplay: a.TargetDisplay,
+		Diff:          a.Diff,
+		CreatedAt:     a.CreatedAt,
+	}
+}
+
+// callbackForwardAuditEntry sends each audit entry to the sink after it is
+// created. Forwarding happens in the background and does not affect the
+// database write. Entries are sent when they are written, so an entry created
+// in a transaction which is later rolled back may still be forwarded.
+func callbackForwardAuditEntry(sink auditsink.Sink) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		if scope.TableName() != "audit_entries" {
+			return
+		}
+
+		if scope.HasError() {
+			return
+		}
+
+		if entry, ok := scope.Value.(*AuditEntry); ok {
+			sink.Send(entry.sinkEntry())
+		}
+	}
+}
+
 // SaveAuditEntry saves the audit entry.
 func (db *Database) SaveAuditEntry(a *AuditEntry) error {
 	return db.db.Save(a).Error
@@ -107,3 +163,86 @@ func (db *Database) ListAudits(p *pagination.PageParams, scopes ...Scope) ([]*Au
 
 	return entries, paginator, nil
 }
+
+// AuditLogQuery filters the audit log. Empty fields match all entries.
+type AuditLogQuery struct {
+	// ActorID and TargetID match the actor and target exactly, for example
+	// "users:1".
+	ActorID  string
+	TargetID string
+
+	// Action matches actions which start with the value, ignoring case, for
+	// example "updated" or "created api key".
+	Action string
+
+	// From and To bound the time of the entries. If To is zero, it is the
+	// current time. If From is zero, it is MaxAuditQueryWindow before To.
+	From time.Time
+	To   time.Time
+}
+
+// scope validates the query and returns a scope which applies it. All values
+// are passed to the database as parameters.
+func (q *AuditLogQuery) scope(now time.Time) (Scope, error) {
+	actorID := strings.TrimSpace(q.ActorID)
+	targetID := strings.TrimSpace(q.TargetID)
+	action := strings.ToLower(strings.TrimSpace(q.Action))
+	for _, v := range []string{actorID, targetID, action} {
+		if len(v) > maxAuditQueryFieldLength {
+			return nil, fmt.Errorf("%w: filters must be no more than %d characters", ErrInvalidAuditLogQuery, maxAuditQueryFieldLength)
+		}
+	}
+
+	to := q.To
+	if to.IsZero() {
+		to = now
+	}
+	from := q.From
+	if from.IsZero() {
+		from = to.Add(-MaxAuditQueryWindow)
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: start time must be before end time", ErrInvalidAuditLogQuery)
+	}
+	if to.Sub(from) > MaxAuditQueryWindow {
+		return nil, fmt.Errorf("%w: time range must be no more than %d days", ErrInvalidAuditLogQuery, MaxAuditQueryWindow/(24*time.Hour))
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.
+			Where("audit_entries.created_at >= ?", from.UTC()).
+			Where("audit_entries.created_at <= ?", to.UTC())
+		if actorID != "" {
+			db = db.Where("audit_entries.actor_id = ?", actorID)
+		}
+		if targetID != "" {
+			db = db.Where("audit_entries.target_id = ?", targetID)
+		}
+		if action != "" {
+			db = db.Where("LOWER(audit_entries.action) LIKE ?", escapeLike(action)+"%")
+		}
+		return db
+	}, nil
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern, using the
+// default escape character.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// QueryAuditLog returns the audit entries which match the query, most recent
+// first. Use WithAuditRealmID to scope the query to a realm. It returns an error
+// if the query is invalid or covers too long a time range.
+func (db *Database) QueryAuditLog(q *AuditLogQuery, p *pagination.PageParams, scopes ...Scope) ([]*AuditEntry, *pagination.Paginator, error) {
+	if q == nil {
+		q = new(AuditLogQuery)
+	}
+
+	scope, err := q.scope(time.Now().UTC())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db.ListAudits(p, append(scopes, scope)...)
+}
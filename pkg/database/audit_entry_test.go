@@ -0,0 +1,125 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+)
+
+func TestAuditLogQuery_Scope(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().UTC()
+
+	cases := []struct {
+		name  string
+		query *AuditLogQuery
+		err   string
+	}{
+		{
+			name:  "empty",
+			query: &AuditLogQuery{},
+		},
+		{
+			name:  "window",
+			query: &AuditLogQuery{From: now.Add(-MaxAuditQueryWindow), To: now},
+		},
+		{
+			name:  "too_long",
+			query: &AuditLogQuery{From: now.Add(-MaxAuditQueryWindow - time.Hour), To: now},
+			err:   "time range must be no more than 90 days",
+		},
+		{
+			name:  "from_too_old",
+			query: &AuditLogQuery{From: now.Add(-2 * MaxAuditQueryWindow)},
+			err:   "time range must be no more than 90 days",
+		},
+		{
+			name:  "reversed",
+			query: &AuditLogQuery{From: now, To: now.Add(-time.Hour)},
+			err:   "start time must be before end time",
+		},
+		{
+			name:  "long_filter",
+			query: &AuditLogQuery{ActorID: strings.Repeat("a", maxAuditQueryFieldLength+1)},
+			err:   "filters must be no more than",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tc.query.scope(now)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected %q to contain %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestDatabase_QueryAuditLog(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	now := time.Now().UTC()
+	for _, entry := range []*AuditEntry{
+		{RealmID: 1, ActorID: "users:1", Action: "updated realm", TargetID: "realms:1", CreatedAt: now.Add(-time.Hour)},
+		{RealmID: 1, ActorID: "users:2", Action: "created API key", TargetID: "authorized_apps:1", CreatedAt: now.Add(-2 * time.Hour)},
+		{RealmID: 1, ActorID: "users:1", Action: "updated_100%", TargetID: "realms:1", CreatedAt: now.Add(-48 * time.Hour)},
+		{RealmID: 2, ActorID: "users:1", Action: "updated realm", TargetID: "realms:2", CreatedAt: now.Add(-time.Hour)},
+	} {
+		if err := db.SaveAuditEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		query *AuditLogQuery
+		exp   int
+	}{
+		{name: "realm", query: &AuditLogQuery{}, exp: 3},
+		{name: "actor", query: &AuditLogQuery{ActorID: "users:1"}, exp: 2},
+		{name: "target", query: &AuditLogQuery{TargetID: "authorized_apps:1"}, exp: 1},
+		{name: "action_prefix", query: &AuditLogQuery{Action: "UPDATED"}, exp: 2},
+		{name: "action_wildcards", query: &AuditLogQuery{Action: "updated_"}, exp: 1},
+		{name: "action_literal_percent", query: &AuditLogQuery{Action: "%"}, exp: 0},
+		{name: "time", query: &AuditLogQuery{From: now.Add(-3 * time.Hour)}, exp: 2},
+	}
+
+	for _, tc := range cases {
+		entries, _, err := db.QueryAuditLog(tc.query, &pagination.PageParams{Limit: 10}, WithAuditRealmID(1))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got, want := len(entries), tc.exp; got != want {
+			t.Errorf("%s: expected %d entries to be %d: %v", tc.name, got, want, entries)
+		}
+	}
+}
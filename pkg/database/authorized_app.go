@@ -27,11 +27,20 @@ import (
 	"github.com/google/exposure-notifications-server/pkg/base64util"
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
 	"github.com/jinzhu/gorm"
 )
 
 const (
 	apiKeyBytes = 64 // 64 bytes is 86 chararacters in non-padded base64.
+
+	// apiKeyTouchInterval is how often the last use of an API key is written to
+	// the database.
+	apiKeyTouchInterval = time.Hour
+
+	// MaxAPIKeyRotationGracePeriod is the longest an API key which was replaced
+	// by rotation is still accepted.
+	MaxAPIKeyRotationGracePeriod = 7 * 24 * time.Hour
 )
 
 type APIKeyType int
@@ -40,6 +49,10 @@ const (
 	APIKeyTypeInvalid APIKeyType = iota - 1
 	APIKeyTypeDevice
 	APIKeyTypeAdmin
+
+	// APIKeyTypeStats can only read the realm's statistics. It is for the
+	// realm's own backend systems, such as dashboards.
+	APIKeyTypeStats
 )
 
 func (a APIKeyType) Display() string {
@@ -48,6 +61,8 @@ func (a APIKeyType) Display() string {
 		return "device"
 	case APIKeyTypeAdmin:
 		return "admin"
+	case APIKeyTypeStats:
+		return "stats"
 	default:
 		return "invalid"
 	}
@@ -81,6 +96,30 @@ type AuthorizedApp struct {
 
 	// APIKeyType is the API key type.
 	APIKeyType APIKeyType `gorm:"column:api_key_type; type:integer; not null;"`
+
+	// PreviousAPIKey is the HMACed API key which was replaced when the key was
+	// last rotated. It is still accepted until PreviousAPIKeyExpiresAt, so
+	// clients can switch to the new key without an outage.
+	PreviousAPIKey          string     `gorm:"column:previous_api_key; type:varchar(512); not null; default:'';"`
+	PreviousAPIKeyExpiresAt *time.Time `gorm:"column:previous_api_key_expires_at;"`
+
+	// LastUsedAt is approximately when the API key was last used. It is updated
+	// at most once per apiKeyTouchInterval.
+	LastUsedAt *time.Time `gorm:"column:last_used_at;"`
+
+	// InactivityExempt keeps the API key from being disabled when it is not
+	// used, such as for keys which are only used in emergencies.
+	InactivityExempt bool `gorm:"column:inactivity_exempt; type:bool; not null; default:false;"`
+
+	// InactivityWarnedAt is when realm admins were warned that the API key will
+	// be disabled for inactivity. It is cleared when the key is used.
+	InactivityWarnedAt *time.Time `gorm:"column:inactivity_warned_at;"`
+
+	// AcceptTestTypes are the test types of codes which can be claimed with this
+	// API key, for apps which cannot process every test type. Codes of other
+	// types are rejected when claimed, even if the app requests them. If zero,
+	// the app accepts the types it requests.
+	AcceptTestTypes TestType `gorm:"column:accept_test_types; type:smallint; not null; default:0;"`
 }
 
 // BeforeSave runs validations. If there are errors, the save fails.
@@ -91,10 +130,19 @@ func (a *AuthorizedApp) BeforeSave(tx *gorm.DB) error {
 		a.AddError("name", "cannot be blank")
 	}
 
-	if !(a.APIKeyType == APIKeyTypeDevice || a.APIKeyType == APIKeyTypeAdmin) {
+	if !(a.APIKeyType == APIKeyTypeDevice || a.APIKeyType == APIKeyTypeAdmin || a.APIKeyType == APIKeyTypeStats) {
 		a.AddError("type", "is invalid")
 	}
 
+	if a.AcceptTestTypes != 0 {
+		if !a.IsDeviceType() {
+			a.AddError("acceptTestTypes", "can only be set on device API keys")
+		}
+		if a.AcceptTestTypes&^(TestTypeConfirmed|TestTypeLikely|TestTypeNegative) != 0 {
+			a.AddError("acceptTestTypes", "is invalid")
+		}
+	}
+
 	if len(a.Errors()) > 0 {
 		return fmt.Errorf("validation failed")
 	}
@@ -109,6 +157,37 @@ func (a *AuthorizedApp) IsDeviceType() bool {
 	return a.APIKeyType == APIKeyTypeDevice
 }
 
+func (a *AuthorizedApp) IsStatsType() bool {
+	return a.APIKeyType == APIKeyTypeStats
+}
+
+// EffectiveAcceptTypes returns the requested test types which the app accepts.
+func (a *AuthorizedApp) EffectiveAcceptTypes(requested api.AcceptTypes) api.AcceptTypes {
+	if a.AcceptTestTypes == 0 {
+		return requested
+	}
+
+	accepted := make(api.AcceptTypes, len(requested))
+	for _, typ := range a.AcceptTestTypes.Names() {
+		if _, ok := requested[typ]; ok {
+			accepted.AddAcceptTypes(typ)
+		}
+	}
+	return accepted
+}
+
+// PreviousAPIKeyActive returns true if the API key replaced by the last
+// rotation is still accepted.
+func (a *AuthorizedApp) PreviousAPIKeyActive() bool {
+	return a.PreviousAPIKey != "" && a.PreviousAPIKeyExpiresAt != nil &&
+		time.Now().Before(*a.PreviousAPIKeyExpiresAt)
+}
+
+// NeedsTouch returns true if the last use of the API key is stale.
+func (a *AuthorizedApp) NeedsTouch() bool {
+	return a.LastUsedAt == nil || time.Since(*a.LastUsedAt) > apiKeyTouchInterval
+}
+
 // Realm returns the associated realm for this app.
 func (a *AuthorizedApp) Realm(db *Database) (*Realm, error) {
 	var realm Realm
@@ -128,30 +207,139 @@ func (AuthorizedApp) TableName() string {
 // only time the API key is available is as the string return parameter from
 // invoking this function.
 func (r *Realm) CreateAuthorizedApp(db *Database, app *AuthorizedApp, actor Auditable) (string, error) {
-	fullAPIKey, err := db.GenerateAPIKey(r.ID)
+	fullAPIKey, hmacedKey, preview, err := db.generateAuthorizedAppKey(r.ID)
+	if err != nil {
+		return "", err
+	}
+
+	app.RealmID = r.ID
+	app.APIKey = hmacedKey
+	app.APIKeyPreview = preview
+
+	if err := db.SaveAuthorizedApp(app, actor); err != nil {
+		return "", err
+	}
+	return fullAPIKey, nil
+}
+
+// generateAuthorizedAppKey generates a new API key for the realm. It returns
+// the full API key, which is only shown to the user, and the HMAC and preview
+// which are stored.
+func (db *Database) generateAuthorizedAppKey(realmID uint) (string, string, string, error) {
+	fullAPIKey, err := db.GenerateAPIKey(realmID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate API key: %w", err)
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
 	}
 
 	parts := strings.SplitN(fullAPIKey, ".", 3)
 	if len(parts) != 3 {
-		return "", fmt.Errorf("internal error, key is invalid")
+		return "", "", "", fmt.Errorf("internal error, key is invalid")
 	}
 	apiKey := parts[0]
 
 	hmacedKey, err := db.GenerateAPIKeyHMAC(apiKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to create hmac: %w", err)
+		return "", "", "", fmt.Errorf("failed to create hmac: %w", err)
 	}
+	return fullAPIKey, hmacedKey, apiKey[:6], nil
+}
 
-	app.RealmID = r.ID
-	app.APIKey = hmacedKey
-	app.APIKeyPreview = apiKey[:6]
+// RotatedAPIKey is an API key which was replaced by RotateAuthorizedApps.
+type RotatedAPIKey struct {
+	App    *AuthorizedApp
+	APIKey string
+}
 
-	if err := db.SaveAuthorizedApp(app, actor); err != nil {
-		return "", err
+// RotateAuthorizedApps replaces the key of every enabled API key in the realm,
+// for example after a suspected breach. The replaced keys are still accepted
+// for the grace period, which may be 0 to stop accepting them immediately. A
+// key which was already rotated loses its earlier replaced key.
+//
+// The keys are rotated in one transaction, so either every key is rotated or
+// none are. Like CreateAuthorizedApp, the new API keys are only available from
+// the return value.
+func (r *Realm) RotateAuthorizedApps(db *Database, grace time.Duration, actor Auditable) ([]*RotatedAPIKey, error) {
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
 	}
-	return fullAPIKey, nil
+	if grace < 0 || grace > MaxAPIKeyRotationGracePeriod {
+		return nil, fmt.Errorf("grace period must be between 0 and %s", MaxAPIKeyRotationGracePeriod)
+	}
+
+	var apps []*AuthorizedApp
+	if err := db.db.
+		Model(&AuthorizedApp{}).
+		Where("realm_id = ?", r.ID).
+		Order("LOWER(name)").
+		Find(&apps).
+		Error; err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	// Generate the keys first, to keep the transaction short.
+	type rotation struct {
+		apiKey, hmacedKey, preview string
+	}
+	rotations := make([]*rotation, 0, len(apps))
+	for _, app := range apps {
+		apiKey, hmacedKey, preview, err := db.generateAuthorizedAppKey(r.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rotate API key %q: %w", app.Name, err)
+		}
+		rotations = append(rotations, &rotation{apiKey, hmacedKey, preview})
+	}
+
+	var previousKey string
+	var previousExpiresAt *time.Time
+	if grace > 0 {
+		t := time.Now().UTC().Add(grace)
+		previousExpiresAt = &t
+	}
+
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		for i, app := range apps {
+			rot := rotations[i]
+			if previousExpiresAt != nil {
+				previousKey = app.APIKey
+			}
+
+			if err := tx.
+				Model(&AuthorizedApp{}).
+				Where("id = ?", app.ID).
+				UpdateColumns(map[string]interface{}{
+					"api_key":                     rot.hmacedKey,
+					"api_key_preview":             rot.preview,
+					"previous_api_key":            previousKey,
+					"previous_api_key_expires_at": previousExpiresAt,
+				}).
+				Error; err != nil {
+				return fmt.Errorf("failed to rotate API key %q: %w", app.Name, err)
+			}
+
+			audit := BuildAuditEntry(actor, "rotated API key", app, r.ID)
+			audit.Diff = stringDiff(app.APIKeyPreview, rot.preview)
+			if err := tx.Save(audit).Error; err != nil {
+				return fmt.Errorf("failed to save audits: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	results := make([]*RotatedAPIKey, 0, len(apps))
+	for i, app := range apps {
+		rot := rotations[i]
+		app.PreviousAPIKey = ""
+		if previousExpiresAt != nil {
+			app.PreviousAPIKey = app.APIKey
+		}
+		app.PreviousAPIKeyExpiresAt = previousExpiresAt
+		app.APIKey = rot.hmacedKey
+		app.APIKeyPreview = rot.preview
+		results = append(results, &RotatedAPIKey{App: app, APIKey: rot.apiKey})
+	}
+	return results, nil
 }
 
 // FindAuthorizedAppByAPIKey located an authorized app based on API key.
@@ -176,7 +364,7 @@ func (db *Database) FindAuthorizedAppByAPIKey(apiKey string) (*AuthorizedApp, er
 		// Find the API key that matches the constraints.
 		var app AuthorizedApp
 		if err := db.db.
-			Where("api_key IN (?)", hmacedKeys).
+			Scopes(withAPIKeyHMACs(hmacedKeys)).
 			Where("realm_id = ?", realmID).
 			First(&app).
 			Error; err != nil {
@@ -186,6 +374,11 @@ func (db *Database) FindAuthorizedAppByAPIKey(apiKey string) (*AuthorizedApp, er
 	}
 
 	// The API key is either invalid or a v1 API key.
+	if db.config.APIKeyRequireSigned {
+		logger.Warnw("rejecting unsigned api key")
+		return nil, gorm.ErrRecordNotFound
+	}
+
 	hmacedKeys, err := db.generateAPIKeyHMACs(apiKey)
 	if err != nil {
 		logger.Warnw("failed to create hmac", "error", err)
@@ -194,7 +387,7 @@ func (db *Database) FindAuthorizedAppByAPIKey(apiKey string) (*AuthorizedApp, er
 
 	var app AuthorizedApp
 	if err := db.db.
-		Or("api_key IN (?)", hmacedKeys).
+		Scopes(withAPIKeyHMACs(hmacedKeys)).
 		First(&app).
 		Error; err != nil {
 		return nil, err
@@ -202,6 +395,15 @@ func (db *Database) FindAuthorizedAppByAPIKey(apiKey string) (*AuthorizedApp, er
 	return &app, nil
 }
 
+// withAPIKeyHMACs matches API keys with any of the given HMACs, including keys
+// which were rotated but are still in their grace period.
+func withAPIKeyHMACs(hmacedKeys []string) Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("api_key IN (?) OR (previous_api_key IN (?) AND previous_api_key_expires_at > ?)",
+			hmacedKeys, hmacedKeys, time.Now().UTC())
+	}
+}
+
 // Stats returns the usage statistics for this app. If no stats exist, it
 // returns an empty array.
 func (a *AuthorizedApp) Stats(db *Database, start, stop time.Time) ([]*AuthorizedAppStats, error) {
@@ -270,6 +472,18 @@ func (db *Database) SaveAuthorizedApp(a *AuthorizedApp, actor Auditable) error {
 				audit.Diff = boolDiff(existing.DeletedAt == nil, a.DeletedAt == nil)
 				audits = append(audits, audit)
 			}
+
+			if existing.InactivityExempt != a.InactivityExempt {
+				audit := BuildAuditEntry(actor, "updated API key inactivity exemption", a, a.RealmID)
+				audit.Diff = boolDiff(existing.InactivityExempt, a.InactivityExempt)
+				audits = append(audits, audit)
+			}
+
+			if existing.AcceptTestTypes != a.AcceptTestTypes {
+				audit := BuildAuditEntry(actor, "updated API key accepted test types", a, a.RealmID)
+				audit.Diff = stringDiff(existing.AcceptTestTypes.Display(), a.AcceptTestTypes.Display())
+				audits = append(audits, audit)
+			}
 		}
 
 		// Save all audits
@@ -283,6 +497,83 @@ func (db *Database) SaveAuthorizedApp(a *AuthorizedApp, actor Auditable) error {
 	})
 }
 
+// TouchAuthorizedApp records that the API key was used. It does not change
+// UpdatedAt or create an audit entry.
+func (db *Database) TouchAuthorizedApp(a *AuthorizedApp) error {
+	now := time.Now().UTC()
+	a.LastUsedAt = &now
+	a.InactivityWarnedAt = nil
+
+	return db.db.
+		Model(&AuthorizedApp{}).
+		Where("id = ?", a.ID).
+		UpdateColumns(map[string]interface{}{
+			"last_used_at":         now,
+			"inactivity_warned_at": gorm.Expr("NULL"),
+		}).
+		Error
+}
+
+// ListInactiveAuthorizedApps lists the enabled, non-exempt API keys which have
+// not been used since the given time, oldest first.
+func (db *Database) ListInactiveAuthorizedApps(since time.Time) ([]*AuthorizedApp, error) {
+	var apps []*AuthorizedApp
+	if err := db.db.
+		Model(&AuthorizedApp{}).
+		Where("inactivity_exempt IS FALSE").
+		Where("COALESCE(last_used_at, created_at) < ?", since).
+		Order("COALESCE(last_used_at, created_at) ASC").
+		Find(&apps).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return apps, nil
+		}
+		return nil, err
+	}
+	return apps, nil
+}
+
+// MarkAuthorizedAppInactivityWarned records that realm admins were warned
+// that the API key will be disabled for inactivity.
+func (db *Database) MarkAuthorizedAppInactivityWarned(a *AuthorizedApp) error {
+	now := time.Now().UTC()
+	a.InactivityWarnedAt = &now
+
+	return db.db.
+		Model(&AuthorizedApp{}).
+		Where("id = ?", a.ID).
+		UpdateColumn("inactivity_warned_at", now).
+		Error
+}
+
+// DisableInactiveAuthorizedApp disables the API key because it has not been
+// used, recording the reason in the audit log. Like any disabled key, it can be
+// re-enabled until it is purged.
+func (db *Database) DisableInactiveAuthorizedApp(a *AuthorizedApp) error {
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		result := tx.
+			Model(&AuthorizedApp{}).
+			Where("id = ?", a.ID).
+			Where("deleted_at IS NULL").
+			UpdateColumn("deleted_at", now)
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to disable API key: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		a.DeletedAt = &now
+
+		audit := BuildAuditEntry(System, "disabled inactive API key", a, a.RealmID)
+		audit.Diff = boolDiff(true, false)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
 // GenerateAPIKeyHMAC generates the HMAC of the provided API key using the
 // latest HMAC key.
 func (db *Database) GenerateAPIKeyHMAC(apiKey string) (string, error) {
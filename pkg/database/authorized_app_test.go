@@ -19,6 +19,10 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestDatabase_CreateFindAPIKey(t *testing.T) {
@@ -74,6 +78,217 @@ func TestDatabase_CreateFindAPIKey(t *testing.T) {
 	}
 }
 
+func TestRealm_RotateAuthorizedApps(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var oldKeys []string
+	for _, name := range []string{"app 1", "app 2"} {
+		apiKey, err := realm.CreateAuthorizedApp(db, &AuthorizedApp{
+			Name:       name,
+			APIKeyType: APIKeyTypeDevice,
+		}, SystemTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldKeys = append(oldKeys, apiKey)
+	}
+
+	if _, err := realm.RotateAuthorizedApps(db, MaxAPIKeyRotationGracePeriod+time.Hour, SystemTest); err == nil {
+		t.Errorf("expected error for grace period over the maximum")
+	}
+
+	rotated, err := realm.RotateAuthorizedApps(db, time.Hour, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(rotated), 2; got != want {
+		t.Fatalf("expected %d keys to be rotated, got %d", want, got)
+	}
+
+	// New and old keys are both accepted during the grace period.
+	for i, r := range rotated {
+		got, err := db.FindAuthorizedAppByAPIKey(r.APIKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != r.App.ID {
+			t.Errorf("expected new key to find %d, got %d", r.App.ID, got.ID)
+		}
+
+		got, err = db.FindAuthorizedAppByAPIKey(oldKeys[i])
+		if err != nil {
+			t.Fatalf("expected old key to be accepted: %v", err)
+		}
+		if !got.PreviousAPIKeyActive() {
+			t.Errorf("expected previous key to be active")
+		}
+	}
+
+	// Rotating without a grace period stops accepting the keys immediately.
+	again, err := realm.RotateAuthorizedApps(db, 0, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range rotated {
+		if _, err := db.FindAuthorizedAppByAPIKey(r.APIKey); !IsNotFound(err) {
+			t.Errorf("expected rotated key to be rejected, got %v", err)
+		}
+		if _, err := db.FindAuthorizedAppByAPIKey(oldKeys[i]); !IsNotFound(err) {
+			t.Errorf("expected original key to be rejected, got %v", err)
+		}
+		if _, err := db.FindAuthorizedAppByAPIKey(again[i].APIKey); err != nil {
+			t.Errorf("expected new key to be accepted: %v", err)
+		}
+	}
+}
+
+func TestDatabase_FindAPIKey_RequireSigned(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signedApp := &AuthorizedApp{
+		Name:       "Signed",
+		APIKeyType: APIKeyTypeAdmin,
+	}
+	signedKey, err := realm.CreateAuthorizedApp(db, signedApp, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Legacy keys are stored as the HMAC of the whole key.
+	legacyKey := "legacyapikey1234567890"
+	hmacedKey, err := db.GenerateAPIKeyHMAC(legacyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyApp := &AuthorizedApp{
+		RealmID:       realm.ID,
+		Name:          "Legacy",
+		APIKey:        hmacedKey,
+		APIKeyPreview: legacyKey[:6],
+		APIKeyType:    APIKeyTypeAdmin,
+	}
+	if err := db.SaveAuthorizedApp(legacyApp, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.FindAuthorizedAppByAPIKey(legacyKey); err != nil {
+		t.Fatalf("expected legacy key to be allowed: %v", err)
+	}
+
+	db.config.APIKeyRequireSigned = true
+
+	if _, err := db.FindAuthorizedAppByAPIKey(legacyKey); !IsNotFound(err) {
+		t.Errorf("expected legacy key to be rejected, got %v", err)
+	}
+	if _, err := db.FindAuthorizedAppByAPIKey(signedKey); err != nil {
+		t.Errorf("expected signed key to be allowed: %v", err)
+	}
+}
+
+func TestDatabase_InactiveAuthorizedApps(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newApp := func(name string, exempt bool) *AuthorizedApp {
+		app := &AuthorizedApp{
+			Name:             name,
+			APIKeyType:       APIKeyTypeAdmin,
+			InactivityExempt: exempt,
+		}
+		if _, err := realm.CreateAuthorizedApp(db, app, SystemTest); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	unused := newApp("unused", false)
+	exempt := newApp("exempt", true)
+	used := newApp("used", false)
+
+	if err := db.TouchAuthorizedApp(used); err != nil {
+		t.Fatal(err)
+	}
+	if used.NeedsTouch() {
+		t.Errorf("expected touched app to not need a touch")
+	}
+
+	// Only the unused, non-exempt key is inactive. The used key was touched
+	// after apps were created, so pick a time in between.
+	since := used.LastUsedAt.Add(-1 * time.Nanosecond)
+	if err := db.db.Model(&AuthorizedApp{}).Where("id IN (?)", []uint{unused.ID, exempt.ID}).
+		UpdateColumn("created_at", since.Add(-1*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	apps, err := db.ListInactiveAuthorizedApps(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 1 || apps[0].ID != unused.ID {
+		t.Fatalf("expected only %d to be inactive, got %v", unused.ID, apps)
+	}
+
+	if err := db.MarkAuthorizedAppInactivityWarned(apps[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DisableInactiveAuthorizedApp(apps[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabled keys are no longer listed, and cannot be used.
+	apps, err = db.ListInactiveAuthorizedApps(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 0 {
+		t.Errorf("expected no inactive apps, got %v", apps)
+	}
+
+	got, err := realm.FindAuthorizedApp(db, unused.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DeletedAt == nil {
+		t.Errorf("expected app to be disabled")
+	}
+	if got.InactivityWarnedAt == nil {
+		t.Errorf("expected app to be marked as warned")
+	}
+
+	audits, _, err := db.ListAudits(nil, WithAuditRealmID(realm.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, a := range audits {
+		if a.Action == "disabled inactive API key" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected audit entry for disabled key")
+	}
+}
+
 func TestDatabase_GenerateAPIKey(t *testing.T) {
 	t.Parallel()
 
@@ -126,3 +341,44 @@ func TestDatabase_GenerateVerifyAPIKeySignature(t *testing.T) {
 		t.Errorf("expected %v to be %v", got, want)
 	}
 }
+
+func TestAuthorizedApp_EffectiveAcceptTypes(t *testing.T) {
+	t.Parallel()
+
+	requested := api.AcceptTypes{}
+	requested.AddAcceptTypes(api.TestTypeConfirmed, api.TestTypeLikely, api.TestTypeNegative)
+
+	app := &AuthorizedApp{
+		Name:       "app",
+		APIKeyType: APIKeyTypeDevice,
+	}
+	if diff := cmp.Diff(requested, app.EffectiveAcceptTypes(requested)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	app.AcceptTestTypes = TestTypeConfirmed | TestTypeNegative
+	if err := app.BeforeSave(nil); err != nil {
+		t.Fatalf("expected no errors, got %v", app.ErrorMessages())
+	}
+	want := api.AcceptTypes{}
+	want.AddAcceptTypes(api.TestTypeConfirmed, api.TestTypeNegative)
+	if diff := cmp.Diff(want, app.EffectiveAcceptTypes(requested)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	onlyConfirmed := api.AcceptTypes{}
+	onlyConfirmed.AddAcceptTypes(api.TestTypeConfirmed)
+	app.AcceptTestTypes = TestTypeNegative
+	if got := app.EffectiveAcceptTypes(onlyConfirmed); len(got) != 0 {
+		t.Errorf("expected no accepted types, got %v", got)
+	}
+
+	admin := &AuthorizedApp{
+		Name:            "admin",
+		APIKeyType:      APIKeyTypeAdmin,
+		AcceptTestTypes: TestTypeConfirmed,
+	}
+	if err := admin.BeforeSave(nil); err == nil {
+		t.Errorf("expected accepted test types to be invalid on admin keys")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuthorizedApps is a list of authorized apps which can be exported as CSV.
+type AuthorizedApps []*AuthorizedApp
+
+// MarshalCSV returns bytes in CSV format. API keys are never included, only
+// their non-secret preview.
+func (a AuthorizedApps) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(a) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"id", "name", "type", "key_preview", "created_at", "last_used_at", "disabled_at", "inactivity_exempt"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, app := range a {
+		var lastUsedAt, disabledAt string
+		if app.LastUsedAt != nil {
+			lastUsedAt = app.LastUsedAt.UTC().Format(time.RFC3339)
+		}
+		if app.DeletedAt != nil {
+			disabledAt = app.DeletedAt.UTC().Format(time.RFC3339)
+		}
+
+		if err := w.Write([]string{
+			strconv.FormatUint(uint64(app.ID), 10),
+			app.Name,
+			app.APIKeyType.Display(),
+			app.APIKeyPreview,
+			app.CreatedAt.UTC().Format(time.RFC3339),
+			lastUsedAt,
+			disabledAt,
+			strconv.FormatBool(app.InactivityExempt),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
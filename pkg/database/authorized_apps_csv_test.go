@@ -0,0 +1,60 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+func TestAuthorizedApps_MarshalCSV(t *testing.T) {
+	t.Parallel()
+
+	if b, err := AuthorizedApps(nil).MarshalCSV(); err != nil || b != nil {
+		t.Errorf("expected no output for no apps, got %q, %v", b, err)
+	}
+
+	createdAt := time.Date(2020, 11, 1, 10, 0, 0, 0, time.UTC)
+	lastUsedAt := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+	apps := AuthorizedApps{
+		{
+			Model:         gorm.Model{ID: 1, CreatedAt: createdAt},
+			Name:          "Clinic, North",
+			APIKeyType:    APIKeyTypeAdmin,
+			APIKeyPreview: "abcdef",
+			APIKey:        "secret-hmac",
+			LastUsedAt:    &lastUsedAt,
+		},
+		{
+			Model:      gorm.Model{ID: 2, CreatedAt: createdAt, DeletedAt: &lastUsedAt},
+			Name:       "App",
+			APIKeyType: APIKeyTypeDevice,
+		},
+	}
+
+	b, err := apps.MarshalCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := "id,name,type,key_preview,created_at,last_used_at,disabled_at,inactivity_exempt\n" +
+		"1,\"Clinic, North\",admin,abcdef,2020-11-01T10:00:00Z,2020-11-02T10:00:00Z,,false\n" +
+		"2,App,device,,2020-11-01T10:00:00Z,,2020-11-02T10:00:00Z,false\n"
+	if got := string(b); got != exp {
+		t.Errorf("expected\n%s\nto be\n%s", got, exp)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// claimLinkPrefix identifies a signed claim link token, as opposed to a short
+// or long code. Codes never contain a period.
+const claimLinkPrefix = "cl1."
+
+// ErrClaimLinksDisabled is returned when signing a claim link and no claim
+// link key is configured.
+var ErrClaimLinksDisabled = errors.New("claim links are not enabled")
+
+// IsClaimLinkToken returns true if the value is a signed claim link token
+// rather than a verification code.
+func IsClaimLinkToken(s string) bool {
+	return strings.HasPrefix(s, claimLinkPrefix)
+}
+
+// ClaimLinksEnabled returns true if a claim link key is configured.
+func (db *Database) ClaimLinksEnabled() bool {
+	return len(db.config.ClaimLinkHMAC) > 0
+}
+
+// SignClaimLink returns a token which can be claimed in place of the code
+// until it expires. The token embeds the realm, expiry, and code, and is
+// signed with the first claim link key. Since the code can only be claimed
+// once, so can the token.
+func (db *Database) SignClaimLink(realmID uint, code string, expiresAt time.Time) (string, error) {
+	if !db.ClaimLinksEnabled() {
+		return "", ErrClaimLinksDisabled
+	}
+
+	payload := fmt.Sprintf("%d:%d:%s", realmID, expiresAt.UTC().Unix(), code)
+	sig := claimLinkSignature(db.config.ClaimLinkHMAC[0], payload)
+
+	return claimLinkPrefix +
+		base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// verifyClaimLink checks the token's signature against each claim link key
+// and returns the code it embeds. It returns ErrVerificationCodeNotFound if
+// the token is malformed, has an invalid signature, or is for another realm,
+// and ErrVerificationCodeExpired if it has expired.
+func (db *Database) verifyClaimLink(token string, realmID uint, now time.Time) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(token, claimLinkPrefix), ".")
+	if len(parts) != 2 {
+		return "", ErrVerificationCodeNotFound
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", ErrVerificationCodeNotFound
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrVerificationCodeNotFound
+	}
+	payload := string(payloadBytes)
+
+	valid := false
+	for _, key := range db.config.ClaimLinkHMAC {
+		if hmac.Equal(sig, claimLinkSignature(key, payload)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", ErrVerificationCodeNotFound
+	}
+
+	fields := strings.SplitN(payload, ":", 3)
+	if len(fields) != 3 {
+		return "", ErrVerificationCodeNotFound
+	}
+
+	tokenRealmID, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil || uint(tokenRealmID) != realmID {
+		return "", ErrVerificationCodeNotFound
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", ErrVerificationCodeNotFound
+	}
+	if !now.Before(time.Unix(expiresAt, 0)) {
+		return "", ErrVerificationCodeExpired
+	}
+
+	return fields[2], nil
+}
+
+// claimLinkSignature is the HMAC of the payload with the key.
+func claimLinkSignature(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+func TestDatabase_ClaimLink(t *testing.T) {
+	t.Parallel()
+
+	oldKey := envconfig.Base64Bytes("old-claim-link-key")
+	newKey := envconfig.Base64Bytes("new-claim-link-key")
+
+	db := &Database{config: &Config{ClaimLinkHMAC: []envconfig.Base64Bytes{newKey, oldKey}}}
+	oldDB := &Database{config: &Config{ClaimLinkHMAC: []envconfig.Base64Bytes{oldKey}}}
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	token, err := db.SignClaimLink(7, "12345678abcdefgh", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsClaimLinkToken(token) {
+		t.Errorf("expected %q to be a claim link token", token)
+	}
+	if strings.Contains(token, "12345678abcdefgh") {
+		t.Errorf("expected token not to contain the raw code")
+	}
+
+	code, err := db.verifyClaimLink(token, 7, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := code, "12345678abcdefgh"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Tokens signed with a previous key are still accepted.
+	oldToken, err := oldDB.SignClaimLink(7, "12345678", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.verifyClaimLink(oldToken, 7, now); err != nil {
+		t.Errorf("expected token signed with old key to be valid: %v", err)
+	}
+
+	// But not the other way around.
+	if _, err := oldDB.verifyClaimLink(token, 7, now); !errors.Is(err, ErrVerificationCodeNotFound) {
+		t.Errorf("expected %v to be %v", err, ErrVerificationCodeNotFound)
+	}
+
+	// Other realms cannot claim the token.
+	if _, err := db.verifyClaimLink(token, 8, now); !errors.Is(err, ErrVerificationCodeNotFound) {
+		t.Errorf("expected %v to be %v", err, ErrVerificationCodeNotFound)
+	}
+
+	// Expired tokens are rejected.
+	if _, err := db.verifyClaimLink(token, 7, expires.Add(time.Second)); !errors.Is(err, ErrVerificationCodeExpired) {
+		t.Errorf("expected %v to be %v", err, ErrVerificationCodeExpired)
+	}
+
+	// Tampering invalidates the signature.
+	parts := strings.Split(token, ".")
+	forged, err := db.SignClaimLink(7, "87654321", expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Join([]string{parts[0], strings.Split(forged, ".")[1], parts[2]}, ".")
+	if _, err := db.verifyClaimLink(tampered, 7, now); !errors.Is(err, ErrVerificationCodeNotFound) {
+		t.Errorf("expected %v to be %v", err, ErrVerificationCodeNotFound)
+	}
+
+	for _, bad := range []string{"cl1.", "cl1.abc", "cl1.!!!.???", "cl1.a.b.c"} {
+		if _, err := db.verifyClaimLink(bad, 7, now); !errors.Is(err, ErrVerificationCodeNotFound) {
+			t.Errorf("%q: expected %v to be %v", bad, err, ErrVerificationCodeNotFound)
+		}
+	}
+
+	// Claim links are disabled without a key.
+	disabled := &Database{config: &Config{}}
+	if _, err := disabled.SignClaimLink(7, "12345678", expires); !errors.Is(err, ErrClaimLinksDisabled) {
+		t.Errorf("expected %v to be %v", err, ErrClaimLinksDisabled)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ClaimResponseFields are the fields of a successful verify (claim) response
+// which a realm's claim response mapping can rename or omit. Error responses
+// are never changed.
+var ClaimResponseFields = []string{"padding", "testtype", "symptomDate", "testDate", "token", "redirectURL"}
+
+// claimResponseFieldRe is the allowed format of a renamed field.
+var claimResponseFieldRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// reservedClaimResponseFields cannot be used as renamed fields because clients
+// use them to detect errors.
+var reservedClaimResponseFields = map[string]struct{}{
+	"error":     {},
+	"errorCode": {},
+}
+
+// ParseClaimResponseMapping parses and validates a claim response mapping. The
+// mapping is a JSON object whose keys are names from ClaimResponseFields and
+// whose values are the names to use in the response instead. An empty value
+// omits the field. Fields which are not in the mapping keep their name. The
+// token cannot be omitted.
+//
+// An empty string is the default response shape and returns a nil map.
+func ParseClaimResponseMapping(s string) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of field names: %w", err)
+	}
+
+	known := make(map[string]struct{}, len(ClaimResponseFields))
+	for _, f := range ClaimResponseFields {
+		known[f] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m[k]
+		if _, ok := known[k]; !ok {
+			return nil, fmt.Errorf("unknown field %q, must be one of %s", k, strings.Join(ClaimResponseFields, ", "))
+		}
+		if v == "" {
+			if k == "token" {
+				return nil, fmt.Errorf("token cannot be omitted")
+			}
+			continue
+		}
+		if !claimResponseFieldRe.MatchString(v) {
+			return nil, fmt.Errorf("invalid name %q for %s, must be letters, numbers, and underscores", v, k)
+		}
+		if _, ok := reservedClaimResponseFields[v]; ok {
+			return nil, fmt.Errorf("name %q for %s is reserved", v, k)
+		}
+	}
+
+	// Every field must end up with a distinct name.
+	seen := make(map[string]string, len(ClaimResponseFields))
+	for _, f := range ClaimResponseFields {
+		name, ok := m[f]
+		if !ok {
+			name = f
+		}
+		if name == "" {
+			continue
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("%s and %s cannot both be named %q", other, f, name)
+		}
+		seen[name] = f
+	}
+
+	return m, nil
+}
+
+// ClaimResponseFieldMapping returns the realm's parsed claim response mapping,
+// or nil if the realm uses the default response shape.
+func (r *Realm) ClaimResponseFieldMapping() (map[string]string, error) {
+	return ParseClaimResponseMapping(r.ClaimResponseMapping)
+}
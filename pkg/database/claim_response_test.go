@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseClaimResponseMapping(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		input  string
+		exp    map[string]string
+		experr bool
+	}{
+		{name: "empty", input: "", exp: nil},
+		{name: "whitespace", input: "  ", exp: nil},
+		{
+			name:  "rename_and_omit",
+			input: `{"token": "verificationToken", "testtype": "testType", "padding": ""}`,
+			exp:   map[string]string{"token": "verificationToken", "testtype": "testType", "padding": ""},
+		},
+		{name: "not_json", input: `token=foo`, experr: true},
+		{name: "unknown_field", input: `{"foo": "bar"}`, experr: true},
+		{name: "omit_token", input: `{"token": ""}`, experr: true},
+		{name: "invalid_name", input: `{"token": "my-token"}`, experr: true},
+		{name: "reserved_name", input: `{"testDate": "error"}`, experr: true},
+		{name: "collides_with_unmapped", input: `{"testDate": "symptomDate"}`, experr: true},
+		{name: "collides_with_mapped", input: `{"testDate": "date", "symptomDate": "date"}`, experr: true},
+		{name: "swap", input: `{"testDate": "symptomDate", "symptomDate": "testDate"}`,
+			exp: map[string]string{"testDate": "symptomDate", "symptomDate": "testDate"}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseClaimResponseMapping(tc.input)
+			if (err != nil) != tc.experr {
+				t.Fatalf("expected error to be %t, got %v", tc.experr, err)
+			}
+			if diff := cmp.Diff(tc.exp, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
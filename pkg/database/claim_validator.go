@@ -0,0 +1,163 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// claimValidatorTimeout is the maximum amount of time all claim validators for
+// a claim may take. Validators run while the code is locked, so they must be
+// fast.
+const claimValidatorTimeout = 500 * time.Millisecond
+
+// ClaimInfo is the information about a claim which is given to claim
+// validators. It is a copy, so changes do not affect the claim.
+type ClaimInfo struct {
+	RealmID     uint
+	TestType    string
+	SymptomDate *time.Time
+	TestDate    *time.Time
+	IssuedAt    time.Time
+	ExternalID  string
+	CohortID    string
+	Metadata    map[string]string
+
+	// AppID is the identifier of the app claiming the code, if it sent one.
+	AppID string
+
+	// DeviceBound is true if the claim includes a device fingerprint.
+	DeviceBound bool
+
+	// Now is the time of the claim.
+	Now time.Time
+}
+
+// ClaimValidator decides if a code may be claimed. It rejects the claim by
+// returning a *ClaimRejectedError, usually built with RejectClaim. Any other
+// error fails the claim as an internal error.
+//
+// Validators must not block. The context is cancelled after a short timeout,
+// and a validator which does not return in time fails the claim.
+type ClaimValidator func(ctx context.Context, info *ClaimInfo) error
+
+// ClaimRejectedError is returned when a claim validator rejects a claim. The
+// reason is returned to the client.
+type ClaimRejectedError struct {
+	Reason string
+}
+
+// Error implements error.
+func (e *ClaimRejectedError) Error() string {
+	return fmt.Sprintf("claim rejected: %s", e.Reason)
+}
+
+// RejectClaim returns an error which rejects a claim with the given reason.
+func RejectClaim(reason string) error {
+	return &ClaimRejectedError{Reason: reason}
+}
+
+var (
+	claimValidatorsLock sync.RWMutex
+	claimValidators     = make(map[uint][]ClaimValidator)
+)
+
+// RegisterClaimValidator registers a validator which is run before a code in
+// the realm is claimed. A realm ID of 0 runs the validator for every realm.
+// Validators are run in the order they are registered, after the built-in
+// checks pass. This is usually called from an init function in a package that
+// the server imports.
+func RegisterClaimValidator(realmID uint, v ClaimValidator) {
+	claimValidatorsLock.Lock()
+	defer claimValidatorsLock.Unlock()
+
+	claimValidators[realmID] = append(claimValidators[realmID], v)
+}
+
+// claimValidatorsFor returns the validators which apply to the realm.
+func claimValidatorsFor(realmID uint) []ClaimValidator {
+	claimValidatorsLock.RLock()
+	defer claimValidatorsLock.RUnlock()
+
+	all, realm := claimValidators[0], claimValidators[realmID]
+	if realmID == 0 {
+		realm = nil
+	}
+
+	validators := make([]ClaimValidator, 0, len(all)+len(realm))
+	validators = append(validators, all...)
+	validators = append(validators, realm...)
+	return validators
+}
+
+// runClaimValidators runs the validators in order and returns the first error.
+// Each validator gets its own copy of the claim information. Panics are
+// returned as errors, and validators which exceed the timeout fail the claim.
+func runClaimValidators(ctx context.Context, validators []ClaimValidator, info *ClaimInfo, timeout time.Duration) error {
+	if len(validators) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for i, v := range validators {
+		// Copy the claim information so validators cannot change it, or what
+		// later validators see.
+		infoCopy := *info
+		infoCopy.SymptomDate = copyTime(info.SymptomDate)
+		infoCopy.TestDate = copyTime(info.TestDate)
+		infoCopy.Metadata = make(map[string]string, len(info.Metadata))
+		for k, val := range info.Metadata {
+			infoCopy.Metadata[k] = val
+		}
+
+		errCh := make(chan error, 1)
+		go func(v ClaimValidator) {
+			defer func() {
+				if r := recover(); r != nil {
+					errCh <- fmt.Errorf("claim validator panicked: %v", r)
+				}
+			}()
+			errCh <- v(ctx, &infoCopy)
+		}(v)
+
+		select {
+		case err := <-errCh:
+			if err != nil {
+				var rerr *ClaimRejectedError
+				if errors.As(err, &rerr) {
+					return err
+				}
+				return fmt.Errorf("claim validator %d failed: %w", i, err)
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("claim validator %d did not return in time: %w", i, ctx.Err())
+		}
+	}
+	return nil
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
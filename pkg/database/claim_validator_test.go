@@ -0,0 +1,143 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunClaimValidators(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	symptomDate := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	info := &ClaimInfo{
+		RealmID:     1,
+		TestType:    "confirmed",
+		SymptomDate: &symptomDate,
+		Metadata:    map[string]string{"site": "a"},
+	}
+
+	allow := func(ctx context.Context, info *ClaimInfo) error { return nil }
+	reject := func(ctx context.Context, info *ClaimInfo) error { return RejectClaim("not today") }
+
+	cases := []struct {
+		name       string
+		validators []ClaimValidator
+		rejected   string
+		err        string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:       "allow",
+			validators: []ClaimValidator{allow, allow},
+		},
+		{
+			name:       "reject",
+			validators: []ClaimValidator{allow, reject},
+			rejected:   "not today",
+		},
+		{
+			name: "error",
+			validators: []ClaimValidator{func(ctx context.Context, info *ClaimInfo) error {
+				return errors.New("backend down")
+			}},
+			err: "backend down",
+		},
+		{
+			name: "panic",
+			validators: []ClaimValidator{func(ctx context.Context, info *ClaimInfo) error {
+				panic("oops")
+			}},
+			err: "panicked",
+		},
+		{
+			name: "timeout",
+			validators: []ClaimValidator{func(ctx context.Context, info *ClaimInfo) error {
+				time.Sleep(time.Second)
+				return nil
+			}},
+			err: "did not return in time",
+		},
+		{
+			name: "mutation",
+			validators: []ClaimValidator{
+				func(ctx context.Context, info *ClaimInfo) error {
+					info.TestType = "negative"
+					info.Metadata["site"] = "b"
+					*info.SymptomDate = time.Time{}
+					return nil
+				},
+				func(ctx context.Context, info *ClaimInfo) error {
+					if info.TestType != "confirmed" || info.Metadata["site"] != "a" || !info.SymptomDate.Equal(symptomDate) {
+						return RejectClaim("saw mutation")
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := runClaimValidators(ctx, tc.validators, info, 50*time.Millisecond)
+
+			var rerr *ClaimRejectedError
+			switch {
+			case tc.rejected != "":
+				if !errors.As(err, &rerr) {
+					t.Fatalf("expected rejection, got %v", err)
+				}
+				if got, want := rerr.Reason, tc.rejected; got != want {
+					t.Errorf("expected %q to be %q", got, want)
+				}
+			case tc.err != "":
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				if errors.As(err, &rerr) {
+					t.Errorf("expected error not to be a rejection")
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestClaimValidatorsFor(t *testing.T) {
+	t.Parallel()
+
+	// Use realm IDs which no other test uses, since the registry is global.
+	RegisterClaimValidator(91001, func(ctx context.Context, info *ClaimInfo) error { return nil })
+	RegisterClaimValidator(91001, func(ctx context.Context, info *ClaimInfo) error { return nil })
+
+	if got, want := len(claimValidatorsFor(91001)), 2+len(claimValidatorsFor(0)); got != want {
+		t.Errorf("expected %d validators to be %d", got, want)
+	}
+	if got, want := len(claimValidatorsFor(91002)), len(claimValidatorsFor(0)); got != want {
+		t.Errorf("expected %d validators to be %d", got, want)
+	}
+}
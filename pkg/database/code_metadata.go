@@ -0,0 +1,188 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	// MaxCodeMetadataKeys is the maximum number of entries in a code's
+	// metadata. The server and realms may configure a lower limit.
+	MaxCodeMetadataKeys = 100
+
+	// MaxCodeMetadataValueLength is the maximum length of a metadata value.
+	MaxCodeMetadataValueLength = 128
+
+	// MaxCodeMetadataSize is the maximum size in bytes of the JSON encoded
+	// metadata. The server and realms may configure a lower limit.
+	MaxCodeMetadataSize = 16384
+
+	// MaxDeepLinkMetadataKeys is the maximum number of metadata keys a realm
+	// can embed in deep links.
+	MaxDeepLinkMetadataKeys = 10
+
+	// MaxDeepLinkMetadataSize is the maximum size in bytes of the JSON encoded
+	// metadata embedded in a deep link, which keeps links short enough for
+	// text messages and QR codes.
+	MaxDeepLinkMetadataSize = 512
+)
+
+var (
+	// codeMetadataKeyRegexp is the format of a metadata key. It starts with a
+	// letter and is up to 32 characters.
+	codeMetadataKeyRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]{0,31}$`)
+
+	// Metadata must not contain PII. These catch the common mistakes of sending
+	// an email address, a phone number, or a US social security number. They
+	// are not exhaustive.
+	metadataEmailRegexp = regexp.MustCompile(`[^\s@]+@[^\s@]+\.[^\s@]+`)
+	metadataPhoneRegexp = regexp.MustCompile(`(?:\+?\d[\s().-]*){10,}`)
+	metadataSSNRegexp   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+
+	// deepLinkPIIKeyRegexp matches metadata keys which likely hold PII. Deep
+	// links are sent to patients and may be shared, so realms cannot embed
+	// these keys even though the values are checked at issuance.
+	deepLinkPIIKeyRegexp = regexp.MustCompile(`(?i)(name|email|phone|mobile|address|birth|dob|ssn)`)
+)
+
+// CodeMetadata is a small set of non-PII key-value tags attached to a
+// verification code by the issuer, such as a clinic ID or test kit lot. It is
+// stored as a JSON object and is not indexed.
+type CodeMetadata map[string]string
+
+// ValidCodeMetadataKey returns true if the given string is a valid metadata
+// key.
+func ValidCodeMetadataKey(s string) bool {
+	return codeMetadataKeyRegexp.MatchString(s)
+}
+
+// Validate returns a list of problems with the metadata, or nil if it is
+// valid.
+func (m CodeMetadata) Validate() []string {
+	return m.ValidateWithLimits(MaxCodeMetadataKeys, MaxCodeMetadataSize)
+}
+
+// ValidateWithLimits is like Validate, but with the given limits on the number
+// of keys and the encoded size.
+func (m CodeMetadata) ValidateWithLimits(maxKeys, maxSize uint) []string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	var problems []string
+	if uint(len(m)) > maxKeys {
+		problems = append(problems, fmt.Sprintf("cannot have more than %d keys", maxKeys))
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !ValidCodeMetadataKey(k) {
+			problems = append(problems, fmt.Sprintf("key %q must start with a letter and be 1-32 letters, digits, dots, underscores, or dashes", k))
+			continue
+		}
+
+		v := m[k]
+		if utf8.RuneCountInString(v) > MaxCodeMetadataValueLength {
+			problems = append(problems, fmt.Sprintf("value of %q cannot exceed %d characters", k, MaxCodeMetadataValueLength))
+		}
+		if containsPII(v) {
+			problems = append(problems, fmt.Sprintf("value of %q appears to contain PII", k))
+		}
+	}
+
+	if len(problems) == 0 {
+		b, err := json.Marshal(m)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("failed to encode: %s", err))
+		} else if uint(len(b)) > maxSize {
+			problems = append(problems, fmt.Sprintf("cannot exceed %d bytes", maxSize))
+		}
+	}
+	return problems
+}
+
+// Select returns the entries of the metadata with the given keys, or nil if
+// there are none.
+func (m CodeMetadata) Select(keys []string) CodeMetadata {
+	var result CodeMetadata
+	for _, k := range keys {
+		v, ok := m[k]
+		if !ok {
+			continue
+		}
+		if result == nil {
+			result = make(CodeMetadata, len(keys))
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// containsPII returns true if the value looks like it contains an email
+// address, phone number, or social security number.
+func containsPII(s string) bool {
+	return metadataEmailRegexp.MatchString(s) ||
+		metadataPhoneRegexp.MatchString(s) ||
+		metadataSSNRegexp.MatchString(s)
+}
+
+// Scan reads the metadata from a JSON column.
+func (m *CodeMetadata) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("invalid scan type %T", src)
+	}
+
+	var result CodeMetadata
+	if err := json.Unmarshal(b, &result); err != nil {
+		return fmt.Errorf("failed to parse code metadata: %w", err)
+	}
+	if len(result) == 0 {
+		result = nil
+	}
+	*m = result
+	return nil
+}
+
+// Value writes the metadata as a JSON object.
+func (m CodeMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal code metadata: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+)
+
+var _ icsv.Marshaler = (CohortStats)(nil)
+
+// CohortStats is a collection of cohort stats.
+type CohortStats []*CohortStat
+
+// CohortStat is the number of codes issued and claimed for a cohort over a date
+// range. It is aggregated from the daily cohort_stats table.
+type CohortStat struct {
+	RealmID      uint      `gorm:"column:realm_id;" json:"-"`
+	CohortID     string    `gorm:"column:cohort_id;" json:"cohort_id"`
+	CodesIssued  uint      `gorm:"column:codes_issued;" json:"codes_issued"`
+	CodesClaimed uint      `gorm:"column:codes_claimed;" json:"codes_claimed"`
+	FirstDate    time.Time `gorm:"column:first_date;" json:"first_date"`
+	LastDate     time.Time `gorm:"column:last_date;" json:"last_date"`
+}
+
+// MarshalCSV returns bytes in CSV format.
+func (s CohortStats) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"realm_id", "cohort_id", "codes_issued", "codes_claimed", "first_date", "last_date"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, stat := range s {
+		if err := w.Write([]string{
+			strconv.FormatUint(uint64(stat.RealmID), 10),
+			stat.CohortID,
+			strconv.FormatUint(uint64(stat.CodesIssued), 10),
+			strconv.FormatUint(uint64(stat.CodesClaimed), 10),
+			stat.FirstDate.Format("2006-01-02"),
+			stat.LastDate.Format("2006-01-02"),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+type jsonCohortStats struct {
+	RealmID uint          `json:"realm_id"`
+	Stats   []*CohortStat `json:"statistics"`
+}
+
+// MarshalJSON is a custom JSON marshaller.
+func (s CohortStats) MarshalJSON() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return json.Marshal(struct{}{})
+	}
+
+	b, err := json.Marshal(&jsonCohortStats{
+		RealmID: s[0].RealmID,
+		Stats:   s,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+	return b, nil
+}
+
+func (s *CohortStats) UnmarshalJSON(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var result jsonCohortStats
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+
+	for _, stat := range result.Stats {
+		stat.RealmID = result.RealmID
+		*s = append(*s, stat)
+	}
+	return nil
+}
+
+// CountCodesByCohort returns the number of codes issued and claimed for each
+// cohort in the realm between the given dates, most recently active first.
+// Counts are kept in daily stats, so they remain after codes are purged.
+func (db *Database) CountCodesByCohort(realmID uint, start, stop time.Time) (CohortStats, error) {
+	start = timeutils.UTCMidnight(start)
+	stop = timeutils.UTCMidnight(stop)
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+
+	sql := `
+		SELECT
+			realm_id,
+			cohort_id,
+			SUM(codes_issued) AS codes_issued,
+			SUM(codes_claimed) AS codes_claimed,
+			MIN(date) AS first_date,
+			MAX(date) AS last_date
+		FROM cohort_stats
+		WHERE realm_id = $1 AND date >= $2 AND date <= $3
+		GROUP BY realm_id, cohort_id
+		ORDER BY last_date DESC, cohort_id`
+
+	var stats CohortStats
+	if err := db.db.Raw(sql, realmID, start, stop).Scan(&stats).Error; err != nil {
+		if IsNotFound(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
@@ -21,9 +21,32 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/secrets"
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
 	"github.com/sethvargo/go-envconfig"
 )
 
+// MigrationMode controls what happens to pending migrations when the database
+// is opened.
+type MigrationMode string
+
+const (
+	// MigrationModeNone neither checks nor applies migrations. Migrations are
+	// run separately with the migrate command.
+	MigrationModeNone MigrationMode = "NONE"
+
+	// MigrationModeVerify refuses to open the database if any migrations are
+	// pending. Use this in environments which migrate separately to prevent
+	// serving on an outdated schema.
+	MigrationModeVerify MigrationMode = "VERIFY"
+
+	// MigrationModeAuto applies any pending migrations when the database is
+	// opened. This is convenient for local development, but it should not be
+	// used when multiple instances start at the same time.
+	MigrationModeAuto MigrationMode = "AUTO"
+)
+
 // Config represents the env var based configuration for database connections.
 type Config struct {
 	Name              string `env:"DB_NAME" json:",omitempty"`
@@ -43,6 +66,16 @@ type Config struct {
 	MaxConnectionLifetime time.Duration `env:"DB_MAX_CONN_LIFETIME, default=5m" json:",omitempty"`
 	MaxConnectionIdleTime time.Duration `env:"DB_MAX_CONN_IDLE_TIME, default=1m" json:",omitempty"`
 
+	// QueryTimeout is the maximum amount of time a request may spend in a
+	// single transaction on the latency sensitive paths (issuing and verifying
+	// codes and claiming tokens). Timed out transactions are rolled back. Set to
+	// 0 to disable.
+	QueryTimeout time.Duration `env:"DB_QUERY_TIMEOUT, default=10s" json:",omitempty"`
+
+	// Migrations controls whether pending migrations are applied, verified, or
+	// ignored when the database is opened.
+	Migrations MigrationMode `env:"DB_MIGRATIONS, default=NONE" json:",omitempty"`
+
 	// Debug is a boolean that indicates whether the database should log SQL
 	// commands.
 	Debug bool `env:"DB_DEBUG,default=false"`
@@ -60,11 +93,29 @@ type Config struct {
 	// the upstream KMS.
 	MaxCertificateSigningKeyVersions int64 `env:"MAX_CERTIFICATE_SIGNING_KEY_VERSIONS, default=5"`
 
+	// MaxRealmsPerUser is the maximum number of realms a user can be a member
+	// of. System admins are exempt. The default of 0 is unlimited. This is
+	// enforced at the database layer.
+	MaxRealmsPerUser uint `env:"MAX_REALMS_PER_USER, default=0"`
+
+	// EnforceUniqueRegionCodes requires each realm to have a different region
+	// code. Deployments which serve one region with several realms can disable
+	// it, in which case lookups by region code return the oldest realm. The
+	// unique index is only relaxed if it is disabled when the database is
+	// migrated.
+	EnforceUniqueRegionCodes bool `env:"ENFORCE_UNIQUE_REGION_CODES, default=true"`
+
 	// EncryptionKey is the reference to an encryption/decryption key to use when
 	// for application-layer encryption before values are persisted to the
 	// database.
 	EncryptionKey string `env:"DB_ENCRYPTION_KEY,required" json:"-"`
 
+	// EncryptionKeyPrevious is the list of keys which were previously used as the
+	// EncryptionKey. They are only used to decrypt values, which allows rotating
+	// the EncryptionKey. Once RotateEncryptionKeys has re-encrypted all values
+	// with the current key, previous keys can be removed.
+	EncryptionKeyPrevious []string `env:"DB_ENCRYPTION_KEY_PREVIOUS" json:"-"`
+
 	// APIKeyDatabaseHMAC is the HMAC key to use for API keys before storing them
 	// in the database.
 	APIKeyDatabaseHMAC []envconfig.Base64Bytes `env:"DB_APIKEY_DATABASE_KEY,required" json:"-"`
@@ -73,10 +124,32 @@ type Config struct {
 	// to the requestor.
 	APIKeySignatureHMAC []envconfig.Base64Bytes `env:"DB_APIKEY_SIGNATURE_KEY,required" json:"-"`
 
+	// APIKeyRequireSigned rejects legacy API keys, which are not signed or bound
+	// to a realm. Keys created by this server are always signed, so this only
+	// affects keys created before signing was introduced.
+	APIKeyRequireSigned bool `env:"DB_APIKEY_REQUIRE_SIGNED, default=false"`
+
 	// VerificationCodeDatabaseHMAC is the HMAC key to hash codes before storing
 	// them in the database.
 	VerificationCodeDatabaseHMAC []envconfig.Base64Bytes `env:"DB_VERIFICATION_CODE_DATABASE_KEY,required" json:"-"`
 
+	// ClaimLinkHMAC is the list of HMAC keys to sign and verify claim links. The
+	// first key signs new links, and all keys are accepted when verifying, so
+	// keys can be rotated. If empty, claim links are disabled.
+	ClaimLinkHMAC []envconfig.Base64Bytes `env:"DB_CLAIM_LINK_KEY" json:"-"`
+
+	// AuditSink is the optional configuration for forwarding audit entries to
+	// an external system. Entries are always saved in the database.
+	AuditSink auditsink.Config
+
+	// EventSink is the optional configuration for emitting code issuance and
+	// claim events for analytics.
+	EventSink eventsink.Config
+
+	// Webhooks is the configuration for delivering code events to the
+	// endpoints configured by each realm.
+	Webhooks webhook.Config
+
 	// Secrets is the secret configuration. This is used to resolve values that
 	// are actually pointers to secrets before returning them to the caller. The
 	// table implementation is the source of truth for which values are secrets
@@ -18,7 +18,6 @@ package database
 import (
 	"context"
 	"database/sql"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -30,13 +29,15 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/exposure-notifications-server/pkg/base64util"
 	"github.com/google/exposure-notifications-server/pkg/keys"
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
 	"github.com/google/exposure-notifications-server/pkg/secrets"
+	"github.com/google/exposure-notifications-verification-server/pkg/auditsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
 	"github.com/jinzhu/gorm"
 	"github.com/sethvargo/go-retry"
 	"go.opencensus.io/stats"
@@ -72,6 +73,20 @@ type Database struct {
 	// secretManager is used to resolve secrets.
 	secretManager secrets.SecretManager
 
+	// auditSink receives a copy of each audit entry after it is saved.
+	auditSink auditsink.Sink
+
+	// eventSink receives issuance and claim events after they are committed.
+	eventSink eventsink.Sink
+
+	// webhooks delivers the code events queued for realm webhooks. It is nil if
+	// webhooks are disabled, and events are not queued.
+	webhooks *webhook.Dispatcher
+
+	// cacher is the cacher passed to OpenWithCacher. It is nil if the database
+	// was opened without one.
+	cacher cache.Cacher
+
 	statsCloser func()
 }
 
@@ -124,13 +139,29 @@ func (c *Config) Load(ctx context.Context) (*Database, error) {
 		logger.Errorf("key manager does not support the SigningKeyManager interface, falling back to single verification signing key")
 	}
 
-	return &Database{
+	// Create the audit sink.
+	auditSink, err := auditsink.SinkFor(ctx, &c.AuditSink)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit sink: %w", err)
+	}
+
+	// Create the event sink.
+	eventSink, err := eventsink.SinkFor(ctx, &c.EventSink)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event sink: %w", err)
+	}
+
+	db := &Database{
 		config:            c,
 		keyManager:        keyManager,
 		signingKeyManager: signingKeyManager,
 		logger:            logger,
 		secretManager:     secretManager,
-	}, nil
+		auditSink:         auditSink,
+		eventSink:         eventSink,
+	}
+
+	return db, nil
 }
 
 // Open creates a database connection. This should only be called once.
@@ -139,8 +170,73 @@ func (db *Database) Open(ctx context.Context) error {
 }
 
 // OpenWithCacher creates a database connection with the cacher. This should
-// only be called once.
+// only be called once. Depending on the configured MigrationMode, pending
+// migrations are applied or cause an error. If webhooks are enabled, the
+// webhook dispatcher is started.
 func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) error {
+	if err := db.open(ctx, cacher); err != nil {
+		return err
+	}
+
+	if err := db.handleMigrations(ctx); err != nil {
+		return err
+	}
+
+	// Start the webhook dispatcher. It claims deliveries from this database, so
+	// it starts once the connection is established and migrated.
+	if db.config.Webhooks.Enabled {
+		webhooks, err := webhook.NewDispatcher(ctx, db, &db.config.Webhooks)
+		if err != nil {
+			return fmt.Errorf("failed to create webhook dispatcher: %w", err)
+		}
+		db.webhooks = webhooks
+	}
+	return nil
+}
+
+// handleMigrations applies or verifies pending migrations according to the
+// configured MigrationMode.
+func (db *Database) handleMigrations(ctx context.Context) error {
+	logger := logging.FromContext(ctx).Named("migrate")
+
+	mode := db.config.Migrations
+	switch mode {
+	case "", MigrationModeNone:
+		return nil
+	case MigrationModeVerify, MigrationModeAuto:
+	default:
+		return fmt.Errorf("unknown migration mode %q", mode)
+	}
+
+	pending, unknown, err := db.PendingMigrations(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+
+	// Migrations unknown to this server were applied by a newer version. That
+	// is expected while a rollout is in progress, so it is not an error.
+	if len(unknown) > 0 {
+		logger.Warnw("database has migrations unknown to this server", "migrations", unknown)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if mode == MigrationModeVerify {
+		return fmt.Errorf("database has %d pending migrations (%s), run the migrate command or set DB_MIGRATIONS=%s",
+			len(pending), strings.Join(pending, ", "), MigrationModeAuto)
+	}
+
+	if err := db.RunMigrations(ctx); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+	logger.Infow("applied migrations", "migrations", pending)
+	return nil
+}
+
+// open creates the database connection and registers callbacks.
+func (db *Database) open(ctx context.Context, cacher cache.Cacher) error {
 	c := db.config
 
 	// Establish a connection to the database. We use this later to register
@@ -202,23 +298,13 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 		defer rawDB.SetLogger(gorm.Logger{LogWriter: log.New(os.Stdout, "\r\n", 0)})
 	}
 
-	// SMS configs
-	rawDB.Callback().Create().Before("gorm:create").Register("sms_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "TwilioAuthToken"))
-	rawDB.Callback().Create().After("gorm:create").Register("sms_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "TwilioAuthToken"))
-
-	rawDB.Callback().Update().Before("gorm:update").Register("sms_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "TwilioAuthToken"))
-	rawDB.Callback().Update().After("gorm:update").Register("sms_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "TwilioAuthToken"))
-
-	rawDB.Callback().Query().After("gorm:after_query").Register("sms_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "sms_configs", "TwilioAuthToken"))
-
-	// Email configs
-	rawDB.Callback().Create().Before("gorm:create").Register("email_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
-	rawDB.Callback().Create().After("gorm:create").Register("email_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
-
-	rawDB.Callback().Update().Before("gorm:update").Register("email_configs:encrypt", callbackKMSEncrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
-	rawDB.Callback().Update().After("gorm:update").Register("email_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
-
-	rawDB.Callback().Query().After("gorm:after_query").Register("email_configs:decrypt", callbackKMSDecrypt(ctx, db.keyManager, c.EncryptionKey, "email_configs", "SMTPPassword"))
+	// Encrypted columns
+	columnKeys := &columnKeys{current: c.EncryptionKey, previous: c.EncryptionKeyPrevious}
+	registerEncryptedColumn(ctx, rawDB, db.keyManager, columnKeys, "sms_configs", "TwilioAuthToken")
+	registerEncryptedColumn(ctx, rawDB, db.keyManager, columnKeys, "email_configs", "SMTPPassword")
+	registerEncryptedColumn(ctx, rawDB, db.keyManager, columnKeys, "sms_retries", "Phone")
+	registerEncryptedColumn(ctx, rawDB, db.keyManager, columnKeys, "sms_retries", "Message")
+	registerEncryptedColumn(ctx, rawDB, db.keyManager, columnKeys, "webhooks", "Secret")
 
 	// Verification codes
 	rawDB.Callback().Create().Before("gorm:create").Register("verification_codes:hmac_code", callbackHMAC(ctx, db.GenerateVerificationCodeHMAC, "verification_codes", "code"))
@@ -227,6 +313,11 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 	// Metrics
 	rawDB.Callback().Create().After("gorm:create").Register("audit_entries:metrics", callbackIncrementMetric(ctx, mAuditEntryCreated, "audit_entries"))
 
+	// Audit forwarding
+	if db.auditSink != nil {
+		rawDB.Callback().Create().After("gorm:create").Register("audit_entries:forward", callbackForwardAuditEntry(db.auditSink))
+	}
+
 	// Cache clearing
 	if cacher != nil {
 		// Apps
@@ -244,15 +335,35 @@ func (db *Database) OpenWithCacher(ctx context.Context, cacher cache.Cacher) err
 		// Users (by email)
 		rawDB.Callback().Update().After("gorm:update").Register("purge_cache:users:by_email", callbackPurgeCache(ctx, cacher, "users:by_email", "users", "email"))
 		rawDB.Callback().Delete().After("gorm:delete").Register("purge_cache:users:by_email", callbackPurgeCache(ctx, cacher, "users:by_email", "users", "email"))
+
+		// User sessions
+		rawDB.Callback().Update().After("gorm:update").Register("purge_cache:user_sessions:by_session_id", callbackPurgeCache(ctx, cacher, "user_sessions:by_session_id", "user_sessions", "session_id"))
+		rawDB.Callback().Delete().After("gorm:delete").Register("purge_cache:user_sessions:by_session_id", callbackPurgeCache(ctx, cacher, "user_sessions:by_session_id", "user_sessions", "session_id"))
 	}
 
 	db.db = rawDB
+	db.cacher = cacher
 	return nil
 }
 
 // Close will close the database connection. Should be deferred right after Open.
 func (db *Database) Close() error {
 	db.statsCloser()
+	if db.auditSink != nil {
+		if err := db.auditSink.Close(); err != nil {
+			db.logger.Errorw("failed to close audit sink", "error", err)
+		}
+	}
+	if db.eventSink != nil {
+		if err := db.eventSink.Close(); err != nil {
+			db.logger.Errorw("failed to close event sink", "error", err)
+		}
+	}
+	if db.webhooks != nil {
+		if err := db.webhooks.Close(); err != nil {
+			db.logger.Errorw("failed to close webhook dispatcher", "error", err)
+		}
+	}
 	return db.db.Close()
 }
 
@@ -376,7 +487,7 @@ func callbackPurgeCache(ctx context.Context, cacher cache.Cacher, namespace, tab
 
 // callbackKMSDecrypt decrypts the given column in the table using the key
 // manager and key id.
-func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID, table, column string) func(scope *gorm.Scope) {
+func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, k *columnKeys, table, column string) func(scope *gorm.Scope) {
 	return func(scope *gorm.Scope) {
 		// Do nothing if not the target table
 		if scope.TableName() != table {
@@ -406,22 +517,15 @@ func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID,
 		if hasPlaintextCache && hasCiphertextCache && ciphertext == ciphertextCache {
 			if err := realField.Set(plaintextCache); err != nil {
 				_ = scope.Err(fmt.Errorf("failed to re-use plaintext: %w", err))
-				return
 			}
-		}
-
-		ciphertextBytes, err := base64util.DecodeString(ciphertext)
-		if err != nil {
-			_ = scope.Err(fmt.Errorf("cannot decrypt %s, invalid ciphertext", column))
 			return
 		}
 
-		plaintextBytes, err := keyManager.Decrypt(ctx, keyID, ciphertextBytes, nil)
+		plaintext, err := k.decrypt(ctx, keyManager, ciphertext)
 		if err != nil {
 			_ = scope.Err(fmt.Errorf("failed to decrypt %s: %w", column, err))
 			return
 		}
-		plaintext := string(plaintextBytes)
 
 		if hasRealField {
 			if err := realField.Set(plaintext); err != nil {
@@ -448,7 +552,7 @@ func callbackKMSDecrypt(ctx context.Context, keyManager keys.KeyManager, keyID,
 
 // callbackKMSEncrypt encrypts the given column in the table using the key
 // manager and key id before saving in the database.
-func callbackKMSEncrypt(ctx context.Context, keyManager keys.KeyManager, keyID, table, column string) func(scope *gorm.Scope) {
+func callbackKMSEncrypt(ctx context.Context, keyManager keys.KeyManager, k *columnKeys, table, column string) func(scope *gorm.Scope) {
 	return func(scope *gorm.Scope) {
 		// Do nothing if not the target table
 		if scope.TableName() != table {
@@ -474,20 +578,20 @@ func callbackKMSEncrypt(ctx context.Context, keyManager keys.KeyManager, keyID,
 		ciphertextCacheField, ciphertextCache, hasCiphertextCache := getFieldString(scope, column+"CiphertextCache")
 
 		// Optimization - if PlaintextCache and CiphertextCache columns exist and the
-		// plaintext is unchanged, do not re-encrypt.
-		if hasPlaintextCache && hasCiphertextCache && plaintext == plaintextCache {
+		// plaintext is unchanged, do not re-encrypt unless the ciphertext was
+		// encrypted with a previous key.
+		if hasPlaintextCache && hasCiphertextCache && plaintext == plaintextCache && k.isCurrent(ciphertextCache) {
 			if err := realField.Set(ciphertextCache); err != nil {
 				_ = scope.Err(fmt.Errorf("failed to re-use encrypted ciphertext: %w", err))
-				return
 			}
+			return
 		}
 
-		b, err := keyManager.Encrypt(ctx, keyID, []byte(plaintext), nil)
+		ciphertext, err := k.encrypt(ctx, keyManager, plaintext)
 		if err != nil {
 			_ = scope.Err(fmt.Errorf("failed to encrypt %s: %w", column, err))
 			return
 		}
-		ciphertext := base64.RawStdEncoding.EncodeToString(b)
 
 		if hasRealField {
 			if err := realField.Set(ciphertext); err != nil {
@@ -629,3 +733,27 @@ func float64Diff(old, new float64) string {
 func uintDiff(old, new uint) string {
 	return stringDiff(strconv.FormatUint(uint64(old), 10), strconv.FormatUint(uint64(new), 10))
 }
+
+func intDiff(old, new int) string {
+	return stringDiff(strconv.Itoa(old), strconv.Itoa(new))
+}
+
+// timePtrDiff builds a diff of the optional time values. Unset values are
+// shown as "none".
+func timePtrDiff(old, new *time.Time) string {
+	format := func(t *time.Time) string {
+		if t == nil {
+			return "none"
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return stringDiff(format(old), format(new))
+}
+
+// timePtrEqual returns true if both times are unset or are the same instant.
+func timePtrEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/google/exposure-notifications-server/pkg/base64util"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/jinzhu/gorm"
+)
+
+// encryptedValueSeparator separates the key version tag from the ciphertext in
+// encrypted columns. It never appears in base64.
+const encryptedValueSeparator = ":"
+
+// columnKeys are the keys used for application-layer encryption of columns.
+// Values are encrypted with the current key and prefixed with a tag derived
+// from the key's ID, like "k1a2b3c4d:<ciphertext>". Previous keys are only used
+// for decryption, which allows rotating to a new key without a migration.
+// Values written before tags existed have no prefix and are decrypted with the
+// current key first, then each previous key.
+type columnKeys struct {
+	current  string
+	previous []string
+}
+
+// keyTag returns the tag for the given key ID.
+func keyTag(keyID string) string {
+	sum := sha256.Sum256([]byte(keyID))
+	return "k" + hex.EncodeToString(sum[:4])
+}
+
+// isCurrent returns true if the ciphertext was encrypted with the current key.
+func (k *columnKeys) isCurrent(ciphertext string) bool {
+	return strings.HasPrefix(ciphertext, keyTag(k.current)+encryptedValueSeparator)
+}
+
+// encrypt encrypts the plaintext with the current key and returns the tagged
+// ciphertext.
+func (k *columnKeys) encrypt(ctx context.Context, keyManager keys.KeyManager, plaintext string) (string, error) {
+	b, err := keyManager.Encrypt(ctx, k.current, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return keyTag(k.current) + encryptedValueSeparator + base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// decrypt decrypts the tagged or legacy ciphertext.
+func (k *columnKeys) decrypt(ctx context.Context, keyManager keys.KeyManager, ciphertext string) (string, error) {
+	candidates := append([]string{k.current}, k.previous...)
+
+	if i := strings.Index(ciphertext, encryptedValueSeparator); i >= 0 {
+		tag := ciphertext[:i]
+		ciphertext = ciphertext[i+1:]
+
+		var keyID string
+		for _, candidate := range candidates {
+			if keyTag(candidate) == tag {
+				keyID = candidate
+				break
+			}
+		}
+		if keyID == "" {
+			return "", fmt.Errorf("no key matches version %q", tag)
+		}
+		candidates = []string{keyID}
+	}
+
+	b, err := base64util.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext")
+	}
+
+	var lastErr error
+	for _, keyID := range candidates {
+		plaintext, err := keyManager.Decrypt(ctx, keyID, b, nil)
+		if err == nil {
+			return string(plaintext), nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// registerEncryptedColumn registers callbacks which encrypt the column before
+// it is written and decrypt it after it is read or written. A table may have
+// more than one encrypted column.
+func registerEncryptedColumn(ctx context.Context, rawDB *gorm.DB, keyManager keys.KeyManager, k *columnKeys, table, column string) {
+	encrypt := callbackKMSEncrypt(ctx, keyManager, k, table, column)
+	decrypt := callbackKMSDecrypt(ctx, keyManager, k, table, column)
+	name := table + ":" + column
+
+	rawDB.Callback().Create().Before("gorm:create").Register(name+":encrypt", encrypt)
+	rawDB.Callback().Create().After("gorm:create").Register(name+":decrypt", decrypt)
+
+	rawDB.Callback().Update().Before("gorm:update").Register(name+":encrypt", encrypt)
+	rawDB.Callback().Update().After("gorm:update").Register(name+":decrypt", decrypt)
+
+	rawDB.Callback().Query().After("gorm:after_query").Register(name+":decrypt", decrypt)
+}
+
+// RotateEncryptionKeys re-encrypts values which were not encrypted with the
+// current DB_ENCRYPTION_KEY, such as after it was rotated and the old key was
+// moved to DB_ENCRYPTION_KEY_PREVIOUS. It returns the number of records
+// updated. Once it returns 0, previous keys are no longer needed.
+func (db *Database) RotateEncryptionKeys() (int64, error) {
+	prefix := keyTag(db.config.EncryptionKey) + encryptedValueSeparator + "%"
+
+	var count int64
+
+	var smsConfigs []*SMSConfig
+	if err := db.db.
+		Where("twilio_auth_token != '' AND twilio_auth_token NOT LIKE ?", prefix).
+		Find(&smsConfigs).
+		Error; err != nil && !IsNotFound(err) {
+		return count, fmt.Errorf("failed to find sms configs: %w", err)
+	}
+	for _, c := range smsConfigs {
+		if err := db.db.Save(c).Error; err != nil {
+			return count, fmt.Errorf("failed to re-encrypt sms config %d: %w", c.ID, err)
+		}
+		count++
+	}
+
+	var emailConfigs []*EmailConfig
+	if err := db.db.
+		Where("smtp_password != '' AND smtp_password NOT LIKE ?", prefix).
+		Find(&emailConfigs).
+		Error; err != nil && !IsNotFound(err) {
+		return count, fmt.Errorf("failed to find email configs: %w", err)
+	}
+	for _, c := range emailConfigs {
+		if err := db.db.Save(c).Error; err != nil {
+			return count, fmt.Errorf("failed to re-encrypt email config %d: %w", c.ID, err)
+		}
+		count++
+	}
+
+	var smsRetries []*SMSRetry
+	if err := db.db.
+		Where("phone NOT LIKE ?", prefix).
+		Find(&smsRetries).
+		Error; err != nil && !IsNotFound(err) {
+		return count, fmt.Errorf("failed to find sms retries: %w", err)
+	}
+	for _, r := range smsRetries {
+		if err := db.db.Save(r).Error; err != nil {
+			return count, fmt.Errorf("failed to re-encrypt sms retry %d: %w", r.ID, err)
+		}
+		count++
+	}
+
+	var webhooks []*Webhook
+	if err := db.db.
+		Where("secret NOT LIKE ?", prefix).
+		Find(&webhooks).
+		Error; err != nil && !IsNotFound(err) {
+		return count, fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	for _, w := range webhooks {
+		if err := db.db.Save(w).Error; err != nil {
+			return count, fmt.Errorf("failed to re-encrypt webhook %d: %w", w.ID, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+func TestColumnKeys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	keyManager := keys.TestKeyManager(t)
+	newKey := func(t *testing.T, name string) string {
+		t.Helper()
+
+		typ := keyManager.(keys.EncryptionKeyManager)
+		parent, err := typ.CreateEncryptionKey(ctx, "parent", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := typ.CreateKeyVersion(ctx, parent); err != nil {
+			t.Fatal(err)
+		}
+		return parent
+	}
+	oldKey := newKey(t, "old")
+	newerKey := newKey(t, "new")
+
+	old := &columnKeys{current: oldKey}
+	oldCiphertext, err := old.encrypt(ctx, keyManager, "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(oldCiphertext, keyTag(oldKey)+encryptedValueSeparator) {
+		t.Errorf("expected %q to be tagged with %q", oldCiphertext, keyTag(oldKey))
+	}
+	if !old.isCurrent(oldCiphertext) {
+		t.Errorf("expected %q to be current", oldCiphertext)
+	}
+
+	// After rotation, values encrypted with the old key can still be decrypted
+	// but are not current.
+	rotated := &columnKeys{current: newerKey, previous: []string{oldKey}}
+	if rotated.isCurrent(oldCiphertext) {
+		t.Errorf("expected %q to not be current", oldCiphertext)
+	}
+	plaintext, err := rotated.decrypt(ctx, keyManager, oldCiphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plaintext, "hunter2"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Values from before tags existed have no prefix.
+	legacy := strings.SplitN(oldCiphertext, encryptedValueSeparator, 2)[1]
+	plaintext, err = rotated.decrypt(ctx, keyManager, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plaintext, "hunter2"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Once the old key is removed, its values cannot be decrypted.
+	removed := &columnKeys{current: newerKey}
+	if _, err := removed.decrypt(ctx, keyManager, oldCiphertext); err == nil {
+		t.Errorf("expected error decrypting with a removed key")
+	}
+}
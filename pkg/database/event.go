@@ -0,0 +1,43 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
+)
+
+// emitCodeEvent sends an analytics event for the verification code to the
+// event sink. It must only be called after the change is committed. The code
+// itself is never included, and the external issuer ID is hashed.
+func (db *Database) emitCodeEvent(typ eventsink.EventType, vc *VerificationCode) {
+	if db.eventSink == nil || vc == nil {
+		return
+	}
+
+	db.eventSink.Send(&eventsink.Event{
+		Type:           typ,
+		RealmID:        vc.RealmID,
+		TestType:       vc.TestType,
+		SymptomDate:    eventsink.FormatDate(vc.SymptomDate),
+		TestDate:       eventsink.FormatDate(vc.TestDate),
+		CohortID:       vc.CohortID,
+		Metadata:       vc.Metadata,
+		ExternalIDHash: eventsink.HashID(db.config.EventSink.ExternalIDKey, vc.IssuingExternalID),
+		IssuedAt:       vc.CreatedAt.UTC(),
+		Timestamp:      time.Now().UTC(),
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
+)
+
+type testEventSink struct {
+	events []*eventsink.Event
+}
+
+func (s *testEventSink) Send(e *eventsink.Event) {
+	s.events = append(s.events, e)
+}
+
+func (s *testEventSink) Close() error {
+	return nil
+}
+
+func TestEmitCodeEvent(t *testing.T) {
+	t.Parallel()
+
+	sink := &testEventSink{}
+	db := &Database{
+		config:    &Config{EventSink: eventsink.Config{ExternalIDKey: []byte("key")}},
+		eventSink: sink,
+	}
+
+	symptomDate := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	vc := &VerificationCode{
+		RealmID:           5,
+		Code:              "12345678",
+		LongCode:          "abcdefghijklmnop",
+		TestType:          "confirmed",
+		SymptomDate:       &symptomDate,
+		CohortID:          "outbreak-1",
+		IssuingExternalID: "patient-1234",
+	}
+	db.emitCodeEvent(eventsink.EventCodeIssued, vc)
+
+	if got, want := len(sink.events), 1; got != want {
+		t.Fatalf("expected %d events, got %d", want, got)
+	}
+
+	e := sink.events[0]
+	if e.Type != eventsink.EventCodeIssued || e.RealmID != 5 || e.TestType != "confirmed" || e.CohortID != "outbreak-1" {
+		t.Errorf("unexpected event: %#v", e)
+	}
+	if got, want := e.SymptomDate, "2020-11-01"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if e.ExternalIDHash == "" || e.ExternalIDHash == vc.IssuingExternalID {
+		t.Errorf("expected external id to be hashed, got %q", e.ExternalIDHash)
+	}
+}
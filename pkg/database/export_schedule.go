@@ -0,0 +1,434 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxExportRangeDays is the longest date range an export may cover.
+	maxExportRangeDays = 90
+
+	// maxExportEmails is the maximum number of recipients of an emailed export.
+	maxExportEmails = 10
+)
+
+// ExportScope is the set of stats included in an export. The values match the
+// scope parameter of the realm stats downloads.
+type ExportScope string
+
+const (
+	ExportScopeRealm    ExportScope = "realm"
+	ExportScopeUser     ExportScope = "user"
+	ExportScopeExternal ExportScope = "external"
+	ExportScopeCohort   ExportScope = "cohort"
+	ExportScopeFailures ExportScope = "failures"
+)
+
+// ExportFrequency is how often an export runs.
+type ExportFrequency string
+
+const (
+	ExportFrequencyDaily  ExportFrequency = "daily"
+	ExportFrequencyWeekly ExportFrequency = "weekly"
+)
+
+// ExportFormat is the file format of an export.
+type ExportFormat string
+
+const (
+	ExportFormatCSV  ExportFormat = "csv"
+	ExportFormatJSON ExportFormat = "json"
+)
+
+// ExportDestination is where an export is delivered.
+type ExportDestination string
+
+const (
+	// ExportDestinationGCS writes the export to the realm's Cloud Storage
+	// bucket.
+	ExportDestinationGCS ExportDestination = "gcs"
+
+	// ExportDestinationEmail writes the export to the system export bucket and
+	// emails a signed, expiring link to it.
+	ExportDestinationEmail ExportDestination = "email"
+)
+
+// gcsBucketRe matches valid Cloud Storage bucket names.
+var gcsBucketRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,220}[a-z0-9]$`)
+
+var _ Auditable = (*ExportSchedule)(nil)
+
+// ExportSchedule is a recurring export of a realm's stats. Exports only
+// contain the aggregate stats which are available on the realm stats page,
+// never codes, tokens, or other secrets.
+type ExportSchedule struct {
+	gorm.Model
+	Errorable
+
+	// RealmID is the realm whose stats are exported.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// Scope, Format, and RangeDays describe the contents of the export, which
+	// covers the RangeDays days up to the day the export runs.
+	Scope     ExportScope  `gorm:"column:scope; type:varchar(32); not null;"`
+	Format    ExportFormat `gorm:"column:format; type:varchar(32); not null;"`
+	RangeDays uint         `gorm:"column:range_days; type:integer; not null;"`
+
+	// Frequency is how often the export runs.
+	Frequency ExportFrequency `gorm:"column:frequency; type:varchar(32); not null;"`
+
+	// Destination is where the export is delivered. Bucket and Prefix are used
+	// for Cloud Storage, and Emails for email.
+	Destination ExportDestination `gorm:"column:destination; type:varchar(32); not null;"`
+	Bucket      string            `gorm:"column:bucket; type:varchar(255); not null; default:'';"`
+	Prefix      string            `gorm:"column:prefix; type:varchar(255); not null; default:'';"`
+	Emails      pq.StringArray    `gorm:"column:emails; type:varchar(255)[];"`
+
+	// NextRunAt is when the export next runs. LastRunAt and LastError are the
+	// result of the most recent run.
+	NextRunAt time.Time  `gorm:"column:next_run_at; not null;"`
+	LastRunAt *time.Time `gorm:"column:last_run_at;"`
+	LastError string     `gorm:"column:last_error; type:text; not null; default:'';"`
+}
+
+// TableName sets the table name.
+func (ExportSchedule) TableName() string {
+	return "export_schedules"
+}
+
+// BeforeSave validates the schedule and sets the first run time.
+func (s *ExportSchedule) BeforeSave(tx *gorm.DB) error {
+	if s.RealmID == 0 {
+		s.AddError("realmID", "is required")
+	}
+
+	switch s.Scope {
+	case ExportScopeRealm, ExportScopeUser, ExportScopeExternal, ExportScopeCohort, ExportScopeFailures:
+	default:
+		s.AddError("scope", "is invalid")
+	}
+
+	switch s.Format {
+	case ExportFormatCSV, ExportFormatJSON:
+	default:
+		s.AddError("format", "is invalid")
+	}
+
+	if s.RangeDays < 1 || s.RangeDays > maxExportRangeDays {
+		s.AddError("rangeDays", fmt.Sprintf("must be between 1 and %d", maxExportRangeDays))
+	}
+
+	switch s.Frequency {
+	case ExportFrequencyDaily, ExportFrequencyWeekly:
+	default:
+		s.AddError("frequency", "is invalid")
+	}
+
+	s.Bucket = project.TrimSpace(s.Bucket)
+	s.Prefix = strings.Trim(project.TrimSpace(s.Prefix), "/")
+
+	emails := make([]string, 0, len(s.Emails))
+	for _, v := range s.Emails {
+		if v = project.TrimSpace(v); v != "" {
+			emails = append(emails, v)
+		}
+	}
+	s.Emails = emails
+
+	switch s.Destination {
+	case ExportDestinationGCS:
+		if !gcsBucketRe.MatchString(s.Bucket) {
+			s.AddError("bucket", "must be a valid Cloud Storage bucket name")
+		}
+		if len(s.Prefix) > 200 {
+			s.AddError("prefix", "cannot be more than 200 characters")
+		}
+		s.Emails = nil
+	case ExportDestinationEmail:
+		if len(s.Emails) == 0 {
+			s.AddError("emails", "cannot be blank")
+		}
+		if len(s.Emails) > maxExportEmails {
+			s.AddError("emails", fmt.Sprintf("cannot have more than %d recipients", maxExportEmails))
+		}
+		for _, v := range s.Emails {
+			if !strings.Contains(v, "@") || strings.ContainsAny(v, " \t\r\n<>,;") {
+				s.AddError("emails", fmt.Sprintf("%q is not a valid email address", v))
+			}
+		}
+		s.Bucket, s.Prefix = "", ""
+	default:
+		s.AddError("destination", "is invalid")
+	}
+
+	if s.NextRunAt.IsZero() {
+		s.NextRunAt = s.Next(time.Now())
+	}
+
+	if len(s.Errors()) > 0 {
+		return fmt.Errorf("validation failed: %v", s.Errors())
+	}
+	return nil
+}
+
+// Next returns the first run time after now. Exports run at midnight UTC, so
+// they include the whole previous day, and weekly exports run on Mondays.
+func (s *ExportSchedule) Next(now time.Time) time.Time {
+	next := timeutils.UTCMidnight(now).Add(24 * time.Hour)
+	if s.Frequency == ExportFrequencyWeekly {
+		for next.Weekday() != time.Monday {
+			next = next.Add(24 * time.Hour)
+		}
+	}
+	return next
+}
+
+// Display describes the schedule, for example "daily realm stats (30 days) as
+// csv".
+func (s *ExportSchedule) Display() string {
+	return fmt.Sprintf("%s %s stats (%d days) as %s", s.Frequency, s.Scope, s.RangeDays, s.Format)
+}
+
+// DestinationDisplay describes where the export is delivered.
+func (s *ExportSchedule) DestinationDisplay() string {
+	switch s.Destination {
+	case ExportDestinationGCS:
+		if s.Prefix != "" {
+			return fmt.Sprintf("gs://%s/%s/", s.Bucket, s.Prefix)
+		}
+		return fmt.Sprintf("gs://%s/", s.Bucket)
+	case ExportDestinationEmail:
+		return strings.Join(s.Emails, ", ")
+	default:
+		return string(s.Destination)
+	}
+}
+
+// Filename returns the name of the export file for a run at the given time.
+func (s *ExportSchedule) Filename(now time.Time) string {
+	return fmt.Sprintf("%s-%s-stats.%s", now.UTC().Format("20060102150405"), s.Scope, s.Format)
+}
+
+// ContentType returns the MIME type of the export file.
+func (s *ExportSchedule) ContentType() string {
+	if s.Format == ExportFormatJSON {
+		return "application/json"
+	}
+	return "text/csv"
+}
+
+// Generate builds the export file for a run at the given time.
+func (s *ExportSchedule) Generate(db *Database, realm *Realm, now time.Time) ([]byte, error) {
+	if realm.ID != s.RealmID {
+		return nil, fmt.Errorf("export schedule %d does not belong to realm %d", s.ID, realm.ID)
+	}
+
+	stop := now.UTC()
+	start := stop.Add(-1 * time.Duration(s.RangeDays) * 24 * time.Hour)
+
+	var stats interface {
+		icsv.Marshaler
+		json.Marshaler
+	}
+	var err error
+
+	switch s.Scope {
+	case ExportScopeRealm:
+		stats, err = realm.Stats(db, start, stop)
+	case ExportScopeUser:
+		stats, err = realm.UserStats(db, start, stop)
+	case ExportScopeExternal:
+		stats, err = realm.ExternalIssuerStats(db, start, stop)
+	case ExportScopeCohort:
+		stats, err = db.CountCodesByCohort(realm.ID, start, stop)
+	case ExportScopeFailures:
+		stats, err = db.IssuanceFailureStats(realm.ID, start, stop)
+	default:
+		return nil, fmt.Errorf("unknown export scope %q", s.Scope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s stats: %w", s.Scope, err)
+	}
+
+	if s.Format == ExportFormatJSON {
+		return stats.MarshalJSON()
+	}
+	return stats.MarshalCSV()
+}
+
+// ListExportSchedules lists the realm's export schedules.
+func (r *Realm) ListExportSchedules(db *Database) ([]*ExportSchedule, error) {
+	var schedules []*ExportSchedule
+	if err := db.db.
+		Model(&ExportSchedule{}).
+		Where("realm_id = ?", r.ID).
+		Order("created_at ASC").
+		Find(&schedules).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return schedules, nil
+		}
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// FindExportSchedule finds the realm's export schedule with the given ID.
+func (r *Realm) FindExportSchedule(db *Database, id interface{}) (*ExportSchedule, error) {
+	var schedule ExportSchedule
+	if err := db.db.
+		Model(&ExportSchedule{}).
+		Where("realm_id = ?", r.ID).
+		Where("id = ?", id).
+		First(&schedule).
+		Error; err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// SaveExportSchedule saves the export schedule.
+func (db *Database) SaveExportSchedule(s *ExportSchedule, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided export schedule is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		var existing ExportSchedule
+		if err := tx.
+			Model(&ExportSchedule{}).
+			Where("id = ?", s.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing export schedule")
+		}
+
+		if err := tx.Save(s).Error; err != nil {
+			return fmt.Errorf("failed to save export schedule: %w", err)
+		}
+
+		var audit *AuditEntry
+		if existing.ID == 0 {
+			audit = BuildAuditEntry(actor, "created export schedule", s, s.RealmID)
+		} else {
+			audit = BuildAuditEntry(actor, "updated export schedule", s, s.RealmID)
+			audit.Diff = stringDiff(
+				existing.Display()+" to "+existing.DestinationDisplay(),
+				s.Display()+" to "+s.DestinationDisplay())
+		}
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// DeleteExportSchedule permanently deletes the export schedule.
+func (db *Database) DeleteExportSchedule(s *ExportSchedule, actor Auditable) error {
+	if s == nil {
+		return fmt.Errorf("provided export schedule is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(s).Error; err != nil {
+			return fmt.Errorf("failed to delete export schedule: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "deleted export schedule", s, s.RealmID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// ClaimDueExportSchedules returns up to limit schedules which are due to run
+// and advances their next run time. Schedules claimed by another caller are
+// skipped, so concurrent runners never run the same export twice.
+func (db *Database) ClaimDueExportSchedules(now time.Time, limit uint64) ([]*ExportSchedule, error) {
+	var schedules []*ExportSchedule
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Model(&ExportSchedule{}).
+			Where("next_run_at <= ?", now).
+			Order("next_run_at ASC").
+			Limit(limit).
+			Find(&schedules).
+			Error; err != nil && !IsNotFound(err) {
+			return err
+		}
+
+		for _, s := range schedules {
+			s.NextRunAt = s.Next(now)
+			if err := tx.
+				Model(s).
+				UpdateColumn("next_run_at", s.NextRunAt).
+				Error; err != nil {
+				return fmt.Errorf("failed to advance export schedule %d: %w", s.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// RecordExportScheduleRun records the result of running the export.
+func (db *Database) RecordExportScheduleRun(s *ExportSchedule, now time.Time, runErr error) error {
+	s.LastRunAt = &now
+	s.LastError = ""
+	if runErr != nil {
+		s.LastError = runErr.Error()
+	}
+
+	return db.db.
+		Model(s).
+		UpdateColumns(map[string]interface{}{
+			"last_run_at": s.LastRunAt,
+			"last_error":  s.LastError,
+		}).
+		Error
+}
+
+func (s *ExportSchedule) AuditID() string {
+	return fmt.Sprintf("export_schedules:%d", s.ID)
+}
+
+func (s *ExportSchedule) AuditDisplay() string {
+	return s.Display()
+}
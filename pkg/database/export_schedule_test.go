@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExportSchedule_BeforeSave(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		mutate func(s *ExportSchedule)
+		errs   map[string][]string
+	}{
+		{
+			name:   "valid_email",
+			mutate: func(s *ExportSchedule) {},
+		},
+		{
+			name: "valid_gcs",
+			mutate: func(s *ExportSchedule) {
+				s.Destination = ExportDestinationGCS
+				s.Bucket = "my-exports"
+				s.Prefix = "/stats/"
+			},
+		},
+		{
+			name: "invalid_options",
+			mutate: func(s *ExportSchedule) {
+				s.Scope = "codes"
+				s.Format = "xml"
+				s.Frequency = "hourly"
+				s.RangeDays = 91
+			},
+			errs: map[string][]string{
+				"scope":     {"is invalid"},
+				"format":    {"is invalid"},
+				"frequency": {"is invalid"},
+				"rangeDays": {"must be between 1 and 90"},
+			},
+		},
+		{
+			name: "invalid_bucket",
+			mutate: func(s *ExportSchedule) {
+				s.Destination = ExportDestinationGCS
+				s.Bucket = "My_Bucket!"
+			},
+			errs: map[string][]string{
+				"bucket": {"must be a valid Cloud Storage bucket name"},
+			},
+		},
+		{
+			name: "missing_emails",
+			mutate: func(s *ExportSchedule) {
+				s.Emails = []string{" "}
+			},
+			errs: map[string][]string{
+				"emails": {"cannot be blank"},
+			},
+		},
+		{
+			name: "invalid_email",
+			mutate: func(s *ExportSchedule) {
+				s.Emails = []string{"admin@example.com\nBcc: other@example.com"}
+			},
+			errs: map[string][]string{
+				"emails": {`"admin@example.com\nBcc: other@example.com" is not a valid email address`},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &ExportSchedule{
+				RealmID:     1,
+				Scope:       ExportScopeRealm,
+				Format:      ExportFormatCSV,
+				RangeDays:   30,
+				Frequency:   ExportFrequencyDaily,
+				Destination: ExportDestinationEmail,
+				Emails:      []string{"admin@example.com"},
+			}
+			tc.mutate(s)
+
+			err := s.BeforeSave(nil)
+			if tc.errs == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if s.NextRunAt.IsZero() {
+					t.Errorf("expected next run to be set")
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if diff := cmp.Diff(tc.errs, s.Errors()); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExportSchedule_Next(t *testing.T) {
+	t.Parallel()
+
+	// A Wednesday.
+	now := time.Date(2020, 12, 9, 15, 30, 0, 0, time.UTC)
+
+	daily := &ExportSchedule{Frequency: ExportFrequencyDaily}
+	if got, want := daily.Next(now), time.Date(2020, 12, 10, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	weekly := &ExportSchedule{Frequency: ExportFrequencyWeekly}
+	if got, want := weekly.Next(now), time.Date(2020, 12, 14, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	// Running at midnight on Monday schedules the following Monday.
+	monday := time.Date(2020, 12, 14, 0, 0, 0, 0, time.UTC)
+	if got, want := weekly.Next(monday), time.Date(2020, 12, 21, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+)
+
+var (
+	_ icsv.Marshaler = (IssuanceFailures)(nil)
+	_ icsv.Marshaler = (IssuanceFailureStats)(nil)
+)
+
+// IssuanceFailure is a failed attempt to issue a code, kept for security
+// analysis. It records why the attempt failed and who made it, but nothing from
+// the request itself, so it contains no patient data.
+type IssuanceFailure struct {
+	// ID is the primary key.
+	ID uint `gorm:"primary_key;"`
+
+	// RealmID is the realm in which the code was requested.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// Source is the audit ID of the API key or user which made the request,
+	// such as "authorized_apps:12".
+	Source string `gorm:"column:source; type:varchar(100); not null;"`
+
+	// Reason is the result recorded in metrics, such as "QUOTA_EXCEEDED".
+	Reason string `gorm:"column:reason; type:varchar(100); not null;"`
+
+	// ErrorCode is the API error code returned, if any, and HTTPCode is the
+	// response status.
+	ErrorCode string `gorm:"column:error_code; type:varchar(100); not null; default:'';"`
+	HTTPCode  int    `gorm:"column:http_code; type:integer; not null;"`
+
+	CreatedAt time.Time `gorm:"column:created_at;"`
+}
+
+// TableName sets the table name.
+func (IssuanceFailure) TableName() string {
+	return "issuance_failures"
+}
+
+// RecordIssuanceFailure saves a failed attempt to issue a code.
+func (db *Database) RecordIssuanceFailure(f *IssuanceFailure) error {
+	if f == nil {
+		return fmt.Errorf("provided issuance failure is nil")
+	}
+	return db.db.Create(f).Error
+}
+
+// ListIssuanceFailures lists the realm's failed issuance attempts between the
+// given times, most recent first.
+func (db *Database) ListIssuanceFailures(realmID uint, start, stop time.Time) (IssuanceFailures, error) {
+	var failures IssuanceFailures
+	if err := db.db.
+		Model(&IssuanceFailure{}).
+		Where("realm_id = ?", realmID).
+		Where("created_at >= ? AND created_at <= ?", start, stop).
+		Order("created_at DESC").
+		Find(&failures).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return failures, nil
+		}
+		return nil, err
+	}
+	return failures, nil
+}
+
+// PurgeIssuanceFailures deletes failed issuance attempts older than maxAge.
+func (db *Database) PurgeIssuanceFailures(maxAge time.Duration) (int64, error) {
+	if maxAge > 0 {
+		maxAge = -1 * maxAge
+	}
+	deleteBefore := time.Now().UTC().Add(maxAge)
+
+	result := db.db.
+		Unscoped().
+		Where("created_at < ?", deleteBefore).
+		Delete(&IssuanceFailure{})
+	return result.RowsAffected, result.Error
+}
+
+// IssuanceFailures is a collection of failed issuance attempts.
+type IssuanceFailures []*IssuanceFailure
+
+// MarshalCSV returns bytes in CSV format.
+func (s IssuanceFailures) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"created_at", "realm_id", "source", "reason", "error_code", "http_code"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, f := range s {
+		if err := w.Write([]string{
+			f.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatUint(uint64(f.RealmID), 10),
+			f.Source,
+			f.Reason,
+			f.ErrorCode,
+			strconv.Itoa(f.HTTPCode),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// IssuanceFailureStats is a collection of issuance failure stats.
+type IssuanceFailureStats []*IssuanceFailureStat
+
+// IssuanceFailureStat is the number of failed issuance attempts for a reason on
+// a day.
+type IssuanceFailureStat struct {
+	Date    time.Time `gorm:"column:date; type:date;" json:"date"`
+	RealmID uint      `gorm:"column:realm_id;" json:"-"`
+	Reason  string    `gorm:"column:reason;" json:"reason"`
+	Count   uint      `gorm:"column:count;" json:"count"`
+}
+
+// IssuanceFailureStats returns the number of failed issuance attempts in the
+// realm for each day and reason between the given dates, most recent first.
+func (db *Database) IssuanceFailureStats(realmID uint, start, stop time.Time) (IssuanceFailureStats, error) {
+	start = timeutils.UTCMidnight(start)
+	stop = timeutils.UTCMidnight(stop)
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+
+	sql := `
+		SELECT
+			DATE(created_at) AS date,
+			realm_id,
+			reason,
+			COUNT(*) AS count
+		FROM issuance_failures
+		WHERE realm_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY DATE(created_at), realm_id, reason
+		ORDER BY date DESC, reason`
+
+	var stats IssuanceFailureStats
+	if err := db.db.Raw(sql, realmID, start, stop.AddDate(0, 0, 1)).Scan(&stats).Error; err != nil {
+		if IsNotFound(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
+
+// MarshalCSV returns bytes in CSV format.
+func (s IssuanceFailureStats) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"date", "realm_id", "reason", "count"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, stat := range s {
+		if err := w.Write([]string{
+			stat.Date.Format("2006-01-02"),
+			strconv.FormatUint(uint64(stat.RealmID), 10),
+			stat.Reason,
+			strconv.FormatUint(uint64(stat.Count), 10),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+type jsonIssuanceFailureStats struct {
+	RealmID uint                   `json:"realm_id"`
+	Stats   []*IssuanceFailureStat `json:"statistics"`
+}
+
+// MarshalJSON is a custom JSON marshaller.
+func (s IssuanceFailureStats) MarshalJSON() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return json.Marshal(struct{}{})
+	}
+
+	b, err := json.Marshal(&jsonIssuanceFailureStats{
+		RealmID: s[0].RealmID,
+		Stats:   s,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+	return b, nil
+}
+
+func (s *IssuanceFailureStats) UnmarshalJSON(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var result jsonIssuanceFailureStats
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+
+	for _, stat := range result.Stats {
+		stat.RealmID = result.RealmID
+		*s = append(*s, stat)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIssuanceFailures(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("TestIssuanceFailures")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, reason := range []string{"QUOTA_EXCEEDED", "QUOTA_EXCEEDED", "UNSUPPORTED_TEST_TYPE"} {
+		if err := db.RecordIssuanceFailure(&IssuanceFailure{
+			RealmID:  realm.ID,
+			Source:   "authorized_apps:1",
+			Reason:   reason,
+			HTTPCode: 400,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UTC()
+	failures, err := db.ListIssuanceFailures(realm.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(failures), 3; got != want {
+		t.Errorf("expected %d failures to be %d", got, want)
+	}
+
+	b, err := failures.MarshalCSV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) == 0 {
+		t.Errorf("expected CSV")
+	}
+
+	stats, err := db.IssuanceFailureStats(realm.ID, now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]uint, len(stats))
+	for _, s := range stats {
+		counts[s.Reason] += s.Count
+	}
+	if got, want := counts["QUOTA_EXCEEDED"], uint(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := counts["UNSUPPORTED_TEST_TYPE"], uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Nothing is old enough to purge yet.
+	count, err := db.PurgeIssuanceFailures(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no failures to be purged, got %d", count)
+	}
+}
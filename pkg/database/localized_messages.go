@@ -0,0 +1,178 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"golang.org/x/text/language"
+)
+
+// rawHTMLRe matches the start of an HTML tag, comment, or processing
+// instruction. Localized messages are markdown only.
+var rawHTMLRe = regexp.MustCompile(`<[A-Za-z/!?]`)
+
+// LocalizedMessages is a set of markdown messages keyed by BCP 47 language tag,
+// such as "es" or "fr-CA". It is stored as a JSON object.
+type LocalizedMessages map[string]string
+
+// ParseLocalizedMessages parses a JSON object of language tags to messages. An
+// empty string returns an empty set. The entries are validated when the realm
+// is saved.
+func ParseLocalizedMessages(s string) (LocalizedMessages, error) {
+	s = project.TrimSpace(s)
+	if s == "" {
+		return LocalizedMessages{}, nil
+	}
+
+	var m LocalizedMessages
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of language tags to messages: %w", err)
+	}
+	if m == nil {
+		m = LocalizedMessages{}
+	}
+	return m, nil
+}
+
+// String returns the messages as an indented JSON object, or the empty string
+// if there are none.
+func (m LocalizedMessages) String() string {
+	if len(m) == 0 {
+		return ""
+	}
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// Languages returns the language tags of the messages in sorted order.
+func (m LocalizedMessages) Languages() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalize canonicalizes the language tags and trims the messages. It returns
+// a list of problems with the entries. Blank messages are removed.
+func (m LocalizedMessages) normalize(maxLength int) (LocalizedMessages, []string) {
+	keys := m.Languages()
+
+	var problems []string
+	result := make(LocalizedMessages, len(m))
+	for _, k := range keys {
+		msg := project.TrimSpace(m[k])
+		if msg == "" {
+			continue
+		}
+
+		tag, err := language.Parse(strings.TrimSpace(k))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%q is not a valid language tag", k))
+			continue
+		}
+		canonical := tag.String()
+		if _, ok := result[canonical]; ok {
+			problems = append(problems, fmt.Sprintf("%q is listed more than once", canonical))
+			continue
+		}
+
+		if len(msg) > maxLength {
+			problems = append(problems, fmt.Sprintf("%q cannot be more than %d characters", canonical, maxLength))
+		}
+		result[canonical] = msg
+	}
+	return result, problems
+}
+
+// Lookup returns the message for the first of the given language preferences
+// which matches an entry. Each preference may be a single tag or an
+// Accept-Language header value.
+func (m LocalizedMessages) Lookup(prefs ...string) (string, bool) {
+	if len(m) == 0 {
+		return "", false
+	}
+
+	keys := m.Languages()
+
+	tags := make([]language.Tag, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, language.Make(k))
+	}
+	matcher := language.NewMatcher(tags)
+
+	for _, pref := range prefs {
+		if pref == "" {
+			continue
+		}
+		desired, _, err := language.ParseAcceptLanguage(pref)
+		if err != nil || len(desired) == 0 {
+			continue
+		}
+		if _, idx, conf := matcher.Match(desired...); conf != language.No {
+			return m[keys[idx]], true
+		}
+	}
+	return "", false
+}
+
+// Scan reads the messages from a JSON column.
+func (m *LocalizedMessages) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*m = LocalizedMessages{}
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("invalid scan type %T", src)
+	}
+
+	var result LocalizedMessages
+	if err := json.Unmarshal(b, &result); err != nil {
+		return fmt.Errorf("failed to parse localized messages: %w", err)
+	}
+	if result == nil {
+		result = LocalizedMessages{}
+	}
+	*m = result
+	return nil
+}
+
+// Value writes the messages as a JSON object.
+func (m LocalizedMessages) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal localized messages: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+)
+
+// LoginLockoutPolicy controls how failed logins lock out a client IP address.
+type LoginLockoutPolicy struct {
+	// Threshold is the number of consecutive failures after which the address
+	// is locked out. A value of 0 disables lockouts.
+	Threshold uint
+
+	// BaseDuration is the length of the first lockout. Each further failure
+	// doubles it, up to MaxDuration.
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+
+	// ResetAfter is how long after the last failure the count starts over.
+	ResetAfter time.Duration
+
+	// AlertThreshold is the number of consecutive failures after which system
+	// admins are alerted. A value of 0 disables alerts.
+	AlertThreshold uint
+}
+
+// lockFor returns how long the address is locked out after the given number
+// of consecutive failures.
+func (p *LoginLockoutPolicy) lockFor(failures uint) time.Duration {
+	if p.Threshold == 0 || failures < p.Threshold {
+		return 0
+	}
+
+	d := p.BaseDuration
+	for i := p.Threshold; i < failures && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	if d > p.MaxDuration {
+		d = p.MaxDuration
+	}
+	return d
+}
+
+// LoginLockout tracks consecutive failed logins from a client IP address.
+// Failures are only counted when the server rejects the sign-in, so a client
+// cannot lock out someone else's account by reporting failures for it.
+type LoginLockout struct {
+	// ID is the primary key.
+	ID uint `gorm:"primary_key;"`
+
+	// IPAddress is the client IP address.
+	IPAddress string `gorm:"column:ip_address; type:varchar(64); unique_index; not null;"`
+
+	// FailedAttempts is the number of consecutive failures.
+	FailedAttempts uint `gorm:"column:failed_attempts; type:integer; not null; default:0;"`
+
+	// LastFailedAt is the time of the most recent failure.
+	LastFailedAt time.Time `gorm:"column:last_failed_at;"`
+
+	// LockedUntil is when the lockout ends, if the address is locked out.
+	LockedUntil *time.Time `gorm:"column:locked_until;"`
+
+	// AlertedAt is when system admins were alerted, if they were.
+	AlertedAt *time.Time `gorm:"column:alerted_at;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName sets the table name.
+func (LoginLockout) TableName() string {
+	return "login_lockouts"
+}
+
+// IsLocked returns true if the address is currently locked out.
+func (l *LoginLockout) IsLocked() bool {
+	return l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
+
+func (l *LoginLockout) AuditID() string {
+	return fmt.Sprintf("login_lockouts:%d", l.ID)
+}
+
+func (l *LoginLockout) AuditDisplay() string {
+	return l.IPAddress
+}
+
+// FindLoginLockout finds the lockout record for the IP address.
+func (db *Database) FindLoginLockout(ip string) (*LoginLockout, error) {
+	var lockout LoginLockout
+	if err := db.db.
+		Where("ip_address = ?", strings.TrimSpace(ip)).
+		First(&lockout).
+		Error; err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// RecordLoginFailure counts a failed login from the IP address and locks it
+// out if the policy's threshold is reached. It returns the updated record and
+// whether this failure crossed the policy's alert threshold.
+func (db *Database) RecordLoginFailure(ip string, policy *LoginLockoutPolicy) (*LoginLockout, bool, error) {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return nil, false, fmt.Errorf("ip address cannot be blank")
+	}
+
+	var lockout LoginLockout
+	var alert bool
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("ip_address = ?", ip).
+			First(&lockout).
+			Error; err != nil {
+			if !IsNotFound(err) {
+				return fmt.Errorf("failed to find login lockout: %w", err)
+			}
+			lockout = LoginLockout{IPAddress: ip}
+		}
+
+		now := time.Now().UTC()
+		if policy.ResetAfter > 0 && !lockout.LastFailedAt.IsZero() && now.Sub(lockout.LastFailedAt) > policy.ResetAfter {
+			lockout.FailedAttempts = 0
+			lockout.LockedUntil = nil
+			lockout.AlertedAt = nil
+		}
+
+		lockout.FailedAttempts++
+		lockout.LastFailedAt = now
+
+		if d := policy.lockFor(lockout.FailedAttempts); d > 0 {
+			until := now.Add(d)
+			lockout.LockedUntil = &until
+		}
+
+		if policy.AlertThreshold > 0 && lockout.FailedAttempts >= policy.AlertThreshold && lockout.AlertedAt == nil {
+			lockout.AlertedAt = &now
+			alert = true
+		}
+
+		if err := tx.Save(&lockout).Error; err != nil {
+			return fmt.Errorf("failed to save login lockout: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &lockout, alert, nil
+}
+
+// ListLoginLockouts lists addresses which are currently locked out, most
+// recently failed first.
+func (db *Database) ListLoginLockouts(p *pagination.PageParams, scopes ...Scope) ([]*LoginLockout, *pagination.Paginator, error) {
+	var lockouts []*LoginLockout
+	query := db.db.
+		Model(&LoginLockout{}).
+		Scopes(scopes...).
+		Where("locked_until > ?", time.Now().UTC()).
+		Order("last_failed_at DESC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &lockouts, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return lockouts, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return lockouts, paginator, nil
+}
+
+// ClearLoginLockout removes the lockout with the given ID, so the address may
+// sign in again immediately.
+func (db *Database) ClearLoginLockout(id interface{}, actor Auditable) (*LoginLockout, error) {
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	var lockout LoginLockout
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ?", id).
+			First(&lockout).
+			Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Delete(&lockout).Error; err != nil {
+			return fmt.Errorf("failed to clear login lockout: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "cleared login lockout", &lockout, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lockout, nil
+}
+
+// PurgeLoginLockouts deletes records whose last failure was more than maxAge
+// ago and which are no longer locked out.
+func (db *Database) PurgeLoginLockouts(maxAge time.Duration) (int64, error) {
+	if maxAge > 0 {
+		maxAge = -1 * maxAge
+	}
+	now := time.Now().UTC()
+	deleteBefore := now.Add(maxAge)
+
+	result := db.db.
+		Unscoped().
+		Where("last_failed_at < ?", deleteBefore).
+		Where("locked_until IS NULL OR locked_until < ?", now).
+		Delete(&LoginLockout{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutPolicy_LockFor(t *testing.T) {
+	t.Parallel()
+
+	policy := &LoginLockoutPolicy{
+		Threshold:    3,
+		BaseDuration: time.Minute,
+		MaxDuration:  5 * time.Minute,
+	}
+
+	cases := []struct {
+		failures uint
+		exp      time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tc := range cases {
+		if got := policy.lockFor(tc.failures); got != tc.exp {
+			t.Errorf("expected %d failures to lock for %s, got %s", tc.failures, tc.exp, got)
+		}
+	}
+
+	disabled := &LoginLockoutPolicy{BaseDuration: time.Minute, MaxDuration: time.Hour}
+	if got := disabled.lockFor(100); got != 0 {
+		t.Errorf("expected disabled policy not to lock, got %s", got)
+	}
+}
+
+func TestDatabase_RecordLoginFailure(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	policy := &LoginLockoutPolicy{
+		Threshold:      2,
+		BaseDuration:   time.Minute,
+		MaxDuration:    time.Hour,
+		ResetAfter:     time.Hour,
+		AlertThreshold: 3,
+	}
+
+	ip := " 203.0.113.10"
+
+	lockout, alert, err := db.RecordLoginFailure(ip, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockout.IsLocked() || alert {
+		t.Errorf("expected first failure not to lock or alert")
+	}
+	if got, want := lockout.IPAddress, "203.0.113.10"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	lockout, alert, err = db.RecordLoginFailure(ip, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lockout.IsLocked() || alert {
+		t.Errorf("expected second failure to lock without alert")
+	}
+
+	// The alert is only sent once.
+	if _, alert, err = db.RecordLoginFailure(ip, policy); err != nil {
+		t.Fatal(err)
+	} else if !alert {
+		t.Errorf("expected third failure to alert")
+	}
+	if _, alert, err = db.RecordLoginFailure(ip, policy); err != nil {
+		t.Fatal(err)
+	} else if alert {
+		t.Errorf("expected fourth failure not to alert again")
+	}
+
+	// Other addresses are counted separately.
+	other, _, err := db.RecordLoginFailure("203.0.113.11", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.IsLocked() {
+		t.Errorf("expected other address not to be locked")
+	}
+
+	lockouts, _, err := db.ListLoginLockouts(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 1 {
+		t.Fatalf("expected 1 lockout, got %d", len(lockouts))
+	}
+
+	if _, err := db.ClearLoginLockout(lockouts[0].ID, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindLoginLockout(ip); !IsNotFound(err) {
+		t.Errorf("expected lockout to be cleared, got %v", err)
+	}
+
+	if _, _, err := db.RecordLoginFailure("", policy); err == nil {
+		t.Errorf("expected blank address to fail")
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/timeutils"
+	"github.com/google/exposure-notifications-verification-server/internal/icsv"
+)
+
+var _ icsv.Marshaler = (MetadataStats)(nil)
+
+// MetadataStats is a collection of metadata stats.
+type MetadataStats []*MetadataStat
+
+// MetadataStat is the number of codes issued and claimed with a given value of
+// a metadata key over a date range. Unlike cohort stats, it is counted from the
+// codes themselves, so codes which were purged are not included.
+type MetadataStat struct {
+	RealmID      uint      `gorm:"column:realm_id;" json:"-"`
+	Key          string    `gorm:"column:key;" json:"key"`
+	Value        string    `gorm:"column:value;" json:"value"`
+	CodesIssued  uint      `gorm:"column:codes_issued;" json:"codes_issued"`
+	CodesClaimed uint      `gorm:"column:codes_claimed;" json:"codes_claimed"`
+	FirstDate    time.Time `gorm:"column:first_date;" json:"first_date"`
+	LastDate     time.Time `gorm:"column:last_date;" json:"last_date"`
+}
+
+// MarshalCSV returns bytes in CSV format.
+func (s MetadataStats) MarshalCSV() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if err := w.Write([]string{"realm_id", "key", "value", "codes_issued", "codes_claimed", "first_date", "last_date"}); err != nil {
+		return nil, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for i, stat := range s {
+		if err := w.Write([]string{
+			strconv.FormatUint(uint64(stat.RealmID), 10),
+			stat.Key,
+			stat.Value,
+			strconv.FormatUint(uint64(stat.CodesIssued), 10),
+			strconv.FormatUint(uint64(stat.CodesClaimed), 10),
+			stat.FirstDate.Format("2006-01-02"),
+			stat.LastDate.Format("2006-01-02"),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to create CSV: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+type jsonMetadataStats struct {
+	RealmID uint            `json:"realm_id"`
+	Stats   []*MetadataStat `json:"statistics"`
+}
+
+// MarshalJSON is a custom JSON marshaller.
+func (s MetadataStats) MarshalJSON() ([]byte, error) {
+	// Do nothing if there's no records
+	if len(s) == 0 {
+		return json.Marshal(struct{}{})
+	}
+
+	b, err := json.Marshal(&jsonMetadataStats{
+		RealmID: s[0].RealmID,
+		Stats:   s,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json: %w", err)
+	}
+	return b, nil
+}
+
+func (s *MetadataStats) UnmarshalJSON(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+
+	var result jsonMetadataStats
+	if err := json.Unmarshal(b, &result); err != nil {
+		return err
+	}
+
+	for _, stat := range result.Stats {
+		stat.RealmID = result.RealmID
+		*s = append(*s, stat)
+	}
+	return nil
+}
+
+// CountCodesByMetadata returns the number of codes issued and claimed in the
+// realm between the given dates for each value of the given metadata key, most
+// recently issued first. Metadata is not indexed, so this scans the realm's
+// codes in the date range.
+func (db *Database) CountCodesByMetadata(realmID uint, key string, start, stop time.Time) (MetadataStats, error) {
+	if !ValidCodeMetadataKey(key) {
+		return nil, fmt.Errorf("invalid metadata key %q", key)
+	}
+
+	start = timeutils.UTCMidnight(start)
+	stop = timeutils.UTCMidnight(stop).Add(24 * time.Hour)
+	if start.After(stop) {
+		return nil, ErrBadDateRange
+	}
+
+	sql := `
+		SELECT
+			realm_id,
+			$2::text AS key,
+			metadata->>$2::text AS value,
+			COUNT(*) AS codes_issued,
+			COUNT(*) FILTER (WHERE claim_count > 0) AS codes_claimed,
+			DATE(MIN(created_at)) AS first_date,
+			DATE(MAX(created_at)) AS last_date
+		FROM verification_codes
+		WHERE realm_id = $1 AND created_at >= $3 AND created_at < $4
+			AND metadata->>$2::text IS NOT NULL
+		GROUP BY realm_id, value
+		ORDER BY last_date DESC, value`
+
+	var stats MetadataStats
+	if err := db.db.Raw(sql, realmID, key, start, stop).Scan(&stats).Error; err != nil {
+		if IsNotFound(err) {
+			return stats, nil
+		}
+		return nil, err
+	}
+	return stats, nil
+}
@@ -30,10 +30,16 @@ const initState = "00000-Init"
 const VercodeUUIDUniqueIndex = "idx_vercode_uuid_unique"
 
 func (db *Database) getMigrations(ctx context.Context) *gormigrate.Gormigrate {
-	logger := logging.FromContext(ctx)
 	options := gormigrate.DefaultOptions
+	return gormigrate.New(db.db, options, db.migrations(ctx))
+}
+
+// migrations returns the list of known migrations, in the order they are
+// applied.
+func (db *Database) migrations(ctx context.Context) []*gormigrate.Migration {
+	logger := logging.FromContext(ctx)
 
-	return gormigrate.New(db.db, options, []*gormigrate.Migration{
+	return []*gormigrate.Migration{
 		{
 			ID: initState,
 			Migrate: func(tx *gorm.DB) error {
@@ -1736,51 +1742,1800 @@ func (db *Database) getMigrations(ctx context.Context) *gormigrate.Gormigrate {
 				return tx.Exec(sql).Error
 			},
 		},
-	})
-}
+		{
+			ID: "00072-AddRealmDuplicateExternalIDWindow",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS reject_duplicate_external_id BOOL`,
+					`UPDATE realms SET reject_duplicate_external_id = FALSE WHERE reject_duplicate_external_id IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN reject_duplicate_external_id SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN reject_duplicate_external_id SET NOT NULL`,
 
-// MigrateTo migrates the database to a specific target migration ID.
-func (db *Database) MigrateTo(ctx context.Context, target string, rollback bool) error {
-	logger := logging.FromContext(ctx).Named("migrate")
-	ctx = logging.WithLogger(ctx, logger)
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS duplicate_external_id_window BIGINT`,
+					`UPDATE realms SET duplicate_external_id_window = 0 WHERE duplicate_external_id_window IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN duplicate_external_id_window SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN duplicate_external_id_window SET NOT NULL`,
 
-	m := db.getMigrations(ctx)
-	logger.Debugw("migrations starting")
+					`CREATE INDEX IF NOT EXISTS idx_vercode_realm_external_id ON verification_codes(realm_id, issuing_external_id, created_at)`,
+				}
 
-	var err error
-	if target == "" {
-		if rollback {
-			err = m.RollbackTo(initState)
-		} else {
-			err = m.Migrate() // run all remaining migrations.
-		}
-	} else {
-		if rollback {
-			err = m.RollbackTo(target)
-		} else {
-			err = m.MigrateTo(target)
-		}
-	}
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_vercode_realm_external_id`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS reject_duplicate_external_id`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS duplicate_external_id_window`,
+				}
 
-	if err != nil {
-		logger.Errorw("failed to migrate", "error", err)
-		return err
-	}
-	logger.Debugw("migrations complete")
-	return nil
-}
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00073-AddRealmTimezone",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS timezone VARCHAR(64)`,
+					`UPDATE realms SET timezone = '' WHERE timezone IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN timezone SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN timezone SET NOT NULL`,
+				}
 
-// RunMigrations will apply sequential, transactional migrations to the database
-func (db *Database) RunMigrations(ctx context.Context) error {
-	logger := logging.FromContext(ctx).Named("migrate")
-	ctx = logging.WithLogger(ctx, logger)
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec("ALTER TABLE realms DROP COLUMN IF EXISTS timezone").Error
+			},
+		},
+		{
+			ID: "00074-AddRealmMaxCodesPerExternalID",
+			Migrate: func(tx *gorm.DB) error {
+				// Counting is served by idx_vercode_realm_external_id.
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_codes_per_external_id INTEGER`,
+					`UPDATE realms SET max_codes_per_external_id = 0 WHERE max_codes_per_external_id IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_codes_per_external_id SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_codes_per_external_id SET NOT NULL`,
+				}
 
-	m := db.getMigrations(ctx)
-	logger.Debugw("migrations starting")
-	if err := m.Migrate(); err != nil {
-		logger.Errorw("failed to migrate", "error", err)
-		return err
-	}
-	logger.Debugw("migrations complete")
-	return nil
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec("ALTER TABLE realms DROP COLUMN IF EXISTS max_codes_per_external_id").Error
+			},
+		},
+		{
+			ID: "00075-AddWebhooks",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS webhooks (
+						id SERIAL PRIMARY KEY,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						deleted_at TIMESTAMP WITH TIME ZONE,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						url TEXT NOT NULL,
+						secret TEXT NOT NULL,
+						events VARCHAR(32)[]
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_webhooks_realm_id ON webhooks (realm_id)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS webhooks`).Error
+			},
+		},
+		{
+			ID: "00076-AddRealmMaxActiveCodes",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_active_codes INTEGER`,
+					`UPDATE realms SET max_active_codes = 0 WHERE max_active_codes IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_active_codes SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_active_codes SET NOT NULL`,
+
+					`CREATE INDEX IF NOT EXISTS idx_vercode_realm_unclaimed ON verification_codes(realm_id, long_expires_at, expires_at) WHERE claimed = false`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_vercode_realm_unclaimed`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_active_codes`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00077-AddRealmDisableLongCodes",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS disable_long_codes BOOLEAN`,
+					`UPDATE realms SET disable_long_codes = false WHERE disable_long_codes IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN disable_long_codes SET DEFAULT false`,
+					`ALTER TABLE realms ALTER COLUMN disable_long_codes SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS disable_long_codes`).Error
+			},
+		},
+		{
+			ID: "00078-AddDeviceBinding",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS require_device_binding BOOLEAN`,
+					`UPDATE realms SET require_device_binding = false WHERE require_device_binding IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN require_device_binding SET DEFAULT false`,
+					`ALTER TABLE realms ALTER COLUMN require_device_binding SET NOT NULL`,
+					`ALTER TABLE tokens ADD COLUMN IF NOT EXISTS device_fingerprint TEXT`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE tokens DROP COLUMN IF EXISTS device_fingerprint`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS require_device_binding`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00079-AddRealmAllowedClaimAppIDs",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms ADD COLUMN IF NOT EXISTS allowed_claim_app_ids VARCHAR(512)[]`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS allowed_claim_app_ids`).Error
+			},
+		},
+		{
+			ID: "00080-AddRealmAutofillTestDate",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS autofill_test_date BOOLEAN`,
+					`UPDATE realms SET autofill_test_date = false WHERE autofill_test_date IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN autofill_test_date SET DEFAULT false`,
+					`ALTER TABLE realms ALTER COLUMN autofill_test_date SET NOT NULL`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS test_date_offset_days SMALLINT`,
+					`UPDATE realms SET test_date_offset_days = 0 WHERE test_date_offset_days IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN test_date_offset_days SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN test_date_offset_days SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS autofill_test_date`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS test_date_offset_days`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00081-AddUserSessions",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS user_sessions (
+						id SERIAL PRIMARY KEY,
+						session_id VARCHAR(64) NOT NULL,
+						user_id INTEGER NOT NULL,
+						realm_id INTEGER NOT NULL DEFAULT 0,
+						ip_address VARCHAR(64),
+						user_agent TEXT,
+						last_activity_at TIMESTAMP WITH TIME ZONE,
+						expires_at TIMESTAMP WITH TIME ZONE,
+						revoked_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_user_sessions_session_id ON user_sessions (session_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions (expires_at)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS user_sessions`).Error
+			},
+		},
+		{
+			ID: "00082-AddRealmDeepLinkScheme",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS deep_link_scheme VARCHAR(64)`,
+					`UPDATE realms SET deep_link_scheme = '' WHERE deep_link_scheme IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN deep_link_scheme SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN deep_link_scheme SET NOT NULL`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS deep_link_host VARCHAR(255)`,
+					`UPDATE realms SET deep_link_host = '' WHERE deep_link_host IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN deep_link_host SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN deep_link_host SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS deep_link_scheme`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS deep_link_host`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00083-AddMobileAppMinVersion",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE mobile_apps ADD COLUMN IF NOT EXISTS min_version VARCHAR(32)`,
+					`UPDATE mobile_apps SET min_version = '' WHERE min_version IS NULL`,
+					`ALTER TABLE mobile_apps ALTER COLUMN min_version SET DEFAULT ''`,
+					`ALTER TABLE mobile_apps ALTER COLUMN min_version SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE mobile_apps DROP COLUMN IF EXISTS min_version`).Error
+			},
+		},
+		{
+			ID: "00084-AddIssuanceApproval",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS require_issuance_approval BOOLEAN`,
+					`UPDATE realms SET require_issuance_approval = FALSE WHERE require_issuance_approval IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN require_issuance_approval SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN require_issuance_approval SET NOT NULL`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS issuance_approval_timeout BIGINT`,
+					`UPDATE realms SET issuance_approval_timeout = 0 WHERE issuance_approval_timeout IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN issuance_approval_timeout SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN issuance_approval_timeout SET NOT NULL`,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS approval_status VARCHAR(16) NOT NULL DEFAULT ''`,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS approval_expires_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS approving_user_id INTEGER NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS require_issuance_approval`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS issuance_approval_timeout`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS approval_status`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS approval_expires_at`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS approving_user_id`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00085-AddRealmIssueRateLimits",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS issue_limit_per_minute INTEGER`,
+					`UPDATE realms SET issue_limit_per_minute = 0 WHERE issue_limit_per_minute IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN issue_limit_per_minute SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN issue_limit_per_minute SET NOT NULL`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS issue_limit_per_hour INTEGER`,
+					`UPDATE realms SET issue_limit_per_hour = 0 WHERE issue_limit_per_hour IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN issue_limit_per_hour SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN issue_limit_per_hour SET NOT NULL`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS issue_limit_per_day INTEGER`,
+					`UPDATE realms SET issue_limit_per_day = 0 WHERE issue_limit_per_day IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN issue_limit_per_day SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN issue_limit_per_day SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS issue_limit_per_minute`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS issue_limit_per_hour`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS issue_limit_per_day`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00086-AddCohortID",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS cohort_id VARCHAR(64)`,
+					`UPDATE verification_codes SET cohort_id = '' WHERE cohort_id IS NULL`,
+					`ALTER TABLE verification_codes ALTER COLUMN cohort_id SET DEFAULT ''`,
+					`ALTER TABLE verification_codes ALTER COLUMN cohort_id SET NOT NULL`,
+					`CREATE TABLE IF NOT EXISTS cohort_stats (
+						date DATE NOT NULL,
+						realm_id INTEGER NOT NULL,
+						cohort_id VARCHAR(64) NOT NULL,
+						codes_issued INTEGER NOT NULL DEFAULT 0,
+						codes_claimed INTEGER NOT NULL DEFAULT 0,
+						PRIMARY KEY (date, realm_id, cohort_id)
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_cohort_stats_realm_id_date ON cohort_stats (realm_id, date)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP TABLE IF EXISTS cohort_stats`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS cohort_id`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00087-AddRealmIssueConfirmationMessage",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS issue_confirmation_message TEXT`,
+					`UPDATE realms SET issue_confirmation_message = '' WHERE issue_confirmation_message IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN issue_confirmation_message SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN issue_confirmation_message SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS issue_confirmation_message`).Error
+			},
+		},
+		{
+			ID: "00088-AddRealmClaimResponseMapping",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS claim_response_mapping TEXT`,
+					`UPDATE realms SET claim_response_mapping = '' WHERE claim_response_mapping IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN claim_response_mapping SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN claim_response_mapping SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS claim_response_mapping`).Error
+			},
+		},
+		{
+			ID: "00089-AddRealmPendingApproval",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS pending_approval BOOLEAN`,
+					`UPDATE realms SET pending_approval = FALSE WHERE pending_approval IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN pending_approval SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN pending_approval SET NOT NULL`,
+
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS requested_by_id INTEGER`,
+					`UPDATE realms SET requested_by_id = 0 WHERE requested_by_id IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN requested_by_id SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN requested_by_id SET NOT NULL`,
+
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS request_reason TEXT`,
+					`UPDATE realms SET request_reason = '' WHERE request_reason IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN request_reason SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN request_reason SET NOT NULL`,
+
+					`CREATE INDEX IF NOT EXISTS idx_realms_pending_approval ON realms (pending_approval) WHERE pending_approval`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_realms_pending_approval`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS pending_approval`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS requested_by_id`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS request_reason`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00090-AddRealmMaxConcurrentAPIKeyRequests",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_concurrent_api_key_requests INTEGER`,
+					`UPDATE realms SET max_concurrent_api_key_requests = 0 WHERE max_concurrent_api_key_requests IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_concurrent_api_key_requests SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_concurrent_api_key_requests SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS max_concurrent_api_key_requests`).Error
+			},
+		},
+		{
+			ID: "00091-AddExportSchedules",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS export_schedules (
+						id SERIAL PRIMARY KEY,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE,
+						deleted_at TIMESTAMP WITH TIME ZONE,
+						realm_id INTEGER NOT NULL REFERENCES realms(id) ON DELETE CASCADE,
+						scope VARCHAR(32) NOT NULL,
+						format VARCHAR(32) NOT NULL,
+						range_days INTEGER NOT NULL,
+						frequency VARCHAR(32) NOT NULL,
+						destination VARCHAR(32) NOT NULL,
+						bucket VARCHAR(255) NOT NULL DEFAULT '',
+						prefix VARCHAR(255) NOT NULL DEFAULT '',
+						emails VARCHAR(255)[],
+						next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						last_run_at TIMESTAMP WITH TIME ZONE,
+						last_error TEXT NOT NULL DEFAULT ''
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_export_schedules_realm_id ON export_schedules (realm_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_export_schedules_next_run_at ON export_schedules (next_run_at) WHERE deleted_at IS NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS export_schedules`).Error
+			},
+		},
+		{
+			ID: "00092-AddRealmNegativeResultPolicy",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS negative_result_policy SMALLINT`,
+					`UPDATE realms SET negative_result_policy = 0 WHERE negative_result_policy IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN negative_result_policy SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN negative_result_policy SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS negative_result_policy`).Error
+			},
+		},
+		{
+			ID: "00093-AddLoginLockouts",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS login_lockouts (
+						id SERIAL PRIMARY KEY,
+						email VARCHAR(250) NOT NULL,
+						failed_attempts INTEGER NOT NULL DEFAULT 0,
+						last_failed_at TIMESTAMP WITH TIME ZONE,
+						locked_until TIMESTAMP WITH TIME ZONE,
+						alerted_at TIMESTAMP WITH TIME ZONE,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_login_lockouts_email ON login_lockouts (email)`,
+					`CREATE INDEX IF NOT EXISTS idx_login_lockouts_locked_until ON login_lockouts (locked_until)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS login_lockouts`).Error
+			},
+		},
+		{
+			ID: "00094-AddRealmAllowedClaimCountries",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS allowed_claim_countries VARCHAR(2)[]`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS enforce_claim_countries BOOLEAN`,
+					`UPDATE realms SET enforce_claim_countries = FALSE WHERE enforce_claim_countries IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN enforce_claim_countries SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN enforce_claim_countries SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS allowed_claim_countries`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS enforce_claim_countries`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00095-AddRealmTokenDuration",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS token_duration BIGINT`,
+					`UPDATE realms SET token_duration = 0 WHERE token_duration IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN token_duration SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN token_duration SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS token_duration`).Error
+			},
+		},
+		{
+			ID: "00096-AddRealmLogoURL",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS logo_url TEXT`,
+					`UPDATE realms SET logo_url = '' WHERE logo_url IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN logo_url SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN logo_url SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS logo_url`).Error
+			},
+		},
+		{
+			ID: "00097-AddRealmLocalizedIssueConfirmationMessages",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS localized_issue_confirmation_messages JSONB`,
+					`UPDATE realms SET localized_issue_confirmation_messages = '{}' WHERE localized_issue_confirmation_messages IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN localized_issue_confirmation_messages SET DEFAULT '{}'`,
+					`ALTER TABLE realms ALTER COLUMN localized_issue_confirmation_messages SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS localized_issue_confirmation_messages`).Error
+			},
+		},
+		{
+			ID: "00098-AddRealmCaseInsensitiveCodes",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS case_insensitive_codes BOOLEAN`,
+					`UPDATE realms SET case_insensitive_codes = FALSE WHERE case_insensitive_codes IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN case_insensitive_codes SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN case_insensitive_codes SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS case_insensitive_codes`).Error
+			},
+		},
+		{
+			ID: "00099-AddWebhookPayloadVersion",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS payload_version INTEGER NOT NULL DEFAULT 1`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE webhooks DROP COLUMN IF EXISTS payload_version`).Error
+			},
+		},
+		{
+			ID: "00100-AddAuthorizedAppInactivity",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					// Existing keys start being tracked now, so they are not disabled
+					// as soon as inactive keys are disabled.
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP WITH TIME ZONE`,
+					`UPDATE authorized_apps SET last_used_at = NOW() WHERE last_used_at IS NULL`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS inactivity_warned_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS inactivity_exempt BOOLEAN`,
+					`UPDATE authorized_apps SET inactivity_exempt = FALSE WHERE inactivity_exempt IS NULL`,
+					`ALTER TABLE authorized_apps ALTER COLUMN inactivity_exempt SET DEFAULT FALSE`,
+					`ALTER TABLE authorized_apps ALTER COLUMN inactivity_exempt SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS last_used_at`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS inactivity_warned_at`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS inactivity_exempt`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00101-AddVerificationCodeMetadata",
+			Migrate: func(tx *gorm.DB) error {
+				// A constant default does not rewrite existing rows.
+				return tx.Exec(`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE verification_codes DROP COLUMN IF EXISTS metadata`).Error
+			},
+		},
+		{
+			ID: "00102-AddSMSFailurePolicy",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS sms_failure_policy SMALLINT`,
+					`UPDATE realms SET sms_failure_policy = 0 WHERE sms_failure_policy IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN sms_failure_policy SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN sms_failure_policy SET NOT NULL`,
+
+					`CREATE TABLE IF NOT EXISTS sms_retries (
+						id SERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL,
+						verification_code_uuid UUID NOT NULL,
+						phone TEXT NOT NULL,
+						message TEXT NOT NULL,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						last_error TEXT,
+						next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE,
+						updated_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_sms_retries_next_attempt_at ON sms_retries (next_attempt_at)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP TABLE IF EXISTS sms_retries`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS sms_failure_policy`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00103-AddRealmStrictCodeExpiry",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS strict_code_expiry BOOLEAN`,
+					`UPDATE realms SET strict_code_expiry = FALSE WHERE strict_code_expiry IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN strict_code_expiry SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN strict_code_expiry SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS strict_code_expiry`).Error
+			},
+		},
+		{
+			ID: "00104-AddSupervisingUser",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS supervising_user_id INTEGER`,
+					`CREATE INDEX IF NOT EXISTS idx_vercode_supervising_user_id ON verification_codes (supervising_user_id)`,
+					`ALTER TABLE user_stats ADD COLUMN IF NOT EXISTS codes_supervised INTEGER`,
+					`UPDATE user_stats SET codes_supervised = 0 WHERE codes_supervised IS NULL`,
+					`ALTER TABLE user_stats ALTER COLUMN codes_supervised SET DEFAULT 0`,
+					`ALTER TABLE user_stats ALTER COLUMN codes_supervised SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE user_stats DROP COLUMN IF EXISTS codes_supervised`,
+					`DROP INDEX IF EXISTS idx_vercode_supervising_user_id`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS supervising_user_id`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00105-AddRealmKioskMode",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS kiosk_mode BOOLEAN`,
+					`UPDATE realms SET kiosk_mode = FALSE WHERE kiosk_mode IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN kiosk_mode SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN kiosk_mode SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS kiosk_mode`).Error
+			},
+		},
+		{
+			ID: "00106-AddRealmQuietHours",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS quiet_hours TEXT`,
+					`UPDATE realms SET quiet_hours = '' WHERE quiet_hours IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN quiet_hours SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN quiet_hours SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS quiet_hours`).Error
+			},
+		},
+		{
+			ID: "00107-AddFailedClaimAttempts",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS failed_claim_attempts INTEGER`,
+					`UPDATE verification_codes SET failed_claim_attempts = 0 WHERE failed_claim_attempts IS NULL`,
+					`ALTER TABLE verification_codes ALTER COLUMN failed_claim_attempts SET DEFAULT 0`,
+					`ALTER TABLE verification_codes ALTER COLUMN failed_claim_attempts SET NOT NULL`,
+
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_failed_claim_attempts INTEGER`,
+					`UPDATE realms SET max_failed_claim_attempts = 0 WHERE max_failed_claim_attempts IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_failed_claim_attempts SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_failed_claim_attempts SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS failed_claim_attempts`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_failed_claim_attempts`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00108-AddRealmAllowedCIDRsIssue",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms ADD COLUMN IF NOT EXISTS allowed_cidrs_issue VARCHAR(50)[]`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS allowed_cidrs_issue`).Error
+			},
+		},
+		{
+			ID: "00109-AddRealmReportTypeMapping",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS report_type_mapping TEXT`,
+					`UPDATE realms SET report_type_mapping = '' WHERE report_type_mapping IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN report_type_mapping SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN report_type_mapping SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS report_type_mapping`).Error
+			},
+		},
+		{
+			ID: "00110-MakeRegionCodeUniqueOptional",
+			Migrate: func(tx *gorm.DB) error {
+				// Deployments which opt out of unique region codes get a plain index.
+				if !db.config.EnforceUniqueRegionCodes {
+					return relaxRegionCodeUniqueness(tx)
+				}
+
+				// Otherwise the constraint becomes a partial unique index, which
+				// SaveRealm reports as a validation error.
+				sqls := []string{
+					`ALTER TABLE realms DROP CONSTRAINT IF EXISTS uix_realms_region_code`,
+					`CREATE UNIQUE INDEX IF NOT EXISTS uix_realms_region_code ON realms (region_code) WHERE region_code IS NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_realms_region_code`,
+					`DROP INDEX IF EXISTS uix_realms_region_code`,
+					`ALTER TABLE realms ADD CONSTRAINT uix_realms_region_code UNIQUE (region_code)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00111-AddRealmClaimLimitPerExternalID",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS claim_limit_per_external_id INTEGER`,
+					`UPDATE realms SET claim_limit_per_external_id = 0 WHERE claim_limit_per_external_id IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN claim_limit_per_external_id SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN claim_limit_per_external_id SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS claim_limit_per_external_id`).Error
+			},
+		},
+		{
+			ID: "00112-AddRealmCodeSeparators",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS code_separators VARCHAR(16)`,
+					`UPDATE realms SET code_separators = '' WHERE code_separators IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN code_separators SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN code_separators SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS code_separators`).Error
+			},
+		},
+		{
+			ID: "00113-AddRealmClaimRedirectURL",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS claim_redirect_url TEXT`,
+					`UPDATE realms SET claim_redirect_url = '' WHERE claim_redirect_url IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN claim_redirect_url SET DEFAULT ''`,
+					`ALTER TABLE realms ALTER COLUMN claim_redirect_url SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS claim_redirect_url`).Error
+			},
+		},
+		{
+			ID: "00114-AddIssuanceFailures",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS issuance_failures (
+						id SERIAL PRIMARY KEY,
+						realm_id INTEGER NOT NULL,
+						source VARCHAR(100) NOT NULL,
+						reason VARCHAR(100) NOT NULL,
+						error_code VARCHAR(100) NOT NULL DEFAULT '',
+						http_code INTEGER NOT NULL,
+						created_at TIMESTAMP WITH TIME ZONE
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_issuance_failures_realm_id_created_at ON issuance_failures (realm_id, created_at)`,
+					`CREATE INDEX IF NOT EXISTS idx_issuance_failures_created_at ON issuance_failures (created_at)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS issuance_failures`).Error
+			},
+		},
+		{
+			ID: "00115-AddRealmSMSTextTemplates",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS sms_text_templates JSONB`,
+					`UPDATE realms SET sms_text_templates = '{}' WHERE sms_text_templates IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN sms_text_templates SET DEFAULT '{}'`,
+					`ALTER TABLE realms ALTER COLUMN sms_text_templates SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS sms_text_templates`).Error
+			},
+		},
+		{
+			ID: "00116-AddRealmIssueFieldLimits",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_metadata_keys INTEGER`,
+					`UPDATE realms SET max_metadata_keys = 0 WHERE max_metadata_keys IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_metadata_keys SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_metadata_keys SET NOT NULL`,
+
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_metadata_bytes INTEGER`,
+					`UPDATE realms SET max_metadata_bytes = 0 WHERE max_metadata_bytes IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_metadata_bytes SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_metadata_bytes SET NOT NULL`,
+
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_external_id_length INTEGER`,
+					`UPDATE realms SET max_external_id_length = 0 WHERE max_external_id_length IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN max_external_id_length SET DEFAULT 0`,
+					`ALTER TABLE realms ALTER COLUMN max_external_id_length SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_metadata_keys`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_metadata_bytes`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_external_id_length`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00117-AddRealmSignCertificateResponses",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS sign_certificate_responses BOOLEAN`,
+					`UPDATE realms SET sign_certificate_responses = FALSE WHERE sign_certificate_responses IS NULL`,
+					`ALTER TABLE realms ALTER COLUMN sign_certificate_responses SET DEFAULT FALSE`,
+					`ALTER TABLE realms ALTER COLUMN sign_certificate_responses SET NOT NULL`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS sign_certificate_responses`).Error
+			},
+		},
+		{
+			ID: "00118-AddRealmTestTypeSunsets",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS confirmed_sunset_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS likely_sunset_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS negative_sunset_at TIMESTAMP WITH TIME ZONE`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS confirmed_sunset_at`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS likely_sunset_at`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS negative_sunset_at`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00119-AddRealmDateOrder",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS enforce_date_order BOOLEAN NOT NULL DEFAULT FALSE`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_test_before_symptom_days SMALLINT NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS enforce_date_order`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_test_before_symptom_days`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00120-AddAuditEntryQueryIndexes",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE INDEX IF NOT EXISTS idx_audit_entries_realm_id_created_at ON audit_entries (realm_id, created_at DESC)`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_entries_actor_id_created_at ON audit_entries (actor_id, created_at DESC)`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_entries_target_id_created_at ON audit_entries (target_id, created_at DESC)`,
+					`CREATE INDEX IF NOT EXISTS idx_audit_entries_lower_action ON audit_entries (LOWER(action) text_pattern_ops)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_audit_entries_realm_id_created_at`,
+					`DROP INDEX IF EXISTS idx_audit_entries_actor_id_created_at`,
+					`DROP INDEX IF EXISTS idx_audit_entries_target_id_created_at`,
+					`DROP INDEX IF EXISTS idx_audit_entries_lower_action`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00121-AddCodeMaxClaims",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS max_claims INTEGER NOT NULL DEFAULT 1`,
+					`ALTER TABLE verification_codes ADD COLUMN IF NOT EXISTS claim_count INTEGER NOT NULL DEFAULT 0`,
+					`UPDATE verification_codes SET claim_count = 1 WHERE claimed`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS max_claims_per_code INTEGER NOT NULL DEFAULT 1`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS max_claims`,
+					`ALTER TABLE verification_codes DROP COLUMN IF EXISTS claim_count`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS max_claims_per_code`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00122-AddRealmDisableShortCodeClaims",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS disable_short_code_claims BOOLEAN NOT NULL DEFAULT FALSE`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS disable_short_code_claims`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00123-AddRealmMonthlyCodeQuota",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS monthly_code_quota INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS quota_disabled_at TIMESTAMP WITH TIME ZONE`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS quota_disabled_notified BOOLEAN NOT NULL DEFAULT FALSE`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS monthly_code_quota`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS quota_disabled_at`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS quota_disabled_notified`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00124-AddRealmRequireExternalID",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS require_external_id BOOLEAN NOT NULL DEFAULT FALSE`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS external_id_format TEXT NOT NULL DEFAULT ''`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS require_external_id`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS external_id_format`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00125-AddAuthorizedAppPreviousAPIKey",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS previous_api_key VARCHAR(512) NOT NULL DEFAULT ''`,
+					`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS previous_api_key_expires_at TIMESTAMP WITH TIME ZONE`,
+					`CREATE INDEX IF NOT EXISTS idx_authorized_apps_previous_api_key ON authorized_apps (previous_api_key) WHERE previous_api_key != ''`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DROP INDEX IF EXISTS idx_authorized_apps_previous_api_key`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS previous_api_key`,
+					`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS previous_api_key_expires_at`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00126-AddRealmFutureDateTolerance",
+			Migrate: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE realms ADD COLUMN IF NOT EXISTS future_date_tolerance BIGINT NOT NULL DEFAULT 300`
+				return tx.Exec(sql).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sql := `ALTER TABLE realms DROP COLUMN IF EXISTS future_date_tolerance`
+				return tx.Exec(sql).Error
+			},
+		},
+		{
+			ID: "00127-AddRealmTokenClaims",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS token_issuer VARCHAR(150) NOT NULL DEFAULT ''`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS token_audience VARCHAR(150) NOT NULL DEFAULT ''`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS token_issuer`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS token_audience`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00128-AddRealmEmailCodes",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS enable_email_codes BOOLEAN NOT NULL DEFAULT false`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS email_code_template TEXT NOT NULL DEFAULT ''`,
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS email_code_templates JSONB NOT NULL DEFAULT '{}'`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS enable_email_codes`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS email_code_template`,
+					`ALTER TABLE realms DROP COLUMN IF EXISTS email_code_templates`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00129-AddRealmDeepLinkMetadataKeys",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms ADD COLUMN IF NOT EXISTS deep_link_metadata_keys VARCHAR(32)[]`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE realms DROP COLUMN IF EXISTS deep_link_metadata_keys`).Error
+			},
+		},
+		{
+			ID: "00130-AddMinClaimInterval",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms ADD COLUMN IF NOT EXISTS min_claim_interval_seconds INTEGER NOT NULL DEFAULT 0`,
+					`ALTER TABLE realm_stats ADD COLUMN IF NOT EXISTS codes_claimed_synthetic INTEGER NOT NULL DEFAULT 0`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE realms DROP COLUMN IF EXISTS min_claim_interval_seconds`,
+					`ALTER TABLE realm_stats DROP COLUMN IF EXISTS codes_claimed_synthetic`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "00131-AddAuthorizedAppAcceptTestTypes",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE authorized_apps ADD COLUMN IF NOT EXISTS accept_test_types SMALLINT NOT NULL DEFAULT 0`).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE authorized_apps DROP COLUMN IF EXISTS accept_test_types`).Error
+			},
+		},
+		{
+			ID: "00132-AddWebhookDeliveries",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+						id BIGSERIAL PRIMARY KEY,
+						created_at TIMESTAMP WITH TIME ZONE,
+						webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+						realm_id INTEGER NOT NULL,
+						event_type VARCHAR(32) NOT NULL,
+						event JSONB NOT NULL,
+						attempts INTEGER NOT NULL DEFAULT 0,
+						next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at)`,
+					`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP TABLE IF EXISTS webhook_deliveries`).Error
+			},
+		},
+		{
+			ID: "00133-AddWebhookDeliveriesVerificationCodeID",
+			Migrate: func(tx *gorm.DB) error {
+				sqls := []string{
+					`ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS verification_code_id INTEGER`,
+					`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_verification_code_id ON webhook_deliveries (verification_code_id)`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS verification_code_id`).Error
+			},
+		},
+		{
+			ID: "00134-KeyLoginLockoutsByIPAddress",
+			Migrate: func(tx *gorm.DB) error {
+				// Failures were reported by the login page for any email, so the
+				// existing records cannot be trusted and are dropped.
+				sqls := []string{
+					`DELETE FROM login_lockouts`,
+					`ALTER TABLE login_lockouts RENAME COLUMN email TO ip_address`,
+					`ALTER TABLE login_lockouts ALTER COLUMN ip_address TYPE VARCHAR(64)`,
+					`ALTER INDEX IF EXISTS uix_login_lockouts_email RENAME TO uix_login_lockouts_ip_address`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Rollback: func(tx *gorm.DB) error {
+				sqls := []string{
+					`DELETE FROM login_lockouts`,
+					`ALTER INDEX IF EXISTS uix_login_lockouts_ip_address RENAME TO uix_login_lockouts_email`,
+					`ALTER TABLE login_lockouts ALTER COLUMN ip_address TYPE VARCHAR(250)`,
+					`ALTER TABLE login_lockouts RENAME COLUMN ip_address TO email`,
+				}
+
+				for _, sql := range sqls {
+					if err := tx.Exec(sql).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// MigrateTo migrates the database to a specific target migration ID.
+func (db *Database) MigrateTo(ctx context.Context, target string, rollback bool) error {
+	logger := logging.FromContext(ctx).Named("migrate")
+	ctx = logging.WithLogger(ctx, logger)
+
+	m := db.getMigrations(ctx)
+	logger.Debugw("migrations starting")
+
+	var err error
+	if target == "" {
+		if rollback {
+			err = m.RollbackTo(initState)
+		} else {
+			err = m.Migrate() // run all remaining migrations.
+		}
+	} else {
+		if rollback {
+			err = m.RollbackTo(target)
+		} else {
+			err = m.MigrateTo(target)
+		}
+	}
+
+	if err != nil {
+		logger.Errorw("failed to migrate", "error", err)
+		return err
+	}
+	logger.Debugw("migrations complete")
+	return nil
+}
+
+// RunMigrations will apply sequential, transactional migrations to the database
+func (db *Database) RunMigrations(ctx context.Context) error {
+	logger := logging.FromContext(ctx).Named("migrate")
+	ctx = logging.WithLogger(ctx, logger)
+
+	m := db.getMigrations(ctx)
+	logger.Debugw("migrations starting")
+	if err := m.Migrate(); err != nil {
+		logger.Errorw("failed to migrate", "error", err)
+		return err
+	}
+	logger.Debugw("migrations complete")
+	return nil
+}
+
+// PendingMigrations returns the IDs of the known migrations which have not
+// been applied to the database, in the order they would be applied. It also
+// returns the IDs of applied migrations which are unknown to this version of
+// the server, which usually means a newer version migrated the database.
+func (db *Database) PendingMigrations(ctx context.Context) ([]string, []string, error) {
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrations := db.migrations(ctx)
+	known := make([]string, 0, len(migrations))
+	for _, m := range migrations {
+		known = append(known, m.ID)
+	}
+
+	pending, unknown := migrationDrift(known, applied)
+	return pending, unknown, nil
+}
+
+// appliedMigrations returns the IDs of all migrations recorded in the
+// database. If the migrations table does not exist, no migrations have been
+// applied.
+func (db *Database) appliedMigrations() ([]string, error) {
+	options := gormigrate.DefaultOptions
+	if !db.db.HasTable(options.TableName) {
+		return nil, nil
+	}
+
+	var ids []string
+	if err := db.db.
+		Table(options.TableName).
+		Order(options.IDColumnName).
+		Pluck(options.IDColumnName, &ids).
+		Error; err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	return ids, nil
+}
+
+// migrationDrift compares the known migrations with the applied migrations.
+// It returns the known migrations which are not applied, in order, and the
+// applied migrations which are not known.
+func migrationDrift(known, applied []string) ([]string, []string) {
+	appliedSet := make(map[string]struct{}, len(applied))
+	for _, id := range applied {
+		appliedSet[id] = struct{}{}
+	}
+
+	knownSet := make(map[string]struct{}, len(known))
+	pending := make([]string, 0, 4)
+	for _, id := range known {
+		knownSet[id] = struct{}{}
+		if _, ok := appliedSet[id]; !ok {
+			pending = append(pending, id)
+		}
+	}
+
+	unknown := make([]string, 0, 4)
+	for _, id := range applied {
+		if _, ok := knownSet[id]; !ok {
+			unknown = append(unknown, id)
+		}
+	}
+
+	return pending, unknown
 }
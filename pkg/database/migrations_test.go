@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMigrationDrift(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		known   []string
+		applied []string
+		pending []string
+		unknown []string
+	}{
+		{
+			name:    "fresh",
+			known:   []string{"00001-A", "00002-B"},
+			pending: []string{"00001-A", "00002-B"},
+			unknown: []string{},
+		},
+		{
+			name:    "up_to_date",
+			known:   []string{"00001-A", "00002-B"},
+			applied: []string{"00001-A", "00002-B"},
+			pending: []string{},
+			unknown: []string{},
+		},
+		{
+			name:    "pending",
+			known:   []string{"00001-A", "00002-B", "00003-C"},
+			applied: []string{"00001-A"},
+			pending: []string{"00002-B", "00003-C"},
+			unknown: []string{},
+		},
+		{
+			name:    "newer_database",
+			known:   []string{"00001-A"},
+			applied: []string{"00001-A", "00002-B"},
+			pending: []string{},
+			unknown: []string{"00002-B"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			pending, unknown := migrationDrift(tc.known, tc.applied)
+			if diff := cmp.Diff(tc.pending, pending); diff != "" {
+				t.Errorf("pending mismatch (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.unknown, unknown); diff != "" {
+				t.Errorf("unknown mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMigrations_UniqueIDs(t *testing.T) {
+	t.Parallel()
+
+	db := new(Database)
+	seen := make(map[string]struct{})
+	for _, m := range db.migrations(context.Background()) {
+		if _, ok := seen[m.ID]; ok {
+			t.Errorf("duplicate migration %q", m.ID)
+		}
+		seen[m.ID] = struct{}{}
+	}
+}
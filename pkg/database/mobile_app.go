@@ -16,6 +16,7 @@ package database
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -49,6 +50,9 @@ const (
 
 var _ Auditable = (*MobileApp)(nil)
 
+// appVersionRe matches dotted version numbers such as "1.4" or "1.4.0".
+var appVersionRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,3}$`)
+
 type MobileApp struct {
 	gorm.Model
 	Errorable
@@ -73,6 +77,11 @@ type MobileApp struct {
 	// It is only present for Android devices, and should be of the form:
 	//   AA:BB:CC:DD...
 	SHA string `gorm:"column:sha; type:text;"`
+
+	// MinVersion is the oldest version of the app the realm supports, such as
+	// "1.4.0". It is returned to clients in the app config so outdated apps can
+	// prompt the user to upgrade. If empty, any version is supported.
+	MinVersion string `gorm:"column:min_version; type:varchar(32); not null; default:'';"`
 }
 
 func (a *MobileApp) BeforeSave(tx *gorm.DB) error {
@@ -127,6 +136,11 @@ func (a *MobileApp) BeforeSave(tx *gorm.DB) error {
 	}
 	a.SHA = strings.Join(shas, "\n")
 
+	a.MinVersion = project.TrimSpace(a.MinVersion)
+	if a.MinVersion != "" && !appVersionRe.MatchString(a.MinVersion) {
+		a.AddError("min_version", "must be a version number like 1.4.0")
+	}
+
 	if len(a.Errors()) > 0 {
 		return fmt.Errorf("validation failed: %v", a.Errors())
 	}
@@ -261,6 +275,12 @@ func (db *Database) SaveMobileApp(a *MobileApp, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.MinVersion != a.MinVersion {
+				audit := BuildAuditEntry(actor, "updated mobile app min version", a, a.RealmID)
+				audit.Diff = stringDiff(existing.MinVersion, a.MinVersion)
+				audits = append(audits, audit)
+			}
+
 			if existing.DeletedAt != a.DeletedAt {
 				audit := BuildAuditEntry(actor, "updated mobile app enabled", a, a.RealmID)
 				audit.Diff = boolDiff(existing.DeletedAt == nil, a.DeletedAt == nil)
@@ -0,0 +1,174 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// QuotaMonth returns the start and end of the UTC calendar month containing t,
+// which is the period of a realm's monthly code quota.
+func QuotaMonth(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// IssuanceDisabledByQuota returns true if issuance was disabled because the
+// realm used its monthly code quota, and the month has not ended.
+func (r *Realm) IssuanceDisabledByQuota(now time.Time) bool {
+	if r.QuotaDisabledAt == nil {
+		return false
+	}
+	_, end := QuotaMonth(*r.QuotaDisabledAt)
+	return now.Before(end)
+}
+
+// MonthlyQuotaExhausted returns true if the realm has a monthly code quota and
+// has issued at least that many codes this month.
+func (r *Realm) MonthlyQuotaExhausted(db *Database, now time.Time) (bool, error) {
+	if r.MonthlyCodeQuota == 0 {
+		return false, nil
+	}
+
+	count, err := r.CountMonthlyCodesIssued(db, now)
+	if err != nil {
+		return false, err
+	}
+	return count >= uint64(r.MonthlyCodeQuota), nil
+}
+
+// CountMonthlyCodesIssued returns the number of codes issued in the realm
+// during the month containing now. Imported codes are not counted.
+func (r *Realm) CountMonthlyCodesIssued(db *Database, now time.Time) (uint64, error) {
+	start, end := QuotaMonth(now)
+
+	var result struct {
+		Count uint64
+	}
+	if err := db.db.
+		Raw(`SELECT COALESCE(SUM(codes_issued), 0) AS count FROM realm_stats
+			WHERE realm_id = ? AND date >= ? AND date < ?`, r.ID, start, end).
+		Scan(&result).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// DisableRealmIssuanceForQuota records that the realm used its monthly code
+// quota. Issuance stays disabled until the month ends or the quota is raised,
+// but codes which were already issued can still be claimed. It does nothing if
+// issuance is already disabled this month.
+func (db *Database) DisableRealmIssuanceForQuota(r *Realm, now time.Time) error {
+	now = now.UTC()
+	start, _ := QuotaMonth(now)
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Model(&Realm{}).
+			Where("id = ?", r.ID).
+			Where("quota_disabled_at IS NULL OR quota_disabled_at < ?", start).
+			UpdateColumns(map[string]interface{}{
+				"quota_disabled_at":       now,
+				"quota_disabled_notified": false,
+			})
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to disable realm issuance: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		r.QuotaDisabledAt = &now
+		r.QuotaDisabledNotified = false
+
+		audit := BuildAuditEntry(System, fmt.Sprintf("disabled issuance after using monthly quota of %d codes", r.MonthlyCodeQuota), r, r.ID)
+		audit.Diff = boolDiff(true, false)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// EnableRealmIssuanceForQuota re-enables issuance for a realm which was
+// disabled by DisableRealmIssuanceForQuota, for example because the month ended
+// or a system admin raised the quota.
+func (db *Database) EnableRealmIssuanceForQuota(r *Realm, reason string, actor Auditable) error {
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Model(&Realm{}).
+			Where("id = ?", r.ID).
+			Where("quota_disabled_at IS NOT NULL").
+			UpdateColumns(map[string]interface{}{
+				"quota_disabled_at":       gorm.Expr("NULL"),
+				"quota_disabled_notified": false,
+			})
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to enable realm issuance: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		r.QuotaDisabledAt = nil
+		r.QuotaDisabledNotified = false
+
+		audit := BuildAuditEntry(actor, fmt.Sprintf("re-enabled issuance, %s", reason), r, r.ID)
+		audit.Diff = boolDiff(false, true)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListQuotaDisabledRealms lists realms whose issuance was disabled for using
+// their monthly code quota.
+func (db *Database) ListQuotaDisabledRealms() ([]*Realm, error) {
+	var realms []*Realm
+	if err := db.db.
+		Model(&Realm{}).
+		Where("quota_disabled_at IS NOT NULL").
+		Order("id").
+		Find(&realms).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return realms, nil
+		}
+		return nil, err
+	}
+	return realms, nil
+}
+
+// MarkRealmQuotaDisabledNotified records that the realm admins were told
+// issuance was disabled.
+func (db *Database) MarkRealmQuotaDisabledNotified(r *Realm) error {
+	r.QuotaDisabledNotified = true
+	return db.db.
+		Model(&Realm{}).
+		Where("id = ?", r.ID).
+		UpdateColumn("quota_disabled_notified", true).
+		Error
+}
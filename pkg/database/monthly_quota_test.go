@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotaMonth(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC-5", -5*60*60)
+
+	cases := []struct {
+		name  string
+		t     time.Time
+		start time.Time
+		end   time.Time
+	}{
+		{
+			name:  "middle",
+			t:     time.Date(2020, 2, 14, 12, 0, 0, 0, time.UTC),
+			start: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "december",
+			t:     time.Date(2020, 12, 31, 23, 59, 0, 0, time.UTC),
+			start: time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:  "other_timezone",
+			t:     time.Date(2020, 4, 30, 22, 0, 0, 0, loc),
+			start: time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			start, end := QuotaMonth(tc.t)
+			if !start.Equal(tc.start) {
+				t.Errorf("expected start %v to be %v", start, tc.start)
+			}
+			if !end.Equal(tc.end) {
+				t.Errorf("expected end %v to be %v", end, tc.end)
+			}
+		})
+	}
+}
+
+func TestRealm_IssuanceDisabledByQuota(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 6, 15, 0, 0, 0, 0, time.UTC)
+	thisMonth := time.Date(2020, 6, 3, 0, 0, 0, 0, time.UTC)
+	lastMonth := time.Date(2020, 5, 28, 0, 0, 0, 0, time.UTC)
+
+	var r Realm
+	if r.IssuanceDisabledByQuota(now) {
+		t.Errorf("expected issuance to be enabled")
+	}
+
+	r.QuotaDisabledAt = &thisMonth
+	if !r.IssuanceDisabledByQuota(now) {
+		t.Errorf("expected issuance to be disabled")
+	}
+
+	r.QuotaDisabledAt = &lastMonth
+	if r.IssuanceDisabledByQuota(now) {
+		t.Errorf("expected issuance to be enabled after the month reset")
+	}
+}
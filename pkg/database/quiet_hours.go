@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// quietHoursLayout is the format of the times in a quiet hours window.
+const quietHoursLayout = "15:04"
+
+// QuietHoursWindow is a daily range of local time during which a realm does
+// not issue codes. Start and End are minutes after midnight. If End is before
+// Start, the window spans midnight.
+type QuietHoursWindow struct {
+	Start int
+	End   int
+}
+
+// Contains returns true if the minute after midnight is in the window. The
+// start is inclusive and the end is exclusive.
+func (w *QuietHoursWindow) Contains(minute int) bool {
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// String returns the window in the "HH:MM-HH:MM" format.
+func (w *QuietHoursWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// ParseQuietHours parses a comma-separated list of "HH:MM-HH:MM" windows in
+// 24-hour time, for example "22:00-06:00, 12:00-13:00". An empty string has no
+// windows.
+func ParseQuietHours(s string) ([]*QuietHoursWindow, error) {
+	var windows []*QuietHoursWindow
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		times := strings.Split(part, "-")
+		if len(times) != 2 {
+			return nil, fmt.Errorf("%q must be of the form HH:MM-HH:MM", part)
+		}
+
+		start, err := parseQuietHoursTime(times[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q has an invalid start time", part)
+		}
+		end, err := parseQuietHoursTime(times[1])
+		if err != nil {
+			return nil, fmt.Errorf("%q has an invalid end time", part)
+		}
+		if start == end {
+			return nil, fmt.Errorf("%q must end at a different time than it starts", part)
+		}
+
+		windows = append(windows, &QuietHoursWindow{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// parseQuietHoursTime returns the minutes after midnight of the "HH:MM" time.
+func parseQuietHoursTime(s string) (int, error) {
+	t, err := time.Parse(quietHoursLayout, strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// formatQuietHours returns the canonical form of the windows.
+func formatQuietHours(windows []*QuietHoursWindow) string {
+	parts := make([]string, 0, len(windows))
+	for _, w := range windows {
+		parts = append(parts, w.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ActiveQuietHours returns the realm's quiet hours window which contains now in
+// the realm's timezone, or nil if codes may be issued.
+func (r *Realm) ActiveQuietHours(now time.Time) *QuietHoursWindow {
+	windows, err := ParseQuietHours(r.QuietHours)
+	if err != nil {
+		return nil
+	}
+
+	local := now.In(r.Location())
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range windows {
+		if w.Contains(minute) {
+			return w
+		}
+	}
+	return nil
+}
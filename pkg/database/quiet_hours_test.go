@@ -0,0 +1,142 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		input string
+		exp   string
+		err   bool
+	}{
+		{name: "empty", input: "", exp: ""},
+		{name: "single", input: "22:00-06:00", exp: "22:00-06:00"},
+		{name: "multiple", input: " 12:00 - 13:30 ,22:00-23:59,", exp: "12:00-13:30, 22:00-23:59"},
+		{name: "single_digit_hour", input: "9:00-17:00", exp: "09:00-17:00"},
+		{name: "missing_end", input: "22:00", err: true},
+		{name: "too_many_parts", input: "22:00-23:00-01:00", err: true},
+		{name: "invalid_hour", input: "25:00-06:00", err: true},
+		{name: "invalid_minute", input: "22:60-06:00", err: true},
+		{name: "empty_window", input: "08:00-08:00", err: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			windows, err := ParseQuietHours(tc.input)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := formatQuietHours(windows); got != tc.exp {
+				t.Errorf("expected %q to be %q", got, tc.exp)
+			}
+		})
+	}
+}
+
+func TestRealm_ActiveQuietHours(t *testing.T) {
+	t.Parallel()
+
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		quietHours string
+		timezone   string
+		now        time.Time
+		exp        string
+	}{
+		{
+			name: "none",
+			now:  time.Date(2020, 6, 1, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "inside",
+			quietHours: "12:00-13:00",
+			now:        time.Date(2020, 6, 1, 12, 30, 0, 0, time.UTC),
+			exp:        "12:00-13:00",
+		},
+		{
+			name:       "end_exclusive",
+			quietHours: "12:00-13:00",
+			now:        time.Date(2020, 6, 1, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "spans_midnight_before",
+			quietHours: "22:00-06:00",
+			now:        time.Date(2020, 6, 1, 23, 15, 0, 0, time.UTC),
+			exp:        "22:00-06:00",
+		},
+		{
+			name:       "spans_midnight_after",
+			quietHours: "22:00-06:00",
+			now:        time.Date(2020, 6, 2, 5, 59, 0, 0, time.UTC),
+			exp:        "22:00-06:00",
+		},
+		{
+			name:       "spans_midnight_outside",
+			quietHours: "22:00-06:00",
+			now:        time.Date(2020, 6, 2, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "realm_timezone",
+			quietHours: "22:00-06:00",
+			timezone:   "America/Los_Angeles",
+			now:        time.Date(2020, 6, 1, 23, 0, 0, 0, la),
+			exp:        "22:00-06:00",
+		},
+		{
+			name:       "realm_timezone_outside",
+			quietHours: "22:00-06:00",
+			timezone:   "America/Los_Angeles",
+			now:        time.Date(2020, 6, 1, 23, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := &Realm{QuietHours: tc.quietHours, Timezone: tc.timezone}
+			got := realm.ActiveQuietHours(tc.now)
+
+			var s string
+			if got != nil {
+				s = got.String()
+			}
+			if s != tc.exp {
+				t.Errorf("expected %q to be %q", s, tc.exp)
+			}
+		})
+	}
+}
@@ -20,15 +20,24 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"net/url"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	// Embed the IANA timezone database since the containers are built from
+	// scratch and do not include one.
+	_ "time/tzdata"
 
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
 	"github.com/google/exposure-notifications-verification-server/pkg/digest"
 	"github.com/google/exposure-notifications-verification-server/pkg/email"
 	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 	"github.com/google/exposure-notifications-verification-server/pkg/sms"
 	"github.com/microcosm-cc/bluemonday"
 
@@ -48,7 +57,12 @@ const (
 )
 
 func (t TestType) Display() string {
-	var types []string
+	return strings.Join(t.Names(), ", ")
+}
+
+// Names returns the names of the test types in the set, in a stable order.
+func (t TestType) Names() []string {
+	types := make([]string, 0, 3)
 
 	if t&TestTypeConfirmed != 0 {
 		types = append(types, "confirmed")
@@ -62,18 +76,89 @@ func (t TestType) Display() string {
 		types = append(types, "negative")
 	}
 
-	return strings.Join(types, ", ")
+	return types
 }
 
 var (
 	ErrNoSigningKeyManagement = errors.New("no signing key management")
 	ErrBadDateRange           = errors.New("bad date range")
+
+	// countryCodeRe matches an ISO 3166-1 alpha-2 country code.
+	countryCodeRe = regexp.MustCompile(`^[A-Z]{2}$`)
+
+	// deepLinkSchemeRe matches a URI scheme as defined in RFC 3986.
+	deepLinkSchemeRe = regexp.MustCompile(`^[a-z][a-z0-9+.\-]*$`)
+
+	// deepLinkHostRe matches a lowercase hostname.
+	deepLinkHostRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9.\-]*[a-z0-9])?$`)
 )
 
+// DefaultIssueConfirmationMessage is the message shown to staff after issuing a
+// code when the realm has not configured one. The format is markdown.
+const DefaultIssueConfirmationMessage = `Read the code to the patient and ask them to enter it in their exposure notifications app before it expires. Remind them not to share the code with anyone.`
+
 const (
 	maxCodeDuration     = time.Hour
 	maxLongCodeDuration = 24 * time.Hour
 
+	maxDuplicateExternalIDWindow = 14 * 24 * time.Hour
+	maxIssuanceApprovalTimeout   = 24 * time.Hour
+
+	// maxExternalIDFormatLength is the longest external ID format expression.
+	maxExternalIDFormatLength = 255
+
+	// MaxTokenDuration is the longest a verification token may be valid after a
+	// code is claimed, for both the server default and realm overrides.
+	MaxTokenDuration = 14 * 24 * time.Hour
+
+	// maxTokenClaimLength is the maximum length of a token issuer or audience.
+	// It matches the size of the columns.
+	maxTokenClaimLength = 150
+
+	maxIssueConfirmationMessageLength = 4096
+
+	// maxSMSTextTemplateLength is the maximum length of an SMS template, before
+	// substitutions. It matches the size of the sms_text_template column.
+	maxSMSTextTemplateLength = 400
+
+	// maxEmailCodeTemplateLength is the maximum length of an email code
+	// template, before substitutions.
+	maxEmailCodeTemplateLength = 4096
+
+	// maxCodeSeparators is the maximum number of code separator characters.
+	maxCodeSeparators = 8
+
+	// maxClaimRedirectURLLength is the maximum length of a claim redirect URL.
+	maxClaimRedirectURLLength = 1024
+
+	// MaxTestDateOffsetDays is the maximum number of days between the symptom
+	// date and the autofilled test date.
+	MaxTestDateOffsetDays = 14
+
+	// MaxTestBeforeSymptomDays is the maximum number of days a test date may be
+	// allowed before the symptom date when the date order is enforced.
+	MaxTestBeforeSymptomDays = 14
+
+	// MaxFutureDateTolerance is the most a realm may set for
+	// FutureDateTolerance.
+	MaxFutureDateTolerance = time.Hour
+
+	// MaxFailedClaimAttemptsLimit is the highest value a realm may set for
+	// MaxFailedClaimAttempts.
+	MaxFailedClaimAttemptsLimit = 100
+
+	// MaxMinClaimIntervalSeconds is the highest value a realm may set for
+	// MinClaimIntervalSeconds.
+	MaxMinClaimIntervalSeconds = 3600
+
+	// MaxClaimLimitPerExternalID is the highest value a realm may set for
+	// ClaimLimitPerExternalID.
+	MaxClaimLimitPerExternalID = 1000
+
+	// MaxClaimsPerCodeLimit is the highest value a realm may set for
+	// MaxClaimsPerCode.
+	MaxClaimsPerCodeLimit = 20
+
 	SMSRegion        = "[region]"
 	SMSCode          = "[code]"
 	SMSExpires       = "[expires]"
@@ -81,6 +166,11 @@ const (
 	SMSLongExpires   = "[longexpires]"
 	SMSENExpressLink = "[enslink]"
 
+	// DefaultDeepLinkScheme and DefaultDeepLinkHost build the deep link for
+	// realms which do not set their own.
+	DefaultDeepLinkScheme = "ens"
+	DefaultDeepLinkHost   = "v"
+
 	EmailInviteLink        = "[invitelink]"
 	EmailPasswordResetLink = "[passwordresetlink]"
 	EmailVerifyLink        = "[verifylink]"
@@ -102,6 +192,75 @@ const (
 	MaxPageSize = 1000
 )
 
+// NegativeResultPolicy controls how verification codes for negative test
+// results are handled when they are claimed.
+type NegativeResultPolicy int16
+
+const (
+	// NegativeResultAllow treats negative results like any other test type.
+	NegativeResultAllow NegativeResultPolicy = iota
+	// NegativeResultBlockUpload issues a verification token, but the token cannot
+	// be exchanged for a verification certificate.
+	NegativeResultBlockUpload
+	// NegativeResultShortExpiry issues a verification token with a shorter
+	// expiration than other test types.
+	NegativeResultShortExpiry
+	// NegativeResultInformational confirms the result to the app without
+	// returning a verification token.
+	NegativeResultInformational
+)
+
+// Display returns a human-readable name for the policy.
+func (p NegativeResultPolicy) Display() string {
+	switch p {
+	case NegativeResultAllow:
+		return "allow"
+	case NegativeResultBlockUpload:
+		return "block upload"
+	case NegativeResultShortExpiry:
+		return "short expiry"
+	case NegativeResultInformational:
+		return "informational only"
+	default:
+		return fmt.Sprintf("unknown (%d)", p)
+	}
+}
+
+// BlocksUpload returns true if tokens for negative results cannot be exchanged
+// for a certificate under this policy.
+func (p NegativeResultPolicy) BlocksUpload() bool {
+	return p == NegativeResultBlockUpload || p == NegativeResultInformational
+}
+
+// SMSFailurePolicy controls what happens to a verification code when the text
+// message containing it cannot be sent.
+type SMSFailurePolicy int16
+
+const (
+	// SMSFailureFail deletes the code and fails the issue request.
+	SMSFailureFail SMSFailurePolicy = iota
+	// SMSFailureWarn keeps the code and returns it with a warning that it was
+	// not sent, so it can be given to the patient another way.
+	SMSFailureWarn
+	// SMSFailureRetry keeps the code, returns it with a warning, and queues the
+	// text message to be retried by the cleanup worker.
+	SMSFailureRetry
+)
+
+// Display returns a human-readable name for the policy.
+func (p SMSFailurePolicy) Display() string {
+	switch p {
+	case SMSFailureFail:
+		return "fail the request"
+	case SMSFailureWarn:
+		return "issue with a warning"
+	case SMSFailureRetry:
+		return "issue and retry sending"
+	default:
+		return fmt.Sprintf("unknown (%d)", p)
+	}
+}
+
 var _ Auditable = (*Realm)(nil)
 
 // Realm represents a tenant in the system. Typically this corresponds to a
@@ -126,6 +285,30 @@ type Realm struct {
 	WelcomeMessage    string  `gorm:"-"`
 	WelcomeMessagePtr *string `gorm:"column:welcome_message; type:text;"`
 
+	// IssueConfirmationMessage is displayed to staff after a code is issued, for
+	// example a script to read to the patient. If empty,
+	// DefaultIssueConfirmationMessage is displayed. The format is markdown.
+	IssueConfirmationMessage string `gorm:"column:issue_confirmation_message; type:text; not null; default:''"`
+
+	// LocalizedIssueConfirmationMessages are translations of the issue
+	// confirmation message, keyed by language tag. The message matching the
+	// user's language is displayed, falling back to IssueConfirmationMessage.
+	LocalizedIssueConfirmationMessages LocalizedMessages `gorm:"column:localized_issue_confirmation_messages; type:jsonb; not null; default:'{}'"`
+
+	// Timezone is the IANA timezone name used when displaying times to users of
+	// this realm. If empty, times are displayed in UTC.
+	Timezone string `gorm:"type:varchar(64); not null; default:''"`
+
+	// LogoURL is the URL of the realm's logo, which is displayed in the header
+	// when the realm is selected. It is set when an admin uploads a logo.
+	LogoURL string `gorm:"column:logo_url; type:text; not null; default:''"`
+
+	// ClaimRedirectURL is returned in successful verify responses, so web claim
+	// flows can send the user to a success page or back into the app. It must be
+	// an https URL or use the realm's deep link scheme. If empty, no redirect is
+	// returned.
+	ClaimRedirectURL string `gorm:"column:claim_redirect_url; type:text; not null; default:''"`
+
 	// AllowBulkUpload allows users to issue codes from a batch file of test results.
 	AllowBulkUpload bool `gorm:"type:boolean; not null; default:false"`
 
@@ -135,9 +318,63 @@ type Realm struct {
 	LongCodeLength   uint            `gorm:"type:smallint; not null; default: 16"`
 	LongCodeDuration DurationSeconds `gorm:"type:bigint; not null; default: 86400"` // default 24h
 
+	// TokenDuration is how long the verification token from claiming a code is
+	// valid. It is independent of the code durations, since some key servers
+	// need longer to accept uploads. If zero, the API server's default is used.
+	TokenDuration DurationSeconds `gorm:"column:token_duration; type:bigint; not null; default:0"`
+
+	// TokenIssuer and TokenAudience are the iss and aud claims of verification
+	// tokens issued for the realm, for key servers which expect specific values.
+	// If empty, the API server's token issuer is used.
+	TokenIssuer   string `gorm:"column:token_issuer; type:varchar(150); not null; default:''"`
+	TokenAudience string `gorm:"column:token_audience; type:varchar(150); not null; default:''"`
+
+	// DisableLongCodes disables generation of long codes. Codes are only usable
+	// by manually entering the short code, so long code SMS substitutions and EN
+	// Express are unavailable.
+	DisableLongCodes bool `gorm:"column:disable_long_codes; type:boolean; not null; default:false"`
+
+	// DisableShortCodeClaims only accepts long codes, and deep links which
+	// contain them, when codes are claimed. This is for realms where codes are
+	// always scanned or followed as links, so a short code which is read aloud
+	// or guessed cannot be claimed. Short codes are still issued.
+	DisableShortCodeClaims bool `gorm:"column:disable_short_code_claims; type:boolean; not null; default:false"`
+
+	// CaseInsensitiveCodes matches codes regardless of case when they are
+	// verified, for staff who type long codes by hand. Codes are stored in
+	// normalized form and displayed in their generated case.
+	CaseInsensitiveCodes bool `gorm:"column:case_insensitive_codes; type:boolean; not null; default:false"`
+
+	// CodeSeparators are characters which are removed from codes before they are
+	// verified, so codes entered with spaces or dashes for readability still
+	// match. They cannot be letters or digits, which appear in codes.
+	CodeSeparators string `gorm:"column:code_separators; type:varchar(16); not null; default:''"`
+
+	// StrictCodeExpiry rejects claims for codes which were valid for longer than
+	// the realm's code durations when they were issued. Codes are always
+	// rejected if they exceed the system maximums.
+	StrictCodeExpiry bool `gorm:"column:strict_code_expiry; type:boolean; not null; default:false"`
+
+	// DeepLinkScheme and DeepLinkHost customize the deep link used for
+	// [enslink] and QR codes when no EN Express redirect domain is configured.
+	// If empty, DefaultDeepLinkScheme and DefaultDeepLinkHost are used.
+	DeepLinkScheme string `gorm:"column:deep_link_scheme; type:varchar(64); not null; default:''"`
+	DeepLinkHost   string `gorm:"column:deep_link_host; type:varchar(255); not null; default:''"`
+
+	// DeepLinkMetadataKeys are the code metadata keys embedded in the deep link
+	// returned when a code is issued, so the app can pre-populate its screens.
+	// The embedded metadata is signed with the realm's signing key. If empty,
+	// the deep link only contains the region and code.
+	DeepLinkMetadataKeys pq.StringArray `gorm:"column:deep_link_metadata_keys; type:varchar(32)[];"`
+
 	// SMS configuration
 	SMSTextTemplate string `gorm:"type:varchar(400); not null; default: 'This is your Exposure Notifications Verification code: [longcode] Expires in [longexpires] hours'"`
 
+	// SMSTextTemplates are translations of SMSTextTemplate, keyed by language
+	// tag. The template matching the locale of the issue request is sent,
+	// falling back to SMSTextTemplate.
+	SMSTextTemplates LocalizedMessages `gorm:"column:sms_text_templates; type:jsonb; not null; default:'{}'"`
+
 	// SMSCountry is an optional field to hint the default phone picker country
 	// code.
 	SMSCountry    string  `gorm:"-"`
@@ -154,6 +391,10 @@ type Realm struct {
 	// configuration, making it impossible to opt out of text message sending.
 	UseSystemSMSConfig bool `gorm:"column:use_system_sms_config; type:bool; not null; default:false;"`
 
+	// SMSFailurePolicy controls whether a code is still issued when its text
+	// message cannot be sent. The default is to fail the request.
+	SMSFailurePolicy SMSFailurePolicy `gorm:"column:sms_failure_policy; type:smallint; not null; default:0;"`
+
 	// EmailInviteTemplate is the template for inviting new users.
 	EmailInviteTemplate string `gorm:"type:text;"`
 
@@ -163,6 +404,15 @@ type Realm struct {
 	// EmailVerifyTemplate is the template used for email verification.
 	EmailVerifyTemplate string `gorm:"type:text;"`
 
+	// EnableEmailCodes allows issued codes to be sent to an email address with
+	// the realm's email configuration. EmailCodeTemplate is the body of the
+	// message, with the same substitutions as SMSTextTemplate, and
+	// EmailCodeTemplates are its translations, keyed by language tag. The
+	// recipient address is only used to send the message and is not stored.
+	EnableEmailCodes   bool              `gorm:"column:enable_email_codes; type:boolean; not null; default:false"`
+	EmailCodeTemplate  string            `gorm:"column:email_code_template; type:text; not null; default:''"`
+	EmailCodeTemplates LocalizedMessages `gorm:"column:email_code_templates; type:jsonb; not null; default:'{}'"`
+
 	// CanUseSystemEmailConfig is configured by system administrators to share the
 	// system email config with this realm. Note that the system email config could be
 	// empty and a local email config is preferred over the system value.
@@ -197,14 +447,183 @@ type Realm struct {
 	AllowedCIDRsAPIServer pq.StringArray `gorm:"column:allowed_cidrs_apiserver; type:varchar(50)[];"`
 	AllowedCIDRsServer    pq.StringArray `gorm:"column:allowed_cidrs_server; type:varchar(50)[];"`
 
+	// AllowedCIDRsIssue is the list of CIDR blocks from which codes may be
+	// issued, through the UI or the Admin API. If empty, codes may be issued
+	// from any IP.
+	AllowedCIDRsIssue pq.StringArray `gorm:"column:allowed_cidrs_issue; type:varchar(50)[];"`
+
+	// MaxConcurrentAPIKeyRequests is the maximum number of requests a single API
+	// key may have in flight at once on each server instance. A value of 0 means
+	// unlimited.
+	MaxConcurrentAPIKeyRequests uint `gorm:"column:max_concurrent_api_key_requests; type:integer; not null; default:0"`
+
+	// KioskMode puts users who are not realm admins in kiosk mode, which hides
+	// navigation, only allows issuing codes, and uses a shorter idle timeout.
+	KioskMode bool `gorm:"column:kiosk_mode; type:boolean; not null; default:false"`
+
+	// SignCertificateResponses signs successful certificate responses with the
+	// key which signs the realm's certificates, so key servers can verify the
+	// response came from this server.
+	SignCertificateResponses bool `gorm:"column:sign_certificate_responses; type:boolean; not null; default:false"`
+
 	// AllowedTestTypes is the type of tests that this realm permits. The default
 	// value is to allow all test types.
 	AllowedTestTypes TestType `gorm:"type:smallint; not null; default: 14"`
 
+	// ConfirmedSunsetAt, LikelySunsetAt, and NegativeSunsetAt are optional times
+	// after which codes can no longer be issued for the test type, even if it is
+	// in AllowedTestTypes.
+	ConfirmedSunsetAt *time.Time `gorm:"column:confirmed_sunset_at;"`
+	LikelySunsetAt    *time.Time `gorm:"column:likely_sunset_at;"`
+	NegativeSunsetAt  *time.Time `gorm:"column:negative_sunset_at;"`
+
+	// NegativeResultPolicy controls how codes for negative test results are
+	// handled when claimed. The default is to treat them like other test types.
+	NegativeResultPolicy NegativeResultPolicy `gorm:"column:negative_result_policy; type:smallint; not null; default:0"`
+
 	// RequireDate requires that verifications on this realm require a test or
 	// symptom date (either). The default behavior is to not require a date.
 	RequireDate bool `gorm:"type:boolean; not null; default:false"`
 
+	// AutofillTestDate allows the issue form to default the test date from the
+	// symptom date, and vice versa, using TestDateOffsetDays. When enabled, the
+	// test date may not be before the symptom date.
+	AutofillTestDate   bool `gorm:"column:autofill_test_date; type:boolean; not null; default:false"`
+	TestDateOffsetDays uint `gorm:"column:test_date_offset_days; type:smallint; not null; default:0"`
+
+	// EnforceDateOrder rejects codes whose test date is more than
+	// MaxTestBeforeSymptomDays before the symptom date. With a gap of 0, the test
+	// date may not be before the symptom date.
+	EnforceDateOrder         bool `gorm:"column:enforce_date_order; type:boolean; not null; default:false"`
+	MaxTestBeforeSymptomDays int  `gorm:"column:max_test_before_symptom_days; type:smallint; not null; default:0"`
+
+	// FutureDateTolerance is how far the clock of a client issuing codes may be
+	// ahead of the server's. Symptom and test dates after today are rejected,
+	// where today is taken this far in the future.
+	FutureDateTolerance DurationSeconds `gorm:"column:future_date_tolerance; type:bigint; not null; default:300"`
+
+	// RejectDuplicateExternalID rejects issuing a code when another code was
+	// issued with the same external issuer ID within DuplicateExternalIDWindow.
+	// Unlike a client-provided UUID, the previously-issued code is never
+	// returned.
+	RejectDuplicateExternalID bool            `gorm:"column:reject_duplicate_external_id; type:boolean; not null; default:false"`
+	DuplicateExternalIDWindow DurationSeconds `gorm:"column:duplicate_external_id_window; type:bigint; not null; default:0"`
+
+	// RequireExternalID rejects issuing a code without an external issuer ID,
+	// for realms which reconcile every code against a case-management system.
+	RequireExternalID bool `gorm:"column:require_external_id; type:boolean; not null; default:false"`
+
+	// ExternalIDFormat is a regular expression which external issuer IDs must
+	// match in full. It is only checked when RequireExternalID is set.
+	ExternalIDFormat string `gorm:"column:external_id_format; type:text; not null; default:''"`
+
+	// MaxCodesPerExternalID is the maximum number of codes that may ever be
+	// issued for a single external issuer ID. A value of 0 means unlimited.
+	MaxCodesPerExternalID uint `gorm:"column:max_codes_per_external_id; type:integer; not null; default:0"`
+
+	// MonthlyCodeQuota is the number of codes the realm may issue each UTC
+	// calendar month, set by system admins. Once it is used, issuance is
+	// disabled until the month ends or the quota is raised. A value of 0 means
+	// unlimited.
+	MonthlyCodeQuota uint `gorm:"column:monthly_code_quota; type:integer; not null; default:0"`
+
+	// QuotaDisabledAt is when issuance was disabled for using the monthly code
+	// quota, and QuotaDisabledNotified is whether the realm admins were told.
+	// They are only changed by DisableRealmIssuanceForQuota and
+	// EnableRealmIssuanceForQuota.
+	QuotaDisabledAt       *time.Time `gorm:"column:quota_disabled_at"`
+	QuotaDisabledNotified bool       `gorm:"column:quota_disabled_notified; type:boolean; not null; default:false"`
+
+	// MaxClaimsPerCode is the most times an issuer may allow a single code to be
+	// claimed, for example when one code is issued for a household. Each claim
+	// produces its own token. Codes are single-use unless the issuer asks for
+	// more claims.
+	MaxClaimsPerCode uint `gorm:"column:max_claims_per_code; type:integer; not null; default:1"`
+
+	// MaxMetadataKeys, MaxMetadataBytes, and MaxExternalIDLength lower the
+	// server's limits on the metadata and external issuer ID of issued codes. A
+	// value of 0 uses the server's limit, and values above it have no effect.
+	MaxMetadataKeys     uint `gorm:"column:max_metadata_keys; type:integer; not null; default:0"`
+	MaxMetadataBytes    uint `gorm:"column:max_metadata_bytes; type:integer; not null; default:0"`
+	MaxExternalIDLength uint `gorm:"column:max_external_id_length; type:integer; not null; default:0"`
+
+	// MaxActiveCodes is the maximum number of issued codes that may be
+	// outstanding (unexpired and unclaimed) at once. A value of 0 means
+	// unlimited.
+	MaxActiveCodes uint `gorm:"column:max_active_codes; type:integer; not null; default:0"`
+
+	// IssueLimitPerMinute, IssueLimitPerHour, and IssueLimitPerDay cap the
+	// number of codes the realm may issue in each window. Any combination may
+	// be set and all are enforced. A value of 0 disables the window.
+	IssueLimitPerMinute uint `gorm:"column:issue_limit_per_minute; type:integer; not null; default:0"`
+	IssueLimitPerHour   uint `gorm:"column:issue_limit_per_hour; type:integer; not null; default:0"`
+	IssueLimitPerDay    uint `gorm:"column:issue_limit_per_day; type:integer; not null; default:0"`
+
+	// QuietHours is a comma-separated list of "HH:MM-HH:MM" windows, in the
+	// realm's timezone, during which codes are not issued. Realm admins may still
+	// issue codes. If empty, codes may be issued at any time.
+	QuietHours string `gorm:"column:quiet_hours; type:text; not null; default:''"`
+
+	// RequireIssuanceApproval issues codes pending approval. A realm admin other
+	// than the issuer must approve the code within IssuanceApprovalTimeout
+	// before it can be claimed.
+	RequireIssuanceApproval bool            `gorm:"column:require_issuance_approval; type:boolean; not null; default:false"`
+	IssuanceApprovalTimeout DurationSeconds `gorm:"column:issuance_approval_timeout; type:bigint; not null; default:0"`
+
+	// RequireDeviceBinding requires clients to send a device fingerprint when
+	// verifying a code. The token is bound to that device and cannot be claimed
+	// by a different one.
+	RequireDeviceBinding bool `gorm:"column:require_device_binding; type:boolean; not null; default:false"`
+
+	// MaxFailedClaimAttempts is the number of failed attempts to claim a code,
+	// such as claims while it is pending approval, after which the code is
+	// expired. It is also the number of claims of codes which do not exist that
+	// each device may make per day. A value of 0 means unlimited.
+	MaxFailedClaimAttempts uint `gorm:"column:max_failed_claim_attempts; type:integer; not null; default:0"`
+
+	// MinClaimIntervalSeconds is the minimum realistic time between issuing and
+	// claiming a code. Codes claimed sooner, such as by testing scripts, are
+	// still accepted but are counted as likely synthetic in the realm's stats.
+	// A value of 0 disables flagging.
+	MinClaimIntervalSeconds uint `gorm:"column:min_claim_interval_seconds; type:integer; not null; default:0"`
+
+	// ClaimLimitPerExternalID is the number of attempts per hour to claim codes
+	// issued with the same external ID, regardless of which client makes them.
+	// A value of 0 means unlimited.
+	ClaimLimitPerExternalID uint `gorm:"column:claim_limit_per_external_id; type:integer; not null; default:0"`
+
+	// AllowedClaimAppIDs is the list of app IDs that may claim codes. If empty,
+	// any app with a valid API key may claim codes. These should correspond to
+	// the AppID of the realm's registered mobile apps.
+	AllowedClaimAppIDs pq.StringArray `gorm:"column:allowed_claim_app_ids; type:varchar(512)[];"`
+
+	// AllowedClaimCountries is the list of ISO 3166-1 alpha-2 country codes from
+	// which codes are expected to be claimed. Claims located elsewhere are logged
+	// and counted, and are rejected if EnforceClaimCountries is set. Claims whose
+	// location is unknown are always allowed. If empty, the location of claims
+	// is not checked.
+	AllowedClaimCountries pq.StringArray `gorm:"column:allowed_claim_countries; type:varchar(2)[];"`
+	EnforceClaimCountries bool           `gorm:"column:enforce_claim_countries; type:boolean; not null; default:false"`
+
+	// ClaimResponseMapping renames or omits fields in the verify response, for
+	// keyservers which expect a different shape. See ParseClaimResponseMapping
+	// for the format. If empty, the default response is used.
+	ClaimResponseMapping string `gorm:"column:claim_response_mapping; type:text; not null; default:''"`
+
+	// ReportTypeMapping maps test types to the report types sent to the key
+	// server, for key servers with a different taxonomy. See
+	// ParseReportTypeMapping for the format. If empty, StandardReportTypes is
+	// used.
+	ReportTypeMapping string `gorm:"column:report_type_mapping; type:text; not null; default:''"`
+
+	// PendingApproval is true for realms which were requested through
+	// self-service onboarding and not yet approved by a system admin. Pending
+	// realms have no members, so they cannot be used. RequestedByID is the user
+	// who requested the realm, and becomes its first admin on approval.
+	PendingApproval bool   `gorm:"column:pending_approval; type:boolean; not null; default:false"`
+	RequestedByID   uint   `gorm:"column:requested_by_id; type:integer; not null; default:0"`
+	RequestReason   string `gorm:"column:request_reason; type:text; not null; default:''"`
+
 	// Signing Key Settings
 	UseRealmCertificateKey bool            `gorm:"type:boolean; default: false"`
 	CertificateIssuer      string          `gorm:"type:varchar(150); default: ''"`
@@ -279,6 +698,7 @@ func NewRealmWithDefaults(name string) *Realm {
 		AllowedTestTypes:    14,
 		CertificateDuration: FromDuration(15 * time.Minute),
 		RequireDate:         true, // Having dates is really important to risk scoring, encourage this by default true.
+		FutureDateTolerance: FromDuration(5 * time.Minute),
 	}
 }
 
@@ -315,6 +735,63 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 	r.WelcomeMessage = project.TrimSpace(r.WelcomeMessage)
 	r.WelcomeMessagePtr = stringPtr(r.WelcomeMessage)
 
+	r.IssueConfirmationMessage = project.TrimSpace(r.IssueConfirmationMessage)
+	if len(r.IssueConfirmationMessage) > maxIssueConfirmationMessageLength {
+		r.AddError("issueConfirmationMessage", fmt.Sprintf("cannot be more than %d characters", maxIssueConfirmationMessageLength))
+	}
+
+	localized, problems := r.LocalizedIssueConfirmationMessages.normalize(maxIssueConfirmationMessageLength)
+	for _, p := range problems {
+		r.AddError("localizedIssueConfirmationMessages", p)
+	}
+	for _, lang := range localized.Languages() {
+		if rawHTMLRe.MatchString(localized[lang]) {
+			r.AddError("localizedIssueConfirmationMessages", fmt.Sprintf("%q cannot contain HTML, use markdown instead", lang))
+		}
+	}
+	r.LocalizedIssueConfirmationMessages = localized
+
+	r.ClaimResponseMapping = project.TrimSpace(r.ClaimResponseMapping)
+	if _, err := ParseClaimResponseMapping(r.ClaimResponseMapping); err != nil {
+		r.AddError("claimResponseMapping", err.Error())
+	}
+
+	// Separators are not trimmed, since a space is a valid separator.
+	if utf8.RuneCountInString(r.CodeSeparators) > maxCodeSeparators {
+		r.AddError("codeSeparators", fmt.Sprintf("cannot be more than %d characters", maxCodeSeparators))
+	}
+	for _, c := range r.CodeSeparators {
+		// Stripping a character which can appear in a code could make two
+		// different entries match the same code.
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			r.AddError("codeSeparators", fmt.Sprintf("%q cannot be a separator since codes may contain it", c))
+			break
+		}
+		if !unicode.IsPrint(c) {
+			r.AddError("codeSeparators", "must be printable characters")
+			break
+		}
+	}
+
+	r.ReportTypeMapping = project.TrimSpace(r.ReportTypeMapping)
+	if _, err := ParseReportTypeMapping(r.ReportTypeMapping, r.AllowedTestTypes); err != nil {
+		r.AddError("reportTypeMapping", err.Error())
+	}
+
+	r.Timezone = project.TrimSpace(r.Timezone)
+	if r.Timezone != "" {
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			r.AddError("timezone", "must be a valid IANA timezone name")
+		}
+	}
+
+	r.LogoURL = project.TrimSpace(r.LogoURL)
+	if r.LogoURL != "" {
+		if u, err := url.Parse(r.LogoURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			r.AddError("logoURL", "must be an http or https URL")
+		}
+	}
+
 	if r.UseSystemSMSConfig && !r.CanUseSystemSMSConfig {
 		r.AddError("useSystemSMSConfig", "is not allowed on this realm")
 	}
@@ -327,6 +804,43 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		}
 	}
 
+	if r.TestDateOffsetDays > MaxTestDateOffsetDays {
+		r.AddError("testDateOffsetDays", fmt.Sprintf("must be no more than %d days", MaxTestDateOffsetDays))
+	}
+
+	if r.MaxTestBeforeSymptomDays < 0 {
+		r.AddError("maxTestBeforeSymptomDays", "cannot be negative")
+	}
+	if r.MaxTestBeforeSymptomDays > MaxTestBeforeSymptomDays {
+		r.AddError("maxTestBeforeSymptomDays", fmt.Sprintf("must be no more than %d days", MaxTestBeforeSymptomDays))
+	}
+
+	if r.FutureDateTolerance.Duration < 0 {
+		r.AddError("futureDateTolerance", "cannot be negative")
+	}
+	if r.FutureDateTolerance.Duration > MaxFutureDateTolerance {
+		r.AddError("futureDateTolerance", fmt.Sprintf("must be no more than %s", MaxFutureDateTolerance))
+	}
+
+	for i, v := range r.AllowedClaimCountries {
+		v = strings.ToUpper(project.TrimSpace(v))
+		if !countryCodeRe.MatchString(v) {
+			r.AddError("allowedClaimCountries", fmt.Sprintf("%q is not a two-letter country code", v))
+		}
+		r.AllowedClaimCountries[i] = v
+	}
+	if r.EnforceClaimCountries && len(r.AllowedClaimCountries) == 0 {
+		r.AddError("allowedClaimCountries", "cannot be blank when enforced")
+	}
+
+	if r.NegativeResultPolicy < NegativeResultAllow || r.NegativeResultPolicy > NegativeResultInformational {
+		r.AddError("negativeResultPolicy", "is not a valid policy")
+	}
+
+	if r.SMSFailurePolicy < SMSFailureFail || r.SMSFailurePolicy > SMSFailureRetry {
+		r.AddError("smsFailurePolicy", "is not a valid policy")
+	}
+
 	if r.PasswordRotationWarningDays > r.PasswordRotationPeriodDays {
 		r.AddError("passwordWarn", "may not be longer than password rotation period")
 	}
@@ -338,6 +852,85 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		r.AddError("codeDuration", "must be no more than 1 hour")
 	}
 
+	// Short codes are always issued, so disabling long codes only needs to
+	// ensure nothing depends on them.
+	if r.DisableLongCodes {
+		if r.EnableENExpress {
+			r.AddError("disableLongCodes", "cannot be enabled when using EN Express")
+		}
+		if r.DisableShortCodeClaims {
+			r.AddError("disableShortCodeClaims", "cannot be enabled when long codes are disabled")
+		}
+	}
+
+	r.DeepLinkScheme = strings.ToLower(project.TrimSpace(r.DeepLinkScheme))
+	if r.DeepLinkScheme != "" {
+		switch {
+		case !deepLinkSchemeRe.MatchString(r.DeepLinkScheme):
+			r.AddError("deepLinkScheme", "must start with a letter and contain only letters, digits, '+', '-', or '.'")
+		case r.DeepLinkScheme == "http" || r.DeepLinkScheme == "https":
+			r.AddError("deepLinkScheme", "must be a custom scheme, configure an EN Express redirect domain for https links")
+		}
+	}
+
+	r.DeepLinkHost = strings.ToLower(project.TrimSpace(r.DeepLinkHost))
+	if r.DeepLinkHost != "" && !deepLinkHostRe.MatchString(r.DeepLinkHost) {
+		r.AddError("deepLinkHost", "must contain only letters, digits, '-', or '.'")
+	}
+
+	deepLinkMetadataKeys := make([]string, 0, len(r.DeepLinkMetadataKeys))
+	seenDeepLinkMetadataKeys := make(map[string]struct{}, len(r.DeepLinkMetadataKeys))
+	for _, k := range r.DeepLinkMetadataKeys {
+		k = project.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if _, ok := seenDeepLinkMetadataKeys[k]; ok {
+			continue
+		}
+		seenDeepLinkMetadataKeys[k] = struct{}{}
+
+		switch {
+		case !ValidCodeMetadataKey(k):
+			r.AddError("deepLinkMetadataKeys", fmt.Sprintf("key %q must start with a letter and be 1-32 letters, digits, dots, underscores, or dashes", k))
+		case deepLinkPIIKeyRegexp.MatchString(k):
+			r.AddError("deepLinkMetadataKeys", fmt.Sprintf("key %q appears to hold PII and cannot be embedded in deep links", k))
+		}
+		deepLinkMetadataKeys = append(deepLinkMetadataKeys, k)
+	}
+	if len(deepLinkMetadataKeys) > MaxDeepLinkMetadataKeys {
+		r.AddError("deepLinkMetadataKeys", fmt.Sprintf("cannot have more than %d keys", MaxDeepLinkMetadataKeys))
+	}
+	if len(deepLinkMetadataKeys) > 0 && !r.UseRealmCertificateKey {
+		r.AddError("deepLinkMetadataKeys", "requires realm-specific signing keys")
+	}
+	if len(deepLinkMetadataKeys) == 0 {
+		deepLinkMetadataKeys = nil
+	}
+	r.DeepLinkMetadataKeys = deepLinkMetadataKeys
+
+	r.ClaimRedirectURL = project.TrimSpace(r.ClaimRedirectURL)
+	if r.ClaimRedirectURL != "" {
+		scheme := r.DeepLinkScheme
+		if scheme == "" {
+			scheme = DefaultDeepLinkScheme
+		}
+
+		u, err := url.Parse(r.ClaimRedirectURL)
+		switch {
+		case len(r.ClaimRedirectURL) > maxClaimRedirectURLLength:
+			r.AddError("claimRedirectURL", fmt.Sprintf("cannot be more than %d characters", maxClaimRedirectURLLength))
+		case err != nil:
+			r.AddError("claimRedirectURL", "must be a valid URL")
+		case u.Scheme == "https":
+			if u.Host == "" {
+				r.AddError("claimRedirectURL", "must include a host")
+			}
+		case u.Scheme != scheme:
+			r.AddError("claimRedirectURL", fmt.Sprintf("must be an https URL or a %s:// deep link", scheme))
+		}
+	}
+
 	if r.LongCodeLength < 12 {
 		r.AddError("longCodeLength", "must be at least 12")
 	}
@@ -345,29 +938,124 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		r.AddError("longCodeDuration", "must be no more than 24 hours")
 	}
 
-	if r.EnableENExpress {
-		if !strings.Contains(r.SMSTextTemplate, SMSENExpressLink) {
-			r.AddError("SMSTextTemplate", fmt.Sprintf("must contain %q", SMSENExpressLink))
+	if r.TokenDuration.Duration < 0 {
+		r.AddError("tokenDuration", "cannot be negative")
+	}
+	if r.TokenDuration.Duration > MaxTokenDuration {
+		r.AddError("tokenDuration", "must be no more than 14 days")
+	}
+
+	r.TokenIssuer = project.TrimSpaceAndNonPrintable(r.TokenIssuer)
+	r.TokenAudience = project.TrimSpaceAndNonPrintable(r.TokenAudience)
+	for _, claim := range []struct {
+		field string
+		value string
+	}{
+		{"tokenIssuer", r.TokenIssuer},
+		{"tokenAudience", r.TokenAudience},
+	} {
+		if len(claim.value) > maxTokenClaimLength {
+			r.AddError(claim.field, fmt.Sprintf("cannot be more than %d characters", maxTokenClaimLength))
+		}
+		if strings.IndexFunc(claim.value, unicode.IsSpace) >= 0 {
+			r.AddError(claim.field, "cannot contain whitespace")
 		}
-		if strings.Contains(r.SMSTextTemplate, SMSRegion) {
-			r.AddError("SMSTextTemplate", fmt.Sprintf("cannot contain %q - this is automatically included in %q", SMSRegion, SMSENExpressLink))
+	}
+
+	if r.RejectDuplicateExternalID {
+		if r.DuplicateExternalIDWindow.Duration <= 0 {
+			r.AddError("duplicateExternalIDWindow", "must be greater than 0")
 		}
-		if strings.Contains(r.SMSTextTemplate, SMSCode) {
-			r.AddError("SMSTextTemplate", fmt.Sprintf("cannot contain %q - the long code is automatically included in %q", SMSCode, SMSENExpressLink))
+		if r.DuplicateExternalIDWindow.Duration > maxDuplicateExternalIDWindow {
+			r.AddError("duplicateExternalIDWindow", "must be no more than 14 days")
 		}
-		if strings.Contains(r.SMSTextTemplate, SMSExpires) {
-			r.AddError("SMSTextTemplate", fmt.Sprintf("cannot contain %q - only the %q is allowed for expiration", SMSExpires, SMSLongExpires))
+	}
+
+	if r.RequireIssuanceApproval {
+		if r.IssuanceApprovalTimeout.Duration <= 0 {
+			r.AddError("issuanceApprovalTimeout", "must be greater than 0")
+		}
+		if r.IssuanceApprovalTimeout.Duration > maxIssuanceApprovalTimeout {
+			r.AddError("issuanceApprovalTimeout", "must be no more than 24 hours")
+		}
+	}
+
+	// A shorter window allowing more codes than a longer one could never be
+	// reached, which is almost certainly a mistake.
+	if r.IssueLimitPerMinute > 0 && r.IssueLimitPerHour > 0 && r.IssueLimitPerMinute > r.IssueLimitPerHour {
+		r.AddError("issueLimitPerMinute", "cannot be more than the hourly limit")
+	}
+	if r.IssueLimitPerHour > 0 && r.IssueLimitPerDay > 0 && r.IssueLimitPerHour > r.IssueLimitPerDay {
+		r.AddError("issueLimitPerHour", "cannot be more than the daily limit")
+	}
+	if r.IssueLimitPerMinute > 0 && r.IssueLimitPerDay > 0 && r.IssueLimitPerMinute > r.IssueLimitPerDay {
+		r.AddError("issueLimitPerMinute", "cannot be more than the daily limit")
+	}
+
+	if r.MaxClaimsPerCode == 0 {
+		r.MaxClaimsPerCode = 1
+	}
+	if r.MaxClaimsPerCode > MaxClaimsPerCodeLimit {
+		r.AddError("maxClaimsPerCode", fmt.Sprintf("must be no more than %d", MaxClaimsPerCodeLimit))
+	}
+
+	if r.MaxFailedClaimAttempts > MaxFailedClaimAttemptsLimit {
+		r.AddError("maxFailedClaimAttempts", fmt.Sprintf("must be no more than %d", MaxFailedClaimAttemptsLimit))
+	}
+
+	if r.MinClaimIntervalSeconds > MaxMinClaimIntervalSeconds {
+		r.AddError("minClaimIntervalSeconds", fmt.Sprintf("must be no more than %d", MaxMinClaimIntervalSeconds))
+	}
+
+	if r.MaxMetadataKeys > MaxCodeMetadataKeys {
+		r.AddError("maxMetadataKeys", fmt.Sprintf("must be no more than %d", MaxCodeMetadataKeys))
+	}
+	if r.MaxMetadataBytes > MaxCodeMetadataSize {
+		r.AddError("maxMetadataBytes", fmt.Sprintf("must be no more than %d", MaxCodeMetadataSize))
+	}
+	if r.MaxExternalIDLength > MaxIssuingExternalIDLength {
+		r.AddError("maxExternalIDLength", fmt.Sprintf("must be no more than %d", MaxIssuingExternalIDLength))
+	}
+
+	r.ExternalIDFormat = strings.TrimSpace(r.ExternalIDFormat)
+	if r.ExternalIDFormat != "" {
+		if len(r.ExternalIDFormat) > maxExternalIDFormatLength {
+			r.AddError("externalIDFormat", fmt.Sprintf("must be no more than %d characters", maxExternalIDFormatLength))
+		} else if _, err := regexp.Compile(r.ExternalIDFormat); err != nil {
+			r.AddError("externalIDFormat", fmt.Sprintf("is not a valid regular expression: %v", err))
 		}
-		if strings.Contains(r.SMSTextTemplate, SMSLongCode) {
-			r.AddError("SMSTextTemplate", fmt.Sprintf("cannot contain %q - the long code is automatically included in %q", SMSLongCode, SMSENExpressLink))
+		if !r.RequireExternalID {
+			r.AddError("externalIDFormat", "requires external IDs to be required")
 		}
+	}
+
+	if r.ClaimLimitPerExternalID > MaxClaimLimitPerExternalID {
+		r.AddError("claimLimitPerExternalID", fmt.Sprintf("must be no more than %d", MaxClaimLimitPerExternalID))
+	}
 
+	if windows, err := ParseQuietHours(r.QuietHours); err != nil {
+		r.AddError("quietHours", err.Error())
 	} else {
-		// Check that we have exactly one of [code] or [longcode] as template substitutions.
-		if c, lc := strings.Contains(r.SMSTextTemplate, "[code]"), strings.Contains(r.SMSTextTemplate, "[longcode]"); !(c || lc) || (c && lc) {
-			r.AddError("SMSTextTemplate", "must contain exactly one of [code] or [longcode]")
+		r.QuietHours = formatQuietHours(windows)
+	}
+
+	if len(r.SMSTextTemplate) > maxSMSTextTemplateLength {
+		r.AddError("SMSTextTemplate", fmt.Sprintf("cannot be more than %d characters", maxSMSTextTemplateLength))
+	}
+	for _, p := range r.smsTextTemplateProblems(r.SMSTextTemplate) {
+		r.AddError("SMSTextTemplate", p)
+	}
+
+	smsTemplates, problems := r.SMSTextTemplates.normalize(maxSMSTextTemplateLength)
+	for _, p := range problems {
+		r.AddError("smsTextTemplates", p)
+	}
+	for _, lang := range smsTemplates.Languages() {
+		for _, p := range r.smsTextTemplateProblems(smsTemplates[lang]) {
+			r.AddError("smsTextTemplates", fmt.Sprintf("%q %s", lang, p))
 		}
 	}
+	r.SMSTextTemplates = smsTemplates
 
 	if r.UseSystemEmailConfig && !r.CanUseSystemEmailConfig {
 		r.AddError("useSystemEmailConfig", "is not allowed on this realm")
@@ -391,6 +1079,30 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 		}
 	}
 
+	r.EmailCodeTemplate = strings.TrimSpace(r.EmailCodeTemplate)
+	if r.EnableEmailCodes && r.EmailCodeTemplate == "" {
+		r.AddError("emailCodeTemplate", "cannot be blank when email codes are enabled")
+	}
+	if r.EmailCodeTemplate != "" {
+		if len(r.EmailCodeTemplate) > maxEmailCodeTemplateLength {
+			r.AddError("emailCodeTemplate", fmt.Sprintf("cannot be more than %d characters", maxEmailCodeTemplateLength))
+		}
+		for _, p := range r.smsTextTemplateProblems(r.EmailCodeTemplate) {
+			r.AddError("emailCodeTemplate", p)
+		}
+	}
+
+	emailCodeTemplates, problems := r.EmailCodeTemplates.normalize(maxEmailCodeTemplateLength)
+	for _, p := range problems {
+		r.AddError("emailCodeTemplates", p)
+	}
+	for _, lang := range emailCodeTemplates.Languages() {
+		for _, p := range r.smsTextTemplateProblems(emailCodeTemplates[lang]) {
+			r.AddError("emailCodeTemplates", fmt.Sprintf("%q %s", lang, p))
+		}
+	}
+	r.EmailCodeTemplates = emailCodeTemplates
+
 	r.CertificateIssuer = project.TrimSpaceAndNonPrintable(r.CertificateIssuer)
 	r.CertificateAudience = project.TrimSpaceAndNonPrintable(r.CertificateAudience)
 	if r.UseRealmCertificateKey {
@@ -414,6 +1126,20 @@ func (r *Realm) BeforeSave(tx *gorm.DB) error {
 	return nil
 }
 
+// Location returns the time location for the realm's configured timezone. If
+// no timezone is configured, or the timezone is invalid, it returns UTC.
+func (r *Realm) Location() *time.Location {
+	if r == nil || r.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(r.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 // GetCodeDurationMinutes is a helper for the HTML rendering to get a round
 // minutes value.
 func (r *Realm) GetCodeDurationMinutes() int {
@@ -426,6 +1152,173 @@ func (r *Realm) GetLongCodeDurationHours() int {
 	return int(r.LongCodeDuration.Duration.Hours())
 }
 
+// GetDuplicateExternalIDWindowHours is a helper for the HTML rendering to get
+// a round hours value.
+func (r *Realm) GetDuplicateExternalIDWindowHours() int {
+	return int(r.DuplicateExternalIDWindow.Duration.Hours())
+}
+
+// GetFutureDateToleranceMinutes is a helper for the HTML rendering to get the
+// future date tolerance in minutes.
+func (r *Realm) GetFutureDateToleranceMinutes() int {
+	return int(r.FutureDateTolerance.Duration.Minutes())
+}
+
+// MaxIssueDate returns the latest symptom or test date, as midnight UTC, which
+// may be given when issuing a code at now. Clients whose clock is ahead by up
+// to FutureDateTolerance may give the next day once it has started for them.
+func (r *Realm) MaxIssueDate(now time.Time) time.Time {
+	return timeutils.UTCMidnight(now.Add(r.FutureDateTolerance.Duration))
+}
+
+// GetTokenDurationHours is a helper for the HTML rendering to get a round
+// hours value.
+func (r *Realm) GetTokenDurationHours() int {
+	return int(r.TokenDuration.Duration.Hours())
+}
+
+// EffectiveTokenDuration returns how long verification tokens for the realm are
+// valid, given the server's default.
+func (r *Realm) EffectiveTokenDuration(defaultDuration time.Duration) time.Duration {
+	if r.TokenDuration.Duration > 0 {
+		return r.TokenDuration.Duration
+	}
+	return defaultDuration
+}
+
+// EffectivePasswordRotation returns the password rotation period and warning,
+// in days, for users of the realm. If the realm does not require rotation, the
+// server's defaults are used.
+func (r *Realm) EffectivePasswordRotation(defaultPeriodDays, defaultWarningDays uint) (uint, uint) {
+	if r.PasswordRotationPeriodDays > 0 {
+		return r.PasswordRotationPeriodDays, r.PasswordRotationWarningDays
+	}
+	return defaultPeriodDays, defaultWarningDays
+}
+
+// EffectiveTokenIssuer returns the iss claim of verification tokens for the
+// realm, given the server's default.
+func (r *Realm) EffectiveTokenIssuer(defaultIssuer string) string {
+	if r.TokenIssuer != "" {
+		return r.TokenIssuer
+	}
+	return defaultIssuer
+}
+
+// EffectiveTokenAudience returns the aud claim of verification tokens for the
+// realm, given the server's default.
+func (r *Realm) EffectiveTokenAudience(defaultAudience string) string {
+	if r.TokenAudience != "" {
+		return r.TokenAudience
+	}
+	return defaultAudience
+}
+
+// GetIssuanceApprovalTimeoutHours is a helper for the HTML rendering to get a
+// round hours value.
+func (r *Realm) GetIssuanceApprovalTimeoutHours() int {
+	return int(r.IssuanceApprovalTimeout.Duration.Hours())
+}
+
+// IssueRateWindows returns the realm's configured issuance rate limit windows,
+// shortest first.
+func (r *Realm) IssueRateWindows() []*ratelimit.Window {
+	windows := make([]*ratelimit.Window, 0, 3)
+	if r.IssueLimitPerMinute > 0 {
+		windows = append(windows, &ratelimit.Window{Name: "minute", Interval: time.Minute, Limit: uint64(r.IssueLimitPerMinute)})
+	}
+	if r.IssueLimitPerHour > 0 {
+		windows = append(windows, &ratelimit.Window{Name: "hour", Interval: time.Hour, Limit: uint64(r.IssueLimitPerHour)})
+	}
+	if r.IssueLimitPerDay > 0 {
+		windows = append(windows, &ratelimit.Window{Name: "day", Interval: 24 * time.Hour, Limit: uint64(r.IssueLimitPerDay)})
+	}
+	return windows
+}
+
+// MetadataLimits returns the realm's limits on the number of keys and the
+// encoded size of code metadata, given the server's limits.
+func (r *Realm) MetadataLimits(maxKeys, maxSize uint) (uint, uint) {
+	return lowerLimit(r.MaxMetadataKeys, maxKeys), lowerLimit(r.MaxMetadataBytes, maxSize)
+}
+
+// ExternalIDMatchesFormat returns true if id matches the realm's external ID
+// format in full, or if the realm has no format.
+func (r *Realm) ExternalIDMatchesFormat(id string) bool {
+	if r.ExternalIDFormat == "" {
+		return true
+	}
+	re, err := regexp.Compile(`^(?:` + r.ExternalIDFormat + `)$`)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(id)
+}
+
+// ExternalIDLengthLimit returns the realm's limit on the length of external
+// issuer IDs, given the server's limit.
+func (r *Realm) ExternalIDLengthLimit(max uint) uint {
+	return lowerLimit(r.MaxExternalIDLength, max)
+}
+
+// lowerLimit returns the realm's limit if it is set and lower than the
+// server's limit, otherwise the server's limit.
+func lowerLimit(realm, server uint) uint {
+	if realm > 0 && realm < server {
+		return realm
+	}
+	return server
+}
+
+// ExternalIDClaimWindows returns the rate limit windows for claims of codes
+// with the same external ID, or nil if the realm does not limit them.
+func (r *Realm) ExternalIDClaimWindows() []*ratelimit.Window {
+	if r.ClaimLimitPerExternalID == 0 {
+		return nil
+	}
+	return []*ratelimit.Window{
+		{Name: "hour", Interval: time.Hour, Limit: uint64(r.ClaimLimitPerExternalID)},
+	}
+}
+
+// FailedClaimWindows returns the rate limit windows for claims of codes which
+// do not exist, counted per device, or nil if the realm does not limit failed
+// claims.
+func (r *Realm) FailedClaimWindows() []*ratelimit.Window {
+	if r.MaxFailedClaimAttempts == 0 {
+		return nil
+	}
+	return []*ratelimit.Window{
+		{Name: "day", Interval: 24 * time.Hour, Limit: uint64(r.MaxFailedClaimAttempts)},
+	}
+}
+
+// ListPendingApprovalCodes lists the codes in the realm which are waiting for
+// approval, oldest first.
+func (r *Realm) ListPendingApprovalCodes(db *Database, p *pagination.PageParams) ([]*VerificationCode, *pagination.Paginator, error) {
+	var codes []*VerificationCode
+	query := db.db.
+		Model(&VerificationCode{}).
+		Where("realm_id = ?", r.ID).
+		Where("approval_status = ?", ApprovalStatusPending).
+		Where("approval_expires_at > ?", time.Now().UTC()).
+		Order("created_at ASC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &codes, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return codes, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return codes, paginator, nil
+}
+
 // FindVerificationCodeByUUID find a verification codes by UUID.
 func (r *Realm) FindVerificationCodeByUUID(db *Database, uuid string) (*VerificationCode, error) {
 	var vc VerificationCode
@@ -437,20 +1330,153 @@ func (r *Realm) FindVerificationCodeByUUID(db *Database, uuid string) (*Verifica
 	return &vc, nil
 }
 
-// BuildSMSText replaces certain strings with the right values.
-func (r *Realm) BuildSMSText(code, longCode string, enxDomain string) string {
-	text := r.SMSTextTemplate
+// HasRecentCodeForExternalID returns true if a code was issued in this realm
+// with the given external issuer ID within the realm's duplicate external ID
+// window.
+func (r *Realm) HasRecentCodeForExternalID(db *Database, externalID string) (bool, error) {
+	since := time.Now().UTC().Add(-1 * r.DuplicateExternalIDWindow.Duration)
+
+	var count int64
+	if err := db.db.
+		Model(&VerificationCode{}).
+		Where("realm_id = ? AND issuing_external_id = ? AND created_at >= ?", r.ID, externalID, since).
+		Count(&count).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CountCodesForExternalID returns the number of codes that have been issued in
+// this realm with the given external issuer ID.
+func (r *Realm) CountCodesForExternalID(db *Database, externalID string) (uint, error) {
+	var count uint
+	if err := db.db.
+		Model(&VerificationCode{}).
+		Where("realm_id = ? AND issuing_external_id = ?", r.ID, externalID).
+		Count(&count).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountActiveCodes returns the number of codes in this realm that are neither
+// expired nor claimed.
+func (r *Realm) CountActiveCodes(db *Database) (uint, error) {
+	now := time.Now().UTC()
 
+	var count uint
+	if err := db.db.
+		Model(&VerificationCode{}).
+		Where("realm_id = ? AND claimed = ?", r.ID, false).
+		Where("(expires_at > ? OR long_expires_at > ?)", now, now).
+		Count(&count).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeepLinkBase returns the scheme and host of the realm's deep link, such as
+// "ens://v".
+func (r *Realm) DeepLinkBase() string {
+	scheme, host := r.DeepLinkScheme, r.DeepLinkHost
+	if scheme == "" {
+		scheme = DefaultDeepLinkScheme
+	}
+	if host == "" {
+		host = DefaultDeepLinkHost
+	}
+	return scheme + "://" + host
+}
+
+// ENExpressLink returns the deep link that opens the exposure notifications
+// app and fills in the given code.
+func (r *Realm) ENExpressLink(code, enxDomain string) string {
 	if enxDomain == "" {
 		// preserves legacy behavior.
-		text = strings.ReplaceAll(text, SMSENExpressLink, fmt.Sprintf("ens://v?r=%s&c=%s", SMSRegion, SMSLongCode))
+		return fmt.Sprintf("%s?r=%s&c=%s", r.DeepLinkBase(), r.RegionCode, code)
+	}
+	return fmt.Sprintf("https://%s.%s/v?c=%s",
+		strings.ToLower(r.RegionCode),
+		enxDomain,
+		code)
+}
+
+// DeepLinkMetadata returns the entries of the code metadata which the realm
+// embeds in deep links, or nil if there are none.
+func (r *Realm) DeepLinkMetadata(m CodeMetadata) CodeMetadata {
+	return m.Select(r.DeepLinkMetadataKeys)
+}
+
+// smsTextTemplateProblems returns the reasons the SMS template is invalid for
+// the realm's code settings, if any.
+func (r *Realm) smsTextTemplateProblems(tmpl string) []string {
+	var problems []string
+	if r.DisableLongCodes {
+		if strings.Contains(tmpl, SMSLongCode) || strings.Contains(tmpl, SMSLongExpires) {
+			problems = append(problems, fmt.Sprintf("cannot contain %q or %q when long codes are disabled", SMSLongCode, SMSLongExpires))
+		}
+	}
+
+	if r.EnableENExpress {
+		if !strings.Contains(tmpl, SMSENExpressLink) {
+			problems = append(problems, fmt.Sprintf("must contain %q", SMSENExpressLink))
+		}
+		if strings.Contains(tmpl, SMSRegion) {
+			problems = append(problems, fmt.Sprintf("cannot contain %q - this is automatically included in %q", SMSRegion, SMSENExpressLink))
+		}
+		if strings.Contains(tmpl, SMSCode) {
+			problems = append(problems, fmt.Sprintf("cannot contain %q - the long code is automatically included in %q", SMSCode, SMSENExpressLink))
+		}
+		if strings.Contains(tmpl, SMSExpires) {
+			problems = append(problems, fmt.Sprintf("cannot contain %q - only the %q is allowed for expiration", SMSExpires, SMSLongExpires))
+		}
+		if strings.Contains(tmpl, SMSLongCode) {
+			problems = append(problems, fmt.Sprintf("cannot contain %q - the long code is automatically included in %q", SMSLongCode, SMSENExpressLink))
+		}
 	} else {
-		text = strings.ReplaceAll(text, SMSENExpressLink,
-			fmt.Sprintf("https://%s.%s/v?c=%s",
-				strings.ToLower(r.RegionCode),
-				enxDomain,
-				SMSLongCode))
+		// Check that we have exactly one of [code] or [longcode] as template substitutions.
+		if c, lc := strings.Contains(tmpl, SMSCode), strings.Contains(tmpl, SMSLongCode); !(c || lc) || (c && lc) {
+			problems = append(problems, "must contain exactly one of [code] or [longcode]")
+		}
 	}
+	return problems
+}
+
+// SMSTextTemplateFor returns the SMS template for the first of the given
+// locales which matches a translation, falling back to SMSTextTemplate.
+func (r *Realm) SMSTextTemplateFor(locales ...string) string {
+	if tmpl, ok := r.SMSTextTemplates.Lookup(locales...); ok {
+		return tmpl
+	}
+	return r.SMSTextTemplate
+}
+
+// BuildSMSText replaces certain strings with the right values.
+func (r *Realm) BuildSMSText(code, longCode string, enxDomain string) string {
+	return r.buildSMSText(r.SMSTextTemplate, code, longCode, enxDomain)
+}
+
+// BuildLocalizedSMSText is like BuildSMSText, but uses the template for the
+// given locale. If the realm has no template for the locale, the default
+// template is used.
+func (r *Realm) BuildLocalizedSMSText(locale, code, longCode, enxDomain string) string {
+	return r.buildSMSText(r.SMSTextTemplateFor(locale), code, longCode, enxDomain)
+}
+
+func (r *Realm) buildSMSText(text, code, longCode, enxDomain string) string {
+	text = strings.ReplaceAll(text, SMSENExpressLink, r.ENExpressLink(SMSLongCode, enxDomain))
 	text = strings.ReplaceAll(text, SMSRegion, r.RegionCode)
 	text = strings.ReplaceAll(text, SMSCode, code)
 	text = strings.ReplaceAll(text, SMSExpires, fmt.Sprintf("%d", r.GetCodeDurationMinutes()))
@@ -460,6 +1486,23 @@ func (r *Realm) BuildSMSText(code, longCode string, enxDomain string) string {
 	return text
 }
 
+// EmailCodeTemplateFor returns the email code template for the first of the
+// given locales which matches a translation, falling back to
+// EmailCodeTemplate.
+func (r *Realm) EmailCodeTemplateFor(locales ...string) string {
+	if tmpl, ok := r.EmailCodeTemplates.Lookup(locales...); ok {
+		return tmpl
+	}
+	return r.EmailCodeTemplate
+}
+
+// BuildLocalizedEmailCodeText builds the body of an email containing the
+// issued code, using the email code template for the given locale. It has the
+// same substitutions as the SMS text.
+func (r *Realm) BuildLocalizedEmailCodeText(locale, code, longCode, enxDomain string) string {
+	return r.buildSMSText(r.EmailCodeTemplateFor(locale), code, longCode, enxDomain)
+}
+
 // BuildInviteEmail replaces certain strings with the right values for invitations.
 func (r *Realm) BuildInviteEmail(inviteLink string) string {
 	text := r.EmailInviteTemplate
@@ -734,6 +1777,43 @@ func (r *Realm) FindAuthorizedApp(db *Database, id interface{}) (*AuthorizedApp,
 	return &app, nil
 }
 
+// MobileAppIDs returns the AppID of each of the realm's mobile apps which have
+// not been deleted, sorted.
+func (r *Realm) MobileAppIDs(db *Database) ([]string, error) {
+	var appIDs []string
+	if err := db.db.
+		Model(&MobileApp{}).
+		Where("realm_id = ?", r.ID).
+		Order("app_id").
+		Pluck("app_id", &appIDs).
+		Error; err != nil {
+		return nil, err
+	}
+	return appIDs, nil
+}
+
+// MinAppVersions returns the minimum supported version of each of the realm's
+// mobile apps which have not been deleted and have one configured, keyed by
+// AppID.
+func (r *Realm) MinAppVersions(db *Database) (map[string]string, error) {
+	var apps []*MobileApp
+	if err := db.db.
+		Model(&MobileApp{}).
+		Where("realm_id = ?", r.ID).
+		Where("min_version <> ''").
+		Select("app_id, min_version").
+		Find(&apps).
+		Error; err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]string, len(apps))
+	for _, app := range apps {
+		versions[app.AppID] = app.MinVersion
+	}
+	return versions, nil
+}
+
 // ListMobileApps gets all the mobile apps for the realm.
 func (r *Realm) ListMobileApps(db *Database, p *pagination.PageParams, scopes ...Scope) ([]*MobileApp, *pagination.Paginator, error) {
 	var mobileApps []*MobileApp
@@ -783,6 +1863,23 @@ func (r *Realm) ListUsers(db *Database, p *pagination.PageParams, scopes ...Scop
 	return db.ListUsers(p, scopes...)
 }
 
+// AdminEmails returns the email addresses of the realm's admins, sorted.
+func (r *Realm) AdminEmails(db *Database) ([]string, error) {
+	var emails []string
+	if err := db.db.
+		Model(&User{}).
+		Joins("INNER JOIN admin_realms ON admin_realms.user_id = users.id AND admin_realms.realm_id = ?", r.ID).
+		Order("users.email").
+		Pluck("users.email", &emails).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return emails, nil
+		}
+		return nil, err
+	}
+	return emails, nil
+}
+
 // FindUser finds the given user in the realm by ID.
 func (r *Realm) FindUser(db *Database, id interface{}) (*User, error) {
 	var user User
@@ -796,6 +1893,21 @@ func (r *Realm) FindUser(db *Database, id interface{}) (*User, error) {
 	return &user, nil
 }
 
+// ClaimCountryAllowed returns true if codes are expected to be claimed from the
+// given country. If the realm has no allowed claim countries, every country is
+// allowed.
+func (r *Realm) ClaimCountryAllowed(country string) bool {
+	if len(r.AllowedClaimCountries) == 0 {
+		return true
+	}
+	for _, v := range r.AllowedClaimCountries {
+		if strings.EqualFold(v, country) {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidTestType returns true if the given test type string is valid for this
 // realm, false otherwise.
 func (r *Realm) ValidTestType(typ string) bool {
@@ -811,6 +1923,62 @@ func (r *Realm) ValidTestType(typ string) bool {
 	}
 }
 
+// AutofillDateOrderViolated returns true if the realm autofills the test date
+// and the test date is before the symptom date. Staff may override the
+// autofilled value, but not in a way that breaks that relationship. It is false
+// if either date is missing.
+func (r *Realm) AutofillDateOrderViolated(symptomDate, testDate *time.Time) bool {
+	if !r.AutofillTestDate || symptomDate == nil || testDate == nil {
+		return false
+	}
+	return testDate.Before(*symptomDate)
+}
+
+// DateOrderViolated returns true if the realm enforces the date order and the
+// test date is more than MaxTestBeforeSymptomDays before the symptom date. It
+// is false if either date is missing.
+func (r *Realm) DateOrderViolated(symptomDate, testDate *time.Time) bool {
+	if !r.EnforceDateOrder || symptomDate == nil || testDate == nil {
+		return false
+	}
+	earliest := symptomDate.AddDate(0, 0, -r.MaxTestBeforeSymptomDays)
+	return testDate.Before(earliest)
+}
+
+// TestTypeSunset returns the time after which codes can no longer be issued for
+// the given test type string, or nil if there is none.
+func (r *Realm) TestTypeSunset(typ string) *time.Time {
+	switch project.TrimSpace(strings.ToLower(typ)) {
+	case "confirmed":
+		return r.ConfirmedSunsetAt
+	case "likely":
+		return r.LikelySunsetAt
+	case "negative":
+		return r.NegativeSunsetAt
+	default:
+		return nil
+	}
+}
+
+// TestTypeSunsetPassed returns true if the given test type string has a sunset
+// at or before now.
+func (r *Realm) TestTypeSunsetPassed(typ string, now time.Time) bool {
+	sunset := r.TestTypeSunset(typ)
+	return sunset != nil && !now.Before(*sunset)
+}
+
+// UpcomingTestTypeSunsets returns the names of allowed test types with a
+// sunset after now, mapped to the sunset time.
+func (r *Realm) UpcomingTestTypeSunsets(now time.Time) map[string]time.Time {
+	sunsets := make(map[string]time.Time, 3)
+	for _, typ := range r.AllowedTestTypes.Names() {
+		if sunset := r.TestTypeSunset(typ); sunset != nil && now.Before(*sunset) {
+			sunsets[typ] = *sunset
+		}
+	}
+	return sunsets
+}
+
 func (db *Database) CreateRealm(name string) (*Realm, error) {
 	realm := NewRealmWithDefaults(name)
 
@@ -823,7 +1991,11 @@ func (db *Database) CreateRealm(name string) (*Realm, error) {
 func (db *Database) FindRealmByRegion(region string) (*Realm, error) {
 	var realm Realm
 
-	if err := db.db.Where("region_code = ?", strings.ToUpper(region)).First(&realm).Error; err != nil {
+	if err := db.db.
+		Where("region_code = ?", strings.ToUpper(region)).
+		Order("id ASC").
+		First(&realm).
+		Error; err != nil {
 		return nil, err
 	}
 	return &realm, nil
@@ -880,6 +2052,34 @@ func (r *Realm) AuditDisplay() string {
 	return r.Name
 }
 
+// regionCodeUniqueIndex is the partial unique index which keeps region codes
+// unique, unless the deployment opted out when it was migrated.
+const regionCodeUniqueIndex = "uix_realms_region_code"
+
+// isRegionCodeConflict returns true if the error is a violation of the unique
+// region code index.
+func isRegionCodeConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == regionCodeUniqueIndex
+}
+
+// relaxRegionCodeUniqueness replaces the unique region code index with a plain
+// index, so that several realms can share a region code.
+func relaxRegionCodeUniqueness(tx *gorm.DB) error {
+	sqls := []string{
+		`ALTER TABLE realms DROP CONSTRAINT IF EXISTS ` + regionCodeUniqueIndex,
+		`DROP INDEX IF EXISTS ` + regionCodeUniqueIndex,
+		`CREATE INDEX IF NOT EXISTS idx_realms_region_code ON realms (region_code)`,
+	}
+
+	for _, sql := range sqls {
+		if err := tx.Exec(sql).Error; err != nil {
+			return fmt.Errorf("failed to relax region code uniqueness: %w", err)
+		}
+	}
+	return nil
+}
+
 func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 	if r == nil {
 		return fmt.Errorf("provided realm is nil")
@@ -901,16 +2101,69 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 			return fmt.Errorf("failed to get existing realm")
 		}
 
+		// Region codes are unique unless the deployment opts out, since some
+		// deployments have multiple realms per region. The unique index is what
+		// enforces it; checking first reports the conflict with the other errors.
+		// Deleted realms keep their region code, so they are included.
+		if regionCode := project.TrimSpace(r.RegionCode); db.config.EnforceUniqueRegionCodes && regionCode != "" {
+			var count int64
+			if err := tx.
+				Unscoped().
+				Model(&Realm{}).
+				Where("region_code = ?", strings.ToUpper(regionCode)).
+				Where("id != ?", r.ID).
+				Count(&count).
+				Error; err != nil {
+				return fmt.Errorf("failed to check region code: %w", err)
+			}
+			if count > 0 {
+				r.AddError("regionCode", "is already in use by another realm")
+				return fmt.Errorf("realm validation failed: %s", strings.Join(r.ErrorMessages(), ", "))
+			}
+		}
+
+		// Sunsets which passed are kept, but new or changed sunsets must be in the
+		// future.
+		now := time.Now()
+		for _, sunset := range []struct {
+			field         string
+			new, existing *time.Time
+		}{
+			{"confirmedSunsetAt", r.ConfirmedSunsetAt, existing.ConfirmedSunsetAt},
+			{"likelySunsetAt", r.LikelySunsetAt, existing.LikelySunsetAt},
+			{"negativeSunsetAt", r.NegativeSunsetAt, existing.NegativeSunsetAt},
+		} {
+			if sunset.new != nil && !timePtrEqual(sunset.new, sunset.existing) && !sunset.new.After(now) {
+				r.AddError(sunset.field, "must be in the future")
+			}
+		}
+		if len(r.ErrorMessages()) > 0 {
+			return fmt.Errorf("realm validation failed: %s", strings.Join(r.ErrorMessages(), ", "))
+		}
+
 		// Save the realm
 		if err := tx.Save(r).Error; err != nil {
+			if isRegionCodeConflict(err) {
+				r.AddError("regionCode", "is already in use by another realm")
+				return fmt.Errorf("realm validation failed: %s", strings.Join(r.ErrorMessages(), ", "))
+			}
 			return fmt.Errorf("failed to save realm: %w", err)
 		}
 
 		// Brand new realm?
 		if existing.ID == 0 {
-			audit := BuildAuditEntry(actor, "created realm", r, r.ID)
+			action := "created realm"
+			if r.PendingApproval {
+				action = "requested realm"
+			}
+			audit := BuildAuditEntry(actor, action, r, r.ID)
 			audits = append(audits, audit)
 		} else {
+			if existing.PendingApproval && !r.PendingApproval {
+				audit := BuildAuditEntry(actor, "approved realm request", r, r.ID)
+				audits = append(audits, audit)
+			}
+
 			if existing.Name != r.Name {
 				audit := BuildAuditEntry(actor, "updated realm name", r, r.ID)
 				audit.Diff = stringDiff(existing.Name, r.Name)
@@ -929,6 +2182,30 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.IssueConfirmationMessage != r.IssueConfirmationMessage {
+				audit := BuildAuditEntry(actor, "updated issue confirmation message", r, r.ID)
+				audit.Diff = stringDiff(existing.IssueConfirmationMessage, r.IssueConfirmationMessage)
+				audits = append(audits, audit)
+			}
+
+			if existing.LocalizedIssueConfirmationMessages.String() != r.LocalizedIssueConfirmationMessages.String() {
+				audit := BuildAuditEntry(actor, "updated localized issue confirmation messages", r, r.ID)
+				audit.Diff = stringDiff(existing.LocalizedIssueConfirmationMessages.String(), r.LocalizedIssueConfirmationMessages.String())
+				audits = append(audits, audit)
+			}
+
+			if existing.Timezone != r.Timezone {
+				audit := BuildAuditEntry(actor, "updated timezone", r, r.ID)
+				audit.Diff = stringDiff(existing.Timezone, r.Timezone)
+				audits = append(audits, audit)
+			}
+
+			if existing.LogoURL != r.LogoURL {
+				audit := BuildAuditEntry(actor, "updated logo", r, r.ID)
+				audit.Diff = stringDiff(existing.LogoURL, r.LogoURL)
+				audits = append(audits, audit)
+			}
+
 			if existing.CodeLength != r.CodeLength {
 				audit := BuildAuditEntry(actor, "updated code length", r, r.ID)
 				audit.Diff = uintDiff(existing.CodeLength, r.CodeLength)
@@ -953,12 +2230,36 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.TokenDuration != r.TokenDuration {
+				audit := BuildAuditEntry(actor, "updated token duration", r, r.ID)
+				audit.Diff = stringDiff(existing.TokenDuration.AsString, r.TokenDuration.AsString)
+				audits = append(audits, audit)
+			}
+
+			if existing.TokenIssuer != r.TokenIssuer {
+				audit := BuildAuditEntry(actor, "updated token issuer", r, r.ID)
+				audit.Diff = stringDiff(existing.TokenIssuer, r.TokenIssuer)
+				audits = append(audits, audit)
+			}
+
+			if existing.TokenAudience != r.TokenAudience {
+				audit := BuildAuditEntry(actor, "updated token audience", r, r.ID)
+				audit.Diff = stringDiff(existing.TokenAudience, r.TokenAudience)
+				audits = append(audits, audit)
+			}
+
 			if existing.SMSTextTemplate != r.SMSTextTemplate {
 				audit := BuildAuditEntry(actor, "updated SMS template", r, r.ID)
 				audit.Diff = stringDiff(existing.SMSTextTemplate, r.SMSTextTemplate)
 				audits = append(audits, audit)
 			}
 
+			if existing.SMSTextTemplates.String() != r.SMSTextTemplates.String() {
+				audit := BuildAuditEntry(actor, "updated localized SMS templates", r, r.ID)
+				audit.Diff = stringDiff(existing.SMSTextTemplates.String(), r.SMSTextTemplates.String())
+				audits = append(audits, audit)
+			}
+
 			if existing.SMSCountry != r.SMSCountry {
 				audit := BuildAuditEntry(actor, "updated SMS country", r, r.ID)
 				audit.Diff = stringDiff(existing.SMSCountry, r.SMSCountry)
@@ -995,6 +2296,24 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 				audits = append(audits, audit)
 			}
 
+			if existing.EnableEmailCodes != r.EnableEmailCodes {
+				audit := BuildAuditEntry(actor, "updated enable email codes", r, r.ID)
+				audit.Diff = boolDiff(existing.EnableEmailCodes, r.EnableEmailCodes)
+				audits = append(audits, audit)
+			}
+
+			if existing.EmailCodeTemplate != r.EmailCodeTemplate {
+				audit := BuildAuditEntry(actor, "updated email code template", r, r.ID)
+				audit.Diff = stringDiff(existing.EmailCodeTemplate, r.EmailCodeTemplate)
+				audits = append(audits, audit)
+			}
+
+			if existing.EmailCodeTemplates.String() != r.EmailCodeTemplates.String() {
+				audit := BuildAuditEntry(actor, "updated localized email code templates", r, r.ID)
+				audit.Diff = stringDiff(existing.EmailCodeTemplates.String(), r.EmailCodeTemplates.String())
+				audits = append(audits, audit)
+			}
+
 			if existing.CanUseSystemEmailConfig != r.CanUseSystemEmailConfig {
 				audit := BuildAuditEntry(actor, "updated ability to use system email config", r, r.ID)
 				audit.Diff = boolDiff(existing.CanUseSystemEmailConfig, r.CanUseSystemEmailConfig)
@@ -1039,18 +2358,312 @@ func (db *Database) SaveRealm(r *Realm, actor Auditable) error {
 
 			// TODO(sethvargo): diff allowed CIDRs
 
+			if a, b := strings.Join(existing.AllowedCIDRsIssue, ", "), strings.Join(r.AllowedCIDRsIssue, ", "); a != b {
+				audit := BuildAuditEntry(actor, "updated allowed issuing CIDRs", r, r.ID)
+				audit.Diff = stringDiff(a, b)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxConcurrentAPIKeyRequests != r.MaxConcurrentAPIKeyRequests {
+				audit := BuildAuditEntry(actor, "updated max concurrent API key requests", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxConcurrentAPIKeyRequests, r.MaxConcurrentAPIKeyRequests)
+				audits = append(audits, audit)
+			}
+
+			if existing.KioskMode != r.KioskMode {
+				audit := BuildAuditEntry(actor, "updated kiosk mode", r, r.ID)
+				audit.Diff = boolDiff(existing.KioskMode, r.KioskMode)
+				audits = append(audits, audit)
+			}
+
+			if existing.SignCertificateResponses != r.SignCertificateResponses {
+				audit := BuildAuditEntry(actor, "updated sign certificate responses", r, r.ID)
+				audit.Diff = boolDiff(existing.SignCertificateResponses, r.SignCertificateResponses)
+				audits = append(audits, audit)
+			}
+
 			if existing.AllowedTestTypes != r.AllowedTestTypes {
 				audit := BuildAuditEntry(actor, "updated allowed test types", r, r.ID)
 				audit.Diff = stringDiff(existing.AllowedTestTypes.Display(), r.AllowedTestTypes.Display())
 				audits = append(audits, audit)
 			}
 
+			if !timePtrEqual(existing.ConfirmedSunsetAt, r.ConfirmedSunsetAt) {
+				audit := BuildAuditEntry(actor, "updated confirmed test sunset", r, r.ID)
+				audit.Diff = timePtrDiff(existing.ConfirmedSunsetAt, r.ConfirmedSunsetAt)
+				audits = append(audits, audit)
+			}
+
+			if !timePtrEqual(existing.LikelySunsetAt, r.LikelySunsetAt) {
+				audit := BuildAuditEntry(actor, "updated likely test sunset", r, r.ID)
+				audit.Diff = timePtrDiff(existing.LikelySunsetAt, r.LikelySunsetAt)
+				audits = append(audits, audit)
+			}
+
+			if !timePtrEqual(existing.NegativeSunsetAt, r.NegativeSunsetAt) {
+				audit := BuildAuditEntry(actor, "updated negative test sunset", r, r.ID)
+				audit.Diff = timePtrDiff(existing.NegativeSunsetAt, r.NegativeSunsetAt)
+				audits = append(audits, audit)
+			}
+
+			if existing.NegativeResultPolicy != r.NegativeResultPolicy {
+				audit := BuildAuditEntry(actor, "updated negative result policy", r, r.ID)
+				audit.Diff = stringDiff(existing.NegativeResultPolicy.Display(), r.NegativeResultPolicy.Display())
+				audits = append(audits, audit)
+			}
+
+			if existing.SMSFailurePolicy != r.SMSFailurePolicy {
+				audit := BuildAuditEntry(actor, "updated sms failure policy", r, r.ID)
+				audit.Diff = stringDiff(existing.SMSFailurePolicy.Display(), r.SMSFailurePolicy.Display())
+				audits = append(audits, audit)
+			}
+
 			if existing.RequireDate != r.RequireDate {
 				audit := BuildAuditEntry(actor, "updated require date", r, r.ID)
 				audit.Diff = boolDiff(existing.RequireDate, r.RequireDate)
 				audits = append(audits, audit)
 			}
 
+			if existing.RejectDuplicateExternalID != r.RejectDuplicateExternalID {
+				audit := BuildAuditEntry(actor, "updated reject duplicate external ID", r, r.ID)
+				audit.Diff = boolDiff(existing.RejectDuplicateExternalID, r.RejectDuplicateExternalID)
+				audits = append(audits, audit)
+			}
+
+			if existing.DuplicateExternalIDWindow != r.DuplicateExternalIDWindow {
+				audit := BuildAuditEntry(actor, "updated duplicate external ID window", r, r.ID)
+				audit.Diff = stringDiff(existing.DuplicateExternalIDWindow.AsString, r.DuplicateExternalIDWindow.AsString)
+				audits = append(audits, audit)
+			}
+
+			if existing.RequireIssuanceApproval != r.RequireIssuanceApproval {
+				audit := BuildAuditEntry(actor, "updated require issuance approval", r, r.ID)
+				audit.Diff = boolDiff(existing.RequireIssuanceApproval, r.RequireIssuanceApproval)
+				audits = append(audits, audit)
+			}
+
+			if existing.IssuanceApprovalTimeout != r.IssuanceApprovalTimeout {
+				audit := BuildAuditEntry(actor, "updated issuance approval timeout", r, r.ID)
+				audit.Diff = stringDiff(existing.IssuanceApprovalTimeout.AsString, r.IssuanceApprovalTimeout.AsString)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxCodesPerExternalID != r.MaxCodesPerExternalID {
+				audit := BuildAuditEntry(actor, "updated max codes per external ID", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxCodesPerExternalID, r.MaxCodesPerExternalID)
+				audits = append(audits, audit)
+			}
+
+			if existing.MonthlyCodeQuota != r.MonthlyCodeQuota {
+				audit := BuildAuditEntry(actor, "updated monthly code quota", r, r.ID)
+				audit.Diff = uintDiff(existing.MonthlyCodeQuota, r.MonthlyCodeQuota)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxClaimsPerCode != r.MaxClaimsPerCode {
+				audit := BuildAuditEntry(actor, "updated max claims per code", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxClaimsPerCode, r.MaxClaimsPerCode)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxMetadataKeys != r.MaxMetadataKeys {
+				audit := BuildAuditEntry(actor, "updated max metadata keys", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxMetadataKeys, r.MaxMetadataKeys)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxMetadataBytes != r.MaxMetadataBytes {
+				audit := BuildAuditEntry(actor, "updated max metadata bytes", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxMetadataBytes, r.MaxMetadataBytes)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxExternalIDLength != r.MaxExternalIDLength {
+				audit := BuildAuditEntry(actor, "updated max external ID length", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxExternalIDLength, r.MaxExternalIDLength)
+				audits = append(audits, audit)
+			}
+
+			if existing.RequireExternalID != r.RequireExternalID {
+				audit := BuildAuditEntry(actor, "updated require external ID", r, r.ID)
+				audit.Diff = boolDiff(existing.RequireExternalID, r.RequireExternalID)
+				audits = append(audits, audit)
+			}
+
+			if existing.ExternalIDFormat != r.ExternalIDFormat {
+				audit := BuildAuditEntry(actor, "updated external ID format", r, r.ID)
+				audit.Diff = stringDiff(existing.ExternalIDFormat, r.ExternalIDFormat)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxActiveCodes != r.MaxActiveCodes {
+				audit := BuildAuditEntry(actor, "updated max active codes", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxActiveCodes, r.MaxActiveCodes)
+				audits = append(audits, audit)
+			}
+
+			if existing.IssueLimitPerMinute != r.IssueLimitPerMinute {
+				audit := BuildAuditEntry(actor, "updated issue limit per minute", r, r.ID)
+				audit.Diff = uintDiff(existing.IssueLimitPerMinute, r.IssueLimitPerMinute)
+				audits = append(audits, audit)
+			}
+
+			if existing.IssueLimitPerHour != r.IssueLimitPerHour {
+				audit := BuildAuditEntry(actor, "updated issue limit per hour", r, r.ID)
+				audit.Diff = uintDiff(existing.IssueLimitPerHour, r.IssueLimitPerHour)
+				audits = append(audits, audit)
+			}
+
+			if existing.IssueLimitPerDay != r.IssueLimitPerDay {
+				audit := BuildAuditEntry(actor, "updated issue limit per day", r, r.ID)
+				audit.Diff = uintDiff(existing.IssueLimitPerDay, r.IssueLimitPerDay)
+				audits = append(audits, audit)
+			}
+
+			if existing.QuietHours != r.QuietHours {
+				audit := BuildAuditEntry(actor, "updated quiet hours", r, r.ID)
+				audit.Diff = stringDiff(existing.QuietHours, r.QuietHours)
+				audits = append(audits, audit)
+			}
+
+			if a, b := strings.Join(existing.AllowedClaimAppIDs, ","), strings.Join(r.AllowedClaimAppIDs, ","); a != b {
+				audit := BuildAuditEntry(actor, "updated allowed claim app ids", r, r.ID)
+				audit.Diff = stringDiff(a, b)
+				audits = append(audits, audit)
+			}
+
+			if a, b := strings.Join(existing.AllowedClaimCountries, ","), strings.Join(r.AllowedClaimCountries, ","); a != b {
+				audit := BuildAuditEntry(actor, "updated allowed claim countries", r, r.ID)
+				audit.Diff = stringDiff(a, b)
+				audits = append(audits, audit)
+			}
+
+			if existing.EnforceClaimCountries != r.EnforceClaimCountries {
+				audit := BuildAuditEntry(actor, "updated enforce claim countries", r, r.ID)
+				audit.Diff = boolDiff(existing.EnforceClaimCountries, r.EnforceClaimCountries)
+				audits = append(audits, audit)
+			}
+
+			if existing.ClaimResponseMapping != r.ClaimResponseMapping {
+				audit := BuildAuditEntry(actor, "updated claim response mapping", r, r.ID)
+				audit.Diff = stringDiff(existing.ClaimResponseMapping, r.ClaimResponseMapping)
+				audits = append(audits, audit)
+			}
+
+			if existing.ClaimRedirectURL != r.ClaimRedirectURL {
+				audit := BuildAuditEntry(actor, "updated claim redirect URL", r, r.ID)
+				audit.Diff = stringDiff(existing.ClaimRedirectURL, r.ClaimRedirectURL)
+				audits = append(audits, audit)
+			}
+
+			if existing.ReportTypeMapping != r.ReportTypeMapping {
+				audit := BuildAuditEntry(actor, "updated report type mapping", r, r.ID)
+				audit.Diff = stringDiff(existing.ReportTypeMapping, r.ReportTypeMapping)
+				audits = append(audits, audit)
+			}
+
+			if existing.AutofillTestDate != r.AutofillTestDate {
+				audit := BuildAuditEntry(actor, "updated autofill test date", r, r.ID)
+				audit.Diff = boolDiff(existing.AutofillTestDate, r.AutofillTestDate)
+				audits = append(audits, audit)
+			}
+
+			if existing.TestDateOffsetDays != r.TestDateOffsetDays {
+				audit := BuildAuditEntry(actor, "updated test date offset days", r, r.ID)
+				audit.Diff = uintDiff(existing.TestDateOffsetDays, r.TestDateOffsetDays)
+				audits = append(audits, audit)
+			}
+
+			if existing.EnforceDateOrder != r.EnforceDateOrder {
+				audit := BuildAuditEntry(actor, "updated enforce date order", r, r.ID)
+				audit.Diff = boolDiff(existing.EnforceDateOrder, r.EnforceDateOrder)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxTestBeforeSymptomDays != r.MaxTestBeforeSymptomDays {
+				audit := BuildAuditEntry(actor, "updated max test before symptom days", r, r.ID)
+				audit.Diff = intDiff(existing.MaxTestBeforeSymptomDays, r.MaxTestBeforeSymptomDays)
+				audits = append(audits, audit)
+			}
+
+			if existing.FutureDateTolerance != r.FutureDateTolerance {
+				audit := BuildAuditEntry(actor, "updated future date tolerance", r, r.ID)
+				audit.Diff = stringDiff(existing.FutureDateTolerance.AsString, r.FutureDateTolerance.AsString)
+				audits = append(audits, audit)
+			}
+
+			if existing.RequireDeviceBinding != r.RequireDeviceBinding {
+				audit := BuildAuditEntry(actor, "updated require device binding", r, r.ID)
+				audit.Diff = boolDiff(existing.RequireDeviceBinding, r.RequireDeviceBinding)
+				audits = append(audits, audit)
+			}
+
+			if existing.MaxFailedClaimAttempts != r.MaxFailedClaimAttempts {
+				audit := BuildAuditEntry(actor, "updated max failed claim attempts", r, r.ID)
+				audit.Diff = uintDiff(existing.MaxFailedClaimAttempts, r.MaxFailedClaimAttempts)
+				audits = append(audits, audit)
+			}
+
+			if existing.MinClaimIntervalSeconds != r.MinClaimIntervalSeconds {
+				audit := BuildAuditEntry(actor, "updated min claim interval", r, r.ID)
+				audit.Diff = uintDiff(existing.MinClaimIntervalSeconds, r.MinClaimIntervalSeconds)
+				audits = append(audits, audit)
+			}
+
+			if existing.ClaimLimitPerExternalID != r.ClaimLimitPerExternalID {
+				audit := BuildAuditEntry(actor, "updated claim limit per external ID", r, r.ID)
+				audit.Diff = uintDiff(existing.ClaimLimitPerExternalID, r.ClaimLimitPerExternalID)
+				audits = append(audits, audit)
+			}
+
+			if existing.DeepLinkScheme != r.DeepLinkScheme {
+				audit := BuildAuditEntry(actor, "updated deep link scheme", r, r.ID)
+				audit.Diff = stringDiff(existing.DeepLinkScheme, r.DeepLinkScheme)
+				audits = append(audits, audit)
+			}
+
+			if existing.DeepLinkHost != r.DeepLinkHost {
+				audit := BuildAuditEntry(actor, "updated deep link host", r, r.ID)
+				audit.Diff = stringDiff(existing.DeepLinkHost, r.DeepLinkHost)
+				audits = append(audits, audit)
+			}
+
+			if a, b := strings.Join(existing.DeepLinkMetadataKeys, ", "), strings.Join(r.DeepLinkMetadataKeys, ", "); a != b {
+				audit := BuildAuditEntry(actor, "updated deep link metadata keys", r, r.ID)
+				audit.Diff = stringDiff(a, b)
+				audits = append(audits, audit)
+			}
+
+			if existing.DisableLongCodes != r.DisableLongCodes {
+				audit := BuildAuditEntry(actor, "updated disable long codes", r, r.ID)
+				audit.Diff = boolDiff(existing.DisableLongCodes, r.DisableLongCodes)
+				audits = append(audits, audit)
+			}
+
+			if existing.DisableShortCodeClaims != r.DisableShortCodeClaims {
+				audit := BuildAuditEntry(actor, "updated disable short code claims", r, r.ID)
+				audit.Diff = boolDiff(existing.DisableShortCodeClaims, r.DisableShortCodeClaims)
+				audits = append(audits, audit)
+			}
+
+			if existing.CodeSeparators != r.CodeSeparators {
+				audit := BuildAuditEntry(actor, "updated code separators", r, r.ID)
+				audit.Diff = stringDiff(existing.CodeSeparators, r.CodeSeparators)
+				audits = append(audits, audit)
+			}
+
+			if existing.CaseInsensitiveCodes != r.CaseInsensitiveCodes {
+				audit := BuildAuditEntry(actor, "updated case-insensitive codes", r, r.ID)
+				audit.Diff = boolDiff(existing.CaseInsensitiveCodes, r.CaseInsensitiveCodes)
+				audits = append(audits, audit)
+			}
+
+			if existing.StrictCodeExpiry != r.StrictCodeExpiry {
+				audit := BuildAuditEntry(actor, "updated strict code expiry", r, r.ID)
+				audit.Diff = boolDiff(existing.StrictCodeExpiry, r.StrictCodeExpiry)
+				audits = append(audits, audit)
+			}
+
 			if existing.UseRealmCertificateKey != r.UseRealmCertificateKey {
 				audit := BuildAuditEntry(actor, "updated use realm certificate key", r, r.ID)
 				audit.Diff = boolDiff(existing.UseRealmCertificateKey, r.UseRealmCertificateKey)
@@ -1268,6 +2881,7 @@ func (r *Realm) Stats(db *Database, start, stop time.Time) (RealmStats, error) {
 			$1 AS realm_id,
 			COALESCE(s.codes_issued, 0) AS codes_issued,
 			COALESCE(s.codes_claimed, 0) AS codes_claimed,
+			COALESCE(s.codes_claimed_synthetic, 0) AS codes_claimed_synthetic,
 			COALESCE(s.daily_active_users, 0) AS daily_active_users
 		FROM (
 			SELECT date::date FROM generate_series($2, $3, '1 day'::interval) date
@@ -1303,7 +2917,8 @@ func (r *Realm) ExternalIssuerStats(db *Database, start, stop time.Time) (Extern
 			d.date AS date,
 			$1 AS realm_id,
 			d.issuer_id AS issuer_id,
-			COALESCE(s.codes_issued, 0) AS codes_issued
+			COALESCE(s.codes_issued, 0) AS codes_issued,
+			COALESCE(s.codes_supervised, 0) AS codes_supervised
 		FROM (
 			SELECT
 				d.date AS date,
@@ -1380,7 +2995,27 @@ func (r *Realm) RenderWelcomeMessage() string {
 	if msg == "" {
 		return ""
 	}
+	return renderMarkdown(msg)
+}
+
+// RenderIssueConfirmationMessage renders the message displayed after a code is
+// issued. It uses the localized message matching the first of the language
+// preferences, falling back to the realm's message and then to
+// DefaultIssueConfirmationMessage.
+func (r *Realm) RenderIssueConfirmationMessage(langs ...string) string {
+	msg, ok := r.LocalizedIssueConfirmationMessages.Lookup(langs...)
+	if !ok {
+		msg = project.TrimSpace(r.IssueConfirmationMessage)
+	}
+	if msg == "" {
+		msg = DefaultIssueConfirmationMessage
+	}
+	return renderMarkdown(msg)
+}
 
+// renderMarkdown renders realm-provided markdown as HTML, removing any markup
+// which could be used for XSS.
+func renderMarkdown(msg string) string {
 	raw := blackfriday.Run([]byte(msg))
 	return string(bluemonday.UGCPolicy().SanitizeBytes(raw))
 }
@@ -1395,6 +3030,52 @@ func (r *Realm) QuotaKey(hmacKey []byte) (string, error) {
 	return fmt.Sprintf("realm:quota:%s", dig), nil
 }
 
+// ExternalIDClaimKey returns the rate limit key for claims of the realm's codes
+// with the given external ID. The external ID is HMACed so it is not stored in
+// the limiter.
+func (r *Realm) ExternalIDClaimKey(hmacKey []byte, externalID string) (string, error) {
+	dig, err := digest.HMAC(fmt.Sprintf("%d:%s", r.ID, externalID), hmacKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create external ID claim key: %w", err)
+	}
+	return fmt.Sprintf("realm:claim:external:%s", dig), nil
+}
+
+// FailedClaimKey returns the rate limit key for claims of codes in the realm
+// which do not exist, made by the given device. The device is HMACed so it is
+// not stored in the limiter.
+func (r *Realm) FailedClaimKey(hmacKey []byte, device string) (string, error) {
+	dig, err := digest.HMAC(fmt.Sprintf("%d:%s", r.ID, device), hmacKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create failed claim key: %w", err)
+	}
+	return fmt.Sprintf("realm:claim:failed:%s", dig), nil
+}
+
+// QuotaDay returns the start and end of the realm's local day which contains
+// now, in the realm's timezone. Around daylight saving time changes, the day
+// is 23 or 25 hours long.
+func (r *Realm) QuotaDay(now time.Time) (time.Time, time.Time) {
+	local := now.In(r.Location())
+	year, month, day := local.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, local.Location())
+	end := time.Date(year, month, day+1, 0, 0, 0, 0, local.Location())
+	return start, end
+}
+
+// DailyQuotaKey returns the key for the realm's abuse prevention quota on the
+// local day which contains now. Each day uses a new key, so the quota resets at
+// midnight in the realm's timezone instead of 24 hours after it was last set.
+func (r *Realm) DailyQuotaKey(hmacKey []byte, now time.Time) (string, error) {
+	key, err := r.QuotaKey(hmacKey)
+	if err != nil {
+		return "", err
+	}
+
+	start, _ := r.QuotaDay(now)
+	return key + ":" + start.Format("2006-01-02"), nil
+}
+
 // IncrementDailyActiveUsers increments the daily active users for the realm by
 // the provided amount.
 func (r *Realm) IncrementDailyActiveUsers(db *Database, now time.Time) error {
@@ -1413,6 +3094,28 @@ func (r *Realm) IncrementDailyActiveUsers(db *Database, now time.Time) error {
 	return nil
 }
 
+// ToAppIDList converts the newline-separated and/or comma-separated list of
+// app IDs into a sorted, de-duplicated slice.
+func ToAppIDList(s string) []string {
+	seen := make(map[string]struct{})
+	appIDs := make([]string, 0, 4)
+	for _, line := range strings.Split(s, "\n") {
+		for _, v := range strings.Split(line, ",") {
+			v = project.TrimSpace(v)
+			if v == "" {
+				continue
+			}
+			if _, ok := seen[v]; ok {
+				continue
+			}
+			seen[v] = struct{}{}
+			appIDs = append(appIDs, v)
+		}
+	}
+	sort.Strings(appIDs)
+	return appIDs
+}
+
 // ToCIDRList converts the newline-separated and/or comma-separated CIDR list
 // into an array of strings.
 func ToCIDRList(s string) ([]string, error) {
@@ -1448,3 +3151,28 @@ func ToCIDRList(s string) ([]string, error) {
 	sort.Strings(cidrs)
 	return cidrs, nil
 }
+
+// CanIssueFromIP returns true if the realm allows issuing codes from the IP.
+// Realms without issuing CIDRs allow every IP, and when there are issuing
+// CIDRs, an unparseable IP is never allowed.
+func (r *Realm) CanIssueFromIP(ip string) bool {
+	if len(r.AllowedCIDRsIssue) == 0 {
+		return true
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, c := range r.AllowedCIDRsIssue {
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			continue
+		}
+		if cidr.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// maxRealmRequestReasonLength is the maximum length of the reason given
+	// when requesting a realm.
+	maxRealmRequestReasonLength = 1024
+)
+
+// ErrRealmRequestPending is returned when a user requests a realm while they
+// already have a request waiting for approval.
+var ErrRealmRequestPending = errors.New("you already have a realm request waiting for approval")
+
+// realmRequestRegionCodeRe is the required format of a requested realm's
+// region code, which is an ISO 3166-1 country code, optionally followed by an
+// ISO 3166-2 subdivision code.
+var realmRequestRegionCodeRe = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+// RequestRealm creates a realm which is pending approval by a system admin.
+// Unlike realms created by system admins, the region code is required, and
+// both the name and region code are checked for uniqueness up front so the
+// requester gets a useful error.
+func (db *Database) RequestRealm(r *Realm, requester *User) error {
+	if requester == nil {
+		return fmt.Errorf("requester is nil")
+	}
+
+	var count int
+	if err := db.db.
+		Model(&Realm{}).
+		Where("pending_approval IS TRUE").
+		Where("requested_by_id = ?", requester.ID).
+		Count(&count).
+		Error; err != nil {
+		return fmt.Errorf("failed to count pending requests: %w", err)
+	}
+	if count > 0 {
+		return ErrRealmRequestPending
+	}
+
+	r.PendingApproval = true
+	r.RequestedByID = requester.ID
+
+	r.Name = project.TrimSpace(r.Name)
+	if r.Name != "" {
+		if _, err := db.FindRealmByName(r.Name); err == nil {
+			r.AddError("name", "is already in use")
+		} else if !IsNotFound(err) {
+			return fmt.Errorf("failed to check realm name: %w", err)
+		}
+	}
+
+	r.RegionCode = strings.ToUpper(project.TrimSpace(r.RegionCode))
+	switch {
+	case r.RegionCode == "":
+		r.AddError("regionCode", "cannot be blank")
+	case !realmRequestRegionCodeRe.MatchString(r.RegionCode):
+		r.AddError("regionCode", "must be an ISO 3166 code such as US or US-WA")
+	case db.config.EnforceUniqueRegionCodes:
+		if _, err := db.FindRealmByRegion(r.RegionCode); err == nil {
+			r.AddError("regionCode", "is already in use")
+		} else if !IsNotFound(err) {
+			return fmt.Errorf("failed to check region code: %w", err)
+		}
+	}
+
+	r.RequestReason = project.TrimSpace(r.RequestReason)
+	if len(r.RequestReason) > maxRealmRequestReasonLength {
+		r.AddError("requestReason", fmt.Sprintf("cannot be more than %d characters", maxRealmRequestReasonLength))
+	}
+
+	// Errors added above are kept, so saving runs the remaining validations and
+	// fails with all of them.
+	return db.SaveRealm(r, requester)
+}
+
+// ListPendingRealms lists realms which are waiting for approval, oldest first.
+func (db *Database) ListPendingRealms() ([]*Realm, error) {
+	var realms []*Realm
+	if err := db.db.
+		Model(&Realm{}).
+		Where("pending_approval IS TRUE").
+		Order("created_at ASC").
+		Find(&realms).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return realms, nil
+		}
+		return nil, err
+	}
+	return realms, nil
+}
+
+// DeleteRealmRequest rejects a realm request by deleting the pending realm.
+// The realm is deleted permanently so the name and region code can be
+// requested again.
+func (db *Database) DeleteRealmRequest(r *Realm, actor Auditable) error {
+	if r == nil {
+		return fmt.Errorf("provided realm is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	return db.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.
+			Unscoped().
+			Where("id = ?", r.ID).
+			Where("pending_approval IS TRUE").
+			Delete(&Realm{})
+		if err := result.Error; err != nil {
+			return fmt.Errorf("failed to delete realm request: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("realm %d is not pending approval", r.ID)
+		}
+
+		audit := BuildAuditEntry(actor, "rejected realm request", r, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+}
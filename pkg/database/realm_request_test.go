@@ -0,0 +1,121 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDatabase_RequestRealm(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	existing := NewRealmWithDefaults("Existing")
+	existing.RegionCode = "US-AA"
+	if err := db.SaveRealm(existing, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	requester := &User{
+		Email: "requester@example.com",
+		Name:  "Requester",
+	}
+	if err := db.SaveUser(requester, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Name and region code must be unique.
+	taken := NewRealmWithDefaults("Existing")
+	taken.RegionCode = "us-aa"
+	if err := db.RequestRealm(taken, requester); err == nil {
+		t.Fatal("expected error")
+	}
+	if errs := taken.ErrorsFor("name"); len(errs) == 0 {
+		t.Errorf("expected errors for name")
+	}
+	if errs := taken.ErrorsFor("regionCode"); len(errs) == 0 {
+		t.Errorf("expected errors for regionCode")
+	}
+
+	// Region code is required and must look like one.
+	invalid := NewRealmWithDefaults("Invalid")
+	invalid.RegionCode = "Washington"
+	if err := db.RequestRealm(invalid, requester); err == nil {
+		t.Fatal("expected error")
+	}
+	if errs := invalid.ErrorsFor("regionCode"); len(errs) == 0 {
+		t.Errorf("expected errors for regionCode")
+	}
+
+	realm := NewRealmWithDefaults("Requested")
+	realm.RegionCode = "US-BB"
+	realm.RequestReason = "For testing"
+	if err := db.RequestRealm(realm, requester); err != nil {
+		t.Fatal(err)
+	}
+	if !realm.PendingApproval {
+		t.Errorf("expected realm to be pending approval")
+	}
+	if got, want := realm.RequestedByID, requester.ID; got != want {
+		t.Errorf("expected requested by %d to be %d", got, want)
+	}
+
+	// Only one pending request per user.
+	another := NewRealmWithDefaults("Another")
+	another.RegionCode = "US-CC"
+	if err := db.RequestRealm(another, requester); !errors.Is(err, ErrRealmRequestPending) {
+		t.Errorf("expected %v to be %v", err, ErrRealmRequestPending)
+	}
+
+	pending, err := db.ListPendingRealms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != realm.ID {
+		t.Errorf("expected only %d to be pending, got %v", realm.ID, pending)
+	}
+
+	// Rejecting deletes the realm so the name can be requested again.
+	if err := db.DeleteRealmRequest(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FindRealm(realm.ID); !IsNotFound(err) {
+		t.Errorf("expected realm to be deleted, got %v", err)
+	}
+	if err := db.DeleteRealmRequest(existing, SystemTest); err == nil {
+		t.Errorf("expected error deleting a realm which is not pending")
+	}
+
+	again := NewRealmWithDefaults("Requested")
+	again.RegionCode = "US-BB"
+	if err := db.RequestRealm(again, requester); err != nil {
+		t.Fatal(err)
+	}
+
+	// Approving the realm makes it active.
+	again.PendingApproval = false
+	if err := db.SaveRealm(again, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	pending, err = db.ListPendingRealms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending realms, got %v", pending)
+	}
+}
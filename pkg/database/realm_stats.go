@@ -38,6 +38,12 @@ type RealmStat struct {
 	CodesIssued      uint      `gorm:"codes_issued; default:0;"`
 	CodesClaimed     uint      `gorm:"codes_claimed; default:0;"`
 	DailyActiveUsers uint      `gorm:"daily_active_users; default:0;"`
+
+	// CodesClaimedSynthetic is the number of claimed codes which were claimed
+	// sooner after issuance than the realm's minimum claim interval, and are
+	// likely from testing rather than real usage. They are included in
+	// CodesClaimed.
+	CodesClaimedSynthetic uint `gorm:"codes_claimed_synthetic; default:0;"`
 }
 
 // MarshalCSV returns bytes in CSV format.
@@ -50,7 +56,7 @@ func (s RealmStats) MarshalCSV() ([]byte, error) {
 	var b bytes.Buffer
 	w := csv.NewWriter(&b)
 
-	if err := w.Write([]string{"date", "codes_issued", "codes_claimed", "daily_active_users"}); err != nil {
+	if err := w.Write([]string{"date", "codes_issued", "codes_claimed", "daily_active_users", "codes_claimed_synthetic"}); err != nil {
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
@@ -60,6 +66,7 @@ func (s RealmStats) MarshalCSV() ([]byte, error) {
 			strconv.FormatUint(uint64(stat.CodesIssued), 10),
 			strconv.FormatUint(uint64(stat.CodesClaimed), 10),
 			strconv.FormatUint(uint64(stat.DailyActiveUsers), 10),
+			strconv.FormatUint(uint64(stat.CodesClaimedSynthetic), 10),
 		}); err != nil {
 			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
 		}
@@ -87,6 +94,8 @@ type jsonRealmStatStatsData struct {
 	CodesIssued      uint `json:"codes_issued"`
 	CodesClaimed     uint `json:"codes_claimed"`
 	DailyActiveUsers uint `json:"daily_active_users"`
+
+	CodesClaimedSynthetic uint `json:"codes_claimed_synthetic"`
 }
 
 // MarshalJSON is a custom JSON marshaller.
@@ -104,6 +113,8 @@ func (s RealmStats) MarshalJSON() ([]byte, error) {
 				CodesIssued:      stat.CodesIssued,
 				CodesClaimed:     stat.CodesClaimed,
 				DailyActiveUsers: stat.DailyActiveUsers,
+
+				CodesClaimedSynthetic: stat.CodesClaimedSynthetic,
 			},
 		})
 	}
@@ -141,6 +152,8 @@ func (s *RealmStats) UnmarshalJSON(b []byte) error {
 			CodesIssued:      stat.Data.CodesIssued,
 			CodesClaimed:     stat.Data.CodesClaimed,
 			DailyActiveUsers: stat.Data.DailyActiveUsers,
+
+			CodesClaimedSynthetic: stat.Data.CodesClaimedSynthetic,
 		})
 	}
 
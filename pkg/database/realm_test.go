@@ -23,6 +23,7 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestSMS(t *testing.T) {
@@ -38,6 +39,20 @@ func TestSMS(t *testing.T) {
 		t.Errorf("SMS text wrong, want: %q got %q", want, got)
 	}
 
+	got = realm.BuildSMSText("12345678", "abcdefgh12345678", "")
+	want = "This is your Exposure Notifications Verification code: ens://v?r=US-WA&c=abcdefgh12345678 Expires in 24 hours"
+	if got != want {
+		t.Errorf("SMS text wrong, want: %q got %q", want, got)
+	}
+
+	realm.DeepLinkScheme = "wonder-en"
+	realm.DeepLinkHost = "verify"
+	got = realm.BuildSMSText("12345678", "abcdefgh12345678", "")
+	want = "This is your Exposure Notifications Verification code: wonder-en://verify?r=US-WA&c=abcdefgh12345678 Expires in 24 hours"
+	if got != want {
+		t.Errorf("SMS text wrong, want: %q got %q", want, got)
+	}
+
 	realm.SMSTextTemplate = "State of Wonder, COVID-19 Exposure Verification code [code]. Expires in [expires] minutes. Act now!"
 	got = realm.BuildSMSText("654321", "asdflkjasdlkfjl", "")
 	want = "State of Wonder, COVID-19 Exposure Verification code 654321. Expires in 15 minutes. Act now!"
@@ -46,6 +61,897 @@ func TestSMS(t *testing.T) {
 	}
 }
 
+func TestRealm_QuotaDay(t *testing.T) {
+	t.Parallel()
+
+	mustParse := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	cases := []struct {
+		name     string
+		timezone string
+		now      string
+		date     string
+		length   time.Duration
+	}{
+		{
+			name:   "utc",
+			now:    "2020-11-02T23:30:00Z",
+			date:   "2020-11-02",
+			length: 24 * time.Hour,
+		},
+		{
+			name:     "west_of_utc",
+			timezone: "America/Los_Angeles",
+			now:      "2020-11-03T05:00:00Z",
+			date:     "2020-11-02",
+			length:   24 * time.Hour,
+		},
+		{
+			name:     "east_of_utc",
+			timezone: "Australia/Sydney",
+			now:      "2020-11-02T20:00:00Z",
+			date:     "2020-11-03",
+			length:   24 * time.Hour,
+		},
+		{
+			name:     "dst_ends",
+			timezone: "America/Los_Angeles",
+			now:      "2020-11-01T12:00:00Z",
+			date:     "2020-11-01",
+			length:   25 * time.Hour,
+		},
+		{
+			name:     "dst_starts",
+			timezone: "America/Los_Angeles",
+			now:      "2020-03-08T12:00:00Z",
+			date:     "2020-03-08",
+			length:   23 * time.Hour,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := &Realm{Timezone: tc.timezone}
+			now := mustParse(tc.now)
+
+			start, end := realm.QuotaDay(now)
+			if got := start.Format("2006-01-02"); got != tc.date {
+				t.Errorf("expected %q to be %q", got, tc.date)
+			}
+			if now.Before(start) || !now.Before(end) {
+				t.Errorf("expected %s to be in [%s, %s)", now, start, end)
+			}
+			if got := end.Sub(start); got != tc.length {
+				t.Errorf("expected day length %s to be %s", got, tc.length)
+			}
+
+			key, err := realm.DailyQuotaKey([]byte("abc"), now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := ":" + tc.date; !strings.HasSuffix(key, want) {
+				t.Errorf("expected %q to end with %q", key, want)
+			}
+		})
+	}
+}
+
+func TestRealm_Location(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		timezone string
+		want     string
+		err      bool
+	}{
+		{
+			name:     "empty",
+			timezone: "",
+			want:     "UTC",
+		},
+		{
+			name:     "valid",
+			timezone: "America/Los_Angeles",
+			want:     "America/Los_Angeles",
+		},
+		{
+			name:     "invalid",
+			timezone: "Not/AZone",
+			want:     "UTC",
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := NewRealmWithDefaults("test")
+			realm.Timezone = tc.timezone
+
+			if got, want := realm.Location().String(), tc.want; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			_ = realm.BeforeSave(nil)
+			if got := len(realm.ErrorsFor("timezone")) > 0; got != tc.err {
+				t.Errorf("expected timezone error to be %t, got %v", tc.err, realm.ErrorsFor("timezone"))
+			}
+		})
+	}
+}
+
+func TestRealm_IssueRateWindows(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got := realm.IssueRateWindows(); len(got) != 0 {
+		t.Errorf("expected no windows, got %v", got)
+	}
+
+	realm.IssueLimitPerMinute = 10
+	realm.IssueLimitPerDay = 500
+	got := realm.IssueRateWindows()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 windows, got %v", got)
+	}
+	if got, want := got[0].String(), "10 per minute"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := got[1].String(), "500 per day"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("issueLimitPerMinute"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	realm.IssueLimitPerMinute = 600
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("issueLimitPerMinute"); len(errs) == 0 {
+		t.Errorf("expected per-minute limit above the daily limit to be invalid")
+	}
+}
+
+func TestRealm_NegativeResultPolicy(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, want := realm.NegativeResultPolicy, NegativeResultAllow; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+	if realm.NegativeResultPolicy.BlocksUpload() {
+		t.Errorf("expected default policy to allow uploads")
+	}
+
+	for _, p := range []NegativeResultPolicy{NegativeResultBlockUpload, NegativeResultInformational} {
+		if !p.BlocksUpload() {
+			t.Errorf("expected %q to block uploads", p.Display())
+		}
+	}
+	if NegativeResultShortExpiry.BlocksUpload() {
+		t.Errorf("expected short expiry to allow uploads")
+	}
+
+	realm.NegativeResultPolicy = NegativeResultInformational
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("negativeResultPolicy"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	realm.NegativeResultPolicy = 12
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("negativeResultPolicy"); len(errs) == 0 {
+		t.Errorf("expected unknown policy to be invalid")
+	}
+}
+
+func TestRealm_SMSFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, want := realm.SMSFailurePolicy, SMSFailureFail; got != want {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	realm.SMSFailurePolicy = SMSFailureRetry
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("smsFailurePolicy"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	realm.SMSFailurePolicy = 12
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("smsFailurePolicy"); len(errs) == 0 {
+		t.Errorf("expected unknown policy to be invalid")
+	}
+}
+
+func TestRealm_ClaimCountryAllowed(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if !realm.ClaimCountryAllowed("FR") {
+		t.Errorf("expected every country to be allowed by default")
+	}
+
+	realm.AllowedClaimCountries = []string{"us", " CA"}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("allowedClaimCountries"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if !realm.ClaimCountryAllowed("US") || !realm.ClaimCountryAllowed("ca") {
+		t.Errorf("expected US and CA to be allowed, got %v", realm.AllowedClaimCountries)
+	}
+	if realm.ClaimCountryAllowed("FR") {
+		t.Errorf("expected FR not to be allowed")
+	}
+
+	realm.AllowedClaimCountries = []string{"USA"}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("allowedClaimCountries"); len(errs) == 0 {
+		t.Errorf("expected invalid country code to be rejected")
+	}
+}
+
+func TestRealm_CanIssueFromIP(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if !realm.CanIssueFromIP("203.0.113.5") {
+		t.Errorf("expected every IP to be allowed by default")
+	}
+
+	realm.AllowedCIDRsIssue = []string{"203.0.113.0/24", "2001:db8::/32"}
+	for _, ip := range []string{"203.0.113.5", "2001:db8::1"} {
+		if !realm.CanIssueFromIP(ip) {
+			t.Errorf("expected %s to be allowed", ip)
+		}
+	}
+	for _, ip := range []string{"198.51.100.1", "2001:db9::1", "", "not-an-ip"} {
+		if realm.CanIssueFromIP(ip) {
+			t.Errorf("expected %q not to be allowed", ip)
+		}
+	}
+}
+
+func TestRealm_ExternalIDClaimWindows(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got := realm.ExternalIDClaimWindows(); got != nil {
+		t.Errorf("expected no windows, got %v", got)
+	}
+
+	realm.ClaimLimitPerExternalID = 5
+	windows := realm.ExternalIDClaimWindows()
+	if len(windows) != 1 || windows[0].Limit != 5 || windows[0].Interval != time.Hour {
+		t.Errorf("expected 5 per hour, got %v", windows)
+	}
+
+	key := []byte("abcd1234")
+	key1, err := realm.ExternalIDClaimKey(key, "patient-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := realm.ExternalIDClaimKey(key, "patient-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key1 == key2 {
+		t.Errorf("expected keys for different external IDs to differ")
+	}
+	if strings.Contains(key1, "patient-1") {
+		t.Errorf("expected external ID to be hashed, got %q", key1)
+	}
+}
+
+func TestRealm_EffectiveTokenDuration(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, want := realm.EffectiveTokenDuration(24*time.Hour), 24*time.Hour; got != want {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+
+	realm.TokenDuration = FromDuration(72 * time.Hour)
+	if got, want := realm.EffectiveTokenDuration(24*time.Hour), 72*time.Hour; got != want {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("tokenDuration"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	realm.TokenDuration = FromDuration(MaxTokenDuration + time.Hour)
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("tokenDuration"); len(errs) == 0 {
+		t.Errorf("expected token duration above the maximum to be invalid")
+	}
+}
+
+func TestRealm_EffectivePasswordRotation(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if period, warning := realm.EffectivePasswordRotation(90, 7); period != 90 || warning != 7 {
+		t.Errorf("expected server policy, got %d, %d", period, warning)
+	}
+
+	realm.PasswordRotationPeriodDays = 30
+	realm.PasswordRotationWarningDays = 3
+	if period, warning := realm.EffectivePasswordRotation(90, 7); period != 30 || warning != 3 {
+		t.Errorf("expected realm policy, got %d, %d", period, warning)
+	}
+}
+
+func TestRealm_EffectiveTokenClaims(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, want := realm.EffectiveTokenIssuer("default-iss"), "default-iss"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := realm.EffectiveTokenAudience("default-aud"), "default-aud"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.TokenIssuer = " realm-iss "
+	realm.TokenAudience = "realm-aud"
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("tokenIssuer"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if got, want := realm.EffectiveTokenIssuer("default-iss"), "realm-iss"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := realm.EffectiveTokenAudience("default-aud"), "realm-aud"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.TokenIssuer = "realm iss"
+	realm.TokenAudience = strings.Repeat("a", maxTokenClaimLength+1)
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("tokenIssuer"); len(errs) == 0 {
+		t.Errorf("expected issuer with whitespace to be invalid")
+	}
+	if errs := realm.ErrorsFor("tokenAudience"); len(errs) == 0 {
+		t.Errorf("expected audience above the maximum length to be invalid")
+	}
+}
+
+func TestRealm_LogoURL(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.LogoURL = " https://storage.googleapis.com/assets/realms/1/logo.png "
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("logoURL"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if got, want := realm.LogoURL, "https://storage.googleapis.com/assets/realms/1/logo.png"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.LogoURL = "javascript:alert(1)"
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("logoURL"); len(errs) == 0 {
+		t.Errorf("expected non-http logo URL to be invalid")
+	}
+}
+
+func TestRealm_CodeSeparators(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.CodeSeparators = " -"
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("codeSeparators"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if got, want := realm.CodeSeparators, " -"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := StripCodeSeparators("1234-5678 abcd", realm.CodeSeparators), "12345678abcd"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	for _, v := range []string{"-0", "a", "\t"} {
+		realm := NewRealmWithDefaults("test")
+		realm.CodeSeparators = v
+		_ = realm.BeforeSave(nil)
+		if errs := realm.ErrorsFor("codeSeparators"); len(errs) == 0 {
+			t.Errorf("expected %q to be invalid", v)
+		}
+	}
+}
+
+func TestRealm_ClaimRedirectURL(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		scheme string
+		url    string
+		valid  bool
+	}{
+		{name: "empty", url: "", valid: true},
+		{name: "https", url: " https://example.com/verified ", valid: true},
+		{name: "default_scheme", url: "ens://verified", valid: true},
+		{name: "custom_scheme", scheme: "wonder-en", url: "wonder-en://verified", valid: true},
+		{name: "other_scheme", scheme: "wonder-en", url: "ens://verified", valid: false},
+		{name: "http", url: "http://example.com/verified", valid: false},
+		{name: "javascript", url: "javascript:alert(1)", valid: false},
+		{name: "no_host", url: "https:///verified", valid: false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := NewRealmWithDefaults("test")
+			realm.DeepLinkScheme = tc.scheme
+			realm.ClaimRedirectURL = tc.url
+			_ = realm.BeforeSave(nil)
+
+			errs := realm.ErrorsFor("claimRedirectURL")
+			if got := len(errs) == 0; got != tc.valid {
+				t.Errorf("expected valid to be %t, got errors %v", tc.valid, errs)
+			}
+		})
+	}
+}
+
+func TestRealm_RenderIssueConfirmationMessage(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, want := realm.RenderIssueConfirmationMessage(), "<p>Read the code to the patient"; !strings.HasPrefix(got, want) {
+		t.Errorf("expected %q to start with %q", got, want)
+	}
+
+	realm.IssueConfirmationMessage = "Say **hello**<script>alert(1)</script> <a href=\"javascript:alert(1)\">link</a>"
+	got := realm.RenderIssueConfirmationMessage()
+	if !strings.Contains(got, "<strong>hello</strong>") {
+		t.Errorf("expected %q to contain rendered markdown", got)
+	}
+	if strings.Contains(got, "<script") || strings.Contains(got, "javascript:") {
+		t.Errorf("expected %q to be sanitized", got)
+	}
+}
+
+func TestRealm_LocalizedIssueConfirmationMessages(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.IssueConfirmationMessage = "Read the code."
+	realm.LocalizedIssueConfirmationMessages = LocalizedMessages{
+		"ES":    "Lea el **código**.",
+		"fr-ca": "Lisez le code.",
+		"de":    " ",
+	}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("localizedIssueConfirmationMessages"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if _, ok := realm.LocalizedIssueConfirmationMessages["de"]; ok {
+		t.Errorf("expected blank message to be removed")
+	}
+
+	cases := []struct {
+		langs []string
+		want  string
+	}{
+		{langs: []string{"es-MX"}, want: "<strong>código</strong>"},
+		{langs: []string{"", "fr-CA,fr;q=0.9"}, want: "Lisez le code."},
+		{langs: []string{"ja"}, want: "Read the code."},
+		{langs: nil, want: "Read the code."},
+	}
+	for _, tc := range cases {
+		if got := realm.RenderIssueConfirmationMessage(tc.langs...); !strings.Contains(got, tc.want) {
+			t.Errorf("%v: expected %q to contain %q", tc.langs, got, tc.want)
+		}
+	}
+
+	realm.LocalizedIssueConfirmationMessages = LocalizedMessages{
+		"not a tag": "Hello",
+		"es":        "Hola <img src=x onerror=alert(1)>",
+	}
+	_ = realm.BeforeSave(nil)
+	if got, want := len(realm.ErrorsFor("localizedIssueConfirmationMessages")), 2; got != want {
+		t.Errorf("expected %d errors, got %v", want, realm.ErrorsFor("localizedIssueConfirmationMessages"))
+	}
+}
+
+func TestRealm_SMSTextTemplates(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.SMSTextTemplate = "Your code is [code]"
+	realm.SMSTextTemplates = LocalizedMessages{
+		"ES":    "Su código es [code]",
+		"fr-ca": "Votre code est [code]",
+	}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("smsTextTemplates"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	cases := []struct {
+		locale string
+		want   string
+	}{
+		{locale: "es-MX", want: "Su código es 123456"},
+		{locale: "fr-CA", want: "Votre code est 123456"},
+		{locale: "ja", want: "Your code is 123456"},
+		{locale: "", want: "Your code is 123456"},
+	}
+	for _, tc := range cases {
+		if got := realm.BuildLocalizedSMSText(tc.locale, "123456", "abcdefgh12345678", ""); got != tc.want {
+			t.Errorf("%q: expected %q to be %q", tc.locale, got, tc.want)
+		}
+	}
+
+	realm.SMSTextTemplates = LocalizedMessages{
+		"es": "Su código es [code] [longcode]",
+		"de": "Ihr Code",
+		"fr": strings.Repeat("a", maxSMSTextTemplateLength) + " [code]",
+	}
+	_ = realm.BeforeSave(nil)
+	if got, want := len(realm.ErrorsFor("smsTextTemplates")), 3; got != want {
+		t.Errorf("expected %d errors, got %v", want, realm.ErrorsFor("smsTextTemplates"))
+	}
+}
+
+func TestRealm_EmailCodeTemplates(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.EnableEmailCodes = true
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("emailCodeTemplate"); len(errs) == 0 {
+		t.Errorf("expected blank template to be invalid when email codes are enabled")
+	}
+
+	realm = NewRealmWithDefaults("test")
+	realm.EnableEmailCodes = true
+	realm.EmailCodeTemplate = "Your code is [code]"
+	realm.EmailCodeTemplates = LocalizedMessages{
+		"es": "Su código es [code]",
+	}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("emailCodeTemplate"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if errs := realm.ErrorsFor("emailCodeTemplates"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+
+	if got, want := realm.BuildLocalizedEmailCodeText("es-MX", "123456", "abcdefgh12345678", ""), "Su código es 123456"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := realm.BuildLocalizedEmailCodeText("", "123456", "abcdefgh12345678", ""), "Your code is 123456"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	realm.EmailCodeTemplate = "Your code"
+	realm.EmailCodeTemplates = LocalizedMessages{
+		"es": "Su código es [code] [longcode]",
+	}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("emailCodeTemplate"); len(errs) == 0 {
+		t.Errorf("expected template without a code to be invalid")
+	}
+	if errs := realm.ErrorsFor("emailCodeTemplates"); len(errs) == 0 {
+		t.Errorf("expected template with both codes to be invalid")
+	}
+}
+
+func TestRealm_IssueFieldLimits(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if keys, size := realm.MetadataLimits(10, 1024); keys != 10 || size != 1024 {
+		t.Errorf("expected server limits, got %d, %d", keys, size)
+	}
+	if got, want := realm.ExternalIDLengthLimit(255), uint(255); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	realm.MaxMetadataKeys = 5
+	realm.MaxMetadataBytes = 2048
+	realm.MaxExternalIDLength = 64
+	if keys, size := realm.MetadataLimits(10, 1024); keys != 5 || size != 1024 {
+		t.Errorf("expected lower limits, got %d, %d", keys, size)
+	}
+	if got, want := realm.ExternalIDLengthLimit(255), uint(64); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	realm.MaxMetadataKeys = MaxCodeMetadataKeys + 1
+	realm.MaxMetadataBytes = MaxCodeMetadataSize + 1
+	realm.MaxExternalIDLength = MaxIssuingExternalIDLength + 1
+	_ = realm.BeforeSave(nil)
+	for _, field := range []string{"maxMetadataKeys", "maxMetadataBytes", "maxExternalIDLength"} {
+		if errs := realm.ErrorsFor(field); len(errs) != 1 {
+			t.Errorf("expected error for %s, got %v", field, errs)
+		}
+	}
+}
+
+func TestRealm_ExternalIDFormat(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if !realm.ExternalIDMatchesFormat("anything") {
+		t.Errorf("expected any ID to match without a format")
+	}
+
+	realm.RequireExternalID = true
+	realm.ExternalIDFormat = " CASE-[0-9]{4} "
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("externalIDFormat"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	for id, want := range map[string]bool{
+		"CASE-1234":   true,
+		"CASE-12345":  false,
+		"xCASE-1234":  false,
+		"case-1234":   false,
+		"CASE-1234\n": false,
+	} {
+		if got := realm.ExternalIDMatchesFormat(id); got != want {
+			t.Errorf("expected %q to match to be %t", id, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		require bool
+		format  string
+	}{
+		{require: true, format: "CASE-[0-9"},
+		{require: false, format: "CASE-[0-9]{4}"},
+	} {
+		realm := NewRealmWithDefaults("test")
+		realm.RequireExternalID = tc.require
+		realm.ExternalIDFormat = tc.format
+		_ = realm.BeforeSave(nil)
+		if errs := realm.ErrorsFor("externalIDFormat"); len(errs) == 0 {
+			t.Errorf("expected %q (required %t) to be invalid", tc.format, tc.require)
+		}
+	}
+}
+
+func TestRealm_AutofillTestDate(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) *time.Time {
+		t := time.Date(2020, 11, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	cases := []struct {
+		name     string
+		autofill bool
+		symptom  *time.Time
+		test     *time.Time
+		violated bool
+	}{
+		{name: "disabled", symptom: day(10), test: day(1)},
+		{name: "missing_symptom", autofill: true, test: day(1)},
+		{name: "missing_test", autofill: true, symptom: day(10)},
+		{name: "same_day", autofill: true, symptom: day(10), test: day(10)},
+		{name: "test_after", autofill: true, symptom: day(10), test: day(12)},
+		{name: "test_before", autofill: true, symptom: day(10), test: day(9), violated: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := NewRealmWithDefaults("test")
+			realm.AutofillTestDate = tc.autofill
+			if got := realm.AutofillDateOrderViolated(tc.symptom, tc.test); got != tc.violated {
+				t.Errorf("expected %t to be %t", got, tc.violated)
+			}
+		})
+	}
+
+	offsets := []struct {
+		days uint
+		err  bool
+	}{
+		{days: 0},
+		{days: MaxTestDateOffsetDays},
+		{days: MaxTestDateOffsetDays + 1, err: true},
+	}
+	for _, tc := range offsets {
+		realm := NewRealmWithDefaults("test")
+		realm.AutofillTestDate = true
+		realm.TestDateOffsetDays = tc.days
+		_ = realm.BeforeSave(nil)
+		if got := len(realm.ErrorsFor("testDateOffsetDays")) > 0; got != tc.err {
+			t.Errorf("%d days: expected error to be %t, got %v", tc.days, tc.err, realm.ErrorsFor("testDateOffsetDays"))
+		}
+	}
+}
+
+func TestRealm_DateOrderViolated(t *testing.T) {
+	t.Parallel()
+
+	day := func(d int) *time.Time {
+		t := time.Date(2020, 11, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	realm := NewRealmWithDefaults("test")
+	if realm.DateOrderViolated(day(10), day(1)) {
+		t.Errorf("expected no violation when the date order is not enforced")
+	}
+
+	realm.EnforceDateOrder = true
+	cases := []struct {
+		name     string
+		gap      int
+		symptom  *time.Time
+		test     *time.Time
+		violated bool
+	}{
+		{name: "missing_symptom", test: day(1)},
+		{name: "missing_test", symptom: day(10)},
+		{name: "same_day", symptom: day(10), test: day(10)},
+		{name: "test_after", symptom: day(10), test: day(12)},
+		{name: "test_before", symptom: day(10), test: day(9), violated: true},
+		{name: "within_gap", gap: 2, symptom: day(10), test: day(8)},
+		{name: "beyond_gap", gap: 2, symptom: day(10), test: day(7), violated: true},
+	}
+
+	for _, tc := range cases {
+		realm.MaxTestBeforeSymptomDays = tc.gap
+		if got := realm.DateOrderViolated(tc.symptom, tc.test); got != tc.violated {
+			t.Errorf("%s: expected %t to be %t", tc.name, got, tc.violated)
+		}
+	}
+
+	for _, gap := range []int{-1, MaxTestBeforeSymptomDays + 1} {
+		realm := NewRealmWithDefaults("test")
+		realm.MaxTestBeforeSymptomDays = gap
+		_ = realm.BeforeSave(nil)
+		if errs := realm.ErrorsFor("maxTestBeforeSymptomDays"); len(errs) != 1 {
+			t.Errorf("expected error for gap %d, got %v", gap, errs)
+		}
+	}
+}
+
+func TestRealm_MaxIssueDate(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	realm.FutureDateTolerance = FromDuration(5 * time.Minute)
+
+	today := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	cases := []struct {
+		name string
+		now  time.Time
+		exp  time.Time
+	}{
+		{name: "midday", now: today.Add(12 * time.Hour), exp: today},
+		{name: "before_tolerance", now: tomorrow.Add(-6 * time.Minute), exp: today},
+		{name: "within_tolerance", now: tomorrow.Add(-4 * time.Minute), exp: tomorrow},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := realm.MaxIssueDate(tc.now); !got.Equal(tc.exp) {
+				t.Errorf("expected %v to be %v", got, tc.exp)
+			}
+		})
+	}
+
+	for _, d := range []time.Duration{-1 * time.Minute, MaxFutureDateTolerance + time.Minute} {
+		realm := NewRealmWithDefaults("test")
+		realm.FutureDateTolerance = FromDuration(d)
+		_ = realm.BeforeSave(nil)
+		if errs := realm.ErrorsFor("futureDateTolerance"); len(errs) == 0 {
+			t.Errorf("expected %s to be invalid", d)
+		}
+	}
+}
+
+func TestRealm_TestTypeSunsets(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(24 * time.Hour)
+
+	realm := NewRealmWithDefaults("test")
+	realm.LikelySunsetAt = &past
+	realm.NegativeSunsetAt = &future
+
+	if realm.TestTypeSunsetPassed("confirmed", now) {
+		t.Errorf("expected confirmed to have no sunset")
+	}
+	if !realm.TestTypeSunsetPassed("LIKELY", now) {
+		t.Errorf("expected likely sunset to have passed")
+	}
+	if realm.TestTypeSunsetPassed("negative", now) {
+		t.Errorf("expected negative sunset to be upcoming")
+	}
+
+	upcoming := realm.UpcomingTestTypeSunsets(now)
+	if got, want := len(upcoming), 1; got != want {
+		t.Fatalf("expected %d upcoming sunsets to be %d: %v", got, want, upcoming)
+	}
+	if got := upcoming["negative"]; !got.Equal(future) {
+		t.Errorf("expected %v to be %v", got, future)
+	}
+
+	// Sunsets for test types which are not allowed are not upcoming.
+	realm.AllowedTestTypes = TestTypeConfirmed | TestTypeLikely
+	if upcoming := realm.UpcomingTestTypeSunsets(now); len(upcoming) != 0 {
+		t.Errorf("expected no upcoming sunsets, got %v", upcoming)
+	}
+}
+
+func TestParseLocalizedMessages(t *testing.T) {
+	t.Parallel()
+
+	m, err := ParseLocalizedMessages("")
+	if err != nil || len(m) != 0 {
+		t.Errorf("expected empty messages, got %v, %v", m, err)
+	}
+
+	m, err = ParseLocalizedMessages(`{"es": "Hola"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m["es"], "Hola"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if _, err := ParseLocalizedMessages(`["es"]`); err == nil {
+		t.Errorf("expected error for non-object")
+	}
+
+	var scanned LocalizedMessages
+	v, err := m.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scanned.Scan([]byte(v.(string))); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := scanned["es"], "Hola"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
 func TestPerUserRealmStats(t *testing.T) {
 	t.Parallel()
 
@@ -108,6 +1014,113 @@ func TestPerUserRealmStats(t *testing.T) {
 	}
 }
 
+func TestSaveRealm_UniqueRegionCodes(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	db.config.EnforceUniqueRegionCodes = true
+
+	realm1 := NewRealmWithDefaults("realm1")
+	realm1.RegionCode = "US-AA"
+	if err := db.SaveRealm(realm1, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saving the same realm again is not a conflict.
+	if err := db.SaveRealm(realm1, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	realm2 := NewRealmWithDefaults("realm2")
+	realm2.RegionCode = "us-aa"
+	if err := db.SaveRealm(realm2, SystemTest); err == nil {
+		t.Fatal("expected error")
+	}
+	if errs := realm2.ErrorsFor("regionCode"); len(errs) == 0 {
+		t.Errorf("expected errors for regionCode")
+	}
+
+	// The unique index rejects conflicts which the check does not see, such as
+	// concurrent saves.
+	realm4 := NewRealmWithDefaults("realm4")
+	realm4.RegionCode = "US-BB"
+	if err := db.SaveRealm(realm4, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.db.Exec("UPDATE realms SET region_code = ? WHERE id = ?", "US-AA", realm4.ID).Error; !isRegionCodeConflict(err) {
+		t.Errorf("expected %v to be a region code conflict", err)
+	}
+
+	// Deleted realms keep their region code.
+	if err := db.db.Delete(realm4).Error; err != nil {
+		t.Fatal(err)
+	}
+	realm5 := NewRealmWithDefaults("realm5")
+	realm5.RegionCode = "US-BB"
+	if err := db.SaveRealm(realm5, SystemTest); err == nil {
+		t.Fatal("expected error")
+	}
+	if errs := realm5.ErrorsFor("regionCode"); len(errs) == 0 {
+		t.Errorf("expected errors for regionCode")
+	}
+
+	// Deployments which opt out are migrated without the unique index. Realms
+	// can then share a region and the oldest is found.
+	if err := relaxRegionCodeUniqueness(db.db); err != nil {
+		t.Fatal(err)
+	}
+	db.config.EnforceUniqueRegionCodes = false
+
+	realm3 := NewRealmWithDefaults("realm3")
+	realm3.RegionCode = "US-AA"
+	if err := db.SaveRealm(realm3, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindRealmByRegion("US-AA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != realm1.ID {
+		t.Errorf("expected realm %d to be %d", got.ID, realm1.ID)
+	}
+}
+
+func TestSaveRealm_TestTypeSunsets(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("realm")
+	past := time.Now().Add(-time.Hour)
+	realm.ConfirmedSunsetAt = &past
+	if err := db.SaveRealm(realm, SystemTest); err == nil {
+		t.Fatal("expected error")
+	}
+	if errs := realm.ErrorsFor("confirmedSunsetAt"); len(errs) == 0 {
+		t.Errorf("expected errors for confirmedSunsetAt")
+	}
+
+	realm = NewRealmWithDefaults("realm")
+	future := time.Now().Add(time.Hour)
+	realm.ConfirmedSunsetAt = &future
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the sunset passes, saving the realm without changing it is allowed.
+	if err := db.RawDB().Model(realm).UpdateColumn("confirmed_sunset_at", past).Error; err != nil {
+		t.Fatal(err)
+	}
+	realm, err := db.FindRealm(realm.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestRealm_FindMobileApp(t *testing.T) {
 	t.Parallel()
 
@@ -219,3 +1232,109 @@ func TestRealm_CreateSigningKeyVersion(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRealm_DeepLinkMetadata(t *testing.T) {
+	t.Parallel()
+
+	metadata := CodeMetadata{
+		"clinic":  "north",
+		"lot":     "A-123",
+		"testKit": "rapid",
+	}
+
+	realm := NewRealmWithDefaults("test")
+	if got := realm.DeepLinkMetadata(metadata); got != nil {
+		t.Errorf("expected no metadata by default, got %v", got)
+	}
+
+	realm.UseRealmCertificateKey = true
+	realm.DeepLinkMetadataKeys = []string{" clinic ", "lot", "clinic", "missing", ""}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("deepLinkMetadataKeys"); len(errs) > 0 {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	if diff := cmp.Diff([]string{"clinic", "lot", "missing"}, []string(realm.DeepLinkMetadataKeys)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(CodeMetadata{"clinic": "north", "lot": "A-123"}, realm.DeepLinkMetadata(metadata)); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	realm = NewRealmWithDefaults("test")
+	realm.DeepLinkMetadataKeys = []string{"clinic"}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("deepLinkMetadataKeys"); len(errs) == 0 {
+		t.Errorf("expected keys to require realm-specific signing keys")
+	}
+
+	realm = NewRealmWithDefaults("test")
+	realm.UseRealmCertificateKey = true
+	realm.DeepLinkMetadataKeys = []string{"patientEmail", "1lot"}
+	_ = realm.BeforeSave(nil)
+	if errs := realm.ErrorsFor("deepLinkMetadataKeys"); len(errs) != 2 {
+		t.Errorf("expected PII and invalid keys to be rejected, got %v", errs)
+	}
+}
+
+func TestRealm_DisableLongCodes(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		disable     bool
+		enxExpress  bool
+		template    string
+		expTemplate bool
+		expDisable  bool
+	}{
+		{
+			name:     "enabled",
+			template: "Your code is [longcode], expires in [longexpires] hours",
+		},
+		{
+			name:     "disabled_short_template",
+			disable:  true,
+			template: "Your code is [code], expires in [expires] minutes",
+		},
+		{
+			name:        "disabled_long_code_template",
+			disable:     true,
+			template:    "Your code is [longcode]",
+			expTemplate: true,
+		},
+		{
+			name:        "disabled_long_expires_template",
+			disable:     true,
+			template:    "Your code is [code], expires in [longexpires] hours",
+			expTemplate: true,
+		},
+		{
+			name:       "disabled_en_express",
+			disable:    true,
+			enxExpress: true,
+			template:   "Your code is [enslink]",
+			expDisable: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			realm := NewRealmWithDefaults("test")
+			realm.DisableLongCodes = tc.disable
+			realm.EnableENExpress = tc.enxExpress
+			realm.SMSTextTemplate = tc.template
+
+			_ = realm.BeforeSave(nil)
+			if got := len(realm.ErrorsFor("SMSTextTemplate")) > 0; got != tc.expTemplate {
+				t.Errorf("expected template error to be %t, got %v", tc.expTemplate, realm.ErrorsFor("SMSTextTemplate"))
+			}
+			if got := len(realm.ErrorsFor("disableLongCodes")) > 0; got != tc.expDisable {
+				t.Errorf("expected disableLongCodes error to be %t, got %v", tc.expDisable, realm.ErrorsFor("disableLongCodes"))
+			}
+		})
+	}
+}
@@ -41,6 +41,9 @@ type RealmUserStat struct {
 	Name        string
 	Email       string
 	CodesIssued uint
+
+	// CodesSupervised is the number of codes issued under the user's supervision.
+	CodesSupervised uint
 }
 
 // MarshalCSV returns bytes in CSV format.
@@ -53,7 +56,7 @@ func (s RealmUserStats) MarshalCSV() ([]byte, error) {
 	var b bytes.Buffer
 	w := csv.NewWriter(&b)
 
-	if err := w.Write([]string{"date", "realm_id", "user_id", "name", "email", "codes_issued"}); err != nil {
+	if err := w.Write([]string{"date", "realm_id", "user_id", "name", "email", "codes_issued", "codes_supervised"}); err != nil {
 		return nil, fmt.Errorf("failed to write CSV header: %w", err)
 	}
 
@@ -65,6 +68,7 @@ func (s RealmUserStats) MarshalCSV() ([]byte, error) {
 			stat.Name,
 			stat.Email,
 			strconv.FormatUint(uint64(stat.CodesIssued), 10),
+			strconv.FormatUint(uint64(stat.CodesSupervised), 10),
 		}); err != nil {
 			return nil, fmt.Errorf("failed to write CSV entry %d: %w", i, err)
 		}
@@ -89,10 +93,11 @@ type jsonRealmUserStatStats struct {
 }
 
 type jsonRealmUserStatIssuerData struct {
-	UserID      uint   `json:"user_id"`
-	Name        string `json:"name"`
-	Email       string `json:"email"`
-	CodesIssued uint   `json:"codes_issued"`
+	UserID          uint   `json:"user_id"`
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	CodesIssued     uint   `json:"codes_issued"`
+	CodesSupervised uint   `json:"codes_supervised"`
 }
 
 // MarshalJSON is a custom JSON marshaller.
@@ -109,10 +114,11 @@ func (s RealmUserStats) MarshalJSON() ([]byte, error) {
 		}
 
 		m[stat.Date] = append(m[stat.Date], &jsonRealmUserStatIssuerData{
-			UserID:      stat.UserID,
-			Name:        stat.Name,
-			Email:       stat.Email,
-			CodesIssued: stat.CodesIssued,
+			UserID:          stat.UserID,
+			Name:            stat.Name,
+			Email:           stat.Email,
+			CodesIssued:     stat.CodesIssued,
+			CodesSupervised: stat.CodesSupervised,
 		})
 	}
 
@@ -153,12 +159,13 @@ func (s *RealmUserStats) UnmarshalJSON(b []byte) error {
 	for _, stat := range result.Stats {
 		for _, r := range stat.IssuerData {
 			*s = append(*s, &RealmUserStat{
-				Date:        stat.Date,
-				RealmID:     result.RealmID,
-				UserID:      r.UserID,
-				Name:        r.Name,
-				Email:       r.Email,
-				CodesIssued: r.CodesIssued,
+				Date:            stat.Date,
+				RealmID:         result.RealmID,
+				UserID:          r.UserID,
+				Name:            r.Name,
+				Email:           r.Email,
+				CodesIssued:     r.CodesIssued,
+				CodesSupervised: r.CodesSupervised,
 			})
 		}
 	}
@@ -0,0 +1,100 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// StandardReportTypes maps each test type to the report type used in
+// verification certificates by default. These are the report types the
+// exposure notifications key server understands.
+var StandardReportTypes = map[string]string{
+	"confirmed": "confirmed",
+	"likely":    "likely",
+	"negative":  "negative",
+}
+
+// reportTypeRe is the allowed format of a mapped report type.
+var reportTypeRe = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+// ParseReportTypeMapping parses and validates a report type mapping. The
+// mapping is a JSON object whose keys are test types and whose values are the
+// report types to send to the key server instead. The mapping must include
+// every test type in allowed, so that no code can be claimed without a report
+// type.
+//
+// An empty string is the standard mapping and returns a nil map.
+func ParseReportTypeMapping(s string, allowed TestType) (map[string]string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, fmt.Errorf("must be a JSON object of test types to report types: %w", err)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, ok := StandardReportTypes[k]; !ok {
+			return nil, fmt.Errorf("unknown test type %q, must be one of confirmed, likely, negative", k)
+		}
+		if v := m[k]; !reportTypeRe.MatchString(v) {
+			return nil, fmt.Errorf("invalid report type %q for %s, must be letters, numbers, dashes, and underscores", v, k)
+		}
+	}
+
+	var missing []string
+	for _, name := range allowed.Names() {
+		if _, ok := m[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing report type for %s", strings.Join(missing, ", "))
+	}
+
+	return m, nil
+}
+
+// ReportTypeFor returns the report type to send to the key server for codes of
+// the given test type, using the realm's report type mapping if it has one.
+// Test types which are not in the mapping, such as codes issued before the
+// realm's allowed test types changed, use the standard report type.
+func (r *Realm) ReportTypeFor(testType string) (string, error) {
+	m, err := ParseReportTypeMapping(r.ReportTypeMapping, r.AllowedTestTypes)
+	if err != nil {
+		return "", fmt.Errorf("invalid report type mapping: %w", err)
+	}
+
+	if v, ok := m[testType]; ok {
+		return v, nil
+	}
+	if v, ok := StandardReportTypes[testType]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("no report type for test type %q", testType)
+}
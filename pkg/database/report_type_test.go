@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseReportTypeMapping(t *testing.T) {
+	t.Parallel()
+
+	all := TestTypeConfirmed | TestTypeLikely | TestTypeNegative
+
+	cases := []struct {
+		name    string
+		input   string
+		allowed TestType
+		exp     map[string]string
+		experr  bool
+	}{
+		{name: "empty", input: "", allowed: all, exp: nil},
+		{
+			name:    "all_types",
+			input:   `{"confirmed": "CONFIRMED_TEST", "likely": "clinical", "negative": "negative"}`,
+			allowed: all,
+			exp:     map[string]string{"confirmed": "CONFIRMED_TEST", "likely": "clinical", "negative": "negative"},
+		},
+		{
+			name:    "only_allowed",
+			input:   `{"confirmed": "positive"}`,
+			allowed: TestTypeConfirmed,
+			exp:     map[string]string{"confirmed": "positive"},
+		},
+		{name: "missing_allowed", input: `{"confirmed": "positive"}`, allowed: all, experr: true},
+		{name: "not_json", input: `confirmed=positive`, allowed: all, experr: true},
+		{name: "unknown_type", input: `{"confirmed": "a", "likely": "b", "negative": "c", "recursive": "d"}`, allowed: all, experr: true},
+		{name: "empty_value", input: `{"confirmed": ""}`, allowed: TestTypeConfirmed, experr: true},
+		{name: "invalid_value", input: `{"confirmed": "a b"}`, allowed: TestTypeConfirmed, experr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseReportTypeMapping(tc.input, tc.allowed)
+			if (err != nil) != tc.experr {
+				t.Fatalf("expected error to be %t, got %v", tc.experr, err)
+			}
+			if diff := cmp.Diff(tc.exp, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRealm_ReportTypeFor(t *testing.T) {
+	t.Parallel()
+
+	realm := NewRealmWithDefaults("test")
+	if got, err := realm.ReportTypeFor("likely"); err != nil || got != "likely" {
+		t.Errorf("expected standard report type, got %q (%v)", got, err)
+	}
+
+	realm.AllowedTestTypes = TestTypeConfirmed
+	realm.ReportTypeMapping = `{"confirmed": "positive"}`
+	if got, err := realm.ReportTypeFor("confirmed"); err != nil || got != "positive" {
+		t.Errorf("expected mapped report type, got %q (%v)", got, err)
+	}
+	if got, err := realm.ReportTypeFor("negative"); err != nil || got != "negative" {
+		t.Errorf("expected standard report type for unmapped type, got %q (%v)", got, err)
+	}
+	if _, err := realm.ReportTypeFor("bogus"); err == nil {
+		t.Errorf("expected error for unknown test type")
+	}
+}
@@ -90,6 +90,14 @@ func WithRealmSearch(q string) Scope {
 	}
 }
 
+// WithoutPendingRealms excludes realms which are waiting for approval. It's
+// only applicable to functions that query Realm.
+func WithoutPendingRealms() Scope {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("realms.pending_approval IS FALSE")
+	}
+}
+
 // WithoutAuditTest excludes audit entries related to test entries created from
 // SystemTest.
 func WithoutAuditTest() Scope {
@@ -0,0 +1,144 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// MaxSMSRetryAttempts is the number of times a queued text message is
+	// retried before it is dropped.
+	MaxSMSRetryAttempts = 5
+
+	// smsRetryBackoff is the delay before the first retry. Each further retry
+	// waits this much longer than the previous one.
+	smsRetryBackoff = 5 * time.Minute
+)
+
+// SMSRetry is a text message which could not be sent when its code was issued
+// and is queued to be retried by the cleanup worker. The phone number and
+// message are encrypted, and the record is deleted once the message is sent or
+// dropped.
+type SMSRetry struct {
+	// ID is the primary key.
+	ID uint `gorm:"primary_key;"`
+
+	// RealmID is the realm which issued the code, and whose SMS configuration is
+	// used.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// VerificationCodeUUID is the UUID of the code in the message. The message
+	// is dropped if the code was claimed or expired.
+	VerificationCodeUUID string `gorm:"column:verification_code_uuid; type:uuid; not null;"`
+
+	// Phone and Message are encrypted.
+	Phone   string `gorm:"column:phone; type:text; not null;"`
+	Message string `gorm:"column:message; type:text; not null;"`
+
+	// Attempts is the number of retries so far, and LastError is the error from
+	// the most recent one.
+	Attempts  uint   `gorm:"column:attempts; type:integer; not null; default:0;"`
+	LastError string `gorm:"column:last_error; type:text;"`
+
+	// NextAttemptAt is the earliest time of the next retry.
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at; not null;"`
+
+	// ExpiresAt is when the code in the message expires.
+	ExpiresAt time.Time `gorm:"column:expires_at; not null;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName sets the table name.
+func (SMSRetry) TableName() string {
+	return "sms_retries"
+}
+
+// IsExpired returns true if the code in the message expired.
+func (r *SMSRetry) IsExpired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// QueueSMSRetry queues the text message for the code with the given UUID to be
+// retried. The first retry is after smsRetryBackoff.
+func (db *Database) QueueSMSRetry(realmID uint, uuid, phone, message string, expiresAt time.Time) (*SMSRetry, error) {
+	now := time.Now().UTC()
+	retry := &SMSRetry{
+		RealmID:              realmID,
+		VerificationCodeUUID: uuid,
+		Phone:                phone,
+		Message:              message,
+		NextAttemptAt:        now.Add(smsRetryBackoff),
+		ExpiresAt:            expiresAt.UTC(),
+	}
+
+	if err := db.db.Create(retry).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue sms retry: %w", err)
+	}
+	return retry, nil
+}
+
+// ListDueSMSRetries returns up to limit queued text messages whose next retry
+// is due, oldest first.
+func (db *Database) ListDueSMSRetries(now time.Time, limit int) ([]*SMSRetry, error) {
+	var retries []*SMSRetry
+	if err := db.db.
+		Where("next_attempt_at <= ?", now.UTC()).
+		Order("next_attempt_at ASC").
+		Limit(limit).
+		Find(&retries).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return retries, nil
+		}
+		return nil, err
+	}
+	return retries, nil
+}
+
+// RecordSMSRetryFailure records a failed retry and schedules the next one. It
+// returns false if the message has no attempts left, in which case the caller
+// should delete it.
+func (db *Database) RecordSMSRetryFailure(r *SMSRetry, sendErr error, now time.Time) (bool, error) {
+	r.Attempts++
+	r.LastError = sendErr.Error()
+	r.NextAttemptAt = now.UTC().Add(time.Duration(r.Attempts+1) * smsRetryBackoff)
+
+	// Update through an empty model so the encrypted columns are not
+	// re-encrypted.
+	if err := db.db.
+		Model(&SMSRetry{}).
+		Where("id = ?", r.ID).
+		UpdateColumns(map[string]interface{}{
+			"attempts":        r.Attempts,
+			"last_error":      r.LastError,
+			"next_attempt_at": r.NextAttemptAt,
+		}).
+		Error; err != nil {
+		return false, fmt.Errorf("failed to record sms retry failure: %w", err)
+	}
+	return r.Attempts < MaxSMSRetryAttempts, nil
+}
+
+// DeleteSMSRetry deletes the queued text message.
+func (db *Database) DeleteSMSRetry(r *SMSRetry) error {
+	return db.db.
+		Where("id = ?", r.ID).
+		Delete(&SMSRetry{}).
+		Error
+}
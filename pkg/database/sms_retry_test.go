@@ -0,0 +1,98 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDatabase_SMSRetries(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	now := time.Now().UTC()
+	codeUUID := uuid.Must(uuid.NewRandom()).String()
+
+	retry, err := db.QueueSMSRetry(1, codeUUID, "+15005550006", "Your code is 123456", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first retry is not due yet.
+	due, err := db.ListDueSMSRetries(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(due); got != 0 {
+		t.Fatalf("expected no due retries, got %d", got)
+	}
+
+	due, err = db.ListDueSMSRetries(now.Add(smsRetryBackoff), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(due); got != 1 {
+		t.Fatalf("expected 1 due retry, got %d", got)
+	}
+	if got, want := due[0].Phone, "+15005550006"; got != want {
+		t.Errorf("expected phone %q to be %q", got, want)
+	}
+	if got, want := due[0].Message, "Your code is 123456"; got != want {
+		t.Errorf("expected message %q to be %q", got, want)
+	}
+	if due[0].IsExpired(now) {
+		t.Errorf("expected retry not to be expired")
+	}
+
+	// The stored values are encrypted.
+	var raw struct {
+		Phone string
+	}
+	if err := db.db.Raw("SELECT phone FROM sms_retries WHERE id = ?", retry.ID).Scan(&raw).Error; err != nil {
+		t.Fatal(err)
+	}
+	if raw.Phone == "" || raw.Phone == "+15005550006" {
+		t.Errorf("expected phone to be encrypted, got %q", raw.Phone)
+	}
+
+	for i := uint(1); i <= MaxSMSRetryAttempts; i++ {
+		keep, err := db.RecordSMSRetryFailure(retry, errors.New("unavailable"), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := i < MaxSMSRetryAttempts; keep != want {
+			t.Errorf("attempt %d: expected keep to be %t", i, want)
+		}
+	}
+	if got, want := retry.NextAttemptAt, now.Add((MaxSMSRetryAttempts+1)*smsRetryBackoff); !got.Equal(want) {
+		t.Errorf("expected next attempt %s to be %s", got, want)
+	}
+
+	if err := db.DeleteSMSRetry(retry); err != nil {
+		t.Fatal(err)
+	}
+	due, err = db.ListDueSMSRetries(now.Add(24*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(due); got != 0 {
+		t.Errorf("expected no retries after delete, got %d", got)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/jinzhu/gorm"
+)
+
+// ErrQueryTimeout is returned when a transaction exceeds the configured query
+// timeout. The transaction is rolled back, so the operation can be retried.
+var ErrQueryTimeout = errors.New("database query timed out")
+
+// IsQueryTimeout returns true if the error is a query timeout.
+func IsQueryTimeout(err error) bool {
+	return errors.Is(err, ErrQueryTimeout)
+}
+
+// transactionContext runs fn in a transaction that is bound to the context,
+// with the configured query timeout applied. gorm does not otherwise propagate
+// contexts to the sql layer, so this is how queries are cancelled.
+//
+// If the deadline passes, the driver cancels the in-flight statement and the
+// whole transaction is rolled back, so a timeout never leaves partial writes.
+func (db *Database) transactionContext(ctx context.Context, name string, fn func(tx *gorm.DB) error) (err error) {
+	timeout := db.config.QueryTimeout
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	defer func() {
+		if err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+
+		logger := logging.FromContext(ctx).Named("database.transactionContext")
+		logger.Warnw("query timed out",
+			"operation", name,
+			"timeout", timeout,
+			"elapsed", time.Since(start),
+			"error", err)
+		err = fmt.Errorf("%w: %s: %v", ErrQueryTimeout, name, err)
+	}()
+
+	tx := db.db.BeginTx(ctx, nil)
+	if err := tx.Error; err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
@@ -15,6 +15,7 @@
 package database
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
@@ -24,6 +25,8 @@ import (
 
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
 	"github.com/jinzhu/gorm"
 )
 
@@ -33,13 +36,19 @@ const (
 )
 
 var (
-	ErrVerificationCodeNotFound = errors.New("verification code not found")
-	ErrVerificationCodeExpired  = errors.New("verification code expired")
-	ErrVerificationCodeUsed     = errors.New("verification code used")
-	ErrTokenExpired             = errors.New("verification token expired")
-	ErrTokenUsed                = errors.New("verification token used")
-	ErrTokenMetadataMismatch    = errors.New("verification token test metadata mismatch")
-	ErrUnsupportedTestType      = errors.New("verification code has unsupported test type")
+	ErrVerificationCodeNotFound  = errors.New("verification code not found")
+	ErrVerificationCodeExpired   = errors.New("verification code expired")
+	ErrVerificationCodeUsed      = errors.New("verification code used")
+	ErrTokenExpired              = errors.New("verification token expired")
+	ErrTokenUsed                 = errors.New("verification token used")
+	ErrTokenMetadataMismatch     = errors.New("verification token test metadata mismatch")
+	ErrUnsupportedTestType       = errors.New("verification code has unsupported test type")
+	ErrTokenDeviceMismatch       = errors.New("verification token bound to a different device")
+	ErrAppNotAllowed             = errors.New("app is not allowed to claim codes")
+	ErrVerificationCodePending   = errors.New("verification code is pending approval")
+	ErrVerificationCodeBadExpiry = errors.New("verification code expiry is outside of policy bounds")
+	ErrTooManyClaimAttempts      = errors.New("verification code expired after too many failed claim attempts")
+	ErrTooManyExternalIDClaims   = errors.New("too many claim attempts for codes with this external ID")
 )
 
 // Token represents an issued "long term" from a validated verification code.
@@ -53,6 +62,11 @@ type Token struct {
 	TestDate    *time.Time
 	Used        bool `gorm:"default:false"`
 	ExpiresAt   time.Time
+
+	// DeviceFingerprint is the HMAC of the fingerprint of the device that
+	// verified the code, if the realm binds tokens to devices. It is deleted
+	// along with the token.
+	DeviceFingerprint string `gorm:"type:text"`
 }
 
 // Subject represents the data that is used in the 'sub' field of the token JWT.
@@ -139,8 +153,14 @@ func (t *Token) Subject() *Subject {
 
 // ClaimToken looks up the token by ID, verifies that it is not expired and that
 // the specified subject matches the parameters that were configured when issued.
-func (db *Database) ClaimToken(realmID uint, tokenID string, subject *Subject) error {
-	return db.db.Transaction(func(tx *gorm.DB) error {
+// If the token is bound to a device, the deviceFingerprint must match.
+func (db *Database) ClaimToken(ctx context.Context, realmID uint, tokenID string, subject *Subject, deviceFingerprint string) error {
+	hmacedFingerprints, err := db.generateVerificationCodeHMACs(deviceFingerprint)
+	if err != nil {
+		return fmt.Errorf("failed to create hmac: %w", err)
+	}
+
+	return db.transactionContext(ctx, "ClaimToken", func(tx *gorm.DB) error {
 		var tok Token
 		if err := tx.
 			Set("gorm:query_option", "FOR UPDATE").
@@ -179,41 +199,182 @@ func (db *Database) ClaimToken(realmID uint, tokenID string, subject *Subject) e
 			return ErrTokenMetadataMismatch
 		}
 
+		if tok.DeviceFingerprint != "" && !containsString(hmacedFingerprints, tok.DeviceFingerprint) {
+			db.logger.Debugw("tried to claim token from a different device", "ID", tok.ID)
+			return ErrTokenDeviceMismatch
+		}
+
 		tok.Used = true
 		return tx.Save(&tok).Error
 	})
 }
 
+// IssueTokenRequest is the input to VerifyCodeAndIssueToken.
+type IssueTokenRequest struct {
+	RealmID uint
+
+	// VerificationCode can be the "short code" or the "long code" which impacts
+	// expiry time, or a signed claim link token which embeds either.
+	VerificationCode string
+	AcceptTypes      api.AcceptTypes
+	ExpireAfter      time.Duration // must be no more than MaxTokenDuration
+
+	// NegativeExpireAfter, if not zero, is used instead of ExpireAfter when the
+	// code is for a negative test result.
+	NegativeExpireAfter time.Duration
+
+	// DeviceFingerprint, if not empty, binds the token to the device.
+	DeviceFingerprint string
+
+	// AppID is the identifier of the app claiming the code. If AllowedAppIDs is
+	// not empty, it must be one of those values.
+	AppID         string
+	AllowedAppIDs []string
+
+	// CaseInsensitive matches the code regardless of case. The code must have
+	// been stored in normalized form.
+	CaseInsensitive bool
+
+	// CodeSeparators are characters removed from the code before it is matched.
+	// They are not removed from claim links.
+	CodeSeparators string
+
+	// LongCodeOnly only matches the code against long codes. Claim links always
+	// embed the long code, so they are still accepted.
+	LongCodeOnly bool
+
+	// MaxCodeDuration and MaxLongCodeDuration, if not zero, further limit how
+	// long after it was issued a code may be valid. Codes are always limited to
+	// the system maximums.
+	MaxCodeDuration     time.Duration
+	MaxLongCodeDuration time.Duration
+
+	// MaxFailedClaimAttempts, if not zero, is the number of failed claims after
+	// which the code is expired.
+	MaxFailedClaimAttempts uint
+
+	// MinClaimInterval, if not zero, is the minimum realistic time between
+	// issuing and claiming a code. Codes claimed sooner are counted as likely
+	// synthetic in the realm's stats, but are not rejected.
+	MinClaimInterval time.Duration
+
+	// CheckExternalID, if set, is called with the issuing external ID of the
+	// code being claimed, if the code has one. If it returns an error, the claim
+	// fails with that error and is not recorded on the code. This lets callers
+	// rate limit claims per external ID. It is called before the code is locked
+	// for the claim.
+	CheckExternalID func(ctx context.Context, externalID string) error
+}
+
 // VerifyCodeAndIssueToken takes a previously issued verification code and exchanges
 // it for a long term token. The verification code must not have expired and must
 // not have been previously used. Both acctions are done in a single database
 // transaction.
-// The verCode can be the "short code" or the "long code" which impacts expiry time.
 //
 // The long term token can be used later to sign keys when they are submitted.
-func (db *Database) VerifyCodeAndIssueToken(realmID uint, verCode string, acceptTypes api.AcceptTypes, expireAfter time.Duration) (*Token, error) {
+func (db *Database) VerifyCodeAndIssueToken(ctx context.Context, req *IssueTokenRequest) (*Token, error) {
+	realmID, verCode, acceptTypes, expireAfter := req.RealmID, req.VerificationCode, req.AcceptTypes, req.ExpireAfter
+
+	// Reject disallowed apps before looking up the code, so that a leaked code
+	// is not consumed by an unauthorized client.
+	if len(req.AllowedAppIDs) > 0 && !containsString(req.AllowedAppIDs, req.AppID) {
+		db.logger.Debugw("app not allowed to claim codes", "realmID", realmID, "appID", req.AppID)
+		return nil, ErrAppNotAllowed
+	}
+
+	// A signed claim link embeds the code. Links are only accepted when claim
+	// links are enabled, otherwise they are treated as an unknown code.
+	if IsClaimLinkToken(verCode) {
+		if !db.ClaimLinksEnabled() {
+			return nil, ErrVerificationCodeNotFound
+		}
+
+		code, err := db.verifyClaimLink(verCode, realmID, time.Now())
+		if err != nil {
+			db.logger.Debugw("invalid claim link", "realmID", realmID, "error", err)
+			return nil, err
+		}
+		verCode = code
+	} else {
+		verCode = StripCodeSeparators(verCode, req.CodeSeparators)
+	}
+
+	if req.CaseInsensitive {
+		verCode = NormalizeCode(verCode)
+	}
+
 	hmacedCodes, err := db.generateVerificationCodeHMACs(verCode)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create hmac: %w", err)
 	}
 
+	var fingerprint string
+	if req.DeviceFingerprint != "" {
+		fingerprint, err = db.hmacDeviceFingerprint(req.DeviceFingerprint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Claims of codes for the same person are limited separately from the
+	// claims by any one client. The limit is checked before the transaction, so
+	// the code's row is not locked while the limiter is called.
+	if req.CheckExternalID != nil {
+		var found VerificationCode
+		query := whereClaimCode(db.db.Select("id, issuing_external_id"), realmID, hmacedCodes, req.LongCodeOnly)
+		if err := query.First(&found).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return nil, ErrVerificationCodeNotFound
+			}
+			return nil, err
+		}
+
+		if found.IssuingExternalID != "" {
+			if err := req.CheckExternalID(ctx, found.IssuingExternalID); err != nil {
+				db.logger.Debugw("claim rejected for external ID", "ID", found.ID, "error", err)
+				return nil, err
+			}
+		}
+	}
+
 	var tok *Token
-	err = db.db.Transaction(func(tx *gorm.DB) error {
+	var vc VerificationCode
+
+	// claimErr is a failed claim which still commits the transaction, so the
+	// failed attempt is recorded on the code.
+	var claimErr error
+	err = db.transactionContext(ctx, "VerifyCodeAndIssueToken", func(tx *gorm.DB) error {
 		// Load the verification code - do quick expiry and claim checks.
 		// Also lock the row for update.
-		var vc VerificationCode
-		if err := tx.
-			Set("gorm:query_option", "FOR UPDATE").
-			Where("realm_id = ?", realmID).
-			Where("(code IN (?) OR long_code IN (?))", hmacedCodes, hmacedCodes).
-			First(&vc).
-			Error; err != nil {
+		query := whereClaimCode(tx.Set("gorm:query_option", "FOR UPDATE"), realmID, hmacedCodes, req.LongCodeOnly)
+		if err := query.First(&vc).Error; err != nil {
 			if gorm.IsRecordNotFoundError(err) {
 				return ErrVerificationCodeNotFound
 			}
 			return err
 		}
 
+		// failClaim records a failed attempt to claim the code and commits it. The
+		// claim fails with the reason, or because the code was expired.
+		failClaim := func(reason error) error {
+			expired, err := db.recordFailedClaim(tx, &vc, req.MaxFailedClaimAttempts)
+			if err != nil {
+				return err
+			}
+			claimErr = reason
+			if expired {
+				claimErr = ErrTooManyClaimAttempts
+				return db.enqueueWebhookEvent(tx, webhook.EventExpired, &vc)
+			}
+			return nil
+		}
+
+		// Codes expired after too many failed claims stay rejected with the same
+		// error.
+		if req.MaxFailedClaimAttempts > 0 && vc.FailedClaimAttempts >= req.MaxFailedClaimAttempts {
+			return ErrTooManyClaimAttempts
+		}
+
 		// Validation
 		expired, codeType, err := db.IsCodeExpired(&vc, verCode)
 		if err != nil {
@@ -228,28 +389,97 @@ func (db *Database) VerifyCodeAndIssueToken(realmID uint, verCode string, accept
 			db.logger.Debugw("checked expired code already used", "ID", vc.ID, "codeType", codeType)
 			return ErrVerificationCodeUsed
 		}
+		if vc.IsApprovalExpired() {
+			db.logger.Debugw("checked code not approved in time", "ID", vc.ID)
+			return ErrVerificationCodeExpired
+		}
+		if vc.ApprovalStatus == ApprovalStatusPending {
+			db.logger.Debugw("checked code pending approval", "ID", vc.ID)
+			return failClaim(ErrVerificationCodePending)
+		}
+
+		// Codes issued by this server are always within bounds, so a code which
+		// is not was imported with bad values or modified in the database.
+		if !vc.HasValidExpiry(req.MaxCodeDuration, req.MaxLongCodeDuration) {
+			db.logger.Warnw("rejected code with expiry outside of policy bounds",
+				"ID", vc.ID,
+				"realmID", vc.RealmID,
+				"createdAt", vc.CreatedAt,
+				"expiresAt", vc.ExpiresAt,
+				"longExpiresAt", vc.LongExpiresAt)
+			return ErrVerificationCodeBadExpiry
+		}
 
 		if _, ok := acceptTypes[vc.TestType]; !ok {
 			db.logger.Debugw("checked not of accepted testType", "ID", vc.ID)
-			return ErrUnsupportedTestType
+			return failClaim(ErrUnsupportedTestType)
 		}
 
-		// Mark as claimed
-		vc.Claimed = true
+		// Deployment specific policy
+		if validators := claimValidatorsFor(vc.RealmID); len(validators) > 0 {
+			info := &ClaimInfo{
+				RealmID:     vc.RealmID,
+				TestType:    vc.TestType,
+				SymptomDate: vc.SymptomDate,
+				TestDate:    vc.TestDate,
+				IssuedAt:    vc.CreatedAt,
+				ExternalID:  vc.IssuingExternalID,
+				CohortID:    vc.CohortID,
+				Metadata:    vc.Metadata,
+				AppID:       req.AppID,
+				DeviceBound: fingerprint != "",
+				Now:         time.Now().UTC(),
+			}
+			if err := runClaimValidators(ctx, validators, info, claimValidatorTimeout); err != nil {
+				var rerr *ClaimRejectedError
+				if errors.As(err, &rerr) {
+					db.logger.Debugw("claim rejected by validator", "ID", vc.ID, "reason", rerr.Reason)
+					return failClaim(err)
+				}
+				return err
+			}
+		}
+
+		// Use one of the code's claims, and mark it as claimed once they are all
+		// used. The row is locked, so concurrent claims cannot exceed the limit.
+		vc.ClaimCount++
+		vc.Claimed = vc.ClaimCount >= vc.MaxClaims
 		if err := tx.Save(&vc).Error; err != nil {
 			return fmt.Errorf("failed to claim token: %w", err)
 		}
 
-		// Update statistics
-		now := timeutils.Midnight(vc.CreatedAt)
-		sql := `
-			INSERT INTO realm_stats(date, realm_id, codes_claimed)
-				VALUES ($1, $2, 1)
-			ON CONFLICT (date, realm_id) DO UPDATE
-				SET codes_claimed = realm_stats.codes_claimed + 1
-		`
-		if err := tx.Exec(sql, now, vc.RealmID).Error; err != nil {
-			return fmt.Errorf("failed to update stats: %w", err)
+		// Update statistics. A code claimed more than once is counted only the
+		// first time.
+		if vc.ClaimCount == 1 {
+			var synthetic int
+			if req.MinClaimInterval > 0 && time.Since(vc.CreatedAt) < req.MinClaimInterval {
+				db.logger.Debugw("claimed code sooner than min claim interval", "ID", vc.ID)
+				synthetic = 1
+			}
+
+			now := timeutils.Midnight(vc.CreatedAt)
+			sql := `
+				INSERT INTO realm_stats(date, realm_id, codes_claimed, codes_claimed_synthetic)
+					VALUES ($1, $2, 1, $3)
+				ON CONFLICT (date, realm_id) DO UPDATE
+					SET codes_claimed = realm_stats.codes_claimed + 1,
+						codes_claimed_synthetic = realm_stats.codes_claimed_synthetic + $3
+			`
+			if err := tx.Exec(sql, now, vc.RealmID, synthetic).Error; err != nil {
+				return fmt.Errorf("failed to update stats: %w", err)
+			}
+
+			if vc.CohortID != "" {
+				sql := `
+					INSERT INTO cohort_stats(date, realm_id, cohort_id, codes_claimed)
+						VALUES ($1, $2, $3, 1)
+					ON CONFLICT (date, realm_id, cohort_id) DO UPDATE
+						SET codes_claimed = cohort_stats.codes_claimed + 1
+				`
+				if err := tx.Exec(sql, now, vc.RealmID, vc.CohortID).Error; err != nil {
+					return fmt.Errorf("failed to update cohort stats: %w", err)
+				}
+			}
 		}
 
 		buffer := make([]byte, tokenBytes)
@@ -258,6 +488,13 @@ func (db *Database) VerifyCodeAndIssueToken(realmID uint, verCode string, accept
 		}
 		tokenID := base64.RawStdEncoding.EncodeToString(buffer)
 
+		if vc.TestType == "negative" && req.NegativeExpireAfter > 0 && req.NegativeExpireAfter < expireAfter {
+			expireAfter = req.NegativeExpireAfter
+		}
+		if expireAfter <= 0 || expireAfter > MaxTokenDuration {
+			return fmt.Errorf("token duration %s must be greater than zero and no more than %s", expireAfter, MaxTokenDuration)
+		}
+
 		// Issue the token. Take the generated value and create a new long term token.
 		tok = &Token{
 			TokenID:     tokenID,
@@ -267,12 +504,66 @@ func (db *Database) VerifyCodeAndIssueToken(realmID uint, verCode string, accept
 			Used:        false,
 			ExpiresAt:   time.Now().UTC().Add(expireAfter),
 			RealmID:     realmID,
+
+			DeviceFingerprint: fingerprint,
 		}
 
-		return tx.Create(tok).Error
+		if err := tx.Create(tok).Error; err != nil {
+			return err
+		}
+		return db.enqueueWebhookEvent(tx, webhook.EventClaimed, &vc)
 	})
+	if err != nil {
+		return tok, err
+	}
+	db.notifyWebhooks()
+	if claimErr != nil {
+		return nil, claimErr
+	}
 
-	return tok, err
+	db.emitCodeEvent(eventsink.EventCodeClaimed, &vc)
+	return tok, nil
+}
+
+// whereClaimCode scopes the query to the realm's code which matches one of the
+// HMACed codes. If longCodeOnly is true, only long codes are matched.
+func whereClaimCode(query *gorm.DB, realmID uint, hmacedCodes []string, longCodeOnly bool) *gorm.DB {
+	query = query.Where("realm_id = ?", realmID)
+	if longCodeOnly {
+		return query.Where("long_code IN (?)", hmacedCodes)
+	}
+	return query.Where("(code IN (?) OR long_code IN (?))", hmacedCodes, hmacedCodes)
+}
+
+// recordFailedClaim counts a failed attempt to claim the code. If the realm's
+// limit is reached the code is expired, so that a code which was leaked or is
+// being targeted cannot be claimed later. It returns true if the code was
+// expired, so the caller can queue the expired webhook event.
+func (db *Database) recordFailedClaim(tx *gorm.DB, vc *VerificationCode, maxAttempts uint) (bool, error) {
+	expired := false
+	vc.FailedClaimAttempts++
+	updates := map[string]interface{}{
+		"failed_claim_attempts": vc.FailedClaimAttempts,
+	}
+
+	if maxAttempts > 0 && vc.FailedClaimAttempts >= maxAttempts {
+		now := time.Now().UTC()
+		vc.ExpiresAt = now
+		vc.LongExpiresAt = now
+		updates["expires_at"] = now
+		updates["long_expires_at"] = now
+		expired = true
+
+		db.logger.Warnw("expired code after too many failed claim attempts",
+			"ID", vc.ID,
+			"realmID", vc.RealmID,
+			"attempts", vc.FailedClaimAttempts)
+	}
+
+	if err := tx.Model(vc).UpdateColumns(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to record failed claim: %w", err)
+	}
+	return expired, nil
 }
 
 func (db *Database) FindTokenByID(tokenID string) (*Token, error) {
@@ -286,6 +577,14 @@ func (db *Database) FindTokenByID(tokenID string) (*Token, error) {
 	return &token, nil
 }
 
+// DeleteToken deletes the token with the given ID. This is a hard delete.
+func (db *Database) DeleteToken(tokenID string) error {
+	return db.db.Unscoped().
+		Where("token_id = ?", tokenID).
+		Delete(&Token{}).
+		Error
+}
+
 // PurgeTokens will delete tokens that have expired since at least the
 // provided maxAge ago.
 // This is a hard delete, not a soft delete.
@@ -298,3 +597,26 @@ func (db *Database) PurgeTokens(maxAge time.Duration) (int64, error) {
 	rtn := db.db.Unscoped().Where("expires_at < ?", deleteBefore).Delete(&Token{})
 	return rtn.RowsAffected, rtn.Error
 }
+
+// hmacDeviceFingerprint returns the HMAC of the device fingerprint using the
+// primary verification code HMAC key. Tokens are short-lived, so older keys
+// are only checked when claiming.
+func (db *Database) hmacDeviceFingerprint(fingerprint string) (string, error) {
+	sigs, err := db.generateVerificationCodeHMACs(fingerprint)
+	if err != nil {
+		return "", fmt.Errorf("failed to create hmac: %w", err)
+	}
+	if len(sigs) == 0 {
+		return "", fmt.Errorf("no verification code hmac keys are configured")
+	}
+	return sigs[0], nil
+}
+
+func containsString(list []string, want string) bool {
+	for _, v := range list {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
@@ -15,6 +15,8 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -140,7 +142,88 @@ func TestIssueToken(t *testing.T) {
 		TokenAge     time.Duration
 		Subject      *Subject
 		ClaimError   string
+
+		DeviceFingerprint      string
+		ClaimDeviceFingerprint string
+
+		AppID         string
+		AllowedAppIDs []string
+
+		// EnterCode, if set, is the code sent to verify instead of the issued
+		// one, and CaseInsensitive matches it regardless of case.
+		EnterCode       string
+		CaseInsensitive bool
+
+		// MaxCodeDuration limits the short code expiry below the system maximum.
+		MaxCodeDuration time.Duration
 	}{
+		{
+			Name: "long_expiry_out_of_bounds",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "76767676",
+					LongCode:      "76767676abcdefgh",
+					TestType:      "confirmed",
+					SymptomDate:   &symptomDate,
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(7 * 24 * time.Hour),
+				}
+			},
+			Accept:   acceptConfirmed,
+			TokenAge: time.Hour,
+			Error:    ErrVerificationCodeBadExpiry.Error(),
+		},
+		{
+			Name: "expiry_above_realm_duration",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "65656565",
+					LongCode:      "65656565abcdefgh",
+					TestType:      "confirmed",
+					SymptomDate:   &symptomDate,
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:          acceptConfirmed,
+			TokenAge:        time.Hour,
+			MaxCodeDuration: 15 * time.Minute,
+			Error:           ErrVerificationCodeBadExpiry.Error(),
+		},
+		{
+			Name: "case_insensitive_long_code",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "87878787",
+					LongCode:      "wxyz9876abcd1234",
+					TestType:      "confirmed",
+					SymptomDate:   &symptomDate,
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:          acceptConfirmed,
+			EnterCode:       "WXYZ9876abCD1234",
+			CaseInsensitive: true,
+			TokenAge:        time.Hour,
+		},
+		{
+			Name: "case_sensitive_long_code",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "76767676",
+					LongCode:      "qrst9876abcd1234",
+					TestType:      "confirmed",
+					SymptomDate:   &symptomDate,
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:    acceptConfirmed,
+			EnterCode: "QRST9876ABCD1234",
+			Error:     ErrVerificationCodeNotFound.Error(),
+			TokenAge:  time.Hour,
+		},
 		{
 			Name: "normal_token_issue",
 			Verification: func() *VerificationCode {
@@ -275,6 +358,75 @@ func TestIssueToken(t *testing.T) {
 			Accept: acceptConfirmed,
 			Error:  ErrUnsupportedTestType.Error(),
 		},
+		{
+			Name: "same_device",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "00000009",
+					LongCode:      "00000009ABC",
+					Claimed:       false,
+					TestType:      "confirmed",
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:                 acceptConfirmed,
+			TokenAge:               time.Hour,
+			DeviceFingerprint:      "device-1",
+			ClaimDeviceFingerprint: "device-1",
+		},
+		{
+			Name: "different_device",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "00000010",
+					LongCode:      "00000010ABC",
+					Claimed:       false,
+					TestType:      "confirmed",
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:                 acceptConfirmed,
+			TokenAge:               time.Hour,
+			DeviceFingerprint:      "device-1",
+			ClaimDeviceFingerprint: "device-2",
+			ClaimError:             ErrTokenDeviceMismatch.Error(),
+		},
+		{
+			Name: "allowed_app",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "00000011",
+					LongCode:      "00000011ABC",
+					Claimed:       false,
+					TestType:      "confirmed",
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:        acceptConfirmed,
+			TokenAge:      time.Hour,
+			AppID:         "com.example.app",
+			AllowedAppIDs: []string{"com.example.other", "com.example.app"},
+		},
+		{
+			Name: "disallowed_app",
+			Verification: func() *VerificationCode {
+				return &VerificationCode{
+					Code:          "00000012",
+					LongCode:      "00000012ABC",
+					Claimed:       false,
+					TestType:      "confirmed",
+					ExpiresAt:     time.Now().Add(time.Hour),
+					LongExpiresAt: time.Now().Add(time.Hour),
+				}
+			},
+			Accept:        acceptConfirmed,
+			AppID:         "com.example.rogue",
+			AllowedAppIDs: []string{"com.example.app"},
+			Error:         ErrAppNotAllowed.Error(),
+		},
 	}
 
 	for _, tc := range cases {
@@ -302,8 +454,11 @@ func TestIssueToken(t *testing.T) {
 			if tc.UseLongCode {
 				code = verification.LongCode
 			}
+			if tc.EnterCode != "" {
+				code = tc.EnterCode
+			}
 
-			if err := db.SaveVerificationCode(verification, codeAge); err != nil {
+			if err := db.SaveVerificationCode(context.Background(), verification, codeAge); err != nil {
 				t.Fatalf("error creating verification code: %v", err)
 			}
 
@@ -311,7 +466,17 @@ func TestIssueToken(t *testing.T) {
 				time.Sleep(tc.Delay)
 			}
 
-			tok, err := db.VerifyCodeAndIssueToken(realm.ID, code, tc.Accept, tc.TokenAge)
+			tok, err := db.VerifyCodeAndIssueToken(context.Background(), &IssueTokenRequest{
+				RealmID:           realm.ID,
+				VerificationCode:  code,
+				AcceptTypes:       tc.Accept,
+				ExpireAfter:       tc.TokenAge,
+				DeviceFingerprint: tc.DeviceFingerprint,
+				AppID:             tc.AppID,
+				AllowedAppIDs:     tc.AllowedAppIDs,
+				CaseInsensitive:   tc.CaseInsensitive,
+				MaxCodeDuration:   tc.MaxCodeDuration,
+			})
 			if err != nil {
 				if tc.Error == "" {
 					t.Fatalf("error issuing token: %v", err)
@@ -350,7 +515,7 @@ func TestIssueToken(t *testing.T) {
 				if err != nil {
 					t.Fatalf("unable to parse subject: %v", err)
 				}
-				if err := db.ClaimToken(realm.ID, got.TokenID, subject); err != nil && tc.ClaimError == "" {
+				if err := db.ClaimToken(context.Background(), realm.ID, got.TokenID, subject, tc.ClaimDeviceFingerprint); err != nil && tc.ClaimError == "" {
 					t.Fatalf("unexpected error claiming token: %v", err)
 				} else if tc.ClaimError != "" {
 					if err == nil {
@@ -374,6 +539,317 @@ func TestIssueToken(t *testing.T) {
 	}
 }
 
+func TestIssueToken_FailedClaimAttempts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("TestIssueToken_FailedClaimAttempts")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	symptomDate := timeutils.UTCMidnight(time.Now())
+	verification := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "45454545",
+		LongCode:      "45454545abcdefgh",
+		TestType:      "confirmed",
+		SymptomDate:   &symptomDate,
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(time.Hour),
+	}
+	code := verification.Code
+	if err := db.SaveVerificationCode(ctx, verification, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func(accept api.AcceptTypes) error {
+		_, err := db.VerifyCodeAndIssueToken(ctx, &IssueTokenRequest{
+			RealmID:                realm.ID,
+			VerificationCode:       code,
+			AcceptTypes:            accept,
+			ExpireAfter:            time.Hour,
+			MaxFailedClaimAttempts: 2,
+		})
+		return err
+	}
+
+	acceptLikely := api.AcceptTypes{api.TestTypeLikely: struct{}{}}
+	if err := claim(acceptLikely); !errors.Is(err, ErrUnsupportedTestType) {
+		t.Fatalf("expected %v, got %v", ErrUnsupportedTestType, err)
+	}
+	if err := claim(acceptLikely); !errors.Is(err, ErrTooManyClaimAttempts) {
+		t.Fatalf("expected %v, got %v", ErrTooManyClaimAttempts, err)
+	}
+
+	// The code stays unusable, even by a client which accepts its test type.
+	acceptConfirmed := api.AcceptTypes{api.TestTypeConfirmed: struct{}{}}
+	if err := claim(acceptConfirmed); !errors.Is(err, ErrTooManyClaimAttempts) {
+		t.Fatalf("expected %v, got %v", ErrTooManyClaimAttempts, err)
+	}
+
+	got, err := db.FindVerificationCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.FailedClaimAttempts, uint(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if !got.IsExpired() {
+		t.Errorf("expected code to be expired")
+	}
+}
+
+func TestIssueToken_MaxClaims(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("TestIssueToken_MaxClaims")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	symptomDate := timeutils.UTCMidnight(time.Now())
+	verification := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "56565656",
+		LongCode:      "56565656abcdefgh",
+		TestType:      "confirmed",
+		SymptomDate:   &symptomDate,
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(time.Hour),
+		MaxClaims:     3,
+	}
+	code := verification.Code
+	if err := db.SaveVerificationCode(ctx, verification, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func() (*Token, error) {
+		return db.VerifyCodeAndIssueToken(ctx, &IssueTokenRequest{
+			RealmID:          realm.ID,
+			VerificationCode: code,
+			AcceptTypes:      api.AcceptTypes{api.TestTypeConfirmed: struct{}{}},
+			ExpireAfter:      time.Hour,
+		})
+	}
+
+	// Each claim produces its own token.
+	tokens := make(map[string]struct{})
+	for i := 0; i < 3; i++ {
+		tok, err := claim()
+		if err != nil {
+			t.Fatalf("claim %d: %v", i, err)
+		}
+		tokens[tok.TokenID] = struct{}{}
+	}
+	if got, want := len(tokens), 3; got != want {
+		t.Errorf("expected %d tokens to be %d", got, want)
+	}
+
+	if _, err := claim(); !errors.Is(err, ErrVerificationCodeUsed) {
+		t.Fatalf("expected %v, got %v", ErrVerificationCodeUsed, err)
+	}
+
+	got, err := db.FindVerificationCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.ClaimCount, uint(3); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if !got.Claimed {
+		t.Errorf("expected code to be claimed")
+	}
+
+	// Codes cannot allow more claims than any realm may.
+	verification = &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "67676767",
+		LongCode:      "67676767abcdefgh",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(time.Hour),
+		MaxClaims:     MaxClaimsPerCodeLimit + 1,
+	}
+	if err := db.SaveVerificationCode(ctx, verification, time.Hour); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestIssueToken_LongCodeOnly(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("TestIssueToken_LongCodeOnly")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	verification := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "78787878",
+		LongCode:      "78787878abcdefgh",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(time.Hour),
+	}
+	shortCode, longCode := verification.Code, verification.LongCode
+	if err := db.SaveVerificationCode(ctx, verification, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	claim := func(code string) error {
+		_, err := db.VerifyCodeAndIssueToken(ctx, &IssueTokenRequest{
+			RealmID:          realm.ID,
+			VerificationCode: code,
+			AcceptTypes:      api.AcceptTypes{api.TestTypeConfirmed: struct{}{}},
+			ExpireAfter:      time.Hour,
+			LongCodeOnly:     true,
+		})
+		return err
+	}
+
+	if err := claim(shortCode); !errors.Is(err, ErrVerificationCodeNotFound) {
+		t.Fatalf("expected %v, got %v", ErrVerificationCodeNotFound, err)
+	}
+	if err := claim(longCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := claim(longCode); !errors.Is(err, ErrVerificationCodeUsed) {
+		t.Fatalf("expected %v, got %v", ErrVerificationCodeUsed, err)
+	}
+}
+
+func TestIssueToken_MinClaimInterval(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("TestIssueToken_MinClaimInterval")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(code string) {
+		verification := &VerificationCode{
+			RealmID:       realm.ID,
+			Code:          code,
+			LongCode:      code + "abcdefgh",
+			TestType:      "confirmed",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(time.Hour),
+		}
+		if err := db.SaveVerificationCode(ctx, verification, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claim := func(code string, interval time.Duration) {
+		if _, err := db.VerifyCodeAndIssueToken(ctx, &IssueTokenRequest{
+			RealmID:          realm.ID,
+			VerificationCode: code,
+			AcceptTypes:      api.AcceptTypes{api.TestTypeConfirmed: struct{}{}},
+			ExpireAfter:      time.Hour,
+			MinClaimInterval: interval,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Claimed immediately with flagging disabled, then with flagging enabled.
+	issue("11223344")
+	claim("11223344", 0)
+	issue("22334455")
+	claim("22334455", time.Hour)
+
+	stats, err := realm.Stats(db, time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 day of stats, got %d", len(stats))
+	}
+	if got, want := stats[0].CodesClaimed, uint(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := stats[0].CodesClaimedSynthetic, uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
+
+func TestIssueToken_CheckExternalID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("TestIssueToken_CheckExternalID")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	symptomDate := timeutils.UTCMidnight(time.Now())
+	verification := &VerificationCode{
+		RealmID:           realm.ID,
+		Code:              "56565656",
+		LongCode:          "56565656abcdefgh",
+		TestType:          "confirmed",
+		SymptomDate:       &symptomDate,
+		ExpiresAt:         time.Now().Add(time.Hour),
+		LongExpiresAt:     time.Now().Add(time.Hour),
+		IssuingExternalID: "patient-1",
+	}
+	code := verification.Code
+	if err := db.SaveVerificationCode(ctx, verification, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var checked []string
+	allow := false
+	req := &IssueTokenRequest{
+		RealmID:          realm.ID,
+		VerificationCode: code,
+		AcceptTypes:      api.AcceptTypes{api.TestTypeConfirmed: struct{}{}},
+		ExpireAfter:      time.Hour,
+		CheckExternalID: func(ctx context.Context, externalID string) error {
+			checked = append(checked, externalID)
+			if !allow {
+				return ErrTooManyExternalIDClaims
+			}
+			return nil
+		},
+	}
+
+	if _, err := db.VerifyCodeAndIssueToken(ctx, req); !errors.Is(err, ErrTooManyExternalIDClaims) {
+		t.Fatalf("expected %v, got %v", ErrTooManyExternalIDClaims, err)
+	}
+
+	// The rejected claim does not use up the code.
+	allow = true
+	if _, err := db.VerifyCodeAndIssueToken(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrong codes are not found before the external ID is checked.
+	wrong := *req
+	wrong.VerificationCode = "12341234"
+	if _, err := db.VerifyCodeAndIssueToken(ctx, &wrong); !errors.Is(err, ErrVerificationCodeNotFound) {
+		t.Fatalf("expected %v, got %v", ErrVerificationCodeNotFound, err)
+	}
+
+	if diff := cmp.Diff([]string{"patient-1", "patient-1"}, checked); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
 func TestPurgeTokens(t *testing.T) {
 	t.Parallel()
 
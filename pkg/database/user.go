@@ -376,6 +376,15 @@ func (db *Database) SaveUser(u *User, actor Auditable) error {
 			return fmt.Errorf("failed to get existing user")
 		}
 
+		// Enforce the maximum number of realms for users who are gaining
+		// memberships. Users who are already over the limit can still be saved, so
+		// lowering the limit does not lock anyone out.
+		if max := db.config.MaxRealmsPerUser; max > 0 && !u.SystemAdmin &&
+			uint(len(u.Realms)) > max && len(u.Realms) > len(existing.Realms) {
+			u.AddError("realms", fmt.Sprintf("cannot be a member of more than %d realms", max))
+			return fmt.Errorf("validation failed: %s", strings.Join(u.ErrorMessages(), ", "))
+		}
+
 		// Force-update associations
 		tx.Model(u).Association("Realms").Replace(u.Realms)
 		tx.Model(u).Association("AdminRealms").Replace(u.AdminRealms)
@@ -0,0 +1,238 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/pagination"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// userSessionIDBytes is the number of random bytes in a session ID.
+	userSessionIDBytes = 32
+
+	// userSessionTouchInterval is how often the last activity of a session is
+	// written to the database. Activity is tracked more precisely in the cookie.
+	userSessionTouchInterval = time.Minute
+)
+
+// UserSession is the server-side record of a logged-in user's browser session.
+// The cookie holds the SessionID, which is checked on each request so that a
+// session can be revoked before the cookie expires.
+type UserSession struct {
+	// ID is the primary key.
+	ID uint `gorm:"primary_key;"`
+
+	// SessionID is the random identifier stored in the cookie.
+	SessionID string `gorm:"column:session_id; type:varchar(64); unique_index; not null;"`
+
+	// UserID is the user who owns the session.
+	UserID uint  `gorm:"column:user_id; type:integer; not null;"`
+	User   *User `gorm:"association_autoupdate:false; association_autocreate:false;"`
+
+	// RealmID is the realm the session last selected, if any.
+	RealmID uint   `gorm:"column:realm_id; type:integer; not null; default:0;"`
+	Realm   *Realm `gorm:"association_autoupdate:false; association_autocreate:false;"`
+
+	// IPAddress and UserAgent are from the most recent request.
+	IPAddress string `gorm:"column:ip_address; type:varchar(64);"`
+	UserAgent string `gorm:"column:user_agent; type:text;"`
+
+	// LastActivityAt is the approximate time of the most recent request.
+	LastActivityAt time.Time `gorm:"column:last_activity_at;"`
+
+	// ExpiresAt is when the cookie expires.
+	ExpiresAt time.Time `gorm:"column:expires_at;"`
+
+	// RevokedAt is when the session was revoked, if it was.
+	RevokedAt *time.Time `gorm:"column:revoked_at;"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TableName sets the table name.
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// IsActive returns true if the session is not revoked or expired.
+func (s *UserSession) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// NeedsTouch returns true if the session's activity record is stale or its
+// realm or IP address changed.
+func (s *UserSession) NeedsTouch(realmID uint, ip string) bool {
+	return time.Since(s.LastActivityAt) > userSessionTouchInterval ||
+		s.RealmID != realmID ||
+		s.IPAddress != ip
+}
+
+// CreateUserSession creates a new session record with a random session ID for
+// the user.
+func (db *Database) CreateUserSession(userID, realmID uint, ip, userAgent string, ttl time.Duration) (*UserSession, error) {
+	b := make([]byte, userSessionIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	now := time.Now().UTC()
+	session := &UserSession{
+		SessionID:      base64.RawURLEncoding.EncodeToString(b),
+		UserID:         userID,
+		RealmID:        realmID,
+		IPAddress:      ip,
+		UserAgent:      userAgent,
+		LastActivityAt: now,
+		ExpiresAt:      now.Add(ttl),
+	}
+
+	if err := db.db.Create(session).Error; err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// FindUserSession finds the session with the given session ID.
+func (db *Database) FindUserSession(sessionID string) (*UserSession, error) {
+	var session UserSession
+	if err := db.db.
+		Set("gorm:auto_preload", false).
+		Where("session_id = ?", sessionID).
+		First(&session).
+		Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TouchUserSession records activity on the session.
+func (db *Database) TouchUserSession(s *UserSession, realmID uint, ip string) error {
+	s.LastActivityAt = time.Now().UTC()
+	s.RealmID = realmID
+	s.IPAddress = ip
+
+	return db.db.
+		Model(s).
+		UpdateColumns(map[string]interface{}{
+			"last_activity_at": s.LastActivityAt,
+			"realm_id":         s.RealmID,
+			"ip_address":       s.IPAddress,
+		}).
+		Error
+}
+
+// ListActiveUserSessions lists sessions which are not revoked or expired, most
+// recently active first.
+func (db *Database) ListActiveUserSessions(p *pagination.PageParams, scopes ...Scope) ([]*UserSession, *pagination.Paginator, error) {
+	var sessions []*UserSession
+	query := db.db.
+		Model(&UserSession{}).
+		Scopes(scopes...).
+		Where("revoked_at IS NULL").
+		Where("expires_at > ?", time.Now().UTC()).
+		Order("last_activity_at DESC")
+
+	if p == nil {
+		p = new(pagination.PageParams)
+	}
+
+	paginator, err := Paginate(query, &sessions, p.Page, p.Limit)
+	if err != nil {
+		if IsNotFound(err) {
+			return sessions, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return sessions, paginator, nil
+}
+
+// RevokeUserSession revokes the session with the given ID. The next request
+// using the session is treated as logged out.
+func (db *Database) RevokeUserSession(id interface{}, actor Auditable) (*UserSession, error) {
+	if actor == nil {
+		return nil, fmt.Errorf("auditing actor is nil")
+	}
+
+	var session UserSession
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("id = ?", id).
+			First(&session).
+			Error; err != nil {
+			return err
+		}
+
+		if session.RevokedAt != nil {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		session.RevokedAt = &now
+		if err := tx.Model(&session).UpdateColumn("revoked_at", now).Error; err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+
+		var user User
+		if err := tx.Where("id = ?", session.UserID).First(&user).Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to find session user: %w", err)
+		}
+		user.ID = session.UserID
+
+		audit := BuildAuditEntry(actor, fmt.Sprintf("revoked session from %s", session.IPAddress), &user, 0)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteUserSession deletes the session with the given session ID. It is used
+// when the user signs out.
+func (db *Database) DeleteUserSession(sessionID string) error {
+	// The session ID is set on the model so the cached session is purged.
+	return db.db.
+		Unscoped().
+		Where("session_id = ?", sessionID).
+		Delete(&UserSession{SessionID: sessionID}).
+		Error
+}
+
+// PurgeUserSessions deletes sessions which expired more than maxAge ago.
+// Revoked sessions are kept until then so they can be reviewed.
+func (db *Database) PurgeUserSessions(maxAge time.Duration) (int64, error) {
+	if maxAge > 0 {
+		maxAge = -1 * maxAge
+	}
+	deleteBefore := time.Now().UTC().Add(maxAge)
+
+	result := db.db.
+		Unscoped().
+		Where("expires_at < ?", deleteBefore).
+		Delete(&UserSession{})
+	return result.RowsAffected, result.Error
+}
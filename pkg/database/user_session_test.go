@@ -0,0 +1,316 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+)
+
+func TestUserSession_IsActive(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	cases := []struct {
+		name    string
+		session *UserSession
+		exp     bool
+	}{
+		{
+			name:    "active",
+			session: &UserSession{ExpiresAt: now.Add(time.Hour)},
+			exp:     true,
+		},
+		{
+			name:    "expired",
+			session: &UserSession{ExpiresAt: now.Add(-1 * time.Hour)},
+			exp:     false,
+		},
+		{
+			name:    "revoked",
+			session: &UserSession{ExpiresAt: now.Add(time.Hour), RevokedAt: &now},
+			exp:     false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := tc.session.IsActive(), tc.exp; got != want {
+				t.Errorf("expected %t to be %t", got, want)
+			}
+		})
+	}
+}
+
+func TestDatabase_CreateUserSession(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &User{Email: "session@example.com", Name: "Session"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := db.CreateUserSession(user.ID, 1, "198.51.100.7", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.SessionID == "" {
+		t.Fatal("expected session id")
+	}
+	if !session.IsActive() {
+		t.Errorf("expected session to be active")
+	}
+
+	other, err := db.CreateUserSession(user.ID, 1, "198.51.100.7", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.SessionID == other.SessionID {
+		t.Errorf("expected unique session ids")
+	}
+
+	got, err := db.FindUserSession(session.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := got.UserID, user.ID; got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := got.IPAddress, "198.51.100.7"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := got.UserAgent, "test-agent"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestDatabase_RevokeUserSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cacher, err := cache.NewInMemory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := testDatabaseInstance.NewDatabase(t, cacher)
+
+	user := &User{Email: "revoke@example.com", Name: "Revoke"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := db.CreateUserSession(user.ID, 0, "198.51.100.7", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cache the active session.
+	cacheKey := &cache.Key{
+		Namespace: "user_sessions:by_session_id",
+		Key:       session.SessionID,
+	}
+	var cached UserSession
+	if err := cacher.Fetch(ctx, cacheKey, &cached, time.Hour, func() (interface{}, error) {
+		return db.FindUserSession(session.SessionID)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.RevokeUserSession(session.ID, nil); err == nil {
+		t.Errorf("expected error without an actor")
+	}
+
+	revoked, err := db.RevokeUserSession(session.ID, SystemTest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.RevokedAt == nil {
+		t.Fatal("expected session to be revoked")
+	}
+	if revoked.IsActive() {
+		t.Errorf("expected session to be inactive")
+	}
+
+	// Revoking again is a no-op.
+	if _, err := db.RevokeUserSession(session.ID, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached session was purged.
+	if err := cacher.Read(ctx, cacheKey, &cached); err == nil {
+		t.Errorf("expected cached session to be purged")
+	}
+
+	audits, _, err := db.ListAudits(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found int
+	for _, audit := range audits {
+		if audit.Action == "revoked session from 198.51.100.7" {
+			found++
+		}
+	}
+	if got, want := found, 1; got != want {
+		t.Errorf("expected %d revoke audits to be %d", got, want)
+	}
+}
+
+func TestDatabase_DeleteUserSession(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	cacher, err := cache.NewInMemory(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := testDatabaseInstance.NewDatabase(t, cacher)
+
+	user := &User{Email: "delete@example.com", Name: "Delete"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := db.CreateUserSession(user.ID, 0, "198.51.100.7", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cacheKey := &cache.Key{
+		Namespace: "user_sessions:by_session_id",
+		Key:       session.SessionID,
+	}
+	var cached UserSession
+	if err := cacher.Fetch(ctx, cacheKey, &cached, time.Hour, func() (interface{}, error) {
+		return db.FindUserSession(session.SessionID)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteUserSession(session.SessionID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.FindUserSession(session.SessionID); !IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := cacher.Read(ctx, cacheKey, &cached); err == nil {
+		t.Errorf("expected cached session to be purged")
+	}
+}
+
+func TestDatabase_ListActiveUserSessions(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &User{Email: "list@example.com", Name: "List"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	older, err := db.CreateUserSession(user.ID, 0, "198.51.100.1", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RawDB().Model(older).UpdateColumn("last_activity_at", time.Now().UTC().Add(-10*time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	newer, err := db.CreateUserSession(user.ID, 0, "198.51.100.2", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := db.CreateUserSession(user.ID, 0, "198.51.100.3", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.RevokeUserSession(revoked.ID, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.CreateUserSession(user.ID, 0, "198.51.100.4", "test-agent", -1*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, _, err := db.ListActiveUserSessions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []uint
+	for _, s := range sessions {
+		got = append(got, s.ID)
+	}
+	want := []uint{newer.ID, older.ID}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+}
+
+func TestDatabase_PurgeUserSessions(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	user := &User{Email: "purge@example.com", Name: "Purge"}
+	if err := db.SaveUser(user, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired two hours ago.
+	if _, err := db.CreateUserSession(user.ID, 0, "198.51.100.1", "test-agent", -2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired a minute ago.
+	recent, err := db.CreateUserSession(user.ID, 0, "198.51.100.2", "test-agent", -1*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Active.
+	active, err := db.CreateUserSession(user.ID, 0, "198.51.100.3", "test-agent", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.PurgeUserSessions(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, int64(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	for _, s := range []*UserSession{recent, active} {
+		if _, err := db.FindUserSession(s.SessionID); err != nil {
+			t.Errorf("expected session %d to remain: %v", s.ID, err)
+		}
+	}
+}
@@ -26,6 +26,10 @@ type UserStats struct {
 	UserID      uint      `gorm:"user_id;"`
 	RealmID     uint      `gorm:"realm_id;"`
 	CodesIssued uint      `gorm:"codes_issued;"`
+
+	// CodesSupervised is the number of codes other users issued under this
+	// user's supervision.
+	CodesSupervised uint `gorm:"codes_supervised;"`
 }
 
 // SaveUserStats saves some UserStats to the database.
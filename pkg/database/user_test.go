@@ -15,6 +15,7 @@
 package database
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -207,6 +208,66 @@ func TestRemoveRealmUpdatesTime(t *testing.T) {
 	}
 }
 
+func TestSaveUser_MaxRealmsPerUser(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	db.config.MaxRealmsPerUser = 2
+
+	realms := make([]*Realm, 0, 3)
+	for i := 0; i < 3; i++ {
+		realm := NewRealmWithDefaults(fmt.Sprintf("realm-%d", i))
+		if err := db.SaveRealm(realm, System); err != nil {
+			t.Fatal(err)
+		}
+		realms = append(realms, realm)
+	}
+
+	user := &User{
+		Email: "many-realms@example.com",
+		Name:  "Many Realms",
+	}
+	user.AddRealm(realms[0])
+	user.AddRealm(realms[1])
+	if err := db.SaveUser(user, System); err != nil {
+		t.Fatal(err)
+	}
+
+	user.AddRealm(realms[2])
+	if err := db.SaveUser(user, System); err == nil {
+		t.Fatal("expected error")
+	}
+	if errs := user.ErrorsFor("realms"); len(errs) == 0 {
+		t.Errorf("expected errors for realms")
+	}
+
+	// System admins are exempt.
+	user, err := db.FindUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.SystemAdmin = true
+	user.AddRealm(realms[2])
+	if err := db.SaveUser(user, System); err != nil {
+		t.Fatal(err)
+	}
+
+	// Users already over the limit can still be saved.
+	db.config.MaxRealmsPerUser = 1
+	user, err = db.FindUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.SystemAdmin = false
+	user.Name = "Fewer Realms"
+	if err := db.SaveUser(user, System); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(user.Realms), 3; got != want {
+		t.Errorf("expected %d realms to be %d", got, want)
+	}
+}
+
 func expectExists(t *testing.T, db *Database, id uint) {
 	got, err := db.FindUser(id)
 	if err != nil {
@@ -15,16 +15,20 @@
 package database
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/timeutils"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
 	"github.com/jinzhu/gorm"
 )
 
@@ -32,6 +36,14 @@ const (
 	oneDay = 24 * time.Hour
 	// MinCodeLength defines the minimum number of digits in a code.
 	MinCodeLength = 6
+
+	// MaxIssuingExternalIDLength is the maximum length of an external issuer ID.
+	// The server and realms may configure a lower limit.
+	MaxIssuingExternalIDLength = 255
+
+	// codeExpirySlack is the extra time allowed when checking a code's expiry
+	// bounds, since its expiry is computed before it is saved.
+	codeExpirySlack = time.Minute
 )
 
 type CodeType int
@@ -55,6 +67,54 @@ var (
 	ErrCodeAlreadyClaimed = errors.New("code already claimed")
 	ErrCodeTooShort       = errors.New("verification code must be at least 6 digits")
 	ErrTestTooOld         = errors.New("test date is more than 14 day ago")
+	ErrCodeCollision      = errors.New("code or long code is already in use in this realm")
+
+	ErrCodeNotPendingApproval = errors.New("code is not pending approval")
+	ErrCodeApprovalExpired    = errors.New("code was not approved in time")
+	ErrApproverIsIssuer       = errors.New("code must be approved by a different user than the one who issued it")
+
+	// cohortIDRegexp is the format of a cohort ID. It starts with a letter or
+	// digit and is up to 64 characters.
+	cohortIDRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,63}$`)
+)
+
+// NormalizeCode returns the form of a code used for case-insensitive matching.
+// Generated codes only contain lowercase letters and digits, so normalizing
+// never maps two different generated codes to the same value.
+func NormalizeCode(code string) string {
+	return strings.ToLower(code)
+}
+
+// StripCodeSeparators removes the separator characters from a code, for codes
+// which were entered with spaces or dashes for readability.
+func StripCodeSeparators(code, separators string) string {
+	if separators == "" {
+		return code
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(separators, r) {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// ValidCohortID returns true if the given cohort ID is blank or valid.
+func ValidCohortID(s string) bool {
+	return s == "" || cohortIDRegexp.MatchString(s)
+}
+
+// ApprovalStatus is the state of a verification code in a realm that requires
+// a second user to approve codes before they can be claimed.
+type ApprovalStatus string
+
+const (
+	// ApprovalStatusNone is the status of codes which did not require approval.
+	ApprovalStatusNone ApprovalStatus = ""
+
+	ApprovalStatusPending  ApprovalStatus = "pending"
+	ApprovalStatusApproved ApprovalStatus = "approved"
+	ApprovalStatusRejected ApprovalStatus = "rejected"
 )
 
 // VerificationCode represents a verification code in the database.
@@ -78,6 +138,11 @@ type VerificationCode struct {
 	// UI.
 	IssuingUserID uint `gorm:"column:issuing_user_id; type:integer;"`
 
+	// SupervisingUserID is the ID of an optional second user in the realm who
+	// supervised the issuance, for example when a trainee issues codes from a
+	// shared workstation. It is never the same as IssuingUserID.
+	SupervisingUserID uint `gorm:"column:supervising_user_id; type:integer;"`
+
 	// IssuingAppID is the ID of the app in the database that created this
 	// verification code. This is only populated if the code was created via the
 	// API.
@@ -88,6 +153,37 @@ type VerificationCode struct {
 	// API AND the API caller supplied it in the request. This ID has no meaning
 	// in this system. It can be up to 255 characters in length.
 	IssuingExternalID string `gorm:"column:issuing_external_id; type:varchar(255);"`
+
+	// CohortID is an optional tag shared by codes issued for the same exposure
+	// event, such as an outbreak investigation. Unlike IssuingExternalID, which
+	// identifies a person or issuer, many codes share a cohort.
+	CohortID string `gorm:"column:cohort_id; type:varchar(64); not null; default:'';"`
+
+	// Metadata is an optional set of non-PII tags supplied by the issuer, such
+	// as a clinic ID or test kit lot.
+	Metadata CodeMetadata `gorm:"column:metadata; type:jsonb; not null; default:'{}';"`
+
+	// ApprovalStatus is whether the code is waiting for, or was given, approval.
+	// Pending codes cannot be claimed. ApprovalExpiresAt is the time by which a
+	// pending code must be approved, and ApprovingUserID is the user who
+	// approved or rejected it.
+	ApprovalStatus    ApprovalStatus `gorm:"column:approval_status; type:varchar(16); not null; default:'';"`
+	ApprovalExpiresAt *time.Time     `gorm:"column:approval_expires_at;"`
+	ApprovingUserID   uint           `gorm:"column:approving_user_id; type:integer; not null; default:0;"`
+
+	// MaxClaims is the number of times the code may be claimed, and ClaimCount
+	// is the number of times it was. The code is marked as Claimed once all of
+	// its claims are used.
+	MaxClaims  uint `gorm:"column:max_claims; type:integer; not null; default:1;"`
+	ClaimCount uint `gorm:"column:claim_count; type:integer; not null; default:0;"`
+
+	// FailedClaimAttempts is the number of times the code was found but could
+	// not be claimed, for example because it was pending approval.
+	FailedClaimAttempts uint `gorm:"column:failed_claim_attempts; type:integer; not null; default:0;"`
+
+	// imported is set on codes which were issued by another system and imported
+	// by ImportVerificationCode. They are not counted in the issuance stats.
+	imported bool
 }
 
 // TableName sets the VerificationCode table name
@@ -97,8 +193,23 @@ func (VerificationCode) TableName() string {
 
 // BeforeSave is used by callbacks.
 func (v *VerificationCode) BeforeSave(scope *gorm.Scope) error {
-	if len(v.IssuingExternalID) > 255 {
-		v.AddError("issuingExternalID", "cannot exceed 255 characters")
+	if len(v.IssuingExternalID) > MaxIssuingExternalIDLength {
+		v.AddError("issuingExternalID", fmt.Sprintf("cannot exceed %d characters", MaxIssuingExternalIDLength))
+	}
+
+	if !ValidCohortID(v.CohortID) {
+		v.AddError("cohortID", "must be 1-64 letters, digits, dots, colons, underscores, or dashes")
+	}
+
+	for _, problem := range v.Metadata.Validate() {
+		v.AddError("metadata", problem)
+	}
+
+	if v.MaxClaims == 0 {
+		v.MaxClaims = 1
+	}
+	if v.MaxClaims > MaxClaimsPerCodeLimit {
+		v.AddError("maxClaims", fmt.Sprintf("must be no more than %d", MaxClaimsPerCodeLimit))
 	}
 
 	if len(v.Errors()) > 0 {
@@ -111,6 +222,10 @@ func (v *VerificationCode) BeforeSave(scope *gorm.Scope) error {
 // to update statistics about usage. If the executions fail, an error is logged
 // but the transaction continues. This is called automatically by gorm.
 func (v *VerificationCode) AfterCreate(scope *gorm.Scope) {
+	if v.imported {
+		return
+	}
+
 	date := timeutils.Midnight(v.CreatedAt)
 
 	// If the issuer was a user, update the user stats for the day.
@@ -127,6 +242,20 @@ func (v *VerificationCode) AfterCreate(scope *gorm.Scope) {
 		}
 	}
 
+	// If the issuance was supervised, update the supervisor's stats for the day.
+	if v.SupervisingUserID != 0 {
+		sql := `
+			INSERT INTO user_stats (date, realm_id, user_id, codes_issued, codes_supervised)
+				VALUES ($1, $2, $3, 0, 1)
+			ON CONFLICT (date, realm_id, user_id) DO UPDATE
+				SET codes_supervised = user_stats.codes_supervised + 1
+		`
+
+		if err := scope.DB().Exec(sql, date, v.RealmID, v.SupervisingUserID).Error; err != nil {
+			scope.Log(fmt.Sprintf("failed to update stats: %v", err))
+		}
+	}
+
 	// If the request was an API request, we might have an external issuer ID.
 	if len(v.IssuingExternalID) != 0 {
 		sql := `
@@ -141,6 +270,20 @@ func (v *VerificationCode) AfterCreate(scope *gorm.Scope) {
 		}
 	}
 
+	// If the code belongs to a cohort, update the cohort stats for the day.
+	if v.CohortID != "" {
+		sql := `
+			INSERT INTO cohort_stats (date, realm_id, cohort_id, codes_issued)
+				VALUES ($1, $2, $3, 1)
+			ON CONFLICT (date, realm_id, cohort_id) DO UPDATE
+				SET codes_issued = cohort_stats.codes_issued + 1
+		`
+
+		if err := scope.DB().Exec(sql, date, v.RealmID, v.CohortID).Error; err != nil {
+			scope.Log(fmt.Sprintf("failed to update cohort stats: %v", err))
+		}
+	}
+
 	// If the issuer was a app, update the app stats for the day.
 	if v.IssuingAppID != 0 {
 		sql := `
@@ -226,6 +369,58 @@ func (v *VerificationCode) HasLongExpiration() bool {
 	return v.LongExpiresAt.After(v.ExpiresAt)
 }
 
+// HasValidExpiry returns true if the code's expiry times are within the policy
+// bounds: they are after the code was issued, the long code does not expire
+// before the short code, and the code is not valid for longer than the maximum
+// durations after it was issued. maxShort and maxLong may lower the system
+// maximums. Approved codes are allowed the extra time spent waiting for
+// approval.
+func (v *VerificationCode) HasValidExpiry(maxShort, maxLong time.Duration) bool {
+	if !v.ExpiresAt.After(v.CreatedAt) || v.LongExpiresAt.Before(v.ExpiresAt) {
+		return false
+	}
+
+	if maxShort <= 0 || maxShort > maxCodeDuration {
+		maxShort = maxCodeDuration
+	}
+	if maxLong <= 0 || maxLong > maxLongCodeDuration {
+		maxLong = maxLongCodeDuration
+	}
+	// Codes which are not sent by SMS have the same short and long expiry.
+	if maxLong < maxShort {
+		maxLong = maxShort
+	}
+
+	allowance := codeExpirySlack
+	if v.ApprovalStatus == ApprovalStatusApproved {
+		allowance += maxIssuanceApprovalTimeout
+	}
+
+	return !v.ExpiresAt.After(v.CreatedAt.Add(maxShort+allowance)) &&
+		!v.LongExpiresAt.After(v.CreatedAt.Add(maxLong+allowance))
+}
+
+// IsPendingApproval returns true if the code is waiting for approval and can
+// still be approved.
+func (v *VerificationCode) IsPendingApproval() bool {
+	return v.ApprovalStatus == ApprovalStatusPending && !v.IsApprovalExpired()
+}
+
+// IsApprovalExpired returns true if the code was pending approval and was not
+// approved in time.
+func (v *VerificationCode) IsApprovalExpired() bool {
+	return v.ApprovalStatus == ApprovalStatusPending &&
+		v.ApprovalExpiresAt != nil && !v.ApprovalExpiresAt.After(time.Now().UTC())
+}
+
+func (v *VerificationCode) AuditID() string {
+	return fmt.Sprintf("verification_codes:%d", v.ID)
+}
+
+func (v *VerificationCode) AuditDisplay() string {
+	return v.UUID
+}
+
 // Validate validates a verification code before save.
 func (v *VerificationCode) Validate(maxAge time.Duration) error {
 	now := time.Now()
@@ -321,24 +516,185 @@ func (db *Database) ExpireCode(uuid string) (*VerificationCode, error) {
 
 		vc.ExpiresAt = time.Now()
 		vc.LongExpiresAt = vc.ExpiresAt
-		return tx.Save(&vc).Error
+		if err := tx.Save(&vc).Error; err != nil {
+			return err
+		}
+		return db.enqueueWebhookEvent(tx, webhook.EventExpired, &vc)
 	})
 	if err != nil {
 		return nil, err
 	}
+
+	db.notifyWebhooks()
+	return &vc, nil
+}
+
+// ApproveCode approves a code which is pending approval so that it can be
+// claimed. The approver must not be the user who issued the code. The expiry
+// of the code is extended by the time it spent waiting, so the patient has the
+// full code duration to claim it.
+func (db *Database) ApproveCode(realmID uint, uuid string, approver *User) (*VerificationCode, error) {
+	return db.decideCode(realmID, uuid, approver, func(vc *VerificationCode, now time.Time) string {
+		waited := now.Sub(vc.CreatedAt)
+		vc.ExpiresAt = vc.ExpiresAt.Add(waited)
+		vc.LongExpiresAt = vc.LongExpiresAt.Add(waited)
+		vc.ApprovalStatus = ApprovalStatusApproved
+		return "approved verification code"
+	})
+}
+
+// RejectCode rejects a code which is pending approval. The code is expired and
+// can never be claimed, so an expired event is sent to the realm's webhooks.
+func (db *Database) RejectCode(realmID uint, uuid string, approver *User) (*VerificationCode, error) {
+	return db.decideCode(realmID, uuid, approver, func(vc *VerificationCode, now time.Time) string {
+		vc.ExpiresAt = now
+		vc.LongExpiresAt = now
+		vc.ApprovalStatus = ApprovalStatusRejected
+		return "rejected verification code"
+	})
+}
+
+// decideCode locks the pending code, checks that the approver may decide on
+// it, and saves the result of fn along with an audit entry. fn returns the
+// audit action.
+func (db *Database) decideCode(realmID uint, uuid string, approver *User, fn func(vc *VerificationCode, now time.Time) string) (*VerificationCode, error) {
+	if approver == nil {
+		return nil, fmt.Errorf("approving user is nil")
+	}
+
+	var vc VerificationCode
+	err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Set("gorm:query_option", "FOR UPDATE").
+			Where("realm_id = ?", realmID).
+			Where("uuid = ?", uuid).
+			First(&vc).
+			Error; err != nil {
+			return err
+		}
+
+		if vc.ApprovalStatus != ApprovalStatusPending {
+			return ErrCodeNotPendingApproval
+		}
+		if vc.IsApprovalExpired() {
+			return ErrCodeApprovalExpired
+		}
+		if vc.IssuingUserID != 0 && vc.IssuingUserID == approver.ID {
+			return ErrApproverIsIssuer
+		}
+
+		action := fn(&vc, time.Now().UTC())
+		vc.ApprovingUserID = approver.ID
+		if err := tx.Save(&vc).Error; err != nil {
+			return fmt.Errorf("failed to save code: %w", err)
+		}
+
+		audit := BuildAuditEntry(approver, action, &vc, realmID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+
+		// Approval extends the code's expiry, so its expired event is rescheduled.
+		if vc.ApprovalStatus == ApprovalStatusRejected {
+			return db.enqueueWebhookEvent(tx, webhook.EventExpired, &vc)
+		}
+		return db.scheduleWebhookExpiry(tx, &vc)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db.notifyWebhooks()
 	return &vc, nil
 }
 
 // SaveVerificationCode created or updates a verification code in the database.
 // Max age represents the maximum age of the test date [optional] in the record.
-func (db *Database) SaveVerificationCode(vc *VerificationCode, maxAge time.Duration) error {
+func (db *Database) SaveVerificationCode(ctx context.Context, vc *VerificationCode, maxAge time.Duration) error {
+	if err := vc.Validate(maxAge); err != nil {
+		return err
+	}
+	created := vc.Model.ID == 0
+	if err := db.transactionContext(ctx, "SaveVerificationCode", func(tx *gorm.DB) error {
+		if created {
+			if err := tx.Create(vc).Error; err != nil {
+				return err
+			}
+			return db.enqueueWebhookEvent(tx, webhook.EventIssued, vc)
+		}
+		return tx.Save(vc).Error
+	}); err != nil {
+		return err
+	}
+
+	if created {
+		db.emitCodeEvent(eventsink.EventCodeIssued, vc)
+		db.notifyWebhooks()
+	}
+	return nil
+}
+
+// ImportVerificationCode saves a code which was issued by another system,
+// keeping its code values instead of generating new ones. The code is
+// validated like an issued code, and ErrCodeCollision is returned if either
+// value matches the code or long code of an existing code in the realm. If the
+// realm matches codes case-insensitively, the stored values are normalized.
+//
+// Imported codes do not count as issued in the realm stats, and an audit entry
+// marks the code as migrated.
+func (db *Database) ImportVerificationCode(ctx context.Context, realm *Realm, vc *VerificationCode, maxAge time.Duration, actor Auditable) error {
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
 	if err := vc.Validate(maxAge); err != nil {
 		return err
 	}
-	if vc.Model.ID == 0 {
-		return db.db.Create(vc).Error
+	if realm.CaseInsensitiveCodes {
+		vc.Code = NormalizeCode(vc.Code)
+		vc.LongCode = NormalizeCode(vc.LongCode)
+	}
+	if vc.Code == vc.LongCode {
+		return ErrCodeCollision
+	}
+
+	var hmacs []string
+	for _, code := range []string{vc.Code, vc.LongCode} {
+		sigs, err := db.generateVerificationCodeHMACs(code)
+		if err != nil {
+			return fmt.Errorf("failed to create hmac: %w", err)
+		}
+		hmacs = append(hmacs, sigs...)
 	}
-	return db.db.Save(vc).Error
+
+	vc.RealmID = realm.ID
+	vc.imported = true
+
+	return db.transactionContext(ctx, "ImportVerificationCode", func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.
+			Model(&VerificationCode{}).
+			Unscoped().
+			Where("realm_id = ?", realm.ID).
+			Where("code IN (?) OR long_code IN (?)", hmacs, hmacs).
+			Count(&count).
+			Error; err != nil {
+			return fmt.Errorf("failed to check for collisions: %w", err)
+		}
+		if count > 0 {
+			return ErrCodeCollision
+		}
+
+		if err := tx.Create(vc).Error; err != nil {
+			return err
+		}
+
+		audit := BuildAuditEntry(actor, "imported migrated code", vc, realm.ID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	})
 }
 
 // DeleteVerificationCode deletes the code if it exists. This is a hard delete.
@@ -15,7 +15,10 @@
 package database
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -44,7 +47,7 @@ func TestVerificationCode_FindVerificationCode(t *testing.T) {
 		LongExpiresAt: time.Now().Add(2 * time.Hour),
 	}
 
-	if err := db.SaveVerificationCode(vc, maxAge); err != nil {
+	if err := db.SaveVerificationCode(context.Background(), vc, maxAge); err != nil {
 		t.Fatalf("error creating verification code: %v", err)
 	}
 
@@ -71,7 +74,7 @@ func TestVerificationCode_FindVerificationCode(t *testing.T) {
 	}
 
 	vc.Claimed = true
-	if err := db.SaveVerificationCode(vc, maxAge); err != nil {
+	if err := db.SaveVerificationCode(context.Background(), vc, maxAge); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -99,7 +102,7 @@ func TestVerificationCode_FindVerificationCodeByUUID(t *testing.T) {
 		LongExpiresAt: time.Now().Add(2 * time.Hour),
 	}
 
-	if err := db.SaveVerificationCode(vc, time.Hour); err != nil {
+	if err := db.SaveVerificationCode(context.Background(), vc, time.Hour); err != nil {
 		t.Fatal(err)
 	}
 
@@ -139,6 +142,393 @@ func TestVerificationCode_FindVerificationCodeByUUID(t *testing.T) {
 	})
 }
 
+func TestRealm_HasRecentCodeForExternalID(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm := NewRealmWithDefaults("testRealm")
+	realm.RejectDuplicateExternalID = true
+	realm.DuplicateExternalIDWindow = FromDuration(time.Hour)
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	vc := &VerificationCode{
+		Code:              "123456",
+		LongCode:          "defghijk329024",
+		TestType:          "confirmed",
+		RealmID:           realm.ID,
+		ExpiresAt:         time.Now().Add(time.Hour),
+		LongExpiresAt:     time.Now().Add(2 * time.Hour),
+		IssuingExternalID: "patient-1",
+	}
+	if err := db.SaveVerificationCode(context.Background(), vc, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err := realm.HasRecentCodeForExternalID(db, "patient-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Errorf("expected recent code for external id")
+	}
+
+	exists, err = realm.HasRecentCodeForExternalID(db, "patient-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Errorf("expected no recent code for external id")
+	}
+
+	// Move the code outside of the window.
+	if err := db.db.Model(vc).UpdateColumn("created_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	exists, err = realm.HasRecentCodeForExternalID(db, "patient-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Errorf("expected code outside of window to be ignored")
+	}
+}
+
+func TestRealm_CountCodesForExternalID(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("testRealm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, code := range []string{"123456", "234567"} {
+		vc := &VerificationCode{
+			Code:              code,
+			LongCode:          fmt.Sprintf("defghijk32902%d", i),
+			TestType:          "confirmed",
+			RealmID:           realm.ID,
+			ExpiresAt:         time.Now().Add(time.Hour),
+			LongExpiresAt:     time.Now().Add(2 * time.Hour),
+			IssuingExternalID: "patient-1",
+		}
+		if err := db.SaveVerificationCode(context.Background(), vc, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := realm.CountCodesForExternalID(db, "patient-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, uint(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	count, err = realm.CountCodesForExternalID(db, "patient-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, uint(0); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
+
+func TestRealm_CountActiveCodes(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("testRealm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	codes := []*VerificationCode{
+		// active
+		{Code: "123456", LongCode: "defghijk329020", ExpiresAt: now.Add(time.Hour), LongExpiresAt: now.Add(2 * time.Hour)},
+		// short code expired, long code active
+		{Code: "234567", LongCode: "defghijk329021", ExpiresAt: now.Add(-time.Minute), LongExpiresAt: now.Add(time.Hour)},
+		// claimed
+		{Code: "345678", LongCode: "defghijk329022", ExpiresAt: now.Add(time.Hour), LongExpiresAt: now.Add(time.Hour), Claimed: true},
+		// expired
+		{Code: "456789", LongCode: "defghijk329023", ExpiresAt: now.Add(-time.Hour), LongExpiresAt: now.Add(-time.Minute)},
+	}
+	for _, vc := range codes {
+		vc.TestType = "confirmed"
+		vc.RealmID = realm.ID
+		if err := db.db.Create(vc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := realm.CountActiveCodes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, uint(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
+
+func TestDatabase_CountCodesByCohort(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("testRealm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	codes := []*VerificationCode{
+		{Code: "123456", LongCode: "defghijk329020", CohortID: "event-1"},
+		{Code: "234567", LongCode: "defghijk329021", CohortID: "event-1"},
+		{Code: "345678", LongCode: "defghijk329022", CohortID: "event-2"},
+		{Code: "456789", LongCode: "defghijk329023"},
+	}
+	for _, vc := range codes {
+		vc.TestType = "confirmed"
+		vc.RealmID = realm.ID
+		vc.ExpiresAt = now.Add(time.Hour)
+		vc.LongExpiresAt = now.Add(time.Hour)
+		if err := db.db.Create(vc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.CountCodesByCohort(realm.ID, now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]uint, len(stats))
+	for _, stat := range stats {
+		got[stat.CohortID] = stat.CodesIssued
+	}
+	if diff := cmp.Diff(map[string]uint{"event-1": 2, "event-2": 1}, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	invalid := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "567890",
+		LongCode:      "defghijk329024",
+		TestType:      "confirmed",
+		ExpiresAt:     now.Add(time.Hour),
+		LongExpiresAt: now.Add(time.Hour),
+		CohortID:      "not a valid cohort",
+	}
+	if err := db.db.Create(invalid).Error; err == nil {
+		t.Errorf("expected invalid cohort ID to be rejected")
+	}
+}
+
+func TestDatabase_CountCodesByMetadata(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	realm, err := db.CreateRealm("testRealm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	codes := []*VerificationCode{
+		{Code: "123456", LongCode: "defghijk329020", Metadata: CodeMetadata{"clinic": "north", "lot": "A1"}},
+		{Code: "234567", LongCode: "defghijk329021", Metadata: CodeMetadata{"clinic": "north"}, Claimed: true},
+		{Code: "345678", LongCode: "defghijk329022", Metadata: CodeMetadata{"clinic": "south"}},
+		{Code: "456789", LongCode: "defghijk329023"},
+	}
+	for _, vc := range codes {
+		vc.TestType = "confirmed"
+		vc.RealmID = realm.ID
+		vc.ExpiresAt = now.Add(time.Hour)
+		vc.LongExpiresAt = now.Add(time.Hour)
+		if err := db.db.Create(vc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.CountCodesByMetadata(realm.ID, "clinic", now.Add(-24*time.Hour), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string][2]uint, len(stats))
+	for _, stat := range stats {
+		got[stat.Value] = [2]uint{stat.CodesIssued, stat.CodesClaimed}
+	}
+	if diff := cmp.Diff(map[string][2]uint{"north": {2, 1}, "south": {1, 0}}, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	var found VerificationCode
+	if err := db.db.Where("id = ?", codes[0].ID).First(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(codes[0].Metadata, found.Metadata); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	if _, err := db.CountCodesByMetadata(realm.ID, "not valid", now, now); err == nil {
+		t.Errorf("expected invalid key to be rejected")
+	}
+}
+
+func TestCodeMetadata_Validate(t *testing.T) {
+	t.Parallel()
+
+	tooMany := make(CodeMetadata, MaxCodeMetadataKeys+1)
+	for i := 0; i <= MaxCodeMetadataKeys; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "value"
+	}
+
+	cases := []struct {
+		name     string
+		metadata CodeMetadata
+		valid    bool
+	}{
+		{"nil", nil, true},
+		{"valid", CodeMetadata{"clinic": "north-42", "kit.lot": "A1234"}, true},
+		{"too_many_keys", tooMany, false},
+		{"invalid_key", CodeMetadata{"1clinic": "north"}, false},
+		{"long_value", CodeMetadata{"clinic": strings.Repeat("a", MaxCodeMetadataValueLength+1)}, false},
+		{"email", CodeMetadata{"contact": "jane@example.com"}, false},
+		{"phone", CodeMetadata{"contact": "+1 (555) 123-4567"}, false},
+		{"ssn", CodeMetadata{"id": "123-45-6789"}, false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			problems := tc.metadata.Validate()
+			if tc.valid && len(problems) > 0 {
+				t.Errorf("expected valid, got %v", problems)
+			}
+			if !tc.valid && len(problems) == 0 {
+				t.Errorf("expected problems")
+			}
+		})
+	}
+}
+
+func TestCodeMetadata_ValidateWithLimits(t *testing.T) {
+	t.Parallel()
+
+	metadata := CodeMetadata{"clinic": "north-42", "kit.lot": "A1234"}
+	if problems := metadata.ValidateWithLimits(2, 1024); len(problems) > 0 {
+		t.Errorf("expected valid, got %v", problems)
+	}
+	if problems := metadata.ValidateWithLimits(1, 1024); len(problems) != 1 {
+		t.Errorf("expected too many keys, got %v", problems)
+	}
+	if problems := metadata.ValidateWithLimits(2, 16); len(problems) != 1 {
+		t.Errorf("expected too large, got %v", problems)
+	}
+}
+
+func TestVerificationCode_HasValidExpiry(t *testing.T) {
+	t.Parallel()
+
+	created := time.Now().UTC()
+
+	cases := []struct {
+		name     string
+		code     *VerificationCode
+		maxShort time.Duration
+		maxLong  time.Duration
+		valid    bool
+	}{
+		{
+			name:  "normal",
+			code:  &VerificationCode{ExpiresAt: created.Add(15 * time.Minute), LongExpiresAt: created.Add(24 * time.Hour)},
+			valid: true,
+		},
+		{
+			name:  "expires_before_issued",
+			code:  &VerificationCode{ExpiresAt: created.Add(-1 * time.Minute), LongExpiresAt: created.Add(time.Hour)},
+			valid: false,
+		},
+		{
+			name:  "long_before_short",
+			code:  &VerificationCode{ExpiresAt: created.Add(time.Hour), LongExpiresAt: created.Add(30 * time.Minute)},
+			valid: false,
+		},
+		{
+			name:  "short_too_long",
+			code:  &VerificationCode{ExpiresAt: created.Add(2 * time.Hour), LongExpiresAt: created.Add(2 * time.Hour)},
+			valid: false,
+		},
+		{
+			name:  "long_too_long",
+			code:  &VerificationCode{ExpiresAt: created.Add(time.Hour), LongExpiresAt: created.Add(48 * time.Hour)},
+			valid: false,
+		},
+		{
+			name:     "realm_limit",
+			code:     &VerificationCode{ExpiresAt: created.Add(time.Hour), LongExpiresAt: created.Add(time.Hour)},
+			maxShort: 15 * time.Minute,
+			maxLong:  24 * time.Hour,
+			valid:    false,
+		},
+		{
+			name:     "realm_limit_above_system",
+			code:     &VerificationCode{ExpiresAt: created.Add(time.Hour), LongExpiresAt: created.Add(24 * time.Hour)},
+			maxShort: 48 * time.Hour,
+			valid:    true,
+		},
+		{
+			name: "approved_extended",
+			code: &VerificationCode{
+				ApprovalStatus: ApprovalStatusApproved,
+				ExpiresAt:      created.Add(5 * time.Hour),
+				LongExpiresAt:  created.Add(28 * time.Hour),
+			},
+			valid: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.code.CreatedAt = created
+			if got := tc.code.HasValidExpiry(tc.maxShort, tc.maxLong); got != tc.valid {
+				t.Errorf("expected %t to be %t", got, tc.valid)
+			}
+		})
+	}
+}
+
+func TestValidCohortID(t *testing.T) {
+	t.Parallel()
+
+	for _, id := range []string{"", "event-1", "OUTBREAK_2020.11", "school:42"} {
+		if !ValidCohortID(id) {
+			t.Errorf("expected %q to be valid", id)
+		}
+	}
+	for _, id := range []string{"-event", "has space", "semi;colon", strings.Repeat("a", 65)} {
+		if ValidCohortID(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+}
+
 func TestVerificationCode_ListRecentCodes(t *testing.T) {
 	t.Parallel()
 
@@ -157,7 +547,7 @@ func TestVerificationCode_ListRecentCodes(t *testing.T) {
 		LongExpiresAt: time.Now().Add(2 * time.Hour),
 	}
 
-	if err := db.SaveVerificationCode(vc, time.Hour); err != nil {
+	if err := db.SaveVerificationCode(context.Background(), vc, time.Hour); err != nil {
 		t.Fatal(err)
 	}
 
@@ -192,7 +582,7 @@ func TestVerificationCode_ExpireVerificationCode(t *testing.T) {
 		LongExpiresAt: time.Now().Add(2 * time.Hour),
 	}
 
-	if err := db.SaveVerificationCode(vc, time.Hour); err != nil {
+	if err := db.SaveVerificationCode(context.Background(), vc, time.Hour); err != nil {
 		t.Fatal(err)
 	}
 
@@ -219,6 +609,216 @@ func TestVerificationCode_ExpireVerificationCode(t *testing.T) {
 	}
 }
 
+func TestVerificationCode_ApproveCode(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	issuer := &User{Model: gorm.Model{ID: 10}, Name: "Issuer", Email: "issuer@example.com"}
+	approver := &User{Model: gorm.Model{ID: 11}, Name: "Approver", Email: "approver@example.com"}
+
+	newCode := func(t *testing.T, code string, approvalExpiresAt time.Time) *VerificationCode {
+		t.Helper()
+
+		vc := &VerificationCode{
+			RealmID:           1,
+			Code:              code,
+			LongCode:          code + "abcdefgh",
+			TestType:          "confirmed",
+			ExpiresAt:         time.Now().Add(time.Hour),
+			LongExpiresAt:     time.Now().Add(2 * time.Hour),
+			IssuingUserID:     issuer.ID,
+			ApprovalStatus:    ApprovalStatusPending,
+			ApprovalExpiresAt: &approvalExpiresAt,
+		}
+		if err := db.SaveVerificationCode(context.Background(), vc, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		return vc
+	}
+
+	t.Run("approve", func(t *testing.T) {
+		vc := newCode(t, "111111", time.Now().Add(time.Hour))
+
+		if _, err := db.ApproveCode(1, vc.UUID, issuer); !errors.Is(err, ErrApproverIsIssuer) {
+			t.Errorf("expected %v to be %v", err, ErrApproverIsIssuer)
+		}
+
+		got, err := db.ApproveCode(1, vc.UUID, approver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ApprovalStatus != ApprovalStatusApproved {
+			t.Errorf("expected %q to be %q", got.ApprovalStatus, ApprovalStatusApproved)
+		}
+		if got.ApprovingUserID != approver.ID {
+			t.Errorf("expected %d to be %d", got.ApprovingUserID, approver.ID)
+		}
+		if got.ExpiresAt.Before(vc.ExpiresAt) {
+			t.Errorf("expected expiry %v to be extended from %v", got.ExpiresAt, vc.ExpiresAt)
+		}
+
+		if _, err := db.ApproveCode(1, vc.UUID, approver); !errors.Is(err, ErrCodeNotPendingApproval) {
+			t.Errorf("expected %v to be %v", err, ErrCodeNotPendingApproval)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		vc := newCode(t, "222222", time.Now().Add(time.Hour))
+
+		got, err := db.RejectCode(1, vc.UUID, approver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ApprovalStatus != ApprovalStatusRejected {
+			t.Errorf("expected %q to be %q", got.ApprovalStatus, ApprovalStatusRejected)
+		}
+		if got.ExpiresAt.After(time.Now()) {
+			t.Errorf("expected expired, got %v", got.ExpiresAt)
+		}
+	})
+
+	t.Run("timed_out", func(t *testing.T) {
+		vc := newCode(t, "333333", time.Now().Add(-1*time.Minute))
+
+		if _, err := db.ApproveCode(1, vc.UUID, approver); !errors.Is(err, ErrCodeApprovalExpired) {
+			t.Errorf("expected %v to be %v", err, ErrCodeApprovalExpired)
+		}
+	})
+
+	t.Run("wrong_realm", func(t *testing.T) {
+		vc := newCode(t, "444444", time.Now().Add(time.Hour))
+
+		if _, err := db.ApproveCode(2, vc.UUID, approver); !IsNotFound(err) {
+			t.Errorf("expected not found, got %v", err)
+		}
+	})
+}
+
+func TestVerificationCode_ImportVerificationCode(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	ctx := context.Background()
+
+	realm := NewRealmWithDefaults("import")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &User{Model: gorm.Model{ID: 10}, Name: "Admin", Email: "admin@example.com"}
+
+	newCode := func(code, longCode string) *VerificationCode {
+		return &VerificationCode{
+			Code:          code,
+			LongCode:      longCode,
+			TestType:      "confirmed",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(2 * time.Hour),
+		}
+	}
+
+	vc := newCode("87654321", "legacylongcode1234")
+	if err := db.ImportVerificationCode(ctx, realm, vc, time.Hour, admin); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.FindVerificationCode("legacylongcode1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RealmID != realm.ID {
+		t.Errorf("expected %d to be %d", got.RealmID, realm.ID)
+	}
+
+	// The short code of an existing code collides, in either column.
+	if err := db.ImportVerificationCode(ctx, realm, newCode("87654321", "otherlongcode1234"), time.Hour, admin); !errors.Is(err, ErrCodeCollision) {
+		t.Errorf("expected %v to be %v", err, ErrCodeCollision)
+	}
+	if err := db.ImportVerificationCode(ctx, realm, newCode("11223344", "87654321"), time.Hour, admin); !errors.Is(err, ErrCodeCollision) {
+		t.Errorf("expected %v to be %v", err, ErrCodeCollision)
+	}
+
+	// Expired codes are rejected.
+	expired := newCode("55667788", "expiredlongcode12")
+	expired.ExpiresAt = time.Now().Add(-1 * time.Minute)
+	if err := db.ImportVerificationCode(ctx, realm, expired, time.Hour, admin); !errors.Is(err, ErrCodeAlreadyExpired) {
+		t.Errorf("expected %v to be %v", err, ErrCodeAlreadyExpired)
+	}
+
+	audits, _, err := db.ListAudits(nil, WithAuditRealmID(realm.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, a := range audits {
+		if a.Action == "imported migrated code" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected audit entry for imported code")
+	}
+
+	// Imported codes are not counted as issued.
+	stats, err := realm.Stats(db, time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stat := range stats {
+		if stat.CodesIssued != 0 {
+			t.Errorf("expected %d to be 0", stat.CodesIssued)
+		}
+	}
+}
+
+func TestVerificationCode_IsPendingApproval(t *testing.T) {
+	t.Parallel()
+
+	past, future := time.Now().Add(-1*time.Minute), time.Now().Add(time.Hour)
+
+	cases := []struct {
+		name    string
+		code    *VerificationCode
+		pending bool
+		expired bool
+	}{
+		{
+			name: "not_required",
+			code: &VerificationCode{},
+		},
+		{
+			name:    "pending",
+			code:    &VerificationCode{ApprovalStatus: ApprovalStatusPending, ApprovalExpiresAt: &future},
+			pending: true,
+		},
+		{
+			name:    "timed_out",
+			code:    &VerificationCode{ApprovalStatus: ApprovalStatusPending, ApprovalExpiresAt: &past},
+			expired: true,
+		},
+		{
+			name: "approved",
+			code: &VerificationCode{ApprovalStatus: ApprovalStatusApproved, ApprovalExpiresAt: &past},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := tc.code.IsPendingApproval(); got != tc.pending {
+				t.Errorf("expected pending %t to be %t", got, tc.pending)
+			}
+			if got := tc.code.IsApprovalExpired(); got != tc.expired {
+				t.Errorf("expected expired %t to be %t", got, tc.expired)
+			}
+		})
+	}
+}
+
 func TestVerCodeValidate(t *testing.T) {
 	t.Parallel()
 
@@ -316,7 +916,7 @@ func TestDeleteVerificationCode(t *testing.T) {
 		LongExpiresAt: time.Now().Add(time.Hour),
 	}
 
-	if err := db.SaveVerificationCode(&code, maxAge); err != nil {
+	if err := db.SaveVerificationCode(context.Background(), &code, maxAge); err != nil {
 		t.Fatal(err)
 	}
 
@@ -351,7 +951,7 @@ func TestVerificationCodesCleanup(t *testing.T) {
 		{Code: "333333", LongCode: "333333ABCDEF", RealmID: realm.ID, TestType: "negative", ExpiresAt: now.Add(time.Minute), LongExpiresAt: now.Add(time.Hour)},
 	}
 	for _, rec := range testData {
-		if err := db.SaveVerificationCode(rec, maxAge); err != nil {
+		if err := db.SaveVerificationCode(context.Background(), rec, maxAge); err != nil {
 			t.Fatalf("can't save test data: %v", err)
 		}
 	}
@@ -448,7 +1048,7 @@ func TestStatDatesOnCreate(t *testing.T) {
 	}
 
 	for i, test := range tests {
-		if err := db.SaveVerificationCode(test.code, maxAge); err != nil {
+		if err := db.SaveVerificationCode(context.Background(), test.code, maxAge); err != nil {
 			t.Fatalf("[%d] error saving code: %v", i, err)
 		}
 
@@ -541,3 +1141,56 @@ func TestStatDatesOnCreate(t *testing.T) {
 		}
 	}
 }
+
+func TestVerificationCode_SupervisingUserStats(t *testing.T) {
+	t.Parallel()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	now := time.Now()
+	code := &VerificationCode{
+		Code:              "222222",
+		LongCode:          "222222",
+		TestType:          "confirmed",
+		ExpiresAt:         now.Add(time.Second),
+		LongExpiresAt:     now.Add(time.Second),
+		IssuingUserID:     100,
+		SupervisingUserID: 101,
+		RealmID:           300,
+	}
+	if err := db.SaveVerificationCode(context.Background(), code, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var stats []*UserStats
+	if err := db.db.
+		Model(&UserStats{}).
+		Order("user_id").
+		Find(&stats).
+		Error; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(stats), 2; got != want {
+		t.Fatalf("expected %d stats to be %d", got, want)
+	}
+
+	if got, want := stats[0].UserID, uint(100); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := stats[0].CodesIssued, uint(1); got != want {
+		t.Errorf("expected issuer codes issued %d to be %d", got, want)
+	}
+	if got, want := stats[0].CodesSupervised, uint(0); got != want {
+		t.Errorf("expected issuer codes supervised %d to be %d", got, want)
+	}
+
+	if got, want := stats[1].UserID, uint(101); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+	if got, want := stats[1].CodesIssued, uint(0); got != want {
+		t.Errorf("expected supervisor codes issued %d to be %d", got, want)
+	}
+	if got, want := stats[1].CodesSupervised, uint(1); got != want {
+		t.Errorf("expected supervisor codes supervised %d to be %d", got, want)
+	}
+}
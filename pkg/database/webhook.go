@@ -0,0 +1,378 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/internal/project"
+	"github.com/google/exposure-notifications-verification-server/pkg/cache"
+	"github.com/google/exposure-notifications-verification-server/pkg/outbound"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxWebhooksPerRealm is the maximum number of webhook endpoints a realm can
+	// configure.
+	maxWebhooksPerRealm = 10
+
+	// webhookSecretBytes is the number of random bytes in a generated webhook
+	// secret.
+	webhookSecretBytes = 32
+
+	// webhookResolveTimeout bounds the DNS lookup when a webhook URL is
+	// validated.
+	webhookResolveTimeout = 5 * time.Second
+
+	// webhookEndpointsCacheTTL is how long a realm's webhook endpoints are
+	// cached. The cache is purged when a webhook is saved or deleted.
+	webhookEndpointsCacheTTL = 5 * time.Minute
+)
+
+var _ Auditable = (*Webhook)(nil)
+
+// Webhook is an HTTPS endpoint which receives the realm's code events. Each
+// webhook subscribes to a subset of events and has its own signing secret.
+type Webhook struct {
+	gorm.Model
+	Errorable
+
+	// RealmID is the realm whose events are delivered.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// URL is the HTTPS endpoint events are posted to.
+	URL string `gorm:"column:url; type:text; not null;"`
+
+	// Secret is the key used to sign deliveries. It is generated when the
+	// webhook is created and is encrypted/decrypted automatically by callbacks.
+	Secret                string `gorm:"column:secret; type:text; not null;" json:"-"` // ignored by zap's JSON formatter
+	SecretPlaintextCache  string `gorm:"-"`
+	SecretCiphertextCache string `gorm:"-"`
+
+	// Events are the event types delivered to the webhook. Other events are
+	// skipped.
+	Events pq.StringArray `gorm:"column:events; type:varchar(32)[];"`
+
+	// PayloadVersion is the payload schema the webhook receives. Realms can pin
+	// an older version so payload changes do not break their integration. New
+	// webhooks default to the latest version.
+	PayloadVersion uint `gorm:"column:payload_version; type:integer; not null; default:1;"`
+
+	// allowLocalhost permits plain http URLs to a loopback address. It is set
+	// from the webhook configuration when the webhook is saved.
+	allowLocalhost bool
+}
+
+// TableName sets the table name.
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// BeforeSave validates the webhook.
+func (w *Webhook) BeforeSave(tx *gorm.DB) error {
+	if w.RealmID == 0 {
+		w.AddError("realmID", "is required")
+	}
+
+	w.URL = project.TrimSpace(w.URL)
+	if w.URL == "" {
+		w.AddError("url", "cannot be blank")
+	} else if u, err := url.Parse(w.URL); err != nil || u.Host == "" {
+		w.AddError("url", "must be a valid https URL")
+	} else if u.User != nil {
+		w.AddError("url", "cannot contain credentials")
+	} else {
+		// Deliveries are made from inside the deployment, so the URL must not
+		// point at an internal address. The delivery client checks the address
+		// again when it connects.
+		ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+		defer cancel()
+
+		if err := outbound.ValidateURL(ctx, w.URL, w.allowLocalhost); errors.Is(err, outbound.ErrInsecureScheme) {
+			w.AddError("url", "must be a valid https URL")
+		} else if err != nil {
+			w.AddError("url", err.Error())
+		}
+	}
+
+	if w.Secret == "" {
+		w.AddError("secret", "cannot be blank")
+	}
+
+	seen := make(map[string]struct{}, len(w.Events))
+	events := make([]string, 0, len(w.Events))
+	for _, v := range w.Events {
+		v = strings.ToLower(project.TrimSpace(v))
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+
+		if !webhook.ValidEventType(v) {
+			w.AddError("events", fmt.Sprintf("%q is not a valid event", v))
+			continue
+		}
+		events = append(events, v)
+	}
+	sort.Strings(events)
+	w.Events = events
+
+	if len(w.Events) == 0 {
+		w.AddError("events", "must include at least one event")
+	}
+
+	if w.PayloadVersion == 0 {
+		w.PayloadVersion = webhook.LatestPayloadVersion
+	}
+	if !webhook.ValidPayloadVersion(w.PayloadVersion) {
+		w.AddError("payloadVersion", "is not a supported version")
+	}
+
+	if len(w.Errors()) > 0 {
+		return fmt.Errorf("validation failed: %v", w.Errors())
+	}
+	return nil
+}
+
+// Subscribed returns true if the webhook subscribes to the event type.
+func (w *Webhook) Subscribed(t webhook.EventType) bool {
+	for _, v := range w.Events {
+		if v == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Endpoint returns the webhook as a dispatcher endpoint.
+func (w *Webhook) Endpoint() *webhook.Endpoint {
+	events := make([]webhook.EventType, 0, len(w.Events))
+	for _, v := range w.Events {
+		events = append(events, webhook.EventType(v))
+	}
+
+	return &webhook.Endpoint{
+		ID:             w.ID,
+		URL:            w.URL,
+		Secret:         w.Secret,
+		Events:         events,
+		PayloadVersion: w.PayloadVersion,
+	}
+}
+
+// Display is a human-readable description of the webhook.
+func (w *Webhook) Display() string {
+	return fmt.Sprintf("%s (%s, v%d)", w.URL, strings.Join(w.Events, ", "), w.PayloadVersion)
+}
+
+// ListWebhooks lists the realm's webhooks.
+func (r *Realm) ListWebhooks(db *Database) ([]*Webhook, error) {
+	var webhooks []*Webhook
+	if err := db.db.
+		Model(&Webhook{}).
+		Where("realm_id = ?", r.ID).
+		Order("created_at ASC").
+		Find(&webhooks).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return webhooks, nil
+		}
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// FindWebhook finds the realm's webhook with the given ID.
+func (r *Realm) FindWebhook(db *Database, id interface{}) (*Webhook, error) {
+	var w Webhook
+	if err := db.db.
+		Model(&Webhook{}).
+		Where("realm_id = ?", r.ID).
+		Where("id = ?", id).
+		First(&w).
+		Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// ListWebhookEndpoints returns the realm's webhooks as dispatcher endpoints.
+// It implements webhook.EndpointLister. The dispatcher lists the endpoints for
+// every event, so they are cached to avoid a query and a secret decryption each
+// time.
+func (db *Database) ListWebhookEndpoints(realmID uint) ([]*webhook.Endpoint, error) {
+	if db.cacher == nil {
+		return db.listWebhookEndpoints(realmID)
+	}
+
+	var endpoints []*webhook.Endpoint
+	if err := db.cacher.Fetch(context.Background(), webhookEndpointsCacheKey(realmID), &endpoints, webhookEndpointsCacheTTL, func() (interface{}, error) {
+		return db.listWebhookEndpoints(realmID)
+	}); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// purgeWebhookEndpoints removes the realm's cached webhook endpoints, so that
+// the next event uses the saved webhooks.
+func (db *Database) purgeWebhookEndpoints(realmID uint) {
+	if db.cacher == nil {
+		return
+	}
+
+	if err := db.cacher.Delete(context.Background(), webhookEndpointsCacheKey(realmID)); err != nil {
+		db.logger.Errorw("failed to purge cached webhook endpoints",
+			"realmID", realmID,
+			"error", err)
+	}
+}
+
+func webhookEndpointsCacheKey(realmID uint) *cache.Key {
+	return &cache.Key{
+		Namespace: "webhooks:by_realm_id",
+		Key:       strconv.FormatUint(uint64(realmID), 10),
+	}
+}
+
+func (db *Database) listWebhookEndpoints(realmID uint) ([]*webhook.Endpoint, error) {
+	webhooks, err := (&Realm{Model: gorm.Model{ID: realmID}}).ListWebhooks(db)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]*webhook.Endpoint, 0, len(webhooks))
+	for _, w := range webhooks {
+		endpoints = append(endpoints, w.Endpoint())
+	}
+	return endpoints, nil
+}
+
+// SaveWebhook saves the webhook. A secret is generated for new webhooks which
+// do not have one. The realm's cached endpoints are purged.
+func (db *Database) SaveWebhook(w *Webhook, actor Auditable) error {
+	if w == nil {
+		return fmt.Errorf("provided webhook is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	w.allowLocalhost = db.config.Webhooks.AllowLocalhost
+
+	if w.Secret == "" {
+		b := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(b); err != nil {
+			return fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		w.Secret = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		var existing Webhook
+		if err := tx.
+			Model(&Webhook{}).
+			Where("id = ?", w.ID).
+			First(&existing).
+			Error; err != nil && !IsNotFound(err) {
+			return fmt.Errorf("failed to get existing webhook")
+		}
+
+		if existing.ID == 0 {
+			var count int
+			if err := tx.
+				Model(&Webhook{}).
+				Where("realm_id = ?", w.RealmID).
+				Count(&count).
+				Error; err != nil {
+				return fmt.Errorf("failed to count webhooks: %w", err)
+			}
+			if count >= maxWebhooksPerRealm {
+				w.AddError("url", fmt.Sprintf("realm cannot have more than %d webhooks", maxWebhooksPerRealm))
+				return fmt.Errorf("validation failed: %v", w.Errors())
+			}
+		}
+
+		if err := tx.Save(w).Error; err != nil {
+			return fmt.Errorf("failed to save webhook: %w", err)
+		}
+
+		var audit *AuditEntry
+		if existing.ID == 0 {
+			audit = BuildAuditEntry(actor, "created webhook", w, w.RealmID)
+		} else {
+			audit = BuildAuditEntry(actor, "updated webhook", w, w.RealmID)
+			audit.Diff = stringDiff(existing.Display(), w.Display())
+		}
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	db.purgeWebhookEndpoints(w.RealmID)
+	return nil
+}
+
+// DeleteWebhook permanently deletes the webhook and purges the realm's cached
+// endpoints.
+func (db *Database) DeleteWebhook(w *Webhook, actor Auditable) error {
+	if w == nil {
+		return fmt.Errorf("provided webhook is nil")
+	}
+
+	if actor == nil {
+		return fmt.Errorf("auditing actor is nil")
+	}
+
+	if err := db.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(w).Error; err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+
+		audit := BuildAuditEntry(actor, "deleted webhook", w, w.RealmID)
+		if err := tx.Save(audit).Error; err != nil {
+			return fmt.Errorf("failed to save audits: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	db.purgeWebhookEndpoints(w.RealmID)
+	return nil
+}
+
+func (w *Webhook) AuditID() string {
+	return fmt.Sprintf("webhooks:%d", w.ID)
+}
+
+func (w *Webhook) AuditDisplay() string {
+	return w.URL
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/eventsink"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
+	"github.com/jinzhu/gorm"
+)
+
+var _ webhook.Store = (*Database)(nil)
+
+// WebhookDelivery is an event waiting to be delivered to one webhook. It is
+// saved in the same transaction as the change to the code, so the event is
+// only delivered if the change is committed, and it is not lost if the server
+// restarts before it is delivered. It is deleted once it is delivered or
+// dead-lettered.
+type WebhookDelivery struct {
+	// ID is the primary key.
+	ID uint `gorm:"primary_key;"`
+
+	// WebhookID is the webhook the event is delivered to. Deliveries are deleted
+	// with their webhook.
+	WebhookID uint `gorm:"column:webhook_id; type:integer; not null;"`
+
+	// RealmID is the realm whose code the event is about.
+	RealmID uint `gorm:"column:realm_id; type:integer; not null;"`
+
+	// VerificationCodeID is the code the event is about. It is used to cancel
+	// the code's scheduled expired event once the code is claimed or expired.
+	VerificationCodeID uint `gorm:"column:verification_code_id; type:integer;"`
+
+	// EventType is the type of the event.
+	EventType string `gorm:"column:event_type; type:varchar(32); not null;"`
+
+	// Event is the JSON-encoded webhook.Event. It never contains the code.
+	Event string `gorm:"column:event; type:jsonb; not null;"`
+
+	// Attempts is the number of failed attempts so far.
+	Attempts int `gorm:"column:attempts; type:integer; not null; default:0;"`
+
+	// NextAttemptAt is when the delivery is next due. While a dispatcher is
+	// attempting it, it is the end of the dispatcher's lease.
+	NextAttemptAt time.Time `gorm:"column:next_attempt_at; not null;"`
+
+	CreatedAt time.Time `gorm:"column:created_at;"`
+}
+
+// TableName sets the table name.
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// enqueueWebhookEvent queues the event for each of the realm's webhooks which
+// subscribe to it. It must be called in the transaction which changes the
+// code, and notifyWebhooks must be called once it is committed. The code itself
+// is never included.
+//
+// Issuing a code also schedules its expired event for when the code expires
+// without being claimed. A code is only claimed or expired once, so queueing
+// either event cancels the scheduled one.
+func (db *Database) enqueueWebhookEvent(tx *gorm.DB, typ webhook.EventType, vc *VerificationCode) error {
+	if db.webhooks == nil || vc == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	switch typ {
+	case webhook.EventIssued:
+		if err := db.queueWebhookEvent(tx, typ, vc, now); err != nil {
+			return err
+		}
+		return db.scheduleWebhookExpiry(tx, vc)
+	default:
+		if err := db.cancelWebhookExpiry(tx, vc); err != nil {
+			return err
+		}
+		return db.queueWebhookEvent(tx, typ, vc, now)
+	}
+}
+
+// scheduleWebhookExpiry replaces the code's scheduled expired event with one
+// due when the code next expires: when its approval window ends if it is
+// pending, or else when both the short and long codes have expired. It must be
+// called again when the code's expiry changes.
+func (db *Database) scheduleWebhookExpiry(tx *gorm.DB, vc *VerificationCode) error {
+	if db.webhooks == nil || vc == nil {
+		return nil
+	}
+
+	if err := db.cancelWebhookExpiry(tx, vc); err != nil {
+		return err
+	}
+
+	at := vc.ExpiresAt
+	if vc.LongExpiresAt.After(at) {
+		at = vc.LongExpiresAt
+	}
+	if vc.ApprovalStatus == ApprovalStatusPending && vc.ApprovalExpiresAt != nil && vc.ApprovalExpiresAt.Before(at) {
+		at = *vc.ApprovalExpiresAt
+	}
+	return db.queueWebhookEvent(tx, webhook.EventExpired, vc, at.UTC())
+}
+
+// cancelWebhookExpiry deletes the code's scheduled expired event, if there is
+// one.
+func (db *Database) cancelWebhookExpiry(tx *gorm.DB, vc *VerificationCode) error {
+	if err := tx.
+		Where("verification_code_id = ?", vc.ID).
+		Where("event_type = ?", string(webhook.EventExpired)).
+		Delete(&WebhookDelivery{}).
+		Error; err != nil {
+		return fmt.Errorf("failed to cancel webhook event: %w", err)
+	}
+	return nil
+}
+
+// queueWebhookEvent queues an event which happens at the given time for each
+// of the realm's webhooks which subscribe to it. The event is due at that
+// time.
+func (db *Database) queueWebhookEvent(tx *gorm.DB, typ webhook.EventType, vc *VerificationCode, at time.Time) error {
+	endpoints, err := db.ListWebhookEndpoints(vc.RealmID)
+	if err != nil {
+		return fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+
+	var event []byte
+	for _, ep := range endpoints {
+		if !ep.Subscribed(typ) {
+			continue
+		}
+
+		if event == nil {
+			if event, err = json.Marshal(&webhook.Event{
+				Type:        typ,
+				RealmID:     vc.RealmID,
+				UUID:        vc.UUID,
+				TestType:    vc.TestType,
+				SymptomDate: eventsink.FormatDate(vc.SymptomDate),
+				TestDate:    eventsink.FormatDate(vc.TestDate),
+				IssuedAt:    vc.CreatedAt.UTC(),
+				ExpiresAt:   vc.ExpiresAt.UTC(),
+				Timestamp:   at,
+			}); err != nil {
+				return fmt.Errorf("failed to marshal webhook event: %w", err)
+			}
+		}
+
+		if err := tx.Create(&WebhookDelivery{
+			WebhookID:          ep.ID,
+			RealmID:            vc.RealmID,
+			VerificationCodeID: vc.ID,
+			EventType:          string(typ),
+			Event:              string(event),
+			NextAttemptAt:      at,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to queue webhook event: %w", err)
+		}
+	}
+	return nil
+}
+
+// notifyWebhooks wakes the webhook dispatcher to deliver events which were just
+// committed.
+func (db *Database) notifyWebhooks() {
+	if db.webhooks != nil {
+		db.webhooks.Notify()
+	}
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries until the given time
+// and returns them, oldest first. Deliveries which are leased by another
+// dispatcher are skipped. It implements webhook.Store.
+func (db *Database) ClaimWebhookDeliveries(limit int, until time.Time) ([]*webhook.Delivery, error) {
+	var rows []*WebhookDelivery
+	if err := db.db.Raw(`
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, until, time.Now().UTC(), limit).
+		Scan(&rows).
+		Error; err != nil {
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]*webhook.Delivery, 0, len(rows))
+	for _, row := range rows {
+		var e webhook.Event
+		if err := json.Unmarshal([]byte(row.Event), &e); err != nil {
+			// The event can never be delivered, so it is dropped instead of being
+			// claimed again.
+			db.logger.Errorw("failed to unmarshal webhook event",
+				"deliveryID", row.ID,
+				"error", err)
+			if err := db.DeleteWebhookDelivery(row.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		deliveries = append(deliveries, &webhook.Delivery{
+			ID:        row.ID,
+			WebhookID: row.WebhookID,
+			Attempts:  row.Attempts,
+			Event:     &e,
+		})
+	}
+	return deliveries, nil
+}
+
+// RescheduleWebhookDelivery sets the number of attempts made and when the
+// delivery is next due. It implements webhook.Store.
+func (db *Database) RescheduleWebhookDelivery(id uint, attempts int, at time.Time) error {
+	if err := db.db.
+		Model(&WebhookDelivery{}).
+		Where("id = ?", id).
+		UpdateColumns(map[string]interface{}{
+			"attempts":        attempts,
+			"next_attempt_at": at.UTC(),
+		}).
+		Error; err != nil {
+		return fmt.Errorf("failed to reschedule webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhookDelivery removes a delivery which was delivered or
+// dead-lettered. It implements webhook.Store.
+func (db *Database) DeleteWebhookDelivery(id uint) error {
+	if err := db.db.
+		Where("id = ?", id).
+		Delete(&WebhookDelivery{}).
+		Error; err != nil {
+		return fmt.Errorf("failed to delete webhook delivery: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/webhook"
+	"github.com/jinzhu/gorm"
+)
+
+// testQueueWebhooks makes the database queue webhook events without delivering
+// them, so the deliveries can be inspected.
+func testQueueWebhooks(tb testing.TB, db *Database) {
+	tb.Helper()
+
+	d, err := webhook.NewDispatcher(context.Background(), db, &webhook.Config{
+		BatchSize:     10,
+		PollInterval:  time.Hour,
+		LeaseDuration: time.Minute,
+		Workers:       1,
+		MaxInFlight:   1,
+		MaxAttempts:   1,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	db.webhooks = d
+}
+
+func TestDatabase_WebhookDeliveries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	testQueueWebhooks(t, db)
+
+	realm := NewRealmWithDefaults("webhook-deliveries")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Webhook{
+		RealmID: realm.ID,
+		URL:     "https://203.0.113.10/hook",
+		Events:  []string{"issued", "expired"},
+	}
+	if err := db.SaveWebhook(w, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	vc := &VerificationCode{
+		RealmID:       realm.ID,
+		Code:          "123456",
+		LongCode:      "defghijk329024",
+		TestType:      "confirmed",
+		ExpiresAt:     time.Now().Add(time.Hour),
+		LongExpiresAt: time.Now().Add(2 * time.Hour),
+	}
+	if err := db.SaveVerificationCode(ctx, vc, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExpireCode(vc.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both events are queued, oldest first.
+	deliveries, err := db.ClaimWebhookDeliveries(10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(deliveries), 2; got != want {
+		t.Fatalf("expected %d deliveries to be %d", got, want)
+	}
+	for i, typ := range []webhook.EventType{webhook.EventIssued, webhook.EventExpired} {
+		dl := deliveries[i]
+		if got, want := dl.WebhookID, w.ID; got != want {
+			t.Errorf("expected webhook %d to be %d", got, want)
+		}
+		if got, want := dl.Event.Type, typ; got != want {
+			t.Errorf("expected type %q to be %q", got, want)
+		}
+		if got, want := dl.Event.UUID, vc.UUID; got != want {
+			t.Errorf("expected uuid %q to be %q", got, want)
+		}
+	}
+
+	// Leased deliveries are not claimed again.
+	leased, err := db.ClaimWebhookDeliveries(10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(leased), 0; got != want {
+		t.Errorf("expected %d leased deliveries to be %d", got, want)
+	}
+
+	// A rescheduled delivery is claimed once it is due, with its attempts.
+	if err := db.RescheduleWebhookDelivery(deliveries[0].ID, 1, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	retried, err := db.ClaimWebhookDeliveries(10, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(retried), 1; got != want {
+		t.Fatalf("expected %d retried deliveries to be %d", got, want)
+	}
+	if got, want := retried[0].Attempts, 1; got != want {
+		t.Errorf("expected %d attempts to be %d", got, want)
+	}
+
+	if err := db.DeleteWebhookDelivery(retried[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the webhook deletes its deliveries.
+	if err := db.DeleteWebhook(w, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.db.Model(&WebhookDelivery{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := count, 0; got != want {
+		t.Errorf("expected %d deliveries to be %d", got, want)
+	}
+}
+
+func TestDatabase_WebhookExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	testQueueWebhooks(t, db)
+
+	realm := NewRealmWithDefaults("webhook-expiry")
+	if err := db.SaveRealm(realm, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveWebhook(&Webhook{
+		RealmID: realm.ID,
+		URL:     "https://203.0.113.10/hook",
+		Events:  []string{"issued", "claimed", "expired"},
+	}, SystemTest); err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(t *testing.T, code string, approvalExpiresAt *time.Time) *VerificationCode {
+		t.Helper()
+
+		vc := &VerificationCode{
+			RealmID:       realm.ID,
+			Code:          code,
+			LongCode:      code + "abcdefgh",
+			TestType:      "confirmed",
+			ExpiresAt:     time.Now().Add(time.Hour),
+			LongExpiresAt: time.Now().Add(2 * time.Hour),
+			IssuingUserID: 10,
+		}
+		if approvalExpiresAt != nil {
+			vc.ApprovalStatus = ApprovalStatusPending
+			vc.ApprovalExpiresAt = approvalExpiresAt
+		}
+		if err := db.SaveVerificationCode(ctx, vc, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		return vc
+	}
+
+	// expired returns when each queued expired event for the code is due.
+	expired := func(t *testing.T, vc *VerificationCode) []time.Time {
+		t.Helper()
+
+		var rows []*WebhookDelivery
+		if err := db.db.
+			Where("verification_code_id = ?", vc.ID).
+			Where("event_type = ?", "expired").
+			Find(&rows).
+			Error; err != nil {
+			t.Fatal(err)
+		}
+
+		times := make([]time.Time, 0, len(rows))
+		for _, row := range rows {
+			times = append(times, row.NextAttemptAt)
+		}
+		return times
+	}
+
+	checkDue := func(t *testing.T, got []time.Time, want time.Time) {
+		t.Helper()
+
+		if len(got) != 1 {
+			t.Fatalf("expected %d expired events to be 1", len(got))
+		}
+		if d := got[0].Sub(want); d < -time.Second || d > time.Second {
+			t.Errorf("expected expired event due at %v to be due at %v", got[0], want)
+		}
+	}
+
+	t.Run("claimed", func(t *testing.T) {
+		vc := issue(t, "11223344", nil)
+		checkDue(t, expired(t, vc), vc.LongExpiresAt)
+
+		if _, err := db.VerifyCodeAndIssueToken(ctx, &IssueTokenRequest{
+			RealmID:          realm.ID,
+			VerificationCode: "11223344",
+			AcceptTypes:      api.AcceptTypes{api.TestTypeConfirmed: struct{}{}},
+			ExpireAfter:      time.Hour,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if got := expired(t, vc); len(got) != 0 {
+			t.Errorf("expected expired events %v to be cancelled", got)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		vc := issue(t, "22334455", nil)
+
+		if _, err := db.ExpireCode(vc.UUID); err != nil {
+			t.Fatal(err)
+		}
+		checkDue(t, expired(t, vc), time.Now())
+	})
+
+	t.Run("approval", func(t *testing.T) {
+		approvalExpiresAt := time.Now().Add(30 * time.Minute)
+		vc := issue(t, "33445566", &approvalExpiresAt)
+		checkDue(t, expired(t, vc), approvalExpiresAt)
+
+		approved, err := db.ApproveCode(realm.ID, vc.UUID, &User{Model: gorm.Model{ID: 11}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDue(t, expired(t, vc), approved.LongExpiresAt)
+	})
+}
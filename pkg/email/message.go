@@ -0,0 +1,53 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// headerReplacer removes line breaks from header values so they cannot add
+// headers of their own.
+var headerReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// ValidateAddress returns an error if addr is not a single, bare email address
+// such as "user@example.com".
+func ValidateAddress(addr string) error {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return fmt.Errorf("invalid email address: %w", err)
+	}
+	if parsed.Address != addr {
+		return fmt.Errorf("invalid email address: must not include a name")
+	}
+	return nil
+}
+
+// PlainTextMessage builds a plain text message with the given headers and body,
+// suitable for Provider.SendEmail.
+func PlainTextMessage(from, to, subject, body string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerReplacer.Replace(subject))
+	fmt.Fprintf(&b, "To: %s\r\n", headerReplacer.Replace(to))
+	fmt.Fprintf(&b, "From: %s\r\n", headerReplacer.Replace(from))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return b.Bytes()
+}
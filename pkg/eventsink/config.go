@@ -0,0 +1,85 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// SinkType represents a type of event sink.
+type SinkType string
+
+const (
+	TypeNone   SinkType = "NONE"
+	TypeStdout SinkType = "STDOUT"
+	TypePubSub SinkType = "PUBSUB"
+)
+
+// Config represents configuration for emitting analytics events.
+type Config struct {
+	Type SinkType `env:"EVENT_SINK_TYPE, default=NONE"`
+
+	// PubSubTopic is the full name of the topic to publish events to, for
+	// example "projects/my-project/topics/verification-events". Requests are
+	// authorized with the application default credentials.
+	PubSubTopic string `env:"EVENT_SINK_PUBSUB_TOPIC"`
+
+	// SampleRate is the fraction of events to emit, between 0 and 1. Each event
+	// is sampled independently.
+	SampleRate float64 `env:"EVENT_SINK_SAMPLE_RATE, default=1"`
+
+	// ExternalIDKey is the HMAC key used to hash external issuer IDs. If it is
+	// empty, external IDs are omitted from events.
+	ExternalIDKey envconfig.Base64Bytes `env:"EVENT_SINK_EXTERNAL_ID_KEY" json:"-"`
+
+	// BufferSize is the number of events held in memory while waiting to be
+	// written. When the buffer is full, new events are dropped.
+	BufferSize int `env:"EVENT_SINK_BUFFER_SIZE, default=1000"`
+
+	// BatchSize is the maximum number of events written at once.
+	BatchSize int `env:"EVENT_SINK_BATCH_SIZE, default=100"`
+
+	// Timeout is the maximum time to spend writing a batch.
+	Timeout time.Duration `env:"EVENT_SINK_TIMEOUT, default=5s"`
+}
+
+// SinkFor returns the sink for the configuration.
+func SinkFor(ctx context.Context, c *Config) (Sink, error) {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return nil, fmt.Errorf("EVENT_SINK_SAMPLE_RATE must be between 0 and 1")
+	}
+
+	switch typ := c.Type; typ {
+	case TypeNone, "":
+		return NewNoop(), nil
+	case TypeStdout:
+		return NewForwarder(ctx, newStdoutWriter(), c)
+	case TypePubSub:
+		if c.PubSubTopic == "" {
+			return nil, fmt.Errorf("EVENT_SINK_PUBSUB_TOPIC is required for the PUBSUB event sink")
+		}
+		w, err := newPubSubWriter(ctx, c.PubSubTopic)
+		if err != nil {
+			return nil, err
+		}
+		return NewForwarder(ctx, w, c)
+	default:
+		return nil, fmt.Errorf("unknown event sink type: %v", typ)
+	}
+}
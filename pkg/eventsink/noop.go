@@ -0,0 +1,30 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsink
+
+var _ Sink = (*noop)(nil)
+
+type noop struct{}
+
+// NewNoop creates a sink which discards all events.
+func NewNoop() Sink {
+	return &noop{}
+}
+
+func (n *noop) Send(e *Event) {}
+
+func (n *noop) Close() error {
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	pubSubEndpoint = "https://pubsub.googleapis.com/v1/"
+	pubSubScope    = "https://www.googleapis.com/auth/pubsub"
+)
+
+var _ writer = (*pubSubWriter)(nil)
+
+// pubSubWriter publishes each event as a Pub/Sub message using the REST API.
+// The event type is also set as a message attribute so subscribers can filter
+// on it.
+type pubSubWriter struct {
+	client *http.Client
+	url    string
+}
+
+func newPubSubWriter(ctx context.Context, topic string) (*pubSubWriter, error) {
+	client, err := google.DefaultClient(ctx, pubSubScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pubsub client: %w", err)
+	}
+
+	return &pubSubWriter{
+		client: client,
+		url:    pubSubEndpoint + topic + ":publish",
+	}, nil
+}
+
+type pubSubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+type pubSubPublishRequest struct {
+	Messages []*pubSubMessage `json:"messages"`
+}
+
+func (p *pubSubWriter) Write(ctx context.Context, events []*Event) error {
+	msgs := make([]*pubSubMessage, 0, len(events))
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		msgs = append(msgs, &pubSubMessage{
+			Data:       b,
+			Attributes: map[string]string{"type": string(e.Type)},
+		})
+	}
+
+	body, err := json.Marshal(&pubSubPublishRequest{Messages: msgs})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	if _, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024)); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("pubsub returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *pubSubWriter) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventsink emits a stream of code issuance and claim events for
+// analytics pipelines, so they do not need to query the operational database.
+// Events never contain codes, and external IDs are only included as a keyed
+// hash.
+package eventsink
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// EventType is the kind of event.
+type EventType string
+
+const (
+	EventCodeIssued  EventType = "code_issued"
+	EventCodeClaimed EventType = "code_claimed"
+)
+
+// Event is the structured form of an issuance or claim event. Dates are
+// formatted as YYYY-MM-DD.
+type Event struct {
+	Type           EventType         `json:"type"`
+	RealmID        uint              `json:"realmID"`
+	TestType       string            `json:"testType"`
+	SymptomDate    string            `json:"symptomDate,omitempty"`
+	TestDate       string            `json:"testDate,omitempty"`
+	CohortID       string            `json:"cohortID,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	ExternalIDHash string            `json:"externalIDHash,omitempty"`
+	IssuedAt       time.Time         `json:"issuedAt"`
+	Timestamp      time.Time         `json:"timestamp"`
+}
+
+// Sink receives events.
+type Sink interface {
+	// Send queues the event to be written. It must not block.
+	Send(e *Event)
+
+	// Close flushes queued events and releases resources.
+	Close() error
+}
+
+// HashID returns the base64-encoded HMAC-SHA256 of id with key, so that events
+// for the same external ID can be grouped without revealing it. It returns the
+// empty string if the key or id is empty.
+func HashID(key []byte, id string) string {
+	if len(key) == 0 || id == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// FormatDate formats an optional date for an event.
+func FormatDate(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// writer sends a batch of events to the external system.
+type writer interface {
+	Write(ctx context.Context, events []*Event) error
+	Close() error
+}
+
+// Forwarder is a Sink which samples events, buffers them in memory, and writes
+// them in the background.
+type Forwarder struct {
+	w          writer
+	logger     *zap.SugaredLogger
+	sampleRate float64
+	batchSize  int
+	timeout    time.Duration
+
+	ch       chan *Event
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewForwarder creates a forwarder which writes to w and starts its background
+// worker.
+func NewForwarder(ctx context.Context, w writer, c *Config) (*Forwarder, error) {
+	if c.BufferSize < 1 {
+		return nil, fmt.Errorf("EVENT_SINK_BUFFER_SIZE must be positive")
+	}
+	if c.BatchSize < 1 {
+		return nil, fmt.Errorf("EVENT_SINK_BATCH_SIZE must be positive")
+	}
+
+	f := &Forwarder{
+		w:          w,
+		logger:     logging.FromContext(ctx).Named("eventsink"),
+		sampleRate: c.SampleRate,
+		batchSize:  c.BatchSize,
+		timeout:    c.Timeout,
+		ch:         make(chan *Event, c.BufferSize),
+		doneCh:     make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Send queues the event if it is sampled. If the buffer is full, the event is
+// dropped and an error is logged.
+func (f *Forwarder) Send(e *Event) {
+	if f.sampleRate < 1 && rand.Float64() >= f.sampleRate {
+		return
+	}
+
+	select {
+	case f.ch <- e:
+	default:
+		f.logger.Errorw("event sink buffer full, dropping event",
+			"type", e.Type,
+			"realmID", e.RealmID)
+	}
+}
+
+// Close stops accepting events, flushes the buffer, and closes the writer.
+// Send must not be called after Close.
+func (f *Forwarder) Close() error {
+	f.stopOnce.Do(func() {
+		close(f.ch)
+	})
+	<-f.doneCh
+	return f.w.Close()
+}
+
+// run reads events from the buffer and writes them in batches until the
+// buffer is closed.
+func (f *Forwarder) run() {
+	defer close(f.doneCh)
+
+	for e := range f.ch {
+		batch := []*Event{e}
+
+		// Collect anything else that is already waiting, up to the batch size.
+	collect:
+		for len(batch) < f.batchSize {
+			select {
+			case next, ok := <-f.ch:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, next)
+			default:
+				break collect
+			}
+		}
+
+		f.write(batch)
+	}
+}
+
+func (f *Forwarder) write(batch []*Event) {
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	if err := f.w.Write(ctx, batch); err != nil {
+		f.logger.Errorw("failed to write events",
+			"count", len(batch),
+			"error", err)
+	}
+}
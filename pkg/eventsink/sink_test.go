@@ -0,0 +1,131 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestForwarder_Stdout(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	f, err := NewForwarder(context.Background(), &streamWriter{w: &buf}, &Config{
+		SampleRate: 1,
+		BufferSize: 10,
+		BatchSize:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint(1); i <= 5; i++ {
+		f.Send(&Event{Type: EventCodeIssued, RealmID: i})
+	}
+
+	// Close flushes the buffer.
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		got = append(got, &e)
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("expected 5 events, got %d", len(got))
+	}
+	for i, e := range got {
+		if want := uint(i + 1); e.RealmID != want {
+			t.Errorf("expected event %d to have realm %d, got %d", i, want, e.RealmID)
+		}
+	}
+}
+
+func TestForwarder_Sampling(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	f, err := NewForwarder(context.Background(), &streamWriter{w: &buf}, &Config{
+		SampleRate: 0,
+		BufferSize: 10,
+		BatchSize:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		f.Send(&Event{Type: EventCodeClaimed})
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("expected no events with a zero sample rate, got %q", buf.String())
+	}
+}
+
+func TestHashID(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+
+	if got := HashID(nil, "abc"); got != "" {
+		t.Errorf("expected empty hash without a key, got %q", got)
+	}
+	if got := HashID(key, ""); got != "" {
+		t.Errorf("expected empty hash without an id, got %q", got)
+	}
+
+	a, b := HashID(key, "abc"), HashID(key, "abc")
+	if a == "" || a != b {
+		t.Errorf("expected stable hash, got %q and %q", a, b)
+	}
+	if a == "abc" {
+		t.Errorf("expected id to be hashed")
+	}
+	if HashID([]byte("other"), "abc") == a {
+		t.Errorf("expected hash to depend on the key")
+	}
+}
+
+func TestSinkFor(t *testing.T) {
+	t.Parallel()
+
+	if _, err := SinkFor(context.Background(), &Config{Type: TypeNone}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if _, err := SinkFor(context.Background(), &Config{Type: TypePubSub}); err == nil {
+		t.Errorf("expected error for missing topic")
+	}
+	if _, err := SinkFor(context.Background(), &Config{Type: TypeNone, SampleRate: 2}); err == nil {
+		t.Errorf("expected error for invalid sample rate")
+	}
+	if _, err := SinkFor(context.Background(), &Config{Type: "BANANA"}); err == nil {
+		t.Errorf("expected error for unknown type")
+	}
+}
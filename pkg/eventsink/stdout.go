@@ -0,0 +1,50 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventsink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+var _ writer = (*streamWriter)(nil)
+
+// streamWriter writes events as JSON lines, one event per line. On Cloud Run
+// and similar platforms, stdout is collected by the logging agent and can be
+// routed to BigQuery with a log sink.
+type streamWriter struct {
+	w io.Writer
+}
+
+func newStdoutWriter() *streamWriter {
+	return &streamWriter{w: os.Stdout}
+}
+
+func (s *streamWriter) Write(ctx context.Context, events []*Event) error {
+	enc := json.NewEncoder(s.w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *streamWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package geo locates the client of a request, for monitoring where codes are
+// claimed from.
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnknownLocation is returned when the location of a request cannot be
+// determined.
+var ErrUnknownLocation = errors.New("unknown location")
+
+// ProviderType represents a type of geolocation provider.
+type ProviderType string
+
+const (
+	ProviderTypeNone   ProviderType = "NONE"
+	ProviderTypeHeader ProviderType = "HEADER"
+)
+
+// Config represents the configuration for geolocation.
+type Config struct {
+	ProviderType ProviderType `env:"GEO_PROVIDER, default=NONE"`
+
+	// Header is the request header which holds the client location when using
+	// the header provider. The value must start with the ISO 3166-1 alpha-2
+	// country code, optionally followed by a comma and a region. Google Cloud
+	// load balancers can set it with a custom header of
+	// "{client_region},{client_region_subdivision}".
+	Header string `env:"GEO_HEADER, default=X-Client-Geo-Location"`
+}
+
+// Location is the location of a client.
+type Location struct {
+	// Country is the upper case ISO 3166-1 alpha-2 country code.
+	Country string
+
+	// Region is the region within the country, if known.
+	Region string
+}
+
+// Provider locates the client of a request.
+type Provider interface {
+	// Locate returns the location of the request's client. It returns
+	// ErrUnknownLocation if the location cannot be determined.
+	Locate(r *http.Request) (*Location, error)
+}
+
+// ProviderFor returns the geolocation provider for the configuration.
+func ProviderFor(ctx context.Context, c *Config) (Provider, error) {
+	switch typ := c.ProviderType; typ {
+	case ProviderTypeNone, "":
+		return NewNoop(), nil
+	case ProviderTypeHeader:
+		if c.Header == "" {
+			return nil, fmt.Errorf("GEO_HEADER is required for the header geo provider")
+		}
+		return NewHeader(c.Header), nil
+	default:
+		return nil, fmt.Errorf("unknown geo provider type: %v", typ)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geo
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var _ Provider = (*Header)(nil)
+
+// countryRe matches an ISO 3166-1 alpha-2 country code.
+var countryRe = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// Header reads the client location from a request header set by a trusted
+// proxy, such as a load balancer. The header must be stripped from requests
+// before they reach the proxy, or clients can choose their own location.
+type Header struct {
+	name string
+}
+
+// NewHeader creates a new provider which reads the named header.
+func NewHeader(name string) Provider {
+	return &Header{name: name}
+}
+
+// Locate implements Provider.
+func (h *Header) Locate(r *http.Request) (*Location, error) {
+	parts := strings.SplitN(r.Header.Get(h.name), ",", 2)
+
+	country := strings.ToUpper(strings.TrimSpace(parts[0]))
+	// "ZZ" is the user-assigned code for an unknown country.
+	if !countryRe.MatchString(country) || country == "ZZ" {
+		return nil, ErrUnknownLocation
+	}
+
+	loc := &Location{Country: country}
+	if len(parts) > 1 {
+		loc.Region = strings.TrimSpace(parts[1])
+	}
+	return loc, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geo
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHeader_Locate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		value string
+		exp   *Location
+	}{
+		{
+			name:  "country_and_region",
+			value: "US,USCA",
+			exp:   &Location{Country: "US", Region: "USCA"},
+		},
+		{
+			name:  "country_only",
+			value: " de ",
+			exp:   &Location{Country: "DE"},
+		},
+		{
+			name: "missing",
+		},
+		{
+			name:  "unknown_country",
+			value: "ZZ,",
+		},
+		{
+			name:  "invalid_country",
+			value: "USA,CA",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := http.NewRequest("POST", "/api/verify", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.value != "" {
+				r.Header.Set("X-Client-Geo-Location", tc.value)
+			}
+
+			got, err := NewHeader("X-Client-Geo-Location").Locate(r)
+			if tc.exp == nil {
+				if !errors.Is(err, ErrUnknownLocation) {
+					t.Fatalf("expected %v, got %v", ErrUnknownLocation, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tc.exp, got); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the ErrorInfo details attached to errors.
+const errorDomain = "verification"
+
+// apiError is the shape of the error fields in every HTTP API response.
+type apiError struct {
+	Error     string `json:"error"`
+	ErrorCode string `json:"errorCode"`
+}
+
+// forwardedMetadata is the incoming metadata which is sent to the HTTP API as
+// headers. Everything else, including transport, encoding, and hop-by-hop
+// headers and anything identifying the client, is dropped.
+var forwardedMetadata = map[string]string{
+	"authorization": "Authorization",
+	"x-api-key":     "X-API-Key",
+	"x-request-id":  "X-Request-ID",
+}
+
+// forward sends the request as JSON to the HTTP API route at path and decodes
+// the response into out. The allowed incoming metadata is sent as headers, so
+// the API key is read from the "x-api-key" metadata. If the HTTP API returns an
+// error, out is still populated and the error is returned as a status.
+func (s *Server) forward(ctx context.Context, path string, in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to marshal request: %v", err)
+	}
+
+	r, err := http.NewRequestWithContext(controller.WithGRPC(ctx), http.MethodPost, path, bytes.NewReader(b))
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to build request: %v", err)
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for k, header := range forwardedMetadata {
+			for _, v := range md.Get(k) {
+				r.Header.Add(header, v)
+			}
+		}
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+
+	// gRPC is always served over TLS or behind a TLS-terminating proxy, and
+	// there is no HTTP to redirect from.
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	// The client address comes from the connection, never from metadata, so
+	// callers cannot spoof the IP used for rate limiting and allowlists. With no
+	// x-forwarded-for header, the HTTP API uses the remote address.
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	w := newResponseRecorder()
+	s.handler.ServeHTTP(w, r)
+
+	if err := json.Unmarshal(w.body.Bytes(), out); err != nil {
+		if w.code == http.StatusOK {
+			return status.Errorf(codes.Internal, "failed to unmarshal response: %v", err)
+		}
+		return status.Error(httpToCode(w.code), strings.TrimSpace(w.body.String()))
+	}
+
+	if w.code == http.StatusOK {
+		return nil
+	}
+
+	var apiErr apiError
+	if err := json.Unmarshal(w.body.Bytes(), &apiErr); err != nil || apiErr.Error == "" {
+		apiErr.Error = http.StatusText(w.code)
+	}
+
+	st := status.New(httpToCode(w.code), apiErr.Error)
+	if apiErr.ErrorCode != "" {
+		if withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+			Reason: apiErr.ErrorCode,
+			Domain: errorDomain,
+		}); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// httpToCode maps an HTTP API status code to a gRPC code.
+func httpToCode(code int) codes.Code {
+	switch code {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		return codes.Internal
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Unknown
+	}
+}
+
+// responseRecorder is a minimal http.ResponseWriter which captures the
+// response of the HTTP API.
+type responseRecorder struct {
+	header http.Header
+	body   *bytes.Buffer
+	code   int
+	wrote  bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+		body:   new(bytes.Buffer),
+		code:   http.StatusOK,
+	}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wrote {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.wrote {
+		return
+	}
+	r.code = code
+	r.wrote = true
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPToCode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		status int
+		code   codes.Code
+	}{
+		{status: http.StatusOK, code: codes.OK},
+		{status: http.StatusBadRequest, code: codes.InvalidArgument},
+		{status: http.StatusUnauthorized, code: codes.Unauthenticated},
+		{status: http.StatusForbidden, code: codes.PermissionDenied},
+		{status: http.StatusNotFound, code: codes.NotFound},
+		{status: http.StatusConflict, code: codes.AlreadyExists},
+		{status: http.StatusPreconditionFailed, code: codes.FailedPrecondition},
+		{status: http.StatusRequestEntityTooLarge, code: codes.ResourceExhausted},
+		{status: http.StatusTooManyRequests, code: codes.ResourceExhausted},
+		{status: http.StatusInternalServerError, code: codes.Internal},
+		{status: http.StatusServiceUnavailable, code: codes.Unavailable},
+		{status: http.StatusGatewayTimeout, code: codes.DeadlineExceeded},
+		{status: http.StatusTeapot, code: codes.Unknown},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			t.Parallel()
+
+			if got, want := httpToCode(tc.status), tc.code; got != want {
+				t.Errorf("expected %s to be %s", got, want)
+			}
+		})
+	}
+}
+
+func TestServer_forward(t *testing.T) {
+	t.Parallel()
+
+	type headers struct {
+		APIKey         string
+		Authorization  string
+		RequestID      string
+		AcceptEncoding string
+		Connection     string
+		ForwardedFor   string
+		RealIP         string
+		Forwarded      string
+		GoogleUser     string
+		RemoteAddr     string
+		ClientIP       string
+		ForwardedProto string
+	}
+
+	var got headers
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/test", func(w http.ResponseWriter, r *http.Request) {
+		got = headers{
+			APIKey:         r.Header.Get("X-API-Key"),
+			Authorization:  r.Header.Get("Authorization"),
+			RequestID:      r.Header.Get("X-Request-ID"),
+			AcceptEncoding: r.Header.Get("Accept-Encoding"),
+			Connection:     r.Header.Get("Connection"),
+			ForwardedFor:   r.Header.Get("X-Forwarded-For"),
+			RealIP:         r.Header.Get("X-Real-IP"),
+			Forwarded:      r.Header.Get("Forwarded"),
+			GoogleUser:     r.Header.Get("X-Goog-Authenticated-User-Email"),
+			RemoteAddr:     r.RemoteAddr,
+			ClientIP:       controller.ClientIP(r, 1),
+			ForwardedProto: r.Header.Get("X-Forwarded-Proto"),
+		}
+		w.WriteHeader(http.StatusGatewayTimeout)
+		json.NewEncoder(w).Encode(map[string]string{"error": "database timeout"})
+	})
+	s := NewAdminAPI(mux)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-api-key", "abc123",
+		"authorization", "Bearer token",
+		"x-request-id", "request-1",
+		"accept-encoding", "gzip",
+		"connection", "keep-alive",
+		"te", "trailers",
+		"x-forwarded-for", "203.0.113.99",
+		"x-real-ip", "203.0.113.99",
+		"forwarded", "for=203.0.113.99",
+		"x-goog-authenticated-user-email", "admin@example.com",
+	))
+	ctx = peer.NewContext(ctx, &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 4321},
+	})
+
+	var out map[string]string
+	err := s.forward(ctx, "/api/test", map[string]string{}, &out)
+	if got, want := status.Code(err), codes.DeadlineExceeded; got != want {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+
+	want := headers{
+		APIKey:         "abc123",
+		Authorization:  "Bearer token",
+		RequestID:      "request-1",
+		RemoteAddr:     "198.51.100.7:4321",
+		ClientIP:       "198.51.100.7",
+		ForwardedProto: "https",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package grpcapi serves the gRPC API. Each RPC is forwarded in-process to the
+// equivalent route of the HTTP API, so that RPCs go through the same
+// middleware and controllers as HTTP requests: API key authentication,
+// firewalls, rate limits, validation, and abuse prevention apply exactly as
+// they do over HTTP.
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-server/pkg/server"
+	"github.com/google/exposure-notifications-verification-server/internal/pb/verification"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ verification.VerificationServer = (*Server)(nil)
+
+// Server implements the Verification gRPC service.
+type Server struct {
+	handler http.Handler
+
+	issue  bool
+	verify bool
+}
+
+// NewAdminAPI creates a server for the adminapi service, which serves
+// IssueCode, BatchIssueCode, and CheckCodeStatus. The handler must be the
+// service's HTTP handler, with all of its middleware.
+func NewAdminAPI(handler http.Handler) *Server {
+	return &Server{handler: handler, issue: true}
+}
+
+// NewAPIServer creates a server for the apiserver service, which serves
+// VerifyCode. The handler must be the service's HTTP handler, with all of its
+// middleware.
+func NewAPIServer(handler http.Handler) *Server {
+	return &Server{handler: handler, verify: true}
+}
+
+// Serve serves the gRPC API on the given port in the background until the
+// context is done.
+func Serve(ctx context.Context, port string, s *Server) error {
+	logger := logging.FromContext(ctx).Named("grpcapi.Serve")
+
+	srv, err := server.New(port)
+	if err != nil {
+		return fmt.Errorf("failed to create grpc server: %w", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	verification.RegisterVerificationServer(grpcServer, s)
+
+	go func() {
+		logger.Infow("serving grpc", "port", port)
+		if err := srv.ServeGRPC(ctx, grpcServer); err != nil {
+			logger.Errorw("failed to serve grpc", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// IssueCode issues a verification code through POST /api/issue.
+func (s *Server) IssueCode(ctx context.Context, req *verification.IssueCodeRequest) (*verification.IssueCodeResponse, error) {
+	if !s.issue {
+		return nil, unimplemented("IssueCode")
+	}
+
+	var resp api.IssueCodeResponse
+	if err := s.forward(ctx, "/api/issue", toIssueCodeRequest(req), &resp); err != nil {
+		return nil, err
+	}
+	return fromIssueCodeResponse(&resp), nil
+}
+
+// BatchIssueCode issues many verification codes through POST
+// /api/batch-issue. If only some codes fail, the response is returned with
+// the errors set on the failed codes.
+func (s *Server) BatchIssueCode(ctx context.Context, req *verification.BatchIssueCodeRequest) (*verification.BatchIssueCodeResponse, error) {
+	if !s.issue {
+		return nil, unimplemented("BatchIssueCode")
+	}
+
+	request := &api.BatchIssueCodeRequest{
+		Codes: make([]*api.IssueCodeRequest, 0, len(req.Codes)),
+	}
+	for _, code := range req.Codes {
+		request.Codes = append(request.Codes, toIssueCodeRequest(code))
+	}
+
+	var resp api.BatchIssueCodeResponse
+	if err := s.forward(ctx, "/api/batch-issue", request, &resp); err != nil {
+		if len(req.Codes) == 0 || len(resp.Codes) != len(req.Codes) {
+			return nil, err
+		}
+	}
+
+	out := &verification.BatchIssueCodeResponse{
+		Codes: make([]*verification.IssueCodeResponse, 0, len(resp.Codes)),
+		Error: resp.Error,
+	}
+	for _, code := range resp.Codes {
+		out.Codes = append(out.Codes, fromIssueCodeResponse(code))
+	}
+	return out, nil
+}
+
+// CheckCodeStatus returns the status of a code through POST
+// /api/checkcodestatus.
+func (s *Server) CheckCodeStatus(ctx context.Context, req *verification.CheckCodeStatusRequest) (*verification.CheckCodeStatusResponse, error) {
+	if !s.issue {
+		return nil, unimplemented("CheckCodeStatus")
+	}
+
+	var resp api.CheckCodeStatusResponse
+	if err := s.forward(ctx, "/api/checkcodestatus", &api.CheckCodeStatusRequest{UUID: req.Uuid}, &resp); err != nil {
+		return nil, err
+	}
+	return &verification.CheckCodeStatusResponse{
+		Claimed:                resp.Claimed,
+		ExpiresAtTimestamp:     resp.ExpiresAtTimestamp,
+		LongExpiresAtTimestamp: resp.LongExpiresAtTimestamp,
+		Metadata:               resp.Metadata,
+	}, nil
+}
+
+// VerifyCode exchanges a verification code for a token through POST
+// /api/verify.
+func (s *Server) VerifyCode(ctx context.Context, req *verification.VerifyCodeRequest) (*verification.VerifyCodeResponse, error) {
+	if !s.verify {
+		return nil, unimplemented("VerifyCode")
+	}
+
+	request := &api.VerifyCodeRequest{
+		VerificationCode:  req.Code,
+		AcceptTestTypes:   req.Accept,
+		DeviceFingerprint: req.DeviceFingerprint,
+		AppID:             req.AppId,
+	}
+
+	var resp api.VerifyCodeResponse
+	if err := s.forward(ctx, "/api/verify", request, &resp); err != nil {
+		return nil, err
+	}
+	return &verification.VerifyCodeResponse{
+		TestType:    resp.TestType,
+		SymptomDate: resp.SymptomDate,
+		TestDate:    resp.TestDate,
+		Token:       resp.VerificationToken,
+		RedirectURL: resp.RedirectURL,
+	}, nil
+}
+
+// unimplemented returns the error for an RPC which is not served by this
+// service.
+func unimplemented(method string) error {
+	return status.Errorf(codes.Unimplemented, "%s is not served by this service", method)
+}
+
+func toIssueCodeRequest(req *verification.IssueCodeRequest) *api.IssueCodeRequest {
+	return &api.IssueCodeRequest{
+		SymptomDate:          req.SymptomDate,
+		TestDate:             req.TestDate,
+		TestType:             req.TestType,
+		TZOffset:             req.TzOffset,
+		Phone:                req.Phone,
+		SMSLocale:            req.SmsLocale,
+		Email:                req.Email,
+		EmailLocale:          req.EmailLocale,
+		UUID:                 req.Uuid,
+		ExternalIssuerID:     req.ExternalIssuerID,
+		CohortID:             req.CohortID,
+		Metadata:             req.Metadata,
+		SupervisingUserEmail: req.SupervisingUserEmail,
+		MaxClaims:            uint(req.MaxClaims),
+	}
+}
+
+func fromIssueCodeResponse(resp *api.IssueCodeResponse) *verification.IssueCodeResponse {
+	out := &verification.IssueCodeResponse{
+		Uuid:                    resp.UUID,
+		Code:                    resp.VerificationCode,
+		ExpiresAt:               resp.ExpiresAt,
+		ExpiresAtTimestamp:      resp.ExpiresAtTimestamp,
+		LongExpiresAt:           resp.LongExpiresAt,
+		LongExpiresAtTimestamp:  resp.LongExpiresAtTimestamp,
+		PendingApproval:         resp.PendingApproval,
+		ClaimToken:              resp.ClaimToken,
+		ClaimLink:               resp.ClaimLink,
+		ClaimExpiresAtTimestamp: resp.ClaimExpiresAtTimestamp,
+		SmsDeliveryState:        resp.SMSDeliveryState,
+		EmailDeliveryState:      resp.EmailDeliveryState,
+		QuotaResetsAtTimestamp:  resp.QuotaResetsAtTimestamp,
+		Error:                   resp.Error,
+		ErrorCode:               resp.ErrorCode,
+	}
+	if resp.CodesRemaining != nil {
+		out.CodesRemaining = *resp.CodesRemaining
+	}
+	return out
+}
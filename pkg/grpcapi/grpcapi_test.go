@@ -0,0 +1,264 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/internal/pb/verification"
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testClient serves s over an in-memory connection and returns a client.
+func testClient(t *testing.T, s *Server) verification.VerificationClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	verification.RegisterVerificationServer(grpcServer, s)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return verification.NewVerificationClient(conn)
+}
+
+func TestServer_IssueCode(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/issue", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if got, want := r.Header.Get("X-API-Key"), "abc123"; got != want {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(api.Errorf("invalid API key"))
+			return
+		}
+
+		var req api.IssueCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if req.TestType != "confirmed" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(api.Errorf("unsupported test type").WithCode(api.ErrUnsupportedTestType))
+			return
+		}
+		json.NewEncoder(w).Encode(&api.IssueCodeResponse{
+			UUID:             "uuid",
+			VerificationCode: "12345678",
+		})
+	})
+
+	client := testClient(t, NewAdminAPI(mux))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", "abc123")
+
+	t.Run("success", func(t *testing.T) {
+		resp, err := client.IssueCode(ctx, &verification.IssueCodeRequest{TestType: "confirmed"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := resp.Code, "12345678"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+		if got, want := resp.Uuid, "uuid"; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := client.IssueCode(context.Background(), &verification.IssueCodeRequest{TestType: "confirmed"})
+		if got, want := status.Code(err), codes.Unauthenticated; got != want {
+			t.Errorf("expected %s to be %s", got, want)
+		}
+	})
+
+	t.Run("invalid_argument", func(t *testing.T) {
+		_, err := client.IssueCode(ctx, &verification.IssueCodeRequest{TestType: "likely"})
+		st := status.Convert(err)
+		if got, want := st.Code(), codes.InvalidArgument; got != want {
+			t.Errorf("expected %s to be %s", got, want)
+		}
+
+		var reason string
+		for _, d := range st.Details() {
+			if info, ok := d.(*errdetails.ErrorInfo); ok {
+				reason = info.Reason
+			}
+		}
+		if got, want := reason, api.ErrUnsupportedTestType; got != want {
+			t.Errorf("expected %q to be %q", got, want)
+		}
+	})
+
+	t.Run("unimplemented", func(t *testing.T) {
+		_, err := client.VerifyCode(ctx, &verification.VerifyCodeRequest{Code: "12345678"})
+		if got, want := status.Code(err), codes.Unimplemented; got != want {
+			t.Errorf("expected %s to be %s", got, want)
+		}
+	})
+}
+
+func TestServer_IssueCode_Request(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		req  *verification.IssueCodeRequest
+		exp  *api.IssueCodeRequest
+		resp *api.IssueCodeResponse
+	}{
+		{
+			name: "default",
+			req:  &verification.IssueCodeRequest{TestType: "confirmed"},
+			exp:  &api.IssueCodeRequest{TestType: "confirmed"},
+		},
+		{
+			name: "max_claims",
+			req:  &verification.IssueCodeRequest{TestType: "confirmed", MaxClaims: 4},
+			exp:  &api.IssueCodeRequest{TestType: "confirmed", MaxClaims: 4},
+		},
+		{
+			name: "email",
+			req:  &verification.IssueCodeRequest{TestType: "confirmed", Email: "user@example.com", EmailLocale: "es"},
+			exp:  &api.IssueCodeRequest{TestType: "confirmed", Email: "user@example.com", EmailLocale: "es"},
+			resp: &api.IssueCodeResponse{UUID: "uuid", EmailDeliveryState: api.EmailDeliverySent},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got api.IssueCodeRequest
+			mux := http.NewServeMux()
+			mux.HandleFunc("/api/issue", func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("failed to decode request: %v", err)
+				}
+				resp := tc.resp
+				if resp == nil {
+					resp = &api.IssueCodeResponse{UUID: "uuid"}
+				}
+				json.NewEncoder(w).Encode(resp)
+			})
+
+			client := testClient(t, NewAdminAPI(mux))
+			resp, err := client.IssueCode(context.Background(), tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.exp, &got, cmpopts.IgnoreFields(api.IssueCodeRequest{}, "Padding")); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+			if tc.resp != nil {
+				if got, want := resp.EmailDeliveryState, tc.resp.EmailDeliveryState; got != want {
+					t.Errorf("expected %q to be %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_VerifyCode(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/verify", func(w http.ResponseWriter, r *http.Request) {
+		if !controller.GRPCFromContext(r.Context()) {
+			t.Errorf("expected request to be marked as grpc")
+		}
+
+		var req api.VerifyCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		json.NewEncoder(w).Encode(&api.VerifyCodeResponse{
+			TestType:          "confirmed",
+			VerificationToken: "token:" + req.VerificationCode,
+		})
+	})
+
+	client := testClient(t, NewAPIServer(mux))
+
+	resp, err := client.VerifyCode(context.Background(), &verification.VerifyCodeRequest{Code: "12345678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resp.Token, "token:12345678"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if _, err := client.IssueCode(context.Background(), &verification.IssueCodeRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected unimplemented, got %v", err)
+	}
+}
+
+func TestServer_BatchIssueCode_PartialFailure(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/batch-issue", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&api.BatchIssueCodeResponse{
+			Codes: []*api.IssueCodeResponse{
+				{VerificationCode: "12345678"},
+				{Error: "unsupported test type", ErrorCode: api.ErrUnsupportedTestType},
+			},
+			Error: "unsupported test type",
+		})
+	})
+
+	client := testClient(t, NewAdminAPI(mux))
+
+	resp, err := client.BatchIssueCode(context.Background(), &verification.BatchIssueCodeRequest{
+		Codes: []*verification.IssueCodeRequest{{TestType: "confirmed"}, {TestType: "nope"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(resp.Codes), 2; got != want {
+		t.Fatalf("expected %d to be %d", got, want)
+	}
+	if got, want := resp.Codes[1].ErrorCode, api.ErrUnsupportedTestType; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
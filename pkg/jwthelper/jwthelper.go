@@ -19,9 +19,11 @@ package jwthelper
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/asn1"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"strings"
@@ -40,6 +42,69 @@ func SignJWT(token *jwt.Token, signer crypto.Signer) (string, error) {
 		return "", err
 	}
 
+	sig, err := signES256(signingString, signer)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{signingString, sig}, "."), nil
+}
+
+// SignDetached signs the payload with the provided signer and returns a JWS
+// with a detached payload (RFC 7515, Appendix F). The result has the form
+// "header..signature", and the header includes the given key ID. The payload
+// must be supplied separately to verify it.
+func SignDetached(payload []byte, keyID string, signer crypto.Signer) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": jwt.SigningMethodES256.Alg(),
+		"kid": keyID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode header: %w", err)
+	}
+
+	encodedHeader := jwt.EncodeSegment(header)
+	signingString := encodedHeader + "." + jwt.EncodeSegment(payload)
+	sig, err := signES256(signingString, signer)
+	if err != nil {
+		return "", err
+	}
+	return encodedHeader + ".." + sig, nil
+}
+
+// VerifyDetached verifies a JWS with a detached payload, as returned by
+// SignDetached, against the payload and public key. It returns the key ID from
+// the header.
+func VerifyDetached(jws string, payload []byte, publicKey *ecdsa.PublicKey) (string, error) {
+	parts := strings.Split(jws, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return "", fmt.Errorf("signature is not a detached JWS")
+	}
+
+	b, err := jwt.DecodeSegment(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return "", fmt.Errorf("failed to parse header: %w", err)
+	}
+	if header.Alg != jwt.SigningMethodES256.Alg() {
+		return "", fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	signingString := parts[0] + "." + jwt.EncodeSegment(payload)
+	if err := jwt.SigningMethodES256.Verify(signingString, parts[2], publicKey); err != nil {
+		return "", fmt.Errorf("invalid signature: %w", err)
+	}
+	return header.Kid, nil
+}
+
+// signES256 signs the signing string with the provided signer and returns the
+// base64 encoded ES256 signature.
+func signES256(signingString string, signer crypto.Signer) (string, error) {
 	digest := sha256.Sum256([]byte(signingString))
 	sig, err := signer.Sign(rand.Reader, digest[:], nil)
 	if err != nil {
@@ -85,5 +150,5 @@ func SignJWT(token *jwt.Token, signer crypto.Signer) (string, error) {
 	//	 	concatenation as their output.)
 	sig = append(rBytesPadded, sBytesPadded...)
 
-	return strings.Join([]string{signingString, jwt.EncodeSegment(sig)}, "."), nil
+	return jwt.EncodeSegment(sig), nil
 }
@@ -0,0 +1,82 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwthelper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestSignJWT(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, &jwt.StandardClaims{Subject: "test"})
+	signed, err := SignJWT(token, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	}); err != nil {
+		t.Errorf("failed to verify token: %v", err)
+	}
+}
+
+func TestSignDetached(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"certificate":"abc"}`)
+	jws, err := SignDetached(payload, "r1v2", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid, err := VerifyDetached(jws, payload, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := kid, "r1v2"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	if _, err := VerifyDetached(jws, []byte(`{"certificate":"xyz"}`), &key.PublicKey); err == nil {
+		t.Errorf("expected modified payload to fail")
+	}
+	if _, err := VerifyDetached(jws, payload, &other.PublicKey); err == nil {
+		t.Errorf("expected other key to fail")
+	}
+	if _, err := VerifyDetached("not.a.jws", payload, &key.PublicKey); err == nil {
+		t.Errorf("expected attached JWS to fail")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"contrib.go.opencensus.io/exporter/prometheus"
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-server/pkg/server"
+	"go.opencensus.io/stats/view"
+)
+
+// ServeMetrics serves the recorded metrics in the Prometheus text format at
+// /metrics on the given port, in the background, until the context is done.
+// This is independent of the configured exporter.
+func ServeMetrics(ctx context.Context, port string) error {
+	logger := logging.FromContext(ctx).Named("observability.ServeMetrics")
+
+	// Views are normally registered when the exporter starts, but not all
+	// exporters register them. Registering the same views again is a no-op.
+	if err := view.Register(enobservability.AllViews()...); err != nil {
+		return fmt.Errorf("failed to register views: %w", err)
+	}
+
+	exporter, err := prometheus.NewExporter(prometheus.Options{
+		OnError: func(err error) {
+			logger.Errorw("failed to export metrics", "error", err)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create prometheus exporter: %w", err)
+	}
+
+	srv, err := server.New(port)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics server: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+
+	go func() {
+		logger.Infow("serving metrics", "port", port)
+		if err := srv.ServeHTTPHandler(ctx, mux); err != nil {
+			logger.Errorw("failed to serve metrics", "error", err)
+		}
+	}()
+	return nil
+}
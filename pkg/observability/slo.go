@@ -0,0 +1,49 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// SLOLatencyDistribution is the latency distribution, in milliseconds, for
+// service level indicator views. The bucket boundaries are at common latency
+// objectives, so the share of requests under an objective can be read
+// directly from the histogram.
+var SLOLatencyDistribution = view.Distribution(25, 50, 100, 250, 500, 1000, 2500, 5000, 10000)
+
+// SLOTagKeys returns the tag keys for service level indicator views. These are
+// deliberately few and bounded, the realm and who to blame for a failure, so
+// that the number of time series stays small enough for alerting. Never add
+// tags with values from requests, such as codes or external IDs.
+func SLOTagKeys() []tag.Key {
+	return []tag.Key{RealmTagKey, blameTagKey}
+}
+
+// SLOView returns the service level indicator view for an operation, the
+// latency distribution of requests by realm and blame. Its count is the total
+// number of requests. Requests blamed on the server or an external system
+// count against the error budget.
+func SLOView(prefix string, m *stats.Float64Measure, description string) *view.View {
+	return &view.View{
+		Name:        prefix + "/slo_request_latency",
+		Measure:     m,
+		Description: description,
+		TagKeys:     SLOTagKeys(),
+		Aggregation: SLOLatencyDistribution,
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestSLOView(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		blame   tag.Mutator
+		latency float64
+		bucket  int
+	}{
+		{name: "fast", blame: BlameNone, latency: 10, bucket: 0},
+		{name: "objective", blame: BlameNone, latency: 100, bucket: 3},
+		{name: "slow", blame: BlameServer, latency: 3000, bucket: 7},
+		{name: "timeout", blame: BlameServer, latency: 60000, bucket: 9},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := stats.Float64("test/slo_"+tc.name+"/latency", "latency", stats.UnitMilliseconds)
+			v := SLOView("test/slo_"+tc.name, m, "test latency")
+
+			if got, want := v.Name, "test/slo_"+tc.name+"/slo_request_latency"; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			// Only bounded tags keep the number of time series small.
+			var keys []string
+			for _, k := range v.TagKeys {
+				keys = append(keys, k.Name())
+			}
+			if diff := cmp.Diff([]string{"realm", "blame"}, keys); diff != "" {
+				t.Errorf("mismatch (-want, +got):\n%s", diff)
+			}
+
+			if err := view.Register(v); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { view.Unregister(v) })
+
+			ctx, err := tag.New(WithRealmID(context.Background(), 7), tc.blame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stats.Record(ctx, m.M(tc.latency))
+
+			rows, err := view.RetrieveData(v.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(rows), 1; got != want {
+				t.Fatalf("expected %d rows to be %d", got, want)
+			}
+
+			var realm string
+			for _, tg := range rows[0].Tags {
+				if tg.Key == RealmTagKey {
+					realm = tg.Value
+				}
+			}
+			if got, want := realm, "7"; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			dist, ok := rows[0].Data.(*view.DistributionData)
+			if !ok {
+				t.Fatalf("expected distribution, got %T", rows[0].Data)
+			}
+			if got, want := dist.Count, int64(1); got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got, want := dist.CountPerBucket[tc.bucket], int64(1); got != want {
+				t.Errorf("expected bucket %d to have %d, got %d (%v)", tc.bucket, want, got, dist.CountPerBucket)
+			}
+		})
+	}
+}
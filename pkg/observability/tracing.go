@@ -0,0 +1,68 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"fmt"
+
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
+	"go.opencensus.io/trace"
+)
+
+// SampleRate returns the trace sampling probability of the exporter. Exporters
+// which do not export traces have a rate of 0.
+func SampleRate(c *enobservability.Config) float64 {
+	switch c.ExporterType {
+	case enobservability.ExporterStackdriver:
+		if c.Stackdriver != nil {
+			return c.Stackdriver.SampleRate
+		}
+	case enobservability.ExporterOCAgent:
+		if c.OpenCensus != nil {
+			return c.OpenCensus.SampleRate
+		}
+	}
+	return 0
+}
+
+// Sampler returns a trace sampler which samples root spans with the given
+// probability, and otherwise keeps the decision of the span's parent. Unlike
+// the exporter's default sampler, this also applies to spans with a remote
+// parent, so a trace is either recorded completely or not at all.
+func Sampler(rate float64) trace.Sampler {
+	probability := trace.ProbabilitySampler(rate)
+	return func(p trace.SamplingParameters) trace.SamplingDecision {
+		if p.ParentContext != (trace.SpanContext{}) {
+			return trace.SamplingDecision{Sample: p.ParentContext.IsSampled()}
+		}
+		return probability(p)
+	}
+}
+
+// ConfigureTracing replaces the exporter's trace sampler with Sampler, which
+// applies to all spans including those started by this server. It must be
+// called after the exporter is started, and returns the effective sampling
+// rate.
+func ConfigureTracing(c *enobservability.Config) (float64, error) {
+	rate := SampleRate(c)
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("TRACE_PROBABILITY must be between 0 and 1, got %v", rate)
+	}
+
+	trace.ApplyConfig(trace.Config{
+		DefaultSampler: Sampler(rate),
+	})
+	return rate, nil
+}
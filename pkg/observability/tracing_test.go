@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package observability
+
+import (
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestSampler(t *testing.T) {
+	t.Parallel()
+
+	sampled := trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceOptions: 1}
+	unsampled := trace.SpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}}
+
+	cases := []struct {
+		name   string
+		rate   float64
+		params trace.SamplingParameters
+		exp    bool
+	}{
+		{
+			name: "root_always",
+			rate: 1,
+			exp:  true,
+		},
+		{
+			name: "root_never",
+			rate: 0,
+			exp:  false,
+		},
+		{
+			name:   "sampled_parent",
+			rate:   0,
+			params: trace.SamplingParameters{ParentContext: sampled},
+			exp:    true,
+		},
+		{
+			name:   "unsampled_parent",
+			rate:   1,
+			params: trace.SamplingParameters{ParentContext: unsampled},
+			exp:    false,
+		},
+		{
+			name:   "unsampled_remote_parent",
+			rate:   1,
+			params: trace.SamplingParameters{ParentContext: unsampled, HasRemoteParent: true},
+			exp:    false,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := Sampler(tc.rate)(tc.params).Sample; got != tc.exp {
+				t.Errorf("expected %t to be %t", got, tc.exp)
+			}
+		})
+	}
+}
@@ -38,7 +38,7 @@ const (
 func GenerateCode(length uint) (string, error) {
 	limit := big.NewInt(0)
 	limit.Exp(big.NewInt(10), big.NewInt(int64(length)), nil)
-	digits, err := rand.Int(rand.Reader, limit)
+	digits, err := rand.Int(entropyReader, limit)
 	if err != nil {
 		return "", err
 	}
@@ -67,7 +67,7 @@ func GenerateAlphanumericCode(length uint) (string, error) {
 }
 
 func randomFromCharset() (string, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+	n, err := rand.Int(entropyReader, big.NewInt(int64(len(charset))))
 	if err != nil {
 		return "", err
 	}
@@ -88,10 +88,32 @@ type Request struct {
 	MaxSymptomAge  time.Duration
 	UUID           string
 
+	// ApprovalExpiresAt, if set, issues the code pending approval. The code
+	// cannot be claimed until it is approved, which must happen before this
+	// time.
+	ApprovalExpiresAt *time.Time
+
 	// Issuing includes information about the issuer.
 	IssuingUser       *database.User
 	IssuingApp        *database.AuthorizedApp
 	IssuingExternalID string
+
+	// SupervisingUser is an optional second user who supervised the issuance.
+	SupervisingUser *database.User
+
+	// CohortID optionally tags the code as part of an exposure event.
+	CohortID string
+
+	// Metadata optionally tags the code with non-PII key-value pairs.
+	Metadata database.CodeMetadata
+
+	// MaxClaims is the number of times the code may be claimed. It defaults to
+	// 1.
+	MaxClaims uint
+
+	// CaseInsensitive stores the codes in normalized form so they can be
+	// verified regardless of case. The returned codes keep their generated case.
+	CaseInsensitive bool
 }
 
 // Issue will generate a verification code and save it to the database, based on
@@ -121,6 +143,10 @@ func (o *Request) Issue(ctx context.Context, retryCount uint) (string, string, s
 		if o.IssuingUser != nil {
 			issuingUserID = o.IssuingUser.ID
 		}
+		supervisingUserID := uint(0)
+		if o.SupervisingUser != nil {
+			supervisingUserID = o.SupervisingUser.ID
+		}
 		issuingAppID := uint(0)
 		if o.IssuingApp != nil {
 			issuingAppID = o.IssuingApp.ID
@@ -136,12 +162,27 @@ func (o *Request) Issue(ctx context.Context, retryCount uint) (string, string, s
 			ExpiresAt:         o.ShortExpiresAt,
 			LongExpiresAt:     o.LongExpiresAt,
 			IssuingUserID:     issuingUserID,
+			SupervisingUserID: supervisingUserID,
 			IssuingAppID:      issuingAppID,
 			IssuingExternalID: o.IssuingExternalID,
+			CohortID:          o.CohortID,
+			Metadata:          o.Metadata,
 			UUID:              o.UUID,
+			MaxClaims:         o.MaxClaims,
+		}
+		if o.CaseInsensitive {
+			verificationCode.Code = database.NormalizeCode(code)
+			verificationCode.LongCode = database.NormalizeCode(longCode)
+		}
+		if o.ApprovalExpiresAt != nil {
+			verificationCode.ApprovalStatus = database.ApprovalStatusPending
+			verificationCode.ApprovalExpiresAt = o.ApprovalExpiresAt
 		}
 		// If a verification code already exists, it will fail to save, and we retry.
-		if err = o.DB.SaveVerificationCode(&verificationCode, o.MaxSymptomAge); err != nil {
+		if err = o.DB.SaveVerificationCode(ctx, &verificationCode, o.MaxSymptomAge); err != nil {
+			if database.IsQueryTimeout(err) {
+				break // not retryable, the request is already too slow
+			}
 			logger.Warnf("duplicate OTP found: %v", err)
 			if strings.Contains(err.Error(), database.VercodeUUIDUniqueIndex) {
 				break // not retryable
@@ -15,7 +15,12 @@
 package otp
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,6 +57,90 @@ func TestGenerateCode(t *testing.T) {
 	}
 }
 
+// TestSelfTest cannot be parallel because it replaces the package entropy
+// source.
+func TestSelfTest(t *testing.T) {
+	origReader, origPath := entropyReader, fipsEnabledPath
+	t.Cleanup(func() {
+		entropyReader, fipsEnabledPath = origReader, origPath
+	})
+
+	dir := t.TempDir()
+	fipsOn := filepath.Join(dir, "fips_on")
+	if err := ioutil.WriteFile(fipsOn, []byte("1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fipsOff := filepath.Join(dir, "fips_off")
+	if err := ioutil.WriteFile(fipsOff, []byte("0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		reader      io.Reader
+		fipsPath    string
+		requireFIPS bool
+		err         string
+	}{
+		{
+			name:   "crypto_rand",
+			reader: origReader,
+		},
+		{
+			name:   "failing",
+			reader: strings.NewReader(""),
+			err:    "failed to read from entropy source",
+		},
+		{
+			name:   "all_zero",
+			reader: bytes.NewReader(make([]byte, 1024)),
+			err:    "all zero bytes",
+		},
+		{
+			name:   "repeated",
+			reader: bytes.NewReader(bytes.Repeat([]byte{0x01}, 1024)),
+			err:    "repeated output",
+		},
+		{
+			name:        "fips_enabled",
+			reader:      origReader,
+			fipsPath:    fipsOn,
+			requireFIPS: true,
+		},
+		{
+			name:        "fips_disabled",
+			reader:      origReader,
+			fipsPath:    fipsOff,
+			requireFIPS: true,
+			err:         "not in FIPS mode",
+		},
+		{
+			name:        "fips_unknown",
+			reader:      origReader,
+			fipsPath:    filepath.Join(dir, "missing"),
+			requireFIPS: true,
+			err:         "could not be determined",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			entropyReader, fipsEnabledPath = tc.reader, tc.fipsPath
+
+			err := SelfTest(tc.requireFIPS)
+			if tc.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
 func TestGenerateAlphanumericCode(t *testing.T) {
 	t.Parallel()
 
@@ -74,6 +163,16 @@ func TestGenerateAlphanumericCode(t *testing.T) {
 	}
 }
 
+func TestCharsetNormalized(t *testing.T) {
+	t.Parallel()
+
+	// Case-insensitive matching lowercases codes, which is only collision free
+	// if generated codes never contain uppercase letters.
+	if got := database.NormalizeCode(charset); got != charset {
+		t.Errorf("expected charset %q to be normalized, got %q", charset, got)
+	}
+}
+
 func TestIssue(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,91 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// entropyReader is the source of randomness for all generated codes. It is
+// always crypto/rand, which reads from the operating system's CSPRNG. It is a
+// variable only so tests can simulate a failing source.
+var entropyReader io.Reader = rand.Reader
+
+// fipsEnabledPath is the kernel flag that indicates the host is running in
+// FIPS mode. When set, the kernel CSPRNG backing crypto/rand is the validated
+// DRBG.
+var fipsEnabledPath = "/proc/sys/crypto/fips_enabled"
+
+// selfTestBlockSize is the number of bytes compared in the continuous random
+// number generator test.
+const selfTestBlockSize = 32
+
+// SelfTest verifies that the entropy source used for code generation can be
+// initialized and is producing output. It performs a continuous random number
+// generator test (consecutive blocks must differ and must not be all zero) and
+// generates a short and long code.
+//
+// If requireFIPS is true, it additionally asserts that the host kernel is in
+// FIPS mode.
+//
+// Servers that issue codes should call this at startup and refuse to start if
+// it returns an error.
+func SelfTest(requireFIPS bool) error {
+	if requireFIPS {
+		if err := checkFIPSEnabled(); err != nil {
+			return err
+		}
+	}
+
+	first := make([]byte, selfTestBlockSize)
+	if _, err := io.ReadFull(entropyReader, first); err != nil {
+		return fmt.Errorf("failed to read from entropy source: %w", err)
+	}
+	second := make([]byte, selfTestBlockSize)
+	if _, err := io.ReadFull(entropyReader, second); err != nil {
+		return fmt.Errorf("failed to read from entropy source: %w", err)
+	}
+
+	if bytes.Equal(first, make([]byte, selfTestBlockSize)) {
+		return fmt.Errorf("entropy source returned all zero bytes")
+	}
+	if bytes.Equal(first, second) {
+		return fmt.Errorf("entropy source returned repeated output")
+	}
+
+	if _, err := GenerateCode(8); err != nil {
+		return fmt.Errorf("failed to generate short code: %w", err)
+	}
+	if _, err := GenerateAlphanumericCode(16); err != nil {
+		return fmt.Errorf("failed to generate long code: %w", err)
+	}
+	return nil
+}
+
+func checkFIPSEnabled() error {
+	b, err := ioutil.ReadFile(fipsEnabledPath)
+	if err != nil {
+		return fmt.Errorf("FIPS randomness is required, but FIPS mode could not be determined: %w", err)
+	}
+	if strings.TrimSpace(string(b)) != "1" {
+		return fmt.Errorf("FIPS randomness is required, but the host is not in FIPS mode")
+	}
+	return nil
+}
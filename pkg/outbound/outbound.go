@@ -0,0 +1,232 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbound validates endpoints that realm administrators configure
+// and the server later connects to, such as SMTP relays and webhook URLs.
+// Endpoints must use TLS and must not point at private or internal addresses,
+// so that realm settings cannot be used to reach services inside the
+// deployment. The HTTP client it provides enforces the same rules when it
+// connects.
+package outbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrInsecureScheme is returned when a URL does not use HTTPS.
+	ErrInsecureScheme = errors.New("must use https")
+
+	// ErrPrivateAddress is returned when a host is, or resolves to, a loopback,
+	// private, link-local, or otherwise internal address.
+	ErrPrivateAddress = errors.New("must not be a private or internal address")
+)
+
+// lookupIPAddr is the resolver, overridden in tests.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// ValidateURL checks that raw is an absolute https URL whose host passes
+// ValidateHost. If allowLocalhost is true, plain http is accepted for loopback
+// hosts, which is intended for development only.
+func ValidateURL(ctx context.Context, raw string, allowLocalhost bool) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid url: missing host")
+	}
+	if u.User != nil {
+		return fmt.Errorf("invalid url: must not contain credentials")
+	}
+
+	host := u.Hostname()
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+	case "http":
+		if !allowLocalhost || !isLocalhost(ctx, host) {
+			return ErrInsecureScheme
+		}
+	default:
+		return ErrInsecureScheme
+	}
+
+	return ValidateHost(ctx, host, allowLocalhost)
+}
+
+// ValidateHost checks that host is not an internal name and that it does not
+// resolve to an internal address. If allowLocalhost is true, loopback hosts are
+// permitted, which is intended for development only.
+func ValidateHost(ctx context.Context, host string, allowLocalhost bool) error {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" {
+		return fmt.Errorf("host is required")
+	}
+
+	if allowLocalhost && isLocalhost(ctx, host) {
+		return nil
+	}
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".internal") || strings.HasSuffix(host, ".local") {
+		return ErrPrivateAddress
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return CheckIP(ip)
+	}
+
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("failed to resolve %s: no addresses", host)
+	}
+	for _, addr := range addrs {
+		if err := CheckIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckIP returns ErrPrivateAddress if ip is not a public unicast address.
+func CheckIP(ip net.IP) error {
+	if ip.IsLoopback() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() {
+		return ErrPrivateAddress
+	}
+	for _, n := range reservedNetworks {
+		if n.Contains(ip) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// DialControl returns a net.Dialer Control function which refuses connections
+// to addresses rejected by CheckIP. It runs after DNS resolution, so a host
+// which resolved to a public address when it was validated cannot later be
+// pointed at an internal one. If allowLocalhost is true, loopback addresses are
+// permitted, which is intended for development only.
+func DialControl(allowLocalhost bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %w", address, err)
+		}
+
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", address)
+		}
+		if allowLocalhost && ip.IsLoopback() {
+			return nil
+		}
+		if err := CheckIP(ip); err != nil {
+			return fmt.Errorf("refusing to connect to %s: %w", host, err)
+		}
+		return nil
+	}
+}
+
+// NewHTTPClient returns an HTTP client for realm-configured URLs. It only
+// connects to addresses permitted by DialControl, ignores proxy environment
+// variables, and does not follow redirects, since a redirect could point
+// anywhere. The redirect response is returned to the caller instead.
+func NewHTTPClient(timeout time.Duration, allowLocalhost bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   DialControl(allowLocalhost),
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// reservedNetworks are ranges which are not covered by the net.IP helpers but
+// must not be reachable from realm-configured endpoints.
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",          // "this" network
+	"10.0.0.0/8",         // RFC 1918
+	"100.64.0.0/10",      // carrier-grade NAT
+	"172.16.0.0/12",      // RFC 1918
+	"192.0.0.0/24",       // IETF protocol assignments
+	"192.168.0.0/16",     // RFC 1918
+	"198.18.0.0/15",      // benchmarking
+	"240.0.0.0/4",        // reserved
+	"255.255.255.255/32", // broadcast
+	"fc00::/7",           // unique local
+	"64:ff9b::/96",       // NAT64, can embed internal IPv4 addresses
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("invalid cidr %q: %v", cidr, err))
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// isLocalhost returns true if host is "localhost" or every address it resolves
+// to is a loopback address.
+func isLocalhost(ctx context.Context, host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return false
+	}
+	for _, addr := range addrs {
+		if !addr.IP.IsLoopback() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,187 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pdf is a minimal PDF writer for generating printable documents. It
+// supports text in the standard Type 1 fonts and filled or stroked
+// rectangles, which is enough to lay out code sheets without embedding fonts
+// or images.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Page sizes in points.
+const (
+	LetterWidth  = 612
+	LetterHeight = 792
+)
+
+// Font is one of the standard fonts every PDF reader provides.
+type Font string
+
+const (
+	Helvetica     Font = "Helvetica"
+	HelveticaBold Font = "Helvetica-Bold"
+	Courier       Font = "Courier"
+	CourierBold   Font = "Courier-Bold"
+)
+
+var fonts = []Font{Helvetica, HelveticaBold, Courier, CourierBold}
+
+// fontResource returns the resource name of the font in each page.
+func fontResource(f Font) string {
+	for i, v := range fonts {
+		if v == f {
+			return "F" + strconv.Itoa(i+1)
+		}
+	}
+	return "F1"
+}
+
+// Document is a PDF document. The zero value is not usable; use New.
+type Document struct {
+	width, height float64
+	pages         []*Page
+}
+
+// New creates a document whose pages are the given size in points.
+func New(width, height float64) *Document {
+	return &Document{width: width, height: height}
+}
+
+// AddPage appends a new, empty page to the document.
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Page is a single page. Coordinates are in points with the origin at the
+// bottom left.
+type Page struct {
+	content bytes.Buffer
+}
+
+// Text draws the string with its baseline starting at x, y. Characters outside
+// of printable ASCII are replaced with "?".
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		fontResource(font), num(size), num(x), num(y), escape(s))
+}
+
+// FillRect draws a filled black rectangle.
+func (p *Page) FillRect(x, y, w, h float64) {
+	fmt.Fprintf(&p.content, "%s %s %s %s re f\n", num(x), num(y), num(w), num(h))
+}
+
+// StrokeRect draws the outline of a rectangle. If dash is greater than zero,
+// the line is dashed with segments of that length.
+func (p *Page) StrokeRect(x, y, w, h, dash float64) {
+	if dash > 0 {
+		fmt.Fprintf(&p.content, "q [%s %s] 0 d 0.5 w %s %s %s %s re S Q\n",
+			num(dash), num(dash), num(x), num(y), num(w), num(h))
+		return
+	}
+	fmt.Fprintf(&p.content, "q 0.5 w %s %s %s %s re S Q\n", num(x), num(y), num(w), num(h))
+}
+
+// WriteTo writes the encoded document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	var offsets []int64
+
+	obj := func(body string) {
+		offsets = append(offsets, cw.n)
+		fmt.Fprintf(cw, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	fmt.Fprint(cw, "%PDF-1.4\n")
+
+	// Objects are numbered in order: catalog, page tree, fonts, then a page and
+	// content stream for each page.
+	firstPage := 3 + len(fonts)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	fontRefs := make([]string, len(fonts))
+	for i, f := range fonts {
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f))
+		fontRefs[i] = fmt.Sprintf("/%s %d 0 R", fontResource(f), 3+i)
+	}
+
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			num(d.width), num(d.height), strings.Join(fontRefs, " "), firstPage+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()))
+	}
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(cw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return cw.n, cw.err
+}
+
+// num formats a number compactly.
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// escape escapes a string for use in a PDF literal string.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// countingWriter tracks the number of bytes written, which is needed for the
+// cross-reference table. After the first error, writes are discarded.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	doc := New(LetterWidth, LetterHeight)
+	p := doc.AddPage()
+	p.Text(36, 700, HelveticaBold, 12, "Codes (sheet 1) \\ héllo")
+	p.FillRect(10, 10, 5, 5)
+	p.StrokeRect(0, 0, 100, 100, 4)
+	doc.AddPage()
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, int64(buf.Len()); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	out := buf.String()
+	if !strings.HasPrefix(out, "%PDF-1.4\n") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatalf("missing header or trailer: %q", out)
+	}
+	if !strings.Contains(out, `(Codes \(sheet 1\) \\ h?llo) Tj`) {
+		t.Errorf("text not escaped: %q", out)
+	}
+	if !strings.Contains(out, "/Count 2") {
+		t.Errorf("expected 2 pages: %q", out)
+	}
+
+	// Every xref offset must point at the start of its object.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(out)
+	if startxref == nil {
+		t.Fatalf("missing startxref")
+	}
+	xref, _ := strconv.Atoi(startxref[1])
+	if !strings.HasPrefix(out[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point at xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out[xref:], -1)
+	for i, e := range entries {
+		off, _ := strconv.Atoi(e[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(out[off:], want) {
+			t.Errorf("object %d: offset %d does not point at %q", i+1, off, want)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	"go.opencensus.io/stats"
+)
+
+const (
+	// adaptiveMinSamples is the minimum number of requests in an interval before
+	// the factor is lowered. Fewer requests are not a meaningful signal.
+	adaptiveMinSamples = 10
+
+	// adaptiveDecrease is multiplied with the factor when the backend is
+	// unhealthy.
+	adaptiveDecrease = 0.75
+
+	// adaptiveIncrease is added to the factor when the backend is healthy.
+	adaptiveIncrease = 0.1
+
+	// adaptiveLowestFactor is the lowest allowed RATE_LIMIT_ADAPTIVE_MIN_FACTOR.
+	// Any lower and an incident could effectively lock everyone out.
+	adaptiveLowestFactor = 0.1
+)
+
+// Adaptive scales rate limits down when the backend is struggling and back up
+// when it recovers. Handlers report the latency and outcome of each request
+// with Observe and, every interval, the factor is lowered if the mean latency
+// or error rate is above its target and raised otherwise. The factor is always
+// between the configured minimum and 1, so limits are never raised above their
+// static value.
+type Adaptive struct {
+	baseTokens      uint64
+	minFactor       float64
+	latencyTarget   time.Duration
+	errorRateTarget float64
+
+	lock     sync.Mutex
+	factor   float64
+	requests int64
+	errors   int64
+	latency  time.Duration
+}
+
+// NewAdaptive creates a new adaptive limit from the configuration. It returns
+// nil if adaptive limiting is not enabled. The factor is adjusted in the
+// background until the context is cancelled.
+func NewAdaptive(ctx context.Context, c *Config) (*Adaptive, error) {
+	if !c.AdaptiveEnabled {
+		return nil, nil
+	}
+
+	if c.AdaptiveMinFactor < adaptiveLowestFactor || c.AdaptiveMinFactor > 1 {
+		return nil, fmt.Errorf("RATE_LIMIT_ADAPTIVE_MIN_FACTOR must be between %.1f and 1, got %v",
+			adaptiveLowestFactor, c.AdaptiveMinFactor)
+	}
+	if c.AdaptiveLatencyTarget <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_ADAPTIVE_LATENCY_TARGET must be positive")
+	}
+	if c.AdaptiveErrorRateTarget <= 0 || c.AdaptiveErrorRateTarget > 1 {
+		return nil, fmt.Errorf("RATE_LIMIT_ADAPTIVE_ERROR_RATE_TARGET must be between 0 and 1, got %v",
+			c.AdaptiveErrorRateTarget)
+	}
+	if c.AdaptiveInterval <= 0 {
+		return nil, fmt.Errorf("RATE_LIMIT_ADAPTIVE_INTERVAL must be positive")
+	}
+
+	a := &Adaptive{
+		baseTokens:      c.Tokens,
+		minFactor:       c.AdaptiveMinFactor,
+		latencyTarget:   c.AdaptiveLatencyTarget,
+		errorRateTarget: c.AdaptiveErrorRateTarget,
+		factor:          1,
+	}
+	go a.run(ctx, c.AdaptiveInterval)
+	return a, nil
+}
+
+// Observe records the latency of a request and whether it failed because of
+// the backend.
+func (a *Adaptive) Observe(latency time.Duration, failed bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.requests++
+	a.latency += latency
+	if failed {
+		a.errors++
+	}
+}
+
+// Factor returns the current factor applied to limits.
+func (a *Adaptive) Factor() float64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.factor
+}
+
+// Limit returns the effective value of the given limit. It is never less than
+// 1 or more than the limit.
+func (a *Adaptive) Limit(limit uint64) uint64 {
+	effective := uint64(math.Floor(float64(limit) * a.Factor()))
+	if effective < 1 {
+		effective = 1
+	}
+	if effective > limit {
+		effective = limit
+	}
+	return effective
+}
+
+// run adjusts the factor every interval.
+func (a *Adaptive) run(ctx context.Context, interval time.Duration) {
+	logger := logging.FromContext(ctx).Named("ratelimit.Adaptive")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := a.Factor()
+			after := a.adjust()
+			if after != before {
+				logger.Infow("adjusted adaptive rate limit",
+					"factor", after,
+					"limit", a.Limit(a.baseTokens))
+			}
+
+			stats.Record(ctx,
+				mAdaptiveFactor.M(after),
+				mAdaptiveLimit.M(int64(a.Limit(a.baseTokens))))
+		}
+	}
+}
+
+// adjust updates the factor from the requests observed since the last call and
+// returns the new factor.
+func (a *Adaptive) adjust() float64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	requests, errors, latency := a.requests, a.errors, a.latency
+	a.requests, a.errors, a.latency = 0, 0, 0
+
+	unhealthy := false
+	if requests >= adaptiveMinSamples {
+		mean := latency / time.Duration(requests)
+		errorRate := float64(errors) / float64(requests)
+		unhealthy = mean > a.latencyTarget || errorRate > a.errorRateTarget
+	}
+
+	if unhealthy {
+		a.factor = math.Max(a.minFactor, a.factor*adaptiveDecrease)
+	} else {
+		a.factor = math.Min(1, a.factor+adaptiveIncrease)
+	}
+	return a.factor
+}
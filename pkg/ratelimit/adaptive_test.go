@@ -0,0 +1,138 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptive(t *testing.T) {
+	t.Parallel()
+
+	a := &Adaptive{
+		baseTokens:      100,
+		minFactor:       0.5,
+		latencyTarget:   100 * time.Millisecond,
+		errorRateTarget: 0.1,
+		factor:          1,
+	}
+
+	observe := func(n int, latency time.Duration, failed int) {
+		for i := 0; i < n; i++ {
+			a.Observe(latency, i < failed)
+		}
+	}
+
+	// Healthy traffic keeps the static limit.
+	observe(20, 10*time.Millisecond, 0)
+	if got, want := a.adjust(), 1.0; got != want {
+		t.Errorf("expected factor %v to be %v", got, want)
+	}
+
+	// Slow traffic lowers the factor.
+	observe(20, 200*time.Millisecond, 0)
+	if got, want := a.adjust(), 0.75; got != want {
+		t.Errorf("expected factor %v to be %v", got, want)
+	}
+	if got, want := a.Limit(100), uint64(75); got != want {
+		t.Errorf("expected limit %d to be %d", got, want)
+	}
+
+	// Errors lower the factor, but never below the minimum.
+	for i := 0; i < 5; i++ {
+		observe(20, 10*time.Millisecond, 10)
+		a.adjust()
+	}
+	if got, want := a.Factor(), 0.5; got != want {
+		t.Errorf("expected factor %v to be %v", got, want)
+	}
+
+	// Too few requests are not a signal, so the factor recovers.
+	observe(adaptiveMinSamples-1, time.Second, adaptiveMinSamples-1)
+	if got, want := a.adjust(), 0.6; got != want {
+		t.Errorf("expected factor %v to be %v", got, want)
+	}
+
+	// Recovery stops at the static limit.
+	for i := 0; i < 10; i++ {
+		a.adjust()
+	}
+	if got, want := a.Factor(), 1.0; got != want {
+		t.Errorf("expected factor %v to be %v", got, want)
+	}
+
+	// The effective limit is never zero.
+	a.factor = 0.5
+	if got, want := a.Limit(1), uint64(1); got != want {
+		t.Errorf("expected limit %d to be %d", got, want)
+	}
+}
+
+func TestNewAdaptive(t *testing.T) {
+	t.Parallel()
+
+	valid := Config{
+		Tokens:                  60,
+		AdaptiveEnabled:         true,
+		AdaptiveMinFactor:       0.5,
+		AdaptiveLatencyTarget:   time.Second,
+		AdaptiveErrorRateTarget: 0.05,
+		AdaptiveInterval:        time.Minute,
+	}
+
+	cases := []struct {
+		name   string
+		modify func(c *Config)
+		isNil  bool
+		experr bool
+	}{
+		{name: "valid"},
+		{name: "disabled", modify: func(c *Config) { c.AdaptiveEnabled = false }, isNil: true},
+		{name: "min_factor_too_low", modify: func(c *Config) { c.AdaptiveMinFactor = 0.01 }, experr: true},
+		{name: "min_factor_too_high", modify: func(c *Config) { c.AdaptiveMinFactor = 1.5 }, experr: true},
+		{name: "no_latency_target", modify: func(c *Config) { c.AdaptiveLatencyTarget = 0 }, experr: true},
+		{name: "bad_error_rate", modify: func(c *Config) { c.AdaptiveErrorRateTarget = 2 }, experr: true},
+		{name: "no_interval", modify: func(c *Config) { c.AdaptiveInterval = 0 }, experr: true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			c := valid
+			if tc.modify != nil {
+				tc.modify(&c)
+			}
+
+			a, err := NewAdaptive(ctx, &c)
+			if (err != nil) != tc.experr {
+				t.Fatalf("expected error to be %t, got %v", tc.experr, err)
+			}
+			if tc.experr {
+				return
+			}
+			if (a == nil) != tc.isNil {
+				t.Errorf("expected nil to be %t, got %v", tc.isNil, a)
+			}
+		})
+	}
+}
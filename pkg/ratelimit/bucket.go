@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+// BucketStore is implemented by stores which can configure a bucket as part of
+// the same atomic operation that uses it. Stores which do not implement it are
+// configured under a lock in this process, which is only safe for stores that
+// are not shared with other processes, like the memory store.
+type BucketStore interface {
+	// TakeBucket takes a token from the bucket at key. A bucket which does not
+	// exist is created with the given tokens and interval first. If reconfigure
+	// is true, a bucket with a different limit is also recreated.
+	TakeBucket(ctx context.Context, key string, tokens uint64, interval time.Duration, reconfigure bool) (limit, remaining, reset uint64, ok bool, err error)
+
+	// EnsureBucket creates the bucket at key with the given tokens and interval
+	// if it does not exist. An existing bucket is left alone.
+	EnsureBucket(ctx context.Context, key string, tokens uint64, interval time.Duration) error
+}
+
+// bucketLock serializes bucket configuration for stores which are not a
+// BucketStore.
+var bucketLock sync.Mutex
+
+// TakeBucket takes a token from the bucket at key, creating the bucket with the
+// given tokens and interval if it does not exist. If reconfigure is true, a
+// bucket with a different limit is recreated, which means changing a limit
+// gives the key a fresh bucket. The bucket is configured and taken from in one
+// operation, so concurrent callers never see the store's default limit.
+func TakeBucket(ctx context.Context, store limiter.Store, key string, tokens uint64, interval time.Duration, reconfigure bool) (uint64, uint64, uint64, bool, error) {
+	if bs, ok := store.(BucketStore); ok {
+		return bs.TakeBucket(ctx, key, tokens, interval, reconfigure)
+	}
+
+	bucketLock.Lock()
+	defer bucketLock.Unlock()
+
+	if err := configureBucket(ctx, store, key, tokens, interval, reconfigure); err != nil {
+		return 0, 0, 0, false, err
+	}
+	return store.Take(ctx, key)
+}
+
+// EnsureBucket configures the bucket for key with the given tokens and interval
+// if it does not exist yet. An existing bucket is left alone so its remaining
+// tokens are kept. This is used for buckets whose key changes each period, so
+// that a burst at the start of a period is not lost to the store's default
+// limit.
+func EnsureBucket(ctx context.Context, store limiter.Store, key string, tokens uint64, interval time.Duration) error {
+	if bs, ok := store.(BucketStore); ok {
+		return bs.EnsureBucket(ctx, key, tokens, interval)
+	}
+
+	bucketLock.Lock()
+	defer bucketLock.Unlock()
+
+	return configureBucket(ctx, store, key, tokens, interval, false)
+}
+
+// configureBucket sets the bucket at key if it does not exist, or if
+// reconfigure is true and its limit differs. Callers must hold bucketLock.
+func configureBucket(ctx context.Context, store limiter.Store, key string, tokens uint64, interval time.Duration, reconfigure bool) error {
+	limit, _, err := store.Get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to get bucket: %w", err)
+	}
+	if limit == tokens || (limit != 0 && !reconfigure) {
+		return nil
+	}
+
+	if err := store.Set(ctx, key, tokens, interval); err != nil {
+		return fmt.Errorf("failed to configure bucket: %w", err)
+	}
+	return nil
+}
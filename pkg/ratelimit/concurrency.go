@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// Concurrency caps the number of in-flight requests per key. Unlike the rate
+// limiter, which counts requests over time, it protects against a single
+// client holding many connections open at once. Counts are local to the
+// process.
+type Concurrency struct {
+	lock     sync.Mutex
+	inflight map[string]uint
+}
+
+// NewConcurrency creates a new concurrency limiter.
+func NewConcurrency() *Concurrency {
+	return &Concurrency{
+		inflight: make(map[string]uint),
+	}
+}
+
+// Acquire reserves a slot for the key. If the key already has limit requests
+// in flight, it returns false and nothing is reserved. Otherwise the returned
+// function must be called exactly once when the request finishes. A limit of
+// 0 means unlimited, but requests are still counted.
+func (c *Concurrency) Acquire(ctx context.Context, key string, limit uint) (func(), bool) {
+	c.lock.Lock()
+	current := c.inflight[key]
+	if limit > 0 && current >= limit {
+		c.lock.Unlock()
+		c.record(ctx, key, current)
+		return nil, false
+	}
+	current++
+	c.inflight[key] = current
+	c.lock.Unlock()
+	c.record(ctx, key, current)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.lock.Lock()
+			remaining := c.inflight[key] - 1
+			if remaining == 0 {
+				delete(c.inflight, key)
+			} else {
+				c.inflight[key] = remaining
+			}
+			c.lock.Unlock()
+			c.record(ctx, key, remaining)
+		})
+	}, true
+}
+
+// Current returns the number of requests in flight for the key.
+func (c *Concurrency) Current(key string) uint {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.inflight[key]
+}
+
+func (c *Concurrency) record(ctx context.Context, key string, current uint) {
+	ctx, err := tag.New(ctx, tag.Upsert(concurrencyKeyTagKey, key))
+	if err != nil {
+		return
+	}
+	stats.Record(ctx, mConcurrencyInflight.M(int64(current)))
+}
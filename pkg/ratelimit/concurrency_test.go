@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConcurrency(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := NewConcurrency()
+
+	release1, ok := c.Acquire(ctx, "1", 2)
+	if !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	release2, ok := c.Acquire(ctx, "1", 2)
+	if !ok {
+		t.Fatal("expected second request to be allowed")
+	}
+	if _, ok := c.Acquire(ctx, "1", 2); ok {
+		t.Fatal("expected third request to be rejected")
+	}
+
+	// Other keys are counted separately.
+	release3, ok := c.Acquire(ctx, "2", 2)
+	if !ok {
+		t.Fatal("expected request for other key to be allowed")
+	}
+	release3()
+
+	if got, want := c.Current("1"), uint(2); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// Releasing twice only frees one slot.
+	release1()
+	release1()
+	if got, want := c.Current("1"), uint(1); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	release4, ok := c.Acquire(ctx, "1", 2)
+	if !ok {
+		t.Fatal("expected request to be allowed after release")
+	}
+	release4()
+	release2()
+
+	if got, want := c.Current("1"), uint(0); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	// A limit of 0 is unlimited.
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Acquire(ctx, "3", 0); !ok {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+	if got, want := c.Current("3"), uint(10); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+}
@@ -46,6 +46,34 @@ type Config struct {
 	Tokens   uint64        `env:"RATE_LIMIT_TOKENS, default=60"`
 	Interval time.Duration `env:"RATE_LIMIT_INTERVAL, default=1m"`
 
+	// FailOpen allows requests through when the store returns an error, such as
+	// when Redis is unreachable. The default is to fail closed and reject the
+	// request with an internal server error.
+	FailOpen bool `env:"RATE_LIMIT_FAIL_OPEN, default=false"`
+
+	// ByAPIKey gives each API key its own limit on servers which authenticate
+	// with API keys. By default, all keys for a realm share a limit per IP.
+	ByAPIKey bool `env:"RATE_LIMIT_BY_API_KEY, default=false"`
+
+	// Adaptive limiting lowers limits when the backend is slow or failing, down
+	// to AdaptiveMinFactor of their configured value, and raises them again
+	// when it recovers. It is disabled by default.
+	AdaptiveEnabled         bool          `env:"RATE_LIMIT_ADAPTIVE, default=false"`
+	AdaptiveMinFactor       float64       `env:"RATE_LIMIT_ADAPTIVE_MIN_FACTOR, default=0.5"`
+	AdaptiveLatencyTarget   time.Duration `env:"RATE_LIMIT_ADAPTIVE_LATENCY_TARGET, default=500ms"`
+	AdaptiveErrorRateTarget float64       `env:"RATE_LIMIT_ADAPTIVE_ERROR_RATE_TARGET, default=0.05"`
+	AdaptiveInterval        time.Duration `env:"RATE_LIMIT_ADAPTIVE_INTERVAL, default=10s"`
+
+	// Issue, Verify, Stats, Admin, and Login override the limit for their group
+	// of routes, for example RATE_LIMIT_STATS_TOKENS. Each group with an override
+	// is counted separately from the others. Groups without one use the default
+	// limit.
+	Issue  GroupLimit `env:",prefix=RATE_LIMIT_ISSUE_"`
+	Verify GroupLimit `env:",prefix=RATE_LIMIT_VERIFY_"`
+	Stats  GroupLimit `env:",prefix=RATE_LIMIT_STATS_"`
+	Admin  GroupLimit `env:",prefix=RATE_LIMIT_ADMIN_"`
+	Login  GroupLimit `env:",prefix=RATE_LIMIT_LOGIN_"`
+
 	// HMACKey is the key to use when calculating the HMAC of keys before saving
 	// them in the rate limiter.
 	HMACKey envconfig.Base64Bytes `env:"RATE_LIMIT_HMAC_KEY, required"`
@@ -55,8 +83,17 @@ type Config struct {
 }
 
 // RateLimiterFor returns the rate limiter for the given type, or an error
-// if one does not exist.
+// if one does not exist. The returned store records health metrics and can be
+// checked with Ping.
 func RateLimiterFor(ctx context.Context, c *Config) (limiter.Store, error) {
+	store, err := rateLimiterFor(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return newInstrumentedStore(ctx, store, c.Type, c.Interval), nil
+}
+
+func rateLimiterFor(ctx context.Context, c *Config) (limiter.Store, error) {
 	switch c.Type {
 	case RateLimiterTypeNoop:
 		return noopstore.New()
@@ -66,34 +103,46 @@ func RateLimiterFor(ctx context.Context, c *Config) (limiter.Store, error) {
 			Interval: c.Interval,
 		})
 	case RateLimiterTypeRedis:
-		addr := c.Redis.Host + ":" + c.Redis.Port
-
-		config := &redisstore.Config{
-			Tokens:   c.Tokens,
-			Interval: c.Interval,
-		}
-
-		return redisstore.NewWithPool(config, &redigo.Pool{
-			Dial: func() (redigo.Conn, error) {
-				options := redigo.TraceOptions{}
-				// set default attributes
-				redigo.WithDefaultAttributes(trace.StringAttribute("span.type", "DB"))(&options)
-
-				return redigo.DialWithContext(ctx, "tcp", addr,
-					redigo.DialPassword(c.Redis.Password),
-					redigo.DialTraceOptions(options),
-				)
-			},
-			TestOnBorrow: func(conn redigo.Conn, _ time.Time) error {
-				_, err := conn.Do("PING")
-				return err
-			},
-
-			IdleTimeout: c.Redis.IdleTimeout,
-			MaxIdle:     c.Redis.MaxIdle,
-			MaxActive:   c.Redis.MaxActive,
-		})
+		return newRedisStore(ctx, c)
 	}
 
 	return nil, fmt.Errorf("unknown rate limiter type: %v", c.Type)
 }
+
+// newRedisStore creates a redis store which can also configure buckets
+// atomically.
+func newRedisStore(ctx context.Context, c *Config) (limiter.Store, error) {
+	addr := c.Redis.Host + ":" + c.Redis.Port
+
+	config := &redisstore.Config{
+		Tokens:   c.Tokens,
+		Interval: c.Interval,
+	}
+
+	pool := &redigo.Pool{
+		Dial: func() (redigo.Conn, error) {
+			options := redigo.TraceOptions{}
+			// set default attributes
+			redigo.WithDefaultAttributes(trace.StringAttribute("span.type", "DB"))(&options)
+
+			return redigo.DialWithContext(ctx, "tcp", addr,
+				redigo.DialPassword(c.Redis.Password),
+				redigo.DialTraceOptions(options),
+			)
+		},
+		TestOnBorrow: func(conn redigo.Conn, _ time.Time) error {
+			_, err := conn.Do("PING")
+			return err
+		},
+
+		IdleTimeout: c.Redis.IdleTimeout,
+		MaxIdle:     c.Redis.MaxIdle,
+		MaxActive:   c.Redis.MaxActive,
+	}
+
+	store, err := redisstore.NewWithPool(config, pool)
+	if err != nil {
+		return nil, err
+	}
+	return &redisBucketStore{Store: store, pool: pool}, nil
+}
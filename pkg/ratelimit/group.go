@@ -0,0 +1,140 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+// Group is a set of routes which share a rate limit.
+type Group string
+
+const (
+	GroupIssue  Group = "issue"
+	GroupVerify Group = "verify"
+	GroupStats  Group = "stats"
+	GroupAdmin  Group = "admin"
+	GroupLogin  Group = "login"
+)
+
+// GroupLimit overrides the default limit for a group of routes. Zero values
+// inherit RATE_LIMIT_TOKENS and RATE_LIMIT_INTERVAL.
+type GroupLimit struct {
+	Tokens   uint64        `env:"TOKENS"`
+	Interval time.Duration `env:"INTERVAL"`
+}
+
+// IsSet returns true if the group limit overrides either default.
+func (g *GroupLimit) IsSet() bool {
+	return g.Tokens > 0 || g.Interval > 0
+}
+
+// groupLimit returns the configured limit for the group.
+func (c *Config) groupLimit(g Group) (*GroupLimit, error) {
+	switch g {
+	case GroupIssue:
+		return &c.Issue, nil
+	case GroupVerify:
+		return &c.Verify, nil
+	case GroupStats:
+		return &c.Stats, nil
+	case GroupAdmin:
+		return &c.Admin, nil
+	case GroupLogin:
+		return &c.Login, nil
+	}
+	return nil, fmt.Errorf("unknown rate limit group: %q", g)
+}
+
+// forGroup returns a copy of the config with the group's tokens and interval.
+func (c *Config) forGroup(gl *GroupLimit) *Config {
+	copied := *c
+	if gl.Tokens > 0 {
+		copied.Tokens = gl.Tokens
+	}
+	if gl.Interval > 0 {
+		copied.Interval = gl.Interval
+	}
+	return &copied
+}
+
+// GroupStores hands out the store for each group of routes. Groups which do
+// not configure their own limit share the default store, so unless a group
+// limit is set, every route has the same limit as before.
+type GroupStores struct {
+	config   *Config
+	base     limiter.Store
+	newStore func(context.Context, *Config) (limiter.Store, error)
+
+	lock   sync.Mutex
+	stores map[Group]limiter.Store
+}
+
+// NewGroupStores creates group stores which fall back to the base store.
+func NewGroupStores(c *Config, base limiter.Store) *GroupStores {
+	return &GroupStores{
+		config:   c,
+		base:     base,
+		newStore: RateLimiterFor,
+		stores:   make(map[Group]limiter.Store),
+	}
+}
+
+// For returns the store for the group, and the key scope to use with it. If the
+// group has its own limit, the scope is extended with the group name so its
+// keys do not collide with the default limit's keys in a shared backend.
+func (s *GroupStores) For(ctx context.Context, g Group, scope string) (limiter.Store, string, error) {
+	gl, err := s.config.groupLimit(g)
+	if err != nil {
+		return nil, "", err
+	}
+	if !gl.IsSet() {
+		return s.base, scope, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	store, ok := s.stores[g]
+	if !ok {
+		store, err = s.newStore(ctx, s.config.forGroup(gl))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create %s limiter: %w", g, err)
+		}
+		s.stores[g] = store
+	}
+	return store, scope + string(g) + ":", nil
+}
+
+// Close closes the stores created for groups. It does not close the base
+// store.
+func (s *GroupStores) Close(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var merr error
+	for g, store := range s.stores {
+		if err := store.Close(ctx); err != nil && merr == nil {
+			merr = fmt.Errorf("failed to close %s limiter: %w", g, err)
+		}
+		delete(s.stores, g)
+	}
+	return merr
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+func TestGroupStores(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	config := &Config{
+		Type:     RateLimiterTypeNoop,
+		Tokens:   60,
+		Interval: time.Minute,
+		Stats:    GroupLimit{Tokens: 10},
+	}
+	base := &fakeStore{buckets: make(map[string]*fakeBucket)}
+
+	var created []*Config
+	groups := &GroupStores{
+		config: config,
+		base:   base,
+		newStore: func(_ context.Context, c *Config) (limiter.Store, error) {
+			created = append(created, c)
+			return &fakeStore{buckets: make(map[string]*fakeBucket)}, nil
+		},
+		stores: make(map[Group]limiter.Store),
+	}
+	defer groups.Close(ctx)
+
+	// Groups without a limit share the base store and scope.
+	store, scope, err := groups.For(ctx, GroupIssue, "adminapi:ratelimit:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store != base {
+		t.Errorf("expected issue group to use the base store")
+	}
+	if got, want := scope, "adminapi:ratelimit:"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Groups with a limit get their own store and scope.
+	stats, scope, err := groups.For(ctx, GroupStats, "adminapi:ratelimit:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == base {
+		t.Errorf("expected stats group to have its own store")
+	}
+	if got, want := scope, "adminapi:ratelimit:stats:"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	again, _, err := groups.For(ctx, GroupStats, "adminapi:ratelimit:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != stats {
+		t.Errorf("expected stats store to be reused")
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("expected 1 store to be created, got %d", len(created))
+	}
+	if got, want := created[0].Tokens, uint64(10); got != want {
+		t.Errorf("expected %d to be %d", got, want)
+	}
+
+	if _, _, err := groups.For(ctx, Group("nope"), ""); err == nil {
+		t.Errorf("expected error for unknown group")
+	}
+}
+
+func TestConfig_ForGroup(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{Tokens: 60, Interval: time.Minute}
+
+	got := config.forGroup(&GroupLimit{Tokens: 5})
+	if got.Tokens != 5 || got.Interval != time.Minute {
+		t.Errorf("expected 5 tokens per minute, got %d per %s", got.Tokens, got.Interval)
+	}
+
+	got = config.forGroup(&GroupLimit{Interval: time.Hour})
+	if got.Tokens != 60 || got.Interval != time.Hour {
+		t.Errorf("expected 60 tokens per hour, got %d per %s", got.Tokens, got.Interval)
+	}
+
+	if config.Tokens != 60 || config.Interval != time.Minute {
+		t.Errorf("expected config to be unchanged")
+	}
+}
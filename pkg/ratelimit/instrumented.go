@@ -0,0 +1,227 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"github.com/sethvargo/go-limiter"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// healthKey is the key used to check the health of the store. It is only ever
+// read, so it does not consume tokens.
+const healthKey = "healthz:ratelimit"
+
+// healthTimeout is the maximum amount of time a health check may take.
+const healthTimeout = 5 * time.Second
+
+var (
+	_ limiter.Store = (*instrumentedStore)(nil)
+	_ BucketStore   = (*instrumentedStore)(nil)
+)
+
+// instrumentedStore wraps a limiter.Store and records latency, errors, and the
+// approximate number of active keys. Without this, a store that is down is
+// indistinguishable from one that is allowing every request.
+type instrumentedStore struct {
+	store     limiter.Store
+	storeType RateLimitType
+	interval  time.Duration
+
+	// keys tracks the time at which each key was last used, for cardinality.
+	keysLock sync.Mutex
+	keys     map[string]time.Time
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// newInstrumentedStore wraps the given store. It starts a background goroutine
+// which periodically reports key cardinality until the store is closed.
+func newInstrumentedStore(ctx context.Context, s limiter.Store, typ RateLimitType, interval time.Duration) *instrumentedStore {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	store := &instrumentedStore{
+		store:     s,
+		storeType: typ,
+		interval:  interval,
+		keys:      make(map[string]time.Time),
+		stopCh:    make(chan struct{}),
+	}
+	go store.reportKeys(ctx)
+	return store
+}
+
+// Take implements limiter.Store.
+func (s *instrumentedStore) Take(ctx context.Context, key string) (uint64, uint64, uint64, bool, error) {
+	start := time.Now()
+	tokens, remaining, reset, ok, err := s.store.Take(ctx, key)
+	s.record(ctx, "take", start, err)
+	if err == nil {
+		s.touch(key, start)
+	}
+	return tokens, remaining, reset, ok, err
+}
+
+// Get implements limiter.Store.
+func (s *instrumentedStore) Get(ctx context.Context, key string) (uint64, uint64, error) {
+	start := time.Now()
+	tokens, remaining, err := s.store.Get(ctx, key)
+	s.record(ctx, "get", start, err)
+	return tokens, remaining, err
+}
+
+// Set implements limiter.Store.
+func (s *instrumentedStore) Set(ctx context.Context, key string, tokens uint64, interval time.Duration) error {
+	start := time.Now()
+	err := s.store.Set(ctx, key, tokens, interval)
+	s.record(ctx, "set", start, err)
+	return err
+}
+
+// Burst implements limiter.Store.
+func (s *instrumentedStore) Burst(ctx context.Context, key string, tokens uint64) error {
+	start := time.Now()
+	err := s.store.Burst(ctx, key, tokens)
+	s.record(ctx, "burst", start, err)
+	return err
+}
+
+// TakeBucket implements BucketStore.
+func (s *instrumentedStore) TakeBucket(ctx context.Context, key string, tokens uint64, interval time.Duration, reconfigure bool) (uint64, uint64, uint64, bool, error) {
+	start := time.Now()
+	limit, remaining, reset, ok, err := TakeBucket(ctx, s.store, key, tokens, interval, reconfigure)
+	s.record(ctx, "take", start, err)
+	if err == nil {
+		s.touch(key, start)
+	}
+	return limit, remaining, reset, ok, err
+}
+
+// EnsureBucket implements BucketStore.
+func (s *instrumentedStore) EnsureBucket(ctx context.Context, key string, tokens uint64, interval time.Duration) error {
+	start := time.Now()
+	err := EnsureBucket(ctx, s.store, key, tokens, interval)
+	s.record(ctx, "set", start, err)
+	return err
+}
+
+// Close implements limiter.Store.
+func (s *instrumentedStore) Close(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+	return s.store.Close(ctx)
+}
+
+// Ping reads a key from the store to verify it is reachable.
+func (s *instrumentedStore) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	if _, _, err := s.Get(ctx, healthKey); err != nil {
+		return fmt.Errorf("failed to read from %s limiter store: %w", s.storeType, err)
+	}
+	return nil
+}
+
+// record records the latency of the operation and, if it failed, the error.
+func (s *instrumentedStore) record(ctx context.Context, op string, start time.Time, err error) {
+	result := observability.ResultOK()
+	if err != nil {
+		result = observability.ResultError("FAILED")
+	}
+
+	ctx, tagErr := tag.New(ctx,
+		tag.Upsert(storeTypeTagKey, string(s.storeType)),
+		tag.Upsert(operationTagKey, op),
+		result)
+	if tagErr != nil {
+		logging.FromContext(ctx).Named("ratelimit.record").
+			Warnw("failed to create context with additional tags", "error", tagErr)
+	}
+
+	ms := float64(time.Since(start)) / float64(time.Millisecond)
+	stats.Record(ctx, mLatencyMs.M(ms))
+
+	if err != nil {
+		stats.Record(ctx, mErrors.M(1))
+		logging.FromContext(ctx).Named("ratelimit.record").
+			Errorw("limiter store operation failed",
+				"operation", op,
+				"store", s.storeType,
+				"error", err)
+	}
+}
+
+// touch marks the key as used at the given time.
+func (s *instrumentedStore) touch(key string, t time.Time) {
+	s.keysLock.Lock()
+	s.keys[key] = t
+	s.keysLock.Unlock()
+}
+
+// reportKeys expires keys which have not been used within the interval and
+// reports the number that remain. This approximates the number of buckets held
+// by the store, since buckets reset after an interval of inactivity.
+func (s *instrumentedStore) reportKeys(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	ctx, err := tag.New(ctx, tag.Upsert(storeTypeTagKey, string(s.storeType)))
+	if err != nil {
+		logging.FromContext(ctx).Named("ratelimit.reportKeys").
+			Warnw("failed to create context with additional tags", "error", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopCh:
+			return
+		case now := <-ticker.C:
+			s.keysLock.Lock()
+			for k, t := range s.keys {
+				if now.Sub(t) > s.interval {
+					delete(s.keys, k)
+				}
+			}
+			n := len(s.keys)
+			s.keysLock.Unlock()
+
+			stats.Record(ctx, mKeys.M(int64(n)))
+		}
+	}
+}
+
+// Ping checks the health of the given store. Stores which were not created by
+// RateLimiterFor are assumed to be healthy.
+func Ping(ctx context.Context, s limiter.Store) error {
+	if typ, ok := s.(*instrumentedStore); ok {
+		return typ.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+func TestInstrumentedStore(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		store   limiter.Store
+		err     bool
+		touched bool
+	}{
+		{
+			name:    "healthy",
+			store:   &fakeStore{buckets: map[string]*fakeBucket{"key": {tokens: 5, remaining: 5}}},
+			touched: true,
+		},
+		{
+			name:  "failing",
+			store: &errStore{err: errors.New("connection refused")},
+			err:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			s := newInstrumentedStore(ctx, tc.store, RateLimiterTypeMemory, time.Hour)
+			defer s.Close(ctx)
+
+			if _, _, err := s.Get(ctx, "key"); (err != nil) != tc.err {
+				t.Errorf("get: expected error to be %t, got %v", tc.err, err)
+			}
+			if got := s.keys; len(got) != 0 {
+				t.Errorf("expected get not to track keys, got %v", got)
+			}
+
+			tokens, remaining, _, ok, err := s.Take(ctx, "key")
+			if (err != nil) != tc.err {
+				t.Errorf("take: expected error to be %t, got %v", tc.err, err)
+			}
+			if !tc.err {
+				if !ok || tokens != 5 || remaining != 4 {
+					t.Errorf("expected take to pass through, got %d tokens with %d remaining (%t)", tokens, remaining, ok)
+				}
+			}
+			if _, got := s.keys["key"]; got != tc.touched {
+				t.Errorf("expected key to be tracked to be %t", tc.touched)
+			}
+
+			if err := s.Set(ctx, "other", 3, time.Minute); (err != nil) != tc.err {
+				t.Errorf("set: expected error to be %t, got %v", tc.err, err)
+			}
+			if err := s.Burst(ctx, "key", 1); (err != nil) != tc.err {
+				t.Errorf("burst: expected error to be %t, got %v", tc.err, err)
+			}
+
+			err = Ping(ctx, s)
+			if (err != nil) != tc.err {
+				t.Errorf("ping: expected error to be %t, got %v", tc.err, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), string(RateLimiterTypeMemory)) {
+				t.Errorf("expected %q to contain the store type", err)
+			}
+		})
+	}
+}
+
+func TestInstrumentedStore_Close(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := newInstrumentedStore(ctx, &fakeStore{buckets: make(map[string]*fakeBucket)}, RateLimiterTypeMemory, time.Hour)
+
+	// Closing more than once must not panic by closing the stop channel again.
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-s.stopCh:
+	default:
+		t.Errorf("expected stop channel to be closed")
+	}
+}
+
+func TestPing_Uninstrumented(t *testing.T) {
+	t.Parallel()
+
+	// Stores not created by RateLimiterFor cannot be checked and are assumed to
+	// be healthy.
+	if err := Ping(context.Background(), &errStore{err: errors.New("oops")}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+var _ limiter.Store = (*errStore)(nil)
+
+// errStore is a limiter.Store which fails every operation.
+type errStore struct {
+	err error
+}
+
+func (s *errStore) Take(_ context.Context, _ string) (uint64, uint64, uint64, bool, error) {
+	return 0, 0, 0, false, s.err
+}
+
+func (s *errStore) Get(_ context.Context, _ string) (uint64, uint64, error) {
+	return 0, 0, s.err
+}
+
+func (s *errStore) Set(_ context.Context, _ string, _ uint64, _ time.Duration) error {
+	return s.err
+}
+
+func (s *errStore) Burst(_ context.Context, _ string, _ uint64) error {
+	return s.err
+}
+
+func (s *errStore) Close(_ context.Context) error {
+	return nil
+}
+
+var _ limiter.Store = (*fakeStore)(nil)
+
+// fakeStore is a limiter.Store with buckets which never reset.
+type fakeStore struct {
+	buckets map[string]*fakeBucket
+}
+
+type fakeBucket struct {
+	tokens, remaining uint64
+}
+
+func (s *fakeStore) Take(_ context.Context, key string) (uint64, uint64, uint64, bool, error) {
+	b, ok := s.buckets[key]
+	if !ok {
+		return 0, 0, 0, false, nil
+	}
+	reset := uint64(time.Now().Add(time.Minute).UnixNano())
+	if b.remaining == 0 {
+		return b.tokens, 0, reset, false, nil
+	}
+	b.remaining--
+	return b.tokens, b.remaining, reset, true, nil
+}
+
+func (s *fakeStore) Get(_ context.Context, key string) (uint64, uint64, error) {
+	if b, ok := s.buckets[key]; ok {
+		return b.tokens, b.remaining, nil
+	}
+	return 0, 0, nil
+}
+
+func (s *fakeStore) Set(_ context.Context, key string, tokens uint64, _ time.Duration) error {
+	s.buckets[key] = &fakeBucket{tokens: tokens, remaining: tokens}
+	return nil
+}
+
+func (s *fakeStore) Burst(_ context.Context, key string, tokens uint64) error {
+	if b, ok := s.buckets[key]; ok {
+		b.remaining += tokens
+	}
+	return nil
+}
+
+func (s *fakeStore) Close(_ context.Context) error {
+	return nil
+}
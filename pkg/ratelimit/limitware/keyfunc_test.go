@@ -0,0 +1,171 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limitware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/controller"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+)
+
+func TestAPIKeyFunc(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+	hmacKey := []byte("abcd1234")
+
+	realm, err := db.CreateRealm("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, name := range []string{"Clinic A", "Clinic B"} {
+		key, err := realm.CreateAuthorizedApp(db, &database.AuthorizedApp{
+			Name:       name,
+			APIKeyType: database.APIKeyTypeAdmin,
+		}, database.SystemTest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	request := func(apiKey, ip string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/issue", nil)
+		r.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			r.Header.Set("x-api-key", apiKey)
+		}
+		return r
+	}
+
+	cases := []struct {
+		name      string
+		perKey    bool
+		a, b      *http.Request
+		same      bool
+		expPrefix string
+	}{
+		{
+			name:      "shared_realm_limit",
+			a:         request(keys[0], "203.0.113.1"),
+			b:         request(keys[1], "203.0.113.1"),
+			same:      true,
+			expPrefix: "test:realm:",
+		},
+		{
+			name:      "shared_realm_limit_per_ip",
+			a:         request(keys[0], "203.0.113.1"),
+			b:         request(keys[1], "203.0.113.2"),
+			expPrefix: "test:realm:",
+		},
+		{
+			name:      "per_key_limit",
+			perKey:    true,
+			a:         request(keys[0], "203.0.113.1"),
+			b:         request(keys[1], "203.0.113.1"),
+			expPrefix: "test:apikey:",
+		},
+		{
+			name:      "per_key_same_key",
+			perKey:    true,
+			a:         request(keys[0], "203.0.113.1"),
+			b:         request(keys[0], "203.0.113.1"),
+			same:      true,
+			expPrefix: "test:apikey:",
+		},
+		{
+			name:      "invalid_key_by_ip",
+			perKey:    true,
+			a:         request("not-a-key", "203.0.113.1"),
+			b:         request("", "203.0.113.1"),
+			same:      true,
+			expPrefix: "test:ip:",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			fn := APIKeyFunc(ctx, db, "test:", hmacKey, tc.perKey, 0)
+
+			a, err := fn(tc.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := fn(tc.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := a == b; got != tc.same {
+				t.Errorf("expected keys to match to be %t, got %q and %q", tc.same, a, b)
+			}
+			if !strings.HasPrefix(a, tc.expPrefix) {
+				t.Errorf("expected %q to start with %q", a, tc.expPrefix)
+			}
+			if apiKey := tc.a.Header.Get("x-api-key"); apiKey != "" && strings.Contains(a, apiKey) {
+				t.Errorf("expected %q not to contain the API key", a)
+			}
+		})
+	}
+}
+
+func TestUserIDKeyFunc(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fn := UserIDKeyFunc(ctx, "test:", []byte("abcd1234"), 0)
+
+	cases := []struct {
+		name      string
+		user      *database.User
+		expPrefix string
+	}{
+		{name: "user", user: &database.User{Email: "user@example.com"}, expPrefix: "test:user:"},
+		{name: "no_user", expPrefix: "test:ip:"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.user != nil {
+				r = r.WithContext(controller.WithUser(r.Context(), tc.user))
+			}
+
+			key, err := fn(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(key, tc.expPrefix) {
+				t.Errorf("expected %q to start with %q", key, tc.expPrefix)
+			}
+		})
+	}
+}
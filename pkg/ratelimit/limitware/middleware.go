@@ -20,7 +20,6 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
@@ -28,6 +27,7 @@ import (
 	"github.com/google/exposure-notifications-verification-server/pkg/database"
 	"github.com/google/exposure-notifications-verification-server/pkg/digest"
 	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/ratelimit"
 
 	"github.com/sethvargo/go-limiter"
 	"github.com/sethvargo/go-limiter/httplimit"
@@ -43,13 +43,15 @@ type Middleware struct {
 	keyFunc httplimit.KeyFunc
 
 	allowOnError bool
+	adaptive     *ratelimit.Adaptive
 }
 
 // Option is an option to the middleware.
 type Option func(m *Middleware) *Middleware
 
-// AllowOnError instructs the middleware to fail (internal server error) on
-// connection errors. The default behavior is to fail on errors to Take.
+// AllowOnError instructs the middleware to allow the request (fail open) on
+// connection errors. The default behavior is to fail (internal server error) on
+// errors to Take.
 func AllowOnError(v bool) Option {
 	return func(m *Middleware) *Middleware {
 		m.allowOnError = v
@@ -57,6 +59,15 @@ func AllowOnError(v bool) Option {
 	}
 }
 
+// Adaptive scales limits with the given adaptive limit, and reports the latency
+// and outcome of each request to it. A nil value disables adaptive limiting.
+func Adaptive(a *ratelimit.Adaptive) Option {
+	return func(m *Middleware) *Middleware {
+		m.adaptive = a
+		return m
+	}
+}
+
 // NewMiddleware creates a new middleware suitable for use as an HTTP handler.
 // This function returns an error if either the Store or KeyFunc are nil.
 func NewMiddleware(ctx context.Context, s limiter.Store, f httplimit.KeyFunc, opts ...Option) (*Middleware, error) {
@@ -118,13 +129,35 @@ func (m *Middleware) Handle(next http.Handler) http.Handler {
 		// Take from the store.
 		limit, remaining, reset, ok, err := m.store.Take(ctx, key)
 		if err != nil {
-			logger.Errorw("failed to take", "error", err)
+			logger.Errorw("failed to take", "error", err, "allow_on_error", m.allowOnError)
 
 			if !m.allowOnError {
 				result = observability.ResultError("FAILED_TO_TAKE")
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				return
 			}
+
+			// The store is unavailable, so there are no meaningful headers to set.
+			result = observability.ResultError("FAILED_TO_TAKE_ALLOWED")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Shed load by rejecting requests beyond the effective limit. The store
+		// still holds the configured limit, so the bucket recovers as soon as the
+		// factor is raised.
+		shed := false
+		if m.adaptive != nil {
+			effective := m.adaptive.Limit(limit)
+			excess := limit - effective
+			if remaining < excess {
+				shed = ok
+				ok = false
+				remaining = 0
+			} else {
+				remaining -= excess
+			}
+			limit = effective
 		}
 
 		resetTime := time.Unix(0, int64(reset)).UTC().Format(time.RFC1123)
@@ -137,6 +170,9 @@ func (m *Middleware) Handle(next http.Handler) http.Handler {
 		// Fail if there were no tokens remaining.
 		if !ok {
 			result = observability.ResultError("RATE_LIMITED")
+			if shed {
+				result = observability.ResultError("RATE_LIMITED_ADAPTIVE")
+			}
 			w.Header().Set(httplimit.HeaderRetryAfter, resetTime)
 			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 			return
@@ -144,15 +180,38 @@ func (m *Middleware) Handle(next http.Handler) http.Handler {
 
 		// If we got this far, we're allowed to continue, so call the next middleware
 		// in the stack to continue processing.
-		next.ServeHTTP(w, r)
+		if m.adaptive == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		m.adaptive.Observe(time.Since(start), sw.code >= http.StatusInternalServerError)
 	})
 }
 
+// statusWriter records the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
 // APIKeyFunc returns a default key function for ratelimiting on our API key
 // header. Since APIKeys are assumed to be "public" at some point, they are rate
-// limited by [realm,ip], and API keys have a 1-1 mapping to a realm.
-func APIKeyFunc(ctx context.Context, db *database.Database, scope string, hmacKey []byte) httplimit.KeyFunc {
-	ipAddrLimit := IPAddressKeyFunc(ctx, scope, hmacKey)
+// limited by [realm,ip], and API keys have a 1-1 mapping to a realm. If perKey
+// is true, they are limited by [realm,key,ip] instead, so keys used from behind
+// the same NAT do not share a limit. Requests without a valid API key are
+// limited by ip. trustedProxies is the number of proxies in front of the
+// server, used to find the client IP.
+func APIKeyFunc(ctx context.Context, db *database.Database, scope string, hmacKey []byte, perKey bool, trustedProxies int) httplimit.KeyFunc {
+	ipAddrLimit := IPAddressKeyFunc(ctx, scope, hmacKey, trustedProxies)
 
 	return func(r *http.Request) (string, error) {
 		ctx := r.Context()
@@ -163,9 +222,18 @@ func APIKeyFunc(ctx context.Context, db *database.Database, scope string, hmacKe
 		v := r.Header.Get("x-api-key")
 		if v != "" {
 			realmID := realmIDFromAPIKey(db, v)
+			if realmID != 0 && perKey {
+				logger.Debugw("limiting by apikey")
+				dig, err := digest.HMAC(fmt.Sprintf("%d:%s:%s", realmID, v, controller.ClientIP(r, trustedProxies)), hmacKey)
+				if err != nil {
+					return "", fmt.Errorf("failed to digest api key: %w", err)
+				}
+				return fmt.Sprintf("%sapikey:%s", scope, dig), nil
+			}
+
 			if realmID != 0 {
 				logger.Debugw("limiting by realm from apikey")
-				dig, err := digest.HMAC(fmt.Sprintf("%d:%s", realmID, remoteIP(r)), hmacKey)
+				dig, err := digest.HMAC(fmt.Sprintf("%d:%s", realmID, controller.ClientIP(r, trustedProxies)), hmacKey)
 				if err != nil {
 					return "", fmt.Errorf("failed to digest api key: %w", err)
 				}
@@ -179,8 +247,8 @@ func APIKeyFunc(ctx context.Context, db *database.Database, scope string, hmacKe
 
 // UserIDKeyFunc pulls the user out of the request context and uses that to
 // ratelimit. It falls back to rate limiting by the client ip.
-func UserIDKeyFunc(ctx context.Context, scope string, hmacKey []byte) httplimit.KeyFunc {
-	ipAddrLimit := IPAddressKeyFunc(ctx, scope, hmacKey)
+func UserIDKeyFunc(ctx context.Context, scope string, hmacKey []byte, trustedProxies int) httplimit.KeyFunc {
+	ipAddrLimit := IPAddressKeyFunc(ctx, scope, hmacKey, trustedProxies)
 
 	return func(r *http.Request) (string, error) {
 		ctx := r.Context()
@@ -202,15 +270,15 @@ func UserIDKeyFunc(ctx context.Context, scope string, hmacKey []byte) httplimit.
 	}
 }
 
-// IPAddressKeyFunc uses the client IP to rate limit.
-func IPAddressKeyFunc(ctx context.Context, scope string, hmacKey []byte) httplimit.KeyFunc {
+// IPAddressKeyFunc uses the client IP to rate limit. trustedProxies is the
+// number of proxies in front of the server, used to find the client IP.
+func IPAddressKeyFunc(ctx context.Context, scope string, hmacKey []byte, trustedProxies int) httplimit.KeyFunc {
 	return func(r *http.Request) (string, error) {
 		ctx := r.Context()
 
 		logger := logging.FromContext(ctx).Named("ratelimit.IPAddressKeyFunc")
 
-		// Get the remote addr
-		ip := remoteIP(r)
+		ip := controller.ClientIP(r, trustedProxies)
 
 		logger.Debugw("limiting by ip", "ip", ip)
 		dig, err := digest.HMAC(ip, hmacKey)
@@ -221,21 +289,6 @@ func IPAddressKeyFunc(ctx context.Context, scope string, hmacKey []byte) httplim
 	}
 }
 
-// remoteIP returns the "real" remote IP.
-func remoteIP(r *http.Request) string {
-	// Get the remote addr
-	ip := r.RemoteAddr
-
-	// Check if x-forwarded-for exists, the load balancer sets this, and the
-	// first entry is the real client IP
-	xff := r.Header.Get("x-forwarded-for")
-	if xff != "" {
-		ip = strings.Split(xff, ",")[0]
-	}
-
-	return ip
-}
-
 // realmIDFromAPIKey extracts the realmID from the provided API key, handling v1
 // and v2 API key formats.
 func realmIDFromAPIKey(db *database.Database, apiKey string) uint64 {
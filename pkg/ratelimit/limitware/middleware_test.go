@@ -0,0 +1,164 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limitware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+	"github.com/sethvargo/go-limiter/httplimit"
+)
+
+func TestMiddleware_Handle(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name         string
+		store        *testStore
+		keyErr       bool
+		allowOnError bool
+		expCode      int
+		expHeaders   bool
+	}{
+		{
+			name:       "allowed",
+			store:      &testStore{remaining: 1},
+			expCode:    http.StatusOK,
+			expHeaders: true,
+		},
+		{
+			name:       "exhausted",
+			store:      &testStore{remaining: 0},
+			expCode:    http.StatusTooManyRequests,
+			expHeaders: true,
+		},
+		{
+			name:    "key_error",
+			store:   &testStore{remaining: 1},
+			keyErr:  true,
+			expCode: http.StatusInternalServerError,
+		},
+		{
+			name:    "store_error_fail_closed",
+			store:   &testStore{err: errors.New("connection refused")},
+			expCode: http.StatusInternalServerError,
+		},
+		{
+			name:         "store_error_fail_open",
+			store:        &testStore{err: errors.New("connection refused")},
+			allowOnError: true,
+			expCode:      http.StatusOK,
+		},
+		{
+			name:         "exhausted_fail_open",
+			store:        &testStore{remaining: 0},
+			allowOnError: true,
+			expCode:      http.StatusTooManyRequests,
+			expHeaders:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			keyFunc := func(r *http.Request) (string, error) {
+				if tc.keyErr {
+					return "", errors.New("no key")
+				}
+				return "key", nil
+			}
+
+			m, err := NewMiddleware(ctx, tc.store, keyFunc, AllowOnError(tc.allowOnError))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got, want := w.Code, tc.expCode; got != want {
+				t.Errorf("expected %d to be %d", got, want)
+			}
+			if got := w.Header().Get(httplimit.HeaderRateLimitRemaining) != ""; got != tc.expHeaders {
+				t.Errorf("expected rate limit headers to be %t, got %v", tc.expHeaders, w.Header())
+			}
+			if got, want := w.Header().Get(httplimit.HeaderRetryAfter) != "", tc.expCode == http.StatusTooManyRequests; got != want {
+				t.Errorf("expected retry-after to be %t, got %v", want, w.Header())
+			}
+		})
+	}
+}
+
+func TestNewMiddleware(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	keyFunc := func(r *http.Request) (string, error) { return "key", nil }
+
+	if _, err := NewMiddleware(ctx, nil, keyFunc); err == nil {
+		t.Errorf("expected error for nil store")
+	}
+	if _, err := NewMiddleware(ctx, &testStore{}, nil); err == nil {
+		t.Errorf("expected error for nil key func")
+	}
+}
+
+var _ limiter.Store = (*testStore)(nil)
+
+// testStore is a limiter.Store with a single bucket of 10 tokens.
+type testStore struct {
+	remaining uint64
+	err       error
+}
+
+func (s *testStore) Take(_ context.Context, _ string) (uint64, uint64, uint64, bool, error) {
+	if s.err != nil {
+		return 0, 0, 0, false, s.err
+	}
+	reset := uint64(time.Now().Add(time.Minute).UnixNano())
+	if s.remaining == 0 {
+		return 10, 0, reset, false, nil
+	}
+	return 10, s.remaining - 1, reset, true, nil
+}
+
+func (s *testStore) Get(_ context.Context, _ string) (uint64, uint64, error) {
+	return 10, s.remaining, s.err
+}
+
+func (s *testStore) Set(_ context.Context, _ string, _ uint64, _ time.Duration) error {
+	return s.err
+}
+
+func (s *testStore) Burst(_ context.Context, _ string, _ uint64) error {
+	return s.err
+}
+
+func (s *testStore) Close(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const (
+	metricPrefix         = observability.MetricRoot + "/ratelimit/store"
+	adaptiveMetricPrefix = observability.MetricRoot + "/ratelimit/adaptive"
+	concurrencyPrefix    = observability.MetricRoot + "/ratelimit/concurrency"
+)
+
+var (
+	mLatencyMs = stats.Float64(metricPrefix+"/latency", "latency of limiter store operations", stats.UnitMilliseconds)
+	mErrors    = stats.Int64(metricPrefix+"/errors", "limiter store operation errors", stats.UnitDimensionless)
+	mKeys      = stats.Int64(metricPrefix+"/keys", "approximate number of active limiter keys", stats.UnitDimensionless)
+
+	mAdaptiveFactor = stats.Float64(adaptiveMetricPrefix+"/factor", "factor applied to rate limits", stats.UnitDimensionless)
+	mAdaptiveLimit  = stats.Int64(adaptiveMetricPrefix+"/limit", "effective default rate limit", stats.UnitDimensionless)
+
+	mConcurrencyInflight = stats.Int64(concurrencyPrefix+"/inflight", "requests in flight per key", stats.UnitDimensionless)
+
+	// operationTagKey is the store operation (take, get, set, burst).
+	operationTagKey = tag.MustNewKey("operation")
+
+	// storeTypeTagKey is the type of store (NOOP, MEMORY, REDIS).
+	storeTypeTagKey = tag.MustNewKey("store_type")
+
+	// concurrencyKeyTagKey is the key being limited, usually an authorized app
+	// ID.
+	concurrencyKeyTagKey = tag.MustNewKey("key")
+)
+
+func init() {
+	tagKeys := append(observability.CommonTagKeys(), storeTypeTagKey)
+
+	enobservability.CollectViews([]*view.View{
+		{
+			Name:        metricPrefix + "/latency",
+			Measure:     mLatencyMs,
+			Aggregation: view.Distribution(0.5, 1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000),
+			TagKeys:     append(tagKeys, operationTagKey, observability.ResultTagKey),
+		},
+		{
+			Name:        metricPrefix + "/error_count",
+			Measure:     mErrors,
+			Aggregation: view.Count(),
+			TagKeys:     append(tagKeys, operationTagKey),
+		},
+		{
+			Name:        metricPrefix + "/keys_latest",
+			Measure:     mKeys,
+			Aggregation: view.LastValue(),
+			TagKeys:     tagKeys,
+		},
+		{
+			Name:        adaptiveMetricPrefix + "/factor_latest",
+			Measure:     mAdaptiveFactor,
+			Aggregation: view.LastValue(),
+			TagKeys:     observability.CommonTagKeys(),
+		},
+		{
+			Name:        adaptiveMetricPrefix + "/limit_latest",
+			Measure:     mAdaptiveLimit,
+			Aggregation: view.LastValue(),
+			TagKeys:     observability.CommonTagKeys(),
+		},
+		{
+			Name:        concurrencyPrefix + "/inflight_latest",
+			Measure:     mConcurrencyInflight,
+			Aggregation: view.LastValue(),
+			TagKeys:     append(observability.CommonTagKeys(), concurrencyKeyTagKey),
+		},
+	}...)
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	redigo "github.com/opencensus-integrations/redigo/redis"
+	"github.com/sethvargo/go-limiter"
+)
+
+// bucketScript configures and takes from a bucket in one step. It uses the same
+// hash fields as the redisstore take script, so buckets it creates can be read,
+// burst, and taken from by the underlying store as usual.
+//
+// ARGV is the current time and interval in nanoseconds, the token limit,
+// whether to recreate a bucket with a different limit, and whether to take a
+// token. It returns the limit, remaining tokens, next reset in nanoseconds, and
+// whether a token was taken.
+var bucketScript = redigo.NewScript(1, `
+local key         = KEYS[1]
+local now         = tonumber(ARGV[1])
+local interval    = tonumber(ARGV[2])
+local maxtokens   = tonumber(ARGV[3])
+local reconfigure = ARGV[4] == '1'
+local take        = ARGV[5] == '1'
+
+-- ttl matches the redisstore script, 3x the interval in seconds.
+local ttl = function (interval)
+  return math.max(1, 3 * math.floor(interval / 1000000000))
+end
+
+local current = tonumber(redis.call('HGET', key, 'm'))
+if current == nil or (reconfigure and current ~= maxtokens) then
+  redis.call('DEL', key)
+  redis.call('HSET', key, 's', now, 't', 0, 'i', interval, 'm', maxtokens, 'k', maxtokens)
+  redis.call('EXPIRE', key, ttl(interval))
+  current = maxtokens
+end
+
+if not take then
+  return {current, 0, 0, 0}
+end
+
+local data = redis.call('HMGET', key, 's', 't', 'i', 'k')
+local start = tonumber(data[1]) or now
+local lasttick = tonumber(data[2]) or 0
+interval = tonumber(data[3]) or interval
+local tokens = tonumber(data[4]) or current
+
+local currtick = math.floor((now - start) / interval)
+if currtick < 0 then
+  currtick = 0
+end
+local nexttime = start + ((currtick + 1) * interval)
+
+if lasttick < currtick then
+  tokens = current
+  lasttick = currtick
+end
+
+local ok = 0
+if tokens > 0 then
+  tokens = tokens - 1
+  ok = 1
+end
+
+redis.call('HSET', key, 's', start, 't', lasttick, 'i', interval, 'k', tokens)
+redis.call('EXPIRE', key, ttl(interval))
+return {current, tokens, nexttime, ok}
+`)
+
+var (
+	_ limiter.Store = (*redisBucketStore)(nil)
+	_ BucketStore   = (*redisBucketStore)(nil)
+)
+
+// redisBucketStore adds atomic bucket configuration to a redisstore which uses
+// the same pool.
+type redisBucketStore struct {
+	limiter.Store
+	pool *redigo.Pool
+}
+
+// TakeBucket implements BucketStore.
+func (s *redisBucketStore) TakeBucket(ctx context.Context, key string, tokens uint64, interval time.Duration, reconfigure bool) (uint64, uint64, uint64, bool, error) {
+	result, err := s.run(ctx, key, tokens, interval, reconfigure, true)
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+	return uint64(result[0]), uint64(result[1]), uint64(result[2]), result[3] == 1, nil
+}
+
+// EnsureBucket implements BucketStore.
+func (s *redisBucketStore) EnsureBucket(ctx context.Context, key string, tokens uint64, interval time.Duration) error {
+	_, err := s.run(ctx, key, tokens, interval, false, false)
+	return err
+}
+
+func (s *redisBucketStore) run(ctx context.Context, key string, tokens uint64, interval time.Duration, reconfigure, take bool) (result []int64, retErr error) {
+	conn, ok := s.pool.GetWithContext(ctx).(redigo.ConnWithContext)
+	if !ok {
+		return nil, fmt.Errorf("pool is not a ConnWithContext")
+	}
+	if err := conn.Err(); err != nil {
+		return nil, fmt.Errorf("connection is not usable: %w", err)
+	}
+	defer func() {
+		if err := conn.CloseContext(ctx); err != nil && retErr == nil {
+			retErr = fmt.Errorf("failed to close connection: %w", err)
+		}
+	}()
+
+	result, err := redigo.Int64s(bucketScript.DoContext(ctx, conn, key,
+		strconv.FormatInt(time.Now().UTC().UnixNano(), 10),
+		strconv.FormatInt(interval.Nanoseconds(), 10),
+		strconv.FormatUint(tokens, 10),
+		boolArg(reconfigure),
+		boolArg(take),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run bucket script: %w", err)
+	}
+	if len(result) < 4 {
+		return nil, fmt.Errorf("bucket script returned %d values, expected 4", len(result))
+	}
+	return result, nil
+}
+
+func boolArg(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest"
+	"github.com/sethvargo/go-retry"
+)
+
+func TestRedisBucketStore(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skipf("🚧 Skipping redis tests (short)!")
+	}
+
+	if skip, _ := strconv.ParseBool(os.Getenv("SKIP_REDIS_TESTS")); skip {
+		t.Skipf("🚧 Skipping redis tests (SKIP_REDIS_TESTS is set)!")
+	}
+
+	ctx := context.Background()
+
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redisImageRef := os.Getenv("CI_REDIS_IMAGE")
+	if redisImageRef == "" {
+		redisImageRef = "redis:6-alpine"
+	}
+	parts := strings.SplitN(redisImageRef, ":", 2)
+	if len(parts) != 2 {
+		t.Fatalf("invalid redis ref %v", redisImageRef)
+	}
+
+	container, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: parts[0],
+		Tag:        parts[1],
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := pool.Purge(container); err != nil {
+			t.Errorf("failed to cleanup redis container: %v", err)
+		}
+	})
+
+	config := &Config{
+		Type:     RateLimiterTypeRedis,
+		Tokens:   1,
+		Interval: time.Minute,
+	}
+	config.Redis.Host = container.GetBoundIP("6379/tcp")
+	config.Redis.Port = container.GetPort("6379/tcp")
+
+	store, err := newRedisStore(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := store.Close(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// Wait for the container to be ready.
+	b, err := retry.NewFibonacci(500 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = retry.WithMaxRetries(5, b)
+	b = retry.WithCappedDuration(2*time.Second, b)
+	if err := retry.Do(ctx, b, func(_ context.Context) error {
+		if _, _, err := store.Get(ctx, healthKey); err != nil {
+			return retry.RetryableError(err)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.(BucketStore); !ok {
+		t.Fatalf("expected %T to be a BucketStore", store)
+	}
+
+	// New buckets use the given limit instead of the store's default.
+	for i, exp := range []uint64{2, 1, 0} {
+		limit, remaining, _, ok, err := TakeBucket(ctx, store, "day", 3, time.Hour, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || limit != 3 || remaining != exp {
+			t.Errorf("take %d: expected take from 3 tokens with %d remaining, got %t, %d, %d", i, exp, ok, limit, remaining)
+		}
+	}
+	if _, _, _, ok, err := TakeBucket(ctx, store, "day", 3, time.Hour, false); err != nil || ok {
+		t.Errorf("expected exhausted bucket to reject, got %t, %v", ok, err)
+	}
+
+	// Bursts and the store's own takes work on the configured bucket.
+	if err := store.Burst(ctx, "day", 1); err != nil {
+		t.Fatal(err)
+	}
+	if limit, remaining, _, ok, err := store.Take(ctx, "day"); err != nil {
+		t.Fatal(err)
+	} else if !ok || limit != 3 || remaining != 0 {
+		t.Errorf("expected burst token to be taken, got %t, %d, %d", ok, limit, remaining)
+	}
+
+	// Reconfiguring with a new limit recreates the bucket.
+	if limit, remaining, _, ok, err := TakeBucket(ctx, store, "day", 5, time.Hour, true); err != nil {
+		t.Fatal(err)
+	} else if !ok || limit != 5 || remaining != 4 {
+		t.Errorf("expected take from 5 tokens with 4 remaining, got %t, %d, %d", ok, limit, remaining)
+	}
+
+	// Ensuring an existing bucket keeps its remaining tokens.
+	if err := EnsureBucket(ctx, store, "day", 10, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if limit, remaining, err := store.Get(ctx, "day"); err != nil {
+		t.Fatal(err)
+	} else if limit != 5 || remaining != 4 {
+		t.Errorf("expected 5 tokens with 4 remaining, got %d with %d remaining", limit, remaining)
+	}
+
+	// A rejected window refunds the windows before it.
+	minute := &Window{Name: "minute", Interval: time.Minute, Limit: 5}
+	hour := &Window{Name: "hour", Interval: time.Hour, Limit: 1}
+	windows := []*Window{minute, hour}
+	if err := TakeWindows(ctx, store, "realm", windows); err != nil {
+		t.Fatal(err)
+	}
+	var werr *WindowExceededError
+	if err := TakeWindows(ctx, store, "realm", windows); !errors.As(err, &werr) {
+		t.Fatalf("expected WindowExceededError, got %v", err)
+	}
+	if _, remaining, err := store.Get(ctx, minute.Key("realm")); err != nil {
+		t.Fatal(err)
+	} else if remaining != 4 {
+		t.Errorf("expected %d per-minute tokens to remain, got %d", 4, remaining)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sethvargo/go-limiter"
+)
+
+// Window is a limit on the number of tokens which can be taken during an
+// interval, such as 10 per minute.
+type Window struct {
+	// Name identifies the window in keys and error messages, for example
+	// "minute".
+	Name string
+
+	// Interval is the length of the window.
+	Interval time.Duration
+
+	// Limit is the number of tokens available in each interval.
+	Limit uint64
+}
+
+// String returns a description of the window, like "10 per minute".
+func (w *Window) String() string {
+	return fmt.Sprintf("%d per %s", w.Limit, w.Name)
+}
+
+// Key returns the store key for the window under the given base key.
+func (w *Window) Key(base string) string {
+	return base + ":" + w.Name
+}
+
+// WindowExceededError is returned by TakeWindows when a window has no tokens
+// remaining.
+type WindowExceededError struct {
+	Window *Window
+
+	// Reset is when tokens are next available in the window.
+	Reset time.Time
+}
+
+// Error implements error.
+func (e *WindowExceededError) Error() string {
+	return fmt.Sprintf("exceeded limit of %s, retry after %s", e.Window, e.Reset.UTC().Format(time.RFC3339))
+}
+
+// TakeWindows takes a token from each window under the base key. Windows are
+// checked in order, so they should be ordered from shortest to longest; the
+// first window without any tokens remaining is returned as a
+// *WindowExceededError. Tokens already taken from earlier windows are refunded,
+// so a rejected request is not charged against any window.
+//
+// Each window is configured and taken from atomically with TakeBucket. A window
+// whose bucket was created with a different limit is recreated, which means
+// changing a limit gives the realm a fresh window.
+func TakeWindows(ctx context.Context, store limiter.Store, base string, windows []*Window) error {
+	for i, w := range windows {
+		_, _, reset, ok, err := TakeBucket(ctx, store, w.Key(base), w.Limit, w.Interval, true)
+		if err != nil {
+			err = fmt.Errorf("failed to take from %s window: %w", w.Name, err)
+		} else if !ok {
+			err = &WindowExceededError{
+				Window: w,
+				Reset:  time.Unix(0, int64(reset)),
+			}
+		}
+
+		if err != nil {
+			if rerr := RefundWindows(ctx, store, base, windows[:i]); rerr != nil {
+				return fmt.Errorf("%w, and %v", err, rerr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// refundWindows returns the token taken from each of the windows.
+func RefundWindows(ctx context.Context, store limiter.Store, base string, windows []*Window) error {
+	for _, w := range windows {
+		if err := store.Burst(ctx, w.Key(base), 1); err != nil {
+			return fmt.Errorf("failed to refund %s window: %w", w.Name, err)
+		}
+	}
+	return nil
+}
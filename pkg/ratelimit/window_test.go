@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTakeWindows(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	store := &fakeStore{buckets: make(map[string]*fakeBucket)}
+
+	minute := &Window{Name: "minute", Interval: time.Minute, Limit: 2}
+	day := &Window{Name: "day", Interval: 24 * time.Hour, Limit: 3}
+	windows := []*Window{minute, day}
+
+	for i := 0; i < 2; i++ {
+		if err := TakeWindows(ctx, store, "realm", windows); err != nil {
+			t.Fatalf("take %d: %v", i, err)
+		}
+	}
+
+	// The per-minute window is exhausted and the daily window is not charged.
+	err := TakeWindows(ctx, store, "realm", windows)
+	var werr *WindowExceededError
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected WindowExceededError, got %v", err)
+	}
+	if werr.Window != minute {
+		t.Errorf("expected %s to be breached, got %s", minute, werr.Window)
+	}
+	if _, remaining, err := store.Get(ctx, day.Key("realm")); err != nil {
+		t.Fatal(err)
+	} else if remaining != 1 {
+		t.Errorf("expected %d daily tokens to remain, got %d", 1, remaining)
+	}
+
+	// Raising the per-minute limit reconfigures that window, and the daily
+	// window is breached next.
+	minute.Limit = 10
+	if err := TakeWindows(ctx, store, "realm", windows); err != nil {
+		t.Fatal(err)
+	}
+	err = TakeWindows(ctx, store, "realm", windows)
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected WindowExceededError, got %v", err)
+	}
+	if werr.Window != day {
+		t.Errorf("expected %s to be breached, got %s", day, werr.Window)
+	}
+	if got, want := werr.Error(), "exceeded limit of 3 per day"; len(got) < len(want) || got[:len(want)] != want {
+		t.Errorf("expected %q to start with %q", got, want)
+	}
+}
+
+func TestTakeWindows_Refund(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &fakeStore{buckets: make(map[string]*fakeBucket)}
+
+	minute := &Window{Name: "minute", Interval: time.Minute, Limit: 5}
+	day := &Window{Name: "day", Interval: 24 * time.Hour, Limit: 1}
+	windows := []*Window{minute, day}
+
+	if err := TakeWindows(ctx, store, "realm", windows); err != nil {
+		t.Fatal(err)
+	}
+
+	// The daily window rejects the request, so the per-minute token taken for
+	// it is refunded.
+	for i := 0; i < 3; i++ {
+		var werr *WindowExceededError
+		if err := TakeWindows(ctx, store, "realm", windows); !errors.As(err, &werr) {
+			t.Fatalf("take %d: expected WindowExceededError, got %v", i, err)
+		}
+	}
+	if _, remaining, err := store.Get(ctx, minute.Key("realm")); err != nil {
+		t.Fatal(err)
+	} else if remaining != 4 {
+		t.Errorf("expected %d per-minute tokens to remain, got %d", 4, remaining)
+	}
+}
+
+func TestTakeBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &fakeStore{buckets: make(map[string]*fakeBucket)}
+
+	limit, remaining, _, ok, err := TakeBucket(ctx, store, "realm", 3, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || limit != 3 || remaining != 2 {
+		t.Errorf("expected take from 3 tokens with 2 remaining, got %t, %d, %d", ok, limit, remaining)
+	}
+
+	// A different limit is ignored unless the bucket is reconfigured.
+	if _, remaining, _, _, err := TakeBucket(ctx, store, "realm", 10, time.Hour, false); err != nil {
+		t.Fatal(err)
+	} else if remaining != 1 {
+		t.Errorf("expected %d tokens to remain, got %d", 1, remaining)
+	}
+	if limit, remaining, _, _, err := TakeBucket(ctx, store, "realm", 10, time.Hour, true); err != nil {
+		t.Fatal(err)
+	} else if limit != 10 || remaining != 9 {
+		t.Errorf("expected 10 tokens with 9 remaining, got %d with %d remaining", limit, remaining)
+	}
+
+	// Stores which configure buckets themselves are used directly.
+	bs := &fakeBucketStore{fakeStore: store}
+	if _, _, _, _, err := TakeBucket(ctx, bs, "other", 1, time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureBucket(ctx, bs, "other", 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bs.calls, []string{"take other", "ensure other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+// fakeBucketStore records calls to its BucketStore methods.
+type fakeBucketStore struct {
+	*fakeStore
+	calls []string
+}
+
+func (s *fakeBucketStore) TakeBucket(_ context.Context, key string, tokens uint64, _ time.Duration, _ bool) (uint64, uint64, uint64, bool, error) {
+	s.calls = append(s.calls, "take "+key)
+	return tokens, tokens - 1, 0, true, nil
+}
+
+func (s *fakeBucketStore) EnsureBucket(_ context.Context, key string, _ uint64, _ time.Duration) error {
+	s.calls = append(s.calls, "ensure "+key)
+	return nil
+}
+
+func TestEnsureBucket(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	store := &fakeStore{buckets: make(map[string]*fakeBucket)}
+
+	if err := EnsureBucket(ctx, store, "realm:2020-11-01", 2, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, ok, err := store.Take(ctx, "realm:2020-11-01"); err != nil || !ok {
+		t.Fatalf("expected take to succeed, got %t, %v", ok, err)
+	}
+
+	// An existing bucket keeps its remaining tokens, even if the limit differs.
+	if err := EnsureBucket(ctx, store, "realm:2020-11-01", 10, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if limit, remaining, err := store.Get(ctx, "realm:2020-11-01"); err != nil {
+		t.Fatal(err)
+	} else if limit != 2 || remaining != 1 {
+		t.Errorf("expected 2 tokens with 1 remaining, got %d with %d remaining", limit, remaining)
+	}
+}
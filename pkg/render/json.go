@@ -100,6 +100,42 @@ func (r *Renderer) RenderJSON(w http.ResponseWriter, code int, data interface{})
 	}
 }
 
+// RenderSignedJSON is like RenderJSON, but passes the encoded body to sign and
+// sets the result in the given response header, so clients can verify the body
+// they received. If signing fails, a generic 500 JSON response is returned.
+func (r *Renderer) RenderSignedJSON(w http.ResponseWriter, code int, data interface{}, header string, sign func([]byte) (string, error)) {
+	if !r.AllowedResponseCode(code) || data == nil {
+		r.RenderJSON(w, code, data)
+		return
+	}
+
+	// Acquire a renderer
+	b := r.rendererPool.Get().(*bytes.Buffer)
+	b.Reset()
+	defer r.rendererPool.Put(b)
+
+	// Render into the renderer
+	if err := json.NewEncoder(b).Encode(data); err != nil {
+		r.JSON500(w, err)
+		return
+	}
+
+	sig, err := sign(b.Bytes())
+	if err != nil {
+		r.logger.Errorw("failed to sign json response", "error", err)
+		r.JSON500(w, err)
+		return
+	}
+
+	// Rendering and signing worked, flush to the response
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(header, sig)
+	w.WriteHeader(code)
+	if _, err := b.WriteTo(w); err != nil {
+		r.logger.Errorw("failed to write json to response", "error", err)
+	}
+}
+
 // JSON500 renders the given error as JSON. In production mode, this always
 // renders a generic "server error" message. In debug, it returns the actual
 // error from the caller.
@@ -25,6 +25,7 @@ import (
 	"strings"
 	"sync"
 	texttemplate "text/template"
+	"time"
 
 	"github.com/google/exposure-notifications-server/pkg/logging"
 	"github.com/google/exposure-notifications-verification-server/internal/project"
@@ -38,8 +39,10 @@ import (
 // bad status code.
 var allowedResponseCodes = map[int]struct{}{
 	200: {},
+	201: {}, // SCIM create
 	400: {},
 	401: {},
+	403: {}, // request-level restrictions like impersonation
 	404: {},
 	405: {},
 	409: {},
@@ -47,6 +50,8 @@ var allowedResponseCodes = map[int]struct{}{
 	413: {},
 	429: {},
 	500: {},
+	501: {}, // SCIM unsupported operations
+	504: {}, // database query timeout
 }
 
 // Renderer is responsible for rendering various content and templates like HTML
@@ -167,6 +172,21 @@ func translate(l *gotext.Locale, key string, vars ...interface{}) (string, error
 	return v, nil
 }
 
+// inTimezone returns the time in the given location. If the location is nil,
+// the time is returned in UTC.
+func inTimezone(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc)
+}
+
+// formatTime formats the time in the given location using the provided layout.
+// If the location is nil, the time is formatted in UTC.
+func formatTime(t time.Time, loc *time.Location, layout string) string {
+	return inTimezone(t, loc).Format(layout)
+}
+
 func templateFuncs() htmltemplate.FuncMap {
 	return map[string]interface{}{
 		"joinStrings":      strings.Join,
@@ -178,6 +198,8 @@ func templateFuncs() htmltemplate.FuncMap {
 		"selectedIf":       selectedIf,
 		"t":                translate,
 		"passwordSentinel": pwdSentinel,
+		"inTimezone":       inTimezone,
+		"formatTime":       formatTime,
 	}
 }
 
@@ -0,0 +1,191 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package selftest issues, claims, and verifies a throwaway verification code
+// to check that the database and signing keys work before serving traffic.
+package selftest
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"time"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/api"
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+	"github.com/google/exposure-notifications-verification-server/pkg/jwthelper"
+	"github.com/google/exposure-notifications-verification-server/pkg/otp"
+
+	verifyapi "github.com/google/exposure-notifications-server/pkg/api/v1"
+	"github.com/google/exposure-notifications-server/pkg/keys"
+	"github.com/google/exposure-notifications-server/pkg/logging"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// codeLength and longCodeLength are the lengths of the throwaway codes.
+	codeLength     = 8
+	longCodeLength = 16
+
+	// codeTTL is how long the throwaway code and token are valid. They are
+	// deleted when the self-test finishes, but expire quickly in case the
+	// deletion fails.
+	codeTTL = 5 * time.Minute
+
+	// collisionRetryCount is the number of times to retry code generation.
+	collisionRetryCount = 6
+
+	// externalID marks codes issued by the self-test.
+	externalID = "startup-self-test"
+)
+
+// Config is the configuration for the self-test.
+type Config struct {
+	// RealmName is the name of the sentinel realm in which the throwaway code is
+	// issued. The realm is created if it does not exist.
+	RealmName string
+
+	// TokenIssuer is the issuer and audience of the token.
+	TokenIssuer string
+
+	// TokenKeyID and TokenKey are the "kid" and key reference of the active
+	// token signing key.
+	TokenKeyID string
+	TokenKey   string
+}
+
+// Run issues a code in the sentinel realm, claims it, signs the token, and
+// verifies and claims the token, logging the result of each step. The code and
+// token are deleted afterwards. It returns an error if any step fails.
+func Run(ctx context.Context, db *database.Database, kms keys.KeyManager, cfg *Config) (retErr error) {
+	logger := logging.FromContext(ctx).Named("selftest.Run")
+
+	step := func(name string, err error) error {
+		if err != nil {
+			logger.Errorw("self-test step failed", "step", name, "error", err)
+			return fmt.Errorf("failed to %s: %w", name, err)
+		}
+		logger.Infow("self-test step passed", "step", name)
+		return nil
+	}
+
+	// Find or create the sentinel realm.
+	realm, err := db.FindRealmByName(cfg.RealmName)
+	if database.IsNotFound(err) {
+		realm, err = db.CreateRealm(cfg.RealmName)
+	}
+	if err := step("find sentinel realm", err); err != nil {
+		return err
+	}
+
+	// Issue the code.
+	now := time.Now().UTC()
+	code, _, _, err := (&otp.Request{
+		DB:                db,
+		RealmID:           realm.ID,
+		ShortLength:       codeLength,
+		ShortExpiresAt:    now.Add(codeTTL),
+		LongLength:        longCodeLength,
+		LongExpiresAt:     now.Add(codeTTL),
+		TestType:          api.TestTypeConfirmed,
+		IssuingExternalID: externalID,
+	}).Issue(ctx, collisionRetryCount)
+	if err := step("issue code", err); err != nil {
+		return err
+	}
+	defer func() {
+		if err := step("delete code", db.DeleteVerificationCode(code)); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	// Claim the code.
+	accept := api.AcceptTypes{}
+	accept.AddAcceptTypes(api.TestTypeConfirmed)
+	token, err := db.VerifyCodeAndIssueToken(ctx, &database.IssueTokenRequest{
+		RealmID:          realm.ID,
+		VerificationCode: code,
+		AcceptTypes:      accept,
+		ExpireAfter:      codeTTL,
+	})
+	if err := step("claim code", err); err != nil {
+		return err
+	}
+	defer func() {
+		if err := step("delete token", db.DeleteToken(token.TokenID)); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+
+	// Sign the token.
+	signer, err := kms.NewSigner(ctx, cfg.TokenKey)
+	if err := step("get token signer", err); err != nil {
+		return err
+	}
+
+	subject := token.Subject()
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodES256, &jwt.StandardClaims{
+		Audience:  cfg.TokenIssuer,
+		ExpiresAt: token.ExpiresAt.Unix(),
+		Id:        token.TokenID,
+		IssuedAt:  now.Unix(),
+		Issuer:    cfg.TokenIssuer,
+		Subject:   subject.String(),
+	})
+	jwtToken.Header[verifyapi.KeyIDHeader] = cfg.TokenKeyID
+	signedJWT, err := jwthelper.SignJWT(jwtToken, signer)
+	if err := step("sign token", err); err != nil {
+		return err
+	}
+
+	// Verify the token, as the certificate API does.
+	claims, err := verifyToken(signedJWT, cfg, signer.Public())
+	if err := step("verify token", err); err != nil {
+		return err
+	}
+
+	parsedSubject, err := database.ParseSubject(claims.Subject)
+	if err == nil {
+		err = db.ClaimToken(ctx, realm.ID, claims.Id, parsedSubject, "")
+	}
+	if err := step("claim token", err); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// verifyToken parses the signed token and checks its signature, "kid", issuer,
+// and audience.
+func verifyToken(signedJWT string, cfg *Config, publicKey crypto.PublicKey) (*jwt.StandardClaims, error) {
+	token, err := jwt.ParseWithClaims(signedJWT, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if kid, _ := token.Header[verifyapi.KeyIDHeader].(string); kid != cfg.TokenKeyID {
+			return nil, fmt.Errorf("unexpected kid %q", kid)
+		}
+		return publicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*jwt.StandardClaims)
+	if !ok {
+		return nil, fmt.Errorf("unexpected claims type %T", token.Claims)
+	}
+	if !claims.VerifyIssuer(cfg.TokenIssuer, true) || !claims.VerifyAudience(cfg.TokenIssuer, true) {
+		return nil, fmt.Errorf("invalid iss %q or aud %q", claims.Issuer, claims.Audience)
+	}
+	return claims, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package selftest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/exposure-notifications-verification-server/pkg/database"
+
+	"github.com/google/exposure-notifications-server/pkg/keys"
+)
+
+var testDatabaseInstance *database.TestInstance
+
+func TestMain(m *testing.M) {
+	testDatabaseInstance = database.MustTestInstance()
+	defer testDatabaseInstance.MustClose()
+	m.Run()
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _ := testDatabaseInstance.NewDatabase(t, nil)
+
+	kms := keys.TestKeyManager(t)
+	keyRef := keys.TestSigningKey(t, kms)
+
+	cfg := &Config{
+		RealmName:   "Startup self-test",
+		TokenIssuer: "test-issuer",
+		TokenKeyID:  "v1",
+		TokenKey:    keyRef,
+	}
+
+	// Run twice to check the sentinel realm is reused.
+	for i := 0; i < 2; i++ {
+		if err := Run(ctx, db, kms, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	realm, err := db.FindRealmByName(cfg.RealmName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The code and token are cleaned up.
+	count, err := realm.CountActiveCodes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expected no codes, got %d", count)
+	}
+
+	// A broken signing key fails the self-test.
+	cfg.TokenKey = "does-not-exist"
+	if err := Run(ctx, db, kms, cfg); err == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -148,6 +148,11 @@ func NewIntegrationTestConfig(ctx context.Context, tb testing.TB) (*IntegrationT
 			APIKeyCacheDuration: APIKeyCacheDuration,
 			CollisionRetryCount: 6,
 			AllowedSymptomAge:   time.Hour * 336,
+			IssueLimits: config.IssueLimitConfig{
+				MaxMetadataKeys:     10,
+				MaxMetadataBytes:    1024,
+				MaxExternalIDLength: 255,
+			},
 		},
 	}
 
@@ -276,7 +281,7 @@ func (s *IntegrationSuite) newAdminAPIServer(ctx context.Context, tb testing.TB)
 		tb.Fatalf("failed to create the limit store %v", err)
 	}
 
-	adminRouter.Handle("/health", controller.HandleHealthz(ctx, &s.cfg.AdminAPISrvConfig.Database, h)).Methods("GET")
+	adminRouter.Handle("/health", controller.HandleHealthz(ctx, &s.cfg.AdminAPISrvConfig.Database, limiterStore, h)).Methods("GET")
 
 	{
 		sub := adminRouter.PathPrefix("/api").Subrouter()
@@ -341,11 +346,17 @@ func (s *IntegrationSuite) newAPIServer(ctx context.Context, tb testing.TB) *ser
 		tb.Fatalf("failed to create certificate key manager: %v", err)
 	}
 
+	// Create LimitStore
+	limiterStore, err := ratelimit.RateLimiterFor(ctx, &s.cfg.APISrvConfig.RateLimit)
+	if err != nil {
+		tb.Fatalf("failed to create the limit store %v", err)
+	}
+
 	apiRouter := mux.NewRouter()
 	// Install common security headers
 	apiRouter.Use(middleware.SecureHeaders(s.cfg.APISrvConfig.DevMode, "json"))
 
-	apiRouter.Handle("/health", controller.HandleHealthz(ctx, &s.cfg.APISrvConfig.Database, h)).Methods("GET")
+	apiRouter.Handle("/health", controller.HandleHealthz(ctx, &s.cfg.APISrvConfig.Database, nil, h)).Methods("GET")
 
 	{
 		sub := apiRouter.PathPrefix("/api").Subrouter()
@@ -359,7 +370,7 @@ func (s *IntegrationSuite) newAPIServer(ctx context.Context, tb testing.TB) *ser
 
 		verifyChaff := chaff.New()
 		defer verifyChaff.Close()
-		verifyapiController, err := verifyapi.New(ctx, &s.cfg.APISrvConfig, s.db, h, tokenSigner)
+		verifyapiController, err := verifyapi.New(ctx, &s.cfg.APISrvConfig, s.db, limiterStore, h, tokenSigner)
 		if err != nil {
 			tb.Fatalf("failed to create verify api controller: %v", err)
 		}
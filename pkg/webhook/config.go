@@ -0,0 +1,76 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"time"
+)
+
+// Config represents configuration for delivering webhooks.
+type Config struct {
+	// Enabled allows realm admins to configure webhooks and delivers events to
+	// them. It must be set on every service which issues, claims, or expires
+	// codes.
+	Enabled bool `env:"WEBHOOK_ENABLED"`
+
+	// BatchSize is the number of due deliveries claimed from the database at a
+	// time. Another batch is claimed as soon as a full batch is attempted.
+	BatchSize int `env:"WEBHOOK_BATCH_SIZE, default=100"`
+
+	// PollInterval is how often the database is checked for due deliveries,
+	// such as retries. New events are claimed without waiting for the poll.
+	PollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL, default=1s"`
+
+	// LeaseDuration is how long claimed deliveries are hidden from other
+	// instances. It must be longer than it takes to attempt a batch. A delivery
+	// which is not finished before its lease expires, for example because the
+	// instance stopped, is claimed and sent again.
+	LeaseDuration time.Duration `env:"WEBHOOK_LEASE_DURATION, default=5m"`
+
+	// Timeout is the maximum time to spend on a single delivery attempt.
+	Timeout time.Duration `env:"WEBHOOK_TIMEOUT, default=10s"`
+
+	// Workers is the number of deliveries attempted at the same time.
+	Workers int `env:"WEBHOOK_WORKERS, default=4"`
+
+	// MaxInFlight is the maximum number of requests to a single endpoint at the
+	// same time. Other deliveries to the endpoint wait for a slot.
+	MaxInFlight int `env:"WEBHOOK_MAX_IN_FLIGHT, default=2"`
+
+	// MaxAttempts is the number of times a delivery is attempted before the
+	// event is dead-lettered. Network errors, 408, 429, and 5xx responses are
+	// retried; other responses are dead-lettered immediately.
+	MaxAttempts int `env:"WEBHOOK_MAX_ATTEMPTS, default=5"`
+
+	// BackoffBase and BackoffMax bound the exponential backoff between
+	// attempts. The delay doubles with each attempt, up to BackoffMax, and a
+	// random jitter of up to half the delay is subtracted.
+	BackoffBase time.Duration `env:"WEBHOOK_BACKOFF_BASE, default=500ms"`
+	BackoffMax  time.Duration `env:"WEBHOOK_BACKOFF_MAX, default=30s"`
+
+	// BreakerThreshold is the number of consecutive failed attempts which open
+	// an endpoint's circuit breaker. While it is open, events for the endpoint
+	// are dead-lettered without a request. After BreakerCooldown, a single
+	// attempt is allowed through, and the breaker closes if it succeeds. A
+	// threshold of 0 disables the breaker.
+	BreakerThreshold int           `env:"WEBHOOK_BREAKER_THRESHOLD, default=5"`
+	BreakerCooldown  time.Duration `env:"WEBHOOK_BREAKER_COOLDOWN, default=1m"`
+
+	// AllowLocalhost permits webhook URLs which use plain http to a loopback
+	// address. It is intended for development only. Private and internal
+	// addresses are always rejected, both when a webhook is saved and when a
+	// delivery connects.
+	AllowLocalhost bool `env:"WEBHOOK_ALLOW_LOCALHOST"`
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	enobservability "github.com/google/exposure-notifications-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const metricPrefix = observability.MetricRoot + "/webhook"
+
+var (
+	mDelivered    = stats.Int64(metricPrefix+"/delivered", "webhook events delivered", stats.UnitDimensionless)
+	mRetried      = stats.Int64(metricPrefix+"/retried", "webhook delivery attempts which are retried", stats.UnitDimensionless)
+	mDeadLettered = stats.Int64(metricPrefix+"/dead_lettered", "webhook events which are not delivered", stats.UnitDimensionless)
+	mLatencyMs    = stats.Float64(metricPrefix+"/latency", "latency of webhook delivery attempts", stats.UnitMilliseconds)
+
+	// eventTypeTagKey is the event type (issued, claimed, expired).
+	eventTypeTagKey = tag.MustNewKey("event_type")
+
+	// reasonTagKey is why an event was dead-lettered, such as the status code
+	// or the breaker being open.
+	reasonTagKey = tag.MustNewKey("reason")
+)
+
+func init() {
+	tagKeys := append(observability.CommonTagKeys(), eventTypeTagKey)
+
+	enobservability.CollectViews([]*view.View{
+		{
+			Name:        metricPrefix + "/delivered_count",
+			Measure:     mDelivered,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+		{
+			Name:        metricPrefix + "/retried_count",
+			Measure:     mRetried,
+			Aggregation: view.Count(),
+			TagKeys:     tagKeys,
+		},
+		{
+			Name:        metricPrefix + "/dead_lettered_count",
+			Measure:     mDeadLettered,
+			Aggregation: view.Count(),
+			TagKeys:     append(tagKeys, reasonTagKey),
+		},
+		{
+			Name:        metricPrefix + "/latency",
+			Measure:     mLatencyMs,
+			Aggregation: view.Distribution(10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000),
+			TagKeys:     append(tagKeys, observability.ResultTagKey),
+		},
+	}...)
+}
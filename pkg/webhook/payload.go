@@ -0,0 +1,115 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LatestPayloadVersion is the newest payload schema. New webhooks use it
+// unless they pin an older version.
+const LatestPayloadVersion uint = 2
+
+// PayloadVersions are the supported payload schema versions, oldest first.
+var PayloadVersions = []uint{1, 2}
+
+// serializers encode an event in each payload schema version. Once a version
+// is released its output must never change, so receivers which pin it keep
+// working. Schema changes go in a new version.
+var serializers = map[uint]func(e *Event) ([]byte, error){
+	1: marshalV1,
+	2: marshalV2,
+}
+
+// ValidPayloadVersion returns true if v is a supported payload version.
+func ValidPayloadVersion(v uint) bool {
+	_, ok := serializers[v]
+	return ok
+}
+
+// Marshal encodes the event in the given payload version.
+func Marshal(e *Event, version uint) ([]byte, error) {
+	fn, ok := serializers[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown payload version %d", version)
+	}
+	return fn(e)
+}
+
+// payloadV1 is a flat object with the code fields at the top level.
+type payloadV1 struct {
+	Version     uint      `json:"version"`
+	Type        EventType `json:"type"`
+	RealmID     uint      `json:"realmID"`
+	UUID        string    `json:"uuid"`
+	TestType    string    `json:"testType"`
+	SymptomDate string    `json:"symptomDate,omitempty"`
+	TestDate    string    `json:"testDate,omitempty"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func marshalV1(e *Event) ([]byte, error) {
+	return json.Marshal(&payloadV1{
+		Version:     1,
+		Type:        e.Type,
+		RealmID:     e.RealmID,
+		UUID:        e.UUID,
+		TestType:    e.TestType,
+		SymptomDate: e.SymptomDate,
+		TestDate:    e.TestDate,
+		IssuedAt:    e.IssuedAt,
+		ExpiresAt:   e.ExpiresAt,
+		Timestamp:   e.Timestamp,
+	})
+}
+
+// payloadV2 separates the event envelope from the code it describes.
+type payloadV2 struct {
+	Version   uint          `json:"version"`
+	Type      EventType     `json:"type"`
+	RealmID   uint          `json:"realmID"`
+	Timestamp time.Time     `json:"timestamp"`
+	Code      payloadV2Code `json:"code"`
+}
+
+type payloadV2Code struct {
+	UUID        string    `json:"uuid"`
+	TestType    string    `json:"testType"`
+	SymptomDate string    `json:"symptomDate,omitempty"`
+	TestDate    string    `json:"testDate,omitempty"`
+	IssuedAt    time.Time `json:"issuedAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+func marshalV2(e *Event) ([]byte, error) {
+	return json.Marshal(&payloadV2{
+		Version:   2,
+		Type:      e.Type,
+		RealmID:   e.RealmID,
+		Timestamp: e.Timestamp,
+		Code: payloadV2Code{
+			UUID:        e.UUID,
+			TestType:    e.TestType,
+			SymptomDate: e.SymptomDate,
+			TestDate:    e.TestDate,
+			IssuedAt:    e.IssuedAt,
+			ExpiresAt:   e.ExpiresAt,
+		},
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+
+	issuedAt := time.Date(2020, 11, 2, 10, 0, 0, 0, time.UTC)
+	e := &Event{
+		Type:        EventClaimed,
+		RealmID:     3,
+		UUID:        "5148c75c-2bc5-4874-9d1c-f9185a0e1b8a",
+		TestType:    "confirmed",
+		SymptomDate: "2020-11-01",
+		IssuedAt:    issuedAt,
+		ExpiresAt:   issuedAt.Add(time.Hour),
+		Timestamp:   issuedAt.Add(5 * time.Minute),
+	}
+
+	// The output of released versions must never change.
+	cases := []struct {
+		version uint
+		exp     string
+		err     bool
+	}{
+		{
+			version: 1,
+			exp: `{"version":1,"type":"claimed","realmID":3,"uuid":"5148c75c-2bc5-4874-9d1c-f9185a0e1b8a",` +
+				`"testType":"confirmed","symptomDate":"2020-11-01","issuedAt":"2020-11-02T10:00:00Z",` +
+				`"expiresAt":"2020-11-02T11:00:00Z","timestamp":"2020-11-02T10:05:00Z"}`,
+		},
+		{
+			version: 2,
+			exp: `{"version":2,"type":"claimed","realmID":3,"timestamp":"2020-11-02T10:05:00Z",` +
+				`"code":{"uuid":"5148c75c-2bc5-4874-9d1c-f9185a0e1b8a","testType":"confirmed",` +
+				`"symptomDate":"2020-11-01","issuedAt":"2020-11-02T10:00:00Z","expiresAt":"2020-11-02T11:00:00Z"}}`,
+		},
+		{
+			version: 0,
+			err:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		got, err := Marshal(e, tc.version)
+		if (err != nil) != tc.err {
+			t.Errorf("version %d: expected error to be %t, got %v", tc.version, tc.err, err)
+			continue
+		}
+		if got, want := string(got), tc.exp; got != want {
+			t.Errorf("version %d: expected %s to be %s", tc.version, got, want)
+		}
+	}
+}
+
+func TestPayloadVersions(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range PayloadVersions {
+		if !ValidPayloadVersion(v) {
+			t.Errorf("expected version %d to have a serializer", v)
+		}
+	}
+	if got, want := PayloadVersions[len(PayloadVersions)-1], LatestPayloadVersion; got != want {
+		t.Errorf("expected newest version %d to be %d", got, want)
+	}
+	if got, want := len(serializers), len(PayloadVersions); got != want {
+		t.Errorf("expected %d serializers to be %d", got, want)
+	}
+}
@@ -0,0 +1,573 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package webhook delivers code lifecycle events to the HTTPS endpoints
+// configured by each realm. Every delivery is signed with the endpoint's
+// secret so the receiver can verify it came from this server.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/exposure-notifications-server/pkg/logging"
+	"github.com/google/exposure-notifications-verification-server/pkg/observability"
+	"github.com/google/exposure-notifications-verification-server/pkg/outbound"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.uber.org/zap"
+)
+
+const (
+	// HeaderEvent is the header which contains the event type.
+	HeaderEvent = "X-Webhook-Event"
+
+	// HeaderVersion is the header which contains the payload version.
+	HeaderVersion = "X-Webhook-Version"
+
+	// HeaderSignature is the header which contains the hex-encoded
+	// HMAC-SHA256 of the payload version, a period, and the request body,
+	// keyed with the endpoint's secret and prefixed with "sha256=".
+	HeaderSignature = "X-Webhook-Signature"
+
+	// HeaderDelivery is the header which contains the delivery ID. A delivery
+	// can be sent more than once, for example if the server stops while it is
+	// in flight, so receivers can use it to ignore duplicates.
+	HeaderDelivery = "X-Webhook-Delivery"
+)
+
+// EventType is the kind of event.
+type EventType string
+
+const (
+	EventIssued  EventType = "issued"
+	EventClaimed EventType = "claimed"
+	EventExpired EventType = "expired"
+)
+
+// EventTypes are all the event types, in the order they are displayed.
+var EventTypes = []EventType{EventIssued, EventClaimed, EventExpired}
+
+// ValidEventType returns true if s is a known event type.
+func ValidEventType(s string) bool {
+	for _, t := range EventTypes {
+		if string(t) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change to a verification code. It never contains the code itself.
+// Dates are formatted as YYYY-MM-DD. Events are encoded with the serializer for
+// each endpoint's payload version.
+type Event struct {
+	Type        EventType
+	RealmID     uint
+	UUID        string
+	TestType    string
+	SymptomDate string
+	TestDate    string
+	IssuedAt    time.Time
+	ExpiresAt   time.Time
+	Timestamp   time.Time
+}
+
+// Endpoint is a realm's webhook endpoint.
+type Endpoint struct {
+	ID             uint
+	URL            string
+	Secret         string
+	Events         []EventType
+	PayloadVersion uint
+}
+
+// Subscribed returns true if the endpoint subscribes to the event type.
+func (e *Endpoint) Subscribed(t EventType) bool {
+	for _, v := range e.Events {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// EndpointLister lists the webhook endpoints for a realm.
+type EndpointLister interface {
+	ListWebhookEndpoints(realmID uint) ([]*Endpoint, error)
+}
+
+// Delivery is an event queued for delivery to one endpoint.
+type Delivery struct {
+	ID        uint
+	WebhookID uint
+	Attempts  int
+	Event     *Event
+}
+
+// Store lists endpoints and persists deliveries until they succeed or are
+// dead-lettered, so queued events and retries are not lost when the server
+// restarts.
+type Store interface {
+	EndpointLister
+
+	// ClaimWebhookDeliveries returns up to limit deliveries which are due and
+	// leases them until the given time, so that other dispatchers do not claim
+	// them while they are being attempted.
+	ClaimWebhookDeliveries(limit int, until time.Time) ([]*Delivery, error)
+
+	// RescheduleWebhookDelivery sets the number of attempts made and the time
+	// of the next attempt.
+	RescheduleWebhookDelivery(id uint, attempts int, at time.Time) error
+
+	// DeleteWebhookDelivery removes a delivery which succeeded or was
+	// dead-lettered.
+	DeleteWebhookDelivery(id uint) error
+}
+
+// Sign returns the value of the signature header for body. The payload version
+// is signed along with the body, so a payload cannot be replayed as another
+// version.
+func Sign(secret string, version uint, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatUint(uint64(version), 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers the events queued in the store in the background. It
+// claims due deliveries in batches, so several dispatchers can share a store.
+// Failed attempts are rescheduled with backoff, and each endpoint has its own
+// concurrency limit and circuit breaker, so a slow or failing endpoint does not
+// hold up the others.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	logger *zap.SugaredLogger
+	config *Config
+
+	lock     sync.Mutex
+	slots    map[uint]chan struct{}
+	breakers map[uint]*breaker
+
+	wakeCh   chan struct{}
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDispatcher creates a dispatcher which delivers the deliveries queued in
+// store and starts it in the background.
+func NewDispatcher(ctx context.Context, store Store, c *Config) (*Dispatcher, error) {
+	if store == nil {
+		return nil, fmt.Errorf("store cannot be nil")
+	}
+	if c.BatchSize < 1 {
+		return nil, fmt.Errorf("WEBHOOK_BATCH_SIZE must be positive")
+	}
+	if c.PollInterval <= 0 {
+		return nil, fmt.Errorf("WEBHOOK_POLL_INTERVAL must be positive")
+	}
+	if c.LeaseDuration <= c.Timeout {
+		return nil, fmt.Errorf("WEBHOOK_LEASE_DURATION must be longer than WEBHOOK_TIMEOUT")
+	}
+	if c.Workers < 1 {
+		return nil, fmt.Errorf("WEBHOOK_WORKERS must be positive")
+	}
+	if c.MaxInFlight < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_IN_FLIGHT must be positive")
+	}
+	if c.MaxAttempts < 1 {
+		return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be positive")
+	}
+
+	d := &Dispatcher{
+		store:    store,
+		client:   outbound.NewHTTPClient(c.Timeout, c.AllowLocalhost),
+		logger:   logging.FromContext(ctx).Named("webhook"),
+		config:   c,
+		slots:    make(map[uint]chan struct{}),
+		breakers: make(map[uint]*breaker),
+		wakeCh:   make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+	}
+	go d.run()
+	return d, nil
+}
+
+// Notify wakes the dispatcher to claim deliveries which were just queued,
+// instead of waiting for the next poll. It is safe to call after Close.
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops claiming deliveries and waits for the attempts in flight to
+// finish. Claimed deliveries which were not attempted yet are released, so
+// that another dispatcher, or this one after a restart, delivers them.
+func (d *Dispatcher) Close() error {
+	d.stopOnce.Do(func() {
+		close(d.stopCh)
+	})
+	<-d.doneCh
+	return nil
+}
+
+// run waits for the poll interval or Notify and then delivers batches until
+// there are no more due deliveries, until the dispatcher is closed.
+func (d *Dispatcher) run() {
+	defer close(d.doneCh)
+
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+		case <-d.wakeCh:
+		}
+
+		for d.dispatchBatch() >= d.config.BatchSize {
+			if d.stopped() {
+				return
+			}
+		}
+	}
+}
+
+// dispatchBatch claims a batch of due deliveries and attempts them, up to
+// Workers at the same time. It returns the number of deliveries claimed.
+func (d *Dispatcher) dispatchBatch() int {
+	deliveries, err := d.store.ClaimWebhookDeliveries(d.config.BatchSize, time.Now().Add(d.config.LeaseDuration))
+	if err != nil {
+		d.logger.Errorw("failed to claim webhook deliveries", "error", err)
+		return 0
+	}
+
+	workers := make(chan struct{}, d.config.Workers)
+	var wg sync.WaitGroup
+	for _, dl := range deliveries {
+		if d.stopped() {
+			d.release(dl)
+			continue
+		}
+
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(dl *Delivery) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			d.deliver(dl)
+		}(dl)
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+// deliver makes one attempt at the delivery, encoded in the endpoint's payload
+// version. The delivery is deleted if it succeeds, if it fails with an error
+// which should not be retried, or if it runs out of attempts. Otherwise it is
+// rescheduled with backoff. Deliveries for an endpoint whose breaker is open are
+// dead-lettered without a request.
+func (d *Dispatcher) deliver(dl *Delivery) {
+	e := dl.Event
+
+	ep, err := d.endpointFor(e.RealmID, dl.WebhookID)
+	if err != nil {
+		// The delivery is claimed again once its lease expires.
+		d.logger.Errorw("failed to list webhook endpoints",
+			"realmID", e.RealmID,
+			"error", err)
+		return
+	}
+	if ep == nil || !ep.Subscribed(e.Type) {
+		// The webhook was deleted or no longer subscribes to the event.
+		d.delete(dl)
+		return
+	}
+
+	body, err := Marshal(e, ep.PayloadVersion)
+	if err != nil {
+		d.deadLetter(dl, "MARSHAL_FAILED", err)
+		return
+	}
+
+	br := d.breakerFor(ep.ID)
+	if !br.allow(time.Now()) {
+		d.deadLetter(dl, "BREAKER_OPEN", fmt.Errorf("circuit breaker is open"))
+		return
+	}
+
+	attempt := dl.Attempts + 1
+	err = d.attempt(ep, dl, body)
+	br.record(time.Now(), err == nil)
+	if err == nil {
+		d.record(e, mDelivered.M(1))
+		d.delete(dl)
+		return
+	}
+
+	dl.Attempts = attempt
+	if !retryable(err) {
+		d.deadLetter(dl, reason(err), err)
+		return
+	}
+	if attempt >= d.config.MaxAttempts {
+		d.deadLetter(dl, "MAX_ATTEMPTS", err)
+		return
+	}
+
+	d.logger.Warnw("retrying webhook delivery",
+		"deliveryID", dl.ID,
+		"webhookID", dl.WebhookID,
+		"type", e.Type,
+		"realmID", e.RealmID,
+		"attempt", attempt,
+		"error", err)
+	d.record(e, mRetried.M(1))
+
+	next := time.Now().Add(backoff(d.config.BackoffBase, d.config.BackoffMax, attempt))
+	if err := d.store.RescheduleWebhookDelivery(dl.ID, attempt, next); err != nil {
+		d.logger.Errorw("failed to reschedule webhook delivery",
+			"deliveryID", dl.ID,
+			"error", err)
+	}
+}
+
+// endpointFor returns the realm's endpoint with the given ID, or nil if the
+// realm has no such endpoint.
+func (d *Dispatcher) endpointFor(realmID, id uint) (*Endpoint, error) {
+	endpoints, err := d.store.ListWebhookEndpoints(realmID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ep := range endpoints {
+		if ep.ID == id {
+			return ep, nil
+		}
+	}
+	return nil, nil
+}
+
+// attempt makes a single request once the endpoint has a free slot. Any 2xx
+// response is a success. Redirects are not followed.
+func (d *Dispatcher) attempt(ep *Endpoint, dl *Delivery, body []byte) (retErr error) {
+	slots := d.slotsFor(ep.ID)
+	slots <- struct{}{}
+	defer func() { <-slots }()
+
+	ctx := context.Background()
+	if d.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.config.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	defer func() {
+		result := observability.ResultOK()
+		if retErr != nil {
+			result = observability.ResultError(reason(retErr))
+		}
+		d.record(dl.Event, mLatencyMs.M(float64(time.Since(start).Microseconds())/1000), result)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return &deliveryError{err: fmt.Errorf("failed to build request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, string(dl.Event.Type))
+	req.Header.Set(HeaderVersion, strconv.FormatUint(uint64(ep.PayloadVersion), 10))
+	req.Header.Set(HeaderSignature, Sign(ep.Secret, ep.PayloadVersion, body))
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(dl.ID), 10))
+
+	// The client refuses to connect to internal addresses, even if the host
+	// resolves to one after the webhook was saved. That will not change on a
+	// retry.
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return &deliveryError{
+			err:   fmt.Errorf("failed to send request: %w", err),
+			retry: !errors.Is(err, outbound.ErrPrivateAddress),
+		}
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if code := resp.StatusCode; code < 200 || code > 299 {
+		return &deliveryError{
+			err:    fmt.Errorf("endpoint returned %d", code),
+			status: code,
+			retry:  code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500,
+		}
+	}
+	return nil
+}
+
+// deadLetter logs, counts, and deletes a delivery which could not be made.
+func (d *Dispatcher) deadLetter(dl *Delivery, why string, err error) {
+	d.logger.Errorw("failed to deliver webhook",
+		"deliveryID", dl.ID,
+		"webhookID", dl.WebhookID,
+		"type", dl.Event.Type,
+		"realmID", dl.Event.RealmID,
+		"attempts", dl.Attempts,
+		"reason", why,
+		"error", err)
+	d.record(dl.Event, mDeadLettered.M(1), tag.Upsert(reasonTagKey, why))
+	d.delete(dl)
+}
+
+// delete removes the delivery from the store. If that fails, the delivery is
+// claimed again once its lease expires.
+func (d *Dispatcher) delete(dl *Delivery) {
+	if err := d.store.DeleteWebhookDelivery(dl.ID); err != nil {
+		d.logger.Errorw("failed to delete webhook delivery",
+			"deliveryID", dl.ID,
+			"error", err)
+	}
+}
+
+// release makes a claimed delivery due again without counting an attempt.
+func (d *Dispatcher) release(dl *Delivery) {
+	if err := d.store.RescheduleWebhookDelivery(dl.ID, dl.Attempts, time.Now()); err != nil {
+		d.logger.Errorw("failed to release webhook delivery",
+			"deliveryID", dl.ID,
+			"error", err)
+	}
+}
+
+// stopped returns true if the dispatcher is closing.
+func (d *Dispatcher) stopped() bool {
+	select {
+	case <-d.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// record records the measurement, tagged with the event's realm and type.
+func (d *Dispatcher) record(e *Event, m stats.Measurement, mutators ...tag.Mutator) {
+	ctx := observability.WithRealmID(observability.WithBuildInfo(context.Background()), e.RealmID)
+	mutators = append(mutators, tag.Upsert(eventTypeTagKey, string(e.Type)))
+	if err := stats.RecordWithTags(ctx, mutators, m); err != nil {
+		d.logger.Warnw("failed to record webhook metric", "error", err)
+	}
+}
+
+// slotsFor returns the semaphore which limits the requests in flight to the
+// endpoint.
+func (d *Dispatcher) slotsFor(id uint) chan struct{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	slots, ok := d.slots[id]
+	if !ok {
+		slots = make(chan struct{}, d.config.MaxInFlight)
+		d.slots[id] = slots
+	}
+	return slots
+}
+
+// breakerFor returns the endpoint's circuit breaker.
+func (d *Dispatcher) breakerFor(id uint) *breaker {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	br, ok := d.breakers[id]
+	if !ok {
+		br = newBreaker(d.config.BreakerThreshold, d.config.BreakerCooldown)
+		d.breakers[id] = br
+	}
+	return br
+}
+
+// deliveryError is a failed delivery attempt.
+type deliveryError struct {
+	err    error
+	status int
+	retry  bool
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+// retryable returns true if the attempt may succeed if it is retried.
+func retryable(err error) bool {
+	var derr *deliveryError
+	return errors.As(err, &derr) && derr.retry
+}
+
+// reason returns a short description of the error for metrics.
+func reason(err error) string {
+	var derr *deliveryError
+	if errors.As(err, &derr) && derr.status != 0 {
+		return fmt.Sprintf("HTTP_%d", derr.status)
+	}
+	if errors.Is(err, outbound.ErrPrivateAddress) {
+		return "PRIVATE_ADDRESS"
+	}
+	return "REQUEST_FAILED"
+}
+
+// backoff returns the delay before the next attempt. The delay doubles with
+// each attempt up to max, and up to half of it is removed at random so that
+// retries to the same endpoint are spread out.
+func backoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	delay := max
+	if shift := uint(attempt - 1); shift < 32 {
+		if d := base << shift; d > 0 && d < max {
+			delay = d
+		}
+	}
+	if delay <= 1 {
+		return delay
+	}
+
+	half := delay / 2
+	return delay - time.Duration(rand.Int63n(int64(half)))
+}
@@ -0,0 +1,747 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStore is an in-memory Store.
+type testStore struct {
+	endpoints map[uint][]*Endpoint
+
+	mu         sync.Mutex
+	lastID     uint
+	deliveries map[uint]*testDelivery
+}
+
+type testDelivery struct {
+	Delivery
+	at time.Time
+}
+
+func newTestStore(endpoints map[uint][]*Endpoint) *testStore {
+	return &testStore{
+		endpoints:  endpoints,
+		deliveries: make(map[uint]*testDelivery),
+	}
+}
+
+func (s *testStore) ListWebhookEndpoints(realmID uint) ([]*Endpoint, error) {
+	return s.endpoints[realmID], nil
+}
+
+func (s *testStore) ClaimWebhookDeliveries(limit int, until time.Time) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]uint, 0, len(s.deliveries))
+	for id, dl := range s.deliveries {
+		if !dl.at.After(time.Now()) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	claimed := make([]*Delivery, 0, len(ids))
+	for _, id := range ids {
+		dl := s.deliveries[id]
+		dl.at = until
+		cp := dl.Delivery
+		claimed = append(claimed, &cp)
+	}
+	return claimed, nil
+}
+
+func (s *testStore) RescheduleWebhookDelivery(id uint, attempts int, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dl, ok := s.deliveries[id]; ok {
+		dl.Attempts = attempts
+		dl.at = at
+	}
+	return nil
+}
+
+func (s *testStore) DeleteWebhookDelivery(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.deliveries, id)
+	return nil
+}
+
+// enqueue queues the event for every endpoint in the realm, including those
+// which do not subscribe to it, so the dispatcher's filtering is tested.
+func (s *testStore) enqueue(e *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ep := range s.endpoints[e.RealmID] {
+		s.lastID++
+		s.deliveries[s.lastID] = &testDelivery{
+			Delivery: Delivery{ID: s.lastID, WebhookID: ep.ID, Event: e},
+			at:       time.Now(),
+		}
+	}
+}
+
+// pending returns the deliveries which are still queued.
+func (s *testStore) pending() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make([]Delivery, 0, len(s.deliveries))
+	for _, dl := range s.deliveries {
+		pending = append(pending, dl.Delivery)
+	}
+	return pending
+}
+
+// testReceiver records the deliveries made to each path.
+type testReceiver struct {
+	mu        sync.Mutex
+	delivered map[string][]*http.Request
+	bodies    map[string][][]byte
+}
+
+func newTestReceiver(tb testing.TB) (*testReceiver, *httptest.Server) {
+	tb.Helper()
+
+	rcv := &testReceiver{
+		delivered: make(map[string][]*http.Request),
+		bodies:    make(map[string][][]byte),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			tb.Error(err)
+		}
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+		rcv.delivered[r.URL.Path] = append(rcv.delivered[r.URL.Path], r)
+		rcv.bodies[r.URL.Path] = append(rcv.bodies[r.URL.Path], b)
+	}))
+	tb.Cleanup(srv.Close)
+	return rcv, srv
+}
+
+// dispatchAll starts a dispatcher for the store and waits for the queued
+// deliveries to be delivered or dead-lettered.
+func dispatchAll(tb testing.TB, store *testStore, c *Config) {
+	tb.Helper()
+
+	d, err := NewDispatcher(context.Background(), store, c)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	d.Notify()
+
+	waitFor(tb, func() bool {
+		return len(store.pending()) == 0
+	})
+	if err := d.Close(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestDispatcher_Filtering(t *testing.T) {
+	t.Parallel()
+
+	rcv, srv := newTestReceiver(t)
+
+	store := newTestStore(map[uint][]*Endpoint{
+		1: {
+			{ID: 1, URL: srv.URL + "/issued", Secret: "secret-1", Events: []EventType{EventIssued}, PayloadVersion: 2},
+			{ID: 2, URL: srv.URL + "/claimed", Secret: "secret-2", Events: []EventType{EventClaimed, EventExpired}, PayloadVersion: 1},
+			{ID: 3, URL: srv.URL + "/all", Secret: "secret-3", Events: EventTypes, PayloadVersion: 2},
+			{ID: 4, URL: srv.URL + "/unknown-version", Secret: "secret-4", Events: EventTypes, PayloadVersion: 99},
+		},
+		2: {
+			{ID: 5, URL: srv.URL + "/other-realm", Secret: "secret-5", Events: EventTypes, PayloadVersion: 2},
+		},
+	})
+	store.enqueue(&Event{Type: EventIssued, RealmID: 1, UUID: "a"})
+	store.enqueue(&Event{Type: EventClaimed, RealmID: 1, UUID: "a"})
+	store.enqueue(&Event{Type: EventExpired, RealmID: 1, UUID: "b"})
+
+	// A single worker delivers the events in order.
+	c := testConfig()
+	c.Workers = 1
+	dispatchAll(t, store, c)
+
+	cases := []struct {
+		path    string
+		secret  string
+		version uint
+		exp     []EventType
+	}{
+		{path: "/issued", secret: "secret-1", version: 2, exp: []EventType{EventIssued}},
+		{path: "/claimed", secret: "secret-2", version: 1, exp: []EventType{EventClaimed, EventExpired}},
+		{path: "/all", secret: "secret-3", version: 2, exp: []EventType{EventIssued, EventClaimed, EventExpired}},
+		{path: "/unknown-version", exp: nil},
+		{path: "/other-realm", exp: nil},
+	}
+
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	for _, tc := range cases {
+		reqs, bodies := rcv.delivered[tc.path], rcv.bodies[tc.path]
+		if got, want := len(reqs), len(tc.exp); got != want {
+			t.Errorf("%s: expected %d deliveries to be %d", tc.path, got, want)
+			continue
+		}
+
+		for i, r := range reqs {
+			if got, want := r.Header.Get(HeaderEvent), string(tc.exp[i]); got != want {
+				t.Errorf("%s: expected event header %q to be %q", tc.path, got, want)
+			}
+			if got, want := r.Header.Get(HeaderVersion), fmt.Sprintf("%d", tc.version); got != want {
+				t.Errorf("%s: expected version header %q to be %q", tc.path, got, want)
+			}
+			if got, want := r.Header.Get(HeaderSignature), Sign(tc.secret, tc.version, bodies[i]); got != want {
+				t.Errorf("%s: expected signature %q to be %q", tc.path, got, want)
+			}
+
+			id := r.Header.Get(HeaderDelivery)
+			if _, ok := seen[id]; ok || id == "" {
+				t.Errorf("%s: expected unique delivery header, got %q", tc.path, id)
+			}
+			seen[id] = struct{}{}
+
+			var payload struct {
+				Version uint      `json:"version"`
+				Type    EventType `json:"type"`
+			}
+			if err := json.Unmarshal(bodies[i], &payload); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := payload.Version, tc.version; got != want {
+				t.Errorf("%s: expected version %d to be %d", tc.path, got, want)
+			}
+			if got, want := payload.Type, tc.exp[i]; got != want {
+				t.Errorf("%s: expected type %q to be %q", tc.path, got, want)
+			}
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"type":"issued"}`)
+
+	a, b := Sign("secret", 1, body), Sign("secret", 1, body)
+	if a != b {
+		t.Errorf("expected stable signature, got %q and %q", a, b)
+	}
+	if got, want := a[:7], "sha256="; got != want {
+		t.Errorf("expected prefix %q to be %q", got, want)
+	}
+	if Sign("other", 1, body) == a {
+		t.Errorf("expected signature to depend on the secret")
+	}
+	if Sign("secret", 2, body) == a {
+		t.Errorf("expected signature to depend on the version")
+	}
+	if Sign("secret", 1, []byte(`{"type":"claimed"}`)) == a {
+		t.Errorf("expected signature to depend on the body")
+	}
+}
+
+func TestNewDispatcher(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		store  Store
+		mutate func(c *Config)
+		err    bool
+	}{
+		{
+			name:   "valid",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) {},
+		},
+		{
+			name:   "no_store",
+			mutate: func(c *Config) {},
+			err:    true,
+		},
+		{
+			name:   "no_batch",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) { c.BatchSize = 0 },
+			err:    true,
+		},
+		{
+			name:   "no_poll_interval",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) { c.PollInterval = 0 },
+			err:    true,
+		},
+		{
+			name:   "lease_shorter_than_timeout",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) { c.Timeout = 2 * c.LeaseDuration },
+			err:    true,
+		},
+		{
+			name:   "no_workers",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) { c.Workers = 0 },
+			err:    true,
+		},
+		{
+			name:   "no_in_flight",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) { c.MaxInFlight = 0 },
+			err:    true,
+		},
+		{
+			name:   "no_attempts",
+			store:  newTestStore(nil),
+			mutate: func(c *Config) { c.MaxAttempts = 0 },
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := testConfig()
+			tc.mutate(c)
+
+			d, err := NewDispatcher(context.Background(), tc.store, c)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if d != nil {
+				if err := d.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	t.Parallel()
+
+	d, err := NewDispatcher(context.Background(), newTestStore(nil), testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Notifying and closing again after Close are no-ops.
+	d.Notify()
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		statuses    []int
+		maxAttempts int
+		expAttempts int32
+	}{
+		{
+			name:        "success",
+			statuses:    []int{200},
+			maxAttempts: 3,
+			expAttempts: 1,
+		},
+		{
+			name:        "retries_then_succeeds",
+			statuses:    []int{503, 429, 202},
+			maxAttempts: 5,
+			expAttempts: 3,
+		},
+		{
+			name:        "dead_letters_after_max_attempts",
+			statuses:    []int{500, 500, 500, 500, 500},
+			maxAttempts: 3,
+			expAttempts: 3,
+		},
+		{
+			name:        "does_not_retry_client_errors",
+			statuses:    []int{400},
+			maxAttempts: 5,
+			expAttempts: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tc.statuses[int(n)-1])
+			}))
+			t.Cleanup(srv.Close)
+
+			c := testConfig()
+			c.MaxAttempts = tc.maxAttempts
+			c.BreakerThreshold = 0
+
+			store := newTestStore(map[uint][]*Endpoint{
+				1: {{ID: 1, URL: srv.URL, Secret: "secret", Events: EventTypes, PayloadVersion: 2}},
+			})
+			store.enqueue(&Event{Type: EventIssued, RealmID: 1})
+
+			// The delivery is deleted once it succeeds or is dead-lettered.
+			dispatchAll(t, store, c)
+
+			if got, want := atomic.LoadInt32(&attempts), tc.expAttempts; got != want {
+				t.Errorf("expected %d attempts to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_Restart(t *testing.T) {
+	t.Parallel()
+
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	c := testConfig()
+	c.BackoffBase = 50 * time.Millisecond
+	c.BackoffMax = 50 * time.Millisecond
+
+	store := newTestStore(map[uint][]*Endpoint{
+		1: {{ID: 1, URL: srv.URL, Secret: "secret", Events: EventTypes, PayloadVersion: 2}},
+	})
+	store.enqueue(&Event{Type: EventClaimed, RealmID: 1})
+
+	// Stop the dispatcher after the first attempt fails.
+	d, err := NewDispatcher(context.Background(), store, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Notify()
+	waitFor(t, func() bool {
+		pending := store.pending()
+		return len(pending) == 1 && pending[0].Attempts == 1
+	})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry is kept in the store and delivered by the next dispatcher.
+	dispatchAll(t, store, c)
+
+	if got, want := atomic.LoadInt32(&attempts), int32(2); got != want {
+		t.Errorf("expected %d attempts to be %d", got, want)
+	}
+}
+
+func TestDispatcher_MaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	var inflight, maxInflight, delivered int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInflight, m, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&delivered, 1)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := testConfig()
+	c.Workers = 8
+	c.MaxInFlight = 2
+
+	store := newTestStore(map[uint][]*Endpoint{
+		1: {{ID: 1, URL: srv.URL, Secret: "secret", Events: EventTypes, PayloadVersion: 2}},
+	})
+	for i := 0; i < 10; i++ {
+		store.enqueue(&Event{Type: EventClaimed, RealmID: 1})
+	}
+	dispatchAll(t, store, c)
+
+	if got, want := atomic.LoadInt32(&delivered), int32(10); got != want {
+		t.Errorf("expected %d deliveries to be %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(&maxInflight), int32(c.MaxInFlight); got > want {
+		t.Errorf("expected at most %d requests in flight, got %d", want, got)
+	}
+}
+
+func TestDispatcher_Batches(t *testing.T) {
+	t.Parallel()
+
+	var delivered int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&delivered, 1)
+	}))
+	t.Cleanup(srv.Close)
+
+	// Full batches are followed immediately by the next one, so the deliveries
+	// do not wait for a poll.
+	c := testConfig()
+	c.BatchSize = 3
+	c.PollInterval = time.Hour
+
+	store := newTestStore(map[uint][]*Endpoint{
+		1: {{ID: 1, URL: srv.URL, Secret: "secret", Events: EventTypes, PayloadVersion: 2}},
+	})
+	for i := 0; i < 10; i++ {
+		store.enqueue(&Event{Type: EventIssued, RealmID: 1})
+	}
+	dispatchAll(t, store, c)
+
+	if got, want := atomic.LoadInt32(&delivered), int32(10); got != want {
+		t.Errorf("expected %d deliveries to be %d", got, want)
+	}
+}
+
+func TestDispatcher_Breaker(t *testing.T) {
+	t.Parallel()
+
+	var failing, healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/failing" {
+			atomic.AddInt32(&failing, 1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		atomic.AddInt32(&healthy, 1)
+	}))
+	t.Cleanup(srv.Close)
+
+	c := testConfig()
+	c.Workers = 1
+	c.MaxAttempts = 1
+	c.BreakerThreshold = 2
+	c.BreakerCooldown = time.Hour
+
+	store := newTestStore(map[uint][]*Endpoint{
+		1: {
+			{ID: 1, URL: srv.URL + "/failing", Secret: "secret", Events: EventTypes, PayloadVersion: 2},
+			{ID: 2, URL: srv.URL + "/healthy", Secret: "secret", Events: EventTypes, PayloadVersion: 2},
+		},
+	})
+	for i := 0; i < 5; i++ {
+		store.enqueue(&Event{Type: EventClaimed, RealmID: 1})
+	}
+	dispatchAll(t, store, c)
+
+	// The failing endpoint's breaker opens after two failures, and the other
+	// endpoint is unaffected.
+	if got, want := atomic.LoadInt32(&failing), int32(2); got != want {
+		t.Errorf("expected %d requests to the failing endpoint to be %d", got, want)
+	}
+	if got, want := atomic.LoadInt32(&healthy), int32(5); got != want {
+		t.Errorf("expected %d requests to the healthy endpoint to be %d", got, want)
+	}
+}
+
+func TestDispatcher_InternalAddresses(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		path           string
+		allowLocalhost bool
+		expRequests    int32
+	}{
+		{
+			name:        "rejects_loopback",
+			path:        "/target",
+			expRequests: 0,
+		},
+		{
+			name:           "does_not_follow_redirects",
+			path:           "/redirect",
+			allowLocalhost: true,
+			expRequests:    1,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				if r.URL.Path == "/redirect" {
+					http.Redirect(w, r, "/target", http.StatusFound)
+				}
+			}))
+			t.Cleanup(srv.Close)
+
+			c := testConfig()
+			c.AllowLocalhost = tc.allowLocalhost
+
+			store := newTestStore(map[uint][]*Endpoint{
+				1: {{ID: 1, URL: srv.URL + tc.path, Secret: "secret", Events: EventTypes, PayloadVersion: 2}},
+			})
+			store.enqueue(&Event{Type: EventIssued, RealmID: 1})
+			dispatchAll(t, store, c)
+
+			if got, want := atomic.LoadInt32(&requests), tc.expRequests; got != want {
+				t.Errorf("expected %d requests to be %d", got, want)
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	b := newBreaker(2, time.Minute)
+
+	b.record(now, false)
+	if !b.allow(now) {
+		t.Fatalf("expected breaker to be closed after one failure")
+	}
+
+	b.record(now, false)
+	if b.allow(now) {
+		t.Fatalf("expected breaker to open after two failures")
+	}
+
+	// After the cooldown, only one probe is allowed.
+	later := now.Add(2 * time.Minute)
+	if !b.allow(later) {
+		t.Fatalf("expected a probe after the cooldown")
+	}
+	if b.allow(later) {
+		t.Fatalf("expected only one probe")
+	}
+
+	// A failed probe opens the breaker again.
+	b.record(later, false)
+	if b.allow(later) {
+		t.Fatalf("expected breaker to reopen after a failed probe")
+	}
+
+	// A successful probe closes it.
+	latest := later.Add(2 * time.Minute)
+	if !b.allow(latest) {
+		t.Fatalf("expected a probe after the cooldown")
+	}
+	b.record(latest, true)
+	if !b.allow(latest) || !b.allow(latest) {
+		t.Errorf("expected breaker to close after a successful probe")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	base, max := 100*time.Millisecond, time.Second
+
+	cases := []struct {
+		attempt int
+		exp     time.Duration
+	}{
+		{attempt: 1, exp: 100 * time.Millisecond},
+		{attempt: 2, exp: 200 * time.Millisecond},
+		{attempt: 4, exp: 800 * time.Millisecond},
+		{attempt: 5, exp: time.Second},
+		{attempt: 100, exp: time.Second},
+	}
+
+	for _, tc := range cases {
+		for i := 0; i < 100; i++ {
+			got := backoff(base, max, tc.attempt)
+			if got > tc.exp || got <= tc.exp/2 {
+				t.Fatalf("attempt %d: expected %s to be in (%s, %s]", tc.attempt, got, tc.exp/2, tc.exp)
+			}
+		}
+	}
+
+	if got := backoff(0, max, 3); got != 0 {
+		t.Errorf("expected no backoff without a base, got %s", got)
+	}
+}
+
+// waitFor waits up to a few seconds for fn to return true.
+func waitFor(tb testing.TB, fn func() bool) {
+	tb.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			tb.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testConfig() *Config {
+	return &Config{
+		BatchSize:        10,
+		PollInterval:     5 * time.Millisecond,
+		LeaseDuration:    time.Minute,
+		Workers:          2,
+		MaxInFlight:      2,
+		MaxAttempts:      3,
+		BackoffBase:      time.Millisecond,
+		BackoffMax:       5 * time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+		AllowLocalhost:   true,
+	}
+}
@@ -212,3 +212,30 @@ resource "google_cloud_scheduler_job" "cleanup-worker" {
     google_project_service.services["cloudscheduler.googleapis.com"],
   ]
 }
+
+resource "google_cloud_scheduler_job" "export-worker" {
+  name             = "export-worker"
+  region           = var.cloudscheduler_location
+  schedule         = "15 * * * *"
+  time_zone        = "Etc/UTC"
+  attempt_deadline = "600s"
+
+  retry_config {
+    retry_count = 1
+  }
+
+  http_target {
+    http_method = "GET"
+    uri         = "${google_cloud_run_service.cleanup.status.0.url}/exports"
+    oidc_token {
+      audience              = google_cloud_run_service.cleanup.status.0.url
+      service_account_email = google_service_account.cleanup-invoker.email
+    }
+  }
+
+  depends_on = [
+    google_app_engine_application.app,
+    google_cloud_run_service_iam_member.cleanup-invoker,
+    google_project_service.services["cloudscheduler.googleapis.com"],
+  ]
+}
@@ -20,7 +20,10 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
-	"math/rand"
+
+	// Seed data is not security sensitive, so it deliberately uses math/rand.
+	// Real codes are only ever generated with crypto/rand by the otp package.
+	mathrand "math/rand"
 	"os"
 	"strconv"
 	"time"
@@ -213,14 +216,14 @@ func realMain(ctx context.Context) error {
 	externalIDs := make([]string, 4)
 	for i := range externalIDs {
 		b := make([]byte, 8)
-		if _, err := rand.Read(b); err != nil {
+		if _, err := mathrand.Read(b); err != nil {
 			return fmt.Errorf("failed to read rand: %w", err)
 		}
 		externalIDs[i] = hex.EncodeToString(b)
 	}
 
 	for day := 1; day <= 30; day++ {
-		max := rand.Intn(50)
+		max := mathrand.Intn(50)
 		for i := 0; i < max; i++ {
 			date := now.Add(time.Duration(day) * -24 * time.Hour)
 
@@ -229,23 +232,23 @@ func realMain(ctx context.Context) error {
 			issuingExternalID := ""
 
 			// Random determine if this was issued by an app (60% chance).
-			if rand.Intn(10) <= 6 {
-				issuingAppID = apps[rand.Intn(len(apps))].ID
+			if mathrand.Intn(10) <= 6 {
+				issuingAppID = apps[mathrand.Intn(len(apps))].ID
 
 				// Random determine if the code had an external audit.
-				if rand.Intn(2) == 0 {
+				if mathrand.Intn(2) == 0 {
 					b := make([]byte, 8)
-					if _, err := rand.Read(b); err != nil {
+					if _, err := mathrand.Read(b); err != nil {
 						return fmt.Errorf("failed to read rand: %w", err)
 					}
-					issuingExternalID = externalIDs[rand.Intn(len(externalIDs))]
+					issuingExternalID = externalIDs[mathrand.Intn(len(externalIDs))]
 				}
 			} else {
-				issuingUserID = users[rand.Intn(len(users))].ID
+				issuingUserID = users[mathrand.Intn(len(users))].ID
 			}
 
-			code := fmt.Sprintf("%08d", rand.Intn(99999999))
-			longCode := fmt.Sprintf("%015d", rand.Intn(999999999999999))
+			code := fmt.Sprintf("%08d", mathrand.Intn(99999999))
+			longCode := fmt.Sprintf("%015d", mathrand.Intn(999999999999999))
 			testDate := now.Add(-48 * time.Hour)
 
 			verificationCode := &database.VerificationCode{
@@ -266,18 +269,23 @@ func realMain(ctx context.Context) error {
 				IssuingExternalID: issuingExternalID,
 			}
 			// If a verification code already exists, it will fail to save, and we retry.
-			if err := db.SaveVerificationCode(verificationCode, 672*time.Hour); err != nil {
+			if err := db.SaveVerificationCode(ctx, verificationCode, 672*time.Hour); err != nil {
 				return fmt.Errorf("failed to create verification code: %w", err)
 			}
 
 			// 40% chance that the code is claimed
-			if rand.Intn(10) <= 4 {
+			if mathrand.Intn(10) <= 4 {
 				accept := map[string]struct{}{
 					api.TestTypeConfirmed: {},
 					api.TestTypeLikely:    {},
 					api.TestTypeNegative:  {},
 				}
-				if _, err := db.VerifyCodeAndIssueToken(realm1.ID, code, accept, 24*time.Hour); err != nil {
+				if _, err := db.VerifyCodeAndIssueToken(ctx, &database.IssueTokenRequest{
+					RealmID:          realm1.ID,
+					VerificationCode: code,
+					AcceptTypes:      accept,
+					ExpireAfter:      24 * time.Hour,
+				}); err != nil {
 					return fmt.Errorf("failed to claim token: %w", err)
 				}
 			}